@@ -0,0 +1,270 @@
+// Package activity manages the activity supertype. Points of contact and documents each own an
+// activity row keyed by activity_id; every subtype registers its tables, loader, summarizer and
+// read permissions here so creating, deleting, loading and summarizing work the same for all of them.
+package activity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// Table is one table of a subtype, keyed by the activity ID
+type Table struct {
+	Name     string
+	IDColumn string
+	// Alias names the table in conditions passed to Delete
+	Alias string
+}
+
+// Type is a registered activity subtype
+type Type struct {
+	// Name is stored in activity.activity_type
+	Name string
+	// Tables hold the subtype rows, parents first; they are deleted together with the activity row
+	Tables []Table
+	// StudentColumn is the column of the last table naming the student the activity is about,
+	// empty when the subtype does not belong to a student
+	StudentColumn string
+	// Roles may read activities of this type; students only read their own
+	Roles []string
+	// Load returns a single activity as its model, sql.ErrNoRows when it does not exist
+	Load func(ctx context.Context, q utils.DBTX, id int) (any, error)
+	// Summarize fills in the type specific parts of summaries keyed by activity ID, nil leaves
+	// the type out of the activity summary
+	Summarize func(ctx context.Context, q utils.DBTX, summaries map[int]*Summary) error
+}
+
+// Person is the student or admin named on a summary
+type Person struct {
+	ID            int    `json:"id"`
+	FirstName     string `json:"first_name"`
+	PreferredName string `json:"preferred_name"`
+	LastName      string `json:"last_name"`
+}
+
+// Summary is an activity as listed by the activity summary; fields that do not apply to its type stay empty
+type Summary struct {
+	ActivityID       int        `json:"activity_id"`
+	ActivityDateTime time.Time  `json:"activity_datetime"`
+	Type             string     `json:"type"`
+	DocType          *string    `json:"doc_type,omitempty"`
+	FileName         *string    `json:"file_name,omitempty"`
+	EventDateTime    *time.Time `json:"event_datetime,omitempty"`
+	Duration         *int       `json:"duration,omitempty"`
+	EventType        *string    `json:"event_type,omitempty"`
+	Student          Person     `json:"student"`
+	Admins           []Person   `json:"admins,omitempty"`
+}
+
+// ErrUnknownType is returned for activity types that were never registered
+var ErrUnknownType = errors.New("unknown activity type")
+
+var (
+	types = map[string]*Type{}
+	order []string
+)
+
+// Register adds an activity subtype. It panics on duplicates because types are registered by the program itself.
+func Register(t Type) {
+	if _, ok := types[t.Name]; ok {
+		panic("activity: duplicate type " + t.Name)
+	}
+	if len(t.Tables) == 0 {
+		panic("activity: type " + t.Name + " has no tables")
+	}
+	types[t.Name] = &t
+	order = append(order, t.Name)
+}
+
+// Lookup returns a registered type
+func Lookup(name string) (*Type, error) {
+	t, ok := types[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, name)
+	}
+	return t, nil
+}
+
+// Summarizable lists the types shown on the activity summary, in registration order
+func Summarizable() []string {
+	var names []string
+	for _, name := range order {
+		if types[name].Summarize != nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Create inserts the activity row of a new activity and returns its ID. The caller inserts the
+// subtype rows with that ID in the same transaction.
+func Create(ctx context.Context, tx *sql.Tx, typeName string, at time.Time) (int64, error) {
+	if _, err := Lookup(typeName); err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO activity (activity_datetime, activity_type) VALUES (?, ?)",
+		at, typeName,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// Delete removes the activities of a type matching condition, written against the table aliases,
+// together with all of their subtype rows. It returns the number of activities deleted.
+func Delete(ctx context.Context, q utils.DBTX, typeName, condition string, args ...any) (int64, error) {
+	t, err := Lookup(typeName)
+	if err != nil {
+		return 0, err
+	}
+
+	aliases := []string{"a"}
+	var joins []string
+	for _, table := range t.Tables {
+		aliases = append(aliases, table.Alias)
+		joins = append(joins, fmt.Sprintf("JOIN %s %s ON %s.%s = a.activity_id", table.Name, table.Alias, table.Alias, table.IDColumn))
+	}
+	query := fmt.Sprintf("DELETE %s FROM activity a %s WHERE a.activity_type = ? AND (%s)",
+		strings.Join(aliases, ", "), strings.Join(joins, " "), condition)
+
+	res, err := q.ExecContext(ctx, query, append([]any{typeName}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows / int64(len(aliases)), nil
+}
+
+// TypeOf returns the type of an activity, sql.ErrNoRows when it does not exist
+func TypeOf(ctx context.Context, q utils.DBTX, id int) (string, error) {
+	var name string
+	err := q.QueryRowContext(ctx, "SELECT activity_type FROM activity WHERE activity_id = ?", id).Scan(&name)
+	return name, err
+}
+
+// CanRead reports whether a user may read an activity of the type: the role must be allowed by
+// the type, and students must be the student it is about
+func CanRead(ctx context.Context, q utils.DBTX, t *Type, role string, userID, id int) (bool, error) {
+	allowed := role == "superadmin"
+	for _, r := range t.Roles {
+		allowed = allowed || r == role
+	}
+	if !allowed || role != "student" {
+		return allowed, nil
+	}
+	if t.StudentColumn == "" {
+		return false, nil
+	}
+
+	last := t.Tables[len(t.Tables)-1]
+	var ownerID int
+	err := q.QueryRowContext(ctx,
+		fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", t.StudentColumn, last.Name, last.IDColumn), id,
+	).Scan(&ownerID)
+	if err != nil {
+		return false, err
+	}
+	return ownerID == userID, nil
+}
+
+// StudentScope returns a subquery selecting the activity IDs of the given types that belong to a
+// student, with one argument per placeholder
+func StudentScope(names []string, studentID any) (string, []any) {
+	var parts []string
+	var args []any
+	for _, name := range names {
+		t, ok := types[name]
+		if !ok || t.StudentColumn == "" {
+			continue
+		}
+		last := t.Tables[len(t.Tables)-1]
+		parts = append(parts, fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", last.IDColumn, last.Name, t.StudentColumn))
+		args = append(args, studentID)
+	}
+	if len(parts) == 0 {
+		return "SELECT NULL FROM DUAL WHERE FALSE", nil
+	}
+	return strings.Join(parts, " UNION "), args
+}
+
+// summaryBatch bounds the IDs handed to one summarizer call so queries stay under the placeholder limit
+const summaryBatch = 1000
+
+// Summarize runs each type's summarizer over the summaries of that type in batches, so the number of
+// queries depends on the number of types and batches rather than on the number of rows
+func Summarize(ctx context.Context, q utils.DBTX, summaries []*Summary) error {
+	type batch struct {
+		t     *Type
+		items map[int]*Summary
+	}
+	var batches []*batch
+	current := map[string]*batch{}
+	for _, s := range summaries {
+		t, ok := types[s.Type]
+		if !ok || t.Summarize == nil {
+			continue
+		}
+		b := current[s.Type]
+		if b == nil || len(b.items) == summaryBatch {
+			b = &batch{t: t, items: map[int]*Summary{}}
+			current[s.Type] = b
+			batches = append(batches, b)
+		}
+		b.items[s.ActivityID] = s
+	}
+	for _, b := range batches {
+		if err := b.t.Summarize(ctx, q, b.items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Admins loads the admins of every point of contact selected by pocIDs, a subquery returning
+// point_of_contact_id values or a list of placeholders, in one query. The aliases differ from the
+// summary queries so pocIDs can reuse their FROM clause.
+func Admins(ctx context.Context, q utils.DBTX, pocIDs string, args []any) (map[int][]Person, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT pca.point_of_contact_id, ap.person_id, ap.first_name, ap.preferred_name, ap.last_name
+		FROM poc_admin pca
+		INNER JOIN admin ad ON ad.admin_id = pca.admin_id
+		INNER JOIN person ap ON ap.person_id = ad.admin_id
+		WHERE pca.point_of_contact_id IN (`+pocIDs+`)
+		ORDER BY pca.point_of_contact_id, ap.person_id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	admins := map[int][]Person{}
+	for rows.Next() {
+		var pocID int
+		var adm Person
+		if err := rows.Scan(&pocID, &adm.ID, &adm.FirstName, &adm.PreferredName, &adm.LastName); err != nil {
+			return nil, err
+		}
+		admins[pocID] = append(admins[pocID], adm)
+	}
+	return admins, rows.Err()
+}
+
+// placeholders returns the IDs of a batch as "?,?,?" and its arguments
+func placeholders(summaries map[int]*Summary) (string, []any) {
+	args := make([]any, 0, len(summaries))
+	for id := range summaries {
+		args = append(args, id)
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", len(args)), ","), args
+}
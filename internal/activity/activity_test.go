@@ -0,0 +1,102 @@
+package activity
+
+import (
+	"context"
+	"database/sql/driver"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// panicked returns the message fn panicked with, empty when it returned
+func panicked(fn func()) (message string) {
+	defer func() { message, _ = recover().(string) }()
+	fn()
+	return ""
+}
+
+func TestRegisterRefusesDuplicates(t *testing.T) {
+	note := Type{Name: "test_register", Tables: []Table{{Name: "note", IDColumn: "note_id", Alias: "n"}}}
+	Register(note)
+	if _, err := Lookup("test_register"); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := panicked(func() { Register(note) }); !strings.Contains(r, "duplicate type test_register") {
+		t.Fatalf("second Register panicked with %q", r)
+	}
+	if r := panicked(func() { Register(Type{Name: "test_no_tables"}) }); !strings.Contains(r, "has no tables") {
+		t.Fatalf("Register without tables panicked with %q", r)
+	}
+	if _, err := Lookup("test_no_tables"); err == nil {
+		t.Fatal("a refused type was registered")
+	}
+}
+
+func TestDeleteCountsActivities(t *testing.T) {
+	Register(Type{Name: "test_delete", Tables: []Table{
+		{Name: "documentation", IDColumn: "documentation_id", Alias: "d"},
+		{Name: "specific_documentation", IDColumn: "specific_documentation_id", Alias: "sd"},
+	}})
+
+	// Two activities each remove their activity row and both subtype rows
+	d := &testdb.DB{Exec: func(query string, args []driver.Value) (testdb.Result, error) {
+		return testdb.Result{Affected: 6}, nil
+	}}
+	deleted, err := Delete(context.Background(), d.Open(t), "test_delete", "sd.student_id = ?", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Fatalf("Delete = %d, want 2 activities", deleted)
+	}
+
+	want := "DELETE a, d, sd FROM activity a JOIN documentation d ON d.documentation_id = a.activity_id " +
+		"JOIN specific_documentation sd ON sd.specific_documentation_id = a.activity_id WHERE a.activity_type = ? AND (sd.student_id = ?)"
+	if statements := d.Statements(); len(statements) != 1 || statements[0] != want {
+		t.Fatalf("statements = %q, want %q", statements, want)
+	}
+
+	if _, err := Delete(context.Background(), d.Open(t), "test_missing", "TRUE"); err == nil {
+		t.Fatal("Delete of an unknown type succeeded")
+	}
+}
+
+func TestSummarizeBatches(t *testing.T) {
+	var big, small []int
+	Register(Type{Name: "test_big", Tables: []Table{{Name: "big", IDColumn: "big_id", Alias: "b"}},
+		Summarize: func(ctx context.Context, q utils.DBTX, summaries map[int]*Summary) error {
+			big = append(big, len(summaries))
+			return nil
+		}})
+	Register(Type{Name: "test_small", Tables: []Table{{Name: "small", IDColumn: "small_id", Alias: "s"}},
+		Summarize: func(ctx context.Context, q utils.DBTX, summaries map[int]*Summary) error {
+			small = append(small, len(summaries))
+			return nil
+		}})
+	Register(Type{Name: "test_unsummarized", Tables: []Table{{Name: "other", IDColumn: "other_id", Alias: "o"}}})
+
+	// The types are interleaved, with entries the summarizers do not know
+	var summaries []*Summary
+	for id := 1; id <= 2500; id++ {
+		summaries = append(summaries, &Summary{ActivityID: id, Type: "test_big"})
+		if id%250 == 0 {
+			summaries = append(summaries,
+				&Summary{ActivityID: 10000 + id, Type: "test_small"},
+				&Summary{ActivityID: 20000 + id, Type: "test_unsummarized"},
+				&Summary{ActivityID: 30000 + id, Type: "test_unregistered"})
+		}
+	}
+	if err := Summarize(context.Background(), nil, summaries); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(big, []int{summaryBatch, summaryBatch, 500}) || !slices.Equal(small, []int{10}) {
+		t.Fatalf("batches of %v and %v, want 1000, 1000 and 500 and one of 10", big, small)
+	}
+	if slices.Contains(Summarizable(), "test_unsummarized") {
+		t.Fatal("a type without a summarizer is summarizable")
+	}
+}
@@ -0,0 +1,181 @@
+package activity
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// Activity types stored in activity.activity_type
+const (
+	TypePointOfContact        = "point_of_contact"
+	TypeSpecificDocumentation = "specific_documentation"
+	TypePersonalDocumentation = "personal_documentation"
+)
+
+func init() {
+	Register(Type{
+		Name:          TypePointOfContact,
+		Tables:        []Table{{Name: "point_of_contact", IDColumn: "point_of_contact_id", Alias: "poc"}},
+		StudentColumn: "student_id",
+		Roles:         []string{"student", "admin"},
+		Load:          loadPointOfContact,
+		Summarize:     summarizePointsOfContact,
+	})
+	Register(Type{
+		Name: TypeSpecificDocumentation,
+		Tables: []Table{
+			{Name: "documentation", IDColumn: "documentation_id", Alias: "d"},
+			{Name: "specific_documentation", IDColumn: "specific_documentation_id", Alias: "sd"},
+		},
+		StudentColumn: "student_id",
+		Roles:         []string{"student", "admin"},
+		Load:          loadSpecificDocumentation,
+		Summarize:     summarizeSpecificDocumentation,
+	})
+	// Personal documents belong to an admin and are not part of the activity summary
+	Register(Type{
+		Name: TypePersonalDocumentation,
+		Tables: []Table{
+			{Name: "documentation", IDColumn: "documentation_id", Alias: "d"},
+			{Name: "personal_documentation", IDColumn: "personal_documentation_id", Alias: "pd"},
+		},
+		Roles: []string{"admin"},
+		Load:  loadPersonalDocumentation,
+	})
+}
+
+func loadPointOfContact(ctx context.Context, q utils.DBTX, id int) (any, error) {
+	var poc models.PointOfContact
+	err := q.QueryRowContext(ctx, `
+		SELECT poc.point_of_contact_id, a.activity_datetime, poc.event_datetime, poc.duration, poc.event_type, poc.student_id
+		FROM point_of_contact poc
+		JOIN activity a ON a.activity_id = poc.point_of_contact_id
+		WHERE poc.point_of_contact_id = ?
+	`, id).Scan(&poc.PointOfContactID, &poc.ActivityDateTime, &poc.EventDateTime, &poc.Duration, &poc.EventType, &poc.StudentID)
+	return poc, err
+}
+
+func loadSpecificDocumentation(ctx context.Context, q utils.DBTX, id int) (any, error) {
+	var sd models.SpecificDocumentation
+	err := q.QueryRowContext(ctx, `
+		SELECT sd.specific_documentation_id, sd.student_id, sd.doc_type, a.activity_datetime,
+			d.file_name, d.storage_key, d.mime_type, d.size_bytes, d.uploaded_by
+		FROM specific_documentation sd
+		JOIN activity a ON a.activity_id = sd.specific_documentation_id
+		JOIN documentation d ON d.documentation_id = sd.specific_documentation_id
+		WHERE sd.specific_documentation_id = ? AND d.deleted_at IS NULL
+	`, id).Scan(&sd.SpecificDocumentationID, &sd.StudentID, &sd.DocType, &sd.ActivityDateTime,
+		&sd.FileName, &sd.StorageKey, &sd.MimeType, &sd.SizeBytes, &sd.UploadedBy)
+	return sd, err
+}
+
+func loadPersonalDocumentation(ctx context.Context, q utils.DBTX, id int) (any, error) {
+	var pd models.PersonalDocumentation
+	err := q.QueryRowContext(ctx, `
+		SELECT pd.personal_documentation_id, pd.admin_id, a.activity_datetime,
+			d.file_name, d.storage_key, d.mime_type, d.size_bytes, d.uploaded_by
+		FROM personal_documentation pd
+		JOIN activity a ON a.activity_id = pd.personal_documentation_id
+		JOIN documentation d ON d.documentation_id = pd.personal_documentation_id
+		WHERE pd.personal_documentation_id = ? AND d.deleted_at IS NULL
+	`, id).Scan(&pd.PersonalDocumentationID, &pd.AdminID, &pd.ActivityDateTime,
+		&pd.FileName, &pd.StorageKey, &pd.MimeType, &pd.SizeBytes, &pd.UploadedBy)
+	return pd, err
+}
+
+// summarizePointsOfContact adds the appointment details, student and admins in two queries
+func summarizePointsOfContact(ctx context.Context, q utils.DBTX, summaries map[int]*Summary) error {
+	ids, args := placeholders(summaries)
+	rows, err := q.QueryContext(ctx, `
+		SELECT poc.point_of_contact_id, poc.event_datetime, poc.duration, poc.event_type,
+			sp.person_id, sp.first_name, sp.preferred_name, sp.last_name
+		FROM point_of_contact poc
+		LEFT JOIN person sp ON sp.person_id = poc.student_id
+		WHERE poc.point_of_contact_id IN (`+ids+`)
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, duration int
+		var eventDateTime time.Time
+		var eventType string
+		var student nullPerson
+		if err := rows.Scan(append([]any{&id, &eventDateTime, &duration, &eventType}, student.dest()...)...); err != nil {
+			return err
+		}
+		s := summaries[id]
+		s.EventDateTime = &eventDateTime
+		s.Duration = &duration
+		s.EventType = &eventType
+		s.Student = student.person()
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	admins, err := Admins(ctx, q, ids, args)
+	if err != nil {
+		return err
+	}
+	for id, list := range admins {
+		summaries[id].Admins = list
+	}
+	return nil
+}
+
+// summarizeSpecificDocumentation adds the document details and student in one query
+func summarizeSpecificDocumentation(ctx context.Context, q utils.DBTX, summaries map[int]*Summary) error {
+	ids, args := placeholders(summaries)
+	rows, err := q.QueryContext(ctx, `
+		SELECT sd.specific_documentation_id, sd.doc_type, d.file_name,
+			sp.person_id, sp.first_name, sp.preferred_name, sp.last_name
+		FROM specific_documentation sd
+		INNER JOIN documentation d ON d.documentation_id = sd.specific_documentation_id
+		LEFT JOIN person sp ON sp.person_id = sd.student_id
+		WHERE sd.specific_documentation_id IN (`+ids+`)
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var docType, fileName string
+		var student nullPerson
+		if err := rows.Scan(append([]any{&id, &docType, &fileName}, student.dest()...)...); err != nil {
+			return err
+		}
+		s := summaries[id]
+		s.DocType = &docType
+		s.FileName = &fileName
+		s.Student = student.person()
+	}
+	return rows.Err()
+}
+
+// nullPerson scans a person from a LEFT JOIN that may not have matched
+type nullPerson struct {
+	id                                 sql.NullInt64
+	firstName, preferredName, lastName sql.NullString
+}
+
+func (p *nullPerson) dest() []any {
+	return []any{&p.id, &p.firstName, &p.preferredName, &p.lastName}
+}
+
+func (p *nullPerson) person() Person {
+	return Person{
+		ID:            int(p.id.Int64),
+		FirstName:     p.firstName.String,
+		PreferredName: p.preferredName.String,
+		LastName:      p.lastName.String,
+	}
+}
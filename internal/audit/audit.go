@@ -0,0 +1,334 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionDelete   = "delete"
+	ActionDownload = "download"
+	ActionExport   = "export"
+)
+
+// Entry is a single audit log record. Entries are append-only and chained by hash.
+type Entry struct {
+	AuditID      int64           `json:"audit_id"`
+	CreatedAt    time.Time       `json:"created_at"`
+	ActorID      *int            `json:"actor_id"`
+	Role         string          `json:"role"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resource_type"`
+	ResourceID   string          `json:"resource_id"`
+	Before       json.RawMessage `json:"before,omitempty"`
+	After        json.RawMessage `json:"after,omitempty"`
+	Changes      json.RawMessage `json:"changes,omitempty"`
+	IP           string          `json:"ip"`
+	RequestID    string          `json:"request_id"`
+	PrevHash     string          `json:"prev_hash"`
+	Hash         string          `json:"hash"`
+}
+
+// Filter narrows the audit log listing, zero values match everything
+type Filter struct {
+	ActorID      *int
+	Role         string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	RequestID    string
+	From         time.Time
+	To           time.Time
+	Limit        int
+	Offset       int
+}
+
+// Record appends an entry to the audit log in its own transaction
+func Record(ctx context.Context, db *sql.DB, e *Entry) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := Append(ctx, tx, e); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Append writes an entry inside tx, linking it to the previous entry's hash. Handlers that own the
+// transaction of a change append its entry there, so the change and its audit entry commit together.
+//
+// The chain is global: the single audit_chain_head row is locked FOR UPDATE until tx ends, so all
+// audited writes across every resource run one at a time through that lock. This keeps one total
+// order that Verify can check, at the cost of throughput; transactions that append should
+// do their slow work (file uploads, scans) before appending and commit right after.
+func Append(ctx context.Context, tx *sql.Tx, e *Entry) error {
+	// The chain head row serialises writers so every entry links to exactly one predecessor
+	if err := tx.QueryRowContext(ctx, "SELECT hash FROM audit_chain_head WHERE id = 1 FOR UPDATE").Scan(&e.PrevHash); err != nil {
+		return err
+	}
+
+	// DATETIME(6) keeps microseconds, so the hash is computed on the stored precision
+	e.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	if len(e.Changes) == 0 {
+		e.Changes = utils.JSONDiff(e.Before, e.After)
+	}
+
+	// Encrypted columns stay encrypted in their copies, the hash covers the sealed text as stored
+	if err := e.seal(); err != nil {
+		return err
+	}
+	e.Hash = e.computeHash()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO audit_log (
+			created_at, actor_id, role, action, resource_type, resource_id,
+			before_data, after_data, changes, ip, request_id, prev_hash, hash
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.CreatedAt, e.ActorID, e.Role, e.Action, e.ResourceType, e.ResourceID,
+		nullableJSON(e.Before), nullableJSON(e.After), nullableJSON(e.Changes),
+		e.IP, e.RequestID, e.PrevHash, e.Hash,
+	)
+	if err != nil {
+		return err
+	}
+	if e.AuditID, err = res.LastInsertId(); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE audit_chain_head SET hash = ? WHERE id = 1", e.Hash)
+	return err
+}
+
+// List returns audit entries matching the filter, newest first
+func List(ctx context.Context, db *sql.DB, f Filter) ([]Entry, error) {
+	where := []string{}
+	args := []any{}
+
+	if f.ActorID != nil {
+		where = append(where, "actor_id = ?")
+		args = append(args, *f.ActorID)
+	}
+	for column, value := range map[string]string{
+		"role":          f.Role,
+		"action":        f.Action,
+		"resource_type": f.ResourceType,
+		"resource_id":   f.ResourceID,
+		"request_id":    f.RequestID,
+	} {
+		if value != "" {
+			where = append(where, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	if !f.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, f.To.UTC())
+	}
+
+	query := selectEntries
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	limit := f.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	query += " ORDER BY audit_id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, f.Offset)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]Entry, 0)
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		if err := e.open(); err != nil {
+			return nil, fmt.Errorf("audit entry %d: %w", e.AuditID, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Verify walks the whole chain and returns the ID of the first entry whose hash or link does not match
+// (0 when the log is intact) and the number of entries checked before it
+func Verify(ctx context.Context, db *sql.DB) (int64, int, error) {
+	rows, err := db.QueryContext(ctx, selectEntries+" ORDER BY audit_id ASC")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+
+	prev := ""
+	checked := 0
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return 0, checked, err
+		}
+		if e.PrevHash != prev || e.computeHash() != e.Hash {
+			return e.AuditID, checked, nil
+		}
+		prev = e.Hash
+		checked++
+	}
+	return 0, checked, rows.Err()
+}
+
+const selectEntries = `
+	SELECT audit_id, created_at, actor_id, role, action, resource_type, resource_id,
+		before_data, after_data, changes, ip, request_id, prev_hash, hash
+	FROM audit_log
+`
+
+func scanEntry(rows *sql.Rows) (Entry, error) {
+	var e Entry
+	var actorID sql.NullInt64
+	var before, after, changes sql.NullString
+	err := rows.Scan(
+		&e.AuditID, &e.CreatedAt, &actorID, &e.Role, &e.Action, &e.ResourceType, &e.ResourceID,
+		&before, &after, &changes, &e.IP, &e.RequestID, &e.PrevHash, &e.Hash,
+	)
+	if err != nil {
+		return e, err
+	}
+	if actorID.Valid {
+		id := int(actorID.Int64)
+		e.ActorID = &id
+	}
+	if before.Valid {
+		e.Before = json.RawMessage(before.String)
+	}
+	if after.Valid {
+		e.After = json.RawMessage(after.String)
+	}
+	if changes.Valid {
+		e.Changes = json.RawMessage(changes.String)
+	}
+	e.CreatedAt = e.CreatedAt.UTC()
+	return e, nil
+}
+
+// sealedFields returns the JSON fields of a resource type that copy encrypted columns
+func sealedFields(resourceType string) map[string]string {
+	if resourceType != "stu_dis" {
+		return fieldcrypt.PersonFields
+	}
+	fields := map[string]string{"disability_id": fieldcrypt.StuDisDisabilityID}
+	for field, column := range fieldcrypt.PersonFields {
+		fields[field] = column
+	}
+	return fields
+}
+
+// seal encrypts the copies of encrypted columns in the entry's resource ID and data
+func (e *Entry) seal() error {
+	fields := sealedFields(e.ResourceType)
+	for _, data := range []*json.RawMessage{&e.Before, &e.After, &e.Changes} {
+		if len(*data) == 0 {
+			continue
+		}
+		sealed, err := fieldcrypt.SealJSON(*data, fields)
+		if err != nil {
+			return err
+		}
+		*data = sealed
+	}
+
+	parts := strings.Split(e.ResourceID, ",")
+	for i, part := range parts {
+		key, value, ok := strings.Cut(part, "=")
+		if column, sealed := fields[key]; ok && sealed {
+			value, err := fieldcrypt.Encrypt(column, value)
+			if err != nil {
+				return err
+			}
+			parts[i] = key + "=" + value
+		}
+	}
+	e.ResourceID = strings.Join(parts, ",")
+	return nil
+}
+
+// open decrypts what seal encrypted, for listing. Verify works on the stored text and needs no keys.
+func (e *Entry) open() error {
+	fields := sealedFields(e.ResourceType)
+	for _, data := range []*json.RawMessage{&e.Before, &e.After, &e.Changes} {
+		if len(*data) == 0 {
+			continue
+		}
+		opened, err := fieldcrypt.OpenJSON(*data, fields)
+		if err != nil {
+			return err
+		}
+		*data = opened
+	}
+
+	parts := strings.Split(e.ResourceID, ",")
+	for i, part := range parts {
+		key, value, ok := strings.Cut(part, "=")
+		if column, sealed := fields[key]; ok && sealed && fieldcrypt.IsEncrypted(value) {
+			value, err := fieldcrypt.Decrypt(column, value)
+			if err != nil {
+				return err
+			}
+			parts[i] = key + "=" + value
+		}
+	}
+	e.ResourceID = strings.Join(parts, ",")
+	return nil
+}
+
+// computeHash covers every stored field and the previous hash
+func (e *Entry) computeHash() string {
+	actor := ""
+	if e.ActorID != nil {
+		actor = fmt.Sprint(*e.ActorID)
+	}
+
+	h := sha256.New()
+	for _, part := range []string{
+		e.PrevHash,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		actor, e.Role, e.Action, e.ResourceType, e.ResourceID,
+		string(e.Before), string(e.After), string(e.Changes),
+		e.IP, e.RequestID,
+	} {
+		// Length prefixes keep field boundaries unambiguous
+		fmt.Fprintf(h, "%d:%s|", len(part), part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func nullableJSON(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
@@ -0,0 +1,367 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// maxCapturedBody bounds the request and response bodies kept for the audit trail
+const maxCapturedBody = 64 << 10
+
+// Middleware records successful POST, PUT, PATCH and DELETE requests of a resource.
+// snapshot is the resource's GET-by-ID handler, used to capture the state before and after the change;
+// without one the JSON request body is recorded as the new state.
+//
+// The response is held back until the entry is written, so a client that reads the audit log after
+// a success finds the entry. The handler has committed by then: a change whose entry cannot be
+// written is still answered with its success response, since a 500 would make clients retry and
+// create duplicates, and the gap is logged as an alert with the entry so it can be reconstructed.
+// Handlers that must not commit without their entry append it in their own transaction instead.
+func Middleware(db *sql.DB, resourceType, idVar string, snapshot http.HandlerFunc, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := actionFor(r.Method)
+		if action == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Captures the state before the change
+		var before json.RawMessage
+		if snapshot != nil && action != ActionCreate {
+			before = capture(snapshot, r, mux.Vars(r))
+		}
+
+		// Keeps a copy of JSON request bodies, uploads are never buffered
+		var requestBody []byte
+		if isJSON(r.Header.Get("Content-Type")) && r.Body != nil {
+			requestBody, _ = io.ReadAll(io.LimitReader(r.Body, maxCapturedBody))
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(requestBody), r.Body))
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK, hold: true}
+		next.ServeHTTP(rec, r)
+
+		// Only changes that happened are recorded
+		if rec.status < 200 || rec.status >= 300 {
+			rec.release()
+			return
+		}
+
+		vars := mux.Vars(r)
+		resourceID := vars[idVar]
+		if resourceID == "" && action == ActionCreate {
+			resourceID = createdID(rec.body.Bytes(), idVar)
+		}
+		if resourceID == "" {
+			resourceID = compositeID(r, requestBody)
+		}
+
+		// Captures the state after the change
+		var after json.RawMessage
+		if action != ActionDelete {
+			if snapshot != nil && idVar != "" && resourceID != "" {
+				after = capture(snapshot, r, map[string]string{idVar: resourceID})
+			}
+			if after == nil {
+				after = redact(requestBody)
+			}
+		}
+
+		err := RecordRequest(db, r, &Entry{
+			Action:       action,
+			ResourceType: resourceType,
+			ResourceID:   resourceID,
+			Before:       before,
+			After:        after,
+		})
+		if err != nil {
+			alertUnrecorded(r, resourceType, resourceID, action, rec.status)
+		}
+		rec.release()
+	})
+}
+
+// alertUnrecorded logs a committed change that is missing from the audit log, with enough to find
+// the request and write the entry by hand
+func alertUnrecorded(r *http.Request, resourceType, resourceID, action string, status int) {
+	actor := "unknown"
+	if userID, ok := r.Context().Value(utils.UserIDKey).(int); ok {
+		actor = fmt.Sprint(userID)
+	}
+	log.Printf("🚨 AUDIT GAP: %s %s %s by user %s (%s %s, request %s) committed with status %d but has no audit entry\n",
+		action, resourceType, resourceID, actor, r.Method, r.URL.Path, utils.RequestID(r), status)
+}
+
+// RelationshipEntry describes a change to a relationship resource made outside Middleware, such as one
+// operation of a batch, the same way Middleware records it. The caller records it once the change committed.
+func RelationshipEntry(r *http.Request, resourceType string, requestBody []byte) *Entry {
+	e := &Entry{
+		Action:       actionFor(r.Method),
+		ResourceType: resourceType,
+		ResourceID:   compositeID(r, requestBody),
+	}
+	if e.Action != ActionDelete {
+		e.After = redact(requestBody)
+	}
+	return e
+}
+
+// DownloadMiddleware records successful file downloads of a resource. The entry is written before
+// the response status is sent, a download whose entry cannot be written is refused with a 500.
+func DownloadMiddleware(db *sql.DB, resourceType, idVar string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK, discard: true}
+		rec.beforeHeader = func(status int) error {
+			// A redirect to a presigned URL hands the file out as well
+			if (status < 200 || status >= 300) && status != http.StatusTemporaryRedirect {
+				return nil
+			}
+			return RecordRequest(db, r, &Entry{
+				Action:       ActionDownload,
+				ResourceType: resourceType,
+				ResourceID:   mux.Vars(r)[idVar],
+			})
+		}
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// RecordRequest fills in who and where from the request and appends the entry. It also runs when
+// the client already left, the change it records happened anyway. Failures are logged and returned
+// so callers can refuse to report success.
+func RecordRequest(db *sql.DB, r *http.Request, e *Entry) error {
+	fromRequest(r, e)
+	err := Record(context.WithoutCancel(r.Context()), db, e)
+	if err != nil {
+		log.Printf("Audit write error (%s %s %s): %v\n", e.Action, e.ResourceType, e.ResourceID, err)
+	}
+	return err
+}
+
+// AppendRequest is RecordRequest for handlers that write the entry in the transaction of the change
+func AppendRequest(tx *sql.Tx, r *http.Request, e *Entry) error {
+	fromRequest(r, e)
+	err := Append(context.WithoutCancel(r.Context()), tx, e)
+	if err != nil {
+		log.Printf("Audit write error (%s %s %s): %v\n", e.Action, e.ResourceType, e.ResourceID, err)
+	}
+	return err
+}
+
+// fromRequest fills in who made the request and from where
+func fromRequest(r *http.Request, e *Entry) {
+	if userID, ok := r.Context().Value(utils.UserIDKey).(int); ok {
+		e.ActorID = &userID
+	}
+	e.Role, _ = r.Context().Value(utils.RoleKey).(string)
+	e.IP = utils.ClientIP(r)
+	e.RequestID = utils.RequestID(r)
+}
+
+// discardHeaders removes the headers of a response that is replaced by an error
+func discardHeaders(h http.Header) {
+	for _, name := range []string{"Content-Length", "Content-Range", "Content-Disposition", "Content-Encoding",
+		"ETag", "Last-Modified", "Location", "Accept-Ranges"} {
+		h.Del(name)
+	}
+}
+
+// capture runs a GET handler against the given route variables and returns its JSON body
+func capture(snapshot http.HandlerFunc, r *http.Request, vars map[string]string) json.RawMessage {
+	// Snapshots after the change are taken even when the client already left
+	req := mux.SetURLVars(r.Clone(context.WithoutCancel(r.Context())), vars)
+	req.Method = http.MethodGet
+	req.Body = http.NoBody
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Match")
+
+	rec := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+	snapshot(rec, req)
+
+	body := rec.body.Bytes()
+	if rec.status != http.StatusOK || !json.Valid(body) {
+		return nil
+	}
+
+	// Compacts the indented handler output
+	var out bytes.Buffer
+	if err := json.Compact(&out, body); err != nil {
+		return nil
+	}
+	return out.Bytes()
+}
+
+// createdID finds the new resource ID in a create response such as {"studentId": 4} or {"id": 4}
+func createdID(body []byte, idVar string) string {
+	var payload map[string]any
+	if json.Unmarshal(body, &payload) != nil {
+		return ""
+	}
+
+	for _, key := range []string{idVar, "id"} {
+		if value, ok := payload[key]; ok && key != "" {
+			return fmt.Sprint(value)
+		}
+	}
+	for key, value := range payload {
+		if strings.HasSuffix(key, "_id") || strings.HasSuffix(key, "Id") {
+			return fmt.Sprint(value)
+		}
+	}
+	return ""
+}
+
+// compositeID identifies relationship rows by all of their key columns, e.g. "admin_id=1,student_id=2",
+// taken from the route, the query string and the JSON body
+func compositeID(r *http.Request, body []byte) string {
+	keys := map[string]string{}
+	for key, value := range mux.Vars(r) {
+		keys[key] = value
+	}
+	for key, values := range r.URL.Query() {
+		if strings.HasSuffix(key, "_id") && len(values) > 0 {
+			keys[key] = values[0]
+		}
+	}
+
+	var payload map[string]any
+	if json.Unmarshal(body, &payload) == nil {
+		for key, value := range payload {
+			if strings.HasSuffix(key, "_id") {
+				keys[key] = fmt.Sprint(value)
+			}
+		}
+	}
+
+	parts := make([]string, 0, len(keys))
+	for key, value := range keys {
+		parts = append(parts, key+"="+value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// redact returns a JSON request body without credentials such as passwords, invite tokens and webhook secrets, or nil when the body is not a JSON object
+func redact(body []byte) json.RawMessage {
+	var payload map[string]json.RawMessage
+	if json.Unmarshal(body, &payload) != nil {
+		return nil
+	}
+	for key := range payload {
+		if lower := strings.ToLower(key); strings.Contains(lower, "password") || strings.Contains(lower, "token") || strings.Contains(lower, "secret") {
+			delete(payload, key)
+		}
+	}
+
+	out, err := json.Marshal(payload)
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func actionFor(method string) string {
+	switch method {
+	case http.MethodPost:
+		return ActionCreate
+	case http.MethodPut, http.MethodPatch:
+		return ActionUpdate
+	case http.MethodDelete:
+		return ActionDelete
+	}
+	return ""
+}
+
+func isJSON(contentType string) bool {
+	return strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, "application/merge-patch+json")
+}
+
+// responseRecorder tracks the status and keeps a bounded copy of the body.
+// With a nil ResponseWriter it only records, which is how snapshots are taken. With hold set the
+// whole response is kept until release sends it. beforeHeader runs before the status is sent, an
+// error replaces the response with a 500.
+type responseRecorder struct {
+	http.ResponseWriter
+	header       http.Header
+	status       int
+	body         bytes.Buffer
+	discard      bool
+	hold         bool
+	beforeHeader func(status int) error
+	failed       bool
+	wroteHeader  bool
+}
+
+func (rec *responseRecorder) Header() http.Header {
+	if rec.ResponseWriter == nil {
+		return rec.header
+	}
+	return rec.ResponseWriter.Header()
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.wroteHeader = true
+	rec.status = status
+	if rec.beforeHeader != nil {
+		if err := rec.beforeHeader(status); err != nil {
+			rec.failed = true
+			discardHeaders(rec.ResponseWriter.Header())
+			utils.WriteError(rec.ResponseWriter, http.StatusInternalServerError, "Failed to record the request in the audit log")
+			return
+		}
+	}
+	if rec.ResponseWriter != nil && !rec.hold {
+		rec.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.failed {
+		return len(b), nil
+	}
+	if rec.hold || !rec.discard && rec.body.Len() < maxCapturedBody {
+		rec.body.Write(b)
+	}
+	if rec.ResponseWriter == nil || rec.hold {
+		return len(b), nil
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// release sends a held response
+func (rec *responseRecorder) release() {
+	if !rec.hold {
+		return
+	}
+	rec.hold = false
+	rec.ResponseWriter.WriteHeader(rec.status)
+	rec.ResponseWriter.Write(rec.body.Bytes())
+}
+
+// Flush keeps streamed downloads working behind the middleware, held responses are sent by release
+func (rec *responseRecorder) Flush() {
+	if rec.hold || rec.failed {
+		return
+	}
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
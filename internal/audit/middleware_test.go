@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+
+	"github.com/gorilla/mux"
+)
+
+// auditDB is an audit_log table that can be made to refuse writes
+type auditDB struct {
+	testdb.DB
+	fail    bool
+	actions []string
+}
+
+func newAuditDB(fail bool) *auditDB {
+	d := &auditDB{fail: fail}
+	d.Query = func(query string, _ []driver.Value) (*testdb.Rows, error) {
+		if !strings.Contains(query, "FROM audit_chain_head") {
+			return nil, nil
+		}
+		if d.fail {
+			return nil, errors.New("fake: audit_log is unavailable")
+		}
+		// An empty chain
+		return testdb.Row(""), nil
+	}
+	d.Exec = func(query string, args []driver.Value) (testdb.Result, error) {
+		if strings.Contains(query, "INSERT INTO audit_log") {
+			d.actions = append(d.actions, args[3].(string))
+		}
+		return testdb.Result{InsertID: 1, Affected: 1}, nil
+	}
+	return d
+}
+
+func TestMiddlewareKeepsCommittedResponse(t *testing.T) {
+	created := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/disabilities/7")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"disability_id":7}`)
+	})
+	rejected := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad input", http.StatusBadRequest)
+	})
+
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		fail     bool
+		status   int
+		body     string
+		location string
+		actions  int
+	}{
+		{"recorded change is answered", created, false, http.StatusCreated, `{"disability_id":7}`, "/disabilities/7", 1},
+		{"unrecorded change is still answered", created, true, http.StatusCreated, `{"disability_id":7}`, "/disabilities/7", 0},
+		{"failed change is not recorded", rejected, true, http.StatusBadRequest, "bad input", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newAuditDB(tt.fail)
+			h := Middleware(fake.Open(t), "disability", "disability_id", nil, tt.handler)
+
+			req := httptest.NewRequest(http.MethodPost, "/disabilities", strings.NewReader(`{"name":"x"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.body) {
+				t.Fatalf("response = %d %s, want %d containing %q", w.Code, w.Body, tt.status, tt.body)
+			}
+			if got := w.Header().Get("Location"); got != tt.location {
+				t.Fatalf("Location = %q, want %q", got, tt.location)
+			}
+			if len(fake.actions) != tt.actions || fake.Commits() != tt.actions {
+				t.Fatalf("audit rows = %v with %d commits, want %d", fake.actions, fake.Commits(), tt.actions)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRecordsAfterClientLeft(t *testing.T) {
+	fake := newAuditDB(false)
+	ctx, cancel := context.WithCancel(context.Background())
+	h := Middleware(fake.Open(t), "disability", "disability_id", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The client disconnects once the change is committed
+		cancel()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest(http.MethodDelete, "/disabilities/7", nil).WithContext(ctx)
+	req = mux.SetURLVars(req, map[string]string{"disability_id": "7"})
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(fake.actions) != 1 || fake.actions[0] != ActionDelete {
+		t.Fatalf("audit rows = %v, want one delete", fake.actions)
+	}
+}
+
+func TestDownloadMiddlewareFailsClosed(t *testing.T) {
+	file := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="notes.pdf"`)
+		w.Header().Set("Content-Length", "7")
+		io.WriteString(w, "%PDF-1.")
+	})
+
+	for _, fail := range []bool{false, true} {
+		t.Run(fmt.Sprintf("fail=%v", fail), func(t *testing.T) {
+			fake := newAuditDB(fail)
+			h := DownloadMiddleware(fake.Open(t), "documentation", "documentation_id", file)
+
+			req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/documentation/3/file", nil),
+				map[string]string{"documentation_id": "3"})
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if fail {
+				if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "%PDF") {
+					t.Fatalf("response = %d %s, want a 500 without the file", w.Code, w.Body)
+				}
+				if w.Header().Get("Content-Disposition") != "" || w.Header().Get("Content-Length") != "" {
+					t.Fatalf("file headers were kept: %v", w.Header())
+				}
+				return
+			}
+			if w.Code != http.StatusOK || w.Body.String() != "%PDF-1." {
+				t.Fatalf("response = %d %s, want the file", w.Code, w.Body)
+			}
+			if len(fake.actions) != 1 || fake.actions[0] != ActionDownload {
+				t.Fatalf("audit rows = %v, want one download", fake.actions)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Package blobstore stores document files under storage keys such as "specific/12_report.pdf",
+// either in a local directory or in an S3-compatible bucket (AWS S3, MinIO, ...). The
+// documentation table records the key, so the files can move between backends without touching
+// the rows.
+//
+// Configuration comes from the environment:
+//
+//	DOCUMENT_STORAGE        local (default) or s3
+//	DOCUMENT_STORAGE_DIR    root directory of the local store, default /home/piconex/database/files
+//	S3_ENDPOINT             e.g. https://s3.us-east-1.amazonaws.com or http://localhost:9000
+//	S3_REGION               default us-east-1
+//	S3_BUCKET
+//	S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY
+//	S3_PATH_STYLE           address the bucket in the path instead of the host name, default true
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+var (
+	ErrNotFound           = errors.New("blobstore: object not found")
+	ErrInvalidKey         = errors.New("blobstore: invalid storage key")
+	ErrPresignUnsupported = errors.New("blobstore: presigned URLs are not supported by this store")
+)
+
+// Info describes a stored object
+type Info struct {
+	Key         string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// Object is a stored object opened for reading. Reads and ReadAt calls are not safe for
+// concurrent use; sequential ReadAt calls are served from one stream where the store allows it.
+type Object interface {
+	io.ReadSeeker
+	io.ReaderAt
+	io.Closer
+	Info() Info
+}
+
+// BlobStore is where document files live
+type BlobStore interface {
+	// Put stores size bytes read from r under key, replacing any object already there. The object
+	// only becomes visible once it is complete.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object stored under key, ErrNotFound when there is none
+	Get(ctx context.Context, key string) (Object, error)
+	// Stat describes the object stored under key, ErrNotFound when there is none
+	Stat(ctx context.Context, key string) (Info, error)
+	// Delete removes the object stored under key, a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// List calls fn with every object whose key starts with prefix
+	List(ctx context.Context, prefix string, fn func(Info) error) error
+	// Presign returns a URL that allows method ("GET" or "PUT") on key without credentials
+	// until expires has passed, ErrPresignUnsupported when the store cannot hand out URLs
+	Presign(ctx context.Context, method, key string, expires time.Duration, opts PresignOptions) (string, error)
+}
+
+// PresignOptions override the response headers of a presigned GET
+type PresignOptions struct {
+	ContentType        string
+	ContentDisposition string
+}
+
+// Key joins the parts into a storage key and checks it
+func Key(parts ...string) (string, error) {
+	key := path.Join(parts...)
+	return key, ValidKey(key)
+}
+
+// ValidKey rejects keys that are empty, absolute or could escape the store root
+func ValidKey(key string) error {
+	if key == "" || len(key) > 512 || strings.HasPrefix(key, "/") || strings.ContainsAny(key, "\\\x00") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	if path.Clean(key) != key {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." || part == "." {
+			return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+	}
+	return nil
+}
+
+var (
+	defaultOnce  sync.Once
+	defaultStore BlobStore
+	defaultErr   error
+)
+
+// Default returns the store configured in the environment
+func Default() (BlobStore, error) {
+	defaultOnce.Do(func() {
+		defaultStore, defaultErr = fromEnv()
+	})
+	return defaultStore, defaultErr
+}
+
+// Check loads the configured store, so the server can refuse to start with a broken configuration
+func Check() error {
+	_, err := Default()
+	return err
+}
+
+// Backend returns the name of the configured backend
+func Backend() string {
+	return utils.Env("DOCUMENT_STORAGE", "local")
+}
+
+func fromEnv() (BlobStore, error) {
+	switch backend := Backend(); backend {
+	case "local":
+		return NewLocal(utils.Env("DOCUMENT_STORAGE_DIR", "/home/piconex/database/files"))
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:        utils.Env("S3_ENDPOINT", ""),
+			Region:          utils.Env("S3_REGION", "us-east-1"),
+			Bucket:          utils.Env("S3_BUCKET", ""),
+			AccessKeyID:     utils.Env("S3_ACCESS_KEY_ID", ""),
+			SecretAccessKey: utils.Env("S3_SECRET_ACCESS_KEY", ""),
+			PathStyle:       utils.Env("S3_PATH_STYLE", "true") == "true",
+		})
+	default:
+		return nil, fmt.Errorf("blobstore: unknown DOCUMENT_STORAGE %q, expected local or s3", backend)
+	}
+}
@@ -0,0 +1,482 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config is the location and credentials of an S3-compatible bucket
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle requests http://endpoint/bucket/key instead of http://bucket.endpoint/key, which
+	// MinIO and most self-hosted servers need
+	PathStyle bool
+	// Client sends the requests, http.DefaultClient when nil
+	Client *http.Client
+}
+
+// S3 keeps objects in a bucket, signing every request with AWS Signature Version 4
+type S3 struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// unsignedPayload skips hashing request bodies, which are streamed
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// emptyPayload is the SHA-256 of an empty body
+const emptyPayload = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// NewS3 returns a store for the bucket described by cfg
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("blobstore: S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required")
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("blobstore: S3_ENDPOINT %q must be an http or https URL", cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3{cfg: cfg, endpoint: endpoint, client: client, now: time.Now}, nil
+}
+
+// objectURL addresses key in the bucket
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	base := strings.TrimSuffix(u.Path, "/")
+	if s.cfg.PathStyle {
+		base += "/" + s.cfg.Bucket
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	}
+	u.Path = base + "/" + key
+	u.RawPath = uriEncode(base, false) + "/" + uriEncode(key, false)
+	u.RawQuery = ""
+	return &u
+}
+
+// do signs and sends a request for key
+func (s *S3) do(ctx context.Context, method, key string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	if err := ValidKey(key); err != nil {
+		return nil, err
+	}
+	return s.send(ctx, method, s.objectURL(key), body, size, header)
+}
+
+// send signs and sends a request for u
+func (s *S3) send(ctx context.Context, method string, u *url.URL, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	payload := emptyPayload
+	if body != nil {
+		req.ContentLength = size
+		payload = unsignedPayload
+	}
+	s.sign(req, payload, s.now())
+	return s.client.Do(req)
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if size < 0 {
+		return errors.New("blobstore: S3 uploads need the size up front")
+	}
+	if size == 0 {
+		r = http.NoBody
+	}
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, r, size, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp, "PUT", key)
+	}
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (Object, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Object{ctx: ctx, store: s, info: info}, nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (Info, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, 0, nil)
+	if err != nil {
+		return Info{}, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return Info{}, ErrNotFound
+	default:
+		return Info{}, s3Error(resp, "HEAD", key)
+	}
+	info := Info{Key: key, Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modTime
+	}
+	return info, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return s3Error(resp, "DELETE", key)
+}
+
+// List pages through ListObjectsV2
+func (s *S3) List(ctx context.Context, prefix string, fn func(Info) error) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u := s.objectURL("")
+		u.RawQuery = canonicalQuery(query)
+		resp, err := s.send(ctx, http.MethodGet, u, nil, 0, nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error(resp, "LIST", prefix)
+			resp.Body.Close()
+			return err
+		}
+		var page struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("blobstore: S3 LIST %s: %w", prefix, err)
+		}
+		for _, c := range page.Contents {
+			if err := fn(Info{Key: c.Key, Size: c.Size, ModTime: c.LastModified}); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// Presign signs the URL in its query string, S3 allows at most 7 days
+func (s *S3) Presign(ctx context.Context, method, key string, expires time.Duration, opts PresignOptions) (string, error) {
+	if err := ValidKey(key); err != nil {
+		return "", err
+	}
+	if method != http.MethodGet && method != http.MethodPut {
+		return "", fmt.Errorf("blobstore: cannot presign %s", method)
+	}
+	if expires < time.Second || expires > 7*24*time.Hour {
+		return "", errors.New("blobstore: presigned URLs expire after between 1 second and 7 days")
+	}
+
+	t := s.now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	u := s.objectURL(key)
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.cfg.AccessKeyID + "/" + s.scope(t)},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {strconv.Itoa(int(expires / time.Second))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if opts.ContentType != "" {
+		query.Set("response-content-type", opts.ContentType)
+	}
+	if opts.ContentDisposition != "" {
+		query.Set("response-content-disposition", opts.ContentDisposition)
+	}
+
+	canonical := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		canonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	u.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + s.signature(t, canonical)
+	return u.String(), nil
+}
+
+// scope is the credential scope of requests signed at t
+func (s *S3) scope(t time.Time) string {
+	return t.UTC().Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+// sign adds the Signature Version 4 Authorization header to req
+func (s *S3) sign(req *http.Request, payload string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	req.Host = req.URL.Host
+
+	// Signs the host, the x-amz-* headers and the headers that change what is read or written
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "range" || lower == "content-type" || lower == "content-md5" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payload,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKeyID, s.scope(t), signedHeaders, s.signature(t, canonical)))
+}
+
+// signature signs a canonical request with the key derived for the day of t
+func (s *S3) signature(t time.Time, canonical string) string {
+	t = t.UTC()
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + t.Format("20060102T150405Z") + "\n" + s.scope(t) + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery sorts and encodes query parameters the way Signature Version 4 expects
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters, and slashes unless encodeSlash
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3Error turns an unexpected response into an error carrying the S3 error code
+func s3Error(resp *http.Response, method, key string) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body)
+	if body.Code == "" {
+		body.Code = http.StatusText(resp.StatusCode)
+	}
+	return fmt.Errorf("blobstore: S3 %s %s: %d %s %s", method, key, resp.StatusCode, body.Code, body.Message)
+}
+
+// s3Object reads an object with ranged GETs. One response body is kept open and reused while
+// reads continue where the previous one ended, a jump elsewhere starts a new request.
+type s3Object struct {
+	ctx     context.Context
+	store   *S3
+	info    Info
+	pos     int64
+	body    io.ReadCloser
+	bodyPos int64
+}
+
+func (o *s3Object) Info() Info {
+	return o.info
+}
+
+// open starts reading the object at off
+func (o *s3Object) open(off int64) error {
+	o.Close()
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-", off)}}
+	resp, err := o.store.do(o.ctx, http.MethodGet, o.info.Key, nil, 0, header)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// The server ignored the range
+		if _, err := io.CopyN(io.Discard, resp.Body, off); err != nil {
+			resp.Body.Close()
+			return err
+		}
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return ErrNotFound
+	default:
+		err := s3Error(resp, "GET", o.info.Key)
+		resp.Body.Close()
+		return err
+	}
+	o.body, o.bodyPos = resp.Body, off
+	return nil
+}
+
+// readAt reads from off, filling p when full is set
+func (o *s3Object) readAt(p []byte, off int64, full bool) (int, error) {
+	if off >= o.info.Size {
+		return 0, io.EOF
+	}
+	if remaining := o.info.Size - off; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	if o.body == nil || o.bodyPos != off {
+		if err := o.open(off); err != nil {
+			return 0, err
+		}
+	}
+
+	var n int
+	var err error
+	if full {
+		n, err = io.ReadFull(o.body, p)
+	} else {
+		n, err = o.body.Read(p)
+	}
+	o.bodyPos += int64(n)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		o.Close()
+		if off+int64(n) < o.info.Size && (full || n == 0) {
+			return n, io.ErrUnexpectedEOF
+		}
+		return n, nil
+	case err != nil:
+		o.Close()
+		return n, err
+	}
+	return n, nil
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := o.readAt(p, o.pos, false)
+	o.pos += int64(n)
+	return n, err
+}
+
+func (o *s3Object) ReadAt(p []byte, off int64) (int, error) {
+	n, err := o.readAt(p, off, true)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.pos
+	case io.SeekEnd:
+		offset += o.info.Size
+	default:
+		return 0, errors.New("blobstore: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("blobstore: negative position")
+	}
+	o.pos = offset
+	return offset, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
@@ -0,0 +1,66 @@
+package deletion
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// adminSteps unlink an admin from students, points of contact and uploads before its rows go
+var adminSteps = []step{
+	{label: "pinned", table: "pinned", where: "admin_id = ?", args: adminID},
+	{label: "poc_admin", table: "poc_admin", where: "admin_id = ?", args: adminID},
+	{label: "documentation.uploaded_by", table: "documentation", where: "uploaded_by = ?", args: adminID, update: "uploaded_by = NULL"},
+	{label: "documentation_version.uploaded_by", table: "documentation_version", where: "uploaded_by = ?", args: adminID, update: "uploaded_by = NULL"},
+	{label: "profile_history", table: "profile_history", where: "profile_type = 'admin' AND profile_id = ?", args: adminID},
+	{label: "users", table: "users", where: "id = ?", args: adminID},
+	{label: "admin", table: "admin", where: "admin_id = ?", args: adminID},
+	{label: "person", table: "person", where: "person_id = ?", args: adminID},
+}
+
+func adminID(p *Plan) []any { return []any{p.ResourceID} }
+
+// PreviewAdmin reports everything DeleteAdmin would remove without changing anything
+func PreviewAdmin(ctx context.Context, q utils.DBTX, id int) (*Plan, error) {
+	// Confirms the admin exists, trashed admins included
+	var exists int
+	query := "SELECT admin_id FROM admin WHERE admin_id = ?"
+	if _, ok := q.(*sql.Tx); ok {
+		query += " FOR UPDATE"
+	}
+	if err := q.QueryRowContext(ctx, query, id).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{ResourceType: "admin", ResourceID: id, Rows: map[string]int64{}, Files: []string{}}
+	if err := countSteps(ctx, q, adminSteps, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// DeleteAdmin removes an admin, its login and its links in one transaction and records a tombstone.
+// Documents the admin uploaded are kept without an uploader.
+func DeleteAdmin(ctx context.Context, db *sql.DB, id int, deletedBy any) (*Plan, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The plan is built inside the transaction so it matches what gets deleted
+	plan, err := PreviewAdmin(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := runSteps(ctx, tx, adminSteps, plan, deletedBy); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
@@ -0,0 +1,96 @@
+package deletion
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// countSteps adds the rows each step touches to the plan
+func countSteps(ctx context.Context, q utils.DBTX, steps []step, plan *Plan) error {
+	for _, s := range steps {
+		where, args, ok := s.bind(plan)
+		if !ok {
+			continue
+		}
+		var n int64
+		if err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+s.table+" WHERE "+where, args...).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			plan.Rows[s.label] += n
+		}
+	}
+	return nil
+}
+
+// runSteps executes the steps in order and records a tombstone of what was removed and by whom
+func runSteps(ctx context.Context, tx *sql.Tx, steps []step, plan *Plan, deletedBy any) error {
+	for _, s := range steps {
+		where, args, ok := s.bind(plan)
+		if !ok {
+			continue
+		}
+		query := "DELETE FROM " + s.table + " WHERE " + where
+		if s.update != "" {
+			query = "UPDATE " + s.table + " SET " + s.update + " WHERE " + where
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("delete %s: %w", s.label, err)
+		}
+	}
+
+	summary, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO deletion_tombstone (resource_type, resource_id, deleted_by, deleted_at, summary)
+		VALUES (?, ?, ?, NOW(), ?)`,
+		plan.ResourceType, plan.ResourceID, deletedBy, summary,
+	)
+	return err
+}
+
+// bind expands IN placeholders for the plan and reports false when the step has nothing to match
+func (s step) bind(p *Plan) (string, []any, bool) {
+	args := s.args(p)
+	if !strings.Contains(s.where, "%s") {
+		return s.where, args, true
+	}
+	if len(args) == 0 {
+		return "", nil, false
+	}
+	return fmt.Sprintf(s.where, strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")), args, true
+}
+
+// queryIDs runs a single column ID query
+func queryIDs(ctx context.Context, q utils.DBTX, query string, args ...any) ([]int, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func intArgs(ids []int) []any {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
@@ -0,0 +1,169 @@
+package deletion
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+)
+
+var countFrom = regexp.MustCompile(`^SELECT COUNT\(\*\) FROM (\w+) WHERE`)
+
+// studentDB answers the queries of a plan for student 7, who has two points of contact and two
+// documents sharing a file; rows maps a table to the rows each of its steps counts
+func studentDB(rows map[string]int64) *testdb.DB {
+	return &testdb.DB{Query: func(query string, args []driver.Value) (*testdb.Rows, error) {
+		switch {
+		case strings.HasPrefix(query, "SELECT student_id FROM student"):
+			if args[0] != int64(7) {
+				return testdb.Empty(), nil
+			}
+			return testdb.Row(int64(7)), nil
+		case strings.HasPrefix(query, "SELECT point_of_contact_id"):
+			return &testdb.Rows{Values: [][]driver.Value{{int64(11)}, {int64(12)}}}, nil
+		case strings.Contains(query, "FROM documentation_version v"):
+			return &testdb.Rows{Values: [][]driver.Value{
+				{int64(21), "letters/21.pdf", nil},
+				{int64(21), "letters/21-v2.pdf", nil},
+				{int64(22), "letters/21.pdf", nil},
+			}}, nil
+		case strings.Contains(query, "WHERE storage_key = ?"):
+			return testdb.Row(int64(0)), nil
+		}
+		if m := countFrom.FindStringSubmatch(query); m != nil {
+			return testdb.Row(rows[m[1]]), nil
+		}
+		return nil, nil
+	}}
+}
+
+var studentRows = map[string]int64{
+	"poc_admin": 3, "point_of_contact": 2, "specific_documentation": 2, "documentation_version": 3,
+	"documentation": 2, "activity": 4, "stu_dis": 1, "users": 1, "student": 1, "person": 1,
+}
+
+func TestPreviewStudentChangesNothing(t *testing.T) {
+	fake := studentDB(studentRows)
+	plan, err := PreviewStudent(context.Background(), fake.Open(t), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int64{
+		"poc_admin": 3, "point_of_contact": 2, "specific_documentation": 2, "documentation_version": 3,
+		"documentation": 2, "activity": 4, "stu_dis": 1, "users": 1, "student": 1, "person": 1,
+		// The uploaded_by steps count the same tables
+		"documentation.uploaded_by": 2, "documentation_version.uploaded_by": 3,
+	}
+	if !reflect.DeepEqual(plan.Rows, want) {
+		t.Fatalf("plan rows = %v, want %v", plan.Rows, want)
+	}
+	if !reflect.DeepEqual(plan.Files, []string{"letters/21.pdf", "letters/21-v2.pdf"}) {
+		t.Fatalf("plan files = %v, want each file once", plan.Files)
+	}
+	if !reflect.DeepEqual(plan.documentationIDs, []int{21, 22}) || !reflect.DeepEqual(plan.pointOfContactIDs, []int{11, 12}) {
+		t.Fatalf("plan IDs = %v and %v", plan.documentationIDs, plan.pointOfContactIDs)
+	}
+
+	for _, statement := range fake.Statements() {
+		if !strings.HasPrefix(statement, "SELECT") || strings.Contains(statement, "FOR UPDATE") {
+			t.Errorf("the preview ran %s", statement)
+		}
+	}
+
+	if _, err := PreviewStudent(context.Background(), fake.Open(t), 8); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("preview of a missing student = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestDeleteStudentAppliesThePreview(t *testing.T) {
+	t.Setenv("DOCUMENT_STORAGE_DIR", t.TempDir())
+	fake := studentDB(studentRows)
+	var tombstone []driver.Value
+	fake.Exec = func(query string, args []driver.Value) (testdb.Result, error) {
+		if strings.Contains(query, "deletion_tombstone") {
+			tombstone = args
+		}
+		return testdb.Result{Affected: 1}, nil
+	}
+	db := fake.Open(t)
+
+	preview, err := PreviewStudent(context.Background(), db, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Reset()
+
+	plan, err := DeleteStudent(context.Background(), db, 7, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(plan.Rows, preview.Rows) || !reflect.DeepEqual(plan.Files, preview.Files) {
+		t.Fatalf("deleted %v %v, previewed %v %v", plan.Rows, plan.Files, preview.Rows, preview.Files)
+	}
+	if !strings.Contains(fake.Log(), "SELECT student_id FROM student WHERE student_id = ? FOR UPDATE") {
+		t.Fatal("the student was not locked while the plan was built")
+	}
+
+	// Every step runs in order, children first, and a tombstone records the plan
+	var writes []string
+	for _, statement := range fake.Statements() {
+		if strings.HasPrefix(statement, "DELETE") || strings.HasPrefix(statement, "UPDATE") || strings.HasPrefix(statement, "INSERT") {
+			writes = append(writes, statement)
+		}
+	}
+	want := []string{
+		"DELETE FROM poc_admin WHERE point_of_contact_id IN (?, ?)",
+		"DELETE FROM point_of_contact WHERE student_id = ?",
+		"DELETE FROM specific_documentation WHERE student_id = ?",
+		"DELETE FROM documentation_version WHERE documentation_id IN (?, ?)",
+		"DELETE FROM documentation WHERE documentation_id IN (?, ?)",
+		"DELETE FROM activity WHERE activity_id IN (?, ?, ?, ?)",
+		"DELETE FROM pinned WHERE student_id = ?",
+		"DELETE FROM stu_dis WHERE student_id = ?",
+		"DELETE FROM stu_accom WHERE student_id = ?",
+		"UPDATE documentation SET uploaded_by = NULL WHERE uploaded_by = ?",
+		"UPDATE documentation_version SET uploaded_by = NULL WHERE uploaded_by = ?",
+		"DELETE FROM profile_history WHERE profile_type = 'student' AND profile_id = ?",
+		"DELETE FROM users WHERE id = ?",
+		"DELETE FROM student WHERE student_id = ?",
+		"DELETE FROM person WHERE person_id = ?",
+		"INSERT INTO deletion_tombstone (resource_type, resource_id, deleted_by, deleted_at, summary) VALUES (?, ?, ?, NOW(), ?)",
+	}
+	if !reflect.DeepEqual(writes, want) {
+		t.Fatalf("writes:\n%s\nwant:\n%s", strings.Join(writes, "\n"), strings.Join(want, "\n"))
+	}
+	if fake.Commits() != 1 {
+		t.Fatalf("%d commits, want 1", fake.Commits())
+	}
+	summary, _ := json.Marshal(preview)
+	if len(tombstone) != 4 || tombstone[0] != "student" || tombstone[1] != int64(7) || tombstone[2] != int64(1) ||
+		string(tombstone[3].([]byte)) != string(summary) {
+		t.Fatalf("tombstone %v, want the previewed plan %s", tombstone, summary)
+	}
+}
+
+func TestDeleteStudentRollsBackAFailedStep(t *testing.T) {
+	t.Setenv("DOCUMENT_STORAGE_DIR", t.TempDir())
+	fake := studentDB(studentRows)
+	fake.Exec = func(query string, args []driver.Value) (testdb.Result, error) {
+		if strings.HasPrefix(query, "DELETE FROM stu_dis") {
+			return testdb.Result{}, errors.New("lock wait timeout")
+		}
+		return testdb.Result{Affected: 1}, nil
+	}
+
+	if _, err := DeleteStudent(context.Background(), fake.Open(t), 7, 1); err == nil || !strings.Contains(err.Error(), "delete stu_dis") {
+		t.Fatalf("DeleteStudent = %v, want the failed step named", err)
+	}
+	if fake.Commits() != 0 || fake.Rollbacks() != 1 || fake.Count("deletion_tombstone") != 0 {
+		t.Fatalf("%d commits and %d rollbacks, want the deletion rolled back without a tombstone", fake.Commits(), fake.Rollbacks())
+	}
+}
@@ -0,0 +1,162 @@
+package deletion
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/docstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// Plan lists everything a cascading deletion removes
+type Plan struct {
+	ResourceType string           `json:"resource_type"`
+	ResourceID   int              `json:"resource_id"`
+	Rows         map[string]int64 `json:"rows"`
+	Files        []string         `json:"files"`
+
+	refs              []docstore.Ref
+	pointOfContactIDs []int
+	documentationIDs  []int
+}
+
+// step is one statement of a cascading deletion, counted for the preview and executed in order
+type step struct {
+	label string
+	table string
+	where string
+	args  func(p *Plan) []any
+	// update replaces the DELETE with an UPDATE ... SET for rows that are kept but unlinked
+	update string
+}
+
+// studentSteps delete children before parents so foreign keys never fail
+var studentSteps = []step{
+	{label: "poc_admin", table: "poc_admin", where: "point_of_contact_id IN (%s)", args: pocIDs},
+	{label: "point_of_contact", table: "point_of_contact", where: "student_id = ?", args: studentID},
+	{label: "specific_documentation", table: "specific_documentation", where: "student_id = ?", args: studentID},
+	{label: "documentation_version", table: "documentation_version", where: "documentation_id IN (%s)", args: docIDs},
+	{label: "documentation", table: "documentation", where: "documentation_id IN (%s)", args: docIDs},
+	{label: "activity", table: "activity", where: "activity_id IN (%s)", args: activityIDs},
+	{label: "pinned", table: "pinned", where: "student_id = ?", args: studentID},
+	{label: "stu_dis", table: "stu_dis", where: "student_id = ?", args: studentID},
+	{label: "stu_accom", table: "stu_accom", where: "student_id = ?", args: studentID},
+	{label: "documentation.uploaded_by", table: "documentation", where: "uploaded_by = ?", args: studentID, update: "uploaded_by = NULL"},
+	{label: "documentation_version.uploaded_by", table: "documentation_version", where: "uploaded_by = ?", args: studentID, update: "uploaded_by = NULL"},
+	{label: "profile_history", table: "profile_history", where: "profile_type = 'student' AND profile_id = ?", args: studentID},
+	{label: "users", table: "users", where: "id = ?", args: studentID},
+	{label: "student", table: "student", where: "student_id = ?", args: studentID},
+	{label: "person", table: "person", where: "person_id = ?", args: studentID},
+}
+
+func studentID(p *Plan) []any { return []any{p.ResourceID} }
+func pocIDs(p *Plan) []any    { return intArgs(p.pointOfContactIDs) }
+func docIDs(p *Plan) []any    { return intArgs(p.documentationIDs) }
+func activityIDs(p *Plan) []any {
+	return append(intArgs(p.pointOfContactIDs), intArgs(p.documentationIDs)...)
+}
+
+// PreviewStudent reports everything DeleteStudent would remove without changing anything
+func PreviewStudent(ctx context.Context, q utils.DBTX, id int) (*Plan, error) {
+	// Confirms the student exists, trashed students included
+	var exists int
+	query := "SELECT student_id FROM student WHERE student_id = ?"
+	if _, ok := q.(*sql.Tx); ok {
+		query += " FOR UPDATE"
+	}
+	if err := q.QueryRowContext(ctx, query, id).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{ResourceType: "student", ResourceID: id, Rows: map[string]int64{}, Files: []string{}}
+
+	// Activity IDs are collected up front because their child rows disappear first
+	var err error
+	plan.pointOfContactIDs, err = queryIDs(ctx, q, "SELECT point_of_contact_id FROM point_of_contact WHERE student_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every version's file goes too, ordered so each document's rows are together
+	rows, err := q.QueryContext(ctx, `
+		SELECT d.documentation_id, d.storage_key, d.content_sha256
+		FROM documentation d
+		JOIN specific_documentation sd ON sd.specific_documentation_id = d.documentation_id
+		WHERE sd.student_id = ?
+		UNION
+		SELECT v.documentation_id, v.storage_key, v.content_sha256
+		FROM documentation_version v
+		JOIN specific_documentation sd ON sd.specific_documentation_id = v.documentation_id
+		WHERE sd.student_id = ?
+		ORDER BY documentation_id`, id, id)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for rows.Next() {
+		var docID int
+		var storageKey string
+		var digest sql.NullString
+		if err := rows.Scan(&docID, &storageKey, &digest); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if n := len(plan.documentationIDs); n == 0 || plan.documentationIDs[n-1] != docID {
+			plan.documentationIDs = append(plan.documentationIDs, docID)
+		}
+		if storageKey != "" && !seen[storageKey] {
+			seen[storageKey] = true
+			plan.Files = append(plan.Files, storageKey)
+			plan.refs = append(plan.refs, docstore.Ref{Key: storageKey, Digest: digest.String})
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Counts the rows each step touches
+	if err := countSteps(ctx, q, studentSteps, plan); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// DeleteStudent removes a student and all dependent data in one transaction, deletes its files
+// after the commit and records a tombstone
+func DeleteStudent(ctx context.Context, db *sql.DB, id int, deletedBy any) (*Plan, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The plan is built inside the transaction so it matches what gets deleted
+	plan, err := PreviewStudent(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := runSteps(ctx, tx, studentSteps, plan, deletedBy); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Delete stored files no other document shares (after DB commit)
+	store, err := blobstore.Default()
+	if err == nil {
+		err = docstore.Release(ctx, db, store, plan.refs)
+	}
+	if err != nil {
+		log.Println("Warning: failed to delete files:", err)
+	}
+
+	return plan, nil
+}
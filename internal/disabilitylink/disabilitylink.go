@@ -0,0 +1,175 @@
+// Package disabilitylink stores which disabilities a student has. The link is the most sensitive
+// fact in the database, so with field encryption enabled for stu_dis.disability_id the disability
+// is kept only as a ciphertext in stu_dis.disability_ref plus a blind index in disability_index,
+// and disability_id stays NULL. Queries can therefore no longer join stu_dis to disability; they
+// read the links through this package, which decrypts them, and then load the disabilities by ID.
+// Rows written while encryption was disabled keep their plain disability_id until
+// "piconexctl rotate-field-keys" seals them.
+package disabilitylink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// Link is one disability of one student
+type Link struct {
+	StudentID    int
+	DisabilityID int
+	RecordedAt   sql.NullTime
+}
+
+// Add records that a student has a disability
+func Add(ctx context.Context, q utils.DBTX, studentID, disabilityID int, recordedAt time.Time) error {
+	plain, ref, index, err := seal(disabilityID)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx,
+		"INSERT INTO stu_dis (student_id, disability_id, disability_ref, disability_index, recorded_at) VALUES (?, ?, ?, ?, ?)",
+		studentID, plain, ref, index, recordedAt,
+	)
+	return err
+}
+
+// Match returns a condition matching the links of the stu_dis row aliased alias to a disability
+// and its arguments, through the blind index and the plain column of rows not sealed yet
+func Match(alias string, disabilityID int) (string, []any) {
+	index := fieldcrypt.BlindIndex(fieldcrypt.StuDisDisabilityID, strconv.Itoa(disabilityID))
+	if index == nil {
+		return alias + "disability_id = ?", []any{disabilityID}
+	}
+	return fmt.Sprintf("(%[1]sdisability_index = ? OR %[1]sdisability_id = ?)", alias), []any{index, disabilityID}
+}
+
+// Delete removes the links of a student, of a disability or, with both, the one link between
+// them. A zero ID matches every student or disability, at least one must be given.
+func Delete(ctx context.Context, q utils.DBTX, studentID, disabilityID int) (int64, error) {
+	where := []string{}
+	args := []any{}
+	if studentID != 0 {
+		where = append(where, "student_id = ?")
+		args = append(args, studentID)
+	}
+	if disabilityID != 0 {
+		cond, condArgs := Match("", disabilityID)
+		where = append(where, cond)
+		args = append(args, condArgs...)
+	}
+	if len(where) == 0 {
+		return 0, fmt.Errorf("disabilitylink: a student or a disability is required")
+	}
+
+	res, err := q.ExecContext(ctx, "DELETE FROM stu_dis WHERE "+strings.Join(where, " AND "), args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// All returns every link
+func All(ctx context.Context, q utils.DBTX) ([]Link, error) {
+	return query(ctx, q, "1 = 1 ORDER BY student_id")
+}
+
+// ForStudents returns the links of the given students
+func ForStudents(ctx context.Context, q utils.DBTX, studentIDs ...int) ([]Link, error) {
+	if len(studentIDs) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(studentIDs))
+	for i, id := range studentIDs {
+		args[i] = id
+	}
+	return query(ctx, q, "student_id IN ("+placeholders(len(args))+") ORDER BY student_id", args...)
+}
+
+// ForDisabilities returns the links to the given disabilities
+func ForDisabilities(ctx context.Context, q utils.DBTX, disabilityIDs ...int) ([]Link, error) {
+	if len(disabilityIDs) == 0 {
+		return nil, nil
+	}
+	var where []string
+	var args []any
+	for _, id := range disabilityIDs {
+		cond, condArgs := Match("", id)
+		where = append(where, cond)
+		args = append(args, condArgs...)
+	}
+	return query(ctx, q, "("+strings.Join(where, " OR ")+") ORDER BY student_id", args...)
+}
+
+// DisabilityIDs returns the distinct disability IDs of links in the order they first appear
+func DisabilityIDs(links []Link) []int {
+	seen := map[int]bool{}
+	ids := []int{}
+	for _, l := range links {
+		if !seen[l.DisabilityID] {
+			seen[l.DisabilityID] = true
+			ids = append(ids, l.DisabilityID)
+		}
+	}
+	return ids
+}
+
+// query reads links matching where, decrypting sealed disability IDs
+func query(ctx context.Context, q utils.DBTX, where string, args ...any) ([]Link, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT student_id, disability_id, disability_ref, recorded_at FROM stu_dis WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []Link{}
+	for rows.Next() {
+		var l Link
+		var plain sql.NullInt64
+		var ref sql.NullString
+		if err := rows.Scan(&l.StudentID, &plain, &ref, &l.RecordedAt); err != nil {
+			return nil, err
+		}
+		if l.DisabilityID, err = open(plain, ref); err != nil {
+			return nil, fmt.Errorf("stu_dis of student %d: %w", l.StudentID, err)
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// seal returns the column values of a link to a disability: the plain ID while encryption is
+// disabled, otherwise the ciphertext and blind index
+func seal(disabilityID int) (any, any, any, error) {
+	if !fieldcrypt.Enabled(fieldcrypt.StuDisDisabilityID) {
+		return disabilityID, nil, nil, nil
+	}
+	value := strconv.Itoa(disabilityID)
+	ref, err := fieldcrypt.Encrypt(fieldcrypt.StuDisDisabilityID, value)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return nil, ref, fieldcrypt.BlindIndex(fieldcrypt.StuDisDisabilityID, value), nil
+}
+
+// open returns the disability ID of a stored link
+func open(plain sql.NullInt64, ref sql.NullString) (int, error) {
+	if plain.Valid {
+		return int(plain.Int64), nil
+	}
+	value, err := fieldcrypt.Decrypt(fieldcrypt.StuDisDisabilityID, ref.String)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
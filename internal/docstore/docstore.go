@@ -0,0 +1,286 @@
+// Package docstore keeps uploaded documents in the blob store under the SHA-256 digest of their
+// content, e.g. "sha256/9f/9f86d0...". Identical uploads share one blob, the digest is recorded
+// with each documentation row and checked again when the document is downloaded.
+//
+// Every blob has a document_blob row. Uploads lock that row while they check for and write the
+// blob, and Release deletes a blob under the same lock once no documentation row references it,
+// so a deduplicated upload never ends up pointing at a blob that is being removed.
+package docstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/filecrypt"
+)
+
+// Prefix starts the key of every content-addressed blob
+const Prefix = "sha256/"
+
+var ErrDigestMismatch = errors.New("docstore: content does not match its SHA-256 digest")
+
+// Key returns the storage key of the blob with the given hex digest
+func Key(digest string) string {
+	return Prefix + digest[:2] + "/" + digest
+}
+
+// Stored is an upload after it has been put in the store
+type Stored struct {
+	Key    string
+	Digest string
+	Size   int64
+	// Deduplicated is set when an identical blob was already stored
+	Deduplicated bool
+}
+
+// Put stores the size bytes of r, encrypted when encryption is enabled, under their digest and
+// records the blob in tx. r is read twice: once to compute the digest and once while it is
+// written, when it is hashed again so content that changed in between is never stored. The
+// blob row stays locked until tx ends, which must also insert the documentation row.
+func Put(ctx context.Context, tx *sql.Tx, store blobstore.BlobStore, r io.ReadSeeker, size int64) (Stored, error) {
+	sum := sha256.New()
+	n, err := io.Copy(sum, r)
+	if err != nil {
+		return Stored{}, err
+	}
+	if n != size {
+		return Stored{}, fmt.Errorf("docstore: read %d bytes, expected %d", n, size)
+	}
+	digest := hex.EncodeToString(sum.Sum(nil))
+	stored := Stored{Key: Key(digest), Digest: digest, Size: size}
+
+	// Locks the blob row, a concurrent Release of the same digest waits for this transaction
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO document_blob (content_sha256, storage_key, size_bytes) VALUES (?, ?, ?)
+		 ON DUPLICATE KEY UPDATE content_sha256 = content_sha256`,
+		digest, stored.Key, size,
+	); err != nil {
+		return Stored{}, err
+	}
+
+	// A blob cut short by an interrupted write is replaced, not shared
+	switch complete, err := holds(ctx, store, stored.Key, size); {
+	case err != nil:
+		return Stored{}, err
+	case complete:
+		stored.Deduplicated = true
+		return stored, nil
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Stored{}, err
+	}
+	check := sha256.New()
+	body, bodySize, err := filecrypt.Encrypt(io.TeeReader(r, check), size)
+	if err != nil {
+		return Stored{}, err
+	}
+	defer body.Close()
+	if err := store.Put(ctx, stored.Key, body, bodySize, "application/octet-stream"); err != nil {
+		return Stored{}, err
+	}
+	if hex.EncodeToString(check.Sum(nil)) != digest {
+		store.Delete(ctx, stored.Key)
+		return Stored{}, ErrDigestMismatch
+	}
+	return stored, nil
+}
+
+// holds reports whether the blob under key exists and decrypts to size bytes. A blob that is
+// missing, has another length or whose encryption header cannot be read is not complete.
+func holds(ctx context.Context, store blobstore.BlobStore, key string, size int64) (bool, error) {
+	obj, err := store.Get(ctx, key)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer obj.Close()
+	_, n, err := filecrypt.Open(obj, obj.Info().Size)
+	return err == nil && n == size, nil
+}
+
+// Ref is a stored file referenced by a documentation row or version that is being removed
+type Ref struct {
+	Key string
+	// Digest is empty for files stored before content addressing
+	Digest string
+}
+
+// Release deletes the blobs of refs that no documentation row or version references any more. It
+// must run after the rows are gone. Failures are collected so one bad blob does not keep the others.
+func Release(ctx context.Context, db *sql.DB, store blobstore.BlobStore, refs []Ref) error {
+	var errs []error
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		if ref.Key == "" || seen[ref.Key] {
+			continue
+		}
+		seen[ref.Key] = true
+
+		var err error
+		if ref.Digest == "" || Quarantined(ref.Key) {
+			err = releaseKey(ctx, db, store, ref.Key)
+		} else {
+			err = release(ctx, db, store, ref.Digest)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ref.Key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// release deletes one content-addressed blob while holding its row lock
+func release(ctx context.Context, db *sql.DB, store blobstore.BlobStore, digest string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var key string
+	err = tx.QueryRowContext(ctx, "SELECT storage_key FROM document_blob WHERE content_sha256 = ? FOR UPDATE", digest).Scan(&key)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return deleteUnreferenced(ctx, tx, store, digest, key)
+}
+
+// Discard deletes the blob Put stored for an upload whose transaction rolled back or failed to
+// commit. It must run after that transaction ended, which released the blob row lock. A blob that
+// was deduplicated, or that another upload recorded in the meantime, is kept.
+func Discard(ctx context.Context, db *sql.DB, store blobstore.BlobStore, stored Stored) error {
+	if stored.Deduplicated || stored.Key == "" {
+		return nil
+	}
+	if Quarantined(stored.Key) {
+		return releaseKey(ctx, db, store, stored.Key)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The blob row rolled back with the upload, it is written again to take the same lock as Put
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO document_blob (content_sha256, storage_key, size_bytes) VALUES (?, ?, ?)
+		 ON DUPLICATE KEY UPDATE content_sha256 = content_sha256`,
+		stored.Digest, stored.Key, stored.Size,
+	); err != nil {
+		return err
+	}
+	return deleteUnreferenced(ctx, tx, store, stored.Digest, stored.Key)
+}
+
+// deleteUnreferenced deletes a blob and its locked document_blob row when no documentation row or
+// version references the digest
+func deleteUnreferenced(ctx context.Context, tx *sql.Tx, store blobstore.BlobStore, digest, key string) error {
+	var refs int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT (SELECT COUNT(*) FROM documentation WHERE content_sha256 = ?)
+			+ (SELECT COUNT(*) FROM documentation_version WHERE content_sha256 = ?)`,
+		digest, digest,
+	).Scan(&refs); err != nil {
+		return err
+	}
+	if refs > 0 {
+		return tx.Commit()
+	}
+
+	// The blob goes before the row is released, an upload waiting on the lock then stores it again
+	if err := store.Delete(ctx, key); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM document_blob WHERE content_sha256 = ?", digest); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// releaseKey deletes a blob without a document_blob row once no row references it: a file stored
+// before content addressing, which its versions may share, or a quarantined blob, which may be
+// shared by the rows that referenced the same blob when it was moved
+func releaseKey(ctx context.Context, db *sql.DB, store blobstore.BlobStore, key string) error {
+	var refs int
+	if err := db.QueryRowContext(ctx, `
+		SELECT (SELECT COUNT(*) FROM documentation WHERE storage_key = ?)
+			+ (SELECT COUNT(*) FROM documentation_version WHERE storage_key = ?)`,
+		key, key,
+	).Scan(&refs); err != nil {
+		return err
+	}
+	if refs > 0 {
+		return nil
+	}
+	return store.Delete(ctx, key)
+}
+
+// Reader checks content against its digest while it is read from the start to the end, which is
+// how a whole document is downloaded. The last bytes are held back until the digest matched, so
+// a client never receives a complete copy of a corrupted file. Reads after a seek elsewhere, such
+// as range requests, are passed through unchecked.
+type Reader struct {
+	r        io.ReadSeeker
+	size     int64
+	want     []byte
+	hash     hash.Hash
+	pos      int64
+	hashed   int64
+	mismatch bool
+}
+
+// Verify wraps content of size bytes that should hash to digest. An empty digest, for files
+// stored before content addressing, disables the check.
+func Verify(content io.ReadSeeker, size int64, digest string) *Reader {
+	v := &Reader{r: content, size: size, hash: sha256.New()}
+	if want, err := hex.DecodeString(digest); err == nil && len(want) == sha256.Size {
+		v.want = want
+	}
+	// Empty content is never read, it is checked up front
+	if v.want != nil && size == 0 {
+		v.mismatch = !bytes.Equal(v.hash.Sum(nil), v.want)
+	}
+	return v
+}
+
+func (v *Reader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	if v.want != nil && v.pos == v.hashed && n > 0 {
+		v.hash.Write(p[:n])
+		v.hashed += int64(n)
+		if v.hashed == v.size && !bytes.Equal(v.hash.Sum(nil), v.want) {
+			v.mismatch = true
+			return 0, ErrDigestMismatch
+		}
+	}
+	v.pos += int64(n)
+	return n, err
+}
+
+func (v *Reader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := v.r.Seek(offset, whence)
+	if err == nil {
+		v.pos = pos
+	}
+	return pos, err
+}
+
+// Mismatch reports whether the content read so far, or empty content, did not match the digest
+func (v *Reader) Mismatch() bool {
+	return v.mismatch
+}
@@ -0,0 +1,299 @@
+package docstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+)
+
+// fakeDB records statements and answers the single-value queries of the blob table
+type fakeDB struct {
+	testdb.DB
+	// refs is the number of rows referencing each digest or key
+	refs map[string]int64
+}
+
+func (f *fakeDB) open(t *testing.T) *sql.DB {
+	f.Query = func(query string, args []driver.Value) (*testdb.Rows, error) {
+		switch {
+		case strings.Contains(query, "SELECT storage_key FROM document_blob"):
+			return testdb.Row(Key(args[0].(string))), nil
+		case strings.Contains(query, "COUNT(*)"):
+			return testdb.Row(f.refs[args[0].(string)]), nil
+		}
+		return nil, nil
+	}
+	return f.Open(t)
+}
+
+func digestOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func newStore(t *testing.T) blobstore.BlobStore {
+	store, err := blobstore.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func put(t *testing.T, db *sql.DB, store blobstore.BlobStore, r io.ReadSeeker, size int64) (Stored, error) {
+	t.Helper()
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	stored, err := Put(ctx, tx, store, r, size)
+	if err == nil {
+		err = tx.Commit()
+	}
+	return stored, err
+}
+
+func TestPutStoresContentUnderDigest(t *testing.T) {
+	fake := &fakeDB{}
+	db, store := fake.open(t), newStore(t)
+	content := "accommodation letter"
+
+	first, err := put(t, db, store, strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := digestOf(content)
+	if first.Digest != digest || first.Key != "sha256/"+digest[:2]+"/"+digest || first.Deduplicated {
+		t.Fatalf("first Put = %+v", first)
+	}
+	if !strings.Contains(fake.Log(), "INSERT INTO document_blob") {
+		t.Fatalf("the blob row was not locked:\n%s", fake.Log())
+	}
+
+	second, err := put(t, db, store, strings.NewReader(content), int64(len(content)))
+	if err != nil || !second.Deduplicated || second.Key != first.Key {
+		t.Fatalf("second Put = %+v, %v", second, err)
+	}
+
+	obj, err := store.Get(context.Background(), first.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	if got, _ := io.ReadAll(obj); string(got) != content {
+		t.Fatalf("stored %q", got)
+	}
+
+	if _, err := put(t, db, store, strings.NewReader(content), 3); err == nil {
+		t.Fatal("Put accepted a wrong size")
+	}
+}
+
+func TestPutReplacesTruncatedBlob(t *testing.T) {
+	fake := &fakeDB{}
+	db, store := fake.open(t), newStore(t)
+	ctx := context.Background()
+	content := "accommodation letter"
+
+	// A write that was cut short left part of the content under its digest
+	key := Key(digestOf(content))
+	if err := store.Put(ctx, key, strings.NewReader(content[:8]), 8, "application/octet-stream"); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := put(t, db, store, strings.NewReader(content), int64(len(content)))
+	if err != nil || stored.Deduplicated {
+		t.Fatalf("Put over a truncated blob = %+v, %v", stored, err)
+	}
+	obj, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	if got, _ := io.ReadAll(obj); string(got) != content {
+		t.Fatalf("stored %q, want the whole content", got)
+	}
+}
+
+// changing returns different content on its second pass, like a file modified during the upload
+type changing struct {
+	*strings.Reader
+	seeks int
+}
+
+func (c *changing) Seek(offset int64, whence int) (int64, error) {
+	c.seeks++
+	c.Reader = strings.NewReader(strings.ToUpper(readAll(c.Reader)))
+	return c.Reader.Seek(offset, whence)
+}
+
+func readAll(r *strings.Reader) string {
+	r.Seek(0, io.SeekStart)
+	b, _ := io.ReadAll(r)
+	return string(b)
+}
+
+func TestPutRefusesContentThatChanged(t *testing.T) {
+	fake := &fakeDB{}
+	db, store := fake.open(t), newStore(t)
+	r := &changing{Reader: strings.NewReader("original")}
+
+	_, err := put(t, db, store, r, int64(r.Len()))
+	if !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("Put = %v, want ErrDigestMismatch", err)
+	}
+	if _, err := store.Stat(context.Background(), Key(digestOf("original"))); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Fatalf("the mismatched blob was kept: %v", err)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	used, unused := "used", "unused"
+	fake := &fakeDB{refs: map[string]int64{digestOf(used): 1}}
+	db, store := fake.open(t), newStore(t)
+	ctx := context.Background()
+
+	var refs []Ref
+	for _, content := range []string{used, unused} {
+		stored, err := put(t, db, store, strings.NewReader(content), int64(len(content)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, Ref{Key: stored.Key, Digest: stored.Digest})
+	}
+	legacy := "specific/12_old.pdf"
+	if err := store.Put(ctx, legacy, strings.NewReader("old"), 3, ""); err != nil {
+		t.Fatal(err)
+	}
+	refs = append(refs, Ref{Key: legacy}, refs[1])
+
+	if err := Release(ctx, db, store, refs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Stat(ctx, refs[0].Key); err != nil {
+		t.Fatalf("a referenced blob was deleted: %v", err)
+	}
+	for _, key := range []string{refs[1].Key, legacy} {
+		if _, err := store.Stat(ctx, key); !errors.Is(err, blobstore.ErrNotFound) {
+			t.Fatalf("%s was kept: %v", key, err)
+		}
+	}
+	if n := strings.Count(fake.Log(), "DELETE FROM document_blob"); n != 1 {
+		t.Fatalf("%d blob rows deleted, want 1:\n%s", n, fake.Log())
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	fake := &fakeDB{}
+	db, store := fake.open(t), newStore(t)
+	ctx := context.Background()
+
+	// An upload whose transaction rolls back leaves no blob behind
+	content := "rolled back upload"
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := Put(ctx, tx, store, strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+	if err := Discard(ctx, db, store, stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Stat(ctx, stored.Key); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Fatalf("the blob of a rolled back upload was kept: %v", err)
+	}
+
+	// A blob another upload recorded meanwhile, or one that was deduplicated, stays
+	shared := "shared upload"
+	fake.refs = map[string]int64{digestOf(shared): 1}
+	first, err := put(t, db, store, strings.NewReader(shared), int64(len(shared)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := put(t, db, store, strings.NewReader(shared), int64(len(shared)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []Stored{second, first} {
+		if err := Discard(ctx, db, store, s); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Stat(ctx, s.Key); err != nil {
+			t.Fatalf("a referenced blob was deleted: %v", err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+	digest := digestOf(content)
+
+	read := func(content, digest string) (string, *Reader, error) {
+		v := Verify(strings.NewReader(content), int64(len(content)), digest)
+		var out bytes.Buffer
+		buf := make([]byte, 333)
+		for {
+			n, err := v.Read(buf)
+			out.Write(buf[:n])
+			if err == io.EOF {
+				return out.String(), v, nil
+			}
+			if err != nil {
+				return out.String(), v, err
+			}
+		}
+	}
+
+	if got, v, err := read(content, digest); err != nil || got != content || v.Mismatch() {
+		t.Fatalf("intact content: %d bytes, %v", len(got), err)
+	}
+
+	corrupted := content[:len(content)-1] + "x"
+	got, v, err := read(corrupted, digest)
+	if !errors.Is(err, ErrDigestMismatch) || !v.Mismatch() {
+		t.Fatalf("corrupted content: %v", err)
+	}
+	if len(got) == len(content) {
+		t.Fatal("the whole corrupted file was returned")
+	}
+
+	if _, _, err := read(corrupted, ""); err != nil {
+		t.Fatalf("files without a digest are not checked: %v", err)
+	}
+
+	// Ranges are passed through
+	v = Verify(strings.NewReader(corrupted), int64(len(corrupted)), digest)
+	v.Seek(100, io.SeekStart)
+	if b, err := io.ReadAll(v); err != nil || len(b) != len(corrupted)-100 {
+		t.Fatalf("range read: %d bytes, %v", len(b), err)
+	}
+
+	if v := Verify(strings.NewReader(""), 0, digest); !v.Mismatch() {
+		t.Fatal("empty content matched a non-empty digest")
+	}
+	if v := Verify(strings.NewReader(""), 0, digestOf("")); v.Mismatch() {
+		t.Fatal("empty content did not match its digest")
+	}
+}
+
+func TestQuarantineKey(t *testing.T) {
+	key := Key(digestOf("x"))
+	q := QuarantineKey(key)
+	if !Quarantined(q) || Quarantined(key) || QuarantineKey(q) != q {
+		t.Fatalf("QuarantineKey(%s) = %s", key, q)
+	}
+}
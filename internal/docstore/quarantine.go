@@ -0,0 +1,130 @@
+package docstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/filecrypt"
+)
+
+// QuarantinePrefix starts the key of every quarantined blob, downloads refuse such keys
+const QuarantinePrefix = "quarantine/"
+
+// QuarantineKey returns where the blob stored under key is kept once it is quarantined
+func QuarantineKey(key string) string {
+	if Quarantined(key) {
+		return key
+	}
+	return QuarantinePrefix + key
+}
+
+// Quarantined reports whether key names a quarantined blob
+func Quarantined(key string) bool {
+	return strings.HasPrefix(key, QuarantinePrefix)
+}
+
+// PutQuarantined stores an upload that was found infected under the quarantine prefix, encrypted
+// when encryption is enabled, so it can be inspected but never served. An identical blob already
+// in the store is infected as well and is quarantined with every row that references it.
+func PutQuarantined(ctx context.Context, db *sql.DB, store blobstore.BlobStore, r io.ReadSeeker, size int64, signature string) (Stored, error) {
+	sum := sha256.New()
+	n, err := io.Copy(sum, r)
+	if err != nil {
+		return Stored{}, err
+	}
+	if n != size {
+		return Stored{}, fmt.Errorf("docstore: read %d bytes, expected %d", n, size)
+	}
+	digest := hex.EncodeToString(sum.Sum(nil))
+	stored := Stored{Key: QuarantineKey(Key(digest)), Digest: digest, Size: size}
+
+	if err := Quarantine(ctx, db, store, Key(digest), digest, signature); err != nil {
+		return Stored{}, err
+	}
+	switch complete, err := holds(ctx, store, stored.Key, size); {
+	case err != nil:
+		return Stored{}, err
+	case complete:
+		stored.Deduplicated = true
+		return stored, nil
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Stored{}, err
+	}
+	body, bodySize, err := filecrypt.Encrypt(r, size)
+	if err != nil {
+		return Stored{}, err
+	}
+	defer body.Close()
+	if err := store.Put(ctx, stored.Key, body, bodySize, "application/octet-stream"); err != nil {
+		return Stored{}, err
+	}
+	return stored, nil
+}
+
+// Quarantine moves the blob stored under key below the quarantine prefix and marks every
+// documentation row and version that references it infected with signature. digest is empty for
+// files stored before content addressing. A key with nothing stored under it is not an error.
+func Quarantine(ctx context.Context, db *sql.DB, store blobstore.BlobStore, key, digest, signature string) error {
+	if Quarantined(key) {
+		return nil
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Holds the blob row like Put and Release do, so no upload is deduplicated onto the blob while it moves
+	if digest != "" {
+		var locked string
+		err := tx.QueryRowContext(ctx, "SELECT storage_key FROM document_blob WHERE content_sha256 = ? FOR UPDATE", digest).Scan(&locked)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	// The stored bytes are copied as they are, an encrypted blob stays encrypted
+	obj, err := store.Get(ctx, key)
+	switch {
+	case errors.Is(err, blobstore.ErrNotFound):
+		return nil
+	case err != nil:
+		return err
+	}
+	err = store.Put(ctx, QuarantineKey(key), obj, obj.Info().Size, "application/octet-stream")
+	obj.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"documentation", "documentation_version"} {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE `+table+`
+			 SET storage_key = ?, scan_status = 'infected', scan_signature = ?, scanned_at = NOW()
+			 WHERE storage_key = ?`,
+			QuarantineKey(key), signature, key,
+		); err != nil {
+			return err
+		}
+	}
+	if digest != "" {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM document_blob WHERE content_sha256 = ?", digest); err != nil {
+			return err
+		}
+	}
+
+	// The original goes before the row lock is released, a waiting upload then stores its own copy
+	if err := store.Delete(ctx, key); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,164 @@
+package docstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/filecrypt"
+)
+
+// Report is the result of checking the store against the documentation table
+type Report struct {
+	Documents int `json:"documents"`
+	Blobs     int `json:"blobs"`
+	Verified  int `json:"verified"`
+	// Unhashed counts files stored before content addressing, only their size is checked
+	Unhashed     int            `json:"unhashed"`
+	Missing      []Problem      `json:"missing"`
+	Mismatched   []Problem      `json:"mismatched"`
+	Unreferenced []Unreferenced `json:"unreferenced"`
+}
+
+// Problem is a referenced blob that is missing or does not match its digest or size
+type Problem struct {
+	StorageKey       string `json:"storage_key"`
+	Digest           string `json:"content_sha256,omitempty"`
+	DocumentationIDs []int  `json:"documentation_ids"`
+	Error            string `json:"error,omitempty"`
+}
+
+// Unreferenced is a stored object no documentation row points to, usually left behind by an
+// upload whose transaction rolled back. Recent ones may belong to an upload still in progress.
+type Unreferenced struct {
+	StorageKey string    `json:"storage_key"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+}
+
+// OK reports whether nothing is missing, mismatched or unreferenced
+func (r Report) OK() bool {
+	return len(r.Missing) == 0 && len(r.Mismatched) == 0 && len(r.Unreferenced) == 0
+}
+
+// blob is a stored file and the rows that reference it
+type blob struct {
+	key    string
+	digest string
+	size   int64
+	ids    []int
+}
+
+// VerifyStorage reads every referenced blob back, decrypting it when needed, and compares it with
+// its digest and the recorded size, then lists the objects in the store that nothing references.
+// Blobs that cannot be decrypted count as mismatched.
+func VerifyStorage(ctx context.Context, db *sql.DB, store blobstore.BlobStore) (Report, error) {
+	report := Report{Missing: []Problem{}, Mismatched: []Problem{}, Unreferenced: []Unreferenced{}}
+
+	// Previous versions reference blobs as well, the current one repeats its documentation row
+	rows, err := db.QueryContext(ctx, `
+		SELECT documentation_id, storage_key, content_sha256, size_bytes, 1 FROM documentation
+		UNION ALL
+		SELECT documentation_id, storage_key, content_sha256, size_bytes, 0 FROM documentation_version
+		ORDER BY documentation_id`)
+	if err != nil {
+		return report, err
+	}
+	blobs := map[string]*blob{}
+	for rows.Next() {
+		var id int
+		var key string
+		var digest sql.NullString
+		var size int64
+		var document bool
+		if err := rows.Scan(&id, &key, &digest, &size, &document); err != nil {
+			rows.Close()
+			return report, err
+		}
+		if document {
+			report.Documents++
+		}
+		b, ok := blobs[key]
+		if !ok {
+			b = &blob{key: key, digest: digest.String, size: size}
+			blobs[key] = b
+		}
+		if n := len(b.ids); n == 0 || b.ids[n-1] != id {
+			b.ids = append(b.ids, id)
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return report, err
+	}
+
+	keys := make([]string, 0, len(blobs))
+	for key := range blobs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		b := blobs[key]
+		report.Blobs++
+		problem := Problem{StorageKey: b.key, Digest: b.digest, DocumentationIDs: b.ids}
+		if b.digest == "" {
+			report.Unhashed++
+		}
+
+		err := verifyBlob(ctx, store, b)
+		switch {
+		case err == nil:
+			report.Verified++
+		case errors.Is(err, blobstore.ErrNotFound):
+			report.Missing = append(report.Missing, problem)
+		default:
+			problem.Error = err.Error()
+			report.Mismatched = append(report.Mismatched, problem)
+		}
+	}
+
+	err = store.List(ctx, "", func(info blobstore.Info) error {
+		if _, ok := blobs[info.Key]; !ok {
+			report.Unreferenced = append(report.Unreferenced, Unreferenced{info.Key, info.Size, info.ModTime})
+		}
+		return nil
+	})
+	return report, err
+}
+
+// verifyBlob reads a blob to the end and checks its length and digest
+func verifyBlob(ctx context.Context, store blobstore.BlobStore, b *blob) error {
+	obj, err := store.Get(ctx, b.key)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	content, _, err := filecrypt.Open(obj, obj.Info().Size)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.New()
+	n, err := io.Copy(sum, content)
+	if err != nil {
+		return err
+	}
+	if n != b.size {
+		return fmt.Errorf("content is %d bytes, documentation records %d", n, b.size)
+	}
+	if b.digest != "" && hex.EncodeToString(sum.Sum(nil)) != b.digest {
+		return ErrDigestMismatch
+	}
+	return nil
+}
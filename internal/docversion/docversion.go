@@ -0,0 +1,318 @@
+// Package docversion keeps the versions of specific and personal documents. Every documentation
+// row has at least one documentation_version row; the documentation row itself always mirrors
+// its current version, so everything that reads documents keeps working unchanged.
+//
+// Old versions are removed by retention rules from the environment:
+//
+//	DOCUMENT_VERSIONS_KEEP              previous versions kept per document, 0 (default) keeps all
+//	DOCUMENT_VERSION_RETENTION_DAYS     previous versions are removed this many days after they were
+//	                                    replaced, or uploaded when they never became current,
+//	                                    0 (default) keeps them forever
+//	DOCUMENT_VERSION_PRUNE_INTERVAL     how often the rules are applied, default 1h
+//
+// The current version is never removed.
+package docversion
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/docstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/scanner"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+var ErrInfected = errors.New("docversion: an infected version cannot become current")
+
+// File is the stored file of a new version
+type File struct {
+	FileName      string
+	StorageKey    string
+	ContentSHA256 string
+	MimeType      string
+	SizeBytes     int64
+	UploadedBy    any
+	ScanStatus    string
+	ScanSignature sql.NullString
+	ScannedAt     sql.NullTime
+}
+
+// columns are the file columns shared by documentation and documentation_version
+const columns = "file_name, storage_key, content_sha256, mime_type, size_bytes, uploaded_by, scan_status, scan_signature, scanned_at"
+
+// Record stores the file of a documentation row that was just inserted as its first version
+func Record(ctx context.Context, q utils.DBTX, documentationID int64) error {
+	_, err := q.ExecContext(ctx, `
+		INSERT INTO documentation_version (documentation_id, version_number, `+columns+`)
+		SELECT documentation_id, current_version, `+columns+`
+		FROM documentation WHERE documentation_id = ?`, documentationID)
+	return err
+}
+
+// Sync copies the file columns of a documentation row into its current version after they were
+// edited in place
+func Sync(ctx context.Context, q utils.DBTX, documentationID int) error {
+	_, err := q.ExecContext(ctx, `
+		UPDATE documentation_version v
+		JOIN documentation d ON d.documentation_id = v.documentation_id AND d.current_version = v.version_number
+		SET v.file_name = d.file_name, v.storage_key = d.storage_key, v.content_sha256 = d.content_sha256,
+			v.mime_type = d.mime_type, v.size_bytes = d.size_bytes, v.uploaded_by = d.uploaded_by,
+			v.scan_status = d.scan_status, v.scan_signature = d.scan_signature, v.scanned_at = d.scanned_at
+		WHERE d.documentation_id = ?`, documentationID)
+	return err
+}
+
+// Add stores a new version with the next number and returns the number. It does not become
+// current until SetCurrent is called. The caller must hold the document's activity row lock.
+func Add(ctx context.Context, tx *sql.Tx, documentationID int, f File) (int, error) {
+	var number int
+	if err := tx.QueryRowContext(ctx,
+		"SELECT COALESCE(MAX(version_number), 0) + 1 FROM documentation_version WHERE documentation_id = ?",
+		documentationID,
+	).Scan(&number); err != nil {
+		return 0, err
+	}
+
+	var digest sql.NullString
+	if f.ContentSHA256 != "" {
+		digest = sql.NullString{String: f.ContentSHA256, Valid: true}
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO documentation_version (documentation_id, version_number, `+columns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		documentationID, number, f.FileName, f.StorageKey, digest, f.MimeType, f.SizeBytes, f.UploadedBy,
+		f.ScanStatus, f.ScanSignature, f.ScannedAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return number, nil
+}
+
+// SetCurrent makes a version the current one by copying its file into the documentation row.
+// The version it replaces is marked superseded, which starts its retention period. It returns
+// sql.ErrNoRows when the version does not exist and ErrInfected for a quarantined version.
+func SetCurrent(ctx context.Context, tx *sql.Tx, documentationID, number int) error {
+	var status string
+	err := tx.QueryRowContext(ctx,
+		"SELECT scan_status FROM documentation_version WHERE documentation_id = ? AND version_number = ?",
+		documentationID, number,
+	).Scan(&status)
+	if err != nil {
+		return err
+	}
+	if status == scanner.StatusInfected {
+		return ErrInfected
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE documentation_version v
+		JOIN documentation d ON d.documentation_id = v.documentation_id AND d.current_version = v.version_number
+		SET v.superseded_at = NOW()
+		WHERE d.documentation_id = ? AND v.version_number <> ?`,
+		documentationID, number,
+	); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE documentation d
+		JOIN documentation_version v ON v.documentation_id = d.documentation_id AND v.version_number = ?
+		SET d.file_name = v.file_name, d.storage_key = v.storage_key, d.content_sha256 = v.content_sha256,
+			d.mime_type = v.mime_type, d.size_bytes = v.size_bytes, d.uploaded_by = v.uploaded_by,
+			d.scan_status = v.scan_status, d.scan_signature = v.scan_signature, d.scanned_at = v.scanned_at,
+			d.current_version = v.version_number, v.superseded_at = NULL
+		WHERE d.documentation_id = ?`,
+		number, documentationID,
+	)
+	return err
+}
+
+// List returns the versions of a document, newest first
+func List(ctx context.Context, q utils.DBTX, documentationID int) ([]models.DocumentationVersion, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT v.documentation_id, v.version_number, v.version_number = d.current_version, v.file_name, v.storage_key,
+			v.content_sha256, v.mime_type, v.size_bytes, v.uploaded_by, v.scan_status, v.created_at, v.superseded_at
+		FROM documentation_version v
+		JOIN documentation d ON d.documentation_id = v.documentation_id
+		WHERE v.documentation_id = ?
+		ORDER BY v.version_number DESC`, documentationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]models.DocumentationVersion, 0)
+	for rows.Next() {
+		var v models.DocumentationVersion
+		var digest sql.NullString
+		var uploadedBy sql.NullInt64
+		var supersededAt sql.NullTime
+		if err := rows.Scan(&v.DocumentationID, &v.VersionNumber, &v.Current, &v.FileName, &v.StorageKey,
+			&digest, &v.MimeType, &v.SizeBytes, &uploadedBy, &v.ScanStatus, &v.CreatedAt, &supersededAt); err != nil {
+			return nil, err
+		}
+		if digest.Valid {
+			v.ContentSHA256 = &digest.String
+		}
+		if uploadedBy.Valid {
+			id := int(uploadedBy.Int64)
+			v.UploadedBy = &id
+		}
+		if supersededAt.Valid {
+			v.SupersededAt = &supersededAt.Time
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// Retention are the rules old versions are removed by
+type Retention struct {
+	// Keep is how many previous versions each document keeps, 0 keeps all
+	Keep int
+	// MaxAge is how long a version is kept after it was replaced, or uploaded when it never became
+	// current, 0 keeps it forever
+	MaxAge time.Duration
+}
+
+// RetentionFromEnv reads the rules from DOCUMENT_VERSIONS_KEEP and DOCUMENT_VERSION_RETENTION_DAYS
+func RetentionFromEnv() Retention {
+	return Retention{
+		Keep:   utils.EnvInt("DOCUMENT_VERSIONS_KEEP", 0),
+		MaxAge: time.Duration(utils.EnvInt("DOCUMENT_VERSION_RETENTION_DAYS", 0)) * 24 * time.Hour,
+	}
+}
+
+// Enabled reports whether the rules remove anything
+func (r Retention) Enabled() bool {
+	return r.Keep > 0 || r.MaxAge > 0
+}
+
+// Prune removes the previous versions the rules no longer keep, of one document or of all of them
+// when documentationID is 0, and then the files no row references any more. It returns the
+// number of versions removed.
+func Prune(ctx context.Context, db *sql.DB, store blobstore.BlobStore, rules Retention, documentationID int) (int64, error) {
+	if !rules.Enabled() {
+		return 0, nil
+	}
+
+	// A version that never became current, e.g. an infected upload, has no superseded_at and ages from its upload
+	query := `
+		SELECT v.documentation_id, v.version_number, v.storage_key, v.content_sha256, COALESCE(v.superseded_at, v.created_at)
+		FROM documentation_version v
+		JOIN documentation d ON d.documentation_id = v.documentation_id
+		WHERE v.version_number <> d.current_version`
+	args := []any{}
+	if documentationID != 0 {
+		query += " AND v.documentation_id = ?"
+		args = append(args, documentationID)
+	}
+	rows, err := db.QueryContext(ctx, query+" ORDER BY v.documentation_id, v.version_number DESC", args...)
+	if err != nil {
+		return 0, err
+	}
+
+	type expired struct {
+		documentationID, number int
+	}
+	var remove []expired
+	var refs []docstore.Ref
+	cutoff := time.Now().Add(-rules.MaxAge)
+	previous, kept := 0, 0
+	for rows.Next() {
+		var e expired
+		var key string
+		var digest sql.NullString
+		var replacedAt time.Time
+		if err := rows.Scan(&e.documentationID, &e.number, &key, &digest, &replacedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if e.documentationID != previous {
+			previous, kept = e.documentationID, 0
+		}
+		kept++
+
+		tooMany := rules.Keep > 0 && kept > rules.Keep
+		tooOld := rules.MaxAge > 0 && replacedAt.Before(cutoff)
+		if tooMany || tooOld {
+			remove = append(remove, e)
+			refs = append(refs, docstore.Ref{Key: key, Digest: digest.String})
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int64
+	for _, e := range remove {
+		res, err := db.ExecContext(ctx, `
+			DELETE v FROM documentation_version v
+			JOIN documentation d ON d.documentation_id = v.documentation_id
+			WHERE v.documentation_id = ? AND v.version_number = ? AND v.version_number <> d.current_version`,
+			e.documentationID, e.number,
+		)
+		if err != nil {
+			return removed, err
+		}
+		n, _ := res.RowsAffected()
+		removed += n
+	}
+
+	// Delete stored files no other version or document shares (after DB delete)
+	if err := docstore.Release(ctx, db, store, refs); err != nil {
+		log.Println("Warning: failed to delete files of pruned versions:", err)
+	}
+	return removed, nil
+}
+
+// DeleteOrphans removes the versions of documentation rows that were hard deleted
+func DeleteOrphans(ctx context.Context, q utils.DBTX) (int64, error) {
+	res, err := q.ExecContext(ctx, `
+		DELETE v FROM documentation_version v
+		LEFT JOIN documentation d ON d.documentation_id = v.documentation_id
+		WHERE d.documentation_id IS NULL`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// StartPruner applies the retention rules on an interval until the context is cancelled
+func StartPruner(ctx context.Context, db *sql.DB, rules Retention, interval time.Duration) {
+	if !rules.Enabled() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			store, err := blobstore.Default()
+			if err == nil {
+				var n int64
+				n, err = Prune(ctx, db, store, rules, 0)
+				if n > 0 {
+					log.Printf("🗂️ Pruned %d old document versions\n", n)
+				}
+			}
+			if err != nil {
+				log.Println("Document version prune error:", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
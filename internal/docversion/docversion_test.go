@@ -0,0 +1,225 @@
+package docversion
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/scanner"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+)
+
+type version struct {
+	doc, number  int64
+	key, status  string
+	createdAt    time.Time
+	supersededAt *time.Time
+}
+
+// versionTable is documentation_version with the current version of each document
+type versionTable struct {
+	testdb.DB
+	mu       sync.Mutex
+	current  map[int64]int64
+	versions []*version
+}
+
+func newVersionTable(versions ...*version) *versionTable {
+	v := &versionTable{current: map[int64]int64{}, versions: versions}
+	for _, ver := range versions {
+		v.current[ver.doc] = max(v.current[ver.doc], ver.number)
+	}
+	v.Query = v.query
+	v.Exec = v.exec
+	return v
+}
+
+func (v *versionTable) query(query string, args []driver.Value) (*testdb.Rows, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	switch {
+	case strings.Contains(query, "SELECT scan_status FROM documentation_version"):
+		for _, ver := range v.versions {
+			if ver.doc == args[0] && ver.number == args[1] {
+				return testdb.Row(ver.status), nil
+			}
+		}
+		return testdb.Empty(), nil
+
+	case strings.Contains(query, "COALESCE(v.superseded_at, v.created_at)"):
+		rows := &testdb.Rows{Columns: []string{"documentation_id", "version_number", "storage_key", "content_sha256", "replaced_at"}}
+		previous := slices.DeleteFunc(slices.Clone(v.versions), func(ver *version) bool { return ver.number == v.current[ver.doc] })
+		slices.SortFunc(previous, func(a, b *version) int {
+			if a.doc != b.doc {
+				return int(a.doc - b.doc)
+			}
+			return int(b.number - a.number)
+		})
+		for _, ver := range previous {
+			replacedAt := ver.createdAt
+			if ver.supersededAt != nil {
+				replacedAt = *ver.supersededAt
+			}
+			rows.Values = append(rows.Values, []driver.Value{ver.doc, ver.number, ver.key, nil, replacedAt})
+		}
+		return rows, nil
+
+	case strings.Contains(query, "WHERE storage_key = ?"):
+		var refs int64
+		for _, ver := range v.versions {
+			if ver.key == args[0] {
+				refs++
+			}
+		}
+		return testdb.Row(refs), nil
+	}
+	return nil, nil
+}
+
+func (v *versionTable) exec(query string, args []driver.Value) (testdb.Result, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if strings.Contains(query, "DELETE v FROM documentation_version") {
+		before := len(v.versions)
+		v.versions = slices.DeleteFunc(v.versions, func(ver *version) bool {
+			return ver.doc == args[0] && ver.number == args[1] && ver.number != v.current[ver.doc]
+		})
+		return testdb.Result{Affected: int64(before - len(v.versions))}, nil
+	}
+	return testdb.Result{Affected: 1}, nil
+}
+
+// numbers returns the version numbers left of a document
+func (v *versionTable) numbers(doc int64) []int64 {
+	var numbers []int64
+	for _, ver := range v.versions {
+		if ver.doc == doc {
+			numbers = append(numbers, ver.number)
+		}
+	}
+	slices.Sort(numbers)
+	return numbers
+}
+
+func setCurrent(t *testing.T, db *sql.DB, doc, number int) error {
+	t.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := SetCurrent(context.Background(), tx, doc, number); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func TestSetCurrentRejectsInfectedVersions(t *testing.T) {
+	table := newVersionTable(
+		&version{doc: 1, number: 1, status: scanner.StatusClean},
+		&version{doc: 1, number: 2, status: scanner.StatusInfected},
+		&version{doc: 1, number: 3, status: scanner.StatusClean},
+	)
+	db := table.Open(t)
+
+	if err := setCurrent(t, db, 1, 2); !errors.Is(err, ErrInfected) {
+		t.Fatalf("SetCurrent on an infected version = %v, want ErrInfected", err)
+	}
+	if n := table.Count("UPDATE documentation"); n != 0 {
+		t.Fatalf("an infected version changed %d rows", n)
+	}
+
+	if err := setCurrent(t, db, 1, 9); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("SetCurrent on a missing version = %v, want sql.ErrNoRows", err)
+	}
+
+	if err := setCurrent(t, db, 1, 1); err != nil {
+		t.Fatalf("SetCurrent on a clean version = %v", err)
+	}
+	if table.Count("SET v.superseded_at = NOW()") != 1 || table.Count("d.current_version = v.version_number, v.superseded_at = NULL") != 1 {
+		t.Fatalf("the clean version was not made current:\n%s", table.Log())
+	}
+}
+
+// storeWith returns a blob store holding the given keys
+func storeWith(t *testing.T, keys ...string) blobstore.BlobStore {
+	t.Helper()
+	store, err := blobstore.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if err := store.Put(context.Background(), key, strings.NewReader(key), int64(len(key)), "application/octet-stream"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func stored(store blobstore.BlobStore, key string) bool {
+	_, err := store.Stat(context.Background(), key)
+	return err == nil
+}
+
+func TestPruneByCount(t *testing.T) {
+	var versions []*version
+	for n := int64(1); n <= 5; n++ {
+		versions = append(versions, &version{doc: 1, number: n, key: fmt.Sprintf("doc-1/v%d", n)})
+	}
+	// Version 1 of another document shares the file of an old version of document 1
+	versions = append(versions, &version{doc: 2, number: 1, key: "doc-1/v1"})
+	table := newVersionTable(versions...)
+	store := storeWith(t, "doc-1/v1", "doc-1/v2", "doc-1/v3", "doc-1/v4", "doc-1/v5")
+
+	removed, err := Prune(context.Background(), table.Open(t), store, Retention{Keep: 2}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 || !slices.Equal(table.numbers(1), []int64{3, 4, 5}) {
+		t.Fatalf("removed %d, versions %v left, want the current and two previous versions", removed, table.numbers(1))
+	}
+	if stored(store, "doc-1/v2") || !stored(store, "doc-1/v3") || !stored(store, "doc-1/v5") {
+		t.Fatal("the files of the removed versions were not released")
+	}
+	if !stored(store, "doc-1/v1") {
+		t.Fatal("a file another document still uses was deleted")
+	}
+}
+
+func TestPruneByAge(t *testing.T) {
+	now := time.Now()
+	old, recent := now.Add(-40*24*time.Hour), now.Add(-5*24*time.Hour)
+	table := newVersionTable(
+		&version{doc: 1, number: 1, key: "v1", createdAt: old, supersededAt: &old},
+		&version{doc: 1, number: 2, key: "v2", createdAt: old, supersededAt: &recent},
+		// An infected upload never became current and was never superseded
+		&version{doc: 1, number: 3, key: "v3", createdAt: old, status: scanner.StatusInfected},
+		&version{doc: 1, number: 4, key: "v4", createdAt: recent, status: scanner.StatusInfected},
+		&version{doc: 1, number: 5, key: "v5", createdAt: old},
+	)
+	store := storeWith(t, "v1", "v2", "v3", "v4", "v5")
+
+	removed, err := Prune(context.Background(), table.Open(t), store, Retention{MaxAge: 30 * 24 * time.Hour}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 || !slices.Equal(table.numbers(1), []int64{2, 4, 5}) {
+		t.Fatalf("removed %d, versions %v left, want 1 and the old never current 3 removed", removed, table.numbers(1))
+	}
+	if stored(store, "v1") || stored(store, "v3") || !stored(store, "v4") {
+		t.Fatal("the files of the removed versions were not released")
+	}
+
+	// The current version is kept however old it is
+	if !stored(store, "v5") {
+		t.Fatal("the current version's file was deleted")
+	}
+}
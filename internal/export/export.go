@@ -0,0 +1,245 @@
+// Package export streams list endpoint results as CSV, XLSX or NDJSON files.
+package export
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/audit"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/xlsx"
+)
+
+// Export formats
+const (
+	FormatJSON   = "json"
+	FormatCSV    = "csv"
+	FormatXLSX   = "xlsx"
+	FormatNDJSON = "ndjson"
+)
+
+// ErrUnsupportedFormat is returned for a format= value that cannot be produced
+var ErrUnsupportedFormat = errors.New("export: unsupported format")
+
+// ErrNotRecorded fails an export whose audit entry could not be written, the client got a 500 instead
+var ErrNotRecorded = errors.New("export: audit entry not written")
+
+// flushEvery bounds how many rows are buffered before they are pushed to the client
+const flushEvery = 100
+
+var contentTypes = map[string]string{
+	FormatCSV:    "text/csv; charset=utf-8",
+	FormatXLSX:   xlsx.ContentType,
+	FormatNDJSON: "application/x-ndjson",
+}
+
+// Negotiate picks the response format from the format query parameter or else the Accept header.
+// Unknown Accept types fall back to JSON so existing clients keep working.
+func Negotiate(r *http.Request) (string, error) {
+	if format := strings.ToLower(r.URL.Query().Get("format")); format != "" {
+		if _, ok := contentTypes[format]; ok || format == FormatJSON {
+			return format, nil
+		}
+		return "", ErrUnsupportedFormat
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		switch mediaType {
+		case "text/csv":
+			return FormatCSV, nil
+		case xlsx.ContentType:
+			return FormatXLSX, nil
+		case "application/x-ndjson":
+			return FormatNDJSON, nil
+		case "application/json", "*/*":
+			return FormatJSON, nil
+		}
+	}
+	return FormatJSON, nil
+}
+
+// Writer streams rows of one list endpoint in the negotiated format
+type Writer struct {
+	db      *sql.DB
+	w       http.ResponseWriter
+	r       *http.Request
+	name    string
+	format  string
+	columns []column
+	rows    int
+
+	csv    *csv.Writer
+	sheet  *xlsx.Writer
+	ndjson *json.Encoder
+	err    error
+}
+
+// Start begins a file export named after the resource when the client asked for CSV, XLSX or NDJSON.
+// sample is a zero value of the row type and fixes the columns, so empty exports still have a header.
+// It returns nil for JSON requests, which the handler answers as before, and ErrUnsupportedFormat
+// before anything is written when the format cannot be produced.
+func Start(db *sql.DB, w http.ResponseWriter, r *http.Request, name string, sample any) (*Writer, error) {
+	format, err := Negotiate(r)
+	if err != nil || format == FormatJSON {
+		return nil, err
+	}
+
+	x := &Writer{db: db, w: w, r: r, name: name, format: format, columns: columnsOf(reflect.TypeOf(sample), "", nil, false)}
+
+	// Records what is exported and with which filters before anything is sent, an export that cannot
+	// be recorded is refused. The Writer is returned failed so the handler stops at the first row.
+	filters := map[string]string{}
+	for key, values := range r.URL.Query() {
+		if key != "format" && len(values) > 0 {
+			filters[key] = values[0]
+		}
+	}
+	details, _ := json.Marshal(map[string]any{"format": format, "filters": filters})
+	if err := audit.RecordRequest(db, r, &audit.Entry{
+		Action:       audit.ActionExport,
+		ResourceType: name,
+		ResourceID:   r.URL.Path,
+		After:        details,
+	}); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to record the export in the audit log")
+		x.err = ErrNotRecorded
+		return x, nil
+	}
+
+	filename := name + "-" + time.Now().UTC().Format("20060102-150405") + "." + format
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	header := make([]string, len(x.columns))
+	for i, c := range x.columns {
+		header[i] = c.name
+	}
+
+	// A failed header write means the client is gone, the error surfaces on the first row
+	switch format {
+	case FormatCSV:
+		x.csv = csv.NewWriter(w)
+		x.err = x.csv.Write(header)
+	case FormatXLSX:
+		if x.sheet, x.err = xlsx.NewWriter(w); x.err == nil {
+			cells := make([]xlsx.Cell, len(header))
+			for i, name := range header {
+				cells[i] = xlsx.Cell{Value: name}
+			}
+			x.err = x.sheet.WriteRow(cells)
+		}
+	case FormatNDJSON:
+		// NDJSON keeps the nested structure, one JSON document per line
+		x.ndjson = json.NewEncoder(w)
+	}
+	return x, nil
+}
+
+// Write streams one row
+func (x *Writer) Write(row any) error {
+	if x.err != nil {
+		return x.err
+	}
+	x.rows++
+
+	var err error
+	switch x.format {
+	case FormatCSV:
+		v := reflect.ValueOf(row)
+		record := make([]string, len(x.columns))
+		for i, c := range x.columns {
+			record[i] = escapeFormula(c.value(v))
+		}
+		err = x.csv.Write(record)
+	case FormatXLSX:
+		v := reflect.ValueOf(row)
+		cells := make([]xlsx.Cell, len(x.columns))
+		for i, c := range x.columns {
+			cells[i] = xlsx.Cell{Value: c.value(v), Number: c.numeric}
+		}
+		err = x.sheet.WriteRow(cells)
+	case FormatNDJSON:
+		err = x.ndjson.Encode(row)
+	}
+	if err != nil {
+		return err
+	}
+
+	if x.rows%flushEvery == 0 {
+		return x.flush()
+	}
+	return nil
+}
+
+// Close finishes the file, the export was recorded in the audit trail by Start.
+// A non-nil err from the row iteration aborts the export: the status is already sent, so the
+// connection is broken to keep the truncated file from being mistaken for a full export.
+func (x *Writer) Close(err error) {
+	if errors.Is(x.err, ErrNotRecorded) {
+		return
+	}
+	if err == nil {
+		err = x.err
+	}
+	if err != nil {
+		log.Printf("Export %s aborted after %d rows: %v\n", x.name, x.rows, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	switch x.format {
+	case FormatCSV:
+		x.csv.Flush()
+		err = x.csv.Error()
+	case FormatXLSX:
+		err = x.sheet.Close()
+	}
+	if err != nil {
+		log.Println("Export write error:", err)
+		return
+	}
+	x.flush()
+}
+
+func (x *Writer) flush() error {
+	switch x.format {
+	case FormatCSV:
+		x.csv.Flush()
+		if err := x.csv.Error(); err != nil {
+			return err
+		}
+	case FormatXLSX:
+		if err := x.sheet.Flush(); err != nil {
+			return err
+		}
+	}
+	if f, ok := x.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// escapeFormula stops spreadsheet programs from running cells that start like a formula
+func escapeFormula(value string) string {
+	if value == "" || !strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return value
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	return "'" + value
+}
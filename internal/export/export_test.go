@@ -0,0 +1,92 @@
+package export
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+)
+
+// auditLog accepts or refuses the audit entry of an export
+func auditLog(fail bool) *testdb.DB {
+	return &testdb.DB{
+		Query: func(string, []driver.Value) (*testdb.Rows, error) {
+			if fail {
+				return nil, errors.New("fake: audit_log is unavailable")
+			}
+			// The chain head of an empty log
+			return testdb.Row(""), nil
+		},
+		Exec: func(string, []driver.Value) (testdb.Result, error) {
+			return testdb.Result{InsertID: 1, Affected: 1}, nil
+		},
+	}
+}
+
+type row struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func start(t *testing.T, fail bool) (*Writer, *httptest.ResponseRecorder) {
+	t.Helper()
+	db := auditLog(fail).Open(t)
+
+	w := httptest.NewRecorder()
+	out, err := Start(db, w, httptest.NewRequest(http.MethodGet, "/disabilities?format=csv", nil), "disabilities", row{})
+	if err != nil || out == nil {
+		t.Fatalf("Start = %v, %v", out, err)
+	}
+	return out, w
+}
+
+func TestExport(t *testing.T) {
+	out, w := start(t, false)
+	for _, r := range []row{{1, "Ann"}, {2, "=cmd"}} {
+		if err := out.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out.Close(nil)
+
+	if got, want := w.Body.String(), "id,name\n1,Ann\n2,'=cmd\n"; got != want {
+		t.Fatalf("body = %q, want %q", got, want)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") {
+		t.Fatalf("Content-Disposition = %q", w.Header().Get("Content-Disposition"))
+	}
+}
+
+func TestExportAbortBreaksConnection(t *testing.T) {
+	out, _ := start(t, false)
+	if err := out.Write(row{1, "Ann"}); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Fatalf("Close panicked with %v, want http.ErrAbortHandler", r)
+		}
+	}()
+	out.Close(errors.New("scan failed"))
+	t.Fatal("Close returned after a failed iteration")
+}
+
+func TestExportRefusedWhenNotRecorded(t *testing.T) {
+	out, w := start(t, true)
+	if err := out.Write(row{1, "Ann"}); !errors.Is(err, ErrNotRecorded) {
+		t.Fatalf("Write = %v, want ErrNotRecorded", err)
+	}
+	out.Close(nil)
+
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "Ann") {
+		t.Fatalf("response = %d %s, want a 500 without rows", w.Code, w.Body)
+	}
+	if w.Header().Get("Content-Disposition") != "" {
+		t.Fatal("an unrecorded export was sent as a file")
+	}
+}
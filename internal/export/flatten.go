@@ -0,0 +1,173 @@
+package export
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// listSeparator joins the values of nested lists, e.g. the names of every admin on a point of contact
+const listSeparator = "; "
+
+// column is one flattened field. Nested structs become "student.first_name";
+// lists of structs become one column per field holding every element's value, e.g. "admins.first_name".
+type column struct {
+	name    string
+	path    []int // field indexes from the row to the value
+	each    []int // field indexes inside every element when the value is a list of structs
+	list    bool
+	numeric bool
+}
+
+var (
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// columnsOf lists the flattened columns of a row type using its JSON field names
+func columnsOf(t reflect.Type, prefix string, path []int, inList bool) []column {
+	t = deref(t)
+	if t.Kind() != reflect.Struct || isLeaf(t) {
+		return []column{{name: strings.TrimSuffix(prefix, "."), path: path}}
+	}
+
+	var columns []column
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		fieldPath := append(append([]int{}, path...), i)
+		ft := deref(f.Type)
+
+		// Embedded structs without a name are promoted like encoding/json does
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			columns = append(columns, columnsOf(ft, prefix, fieldPath, inList)...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		switch {
+		case ft.Kind() == reflect.Struct && !isLeaf(ft):
+			columns = append(columns, columnsOf(ft, prefix+name+".", fieldPath, inList)...)
+
+		case ft.Kind() == reflect.Slice && !inList && deref(ft.Elem()).Kind() == reflect.Struct && !isLeaf(deref(ft.Elem())):
+			for _, sub := range columnsOf(ft.Elem(), "", nil, true) {
+				columns = append(columns, column{name: prefix + name + "." + sub.name, path: fieldPath, each: sub.path, list: true})
+			}
+
+		default:
+			columns = append(columns, column{name: prefix + name, path: fieldPath, numeric: isNumber(ft)})
+		}
+	}
+	return columns
+}
+
+// value formats one column of a row
+func (c column) value(row reflect.Value) string {
+	v, ok := field(row, c.path)
+	if !ok {
+		return ""
+	}
+	if !c.list {
+		return format(v)
+	}
+
+	values := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if ev, ok := field(v.Index(i), c.each); ok {
+			values = append(values, format(ev))
+		}
+	}
+	return strings.Join(values, listSeparator)
+}
+
+// field follows the field indexes, stopping at nil pointers
+func field(v reflect.Value, path []int) (reflect.Value, bool) {
+	for _, i := range path {
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return v, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+	return v, true
+}
+
+// format renders a leaf value the way a spreadsheet user expects to read it
+func format(v reflect.Value) string {
+	if t, ok := v.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return fmt.Sprint(v.Interface())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		values := make([]string, v.Len())
+		for i := range values {
+			values[i] = format(v.Index(i))
+		}
+		return strings.Join(values, listSeparator)
+	}
+
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		if text, err := m.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// isLeaf reports whether a struct type serialises itself, like time.Time
+func isLeaf(t reflect.Type) bool {
+	p := reflect.PointerTo(t)
+	return t.Implements(textMarshaler) || t.Implements(jsonMarshaler) || p.Implements(textMarshaler) || p.Implements(jsonMarshaler)
+}
+
+func isNumber(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func deref(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,345 @@
+// Package fieldcrypt encrypts sensitive columns before they reach the database. Every value gets
+// its own random data key; the value is sealed with AES-256-GCM under that key and the data key is
+// sealed under a configured key encryption key whose ID is stored with the value, so keys can be
+// rotated by re-encrypting rows. Columns that must be looked up get a blind index, an HMAC of the
+// normalized value, stored next to the ciphertext.
+//
+// Configuration comes from the environment:
+//
+//	FIELD_ENCRYPTION_KEYS     comma-separated id:base64 pairs of 32-byte keys, e.g. "2024a:...,2025a:..."
+//	FIELD_ENCRYPTION_KEY_ID   ID of the key new values are sealed with, required with more than one key
+//	FIELD_BLIND_INDEX_KEY     base64 32-byte HMAC key of the blind indexes
+//	FIELD_ENCRYPTED_COLUMNS   table.column list, defaults to Columns
+//
+// Without keys encryption is disabled: values are stored as given and ciphertexts cannot be read.
+// The same keys wrap the data keys of encrypted document files, see filecrypt. Copies of encrypted
+// columns in JSON documents, such as audit entries and profile history, are sealed with SealJSON.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// Encrypted columns
+const (
+	PersonEmail       = "person.email"
+	PersonPhoneNumber = "person.phone_number"
+	PersonBirthday    = "person.birthday"
+	PersonAddress     = "person.address"
+	// StuDisDisabilityID is stored in stu_dis.disability_ref, see internal/disabilitylink
+	StuDisDisabilityID = "stu_dis.disability_id"
+	// IdempotencyResponse covers the responses kept for Idempotency-Key replays
+	IdempotencyResponse = "idempotency_key.response_body"
+)
+
+// Columns lists the columns that can be encrypted, all of them unless FIELD_ENCRYPTED_COLUMNS says otherwise
+var Columns = []string{PersonEmail, PersonPhoneNumber, PersonBirthday, PersonAddress, StuDisDisabilityID, IdempotencyResponse}
+
+// prefix marks sealed values, anything else is plaintext written before encryption was enabled
+const prefix = "enc:v1:"
+
+var (
+	ErrDisabled  = errors.New("fieldcrypt: no encryption keys configured")
+	ErrUnknownID = errors.New("fieldcrypt: value sealed with an unknown key")
+	ErrMalformed = errors.New("fieldcrypt: malformed ciphertext")
+)
+
+// keyring holds the configuration loaded from the environment
+type keyring struct {
+	keys    map[string]cipher.AEAD
+	current string
+	index   []byte
+	columns map[string]bool
+}
+
+var (
+	loadOnce sync.Once
+	loaded   *keyring
+	loadErr  error
+	keyID    = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// Check loads the configuration and reports whether it is usable, so the server can refuse to
+// start with a malformed key instead of failing on the first request
+func Check() error {
+	_, err := ring()
+	return err
+}
+
+// Enabled reports whether values of column are encrypted
+func Enabled(column string) bool {
+	k, err := ring()
+	return err == nil && k.current != "" && k.columns[column]
+}
+
+// CurrentKeyID returns the ID of the key new values are sealed with, empty when disabled
+func CurrentKeyID() string {
+	k, err := ring()
+	if err != nil {
+		return ""
+	}
+	return k.current
+}
+
+func ring() (*keyring, error) {
+	loadOnce.Do(func() {
+		loaded, loadErr = load(
+			utils.Env("FIELD_ENCRYPTION_KEYS", ""),
+			utils.Env("FIELD_ENCRYPTION_KEY_ID", ""),
+			utils.Env("FIELD_BLIND_INDEX_KEY", ""),
+			utils.Env("FIELD_ENCRYPTED_COLUMNS", strings.Join(Columns, ",")),
+		)
+	})
+	return loaded, loadErr
+}
+
+func load(keys, current, index, columns string) (*keyring, error) {
+	k := &keyring{keys: map[string]cipher.AEAD{}, columns: map[string]bool{}}
+
+	for _, column := range strings.Split(columns, ",") {
+		column = strings.TrimSpace(column)
+		if column == "" {
+			continue
+		}
+		known := false
+		for _, c := range Columns {
+			known = known || c == column
+		}
+		if !known {
+			return nil, fmt.Errorf("fieldcrypt: %s cannot be encrypted", column)
+		}
+		k.columns[column] = true
+	}
+
+	if keys == "" {
+		if current != "" || index != "" {
+			return nil, errors.New("fieldcrypt: FIELD_ENCRYPTION_KEYS is required when a key ID or blind index key is set")
+		}
+		return k, nil
+	}
+
+	var last string
+	for _, pair := range strings.Split(keys, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || !keyID.MatchString(id) {
+			return nil, fmt.Errorf("fieldcrypt: malformed key entry %q, expected id:base64", id)
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("fieldcrypt: duplicate key ID %s", id)
+		}
+		aead, err := newAEAD(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("fieldcrypt: key %s: %w", id, err)
+		}
+		k.keys[id] = aead
+		last = id
+	}
+
+	switch {
+	case current != "":
+		if _, ok := k.keys[current]; !ok {
+			return nil, fmt.Errorf("fieldcrypt: FIELD_ENCRYPTION_KEY_ID %s is not in FIELD_ENCRYPTION_KEYS", current)
+		}
+		k.current = current
+	case len(k.keys) == 1:
+		k.current = last
+	default:
+		return nil, errors.New("fieldcrypt: FIELD_ENCRYPTION_KEY_ID is required with more than one key")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(index)
+	if err != nil || len(raw) != 32 {
+		return nil, errors.New("fieldcrypt: FIELD_BLIND_INDEX_KEY must be 32 bytes of base64")
+	}
+	k.index = raw
+	return k, nil
+}
+
+// newAEAD builds AES-256-GCM from a base64 key
+func newAEAD(encoded string) (cipher.AEAD, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != 32 {
+		return nil, errors.New("must be 32 bytes of base64")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals plaintext for column. Empty values and columns that are not encrypted are returned as given.
+func Encrypt(column, plaintext string) (string, error) {
+	if plaintext == "" || !Enabled(column) {
+		return plaintext, nil
+	}
+	k, _ := ring()
+	kek := k.keys[k.current]
+
+	// Fresh data key for this value, sealed under the key encryption key
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return "", err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	// The column is authenticated so a ciphertext cannot be moved to another column
+	aad := []byte(column)
+	wrapped, err := seal(kek, dek, aad)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(aead, []byte(plaintext), aad)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawStdEncoding
+	return prefix + k.current + ":" + enc.EncodeToString(wrapped) + ":" + enc.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value stored in column. Plaintext written before encryption was enabled is returned as is.
+func Decrypt(column, stored string) (string, error) {
+	if !IsEncrypted(stored) {
+		return stored, nil
+	}
+	k, err := ring()
+	if err != nil {
+		return "", err
+	}
+	if len(k.keys) == 0 {
+		return "", ErrDisabled
+	}
+
+	parts := strings.Split(strings.TrimPrefix(stored, prefix), ":")
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+	kek, ok := k.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownID, parts[0])
+	}
+	enc := base64.RawStdEncoding
+	wrapped, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	sealed, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	aad := []byte(column)
+	dek, err := open(kek, wrapped, aad)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return "", ErrMalformed
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, sealed, aad)
+	return string(plaintext), err
+}
+
+// IsEncrypted reports whether a stored value is a ciphertext
+func IsEncrypted(stored string) bool {
+	return strings.HasPrefix(stored, prefix)
+}
+
+// KeyIDOf returns the ID of the key a stored value is sealed with, empty for plaintext
+func KeyIDOf(stored string) string {
+	if !IsEncrypted(stored) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(stored, prefix), ":")
+	return id
+}
+
+// BlindIndex returns the lookup hash of a value of column, nil when encryption is disabled so the
+// index column stays NULL. Emails are compared case-insensitively like the database collation did.
+func BlindIndex(column, value string) any {
+	k, err := ring()
+	if err != nil || k.index == nil || value == "" {
+		return nil
+	}
+	mac := hmac.New(sha256.New, k.index)
+	mac.Write([]byte(column))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// seal prepends a random nonce to the GCM ciphertext
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return plaintext, nil
+}
+
+// WrapKey seals a data key under the current key for other encrypted formats such as document
+// files and returns the ID of the key it used. aad must be given again to UnwrapKey.
+func WrapKey(dek, aad []byte) (string, []byte, error) {
+	k, err := ring()
+	if err != nil {
+		return "", nil, err
+	}
+	if k.current == "" {
+		return "", nil, ErrDisabled
+	}
+	wrapped, err := seal(k.keys[k.current], dek, aad)
+	return k.current, wrapped, err
+}
+
+// UnwrapKey opens a data key sealed by WrapKey
+func UnwrapKey(id string, wrapped, aad []byte) ([]byte, error) {
+	k, err := ring()
+	if err != nil {
+		return nil, err
+	}
+	kek, ok := k.keys[id]
+	if !ok {
+		if len(k.keys) == 0 {
+			return nil, ErrDisabled
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUnknownID, id)
+	}
+	return open(kek, wrapped, aad)
+}
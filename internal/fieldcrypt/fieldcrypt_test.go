@@ -0,0 +1,168 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+// useKeys replaces the keyring loaded from the environment for the rest of the test
+func useKeys(t *testing.T, keys, current, columns string) {
+	t.Helper()
+	index := ""
+	if keys != "" {
+		index = testKey(9)
+	}
+	k, err := load(keys, current, index, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadOnce.Do(func() {})
+	previous := loaded
+	loaded, loadErr = k, nil
+	t.Cleanup(func() { loaded = previous })
+}
+
+func TestLoad(t *testing.T) {
+	all := strings.Join(Columns, ",")
+	tests := []struct {
+		name                          string
+		keys, current, index, columns string
+		want                          string
+	}{
+		{name: "disabled", columns: all},
+		{name: "one key", keys: "a:" + testKey(1), index: testKey(9), columns: all},
+		{name: "current of several", keys: "a:" + testKey(1) + ",b:" + testKey(2), current: "b", index: testKey(9), columns: all},
+		{name: "several without current", keys: "a:" + testKey(1) + ",b:" + testKey(2), index: testKey(9), columns: all,
+			want: "FIELD_ENCRYPTION_KEY_ID is required"},
+		{name: "unknown current", keys: "a:" + testKey(1), current: "b", index: testKey(9), columns: all,
+			want: "is not in FIELD_ENCRYPTION_KEYS"},
+		{name: "short key", keys: "a:" + base64.StdEncoding.EncodeToString([]byte("short")), index: testKey(9), columns: all,
+			want: "must be 32 bytes"},
+		{name: "malformed entry", keys: "a b:" + testKey(1), index: testKey(9), columns: all, want: "malformed key entry"},
+		{name: "duplicate ID", keys: "a:" + testKey(1) + ",a:" + testKey(2), current: "a", index: testKey(9), columns: all,
+			want: "duplicate key ID"},
+		{name: "missing index key", keys: "a:" + testKey(1), columns: all, want: "FIELD_BLIND_INDEX_KEY"},
+		{name: "index key without keys", index: testKey(9), columns: all, want: "FIELD_ENCRYPTION_KEYS is required"},
+		{name: "unknown column", columns: "person.first_name", want: "cannot be encrypted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(tt.keys, tt.current, tt.index, tt.columns)
+			if tt.want == "" && err != nil {
+				t.Fatalf("load = %v", err)
+			}
+			if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Fatalf("load = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	useKeys(t, "old:"+testKey(1), "", PersonEmail+","+PersonAddress)
+
+	sealed, err := Encrypt(PersonEmail, "ann@example.edu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(sealed) || KeyIDOf(sealed) != "old" || strings.Contains(sealed, "ann") {
+		t.Fatalf("Encrypt = %q", sealed)
+	}
+	again, _ := Encrypt(PersonEmail, "ann@example.edu")
+	if again == sealed {
+		t.Fatal("two encryptions of a value are identical")
+	}
+	if got, err := Decrypt(PersonEmail, sealed); err != nil || got != "ann@example.edu" {
+		t.Fatalf("Decrypt = %q, %v", got, err)
+	}
+
+	// A ciphertext is bound to its column
+	if _, err := Decrypt(PersonAddress, sealed); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("Decrypt in another column = %v, want ErrMalformed", err)
+	}
+	tampered := sealed[:len(sealed)-2] + "AA"
+	if _, err := Decrypt(PersonEmail, tampered); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("Decrypt of a tampered value = %v, want ErrMalformed", err)
+	}
+
+	// Empty values, plaintext and columns left out of FIELD_ENCRYPTED_COLUMNS pass through
+	if got, _ := Encrypt(PersonEmail, ""); got != "" {
+		t.Fatalf("Encrypt of empty = %q", got)
+	}
+	if got, _ := Encrypt(PersonPhoneNumber, "555"); got != "555" {
+		t.Fatalf("Encrypt of an unlisted column = %q", got)
+	}
+	if got, _ := Decrypt(PersonEmail, "legacy@example.edu"); got != "legacy@example.edu" {
+		t.Fatalf("Decrypt of plaintext = %q", got)
+	}
+
+	// After rotation values sealed with the old key still open
+	useKeys(t, "old:"+testKey(1)+",new:"+testKey(2), "new", PersonEmail)
+	if got, err := Decrypt(PersonEmail, sealed); err != nil || got != "ann@example.edu" {
+		t.Fatalf("Decrypt after rotation = %q, %v", got, err)
+	}
+	if rotated, _ := Encrypt(PersonEmail, "ann@example.edu"); KeyIDOf(rotated) != "new" {
+		t.Fatalf("new values are sealed with %s", KeyIDOf(rotated))
+	}
+
+	useKeys(t, "new:"+testKey(2), "", PersonEmail)
+	if _, err := Decrypt(PersonEmail, sealed); !errors.Is(err, ErrUnknownID) {
+		t.Fatalf("Decrypt with a removed key = %v, want ErrUnknownID", err)
+	}
+	useKeys(t, "", "", PersonEmail)
+	if _, err := Decrypt(PersonEmail, sealed); !errors.Is(err, ErrDisabled) {
+		t.Fatalf("Decrypt without keys = %v, want ErrDisabled", err)
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	useKeys(t, "", "", PersonEmail)
+	if got := BlindIndex(PersonEmail, "ann@example.edu"); got != nil {
+		t.Fatalf("BlindIndex without keys = %v, want nil", got)
+	}
+
+	useKeys(t, "a:"+testKey(1), "", PersonEmail)
+	index := BlindIndex(PersonEmail, "ann@example.edu")
+	if s, ok := index.(string); !ok || len(s) != 64 {
+		t.Fatalf("BlindIndex = %v", index)
+	}
+	if BlindIndex(PersonEmail, "  ANN@example.edu ") != index {
+		t.Fatal("emails are not compared case-insensitively")
+	}
+	if BlindIndex(PersonPhoneNumber, "ann@example.edu") == index {
+		t.Fatal("the same value has the same index in two columns")
+	}
+	if BlindIndex(PersonEmail, "") != nil {
+		t.Fatal("empty values are indexed")
+	}
+}
+
+func TestWrapKey(t *testing.T) {
+	useKeys(t, "a:"+testKey(1), "", PersonEmail)
+	dek := bytes.Repeat([]byte{7}, 32)
+	id, wrapped, err := WrapKey(dek, []byte("file header"))
+	if err != nil || id != "a" {
+		t.Fatalf("WrapKey = %s, %v", id, err)
+	}
+	if got, err := UnwrapKey(id, wrapped, []byte("file header")); err != nil || !bytes.Equal(got, dek) {
+		t.Fatalf("UnwrapKey = %x, %v", got, err)
+	}
+	if _, err := UnwrapKey(id, wrapped, []byte("other header")); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("UnwrapKey with another aad = %v", err)
+	}
+	if _, err := UnwrapKey("b", wrapped, []byte("file header")); !errors.Is(err, ErrUnknownID) {
+		t.Fatalf("UnwrapKey with an unknown key = %v", err)
+	}
+
+	useKeys(t, "", "", PersonEmail)
+	if _, _, err := WrapKey(dek, nil); !errors.Is(err, ErrDisabled) {
+		t.Fatalf("WrapKey without keys = %v", err)
+	}
+}
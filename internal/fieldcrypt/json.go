@@ -0,0 +1,156 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PersonFields maps the JSON names of the encrypted person columns to the columns, for copies of
+// profiles such as audit entries and profile history
+var PersonFields = map[string]string{
+	"email":        PersonEmail,
+	"phone_number": PersonPhoneNumber,
+	"birthday":     PersonBirthday,
+	"address":      PersonAddress,
+}
+
+// SealJSON encrypts the values of fields anywhere in a JSON document, so copies of encrypted
+// columns are encrypted too. A field's value is sealed as its JSON text, objects below a field
+// such as {"email": {"before": ..., "after": ...}} have every value sealed, and nulls are kept.
+// Documents without such fields, or whose columns are not encrypted, are returned unchanged.
+func SealJSON(doc []byte, fields map[string]string) ([]byte, error) {
+	if !anyEnabled(fields) {
+		return doc, nil
+	}
+	return transform(doc, fields, func(column string, value []byte) ([]byte, error) {
+		if !Enabled(column) {
+			return value, nil
+		}
+		sealed, err := Encrypt(column, string(value))
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(sealed)
+	})
+}
+
+// OpenJSON decrypts the values SealJSON sealed, documents without sealed values are returned unchanged
+func OpenJSON(doc []byte, fields map[string]string) ([]byte, error) {
+	if !strings.Contains(string(doc), prefix) {
+		return doc, nil
+	}
+	return transform(doc, fields, func(column string, value []byte) ([]byte, error) {
+		var stored string
+		if json.Unmarshal(value, &stored) != nil || !IsEncrypted(stored) {
+			return value, nil
+		}
+		plaintext, err := Decrypt(column, stored)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", column, err)
+		}
+		if !json.Valid([]byte(plaintext)) {
+			return nil, ErrMalformed
+		}
+		return []byte(plaintext), nil
+	})
+}
+
+// anyEnabled reports whether one of the columns of fields is encrypted
+func anyEnabled(fields map[string]string) bool {
+	for _, column := range fields {
+		if Enabled(column) {
+			return true
+		}
+	}
+	return false
+}
+
+// transform rewrites a JSON document compactly, keeping the order of object keys, and passes
+// every non-null value below one of fields to leaf with the field's column
+func transform(doc []byte, fields map[string]string, leaf func(column string, value []byte) ([]byte, error)) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var out bytes.Buffer
+	if err := walk(dec, &out, fields, "", leaf); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, ErrMalformed
+	}
+	return out.Bytes(), nil
+}
+
+// walk copies the next value of dec to out, column is set below an encrypted field
+func walk(dec *json.Decoder, out *bytes.Buffer, fields map[string]string, column string, leaf func(string, []byte) ([]byte, error)) error {
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	raw = bytes.TrimSpace(raw)
+
+	switch {
+	case len(raw) > 0 && raw[0] == '{':
+		inner := json.NewDecoder(bytes.NewReader(raw))
+		inner.UseNumber()
+		inner.Token()
+		out.WriteByte('{')
+		for i := 0; inner.More(); i++ {
+			token, err := inner.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := token.(string)
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			encoded, _ := json.Marshal(key)
+			out.Write(encoded)
+			out.WriteByte(':')
+
+			child := column
+			if c, ok := fields[key]; ok && column == "" {
+				child = c
+			}
+			if err := walk(inner, out, fields, child, leaf); err != nil {
+				return err
+			}
+		}
+		out.WriteByte('}')
+		return nil
+
+	case len(raw) > 0 && raw[0] == '[':
+		inner := json.NewDecoder(bytes.NewReader(raw))
+		inner.UseNumber()
+		inner.Token()
+		out.WriteByte('[')
+		for i := 0; inner.More(); i++ {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			if err := walk(inner, out, fields, column, leaf); err != nil {
+				return err
+			}
+		}
+		out.WriteByte(']')
+		return nil
+
+	case column != "" && string(raw) != "null":
+		value, err := leaf(column, raw)
+		if err != nil {
+			return err
+		}
+		out.Write(value)
+		return nil
+
+	default:
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, raw); err != nil {
+			return err
+		}
+		out.Write(compact.Bytes())
+		return nil
+	}
+}
@@ -0,0 +1,54 @@
+package fieldcrypt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSealJSON(t *testing.T) {
+	useKeys(t, "a:"+testKey(1), "", strings.Join(Columns, ","))
+
+	doc := `{"person_id": 4, "first_name": "Ann", "email": "ann@example.edu", "birthday": null,
+		"changes": {"address": {"before": "1 Main St", "after": "2 Oak Ave"}},
+		"history": [{"phone_number": 5551234}]}`
+	sealed, err := SealJSON([]byte(doc), PersonFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plaintext := range []string{"ann@example.edu", "Main St", "Oak Ave", "5551234"} {
+		if strings.Contains(string(sealed), plaintext) {
+			t.Fatalf("%s was not sealed: %s", plaintext, sealed)
+		}
+	}
+	for _, kept := range []string{`"person_id":4`, `"first_name":"Ann"`, `"birthday":null`} {
+		if !strings.Contains(string(sealed), kept) {
+			t.Fatalf("%s was not kept: %s", kept, sealed)
+		}
+	}
+
+	opened, err := OpenJSON(sealed, PersonFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"person_id":4,"first_name":"Ann","email":"ann@example.edu","birthday":null,` +
+		`"changes":{"address":{"before":"1 Main St","after":"2 Oak Ave"}},"history":[{"phone_number":5551234}]}`
+	if string(opened) != want {
+		t.Fatalf("OpenJSON =\n%s\nwant\n%s", opened, want)
+	}
+
+	if _, err := SealJSON([]byte(`{"email": "a"} trailing`), PersonFields); err == nil {
+		t.Fatal("SealJSON accepted trailing data")
+	}
+}
+
+func TestSealJSONDisabled(t *testing.T) {
+	useKeys(t, "", "", strings.Join(Columns, ","))
+	doc := []byte(`{"email": "ann@example.edu"}`)
+	sealed, err := SealJSON(doc, PersonFields)
+	if err != nil || string(sealed) != string(doc) {
+		t.Fatalf("SealJSON without keys = %s, %v", sealed, err)
+	}
+	if opened, err := OpenJSON(doc, PersonFields); err != nil || string(opened) != string(doc) {
+		t.Fatalf("OpenJSON of plaintext = %s, %v", opened, err)
+	}
+}
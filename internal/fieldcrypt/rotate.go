@@ -0,0 +1,325 @@
+package fieldcrypt
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// table is a table with encrypted columns
+type table struct {
+	name     string
+	idColumn string
+	// columns are the encrypted columns, indexes maps a column to its blind index column
+	columns []string
+	indexes map[string]string
+	// documents maps a column holding JSON documents to the fields sealed in them with SealJSON
+	documents map[string]map[string]string
+}
+
+var tables = []table{{
+	name:     "person",
+	idColumn: "person_id",
+	columns:  []string{PersonEmail, PersonPhoneNumber, PersonBirthday, PersonAddress},
+	indexes:  map[string]string{PersonEmail: "email_index"},
+}, {
+	name:     "profile_history",
+	idColumn: "history_id",
+	columns:  []string{"profile_history.snapshot", "profile_history.changes"},
+	documents: map[string]map[string]string{
+		"profile_history.snapshot": PersonFields,
+		"profile_history.changes":  PersonFields,
+	},
+}}
+
+// RotateResult counts the rows a rotation looked at and rewrote
+type RotateResult struct {
+	Scanned int `json:"scanned"`
+	Updated int `json:"updated"`
+}
+
+// Rotate brings every encrypted table in line with the configuration: values sealed with an older
+// key and plaintext rows are sealed with the current key, columns no longer configured are
+// decrypted and blind indexes are recomputed. force re-encrypts values already sealed with the
+// current key. Rows are rewritten in batches, each in its own transaction, so the server can keep
+// running and an interrupted rotation can simply be started again.
+//
+// Audit entries are append-only and keep the key they were sealed with, old keys must stay
+// configured for as long as those entries have to be read. Idempotency responses expire within a
+// day and are left alone.
+func Rotate(ctx context.Context, db *sql.DB, batch int, force bool) (RotateResult, error) {
+	var result RotateResult
+	if batch <= 0 {
+		batch = 500
+	}
+	if err := Check(); err != nil {
+		return result, err
+	}
+	for _, t := range tables {
+		t := t
+		err := rotateAll(&result, t.name, t.idColumn, batch, func(lastID int) (int, int, int, error) {
+			return rotateBatch(ctx, db, t, lastID, batch, force)
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	err := rotateAll(&result, "stu_dis", "stu_dis_id", batch, func(lastID int) (int, int, int, error) {
+		return rotateLinks(ctx, db, lastID, batch, force)
+	})
+	return result, err
+}
+
+// rotateAll runs a batch function until a batch comes back short
+func rotateAll(result *RotateResult, name, idColumn string, batch int, run func(lastID int) (int, int, int, error)) error {
+	lastID := 0
+	for {
+		n, updated, next, err := run(lastID)
+		result.Scanned += n
+		result.Updated += updated
+		if err != nil {
+			return fmt.Errorf("%s after %s %d: %w", name, idColumn, lastID, err)
+		}
+		if n < batch {
+			return nil
+		}
+		lastID = next
+	}
+}
+
+// rotateBatch rewrites up to batch rows after lastID and returns how many it read and rewrote and the last ID
+func rotateBatch(ctx context.Context, db *sql.DB, t table, lastID, batch int, force bool) (int, int, int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, lastID, err
+	}
+	defer tx.Rollback()
+
+	names := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		names[i] = columnName(column)
+	}
+	var indexNames []string
+	for _, column := range t.columns {
+		if index, ok := t.indexes[column]; ok {
+			indexNames = append(indexNames, index)
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s, %s FROM %s WHERE %s > ? ORDER BY %s LIMIT ? FOR UPDATE",
+		t.idColumn, strings.Join(append(append([]string{}, names...), indexNames...), ", "),
+		t.name, t.idColumn, t.idColumn,
+	), lastID, batch)
+	if err != nil {
+		return 0, 0, lastID, err
+	}
+
+	type row struct {
+		id      int
+		values  []sql.NullString
+		indexes []sql.NullString
+	}
+	var pending []row
+	for rows.Next() {
+		r := row{values: make([]sql.NullString, len(names)), indexes: make([]sql.NullString, len(indexNames))}
+		dest := []any{&r.id}
+		for i := range r.values {
+			dest = append(dest, &r.values[i])
+		}
+		for i := range r.indexes {
+			dest = append(dest, &r.indexes[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return 0, 0, lastID, err
+		}
+		pending = append(pending, r)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, 0, lastID, err
+	}
+
+	current := CurrentKeyID()
+	updated := 0
+	for _, r := range pending {
+		lastID = r.id
+		var set []string
+		var args []any
+		index := 0
+		for i, column := range t.columns {
+			stored := r.values[i].String
+			if fields, ok := t.documents[column]; ok {
+				if !r.values[i].Valid || !staleJSON([]byte(stored), fields, force) {
+					continue
+				}
+				opened, err := OpenJSON([]byte(stored), fields)
+				if err != nil {
+					return len(pending), 0, lastID, fmt.Errorf("%s %d: %w", t.idColumn, r.id, err)
+				}
+				sealed, err := SealJSON(opened, fields)
+				if err != nil {
+					return len(pending), 0, lastID, err
+				}
+				set = append(set, names[i]+" = ?")
+				args = append(args, string(sealed))
+				continue
+			}
+
+			plaintext, err := Decrypt(column, stored)
+			if err != nil {
+				return len(pending), 0, lastID, fmt.Errorf("%s %d: %w", t.idColumn, r.id, err)
+			}
+
+			stale := stored != "" && (force || KeyIDOf(stored) != current && Enabled(column) || IsEncrypted(stored) && !Enabled(column))
+			if stale {
+				sealed, err := Encrypt(column, plaintext)
+				if err != nil {
+					return len(pending), 0, lastID, err
+				}
+				set = append(set, names[i]+" = ?")
+				args = append(args, sealed)
+			}
+
+			if indexColumn, ok := t.indexes[column]; ok {
+				want := BlindIndex(column, plaintext)
+				have := r.indexes[index]
+				index++
+				if want == nil && have.Valid || want != nil && (!have.Valid || have.String != want) {
+					set = append(set, indexColumn+" = ?")
+					args = append(args, want)
+				}
+			}
+		}
+		if len(set) == 0 {
+			continue
+		}
+
+		args = append(args, r.id)
+		if _, err := tx.ExecContext(ctx,
+			fmt.Sprintf("UPDATE %s SET %s WHERE %s = ?", t.name, strings.Join(set, ", "), t.idColumn),
+			args...,
+		); err != nil {
+			return len(pending), 0, lastID, err
+		}
+		updated++
+	}
+
+	// Nothing was rewritten when the batch does not commit
+	if err := tx.Commit(); err != nil {
+		return len(pending), 0, lastID, err
+	}
+	return len(pending), updated, lastID, nil
+}
+
+// staleJSON reports whether a document has fields sealed with an older key or not sealed as configured
+func staleJSON(doc []byte, fields map[string]string, force bool) bool {
+	current := CurrentKeyID()
+	stale := false
+	transform(doc, fields, func(column string, value []byte) ([]byte, error) {
+		var stored string
+		sealed := json.Unmarshal(value, &stored) == nil && IsEncrypted(stored)
+		switch {
+		case sealed && (force || !Enabled(column) || KeyIDOf(stored) != current):
+			stale = true
+		case !sealed && Enabled(column):
+			stale = true
+		}
+		return value, nil
+	})
+	return stale
+}
+
+// rotateLinks rewrites up to batch stu_dis rows after lastID. Sealed links keep the disability ID
+// only in disability_ref with its blind index, plain links only in disability_id.
+func rotateLinks(ctx context.Context, db *sql.DB, lastID, batch int, force bool) (int, int, int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, lastID, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT stu_dis_id, disability_id, disability_ref, disability_index
+		FROM stu_dis WHERE stu_dis_id > ? ORDER BY stu_dis_id LIMIT ? FOR UPDATE`, lastID, batch)
+	if err != nil {
+		return 0, 0, lastID, err
+	}
+
+	type row struct {
+		id    int
+		plain sql.NullInt64
+		ref   sql.NullString
+		index sql.NullString
+	}
+	var pending []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.plain, &r.ref, &r.index); err != nil {
+			rows.Close()
+			return 0, 0, lastID, err
+		}
+		pending = append(pending, r)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, 0, lastID, err
+	}
+
+	current := CurrentKeyID()
+	enabled := Enabled(StuDisDisabilityID)
+	updated := 0
+	for _, r := range pending {
+		lastID = r.id
+		value := strconv.FormatInt(r.plain.Int64, 10)
+		if !r.plain.Valid {
+			if value, err = Decrypt(StuDisDisabilityID, r.ref.String); err != nil {
+				return len(pending), 0, lastID, fmt.Errorf("stu_dis_id %d: %w", r.id, err)
+			}
+		}
+		disabilityID, err := strconv.Atoi(value)
+		if err != nil {
+			return len(pending), 0, lastID, fmt.Errorf("stu_dis_id %d: %w", r.id, ErrMalformed)
+		}
+
+		var plain, ref, index any = disabilityID, nil, nil
+		if enabled {
+			index = BlindIndex(StuDisDisabilityID, value)
+			if !r.plain.Valid && !force && KeyIDOf(r.ref.String) == current && r.index.Valid && r.index.String == index {
+				continue
+			}
+			if ref, err = Encrypt(StuDisDisabilityID, value); err != nil {
+				return len(pending), 0, lastID, err
+			}
+			plain = nil
+		} else if r.plain.Valid && !r.ref.Valid && !r.index.Valid {
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE stu_dis SET disability_id = ?, disability_ref = ?, disability_index = ? WHERE stu_dis_id = ?",
+			plain, ref, index, r.id,
+		); err != nil {
+			return len(pending), 0, lastID, err
+		}
+		updated++
+	}
+
+	// Nothing was rewritten when the batch does not commit
+	if err := tx.Commit(); err != nil {
+		return len(pending), 0, lastID, err
+	}
+	return len(pending), updated, lastID, nil
+}
+
+// columnName strips the table from table.column
+func columnName(column string) string {
+	_, name, _ := strings.Cut(column, ".")
+	return name
+}
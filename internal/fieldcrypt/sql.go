@@ -0,0 +1,75 @@
+package fieldcrypt
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// Value wraps a query argument so it is encrypted for column when the statement runs:
+//
+//	db.ExecContext(ctx, "UPDATE person SET address = ? WHERE person_id = ?",
+//		fieldcrypt.Value(fieldcrypt.PersonAddress, p.Address), p.PersonID)
+func Value(column, plaintext string) driver.Valuer {
+	return value{column, plaintext}
+}
+
+type value struct {
+	column, plaintext string
+}
+
+func (v value) Value() (driver.Value, error) {
+	return Encrypt(v.column, v.plaintext)
+}
+
+// Scan wraps a scan destination so the column is decrypted into dst:
+//
+//	rows.Scan(&p.PersonID, fieldcrypt.Scan(fieldcrypt.PersonAddress, &p.Address))
+//
+// NULL scans as an empty string.
+func Scan(column string, dst *string) sql.Scanner {
+	return scanner{column, dst}
+}
+
+type scanner struct {
+	column string
+	dst    *string
+}
+
+func (s scanner) Scan(src any) error {
+	var stored string
+	switch v := src.(type) {
+	case nil:
+		*s.dst = ""
+		return nil
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	case time.Time:
+		// Dates in columns that have not been converted yet
+		*s.dst = v.Format("2006-01-02")
+		return nil
+	default:
+		return fmt.Errorf("fieldcrypt: cannot scan %T into %s", src, s.column)
+	}
+
+	plaintext, err := Decrypt(s.column, stored)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.column, err)
+	}
+	*s.dst = plaintext
+	return nil
+}
+
+// EmailMatch returns a condition matching the person aliased alias by email and its arguments. It
+// goes through the blind index, falling back to the plaintext column for rows written before
+// encryption was enabled that the rotation has not indexed yet.
+func EmailMatch(alias, email string) (string, []any) {
+	index := BlindIndex(PersonEmail, email)
+	if index == nil {
+		return alias + ".email = ?", []any{email}
+	}
+	return fmt.Sprintf("(%[1]s.email_index = ? OR (%[1]s.email_index IS NULL AND %[1]s.email = ?))", alias), []any{index, email}
+}
@@ -0,0 +1,424 @@
+// Package filecrypt encrypts uploaded documents at rest. Every file gets its own random data key,
+// wrapped by the field encryption keys (see fieldcrypt), and the content is sealed in fixed size
+// AES-256-GCM chunks so downloads decrypt as they stream and can still serve byte ranges.
+//
+// An encrypted file is a header followed by the chunks:
+//
+//	magic "PCXENC01" | key ID length (1) | key ID | wrapped key length (2) | wrapped key | chunk size (4) | nonce prefix (7)
+//
+// Each chunk is sealed with the nonce prefix, its index and a flag marking the last chunk, so
+// chunks cannot be reordered, dropped or cut off without failing authentication. Files that do
+// not start with the magic are plaintext written before encryption was enabled.
+package filecrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+)
+
+const (
+	magic       = "PCXENC01"
+	chunkSize   = 64 << 10
+	prefixSize  = 7
+	overhead    = 16 // GCM tag per chunk
+	maxKeyIDLen = 255
+)
+
+var (
+	ErrMalformed = errors.New("filecrypt: malformed encrypted file")
+	ErrTampered  = errors.New("filecrypt: encrypted file failed authentication")
+)
+
+// Enabled reports whether new files are encrypted
+func Enabled() bool {
+	return fieldcrypt.CurrentKeyID() != ""
+}
+
+// header is the parsed start of an encrypted file
+type header struct {
+	keyID     string
+	wrapped   []byte
+	chunkSize int
+	prefix    []byte
+	length    int64
+}
+
+// aad binds the wrapped data key to the chunk layout of its file
+func (h header) aad() []byte {
+	aad := append([]byte(magic), 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(aad[len(magic):], uint32(h.chunkSize))
+	return append(aad, h.prefix...)
+}
+
+func (h header) marshal() []byte {
+	var b bytes.Buffer
+	b.WriteString(magic)
+	b.WriteByte(byte(len(h.keyID)))
+	b.WriteString(h.keyID)
+	binary.Write(&b, binary.BigEndian, uint16(len(h.wrapped)))
+	b.Write(h.wrapped)
+	binary.Write(&b, binary.BigEndian, uint32(h.chunkSize))
+	b.Write(h.prefix)
+	return b.Bytes()
+}
+
+// readHeader parses the header at the start of ra
+func readHeader(ra io.ReaderAt) (header, error) {
+	var h header
+	buf := make([]byte, len(magic)+1)
+	if _, err := ra.ReadAt(buf, 0); err != nil {
+		return h, ErrMalformed
+	}
+	if string(buf[:len(magic)]) != magic {
+		return h, ErrMalformed
+	}
+	off := int64(len(buf))
+
+	id := make([]byte, buf[len(magic)])
+	if _, err := ra.ReadAt(id, off); err != nil {
+		return h, ErrMalformed
+	}
+	off += int64(len(id))
+	h.keyID = string(id)
+
+	var n [2]byte
+	if _, err := ra.ReadAt(n[:], off); err != nil {
+		return h, ErrMalformed
+	}
+	off += 2
+	h.wrapped = make([]byte, binary.BigEndian.Uint16(n[:]))
+	if _, err := ra.ReadAt(h.wrapped, off); err != nil {
+		return h, ErrMalformed
+	}
+	off += int64(len(h.wrapped))
+
+	var size [4]byte
+	if _, err := ra.ReadAt(size[:], off); err != nil {
+		return h, ErrMalformed
+	}
+	off += 4
+	h.chunkSize = int(binary.BigEndian.Uint32(size[:]))
+	if h.chunkSize <= 0 || h.chunkSize > 16<<20 {
+		return h, ErrMalformed
+	}
+
+	h.prefix = make([]byte, prefixSize)
+	if _, err := ra.ReadAt(h.prefix, off); err != nil {
+		return h, ErrMalformed
+	}
+	h.length = off + prefixSize
+	return h, nil
+}
+
+// IsEncrypted reports whether ra starts with an encrypted file header
+func IsEncrypted(ra io.ReaderAt) bool {
+	buf := make([]byte, len(magic))
+	_, err := ra.ReadAt(buf, 0)
+	return err == nil && string(buf) == magic
+}
+
+// KeyID returns the ID of the key wrapping the data key of an encrypted file
+func KeyID(ra io.ReaderAt) (string, error) {
+	h, err := readHeader(ra)
+	return h.keyID, err
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce is the prefix, the chunk index and the last chunk flag
+func nonce(prefix []byte, index uint32, last bool) []byte {
+	n := make([]byte, 12)
+	copy(n, prefix)
+	binary.BigEndian.PutUint32(n[prefixSize:], index)
+	if last {
+		n[11] = 1
+	}
+	return n
+}
+
+// Writer encrypts everything written to it. Close must be called to seal the last chunk.
+type Writer struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	buf     []byte
+	index   uint32
+	closed  bool
+	err     error
+	written int64
+}
+
+// NewWriter writes the header of a new encrypted file with a fresh data key to w
+func NewWriter(w io.Writer) (*Writer, error) {
+	x, h, err := newWriter()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(h); err != nil {
+		return nil, err
+	}
+	x.w = w
+	return x, nil
+}
+
+// newWriter returns a writer with a fresh data key and the header it has to be preceded by
+func newWriter() (*Writer, []byte, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, nil, err
+	}
+	h := header{chunkSize: chunkSize, prefix: make([]byte, prefixSize)}
+	if _, err := rand.Read(h.prefix); err != nil {
+		return nil, nil, err
+	}
+
+	var err error
+	h.keyID, h.wrapped, err = fieldcrypt.WrapKey(dek, h.aad())
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(h.keyID) > maxKeyIDLen {
+		return nil, nil, fmt.Errorf("filecrypt: key ID %s is too long", h.keyID)
+	}
+
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Writer{aead: aead, prefix: h.prefix, buf: make([]byte, 0, chunkSize)}, h.marshal(), nil
+}
+
+// Write buffers p and seals every chunk that is known not to be the last one
+func (x *Writer) Write(p []byte) (int, error) {
+	if x.err != nil {
+		return 0, x.err
+	}
+	if x.closed {
+		return 0, errors.New("filecrypt: write after close")
+	}
+	n := 0
+	for len(p) > 0 {
+		// A full buffer is only sealed once more data arrives, the last chunk is sealed by Close
+		if len(x.buf) == chunkSize {
+			if x.err = x.flush(false); x.err != nil {
+				return n, x.err
+			}
+		}
+		c := copy(x.buf[len(x.buf):chunkSize], p)
+		x.buf = x.buf[:len(x.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	x.written += int64(n)
+	return n, nil
+}
+
+func (x *Writer) flush(last bool) error {
+	sealed := x.aead.Seal(nil, nonce(x.prefix, x.index, last), x.buf, nil)
+	x.index++
+	x.buf = x.buf[:0]
+	_, err := x.w.Write(sealed)
+	return err
+}
+
+// Close seals the last chunk, an empty one for an empty file. It does not close the underlying writer.
+func (x *Writer) Close() error {
+	if x.closed {
+		return x.err
+	}
+	x.closed = true
+	if x.err == nil {
+		x.err = x.flush(true)
+	}
+	return x.err
+}
+
+// Reader decrypts an encrypted file and supports seeking, so it can back http.ServeContent
+type Reader struct {
+	ra        io.ReaderAt
+	aead      cipher.AEAD
+	h         header
+	chunks    int64
+	size      int64
+	pos       int64
+	chunk     []byte
+	chunkAt   int64
+	sealedBuf []byte
+}
+
+// NewReader opens the encrypted file in ra, whose total length is size
+func NewReader(ra io.ReaderAt, size int64) (*Reader, error) {
+	h, err := readHeader(ra)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := fieldcrypt.UnwrapKey(h.keyID, h.wrapped, h.aad())
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every chunk is full except the last, which holds at least its tag
+	body := size - h.length
+	sealedChunk := int64(h.chunkSize + overhead)
+	if body < overhead {
+		return nil, ErrMalformed
+	}
+	chunks := (body + sealedChunk - 1) / sealedChunk
+	if body-(chunks-1)*sealedChunk < overhead {
+		return nil, ErrMalformed
+	}
+
+	return &Reader{
+		ra:        ra,
+		aead:      aead,
+		h:         h,
+		chunks:    chunks,
+		size:      body - chunks*overhead,
+		chunkAt:   -1,
+		sealedBuf: make([]byte, sealedChunk),
+	}, nil
+}
+
+// Size returns the length of the decrypted content
+func (x *Reader) Size() int64 {
+	return x.size
+}
+
+// load decrypts chunk i into the buffer
+func (x *Reader) load(i int64) error {
+	if x.chunkAt == i {
+		return nil
+	}
+	sealedChunk := int64(x.h.chunkSize + overhead)
+	off := x.h.length + i*sealedChunk
+	n := sealedChunk
+	last := i == x.chunks-1
+	if last {
+		n = x.h.length + x.size + x.chunks*overhead - off
+	}
+	sealed := x.sealedBuf[:n]
+	if _, err := x.ra.ReadAt(sealed, off); err != nil && !(err == io.EOF && last) {
+		return err
+	}
+	plain, err := x.aead.Open(x.chunk[:0], nonce(x.h.prefix, uint32(i), last), sealed, nil)
+	if err != nil {
+		x.chunkAt = -1
+		return ErrTampered
+	}
+	x.chunk, x.chunkAt = plain, i
+	return nil
+}
+
+func (x *Reader) Read(p []byte) (int, error) {
+	if x.pos >= x.size {
+		// The last chunk is always checked, it may be empty, so a cut off file never reads as complete
+		if err := x.load(x.chunks - 1); err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	i := x.pos / int64(x.h.chunkSize)
+	if err := x.load(i); err != nil {
+		return 0, err
+	}
+	n := copy(p, x.chunk[x.pos-i*int64(x.h.chunkSize):])
+	x.pos += int64(n)
+	return n, nil
+}
+
+func (x *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += x.pos
+	case io.SeekEnd:
+		offset += x.size
+	default:
+		return 0, errors.New("filecrypt: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("filecrypt: negative position")
+	}
+	x.pos = offset
+	return offset, nil
+}
+
+// Source is stored content that can be read in place, such as a blobstore.Object
+type Source interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+// Open returns the content of src, whose stored length is size, decrypted when it is encrypted,
+// and the length of the content
+func Open(src Source, size int64) (io.ReadSeeker, int64, error) {
+	if !IsEncrypted(src) {
+		return src, size, nil
+	}
+	r, err := NewReader(src, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	return r, r.Size(), nil
+}
+
+// Encrypt returns the size bytes of r as they are stored, encrypted when encryption is enabled,
+// and their stored length. The encryption runs as the result is read; Close must be called and
+// stops it early.
+func Encrypt(r io.Reader, size int64) (io.ReadCloser, int64, error) {
+	if !Enabled() {
+		return io.NopCloser(r), size, nil
+	}
+	w, h, err := newWriter()
+	if err != nil {
+		return nil, 0, err
+	}
+	pr, pw := io.Pipe()
+	w.w = pw
+	go func() {
+		n, err := io.Copy(w, r)
+		if err == nil && n != size {
+			err = fmt.Errorf("filecrypt: read %d bytes, expected %d", n, size)
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	// Every chunk is full except the last, which is empty for an empty file
+	chunks := (size + chunkSize - 1) / chunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	stored := io.MultiReader(bytes.NewReader(h), pr)
+	return encrypted{stored, pr}, int64(len(h)) + size + chunks*overhead, nil
+}
+
+// encrypted is the stream returned by Encrypt
+type encrypted struct {
+	io.Reader
+	pipe *io.PipeReader
+}
+
+func (e encrypted) Close() error {
+	return e.pipe.Close()
+}
@@ -0,0 +1,176 @@
+package filecrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("FIELD_ENCRYPTION_KEYS", "test:"+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	os.Setenv("FIELD_BLIND_INDEX_KEY", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32)))
+	os.Exit(m.Run())
+}
+
+// encrypt returns content encrypted with Encrypt, checking the stored length it announced
+func encrypt(t *testing.T, content []byte) []byte {
+	t.Helper()
+	stream, size, err := Encrypt(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	stored, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(stored)) != size {
+		t.Fatalf("Encrypt announced %d bytes and wrote %d", size, len(stored))
+	}
+	return stored
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17} {
+		content := make([]byte, n)
+		rand.Read(content)
+		stored := encrypt(t, content)
+
+		if !IsEncrypted(bytes.NewReader(stored)) {
+			t.Fatalf("%d bytes: not encrypted", n)
+		}
+		if id, err := KeyID(bytes.NewReader(stored)); err != nil || id != "test" {
+			t.Fatalf("%d bytes: KeyID = %q, %v", n, id, err)
+		}
+		r, size, err := Open(bytes.NewReader(stored), int64(len(stored)))
+		if err != nil {
+			t.Fatalf("%d bytes: %v", n, err)
+		}
+		if size != int64(n) {
+			t.Fatalf("%d bytes: Open reports %d", n, size)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, content) {
+			t.Fatalf("%d bytes: decrypted %d bytes, %v", n, len(got), err)
+		}
+	}
+}
+
+func TestWriterMatchesEncrypt(t *testing.T) {
+	content := bytes.Repeat([]byte("piconex "), chunkSize/4)
+	var stored bytes.Buffer
+	w, err := NewWriter(&stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Small writes across chunk boundaries
+	for i := 0; i < len(content); i += 1000 {
+		end := min(i+1000, len(content))
+		if _, err := w.Write(content[i:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("x")); err == nil {
+		t.Fatal("Write after Close succeeded")
+	}
+
+	r, err := NewReader(bytes.NewReader(stored.Bytes()), int64(stored.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("decrypted %d bytes, %v", len(got), err)
+	}
+}
+
+func TestReaderSeeks(t *testing.T) {
+	content := make([]byte, 2*chunkSize+100)
+	rand.Read(content)
+	stored := encrypt(t, content)
+	r, err := NewReader(bytes.NewReader(stored), int64(len(stored)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ranges inside a chunk, across a boundary and at the end, like http.ServeContent asks for
+	for _, span := range [][2]int{{10, 20}, {chunkSize - 5, chunkSize + 5}, {len(content) - 50, len(content)}, {0, len(content)}} {
+		if _, err := r.Seek(int64(span[0]), io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, span[1]-span[0])
+		if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, content[span[0]:span[1]]) {
+			t.Fatalf("range %v: %v", span, err)
+		}
+	}
+	if pos, err := r.Seek(-10, io.SeekEnd); err != nil || pos != int64(len(content))-10 {
+		t.Fatalf("Seek from end = %d, %v", pos, err)
+	}
+	if _, err := r.Seek(-1, io.SeekStart); err == nil {
+		t.Fatal("seeked before the start")
+	}
+}
+
+func TestTamperingIsDetected(t *testing.T) {
+	content := make([]byte, 2*chunkSize+100)
+	rand.Read(content)
+	stored := encrypt(t, content)
+	sealedChunk := chunkSize + overhead
+	headerLen := len(stored) - len(content) - 3*overhead
+
+	read := func(stored []byte) error {
+		r, err := NewReader(bytes.NewReader(stored), int64(len(stored)))
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadAll(r)
+		return err
+	}
+
+	flipped := bytes.Clone(stored)
+	flipped[headerLen+sealedChunk+10] ^= 1
+	if err := read(flipped); !errors.Is(err, ErrTampered) {
+		t.Fatalf("flipped byte: %v, want ErrTampered", err)
+	}
+
+	// Swapping the first two chunks breaks their nonces
+	swapped := bytes.Clone(stored)
+	first := bytes.Clone(swapped[headerLen : headerLen+sealedChunk])
+	copy(swapped[headerLen:], swapped[headerLen+sealedChunk:headerLen+2*sealedChunk])
+	copy(swapped[headerLen+sealedChunk:], first)
+	if err := read(swapped); !errors.Is(err, ErrTampered) {
+		t.Fatalf("swapped chunks: %v, want ErrTampered", err)
+	}
+
+	// A file cut after a full chunk never reads as complete
+	cut := stored[:headerLen+2*sealedChunk]
+	if err := read(cut); !errors.Is(err, ErrTampered) {
+		t.Fatalf("cut off file: %v, want ErrTampered", err)
+	}
+
+	wrongKey := bytes.Clone(stored)
+	wrongKey[len(magic)+1+len("test")+2] ^= 1
+	if err := read(wrongKey); err == nil {
+		t.Fatal("a damaged wrapped key was accepted")
+	}
+	if err := read(stored[:len(magic)+3]); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("truncated header: %v, want ErrMalformed", err)
+	}
+}
+
+func TestOpenPassesPlaintextThrough(t *testing.T) {
+	plain := []byte("%PDF-1.7 written before encryption")
+	r, size, err := Open(bytes.NewReader(plain), int64(len(plain)))
+	if err != nil || size != int64(len(plain)) {
+		t.Fatalf("Open = %d, %v", size, err)
+	}
+	if got, _ := io.ReadAll(r); !bytes.Equal(got, plain) {
+		t.Fatalf("read %q", got)
+	}
+}
@@ -0,0 +1,201 @@
+package filecrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+)
+
+// MigrateResult counts what a migration did to the stored documents
+type MigrateResult struct {
+	Scanned   int              `json:"scanned"`
+	Encrypted int              `json:"encrypted"`
+	Rewrapped int              `json:"rewrapped"`
+	Verified  int              `json:"verified"`
+	Failed    []MigrateFailure `json:"failed"`
+}
+
+// MigrateFailure is a document that could not be migrated or verified
+type MigrateFailure struct {
+	DocumentationID int    `json:"documentation_id"`
+	StorageKey      string `json:"storage_key"`
+	Error           string `json:"error"`
+}
+
+// Migrate encrypts every stored document that is still plaintext and re-encrypts the ones sealed
+// with an older key, then checks that each file decrypts to the size recorded in documentation.
+// A file is encrypted into a temporary file, verified against a hash of its content and only then
+// put back under its key, which replaces it in one step, so an interrupted migration leaves every
+// file readable and can be started again. verifyOnly only decrypts and checks the files.
+func Migrate(ctx context.Context, db *sql.DB, store blobstore.BlobStore, verifyOnly bool) (MigrateResult, error) {
+	result := MigrateResult{Failed: []MigrateFailure{}}
+	if !verifyOnly && !Enabled() {
+		return result, fieldcrypt.ErrDisabled
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT documentation_id, storage_key, size_bytes FROM documentation ORDER BY documentation_id")
+	if err != nil {
+		return result, err
+	}
+	type document struct {
+		id   int
+		key  string
+		size int64
+	}
+	var documents []document
+	for rows.Next() {
+		var d document
+		if err := rows.Scan(&d.id, &d.key, &d.size); err != nil {
+			rows.Close()
+			return result, err
+		}
+		documents = append(documents, d)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return result, err
+	}
+
+	for _, d := range documents {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		result.Scanned++
+
+		if !verifyOnly {
+			rewritten, err := migrateFile(ctx, store, d.key)
+			if err != nil {
+				result.Failed = append(result.Failed, MigrateFailure{d.id, d.key, err.Error()})
+				continue
+			}
+			switch rewritten {
+			case "encrypted":
+				result.Encrypted++
+			case "rewrapped":
+				result.Rewrapped++
+			}
+		}
+
+		if err := verifyFile(ctx, store, d.key, d.size); err != nil {
+			result.Failed = append(result.Failed, MigrateFailure{d.id, d.key, err.Error()})
+			continue
+		}
+		result.Verified++
+	}
+	return result, nil
+}
+
+// migrateFile rewrites key with the current key unless it is already sealed with it and reports
+// whether it was encrypted for the first time or moved off an older key
+func migrateFile(ctx context.Context, store blobstore.BlobStore, key string) (string, error) {
+	obj, err := store.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	encrypted := IsEncrypted(obj)
+	keyID := ""
+	if encrypted {
+		keyID, err = KeyID(obj)
+	}
+	obj.Close()
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case !encrypted:
+		return "encrypted", rewrite(ctx, store, key)
+	case keyID != fieldcrypt.CurrentKeyID():
+		return "rewrapped", rewrite(ctx, store, key)
+	}
+	return "", nil
+}
+
+// rewrite encrypts the content of key with a fresh data key under the current key
+func rewrite(ctx context.Context, store blobstore.BlobStore, key string) error {
+	obj, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	content, _, err := Open(obj, obj.Info().Size)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "piconex-encrypt-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	// Hashes the content on the way in so the result can be checked before it replaces the original
+	sum := sha256.New()
+	w, err := NewWriter(tmp)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(w, io.TeeReader(content, sum))
+	if err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	obj.Close()
+
+	size, err := tmp.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	check, _, err := Open(tmp, size)
+	if err != nil {
+		return err
+	}
+	checkSum := sha256.New()
+	m, err := io.Copy(checkSum, check)
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	if m != n || !bytes.Equal(sum.Sum(nil), checkSum.Sum(nil)) {
+		return fmt.Errorf("verify: encrypted copy does not match the original")
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return store.Put(ctx, key, tmp, size, "application/octet-stream")
+}
+
+// verifyFile reads key to the end, which authenticates every chunk of an encrypted file, and
+// compares its length with size
+func verifyFile(ctx context.Context, store blobstore.BlobStore, key string, size int64) error {
+	obj, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	content, _, err := Open(obj, obj.Info().Size)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(io.Discard, content)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("content is %d bytes, documentation records %d", n, size)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// Same messages as the REST role and ownership middleware
+var (
+	errForbiddenRole  = errors.New("Forbidden: insufficient role")
+	errForbiddenOwner = errors.New("Forbidden: not owner")
+)
+
+func isAdmin(ctx context.Context) bool {
+	role, _ := ctx.Value(utils.RoleKey).(string)
+	return role == "admin" || role == "superadmin"
+}
+
+// requireAdmin mirrors routes only open to the admin role
+func requireAdmin(ctx context.Context) error {
+	if !isAdmin(ctx) {
+		return errForbiddenRole
+	}
+	return nil
+}
+
+// requireStudent mirrors OwnershipMiddleware: admins see every student, students only themselves
+func requireStudent(ctx context.Context, studentID int) error {
+	if isAdmin(ctx) {
+		return nil
+	}
+	role, _ := ctx.Value(utils.RoleKey).(string)
+	userID, _ := ctx.Value(utils.UserIDKey).(int)
+	if role == "student" && userID == studentID {
+		return nil
+	}
+	return errForbiddenOwner
+}
@@ -0,0 +1,86 @@
+package graph
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/graphql"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+func asStudent(ctx context.Context, id int) context.Context {
+	ctx = context.WithValue(ctx, utils.RoleKey, "student")
+	return context.WithValue(ctx, utils.UserIDKey, id)
+}
+
+func TestAuthorization(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		query  string
+		data   string
+		errors []string
+	}{
+		{
+			name:  "student reads itself",
+			ctx:   asStudent(context.Background(), 2),
+			query: `{ student(id: 2) { studentId firstName } }`,
+			data:  `{"student":{"studentId":2,"firstName":"first-2"}}`,
+		},
+		{
+			name:   "student cannot read another student",
+			ctx:    asStudent(context.Background(), 2),
+			query:  `{ student(id: 3) { studentId firstName } }`,
+			data:   `{"student":null}`,
+			errors: []string{"Forbidden: not owner"},
+		},
+		{
+			name:   "student cannot list students",
+			ctx:    asStudent(context.Background(), 2),
+			query:  `{ students { studentId } }`,
+			errors: []string{"Forbidden: insufficient role"},
+		},
+		{
+			name:   "student cannot see who pinned it",
+			ctx:    asStudent(context.Background(), 2),
+			query:  `{ student(id: 2) { studentId pinnedBy { adminId } } }`,
+			errors: []string{"Forbidden: insufficient role"},
+		},
+		{
+			name:   "admin-only queries are refused without a role",
+			ctx:    context.Background(),
+			query:  `{ persons { personId } }`,
+			errors: []string{"Forbidden: insufficient role"},
+		},
+		{
+			name:  "admin reads any student",
+			ctx:   asAdmin(context.Background()),
+			query: `{ student(id: 3) { studentId } }`,
+			data:  `{"student":{"studentId":3}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := campus(3)
+			ctx := WithLoaders(tt.ctx, fake.Open(t))
+			res := Schema.Execute(ctx, graphql.Request{Query: tt.query})
+
+			var got []string
+			for _, e := range res.Errors {
+				got = append(got, e.Message)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.errors, "\n") {
+				t.Fatalf("errors = %q, want %q", got, tt.errors)
+			}
+			if tt.data != "" {
+				if data := toJSON(t, res.Data); data != tt.data {
+					t.Fatalf("data = %s, want %s", data, tt.data)
+				}
+			}
+			if strings.Contains(toJSON(t, res.Data), "first-3") && tt.ctx.Value(utils.RoleKey) != "admin" {
+				t.Fatalf("another student's data leaked: %s", toJSON(t, res.Data))
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/disabilitylink"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/graphql"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
+	"sort"
+)
+
+// Selected columns, in the order the scan functions below read them
+const (
+	personColumns = `p.person_id, p.first_name, p.preferred_name, p.middle_name, p.last_name,
+		p.email, p.phone_number, p.pronouns, p.sex, p.gender,
+		p.birthday, p.address, p.city, p.state, p.zip_code, p.country`
+	studentColumns        = personColumns + `, s.year, s.start_year, s.planned_grad_year, s.housing, s.dining`
+	adminColumns          = personColumns + `, a.title`
+	pointOfContactColumns = `poc.point_of_contact_id, act.activity_datetime, poc.event_datetime, poc.duration, poc.event_type, poc.student_id`
+	documentationColumns  = `d.documentation_id, act.activity_datetime, d.file_name, d.storage_key, d.mime_type, d.size_bytes, d.uploaded_by`
+	specificDocColumns    = documentationColumns + `, sd.doc_type, sd.student_id`
+	personalDocColumns    = documentationColumns + `, pd.admin_id`
+)
+
+// Joins of each resource, trashed people and documents are left out like in the REST handlers
+const (
+	studentFrom        = ` FROM student s JOIN person p ON s.student_id = p.person_id`
+	adminFrom          = ` FROM admin a JOIN person p ON a.admin_id = p.person_id`
+	pointOfContactFrom = ` FROM point_of_contact poc JOIN activity act ON poc.point_of_contact_id = act.activity_id`
+	documentationFrom  = ` FROM documentation d JOIN activity act ON d.documentation_id = act.activity_id`
+	specificDocFrom    = documentationFrom + ` JOIN specific_documentation sd ON sd.specific_documentation_id = d.documentation_id`
+	personalDocFrom    = documentationFrom + ` JOIN personal_documentation pd ON pd.personal_documentation_id = d.documentation_id`
+)
+
+// scanFunc reads one row into a model. extra destinations are scanned first, for the batch key.
+type scanFunc[V any] func(rows *sql.Rows, extra ...any) (V, error)
+
+func scanPerson(rows *sql.Rows, extra ...any) (models.Person, error) {
+	var p models.Person
+	return p, rows.Scan(append(extra,
+		&p.PersonID, &p.FirstName, &p.PreferredName, &p.MiddleName, &p.LastName,
+		fieldcrypt.Scan(fieldcrypt.PersonEmail, &p.Email),
+		fieldcrypt.Scan(fieldcrypt.PersonPhoneNumber, &p.PhoneNumber),
+		&p.Pronouns, &p.Sex, &p.Gender,
+		fieldcrypt.Scan(fieldcrypt.PersonBirthday, &p.Birthday),
+		fieldcrypt.Scan(fieldcrypt.PersonAddress, &p.Address),
+		&p.City, &p.State, &p.ZipCode, &p.Country,
+	)...)
+}
+
+func scanStudent(rows *sql.Rows, extra ...any) (models.Student, error) {
+	var s models.Student
+	return s, rows.Scan(append(extra,
+		&s.StudentID, &s.FirstName, &s.PreferredName, &s.MiddleName, &s.LastName,
+		fieldcrypt.Scan(fieldcrypt.PersonEmail, &s.Email),
+		fieldcrypt.Scan(fieldcrypt.PersonPhoneNumber, &s.PhoneNumber),
+		&s.Pronouns, &s.Sex, &s.Gender,
+		fieldcrypt.Scan(fieldcrypt.PersonBirthday, &s.Birthday),
+		fieldcrypt.Scan(fieldcrypt.PersonAddress, &s.Address),
+		&s.City, &s.State, &s.ZipCode, &s.Country,
+		&s.Year, &s.StartYear, &s.PlannedGradYear, &s.Housing, &s.Dining,
+	)...)
+}
+
+func scanAdmin(rows *sql.Rows, extra ...any) (models.Admin, error) {
+	var a models.Admin
+	return a, rows.Scan(append(extra,
+		&a.AdminID, &a.FirstName, &a.PreferredName, &a.MiddleName, &a.LastName,
+		fieldcrypt.Scan(fieldcrypt.PersonEmail, &a.Email),
+		fieldcrypt.Scan(fieldcrypt.PersonPhoneNumber, &a.PhoneNumber),
+		&a.Pronouns, &a.Sex, &a.Gender,
+		fieldcrypt.Scan(fieldcrypt.PersonBirthday, &a.Birthday),
+		fieldcrypt.Scan(fieldcrypt.PersonAddress, &a.Address),
+		&a.City, &a.State, &a.ZipCode, &a.Country, &a.Title,
+	)...)
+}
+
+func scanPointOfContact(rows *sql.Rows, extra ...any) (models.PointOfContact, error) {
+	var poc models.PointOfContact
+	return poc, rows.Scan(append(extra,
+		&poc.PointOfContactID, &poc.ActivityDateTime, &poc.EventDateTime, &poc.Duration, &poc.EventType, &poc.StudentID,
+	)...)
+}
+
+func scanDocumentation(rows *sql.Rows, extra ...any) (models.Documentation, error) {
+	var d models.Documentation
+	return d, rows.Scan(append(extra,
+		&d.DocumentationID, &d.ActivityDateTime, &d.FileName, &d.StorageKey, &d.MimeType, &d.SizeBytes, &d.UploadedBy,
+	)...)
+}
+
+func scanSpecificDoc(rows *sql.Rows, extra ...any) (models.SpecificDocumentation, error) {
+	var d models.SpecificDocumentation
+	return d, rows.Scan(append(extra,
+		&d.SpecificDocumentationID, &d.ActivityDateTime, &d.FileName, &d.StorageKey, &d.MimeType, &d.SizeBytes, &d.UploadedBy,
+		&d.DocType, &d.StudentID,
+	)...)
+}
+
+func scanPersonalDoc(rows *sql.Rows, extra ...any) (models.PersonalDocumentation, error) {
+	var d models.PersonalDocumentation
+	return d, rows.Scan(append(extra,
+		&d.PersonalDocumentationID, &d.ActivityDateTime, &d.FileName, &d.StorageKey, &d.MimeType, &d.SizeBytes, &d.UploadedBy,
+		&d.AdminID,
+	)...)
+}
+
+func scanDisability(rows *sql.Rows, extra ...any) (models.Disability, error) {
+	var d models.Disability
+	return d, rows.Scan(append(extra, &d.DisabilityID, &d.Name, &d.Description)...)
+}
+
+func scanAccommodation(rows *sql.Rows, extra ...any) (models.Accommodation, error) {
+	var a models.Accommodation
+	return a, rows.Scan(append(extra, &a.AccommodationID, &a.Name, &a.Description)...)
+}
+
+// errLoad is what clients see when a query fails, the cause is only logged
+var errLoad = errors.New("Failed to load data")
+
+// list runs a query and scans every row
+func list[V any](ctx context.Context, db *sql.DB, query string, args []any, scan scanFunc[V]) ([]V, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Println("DB query error:", err)
+		return nil, errLoad
+	}
+	defer rows.Close()
+
+	out := make([]V, 0)
+	for rows.Next() {
+		v, err := scan(rows)
+		if err != nil {
+			log.Println("Row scan error:", err)
+			return nil, errLoad
+		}
+		out = append(out, v)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Rows error:", err)
+		return nil, errLoad
+	}
+	return out, nil
+}
+
+// batch runs a query whose first column is the key and whose %s is replaced by the key placeholders,
+// grouping the rows by key
+func batch[V any](ctx context.Context, db *sql.DB, query string, keys []int, scan scanFunc[V]) (map[int][]V, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(keys)), ",")
+	args := make([]any, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(query, placeholders), args...)
+	if err != nil {
+		log.Println("DB query error:", err)
+		return nil, errLoad
+	}
+	defer rows.Close()
+
+	out := make(map[int][]V, len(keys))
+	for _, key := range keys {
+		out[key] = make([]V, 0)
+	}
+	for rows.Next() {
+		var key int
+		v, err := scan(rows, &key)
+		if err != nil {
+			log.Println("Row scan error:", err)
+			return nil, errLoad
+		}
+		out[key] = append(out[key], v)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Rows error:", err)
+		return nil, errLoad
+	}
+	return out, nil
+}
+
+// manyLoader loads the rows related to each key
+func manyLoader[V any](ctx context.Context, db *sql.DB, query string, scan scanFunc[V]) *graphql.Loader[int, []V] {
+	return graphql.NewLoader(ctx, func(ctx context.Context, keys []int) (map[int][]V, error) {
+		return batch(ctx, db, query, keys, scan)
+	})
+}
+
+// linkLoader loads the records linked to each key through stu_dis. Sealed links cannot be joined
+// in SQL, so the links are read and decrypted first and the records loaded by ID with query,
+// whose first column is the record ID. Records are ordered by ID like the joined loaders.
+func linkLoader[V any](ctx context.Context, db *sql.DB, links func(ctx context.Context, keys []int) ([]disabilitylink.Link, error), key, target func(disabilitylink.Link) int, query string, scan scanFunc[V]) *graphql.Loader[int, []V] {
+	return graphql.NewLoader(ctx, func(ctx context.Context, keys []int) (map[int][]V, error) {
+		found, err := links(ctx, keys)
+		if err != nil {
+			log.Println("DB query error:", err)
+			return nil, errLoad
+		}
+		sort.Slice(found, func(i, j int) bool { return target(found[i]) < target(found[j]) })
+
+		out := make(map[int][]V, len(keys))
+		for _, k := range keys {
+			out[k] = make([]V, 0)
+		}
+		ids := []int{}
+		seen := map[int]bool{}
+		for _, l := range found {
+			if !seen[target(l)] {
+				seen[target(l)] = true
+				ids = append(ids, target(l))
+			}
+		}
+		if len(ids) == 0 {
+			return out, nil
+		}
+
+		records, err := batch(ctx, db, query, ids, scan)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range found {
+			if r := records[target(l)]; len(r) > 0 {
+				out[key(l)] = append(out[key(l)], r[0])
+			}
+		}
+		return out, nil
+	})
+}
+
+// oneLoader loads records by ID, missing IDs resolve to null
+func oneLoader[V any](ctx context.Context, db *sql.DB, query string, scan scanFunc[V]) *graphql.Loader[int, *V] {
+	return graphql.NewLoader(ctx, func(ctx context.Context, keys []int) (map[int]*V, error) {
+		rows, err := batch(ctx, db, query, keys, scan)
+		if err != nil {
+			return nil, err
+		}
+		out := make(map[int]*V, len(rows))
+		for key, found := range rows {
+			if len(found) > 0 {
+				out[key] = &found[0]
+			}
+		}
+		return out, nil
+	})
+}
+
+func linkStudent(l disabilitylink.Link) int    { return l.StudentID }
+func linkDisability(l disabilitylink.Link) int { return l.DisabilityID }
+
+// loaders holds the batching loaders of one request
+type loaders struct {
+	db *sql.DB
+
+	person         *graphql.Loader[int, *models.Person]
+	student        *graphql.Loader[int, *models.Student]
+	admin          *graphql.Loader[int, *models.Admin]
+	pointOfContact *graphql.Loader[int, *models.PointOfContact]
+	documentation  *graphql.Loader[int, *models.Documentation]
+	specificDoc    *graphql.Loader[int, *models.SpecificDocumentation]
+	personalDoc    *graphql.Loader[int, *models.PersonalDocumentation]
+	disability     *graphql.Loader[int, *models.Disability]
+	accommodation  *graphql.Loader[int, *models.Accommodation]
+
+	disabilitiesByStudent    *graphql.Loader[int, []models.Disability]
+	accommodationsByStudent  *graphql.Loader[int, []models.Accommodation]
+	pointsOfContactByStudent *graphql.Loader[int, []models.PointOfContact]
+	pointsOfContactByAdmin   *graphql.Loader[int, []models.PointOfContact]
+	adminsByPointOfContact   *graphql.Loader[int, []models.Admin]
+	documentsByStudent       *graphql.Loader[int, []models.SpecificDocumentation]
+	documentsByAdmin         *graphql.Loader[int, []models.PersonalDocumentation]
+	pinnedByAdmin            *graphql.Loader[int, []models.Student]
+	pinnedByStudent          *graphql.Loader[int, []models.Admin]
+	studentsByDisability     *graphql.Loader[int, []models.Student]
+	studentsByAccommodation  *graphql.Loader[int, []models.Student]
+}
+
+func newLoaders(ctx context.Context, db *sql.DB) *loaders {
+	return &loaders{
+		db: db,
+
+		person: oneLoader(ctx, db, `SELECT p.person_id, `+personColumns+` FROM person p
+			WHERE p.deleted_at IS NULL AND p.person_id IN (%s)`, scanPerson),
+		student: oneLoader(ctx, db, `SELECT s.student_id, `+studentColumns+studentFrom+`
+			WHERE p.deleted_at IS NULL AND s.student_id IN (%s)`, scanStudent),
+		admin: oneLoader(ctx, db, `SELECT a.admin_id, `+adminColumns+adminFrom+`
+			WHERE p.deleted_at IS NULL AND a.admin_id IN (%s)`, scanAdmin),
+		pointOfContact: oneLoader(ctx, db, `SELECT poc.point_of_contact_id, `+pointOfContactColumns+pointOfContactFrom+`
+			WHERE poc.point_of_contact_id IN (%s)`, scanPointOfContact),
+		documentation: oneLoader(ctx, db, `SELECT d.documentation_id, `+documentationColumns+documentationFrom+`
+			WHERE d.deleted_at IS NULL AND d.documentation_id IN (%s)`, scanDocumentation),
+		specificDoc: oneLoader(ctx, db, `SELECT d.documentation_id, `+specificDocColumns+specificDocFrom+`
+			WHERE d.deleted_at IS NULL AND d.documentation_id IN (%s)`, scanSpecificDoc),
+		personalDoc: oneLoader(ctx, db, `SELECT d.documentation_id, `+personalDocColumns+personalDocFrom+`
+			WHERE d.deleted_at IS NULL AND d.documentation_id IN (%s)`, scanPersonalDoc),
+		disability: oneLoader(ctx, db, `SELECT disability_id, disability_id, name, description FROM disability
+			WHERE disability_id IN (%s)`, scanDisability),
+		accommodation: oneLoader(ctx, db, `SELECT accommodation_id, accommodation_id, name, description FROM accommodation
+			WHERE accommodation_id IN (%s)`, scanAccommodation),
+
+		disabilitiesByStudent: linkLoader(ctx, db, func(ctx context.Context, keys []int) ([]disabilitylink.Link, error) {
+			return disabilitylink.ForStudents(ctx, db, keys...)
+		}, linkStudent, linkDisability, `SELECT disability_id, disability_id, name, description FROM disability
+			WHERE disability_id IN (%s)`, scanDisability),
+		accommodationsByStudent: manyLoader(ctx, db, `SELECT sa.student_id, a.accommodation_id, a.name, a.description
+			FROM stu_accom sa JOIN accommodation a ON a.accommodation_id = sa.accommodation_id
+			WHERE sa.student_id IN (%s) ORDER BY a.accommodation_id`, scanAccommodation),
+		pointsOfContactByStudent: manyLoader(ctx, db, `SELECT poc.student_id, `+pointOfContactColumns+pointOfContactFrom+`
+			WHERE poc.student_id IN (%s) ORDER BY poc.event_datetime DESC`, scanPointOfContact),
+		pointsOfContactByAdmin: manyLoader(ctx, db, `SELECT pa.admin_id, `+pointOfContactColumns+pointOfContactFrom+`
+			JOIN poc_admin pa ON pa.point_of_contact_id = poc.point_of_contact_id
+			WHERE pa.admin_id IN (%s) ORDER BY poc.event_datetime DESC`, scanPointOfContact),
+		adminsByPointOfContact: manyLoader(ctx, db, `SELECT pa.point_of_contact_id, `+adminColumns+adminFrom+`
+			JOIN poc_admin pa ON pa.admin_id = a.admin_id
+			WHERE p.deleted_at IS NULL AND pa.point_of_contact_id IN (%s) ORDER BY a.admin_id`, scanAdmin),
+		documentsByStudent: manyLoader(ctx, db, `SELECT sd.student_id, `+specificDocColumns+specificDocFrom+`
+			WHERE d.deleted_at IS NULL AND sd.student_id IN (%s) ORDER BY act.activity_datetime DESC`, scanSpecificDoc),
+		documentsByAdmin: manyLoader(ctx, db, `SELECT pd.admin_id, `+personalDocColumns+personalDocFrom+`
+			WHERE d.deleted_at IS NULL AND pd.admin_id IN (%s) ORDER BY act.activity_datetime DESC`, scanPersonalDoc),
+		pinnedByAdmin: manyLoader(ctx, db, `SELECT pin.admin_id, `+studentColumns+studentFrom+`
+			JOIN pinned pin ON pin.student_id = s.student_id
+			WHERE p.deleted_at IS NULL AND pin.admin_id IN (%s) ORDER BY s.student_id`, scanStudent),
+		pinnedByStudent: manyLoader(ctx, db, `SELECT pin.student_id, `+adminColumns+adminFrom+`
+			JOIN pinned pin ON pin.admin_id = a.admin_id
+			WHERE p.deleted_at IS NULL AND pin.student_id IN (%s) ORDER BY a.admin_id`, scanAdmin),
+		studentsByDisability: linkLoader(ctx, db, func(ctx context.Context, keys []int) ([]disabilitylink.Link, error) {
+			return disabilitylink.ForDisabilities(ctx, db, keys...)
+		}, linkDisability, linkStudent, `SELECT s.student_id, `+studentColumns+studentFrom+`
+			WHERE p.deleted_at IS NULL AND s.student_id IN (%s)`, scanStudent),
+		studentsByAccommodation: manyLoader(ctx, db, `SELECT sa.accommodation_id, `+studentColumns+studentFrom+`
+			JOIN stu_accom sa ON sa.student_id = s.student_id
+			WHERE p.deleted_at IS NULL AND sa.accommodation_id IN (%s) ORDER BY s.student_id`, scanStudent),
+	}
+}
@@ -0,0 +1,154 @@
+package graph
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/graphql"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// studentValues is a row of studentColumns
+func studentValues(id int64) []driver.Value {
+	values := []driver.Value{id}
+	for _, field := range []string{"first", "preferred", "middle", "last", "email", "phone", "pronouns",
+		"sex", "gender", "2000-01-02", "address", "city", "state", "zip", "country", "senior"} {
+		values = append(values, fmt.Sprintf("%s-%d", field, id))
+	}
+	return append(values, int64(2020), int64(2024), "on campus", "meal plan")
+}
+
+// campus is a database answering the queries of the student graph for students 1..n, each with
+// disabilities 1 and 2 and accommodation 10
+func campus(n int) *testdb.DB {
+	return &testdb.DB{Query: func(query string, args []driver.Value) (*testdb.Rows, error) {
+		var rows [][]driver.Value
+		switch {
+		case strings.Contains(query, "FROM stu_dis"):
+			for _, student := range args {
+				rows = append(rows,
+					[]driver.Value{student, int64(1), nil, nil},
+					[]driver.Value{student, int64(2), nil, nil})
+			}
+			return &testdb.Rows{Values: rows}, nil
+
+		case strings.Contains(query, "FROM disability"):
+			for _, id := range args {
+				rows = append(rows, []driver.Value{id, id, fmt.Sprintf("disability-%d", id), "description"})
+			}
+			return &testdb.Rows{Values: rows}, nil
+
+		case strings.Contains(query, "FROM stu_accom"):
+			for _, student := range args {
+				rows = append(rows, []driver.Value{student, int64(10), "accommodation-10", "description"})
+			}
+			return &testdb.Rows{Values: rows}, nil
+
+		case strings.Contains(query, studentFrom) && strings.Contains(query, "IN ("):
+			for _, id := range args {
+				rows = append(rows, append([]driver.Value{id}, studentValues(id.(int64))...))
+			}
+			return &testdb.Rows{Values: rows}, nil
+
+		case strings.Contains(query, studentFrom):
+			for id := 1; id <= n; id++ {
+				rows = append(rows, studentValues(int64(id)))
+			}
+			return &testdb.Rows{Values: rows}, nil
+		}
+		return nil, nil
+	}}
+}
+
+func toJSON(t testing.TB, data any) string {
+	t.Helper()
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(encoded)
+}
+
+func asAdmin(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, utils.RoleKey, "admin")
+	return context.WithValue(ctx, utils.UserIDKey, 1)
+}
+
+const studentsWithRelationships = `{
+	students {
+		studentId
+		disabilities { disabilityId name }
+		accommodations { name }
+	}
+}`
+
+func TestLoadersBatchRelationships(t *testing.T) {
+	for _, n := range []int{1, 10, 200} {
+		t.Run(fmt.Sprint(n, " students"), func(t *testing.T) {
+			fake := campus(n)
+			db := fake.Open(t)
+
+			ctx := WithLoaders(asAdmin(context.Background()), db)
+			res := Schema.Execute(ctx, graphql.Request{Query: studentsWithRelationships})
+			if len(res.Errors) > 0 {
+				t.Fatalf("errors: %v", res.Errors[0])
+			}
+
+			// students, stu_dis links, disabilities and accommodations, whatever the number of students
+			if got := len(fake.Statements()); got != 4 {
+				t.Fatalf("%d students ran %d queries, want 4:\n%s", n, got, fake.Log())
+			}
+
+			data := toJSON(t, res.Data)
+			want := `{"studentId":1,"disabilities":[{"disabilityId":1,"name":"disability-1"},{"disabilityId":2,"name":"disability-2"}],"accommodations":[{"name":"accommodation-10"}]}`
+			if !strings.Contains(data, want) {
+				t.Fatalf("student 1 is missing its relationships: %s", data)
+			}
+		})
+	}
+}
+
+func TestLoaderCachesKeysWithinRequest(t *testing.T) {
+	fake := campus(3)
+	db := fake.Open(t)
+
+	// The same student reached twice through aliases is loaded once
+	ctx := WithLoaders(asAdmin(context.Background()), db)
+	res := Schema.Execute(ctx, graphql.Request{Query: `{
+		a: student(id: 2) { studentId }
+		b: student(id: 2) { studentId }
+		c: student(id: 3) { studentId }
+	}`})
+	if len(res.Errors) > 0 {
+		t.Fatalf("errors: %v", res.Errors[0])
+	}
+	if got := len(fake.Statements()); got != 1 {
+		t.Fatalf("ran %d queries, want 1:\n%s", got, fake.Log())
+	}
+	if data := toJSON(t, res.Data); data != `{"a":{"studentId":2},"b":{"studentId":2},"c":{"studentId":3}}` {
+		t.Fatalf("data = %s", data)
+	}
+}
+
+func BenchmarkStudentRelationships(b *testing.B) {
+	fake := campus(500)
+	db := fake.Open(b)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		fake.Reset()
+		ctx := WithLoaders(asAdmin(context.Background()), db)
+		if res := Schema.Execute(ctx, graphql.Request{Query: studentsWithRelationships}); len(res.Errors) > 0 {
+			b.Fatalf("errors: %v", res.Errors[0])
+		}
+		if got := len(fake.Statements()); got != 4 {
+			b.Fatalf("ran %d queries, want 4", got)
+		}
+	}
+	b.ReportMetric(float64(len(fake.Statements())), "queries/op")
+}
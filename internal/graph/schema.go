@@ -0,0 +1,330 @@
+// Package graph exposes people, students, admins, points of contact, documents, disabilities and
+// accommodations as a GraphQL graph. Relationships are loaded in batches per request and every
+// type applies the role and ownership rules of the matching REST routes.
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/graphql"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
+)
+
+// MaxDepth bounds how deeply a query may follow relationships
+const MaxDepth = 6
+
+type loadersKey struct{}
+
+// WithLoaders attaches fresh batching loaders to the context of one request
+func WithLoaders(ctx context.Context, db *sql.DB) context.Context {
+	return context.WithValue(ctx, loadersKey{}, newLoaders(ctx, db))
+}
+
+func from(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// Schema is the GraphQL schema, resolvers read the database through the context's loaders
+var Schema = mustSchema()
+
+func mustSchema() *graphql.Schema {
+	s, err := graphql.NewSchema(query(),
+		personType(), studentType(), adminType(), pointOfContactType(), documentationType(),
+		specificDocumentationType(), personalDocumentationType(), disabilityType(), accommodationType())
+	if err != nil {
+		panic(err)
+	}
+	s.MaxDepth = MaxDepth
+	return s
+}
+
+func idArg() []graphql.Arg {
+	return []graphql.Arg{{Name: "id", Type: "Int!"}}
+}
+
+func scalar(name, typ string) *graphql.Field {
+	return &graphql.Field{Name: name, Type: typ}
+}
+
+// personFields are shared by Person, Student and Admin
+func personFields(idField string) []*graphql.Field {
+	fields := []*graphql.Field{scalar(idField, "Int!")}
+	for _, name := range []string{"firstName", "preferredName", "middleName", "lastName", "email", "phoneNumber",
+		"pronouns", "sex", "gender", "birthday", "address", "city", "state", "zipCode", "country"} {
+		fields = append(fields, scalar(name, "String"))
+	}
+	return fields
+}
+
+func documentFields(idField string) []*graphql.Field {
+	return []*graphql.Field{
+		scalar(idField, "Int!"),
+		scalar("activityDatetime", "DateTime"),
+		scalar("fileName", "String"),
+		scalar("storageKey", "String"),
+		scalar("mimeType", "String"),
+		scalar("sizeBytes", "Int"),
+		scalar("uploadedBy", "Int"),
+	}
+}
+
+// adminOnly wraps a resolver so only admins reach it
+func adminOnly(resolve graphql.ResolveFunc) graphql.ResolveFunc {
+	return func(p graphql.Params) (any, error) {
+		if err := requireAdmin(p.Context); err != nil {
+			return nil, err
+		}
+		return resolve(p)
+	}
+}
+
+// optionalInt reads a nullable Int argument
+func optionalInt(args map[string]any, name string) (int, bool) {
+	v, ok := args[name].(int)
+	return v, ok
+}
+
+func query() *graphql.Object {
+	return &graphql.Object{Name: "Query", Fields: []*graphql.Field{
+		{Name: "person", Type: "Person", Args: idArg(), Resolve: adminOnly(func(p graphql.Params) (any, error) {
+			return from(p.Context).person.Load(p.Args["id"].(int)), nil
+		})},
+		{Name: "persons", Type: "[Person!]!", Resolve: adminOnly(func(p graphql.Params) (any, error) {
+			return list(p.Context, from(p.Context).db, `SELECT `+personColumns+` FROM person p
+				WHERE p.deleted_at IS NULL ORDER BY p.person_id`, nil, scanPerson)
+		})},
+
+		{Name: "student", Type: "Student", Args: idArg(), Resolve: func(p graphql.Params) (any, error) {
+			id := p.Args["id"].(int)
+			if err := requireStudent(p.Context, id); err != nil {
+				return nil, err
+			}
+			return from(p.Context).student.Load(id), nil
+		}},
+		{Name: "students", Type: "[Student!]!", Description: "Every word of name must match a first, last, preferred or middle name",
+			Args: []graphql.Arg{{Name: "name", Type: "String"}},
+			Resolve: adminOnly(func(p graphql.Params) (any, error) {
+				q := `SELECT ` + studentColumns + studentFrom + ` WHERE p.deleted_at IS NULL`
+				var args []any
+				name, _ := p.Args["name"].(string)
+				for _, word := range strings.Fields(name) {
+					word = "%" + strings.ToLower(word) + "%"
+					q += ` AND (LOWER(p.first_name) LIKE ? OR LOWER(p.last_name) LIKE ? OR LOWER(p.preferred_name) LIKE ? OR LOWER(p.middle_name) LIKE ?)`
+					args = append(args, word, word, word, word)
+				}
+				return list(p.Context, from(p.Context).db, q+` ORDER BY s.student_id`, args, scanStudent)
+			})},
+
+		{Name: "admin", Type: "Admin", Args: idArg(), Resolve: adminOnly(func(p graphql.Params) (any, error) {
+			return from(p.Context).admin.Load(p.Args["id"].(int)), nil
+		})},
+		{Name: "admins", Type: "[Admin!]!", Resolve: adminOnly(func(p graphql.Params) (any, error) {
+			return list(p.Context, from(p.Context).db, `SELECT `+adminColumns+adminFrom+`
+				WHERE p.deleted_at IS NULL ORDER BY a.admin_id`, nil, scanAdmin)
+		})},
+
+		{Name: "pointOfContact", Type: "PointOfContact", Args: idArg(), Resolve: func(p graphql.Params) (any, error) {
+			return from(p.Context).pointOfContact.Load(p.Args["id"].(int)), nil
+		}},
+		{Name: "pointsOfContact", Type: "[PointOfContact!]!",
+			Args: []graphql.Arg{{Name: "studentId", Type: "Int"}, {Name: "adminId", Type: "Int"}},
+			Resolve: adminOnly(func(p graphql.Params) (any, error) {
+				q := `SELECT ` + pointOfContactColumns + pointOfContactFrom + ` WHERE 1=1`
+				var args []any
+				if studentID, ok := optionalInt(p.Args, "studentId"); ok {
+					q += ` AND poc.student_id = ?`
+					args = append(args, studentID)
+				}
+				if adminID, ok := optionalInt(p.Args, "adminId"); ok {
+					q += ` AND EXISTS (SELECT 1 FROM poc_admin pa WHERE pa.point_of_contact_id = poc.point_of_contact_id AND pa.admin_id = ?)`
+					args = append(args, adminID)
+				}
+				return list(p.Context, from(p.Context).db, q+` ORDER BY poc.event_datetime DESC`, args, scanPointOfContact)
+			})},
+
+		{Name: "documentation", Type: "Documentation", Args: idArg(), Resolve: adminOnly(func(p graphql.Params) (any, error) {
+			return from(p.Context).documentation.Load(p.Args["id"].(int)), nil
+		})},
+		{Name: "documentations", Type: "[Documentation!]!", Resolve: adminOnly(func(p graphql.Params) (any, error) {
+			return list(p.Context, from(p.Context).db, `SELECT `+documentationColumns+documentationFrom+`
+				WHERE d.deleted_at IS NULL ORDER BY act.activity_datetime DESC`, nil, scanDocumentation)
+		})},
+		{Name: "specificDocumentation", Type: "SpecificDocumentation", Args: idArg(), Resolve: func(p graphql.Params) (any, error) {
+			return from(p.Context).specificDoc.Load(p.Args["id"].(int)), nil
+		}},
+		{Name: "specificDocumentations", Type: "[SpecificDocumentation!]!", Args: []graphql.Arg{{Name: "studentId", Type: "Int"}},
+			Resolve: adminOnly(func(p graphql.Params) (any, error) {
+				q := `SELECT ` + specificDocColumns + specificDocFrom + ` WHERE d.deleted_at IS NULL`
+				var args []any
+				if studentID, ok := optionalInt(p.Args, "studentId"); ok {
+					q += ` AND sd.student_id = ?`
+					args = append(args, studentID)
+				}
+				return list(p.Context, from(p.Context).db, q+` ORDER BY act.activity_datetime DESC`, args, scanSpecificDoc)
+			})},
+		{Name: "personalDocumentation", Type: "PersonalDocumentation", Args: idArg(), Resolve: adminOnly(func(p graphql.Params) (any, error) {
+			return from(p.Context).personalDoc.Load(p.Args["id"].(int)), nil
+		})},
+		{Name: "personalDocumentations", Type: "[PersonalDocumentation!]!", Args: []graphql.Arg{{Name: "adminId", Type: "Int"}},
+			Resolve: adminOnly(func(p graphql.Params) (any, error) {
+				q := `SELECT ` + personalDocColumns + personalDocFrom + ` WHERE d.deleted_at IS NULL`
+				var args []any
+				if adminID, ok := optionalInt(p.Args, "adminId"); ok {
+					q += ` AND pd.admin_id = ?`
+					args = append(args, adminID)
+				}
+				return list(p.Context, from(p.Context).db, q+` ORDER BY act.activity_datetime DESC`, args, scanPersonalDoc)
+			})},
+
+		{Name: "disability", Type: "Disability", Args: idArg(), Resolve: func(p graphql.Params) (any, error) {
+			return from(p.Context).disability.Load(p.Args["id"].(int)), nil
+		}},
+		{Name: "disabilities", Type: "[Disability!]!", Resolve: func(p graphql.Params) (any, error) {
+			return list(p.Context, from(p.Context).db, `SELECT disability_id, name, description FROM disability ORDER BY disability_id`, nil, scanDisability)
+		}},
+		{Name: "accommodation", Type: "Accommodation", Args: idArg(), Resolve: func(p graphql.Params) (any, error) {
+			return from(p.Context).accommodation.Load(p.Args["id"].(int)), nil
+		}},
+		{Name: "accommodations", Type: "[Accommodation!]!", Resolve: func(p graphql.Params) (any, error) {
+			return list(p.Context, from(p.Context).db, `SELECT accommodation_id, name, description FROM accommodation ORDER BY accommodation_id`, nil, scanAccommodation)
+		}},
+	}}
+}
+
+func personType() *graphql.Object {
+	return &graphql.Object{Name: "Person", Description: "A student or admin",
+		Fields:    personFields("personId"),
+		Authorize: func(ctx context.Context, _ any) error { return requireAdmin(ctx) },
+	}
+}
+
+func studentType() *graphql.Object {
+	fields := append(personFields("studentId"),
+		scalar("year", "String"),
+		scalar("startYear", "Int"),
+		scalar("plannedGradYear", "Int"),
+		scalar("housing", "String"),
+		scalar("dining", "String"),
+		&graphql.Field{Name: "disabilities", Type: "[Disability!]!", Resolve: func(p graphql.Params) (any, error) {
+			return from(p.Context).disabilitiesByStudent.Load(p.Source.(models.Student).StudentID), nil
+		}},
+		&graphql.Field{Name: "accommodations", Type: "[Accommodation!]!", Resolve: func(p graphql.Params) (any, error) {
+			return from(p.Context).accommodationsByStudent.Load(p.Source.(models.Student).StudentID), nil
+		}},
+		&graphql.Field{Name: "pointsOfContact", Type: "[PointOfContact!]!", Resolve: func(p graphql.Params) (any, error) {
+			return from(p.Context).pointsOfContactByStudent.Load(p.Source.(models.Student).StudentID), nil
+		}},
+		&graphql.Field{Name: "documents", Type: "[SpecificDocumentation!]!", Resolve: func(p graphql.Params) (any, error) {
+			return from(p.Context).documentsByStudent.Load(p.Source.(models.Student).StudentID), nil
+		}},
+		&graphql.Field{Name: "pinnedBy", Type: "[Admin!]!", Description: "Admins who pinned the student, admins only",
+			Resolve: adminOnly(func(p graphql.Params) (any, error) {
+				return from(p.Context).pinnedByStudent.Load(p.Source.(models.Student).StudentID), nil
+			})},
+	)
+	return &graphql.Object{Name: "Student", Fields: fields,
+		Authorize: func(ctx context.Context, source any) error {
+			return requireStudent(ctx, source.(models.Student).StudentID)
+		},
+	}
+}
+
+func adminType() *graphql.Object {
+	fields := append(personFields("adminId"),
+		scalar("title", "String"),
+		&graphql.Field{Name: "pinnedStudents", Type: "[Student!]!", Resolve: func(p graphql.Params) (any, error) {
+			return from(p.Context).pinnedByAdmin.Load(p.Source.(models.Admin).AdminID), nil
+		}},
+		&graphql.Field{Name: "pointsOfContact", Type: "[PointOfContact!]!", Resolve: func(p graphql.Params) (any, error) {
+			return from(p.Context).pointsOfContactByAdmin.Load(p.Source.(models.Admin).AdminID), nil
+		}},
+		&graphql.Field{Name: "documents", Type: "[PersonalDocumentation!]!", Resolve: func(p graphql.Params) (any, error) {
+			return from(p.Context).documentsByAdmin.Load(p.Source.(models.Admin).AdminID), nil
+		}},
+	)
+	return &graphql.Object{Name: "Admin", Fields: fields,
+		Authorize: func(ctx context.Context, _ any) error { return requireAdmin(ctx) },
+	}
+}
+
+func pointOfContactType() *graphql.Object {
+	return &graphql.Object{Name: "PointOfContact", Fields: []*graphql.Field{
+		scalar("pointOfContactId", "Int!"),
+		scalar("activityDatetime", "DateTime"),
+		scalar("eventDatetime", "DateTime"),
+		scalar("duration", "Int"),
+		scalar("eventType", "String"),
+		scalar("studentId", "Int"),
+		{Name: "student", Type: "Student", Resolve: func(p graphql.Params) (any, error) {
+			return from(p.Context).student.Load(p.Source.(models.PointOfContact).StudentID), nil
+		}},
+		{Name: "admins", Type: "[Admin!]!", Description: "Admins at the point of contact, admins only",
+			Resolve: adminOnly(func(p graphql.Params) (any, error) {
+				return from(p.Context).adminsByPointOfContact.Load(p.Source.(models.PointOfContact).PointOfContactID), nil
+			})},
+	},
+		Authorize: func(ctx context.Context, source any) error {
+			return requireStudent(ctx, source.(models.PointOfContact).StudentID)
+		},
+	}
+}
+
+func documentationType() *graphql.Object {
+	return &graphql.Object{Name: "Documentation", Description: "Any uploaded document",
+		Fields:    documentFields("documentationId"),
+		Authorize: func(ctx context.Context, _ any) error { return requireAdmin(ctx) },
+	}
+}
+
+func specificDocumentationType() *graphql.Object {
+	fields := append(documentFields("specificDocumentationId"),
+		scalar("docType", "String"),
+		scalar("studentId", "Int"),
+		&graphql.Field{Name: "student", Type: "Student", Resolve: func(p graphql.Params) (any, error) {
+			return from(p.Context).student.Load(p.Source.(models.SpecificDocumentation).StudentID), nil
+		}},
+	)
+	return &graphql.Object{Name: "SpecificDocumentation", Description: "A document about a student", Fields: fields,
+		Authorize: func(ctx context.Context, source any) error {
+			return requireStudent(ctx, source.(models.SpecificDocumentation).StudentID)
+		},
+	}
+}
+
+func personalDocumentationType() *graphql.Object {
+	fields := append(documentFields("personalDocumentationId"),
+		scalar("adminId", "Int"),
+		&graphql.Field{Name: "admin", Type: "Admin", Resolve: func(p graphql.Params) (any, error) {
+			return from(p.Context).admin.Load(p.Source.(models.PersonalDocumentation).AdminID), nil
+		}},
+	)
+	return &graphql.Object{Name: "PersonalDocumentation", Description: "A document kept by an admin", Fields: fields,
+		Authorize: func(ctx context.Context, _ any) error { return requireAdmin(ctx) },
+	}
+}
+
+func disabilityType() *graphql.Object {
+	return &graphql.Object{Name: "Disability", Fields: []*graphql.Field{
+		scalar("disabilityId", "Int!"),
+		scalar("name", "String"),
+		scalar("description", "String"),
+		{Name: "students", Type: "[Student!]!", Description: "Students with the disability, admins only",
+			Resolve: adminOnly(func(p graphql.Params) (any, error) {
+				return from(p.Context).studentsByDisability.Load(p.Source.(models.Disability).DisabilityID), nil
+			})},
+	}}
+}
+
+func accommodationType() *graphql.Object {
+	return &graphql.Object{Name: "Accommodation", Fields: []*graphql.Field{
+		scalar("accommodationId", "Int!"),
+		scalar("name", "String"),
+		scalar("description", "String"),
+		{Name: "students", Type: "[Student!]!", Description: "Students given the accommodation, admins only",
+			Resolve: adminOnly(func(p graphql.Params) (any, error) {
+				return from(p.Context).studentsByAccommodation.Load(p.Source.(models.Accommodation).AccommodationID), nil
+			})},
+	}}
+}
@@ -0,0 +1,700 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Request is a GraphQL request as sent over HTTP
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// Response is the result of a request. Data is nil when the request was rejected before execution.
+type Response struct {
+	Data   any      `json:"data,omitempty"`
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+// Error is a GraphQL error with the location in the query or the path in the result it belongs to
+type Error struct {
+	Message   string     `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+	Path      []any      `json:"path,omitempty"`
+}
+
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func errorAt(line, column int, format string, args ...any) *Error {
+	return &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{{line, column}}}
+}
+
+// Execute parses, validates and runs a query. Resolver errors null their field and are reported
+// next to the data; syntax and validation errors reject the whole request.
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		var syntaxErr *SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return &Response{Errors: []*Error{errorAt(syntaxErr.Line, syntaxErr.Column, "%s", syntaxErr.Message)}}
+		}
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+	if op.Type != "query" {
+		return &Response{Errors: []*Error{{Message: "Only queries are supported, " + op.Type + " is not"}}}
+	}
+
+	vars, errs := s.variables(op, req.Variables)
+	errs = append(errs, s.validate(doc, op)...)
+	if len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+
+	e := &executor{ctx: ctx, schema: s, fragments: doc.Fragments, vars: vars}
+	data := e.resolveObject(s.Query, nil, op.SelectionSet, nil)
+
+	// Each round runs the thunks of one level, so a loader sees every sibling's key before it loads
+	for len(e.queue) > 0 {
+		round := e.queue
+		e.queue = nil
+		for _, run := range round {
+			run()
+		}
+	}
+
+	if data == nil {
+		data = json.RawMessage("null")
+	}
+	return &Response{Data: data, Errors: e.errors}
+}
+
+func selectOperation(doc *Document, name string) (*Operation, error) {
+	if name == "" {
+		if len(doc.Operations) > 1 {
+			return nil, errors.New("operationName is required when the document has several operations")
+		}
+		return doc.Operations[0], nil
+	}
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// variables coerces the JSON variables to the types the operation declares
+func (s *Schema) variables(op *Operation, input map[string]any) (map[string]any, []*Error) {
+	vars := map[string]any{}
+	var errs []*Error
+	for _, def := range op.Variables {
+		t, err := parseType(def.Type)
+		if err != nil || !scalars[t.base()] {
+			errs = append(errs, &Error{Message: fmt.Sprintf("variable $%s has unsupported type %s", def.Name, def.Type)})
+			continue
+		}
+
+		value, given := input[def.Name]
+		if !given && def.Default != nil {
+			if vars[def.Name], err = coerceLiteral(def.Default, t, nil); err != nil {
+				errs = append(errs, &Error{Message: fmt.Sprintf("variable $%s default: %v", def.Name, err)})
+			}
+			continue
+		}
+		if vars[def.Name], err = coerceInput(value, t); err != nil {
+			errs = append(errs, &Error{Message: fmt.Sprintf("variable $%s: %v", def.Name, err)})
+		}
+	}
+	return vars, errs
+}
+
+// validate checks the operation against the schema before anything is resolved
+func (s *Schema) validate(doc *Document, op *Operation) []*Error {
+	declared := map[string]bool{}
+	for _, def := range op.Variables {
+		declared[def.Name] = true
+	}
+	v := &validator{schema: s, doc: doc, declared: declared, spreading: map[string]bool{}}
+	v.selections(s.Query, op.SelectionSet, 0)
+	return v.errs
+}
+
+type validator struct {
+	schema    *Schema
+	doc       *Document
+	declared  map[string]bool
+	spreading map[string]bool
+	errs      []*Error
+}
+
+func (v *validator) selections(obj *Object, sels []Selection, depth int) {
+	for _, sel := range sels {
+		v.directives(sel)
+		switch {
+		case sel.Fragment != "":
+			f, ok := v.doc.Fragments[sel.Fragment]
+			if !ok {
+				v.errs = append(v.errs, errorAt(sel.Line, sel.Column, "Unknown fragment %q", sel.Fragment))
+				continue
+			}
+			if v.spreading[f.Name] {
+				v.errs = append(v.errs, errorAt(sel.Line, sel.Column, "Fragment %q spreads itself", f.Name))
+				continue
+			}
+			if f.TypeCondition != obj.Name {
+				v.errs = append(v.errs, errorAt(sel.Line, sel.Column, "Fragment %q on %s cannot be spread on %s", f.Name, f.TypeCondition, obj.Name))
+				continue
+			}
+			v.spreading[f.Name] = true
+			v.selections(obj, f.SelectionSet, depth)
+			delete(v.spreading, f.Name)
+
+		case sel.Inline:
+			if sel.TypeCondition != "" && sel.TypeCondition != obj.Name {
+				v.errs = append(v.errs, errorAt(sel.Line, sel.Column, "Inline fragment on %s cannot be spread on %s", sel.TypeCondition, obj.Name))
+				continue
+			}
+			v.selections(obj, sel.SelectionSet, depth)
+
+		case sel.Name == "__typename":
+			if sel.SelectionSet != nil {
+				v.errs = append(v.errs, errorAt(sel.Line, sel.Column, "Field \"__typename\" has no subfields"))
+			}
+
+		default:
+			f, ok := obj.fields[sel.Name]
+			if !ok {
+				v.errs = append(v.errs, errorAt(sel.Line, sel.Column, "Cannot query field %q on type %q", sel.Name, obj.Name))
+				continue
+			}
+			v.arguments(f, sel)
+
+			child := v.schema.types[f.typ.base()]
+			switch {
+			case child == nil && sel.SelectionSet != nil:
+				v.errs = append(v.errs, errorAt(sel.Line, sel.Column, "Field %q of type %s has no subfields", sel.Name, f.Type))
+			case child != nil && sel.SelectionSet == nil:
+				v.errs = append(v.errs, errorAt(sel.Line, sel.Column, "Field %q of type %s needs a selection of subfields", sel.Name, f.Type))
+			case child != nil && v.schema.MaxDepth > 0 && depth+1 > v.schema.MaxDepth:
+				v.errs = append(v.errs, errorAt(sel.Line, sel.Column, "Query is nested deeper than %d levels", v.schema.MaxDepth))
+			case child != nil:
+				v.selections(child, sel.SelectionSet, depth+1)
+			}
+		}
+	}
+}
+
+func (v *validator) arguments(f *Field, sel Selection) {
+	known := map[string]bool{}
+	for _, arg := range f.Args {
+		known[arg.Name] = true
+		value, given := sel.Arguments[arg.Name]
+		if (!given || value.Kind == KindNull) && arg.typ.nonNull && arg.Default == nil {
+			v.errs = append(v.errs, errorAt(sel.Line, sel.Column, "Field %q argument %q of type %s is required", f.Name, arg.Name, arg.Type))
+			continue
+		}
+		// Literals are checked now, variables once their values are known
+		if given && value.Kind != KindVariable && value.Kind != KindList {
+			if _, err := coerceLiteral(value, arg.typ, nil); err != nil {
+				v.errs = append(v.errs, errorAt(sel.Line, sel.Column, "Field %q argument %q: %v", f.Name, arg.Name, err))
+			}
+		}
+	}
+	for name, value := range sel.Arguments {
+		if !known[name] {
+			v.errs = append(v.errs, errorAt(sel.Line, sel.Column, "Unknown argument %q on field %q", name, f.Name))
+		}
+		v.variablesUsed(value, sel)
+	}
+}
+
+func (v *validator) directives(sel Selection) {
+	for _, d := range sel.Directives {
+		if d.Name != "include" && d.Name != "skip" {
+			v.errs = append(v.errs, errorAt(sel.Line, sel.Column, "Unknown directive @%s", d.Name))
+			continue
+		}
+		if d.Arguments["if"] == nil {
+			v.errs = append(v.errs, errorAt(sel.Line, sel.Column, "Directive @%s needs an \"if\" argument", d.Name))
+			continue
+		}
+		v.variablesUsed(d.Arguments["if"], sel)
+	}
+}
+
+func (v *validator) variablesUsed(value *Value, sel Selection) {
+	switch value.Kind {
+	case KindVariable:
+		if !v.declared[value.Raw] {
+			v.errs = append(v.errs, errorAt(sel.Line, sel.Column, "Variable $%s is not defined", value.Raw))
+		}
+	case KindList:
+		for _, item := range value.List {
+			v.variablesUsed(item, sel)
+		}
+	case KindObject:
+		for _, item := range value.Fields {
+			v.variablesUsed(item, sel)
+		}
+	}
+}
+
+type executor struct {
+	ctx       context.Context
+	schema    *Schema
+	fragments map[string]*Fragment
+	vars      map[string]any
+	errors    []*Error
+	queue     []func()
+}
+
+func (e *executor) fail(err error, path []any) {
+	e.errors = append(e.errors, &Error{Message: err.Error(), Path: path})
+}
+
+// fieldGroup is every selection of one response key, merged like the spec's CollectFields
+type fieldGroup struct {
+	key  string
+	sels []Selection
+}
+
+func (e *executor) collect(obj *Object, sels []Selection, groups []*fieldGroup, index map[string]*fieldGroup) []*fieldGroup {
+	for _, sel := range sels {
+		if !e.included(sel) {
+			continue
+		}
+		switch {
+		case sel.Fragment != "":
+			groups = e.collect(obj, e.fragments[sel.Fragment].SelectionSet, groups, index)
+		case sel.Inline:
+			groups = e.collect(obj, sel.SelectionSet, groups, index)
+		default:
+			key := sel.Alias
+			if key == "" {
+				key = sel.Name
+			}
+			if g, ok := index[key]; ok {
+				g.sels = append(g.sels, sel)
+				continue
+			}
+			g := &fieldGroup{key: key, sels: []Selection{sel}}
+			index[key] = g
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// included applies @skip and @include
+func (e *executor) included(sel Selection) bool {
+	for _, d := range sel.Directives {
+		cond, _ := coerceLiteral(d.Arguments["if"], &typeRef{name: "Boolean", nonNull: true}, e.vars)
+		if b, _ := cond.(bool); b == (d.Name == "skip") {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveObject resolves the selections on one value, returning nil when the type refuses it
+func (e *executor) resolveObject(obj *Object, source any, sels []Selection, path []any) any {
+	if obj.Authorize != nil {
+		if err := obj.Authorize(e.ctx, source); err != nil {
+			e.fail(err, path)
+			return nil
+		}
+	}
+
+	out := &orderedMap{values: map[string]any{}}
+	for _, g := range e.collect(obj, sels, nil, map[string]*fieldGroup{}) {
+		key := g.key
+		out.set(key, nil)
+
+		sel := g.sels[0]
+		if sel.Name == "__typename" {
+			out.set(key, obj.Name)
+			continue
+		}
+
+		f := obj.fields[sel.Name]
+		fieldPath := append(path[:len(path):len(path)], key)
+		var subs []Selection
+		for _, s := range g.sels {
+			subs = append(subs, s.SelectionSet...)
+		}
+
+		args, err := e.arguments(f, sel)
+		if err != nil {
+			e.complete(nil, err, f.typ, nil, fieldPath, nil)
+			continue
+		}
+		value, err := e.call(f, source, args)
+		e.complete(value, err, f.typ, subs, fieldPath, func(v any) { out.values[key] = v })
+	}
+	return out
+}
+
+// call runs a resolver, turning panics into field errors
+func (e *executor) call(f *Field, source any, args map[string]any) (value any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("GraphQL resolver %s panicked: %v\n", f.Name, r)
+			value, err = nil, errors.New("internal error")
+		}
+	}()
+	if f.Resolve == nil {
+		return defaultResolve(source, f.Name)
+	}
+	return f.Resolve(Params{Context: e.ctx, Source: source, Args: args})
+}
+
+// complete turns a resolved value into its response shape, queueing thunks for the next round
+func (e *executor) complete(value any, err error, t *typeRef, subs []Selection, path []any, set func(any)) {
+	if set == nil {
+		set = func(any) {}
+	}
+	if err != nil {
+		e.fail(err, path)
+		set(nil)
+		return
+	}
+	if thunk, ok := value.(Thunk); ok {
+		e.queue = append(e.queue, func() {
+			v, err := thunk()
+			e.complete(v, err, t, subs, path, set)
+		})
+		return
+	}
+
+	rv := reflect.ValueOf(value)
+	for rv.IsValid() && (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface) {
+		if rv.IsNil() {
+			rv = reflect.Value{}
+			break
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		if t.nonNull {
+			e.fail(errors.New("cannot return null for a non-null field"), path)
+		}
+		set(nil)
+		return
+	}
+
+	if t.list != nil {
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			e.fail(fmt.Errorf("expected a list, resolver returned %s", rv.Type()), path)
+			set(nil)
+			return
+		}
+		// A nil slice is an empty list
+		items := make([]any, rv.Len())
+		set(items)
+		for i := range items {
+			e.complete(rv.Index(i).Interface(), nil, t.list, subs, append(path[:len(path):len(path)], i), func(v any) { items[i] = v })
+		}
+		return
+	}
+
+	if scalars[t.name] {
+		v, err := serialize(rv, t.name)
+		if err != nil {
+			e.fail(err, path)
+		}
+		set(v)
+		return
+	}
+	set(e.resolveObject(e.schema.types[t.name], rv.Interface(), subs, path))
+}
+
+func serialize(rv reflect.Value, scalar string) (any, error) {
+	if tm, ok := rv.Interface().(time.Time); ok {
+		return tm.Format(time.RFC3339), nil
+	}
+	switch scalar {
+	case "ID":
+		switch {
+		case rv.CanInt():
+			return strconv.FormatInt(rv.Int(), 10), nil
+		case rv.CanUint():
+			return strconv.FormatUint(rv.Uint(), 10), nil
+		}
+		return fmt.Sprint(rv.Interface()), nil
+	case "Int":
+		if !rv.CanInt() && !rv.CanUint() {
+			return nil, fmt.Errorf("cannot serialize %s as Int", rv.Type())
+		}
+	case "Float":
+		if !rv.CanFloat() && !rv.CanInt() && !rv.CanUint() {
+			return nil, fmt.Errorf("cannot serialize %s as Float", rv.Type())
+		}
+	case "Boolean":
+		if rv.Kind() != reflect.Bool {
+			return nil, fmt.Errorf("cannot serialize %s as Boolean", rv.Type())
+		}
+	case "String", "DateTime":
+		if rv.Kind() != reflect.String {
+			return fmt.Sprint(rv.Interface()), nil
+		}
+	}
+	return rv.Interface(), nil
+}
+
+// defaultResolve reads the struct field tagged with the snake_case of a camelCase field name
+func defaultResolve(source any, name string) (any, error) {
+	rv := reflect.ValueOf(source)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("no value for field %s", name)
+	}
+
+	tag := snakeCase(name)
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		jsonName, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if jsonName == tag {
+			return rv.Field(i).Interface(), nil
+		}
+	}
+	return nil, fmt.Errorf("no value for field %s", name)
+}
+
+// snakeCase converts firstName to first_name and activityDatetime to activity_datetime
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// arguments coerces the arguments of a field, filling in defaults
+func (e *executor) arguments(f *Field, sel Selection) (map[string]any, error) {
+	args := map[string]any{}
+	for _, arg := range f.Args {
+		value, given := sel.Arguments[arg.Name]
+		if given && value.Kind == KindVariable {
+			_, given = e.vars[value.Raw]
+		}
+		if !given {
+			if arg.Default != nil {
+				args[arg.Name] = arg.Default
+			}
+			continue
+		}
+		v, err := coerceLiteral(value, arg.typ, e.vars)
+		if err != nil {
+			return nil, fmt.Errorf("argument %q: %v", arg.Name, err)
+		}
+		if v == nil && arg.typ.nonNull {
+			return nil, fmt.Errorf("argument %q of type %s is required", arg.Name, arg.Type)
+		}
+		args[arg.Name] = v
+	}
+	return args, nil
+}
+
+// coerceLiteral converts a query literal, or the variable it names, to the Go value of a scalar type
+func coerceLiteral(value *Value, t *typeRef, vars map[string]any) (any, error) {
+	switch value.Kind {
+	case KindVariable:
+		return coerceInput(vars[value.Raw], t)
+	case KindNull:
+		if t.nonNull {
+			return nil, fmt.Errorf("expected %s, found null", t)
+		}
+		return nil, nil
+	case KindList:
+		if t.list == nil {
+			return nil, fmt.Errorf("expected %s, found a list", t)
+		}
+		items := make([]any, len(value.List))
+		for i, item := range value.List {
+			var err error
+			if items[i], err = coerceLiteral(item, t.list, vars); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+
+	if t.list != nil {
+		// A single value is accepted where a list is expected
+		item, err := coerceLiteral(value, t.list, vars)
+		if err != nil {
+			return nil, err
+		}
+		return []any{item}, nil
+	}
+
+	switch {
+	case t.name == "Int" && value.Kind == KindInt:
+		n, err := strconv.ParseInt(value.Raw, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a 32-bit integer", value.Raw)
+		}
+		return int(n), nil
+	case t.name == "Float" && (value.Kind == KindInt || value.Kind == KindFloat):
+		return strconv.ParseFloat(value.Raw, 64)
+	case t.name == "ID" && (value.Kind == KindInt || value.Kind == KindString):
+		return value.Raw, nil
+	case (t.name == "String" || t.name == "DateTime") && value.Kind == KindString:
+		return value.Raw, nil
+	case t.name == "Boolean" && value.Kind == KindBoolean:
+		return value.Raw == "true", nil
+	}
+	return nil, fmt.Errorf("expected %s, found %s", t, describeValue(value))
+}
+
+func describeValue(value *Value) string {
+	switch value.Kind {
+	case KindString:
+		return strconv.Quote(value.Raw)
+	case KindObject:
+		return "an object"
+	}
+	return value.Raw
+}
+
+// coerceInput converts a decoded JSON variable to the Go value of a scalar type
+func coerceInput(value any, t *typeRef) (any, error) {
+	if value == nil {
+		if t.nonNull {
+			return nil, fmt.Errorf("expected %s, found null", t)
+		}
+		return nil, nil
+	}
+
+	if t.list != nil {
+		items, ok := value.([]any)
+		if !ok {
+			item, err := coerceInput(value, t.list)
+			if err != nil {
+				return nil, err
+			}
+			return []any{item}, nil
+		}
+		out := make([]any, len(items))
+		for i, item := range items {
+			var err error
+			if out[i], err = coerceInput(item, t.list); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+
+	switch t.name {
+	case "Int":
+		switch n := value.(type) {
+		case int:
+			return n, nil
+		case float64:
+			if n == math.Trunc(n) && n >= math.MinInt32 && n <= math.MaxInt32 {
+				return int(n), nil
+			}
+		case json.Number:
+			if i, err := strconv.ParseInt(n.String(), 10, 32); err == nil {
+				return int(i), nil
+			}
+		}
+	case "Float":
+		switch n := value.(type) {
+		case int:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		case json.Number:
+			return n.Float64()
+		}
+	case "ID":
+		switch id := value.(type) {
+		case string:
+			return id, nil
+		case float64:
+			if id == math.Trunc(id) {
+				return strconv.FormatInt(int64(id), 10), nil
+			}
+		case int:
+			return strconv.Itoa(id), nil
+		case json.Number:
+			return id.String(), nil
+		}
+	case "String", "DateTime":
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case "Boolean":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("expected %s, found %v", t, value)
+}
+
+// orderedMap keeps the response keys in the order they were selected
+type orderedMap struct {
+	keys   []string
+	values map[string]any
+}
+
+func (m *orderedMap) set(key string, value any) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		b.Write(k)
+		b.WriteByte(':')
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
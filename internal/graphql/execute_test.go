@@ -0,0 +1,266 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testPet struct {
+	PetID   int       `json:"pet_id"`
+	Name    string    `json:"name"`
+	OwnerID int       `json:"owner_id"`
+	BornAt  time.Time `json:"born_at"`
+	Secret  string    `json:"secret"`
+}
+
+var testPets = map[int]testPet{
+	1: {PetID: 1, Name: "Rex", OwnerID: 2, BornAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+	2: {PetID: 2, Name: "Tom", OwnerID: 3, Secret: "hidden"},
+	3: {PetID: 3, Name: "Kit", OwnerID: 2},
+}
+
+type ownerKey struct{}
+
+// testSchema has pets that only their owner sees, loaded through a loader that counts its batches
+func testSchema(t *testing.T, batches *int) *Schema {
+	t.Helper()
+	var loader *Loader[int, *testPet]
+	newLoader := func(ctx context.Context) *Loader[int, *testPet] {
+		if loader == nil {
+			loader = NewLoader(ctx, func(ctx context.Context, keys []int) (map[int]*testPet, error) {
+				*batches++
+				out := map[int]*testPet{}
+				for _, key := range keys {
+					if pet, ok := testPets[key]; ok {
+						out[key] = &pet
+					}
+				}
+				return out, nil
+			})
+		}
+		return loader
+	}
+
+	pet := &Object{Name: "Pet",
+		Fields: []*Field{
+			{Name: "petId", Type: "Int!"},
+			{Name: "name", Type: "String"},
+			{Name: "bornAt", Type: "DateTime"},
+			{Name: "secret", Type: "String", Resolve: func(p Params) (any, error) {
+				return nil, errors.New("Forbidden: secret")
+			}},
+			{Name: "friend", Type: "Pet", Resolve: func(p Params) (any, error) {
+				return newLoader(p.Context).Load(p.Source.(testPet).PetID%3 + 1), nil
+			}},
+			{Name: "mustExist", Type: "String!", Resolve: func(p Params) (any, error) { return nil, nil }},
+			{Name: "crash", Type: "String", Resolve: func(p Params) (any, error) { panic("boom") }},
+		},
+		Authorize: func(ctx context.Context, source any) error {
+			if source.(testPet).OwnerID != ctx.Value(ownerKey{}) {
+				return errors.New("Forbidden: not owner")
+			}
+			return nil
+		},
+	}
+	query := &Object{Name: "Query", Fields: []*Field{
+		{Name: "pet", Type: "Pet", Args: []Arg{{Name: "id", Type: "Int!"}}, Resolve: func(p Params) (any, error) {
+			return newLoader(p.Context).Load(p.Args["id"].(int)), nil
+		}},
+		{Name: "pets", Type: "[Pet!]!", Args: []Arg{{Name: "ids", Type: "[Int!]"}}, Resolve: func(p Params) (any, error) {
+			ids, _ := p.Args["ids"].([]any)
+			var pets []testPet
+			for _, id := range ids {
+				pets = append(pets, testPets[id.(int)])
+			}
+			return pets, nil
+		}},
+		{Name: "greet", Type: "String!", Args: []Arg{{Name: "name", Type: "String", Default: "you"}},
+			Resolve: func(p Params) (any, error) { return "hello " + p.Args["name"].(string), nil }},
+	}}
+
+	s, err := NewSchema(query, pet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MaxDepth = 3
+	return s
+}
+
+func run(t *testing.T, s *Schema, owner int, query string, vars map[string]any) (string, []*Error) {
+	t.Helper()
+	ctx := context.WithValue(context.Background(), ownerKey{}, owner)
+	res := s.Execute(ctx, Request{Query: query, Variables: vars})
+	if res.Data == nil {
+		return "", res.Errors
+	}
+	data, err := json.Marshal(res.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), res.Errors
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		vars   map[string]any
+		data   string
+		errors []string
+	}{
+		{
+			name:  "fields, aliases and __typename",
+			query: `{ p: pet(id: 1) { __typename petId name bornAt } greet }`,
+			data:  `{"p":{"__typename":"Pet","petId":1,"name":"Rex","bornAt":"2020-01-02T03:04:05Z"},"greet":"hello you"}`,
+		},
+		{
+			name:  "variables and defaults",
+			query: `query ($id: Int!, $who: String = "there") { pet(id: $id) { name } greet(name: $who) }`,
+			vars:  map[string]any{"id": 3},
+			data:  `{"pet":{"name":"Kit"},"greet":"hello there"}`,
+		},
+		{
+			name:  "fragments merge with fields",
+			query: `{ pet(id: 1) { ...Names ... on Pet { petId } name } } fragment Names on Pet { name }`,
+			data:  `{"pet":{"name":"Rex","petId":1}}`,
+		},
+		{
+			name:  "include and skip",
+			query: `query ($yes: Boolean!) { pet(id: 1) { name @skip(if: $yes) petId @include(if: $yes) } }`,
+			vars:  map[string]any{"yes": true},
+			data:  `{"pet":{"petId":1}}`,
+		},
+		{
+			name:  "missing object is null",
+			query: `{ pet(id: 9) { name } }`,
+			data:  `{"pet":null}`,
+		},
+		{
+			name:   "resolver error nulls only its field",
+			query:  `{ pet(id: 1) { name secret } }`,
+			data:   `{"pet":{"name":"Rex","secret":null}}`,
+			errors: []string{"Forbidden: secret at [pet secret]"},
+		},
+		{
+			name:   "non-null field without value",
+			query:  `{ pet(id: 1) { mustExist } }`,
+			data:   `{"pet":{"mustExist":null}}`,
+			errors: []string{"cannot return null for a non-null field at [pet mustExist]"},
+		},
+		{
+			name:   "panicking resolver",
+			query:  `{ pet(id: 1) { crash } }`,
+			data:   `{"pet":{"crash":null}}`,
+			errors: []string{"internal error at [pet crash]"},
+		},
+		{
+			name:   "authorization refuses the object",
+			query:  `{ mine: pet(id: 1) { name } theirs: pet(id: 2) { name } }`,
+			data:   `{"mine":{"name":"Rex"},"theirs":null}`,
+			errors: []string{"Forbidden: not owner at [theirs]"},
+		},
+		{
+			name:   "authorization applies to nested objects",
+			query:  `{ pet(id: 1) { name friend { name } } }`,
+			data:   `{"pet":{"name":"Rex","friend":null}}`,
+			errors: []string{"Forbidden: not owner at [pet friend]"},
+		},
+		{
+			name:   "lists with indexes in paths",
+			query:  `query ($ids: [Int!]) { pets(ids: $ids) { name } }`,
+			vars:   map[string]any{"ids": []any{1, 2}},
+			data:   `{"pets":[{"name":"Rex"},null]}`,
+			errors: []string{"Forbidden: not owner at [pets 1]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batches := 0
+			data, errs := run(t, testSchema(t, &batches), 2, tt.query, tt.vars)
+			if data != tt.data {
+				t.Errorf("data = %s, want %s", data, tt.data)
+			}
+			var got []string
+			for _, e := range errs {
+				got = append(got, e.Message+" at "+strings.Trim(strings.ReplaceAll(jsonString(t, e.Path), ",", " "), "[]"))
+			}
+			want := make([]string, len(tt.errors))
+			for i, e := range tt.errors {
+				msg, path, _ := strings.Cut(e, " at [")
+				want[i] = msg + " at " + strings.TrimSuffix(path, "]")
+			}
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("errors = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// jsonString renders a path like ["pets",1] as [pets,1]
+func jsonString(t *testing.T, path []any) string {
+	encoded, err := json.Marshal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.ReplaceAll(string(encoded), `"`, "")
+}
+
+func TestExecuteRejectsInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		vars  map[string]any
+		want  string
+	}{
+		{"syntax error", `{ pet(id: 1) { name }`, nil, `expected a name, found end of document`},
+		{"mutation", `mutation { pet(id: 1) { name } }`, nil, "Only queries are supported, mutation is not"},
+		{"unknown field", `{ pet(id: 1) { color } }`, nil, `Cannot query field "color" on type "Pet"`},
+		{"missing subfields", `{ pet(id: 1) }`, nil, `Field "pet" of type Pet needs a selection of subfields`},
+		{"subfields on scalar", `{ greet { x } }`, nil, `Field "greet" of type String! has no subfields`},
+		{"missing argument", `{ pet { name } }`, nil, `Field "pet" argument "id" of type Int! is required`},
+		{"wrong argument type", `{ pet(id: "one") { name } }`, nil, `Field "pet" argument "id"`},
+		{"unknown argument", `{ greet(nickname: "x") }`, nil, `Unknown argument "nickname" on field "greet"`},
+		{"undefined variable", `{ pet(id: $id) { name } }`, nil, "Variable $id is not defined"},
+		{"missing variable", `query ($id: Int!) { pet(id: $id) { name } }`, nil, "variable $id"},
+		{"unknown fragment", `{ pet(id: 1) { ...Nope } }`, nil, `Unknown fragment "Nope"`},
+		{"fragment cycle", `{ pet(id: 1) { ...A } } fragment A on Pet { friend { ...A } }`, nil, `Fragment "A" spreads itself`},
+		{"fragment on wrong type", `{ pet(id: 1) { ...Q } } fragment Q on Query { greet }`, nil, `Fragment "Q" on Query cannot be spread on Pet`},
+		{"unknown directive", `{ greet @deprecated }`, nil, "Unknown directive @deprecated"},
+		{"too deep", `{ pet(id: 1) { friend { friend { friend { name } } } } }`, nil, "Query is nested deeper than 3 levels"},
+		{"several operations", `query A { greet } query B { greet }`, nil, "operationName is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batches := 0
+			data, errs := run(t, testSchema(t, &batches), 2, tt.query, tt.vars)
+			if data != "" {
+				t.Fatalf("data = %s, want the request rejected", data)
+			}
+			if len(errs) == 0 || !strings.Contains(errs[0].Message, tt.want) {
+				t.Fatalf("errors = %v, want %q", errs, tt.want)
+			}
+			if batches != 0 {
+				t.Fatalf("a rejected request ran %d batches", batches)
+			}
+		})
+	}
+}
+
+func TestExecuteBatchesSiblings(t *testing.T) {
+	batches := 0
+	s := testSchema(t, &batches)
+	data, errs := run(t, s, 2, `{ a: pet(id: 1) { name } b: pet(id: 3) { name } c: pet(id: 1) { petId } }`, nil)
+	if len(errs) > 0 {
+		t.Fatalf("errors = %v", errs)
+	}
+	if data != `{"a":{"name":"Rex"},"b":{"name":"Kit"},"c":{"petId":1}}` {
+		t.Fatalf("data = %s", data)
+	}
+	if batches != 1 {
+		t.Fatalf("sibling loads ran %d batches, want 1", batches)
+	}
+}
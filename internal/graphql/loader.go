@@ -0,0 +1,66 @@
+package graphql
+
+import "context"
+
+// BatchFunc loads many keys at once. Keys missing from the result resolve to the zero value.
+type BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+// Loader collects the keys requested by sibling fields and loads them in one batch when the first
+// of their thunks runs. Results are cached for the rest of the request. Loaders are per request
+// and, like the executor, not safe for concurrent use.
+type Loader[K comparable, V any] struct {
+	ctx   context.Context
+	batch BatchFunc[K, V]
+
+	pending []K
+	queued  map[K]bool
+	done    map[K]bool
+	results map[K]V
+	errs    map[K]error
+}
+
+// NewLoader returns a loader whose batches run with ctx
+func NewLoader[K comparable, V any](ctx context.Context, batch BatchFunc[K, V]) *Loader[K, V] {
+	return &Loader[K, V]{
+		ctx:     ctx,
+		batch:   batch,
+		queued:  map[K]bool{},
+		done:    map[K]bool{},
+		results: map[K]V{},
+		errs:    map[K]error{},
+	}
+}
+
+// Load schedules key for the next batch and returns a thunk resolving to its value
+func (l *Loader[K, V]) Load(key K) Thunk {
+	if !l.done[key] && !l.queued[key] {
+		l.queued[key] = true
+		l.pending = append(l.pending, key)
+	}
+	return func() (any, error) {
+		if !l.done[key] {
+			l.dispatch()
+		}
+		if err := l.errs[key]; err != nil {
+			return nil, err
+		}
+		return l.results[key], nil
+	}
+}
+
+// dispatch loads every pending key with a single call of the batch function
+func (l *Loader[K, V]) dispatch() {
+	keys := l.pending
+	l.pending = nil
+
+	results, err := l.batch(l.ctx, keys)
+	for _, key := range keys {
+		delete(l.queued, key)
+		l.done[key] = true
+		if err != nil {
+			l.errs[key] = err
+			continue
+		}
+		l.results[key] = results[key]
+	}
+}
@@ -0,0 +1,509 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Document is a parsed request: its operations and the fragments they may spread
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation is a query, mutation or subscription definition
+type Operation struct {
+	Type         string
+	Name         string
+	Variables    []VariableDefinition
+	SelectionSet []Selection
+}
+
+type VariableDefinition struct {
+	Name    string
+	Type    string
+	Default *Value
+}
+
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	SelectionSet  []Selection
+}
+
+// Selection is a field, a fragment spread (Fragment set) or an inline fragment (SelectionSet set without Name)
+type Selection struct {
+	Alias        string
+	Name         string
+	Arguments    map[string]*Value
+	Directives   []Directive
+	SelectionSet []Selection
+
+	Fragment      string
+	TypeCondition string
+	Inline        bool
+
+	Line, Column int
+}
+
+type Directive struct {
+	Name      string
+	Arguments map[string]*Value
+}
+
+// Value kinds of a literal argument
+const (
+	KindVariable = iota
+	KindInt
+	KindFloat
+	KindString
+	KindBoolean
+	KindNull
+	KindEnum
+	KindList
+	KindObject
+)
+
+// Value is a literal or a variable reference
+type Value struct {
+	Kind   int
+	Raw    string
+	List   []*Value
+	Fields map[string]*Value
+}
+
+// SyntaxError reports where parsing failed
+type SyntaxError struct {
+	Message      string
+	Line, Column int
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// Token kinds
+const (
+	tokenEOF = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind         int
+	value        string
+	line, column int
+}
+
+type parser struct {
+	src   string
+	pos   int
+	line  int
+	col   int
+	token token
+}
+
+// Parse parses a GraphQL request document
+func Parse(src string) (doc *Document, err error) {
+	p := &parser{src: src, line: 1, col: 1}
+	defer func() {
+		if r := recover(); r != nil {
+			syntaxErr, ok := r.(*SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, syntaxErr
+		}
+	}()
+
+	p.next()
+	doc = &Document{Fragments: map[string]*Fragment{}}
+	for p.token.kind != tokenEOF {
+		switch {
+		case p.peek("{"):
+			doc.Operations = append(doc.Operations, &Operation{Type: "query", SelectionSet: p.selectionSet()})
+		case p.token.kind == tokenName && p.token.value == "fragment":
+			p.next()
+			f := &Fragment{Name: p.name()}
+			if p.name() != "on" {
+				p.fail("expected \"on\"")
+			}
+			f.TypeCondition = p.name()
+			p.directives()
+			f.SelectionSet = p.selectionSet()
+			if _, dup := doc.Fragments[f.Name]; dup {
+				p.fail("duplicate fragment " + f.Name)
+			}
+			doc.Fragments[f.Name] = f
+		case p.token.kind == tokenName && (p.token.value == "query" || p.token.value == "mutation" || p.token.value == "subscription"):
+			op := &Operation{Type: p.name()}
+			if p.token.kind == tokenName {
+				op.Name = p.name()
+			}
+			if p.skip("(") {
+				for !p.skip(")") {
+					p.expect("$")
+					v := VariableDefinition{Name: p.name()}
+					p.expect(":")
+					v.Type = p.typeRef()
+					if p.skip("=") {
+						v.Default = p.value(true)
+					}
+					op.Variables = append(op.Variables, v)
+				}
+			}
+			p.directives()
+			op.SelectionSet = p.selectionSet()
+			doc.Operations = append(doc.Operations, op)
+		default:
+			p.fail("unexpected " + p.describe())
+		}
+	}
+	if len(doc.Operations) == 0 {
+		p.fail("document has no operation")
+	}
+	return doc, nil
+}
+
+func (p *parser) selectionSet() []Selection {
+	p.expect("{")
+	var selections []Selection
+	for !p.skip("}") {
+		line, col := p.token.line, p.token.column
+		if p.skip("...") {
+			s := Selection{Line: line, Column: col}
+			switch {
+			case p.token.kind == tokenName && p.token.value == "on":
+				p.next()
+				s.TypeCondition = p.name()
+				s.Inline = true
+			case p.token.kind == tokenName:
+				s.Fragment = p.name()
+			default:
+				s.Inline = true
+			}
+			s.Directives = p.directives()
+			if s.Inline {
+				s.SelectionSet = p.selectionSet()
+			}
+			selections = append(selections, s)
+			continue
+		}
+
+		s := Selection{Name: p.name(), Line: line, Column: col}
+		if p.skip(":") {
+			s.Alias, s.Name = s.Name, p.name()
+		}
+		s.Arguments = p.arguments()
+		s.Directives = p.directives()
+		if p.peek("{") {
+			s.SelectionSet = p.selectionSet()
+		}
+		selections = append(selections, s)
+	}
+	if len(selections) == 0 {
+		p.fail("empty selection set")
+	}
+	return selections
+}
+
+func (p *parser) arguments() map[string]*Value {
+	if !p.skip("(") {
+		return nil
+	}
+	args := map[string]*Value{}
+	for !p.skip(")") {
+		name := p.name()
+		p.expect(":")
+		args[name] = p.value(false)
+	}
+	return args
+}
+
+func (p *parser) directives() []Directive {
+	var directives []Directive
+	for p.skip("@") {
+		directives = append(directives, Directive{Name: p.name(), Arguments: p.arguments()})
+	}
+	return directives
+}
+
+// typeRef returns a type reference such as "[Int!]!" as written
+func (p *parser) typeRef() string {
+	var t string
+	if p.skip("[") {
+		t = "[" + p.typeRef() + "]"
+		p.expect("]")
+	} else {
+		t = p.name()
+	}
+	if p.skip("!") {
+		t += "!"
+	}
+	return t
+}
+
+func (p *parser) value(constant bool) *Value {
+	tok := p.token
+	switch {
+	case tok.kind == tokenPunct && tok.value == "$" && !constant:
+		p.next()
+		return &Value{Kind: KindVariable, Raw: p.name()}
+	case tok.kind == tokenInt:
+		p.next()
+		return &Value{Kind: KindInt, Raw: tok.value}
+	case tok.kind == tokenFloat:
+		p.next()
+		return &Value{Kind: KindFloat, Raw: tok.value}
+	case tok.kind == tokenString:
+		p.next()
+		return &Value{Kind: KindString, Raw: tok.value}
+	case tok.kind == tokenName:
+		p.next()
+		switch tok.value {
+		case "true", "false":
+			return &Value{Kind: KindBoolean, Raw: tok.value}
+		case "null":
+			return &Value{Kind: KindNull}
+		}
+		return &Value{Kind: KindEnum, Raw: tok.value}
+	case p.skip("["):
+		v := &Value{Kind: KindList}
+		for !p.skip("]") {
+			v.List = append(v.List, p.value(constant))
+		}
+		return v
+	case p.skip("{"):
+		v := &Value{Kind: KindObject, Fields: map[string]*Value{}}
+		for !p.skip("}") {
+			name := p.name()
+			p.expect(":")
+			v.Fields[name] = p.value(constant)
+		}
+		return v
+	}
+	p.fail("expected a value, found " + p.describe())
+	return nil
+}
+
+func (p *parser) name() string {
+	if p.token.kind != tokenName {
+		p.fail("expected a name, found " + p.describe())
+	}
+	name := p.token.value
+	p.next()
+	return name
+}
+
+func (p *parser) peek(punct string) bool {
+	return p.token.kind == tokenPunct && p.token.value == punct
+}
+
+func (p *parser) skip(punct string) bool {
+	if p.peek(punct) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(punct string) {
+	if !p.skip(punct) {
+		p.fail(fmt.Sprintf("expected %q, found %s", punct, p.describe()))
+	}
+}
+
+func (p *parser) describe() string {
+	if p.token.kind == tokenEOF {
+		return "end of document"
+	}
+	return strconv.Quote(p.token.value)
+}
+
+func (p *parser) fail(message string) {
+	panic(&SyntaxError{Message: message, Line: p.token.line, Column: p.token.column})
+}
+
+// next reads the following token, skipping whitespace, commas and comments
+func (p *parser) next() {
+skip:
+	for p.pos < len(p.src) {
+		rest := p.src[p.pos:]
+		switch {
+		case rest[0] == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.advance(1)
+			}
+		case strings.HasPrefix(rest, "\uFEFF"):
+			p.advance(len("\uFEFF"))
+		case strings.IndexByte(" \t\n\r,", rest[0]) >= 0:
+			p.advance(1)
+		default:
+			break skip
+		}
+	}
+
+	p.token = token{line: p.line, column: p.col}
+	if p.pos >= len(p.src) {
+		p.token.kind = tokenEOF
+		return
+	}
+
+	rest := p.src[p.pos:]
+	c := rest[0]
+	switch {
+	case strings.HasPrefix(rest, "..."):
+		p.token.kind, p.token.value = tokenPunct, "..."
+		p.advance(3)
+	case strings.ContainsRune("!$()&:=@[]{}|", rune(c)):
+		p.token.kind, p.token.value = tokenPunct, string(c)
+		p.advance(1)
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		n := 1
+		for n < len(rest) && (rest[n] == '_' || rest[n] >= 'a' && rest[n] <= 'z' || rest[n] >= 'A' && rest[n] <= 'Z' || rest[n] >= '0' && rest[n] <= '9') {
+			n++
+		}
+		p.token.kind, p.token.value = tokenName, rest[:n]
+		p.advance(n)
+	case c == '-' || c >= '0' && c <= '9':
+		p.number(rest)
+	case c == '"':
+		p.string(rest)
+	default:
+		r, _ := utf8.DecodeRuneInString(rest)
+		p.fail(fmt.Sprintf("unexpected character %q", r))
+	}
+}
+
+func (p *parser) number(rest string) {
+	n := 0
+	if rest[0] == '-' {
+		n++
+	}
+	kind := tokenInt
+	for n < len(rest) {
+		c := rest[n]
+		switch {
+		case c >= '0' && c <= '9':
+		case c == '.' || c == 'e' || c == 'E':
+			kind = tokenFloat
+		case (c == '+' || c == '-') && (rest[n-1] == 'e' || rest[n-1] == 'E'):
+		default:
+			goto done
+		}
+		n++
+	}
+done:
+	raw := rest[:n]
+	if kind == tokenInt {
+		if _, err := strconv.ParseInt(raw, 10, 64); err != nil {
+			p.fail("invalid number " + raw)
+		}
+	} else if _, err := strconv.ParseFloat(raw, 64); err != nil {
+		p.fail("invalid number " + raw)
+	}
+	p.token.kind, p.token.value = kind, raw
+	p.advance(n)
+}
+
+func (p *parser) string(rest string) {
+	// Block strings keep their content verbatim apart from common indentation
+	if strings.HasPrefix(rest, `"""`) {
+		end := strings.Index(rest[3:], `"""`)
+		if end < 0 {
+			p.fail("unterminated string")
+		}
+		p.token.kind, p.token.value = tokenString, blockString(rest[3:3+end])
+		p.advance(end + 6)
+		return
+	}
+
+	var b strings.Builder
+	for n := 1; n < len(rest); {
+		c := rest[n]
+		switch {
+		case c == '"':
+			p.token.kind, p.token.value = tokenString, b.String()
+			p.advance(n + 1)
+			return
+		case c == '\n' || c == '\r':
+			p.fail("unterminated string")
+		case c == '\\' && n+1 < len(rest):
+			escape := rest[n+1]
+			n += 2
+			switch escape {
+			case '"', '\\', '/':
+				b.WriteByte(escape)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if n+4 > len(rest) {
+					p.fail("invalid unicode escape")
+				}
+				code, err := strconv.ParseUint(rest[n:n+4], 16, 32)
+				if err != nil {
+					p.fail("invalid unicode escape")
+				}
+				b.WriteRune(rune(code))
+				n += 4
+			default:
+				p.fail(fmt.Sprintf("invalid escape \\%c", escape))
+			}
+		default:
+			b.WriteByte(c)
+			n++
+		}
+	}
+	p.fail("unterminated string")
+}
+
+func blockString(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && (indent < 0 || len(line)-len(trimmed) < indent) {
+			indent = len(line) - len(trimmed)
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		if len(lines[i]) >= indent {
+			lines[i] = lines[i][indent:]
+		}
+	}
+
+	// Blank lines around the content are dropped, including the indentation of the closing quotes
+	for len(lines) > 0 && strings.TrimLeft(lines[0], " \t") == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[len(lines)-1], " \t") == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// advance moves n bytes forward, tracking line and column for error locations
+func (p *parser) advance(n int) {
+	for _, c := range p.src[p.pos : p.pos+n] {
+		if c == '\n' {
+			p.line++
+			p.col = 1
+		} else {
+			p.col++
+		}
+	}
+	p.pos += n
+}
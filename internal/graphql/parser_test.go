@@ -0,0 +1,137 @@
+package graphql
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`
+		# a named query with variables, aliases, arguments, directives and fragments
+		query Students($name: String = "ann", $ids: [Int!]!, $withDocs: Boolean!) {
+			all: students(name: $name) {
+				...StudentFields
+				documents @include(if: $withDocs) { fileName }
+				... on Student { year }
+				... @skip(if: false) { housing }
+			}
+			student(id: -12) { studentId }
+		}
+
+		fragment StudentFields on Student { studentId, firstName }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Operations) != 1 {
+		t.Fatalf("operations = %d", len(doc.Operations))
+	}
+
+	op := doc.Operations[0]
+	if op.Type != "query" || op.Name != "Students" {
+		t.Fatalf("operation = %s %s", op.Type, op.Name)
+	}
+	wantVars := []VariableDefinition{
+		{Name: "name", Type: "String", Default: &Value{Kind: KindString, Raw: "ann"}},
+		{Name: "ids", Type: "[Int!]!"},
+		{Name: "withDocs", Type: "Boolean!"},
+	}
+	if !reflect.DeepEqual(op.Variables, wantVars) {
+		t.Fatalf("variables = %+v", op.Variables)
+	}
+
+	all := op.SelectionSet[0]
+	if all.Alias != "all" || all.Name != "students" || all.Line != 4 {
+		t.Fatalf("first selection = %+v", all)
+	}
+	if arg := all.Arguments["name"]; arg.Kind != KindVariable || arg.Raw != "name" {
+		t.Fatalf("name argument = %+v", arg)
+	}
+
+	sels := all.SelectionSet
+	if len(sels) != 4 {
+		t.Fatalf("students selections = %d", len(sels))
+	}
+	if sels[0].Fragment != "StudentFields" {
+		t.Fatalf("spread = %+v", sels[0])
+	}
+	if d := sels[1].Directives; len(d) != 1 || d[0].Name != "include" || d[0].Arguments["if"].Raw != "withDocs" {
+		t.Fatalf("directives = %+v", d)
+	}
+	if !sels[2].Inline || sels[2].TypeCondition != "Student" {
+		t.Fatalf("inline fragment = %+v", sels[2])
+	}
+	if !sels[3].Inline || sels[3].TypeCondition != "" || sels[3].Directives[0].Name != "skip" {
+		t.Fatalf("inline fragment without type = %+v", sels[3])
+	}
+
+	if arg := op.SelectionSet[1].Arguments["id"]; arg.Kind != KindInt || arg.Raw != "-12" {
+		t.Fatalf("id argument = %+v", arg)
+	}
+
+	f := doc.Fragments["StudentFields"]
+	if f == nil || f.TypeCondition != "Student" || len(f.SelectionSet) != 2 {
+		t.Fatalf("fragment = %+v", f)
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	doc, err := Parse(`{ f(a: 1.5e3, b: "tab\tquote\" é", c: true, d: null, e: RED, f: [1, 2], g: {x: "y"}, h: """
+		block
+		  indented
+	""") }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := doc.Operations[0].SelectionSet[0].Arguments
+
+	tests := map[string]Value{
+		"a": {Kind: KindFloat, Raw: "1.5e3"},
+		"b": {Kind: KindString, Raw: "tab\tquote\" é"},
+		"c": {Kind: KindBoolean, Raw: "true"},
+		"d": {Kind: KindNull},
+		"e": {Kind: KindEnum, Raw: "RED"},
+		"f": {Kind: KindList, List: []*Value{{Kind: KindInt, Raw: "1"}, {Kind: KindInt, Raw: "2"}}},
+		"g": {Kind: KindObject, Fields: map[string]*Value{"x": {Kind: KindString, Raw: "y"}}},
+		"h": {Kind: KindString, Raw: "block\n  indented"},
+	}
+	for name, want := range tests {
+		if got := args[name]; got == nil || !reflect.DeepEqual(*got, want) {
+			t.Errorf("%s = %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+func TestParseSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		src          string
+		line, column int
+	}{
+		{"empty document", ``, 1, 1},
+		{"unclosed selection", `{ student(id: 1) { name }`, 1, 26},
+		{"empty selection set", `{ student { } }`, 1, 15},
+		{"missing argument value", `{ student(id: ) { name } }`, 1, 15},
+		{"unterminated string", "{ f(a: \"abc\n\") }", 1, 8},
+		{"invalid escape", `{ f(a: "\q") }`, 1, 8},
+		{"invalid number", `{ f(a: 1.2.3) }`, 1, 8},
+		{"unexpected character", `{ f ? }`, 1, 5},
+		{"fragment without on", `fragment F Student { name } { a }`, 1, 20},
+		{"duplicate fragment", "fragment F on A { a }\nfragment F on A { a } { a }", 2, 23},
+		{"variable in default", `query ($a: Int = $b) { a }`, 1, 18},
+		{"stray token", `{ a } }`, 1, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(tt.src)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Parse = %v, %v; want a syntax error", doc, err)
+			}
+			if syntaxErr.Line != tt.line || syntaxErr.Column != tt.column {
+				t.Fatalf("error at %d:%d (%s), want %d:%d", syntaxErr.Line, syntaxErr.Column, syntaxErr.Message, tt.line, tt.column)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+// Package graphql is a small GraphQL query engine: a parser, a schema of Go resolvers and an
+// executor that resolves the query breadth first so Loader batches every sibling's lookups into one.
+// It supports queries with variables, aliases, fragments and @include/@skip. Mutations,
+// subscriptions and introspection are not supported; Schema.SDL prints the schema instead.
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Built-in scalars. DateTime values are serialized as RFC 3339 strings.
+var scalars = map[string]bool{"Int": true, "Float": true, "String": true, "Boolean": true, "ID": true, "DateTime": true}
+
+// Params is what a resolver receives
+type Params struct {
+	Context context.Context
+	// Source is the parent object, dereferenced when it was a pointer
+	Source any
+	Args   map[string]any
+}
+
+// ResolveFunc returns the value of a field, or a Thunk to defer loading it until every
+// sibling asked for its value
+type ResolveFunc func(p Params) (any, error)
+
+// Thunk is a deferred value, usually returned by Loader.Load
+type Thunk func() (any, error)
+
+// Object is an object type of the schema
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*Field
+	// Authorize runs before any field of a value of this type is resolved. An error replaces
+	// the whole object with null.
+	Authorize func(ctx context.Context, source any) error
+
+	fields map[string]*Field
+}
+
+// Field is a field of an object type. Type is written in SDL, e.g. "[Student!]!".
+// Fields without Resolve read the struct field whose json tag is the snake_case of the name.
+type Field struct {
+	Name        string
+	Description string
+	Type        string
+	Args        []Arg
+	Resolve     ResolveFunc
+
+	typ *typeRef
+}
+
+// Arg is a field argument
+type Arg struct {
+	Name        string
+	Type        string
+	Description string
+	Default     any
+
+	typ *typeRef
+}
+
+// Schema is the query root and every object type reachable from it
+type Schema struct {
+	Query *Object
+	// MaxDepth bounds how deeply selections may nest, 0 means unlimited
+	MaxDepth int
+
+	types map[string]*Object
+}
+
+type typeRef struct {
+	name    string
+	list    *typeRef
+	nonNull bool
+}
+
+var typePattern = regexp.MustCompile(`^(\[.+\]|[_A-Za-z][_0-9A-Za-z]*)(!?)$`)
+
+func parseType(s string) (*typeRef, error) {
+	m := typePattern.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("invalid type %q", s)
+	}
+	t := &typeRef{nonNull: m[2] == "!"}
+	if strings.HasPrefix(m[1], "[") {
+		elem, err := parseType(m[1][1 : len(m[1])-1])
+		if err != nil {
+			return nil, err
+		}
+		t.list = elem
+	} else {
+		t.name = m[1]
+	}
+	return t, nil
+}
+
+func (t *typeRef) String() string {
+	s := t.name
+	if t.list != nil {
+		s = "[" + t.list.String() + "]"
+	}
+	if t.nonNull {
+		s += "!"
+	}
+	return s
+}
+
+// NewSchema checks that every referenced type exists and indexes the fields
+func NewSchema(query *Object, types ...*Object) (*Schema, error) {
+	s := &Schema{Query: query, types: map[string]*Object{}}
+	for _, obj := range append([]*Object{query}, types...) {
+		if _, dup := s.types[obj.Name]; dup || scalars[obj.Name] {
+			return nil, fmt.Errorf("graphql: type %s defined twice", obj.Name)
+		}
+		s.types[obj.Name] = obj
+	}
+
+	for _, obj := range s.types {
+		obj.fields = map[string]*Field{}
+		for _, f := range obj.Fields {
+			t, err := parseType(f.Type)
+			if err != nil {
+				return nil, fmt.Errorf("graphql: %s.%s: %w", obj.Name, f.Name, err)
+			}
+			if name := t.base(); !scalars[name] && s.types[name] == nil {
+				return nil, fmt.Errorf("graphql: %s.%s: unknown type %s", obj.Name, f.Name, name)
+			}
+			f.typ = t
+			for i := range f.Args {
+				at, err := parseType(f.Args[i].Type)
+				if err != nil {
+					return nil, fmt.Errorf("graphql: %s.%s(%s): %w", obj.Name, f.Name, f.Args[i].Name, err)
+				}
+				if !scalars[at.base()] {
+					return nil, fmt.Errorf("graphql: %s.%s(%s): arguments must be scalars", obj.Name, f.Name, f.Args[i].Name)
+				}
+				f.Args[i].typ = at
+			}
+			obj.fields[f.Name] = f
+		}
+	}
+	return s, nil
+}
+
+func (t *typeRef) base() string {
+	for t.list != nil {
+		t = t.list
+	}
+	return t.name
+}
+
+// SDL prints the schema in the GraphQL schema definition language
+func (s *Schema) SDL() string {
+	names := make([]string, 0, len(s.types))
+	for name := range s.types {
+		if name != s.Query.Name {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("scalar DateTime\n\nschema {\n  query: " + s.Query.Name + "\n}\n")
+	for _, name := range append([]string{s.Query.Name}, names...) {
+		obj := s.types[name]
+		b.WriteString("\n")
+		writeDescription(&b, obj.Description, "")
+		b.WriteString("type " + obj.Name + " {\n")
+		for _, f := range obj.Fields {
+			writeDescription(&b, f.Description, "  ")
+			b.WriteString("  " + f.Name)
+			if len(f.Args) > 0 {
+				args := make([]string, len(f.Args))
+				for i, a := range f.Args {
+					args[i] = a.Name + ": " + a.Type
+					if a.Default != nil {
+						args[i] += fmt.Sprintf(" = %v", a.Default)
+					}
+				}
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			b.WriteString(": " + f.Type + "\n")
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+func writeDescription(b *strings.Builder, description, indent string) {
+	if description != "" {
+		b.WriteString(indent + `"""` + description + `"""` + "\n")
+	}
+}
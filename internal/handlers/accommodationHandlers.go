@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/export"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 
@@ -32,6 +33,13 @@ func GetAccommodations(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "accommodations", models.Accommodation{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	accommodations := make([]models.Accommodation, 0)
 
@@ -40,15 +48,35 @@ func GetAccommodations(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		var a models.Accommodation
 		// Parses the current data into fields of "a" variable
 		if err := rows.Scan(&a.AccommodationID, &a.Name, &a.Description); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse accommodations")
 			log.Println("Row scan error:", err)
 			return
 		}
 
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(a); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		// Adds the obtained data to the slice
 		accommodations = append(accommodations, a)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -154,6 +182,13 @@ func GetAccommodationsByStudentID(db *sql.DB, w http.ResponseWriter, r *http.Req
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "student_accommodations", AccommodationWithBoolean{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	accommodations := make([]AccommodationWithBoolean, 0)
 
@@ -162,15 +197,35 @@ func GetAccommodationsByStudentID(db *sql.DB, w http.ResponseWriter, r *http.Req
 		var a AccommodationWithBoolean
 		// Parses the current data into fields of "a" variable
 		if err := rows.Scan(&a.AccommodationID, &a.Name, &a.Description, &a.HasAccommodation); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse accommodations")
 			log.Println("Row scan error:", err)
 			return
 		}
 
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(a); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		// Adds the obtained data to the slice
 		accommodations = append(accommodations, a)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -8,6 +8,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/activity"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/export"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 	"github.com/gorilla/mux"
@@ -19,7 +21,7 @@ func GetActivities(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	// All data being selected for this GET command
 	query := `
 		SELECT
-    	    activity_id, activity_datetime
+    	    activity_id, activity_datetime, activity_type
     	FROM activity
 	`
 
@@ -34,6 +36,13 @@ func GetActivities(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "activities", models.Activity{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	activities := make([]models.Activity, 0)
 
@@ -41,16 +50,36 @@ func GetActivities(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var a models.Activity
 		// Parses the current data into fields of "a" variable
-		if err := rows.Scan(&a.ActivityID, &a.ActivityDateTime); err != nil {
+		if err := rows.Scan(&a.ActivityID, &a.ActivityDateTime, &a.ActivityType); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse activities")
 			log.Println("Row scan error:", err)
 			return
 		}
 
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(a); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		// Adds the obtained data to the slice
 		activities = append(activities, a)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -79,9 +108,9 @@ func GetActivityByID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// All data being selected for this GET command
+	// All data being selected for this GET command, the type says where the details live
 	query := `
-        SELECT activity_id, activity_datetime
+        SELECT activity_id, activity_datetime, activity_type
         FROM activity
         WHERE activity_id = ?
     `
@@ -91,7 +120,7 @@ func GetActivityByID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 
 	// Executes written SQL and retrieves only one row
 	err = db.QueryRowContext(r.Context(), query, activityID).Scan(
-		&a.ActivityID, &a.ActivityDateTime,
+		&a.ActivityID, &a.ActivityDateTime, &a.ActivityType,
 	)
 
 	// Error message if no rows are found
@@ -105,13 +134,51 @@ func GetActivityByID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Writes the struct as JSON & sends a HTTP 200 response code
-	utils.WriteJSON(w, http.StatusOK, a)
+	// Looks up the registered type of the activity
+	t, err := activity.Lookup(a.ActivityType)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch activity")
+		log.Println("Activity type error:", err)
+		return
+	}
+
+	// Checks that the caller may read activities of this type, students only their own
+	role, _ := r.Context().Value(utils.RoleKey).(string)
+	userID, _ := r.Context().Value(utils.UserIDKey).(int)
+	allowed, err := activity.CanRead(r.Context(), db, t, role, userID, activityID)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "Activity not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch activity")
+		log.Println("DB query error:", err)
+		return
+	}
+	if !allowed {
+		utils.WriteError(w, http.StatusForbidden, "Forbidden: not allowed to read this activity")
+		return
+	}
+
+	// Loads the subtype details, documents in the trash are not found
+	details, err := t.Load(r.Context(), db, activityID)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "Activity not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch activity")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Writes the activity with its details as JSON & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, struct {
+		models.Activity
+		Details any `json:"details"`
+	}{a, details})
 }
 
 func GetActivitiesSummary(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	// Extracts query parameters from the request URL
-	dateStr := r.URL.Query().Get("date")
 	tzStr := r.URL.Query().Get("tz")
 	studentIDStr := r.URL.Query().Get("student_id")
 	adminIDStr := r.URL.Query().Get("admin_id")
@@ -128,61 +195,52 @@ func GetActivitiesSummary(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Base SQL query to retrieve all activities
-	query := `
-		SELECT activity_id, activity_datetime
-		FROM activity
-	`
+	// Only types with a summarizer are listed, documents in the trash are hidden
+	types := activity.Summarizable()
 	args := []any{}
-	where := []string{}
+	for _, t := range types {
+		args = append(args, t)
+	}
+	where := []string{
+		"a.activity_type IN (" + strings.TrimSuffix(strings.Repeat("?,", len(types)), ",") + ")",
+		"a.activity_id NOT IN (SELECT documentation_id FROM documentation WHERE deleted_at IS NOT NULL)",
+	}
 
-	// Optional date filter — converts date string to time range
-	if dateStr != "" {
-		targetDate, err := time.ParseInLocation("2006-01-02", dateStr, loc)
-		if err != nil {
-			utils.WriteError(w, http.StatusBadRequest, "Invalid date format (expected YYYY-MM-DD)")
-			log.Println("Date parse error:", err)
-			return
-		}
-		start := targetDate
-		end := targetDate.Add(24 * time.Hour)
-		where = append(where, "activity_datetime >= ? AND activity_datetime < ?")
-		args = append(args, start.UTC(), end.UTC())
+	// Optional date or from/to filter — converts the days to a time range
+	dateRange, rangeArgs, err := summaryRange(r.URL.Query(), loc, "a.activity_datetime")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if dateRange != "" {
+		where = append(where, dateRange)
+		args = append(args, rangeArgs...)
 	}
 
 	// Optional student filter — restricts to activities linked to a student
 	if studentIDStr != "" {
-		where = append(where, `
-			activity_id IN (
-				SELECT point_of_contact_id FROM point_of_contact WHERE student_id = ?
-				UNION
-				SELECT specific_documentation_id FROM specific_documentation WHERE student_id = ?
-			)
-		`)
-		args = append(args, studentIDStr, studentIDStr)
+		scope, scopeArgs := activity.StudentScope(types, studentIDStr)
+		where = append(where, "a.activity_id IN ("+scope+")")
+		args = append(args, scopeArgs...)
 	}
 
 	// Optional admin filter — restricts to activities linked to an admin
 	if adminIDStr != "" {
 		where = append(where, `
-			activity_id IN (
-				SELECT poc.point_of_contact_id
-				FROM point_of_contact poc
-				INNER JOIN poc_admin pa ON pa.point_of_contact_id = poc.point_of_contact_id
-				WHERE pa.admin_id = ?
+			a.activity_id IN (
+				SELECT pa.point_of_contact_id FROM poc_admin pa WHERE pa.admin_id = ?
 			)
 		`)
 		args = append(args, adminIDStr)
 	}
 
-	// Adds all conditions to the final query
-	if len(where) > 0 {
-		query += " WHERE " + strings.Join(where, " AND ")
-	}
-	query += " ORDER BY activity_datetime DESC"
-
-	// Executes written SQL query
-	rows, err := db.QueryContext(r.Context(), query, args...)
+	// Executes written SQL query, the details are added per type below
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT a.activity_id, a.activity_datetime, a.activity_type
+		FROM activity a
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY a.activity_datetime DESC
+	`, args...)
 
 	// Error message if QueryContext fails
 	if err != nil {
@@ -192,127 +250,18 @@ func GetActivitiesSummary(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
-	// Defines supporting structs for output
-	type Person struct {
-		ID            int    `json:"id"`
-		FirstName     string `json:"first_name"`
-		PreferredName string `json:"preferred_name"`
-		LastName      string `json:"last_name"`
-	}
-
-	type ActivityData struct {
-		ActivityID       int        `json:"activity_id"`
-		ActivityDateTime time.Time  `json:"activity_datetime"`
-		Type             string     `json:"type"`
-		DocType          *string    `json:"doc_type,omitempty"`
-		FileName         *string    `json:"file_name,omitempty"`
-		EventDateTime    *time.Time `json:"event_datetime,omitempty"`
-		Duration         *int       `json:"duration,omitempty"`
-		EventType        *string    `json:"event_type,omitempty"`
-		Student          Person     `json:"student"`
-		Admins           []Person   `json:"admins,omitempty"`
-	}
-
 	// Creates an empty slice to store results
-	activities := make([]ActivityData, 0)
+	activities := make([]*activity.Summary, 0)
 
 	// Reads each row returned by the database
 	for rows.Next() {
-		var a ActivityData
-		// Parses current row data into ActivityData fields
-		if err := rows.Scan(&a.ActivityID, &a.ActivityDateTime); err != nil {
+		var a activity.Summary
+		if err := rows.Scan(&a.ActivityID, &a.ActivityDateTime, &a.Type); err != nil {
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse activities")
 			log.Println("Row scan error:", err)
 			return
 		}
-
-		// --- CASE 1: Point of Contact ---
-		var poc struct {
-			PointOfContactID int
-			StudentID        int
-			EventDateTime    time.Time
-			Duration         int
-			EventType        string
-		}
-		err = db.QueryRowContext(r.Context(), `
-			SELECT point_of_contact_id, student_id, event_datetime, duration, event_type
-			FROM point_of_contact
-			WHERE point_of_contact_id = ?
-		`, a.ActivityID).Scan(&poc.PointOfContactID, &poc.StudentID, &poc.EventDateTime, &poc.Duration, &poc.EventType)
-
-		// Found: Point of Contact type
-		if err == nil {
-			var student Person
-			if err := db.QueryRowContext(r.Context(), `
-				SELECT person_id, first_name, preferred_name, last_name
-				FROM person
-				WHERE person_id = ?
-			`, poc.StudentID).Scan(&student.ID, &student.FirstName, &student.PreferredName, &student.LastName); err != nil {
-				log.Println("Student query error:", err)
-			}
-
-			adminRows, _ := db.QueryContext(r.Context(), `
-				SELECT p.person_id, p.first_name, p.preferred_name, p.last_name
-				FROM admin a
-				INNER JOIN person p ON a.admin_id = p.person_id
-				INNER JOIN poc_admin pa ON pa.admin_id = a.admin_id
-				WHERE pa.point_of_contact_id = ?
-			`, poc.PointOfContactID)
-
-			admins := []Person{}
-			for adminRows.Next() {
-				var adm Person
-				if err := adminRows.Scan(&adm.ID, &adm.FirstName, &adm.PreferredName, &adm.LastName); err == nil {
-					admins = append(admins, adm)
-				}
-			}
-			adminRows.Close()
-
-			a.Type = "point_of_contact"
-			a.Student = student
-			a.Admins = admins
-			a.EventDateTime = &poc.EventDateTime
-			a.Duration = &poc.Duration
-			a.EventType = &poc.EventType
-			activities = append(activities, a)
-			continue
-		}
-
-		// --- CASE 2: Specific Documentation ---
-		var doc struct {
-			ID        int
-			StudentID int
-			DocType   string
-			FileName  string
-		}
-		err = db.QueryRowContext(r.Context(), `
-			SELECT sd.specific_documentation_id,
-				sd.student_id,
-				sd.doc_type,
-				d.file_name
-			FROM specific_documentation sd
-			INNER JOIN documentation d
-				ON d.documentation_id = sd.specific_documentation_id
-			WHERE sd.specific_documentation_id = ?
-		`, a.ActivityID).Scan(&doc.ID, &doc.StudentID, &doc.DocType, &doc.FileName)
-
-		// Found: Specific Documentation type
-		if err == nil {
-			var student Person
-			if err := db.QueryRowContext(r.Context(), `
-				SELECT person_id, first_name, preferred_name, last_name
-				FROM person
-				WHERE person_id = ?
-			`, doc.StudentID).Scan(&student.ID, &student.FirstName, &student.PreferredName, &student.LastName); err != nil {
-				log.Println("Student query error:", err)
-			}
-
-			a.Type = "specific_documentation"
-			a.Student = student
-			a.DocType = &doc.DocType
-			a.FileName = &doc.FileName
-			activities = append(activities, a)
-		}
+		activities = append(activities, &a)
 	}
 
 	// Checks for iteration errors
@@ -321,6 +270,31 @@ func GetActivitiesSummary(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		log.Println("Rows error:", err)
 		return
 	}
+	rows.Close()
+
+	// Lets every type fill in its details, a few queries per type however many rows there are
+	if err := activity.Summarize(r.Context(), db, activities); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to obtain activity details")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "activity_summary", activity.Summary{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+	if out != nil {
+		for _, a := range activities {
+			if err := out.Write(*a); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+		}
+		out.Close(nil)
+		return
+	}
 
 	// Writes the slice as JSON & sends a HTTP 200 response code
 	utils.WriteJSON(w, http.StatusOK, activities)
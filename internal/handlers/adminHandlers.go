@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"log"
 	"net/http"
 	"strconv"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/export"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/history"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 	"golang.org/x/crypto/bcrypt"
@@ -25,6 +29,7 @@ func GetAdmins(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 			p.birthday, p.address, p.city, p.state, p.zip_code, p.country, a.title
 		FROM admin a
 		JOIN person p ON a.admin_id = p.person_id
+		WHERE p.deleted_at IS NULL
 	`
 
 	// Executes written SQL
@@ -38,6 +43,13 @@ func GetAdmins(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "admins", models.Admin{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	admins := make([]models.Admin, 0)
 
@@ -47,18 +59,42 @@ func GetAdmins(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		// Parses the current data into fields of "a" variable
 		if err := rows.Scan(
 			&a.AdminID, &a.FirstName, &a.PreferredName, &a.MiddleName, &a.LastName,
-			&a.Email, &a.PhoneNumber, &a.Pronouns, &a.Sex, &a.Gender,
-			&a.Birthday, &a.Address, &a.City, &a.State, &a.ZipCode, &a.Country,
+			fieldcrypt.Scan(fieldcrypt.PersonEmail, &a.Email),
+			fieldcrypt.Scan(fieldcrypt.PersonPhoneNumber, &a.PhoneNumber),
+			&a.Pronouns, &a.Sex, &a.Gender,
+			fieldcrypt.Scan(fieldcrypt.PersonBirthday, &a.Birthday),
+			fieldcrypt.Scan(fieldcrypt.PersonAddress, &a.Address),
+			&a.City, &a.State, &a.ZipCode, &a.Country,
 			&a.Title,
 		); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse admins")
 			log.Println("Row scan error:", err)
 			return
 		}
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(a); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		// Adds the obtained data to the slice
 		admins = append(admins, a)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -87,27 +123,8 @@ func GetAdminByID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// All data being selected for this GET command
-	query := `
-		SELECT
-			a.admin_id, p.first_name, p.preferred_name, p.middle_name, p.last_name,
-			p.email, p.phone_number, p.pronouns, p.sex, p.gender,
-			p.birthday, p.address, p.city, p.state, p.zip_code, p.country, a.title
-		FROM admin a
-		JOIN person p ON a.admin_id = p.person_id
-		WHERE a.admin_id = ?
-	`
-
-	// Empty variable for admin struct
-	var a models.Admin
-
-	// Executes written SQL and retrieves only one row
-	err = db.QueryRowContext(r.Context(), query, adminID).Scan(
-		&a.AdminID, &a.FirstName, &a.PreferredName, &a.MiddleName, &a.LastName,
-		&a.Email, &a.PhoneNumber, &a.Pronouns, &a.Sex, &a.Gender,
-		&a.Birthday, &a.Address, &a.City, &a.State, &a.ZipCode, &a.Country,
-		&a.Title,
-	)
+	// Fetches the admin from the database
+	a, version, err := fetchAdmin(r.Context(), db, adminID)
 
 	// Error message if no rows are found
 	if err == sql.ErrNoRows {
@@ -120,7 +137,8 @@ func GetAdminByID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Writes the struct as JSON & sends a HTTP 200 response code
+	// Writes the struct as JSON with the row version as ETag & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(adminID, version))
 	utils.WriteJSON(w, http.StatusOK, a)
 }
 
@@ -163,14 +181,23 @@ func CreateAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		`INSERT INTO person (
 		first_name, preferred_name, middle_name, last_name,
 		email, phone_number, pronouns, sex, gender,
-		birthday, address, city, state, zip_code, country
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		birthday, address, city, state, zip_code, country, email_index
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		a.FirstName, a.PreferredName, a.MiddleName, a.LastName,
-		a.Email, a.PhoneNumber, a.Pronouns, a.Sex, a.Gender,
-		a.Birthday, a.Address, a.City, a.State, a.ZipCode, a.Country,
+		fieldcrypt.Value(fieldcrypt.PersonEmail, a.Email),
+		fieldcrypt.Value(fieldcrypt.PersonPhoneNumber, a.PhoneNumber),
+		a.Pronouns, a.Sex, a.Gender,
+		fieldcrypt.Value(fieldcrypt.PersonBirthday, a.Birthday),
+		fieldcrypt.Value(fieldcrypt.PersonAddress, a.Address),
+		a.City, a.State, a.ZipCode, a.Country,
+		fieldcrypt.BlindIndex(fieldcrypt.PersonEmail, a.Email),
 	)
 
 	// Error message if ExecContext fails
+	if utils.IsDuplicateEntry(err) {
+		utils.WriteError(w, http.StatusConflict, "Email is already used by another person")
+		return
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to insert into person")
 		log.Println("DB insert error:", err)
@@ -265,9 +292,7 @@ func UpdateAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validates required fields
-	if a.FirstName == "" || a.LastName == "" || a.Email == "" || a.PhoneNumber == "" ||
-		a.Sex == "" || a.Birthday == "" || a.Address == "" || a.City == "" ||
-		a.Country == "" || a.Title == "" {
+	if missingAdminFields(a) {
 		utils.WriteError(w, http.StatusBadRequest, "Missing required fields")
 		return
 	}
@@ -281,53 +306,150 @@ func UpdateAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	// Executes written SQL to update the person data
-	_, err = tx.ExecContext(r.Context(),
-		`UPDATE person SET
-			first_name=?, preferred_name=?, middle_name=?, last_name=?,
-			email=?, phone_number=?, pronouns=?, sex=?, gender=?,
-			birthday=?, address=?, city=?, state=?, zip_code=?, country=?
-		WHERE person_id=?`,
-		a.FirstName, a.PreferredName, a.MiddleName, a.LastName,
-		a.Email, a.PhoneNumber, a.Pronouns, a.Sex, a.Gender,
-		a.Birthday, a.Address, a.City, a.State, a.ZipCode, a.Country,
-		adminID,
-	)
+	// Locks the admin row, keeps its current state for the history and checks the If-Match precondition
+	before, version, err := fetchAdmin(r.Context(), tx, adminID)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "Admin not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch admin")
+		log.Println("DB query error:", err)
+		return
+	}
+	if !utils.CheckIfMatch(w, r, utils.ETag(adminID, version)) {
+		return
+	}
 
-	// Error message if ExecContext fails
+	// Updates the person and admin rows
+	rowsAffected, err := updateAdminRows(r.Context(), tx, adminID, a)
+
+	// Error message if the update fails
+	if utils.IsDuplicateEntry(err) {
+		utils.WriteError(w, http.StatusConflict, "Email is already used by another person")
+		return
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to update admin")
 		log.Println("DB update error:", err)
 		return
 	}
 
-	// Executes written SQL to update the admin title
-	res, err := tx.ExecContext(r.Context(),
-		"UPDATE admin SET title=? WHERE admin_id=?",
-		a.Title, adminID,
-	)
+	// Error message if no rows were updated
+	if rowsAffected == 0 {
+		utils.WriteError(w, http.StatusNotFound, "Admin not found")
+		return
+	}
 
-	// Error message if ExecContext fails
+	// Saves the new version to the profile history
+	a.AdminID = adminID
+	if err := history.Record(r.Context(), tx, history.ProfileAdmin, adminID, version, before, a, r.Context().Value(utils.UserIDKey), nil); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to record admin history")
+		log.Println("DB insert error:", err)
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
+		log.Println("Transaction commit error:", err)
+		return
+	}
+
+	// Writes JSON response confirming update & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(adminID, version+1))
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Admin updated successfully",
+	})
+}
+
+func PatchAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts path variables from the request
+	vars := mux.Vars(r)
+	idStr, ok := vars["admin_id"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, "Missing admin ID")
+		return
+	}
+
+	// Converts the "admin_id" string to an integer
+	adminID, err := strconv.Atoi(idStr)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to update admin title")
-		log.Println("DB update error:", err)
+		utils.WriteError(w, http.StatusBadRequest, "Invalid admin ID")
+		log.Println("Invalid ID parse error:", err)
 		return
 	}
 
-	// Gets the number of rows affected by the update
-	rowsAffected, err := res.RowsAffected()
+	// Reads the JSON Merge Patch document from the request
+	patch, err := utils.ReadMergePatch(r)
+	if err == utils.ErrUnsupportedPatchType {
+		utils.WriteError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/merge-patch+json")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		log.Println("JSON decode error:", err)
+		return
+	}
 
-	// Error message if RowsAffected fails
+	// Start transaction
+	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to get rows affected")
-		log.Println("RowsAffected error:", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
+		log.Println("BeginTx error:", err)
 		return
 	}
+	defer tx.Rollback()
 
-	// Error message if no rows were updated
-	if rowsAffected == 0 {
+	// Loads the current admin to merge the patch into
+	current, version, err := fetchAdmin(r.Context(), tx, adminID)
+	if err == sql.ErrNoRows {
 		utils.WriteError(w, http.StatusNotFound, "Admin not found")
 		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch admin")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Checks the If-Match precondition against the locked row
+	if !utils.CheckIfMatch(w, r, utils.ETag(adminID, version)) {
+		return
+	}
+
+	// Applies the patch on top of the current admin
+	var a models.Admin
+	if err := utils.ApplyMergePatch(current, patch, &a); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid patch document")
+		log.Println("Merge patch error:", err)
+		return
+	}
+
+	// The admin ID cannot be changed
+	if a.AdminID != adminID {
+		utils.WriteError(w, http.StatusBadRequest, "admin_id cannot be modified")
+		return
+	}
+
+	// Validates required fields on the merged result
+	if missingAdminFields(a) {
+		utils.WriteError(w, http.StatusBadRequest, "Missing required fields")
+		return
+	}
+
+	// Updates the person and admin rows
+	if _, err := updateAdminRows(r.Context(), tx, adminID, a); utils.IsDuplicateEntry(err) {
+		utils.WriteError(w, http.StatusConflict, "Email is already used by another person")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update admin")
+		log.Println("DB update error:", err)
+		return
+	}
+
+	// Saves the new version to the profile history
+	if err := history.Record(r.Context(), tx, history.ProfileAdmin, adminID, version, current, a, r.Context().Value(utils.UserIDKey), nil); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to record admin history")
+		log.Println("DB insert error:", err)
+		return
 	}
 
 	// Commit transaction
@@ -337,10 +459,9 @@ func UpdateAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Writes JSON response confirming update & sends a HTTP 200 response code
-	utils.WriteJSON(w, http.StatusOK, map[string]string{
-		"message": "Admin updated successfully",
-	})
+	// Writes the patched admin as JSON & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(adminID, version+1))
+	utils.WriteJSON(w, http.StatusOK, a)
 }
 
 func DeleteAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
@@ -369,17 +490,30 @@ func DeleteAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	// Multi-table delete query:
-	// Deletes from admin and person in one go
+	// Locks the admin row and checks the If-Match precondition
+	version, err := utils.LockLiveVersion(r.Context(), tx, "admin", "admin_id", "person", "person_id", adminID)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "No admin found for this ID")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch admin")
+		log.Println("DB query error:", err)
+		return
+	}
+	if !utils.CheckIfMatch(w, r, utils.ETag(adminID, version)) {
+		return
+	}
+
+	// Soft delete query:
+	// Moves the admin to the trash, the purger removes it after the retention window
 	query := `
-		DELETE a, u, p
-		FROM admin a
-		JOIN users u ON u.id = a.admin_id
-		JOIN person p ON p.person_id = a.admin_id
-		WHERE a.admin_id = ?;
+		UPDATE person p
+		JOIN admin a ON a.admin_id = p.person_id
+		SET p.deleted_at = NOW(), p.deleted_by = ?
+		WHERE a.admin_id = ? AND p.deleted_at IS NULL;
 	`
-	// Executes written SQL to delete the admin
-	res, err := tx.ExecContext(r.Context(), query, adminID)
+	// Executes written SQL to trash the admin
+	res, err := tx.ExecContext(r.Context(), query, r.Context().Value(utils.UserIDKey), adminID)
 
 	// Error message if ExecContext fails
 	if err != nil {
@@ -413,7 +547,87 @@ func DeleteAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 
 	// Respond with success
 	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"message":       "Admin " + idStr + " deleted successfully",
-		"rows_affected": rowsAffected / 3, // Each admin involves 3 rows deleted
+		"message":       "Admin " + idStr + " moved to trash",
+		"rows_affected": rowsAffected,
 	})
 }
+
+// fetchAdmin loads a single admin joined with its person row and returns its row version.
+// The admin row is locked when called inside a transaction.
+func fetchAdmin(ctx context.Context, q utils.DBTX, adminID int) (models.Admin, int, error) {
+	// All data being selected for this GET command
+	query := `
+		SELECT
+			a.admin_id, p.first_name, p.preferred_name, p.middle_name, p.last_name,
+			p.email, p.phone_number, p.pronouns, p.sex, p.gender,
+			p.birthday, p.address, p.city, p.state, p.zip_code, p.country, a.title, a.version
+		FROM admin a
+		JOIN person p ON a.admin_id = p.person_id
+		WHERE a.admin_id = ? AND p.deleted_at IS NULL
+	`
+	if _, ok := q.(*sql.Tx); ok {
+		query += " FOR UPDATE"
+	}
+
+	// Empty variables for admin struct and row version
+	var a models.Admin
+	var version int
+
+	// Executes written SQL and retrieves only one row
+	err := q.QueryRowContext(ctx, query, adminID).Scan(
+		&a.AdminID, &a.FirstName, &a.PreferredName, &a.MiddleName, &a.LastName,
+		fieldcrypt.Scan(fieldcrypt.PersonEmail, &a.Email),
+		fieldcrypt.Scan(fieldcrypt.PersonPhoneNumber, &a.PhoneNumber),
+		&a.Pronouns, &a.Sex, &a.Gender,
+		fieldcrypt.Scan(fieldcrypt.PersonBirthday, &a.Birthday),
+		fieldcrypt.Scan(fieldcrypt.PersonAddress, &a.Address),
+		&a.City, &a.State, &a.ZipCode, &a.Country,
+		&a.Title, &version,
+	)
+
+	return a, version, err
+}
+
+// missingAdminFields reports whether any required admin field is empty
+func missingAdminFields(a models.Admin) bool {
+	return a.FirstName == "" || a.LastName == "" || a.Email == "" || a.PhoneNumber == "" ||
+		a.Sex == "" || a.Birthday == "" || a.Address == "" || a.City == "" ||
+		a.Country == "" || a.Title == ""
+}
+
+// updateAdminRows writes an admin to the person and admin tables, bumps its row version
+// and returns the admin rows affected
+func updateAdminRows(ctx context.Context, tx *sql.Tx, adminID int, a models.Admin) (int64, error) {
+	// Executes written SQL to update the person data
+	_, err := tx.ExecContext(ctx,
+		`UPDATE person SET
+			first_name=?, preferred_name=?, middle_name=?, last_name=?,
+			email=?, phone_number=?, pronouns=?, sex=?, gender=?,
+			birthday=?, address=?, city=?, state=?, zip_code=?, country=?, email_index=?
+		WHERE person_id=?`,
+		a.FirstName, a.PreferredName, a.MiddleName, a.LastName,
+		fieldcrypt.Value(fieldcrypt.PersonEmail, a.Email),
+		fieldcrypt.Value(fieldcrypt.PersonPhoneNumber, a.PhoneNumber),
+		a.Pronouns, a.Sex, a.Gender,
+		fieldcrypt.Value(fieldcrypt.PersonBirthday, a.Birthday),
+		fieldcrypt.Value(fieldcrypt.PersonAddress, a.Address),
+		a.City, a.State, a.ZipCode, a.Country,
+		fieldcrypt.BlindIndex(fieldcrypt.PersonEmail, a.Email),
+		adminID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	// Executes written SQL to update the admin title
+	res, err := tx.ExecContext(ctx,
+		"UPDATE admin SET title=?, version=version+1 WHERE admin_id=?",
+		a.Title, adminID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	// Gets the number of rows affected by the update
+	return res.RowsAffected()
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/audit"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+func GetAuditLog(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts optional query parameters from the request
+	q := r.URL.Query()
+	filter := audit.Filter{
+		Role:         q.Get("role"),
+		Action:       q.Get("action"),
+		ResourceType: q.Get("resource_type"),
+		ResourceID:   q.Get("resource_id"),
+		RequestID:    q.Get("request_id"),
+	}
+
+	// Optional actor filter
+	if actorStr := q.Get("actor_id"); actorStr != "" {
+		actorID, err := strconv.Atoi(actorStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid actor ID")
+			log.Println("Invalid ID parse error:", err)
+			return
+		}
+		filter.ActorID = &actorID
+	}
+
+	// Optional time range, accepts RFC 3339 timestamps or YYYY-MM-DD dates
+	for _, bound := range []struct {
+		param string
+		dst   *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := q.Get(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t, err = time.Parse("2006-01-02", value)
+		}
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid "+bound.param+" (expected RFC 3339 or YYYY-MM-DD)")
+			log.Println("Date parse error:", err)
+			return
+		}
+		*bound.dst = t
+	}
+
+	// Optional paging
+	for _, page := range []struct {
+		param string
+		dst   *int
+	}{{"limit", &filter.Limit}, {"offset", &filter.Offset}} {
+		value := q.Get(page.param)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid "+page.param)
+			return
+		}
+		*page.dst = n
+	}
+
+	// Lists matching audit entries
+	entries, err := audit.List(r.Context(), db, filter)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to obtain audit log")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Writes the entries as JSON & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, entries)
+}
+
+func VerifyAuditLog(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Recomputes the hash chain from the first entry
+	brokenID, checked, err := audit.Verify(r.Context(), db)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to verify audit log")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Reports the first entry that does not match its hash or predecessor
+	if brokenID != 0 {
+		utils.WriteJSON(w, http.StatusConflict, map[string]interface{}{
+			"valid":           false,
+			"first_broken_id": brokenID,
+			"entries_checked": checked,
+		})
+		return
+	}
+
+	// Writes the result as JSON & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"valid":           true,
+		"entries_checked": checked,
+	})
+}
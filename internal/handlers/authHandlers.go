@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/invite"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 	"golang.org/x/crypto/bcrypt"
@@ -35,12 +37,13 @@ func LoginHandler(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	var userID int
 	var passwordHash, role string
 
-	// Look up user by email in users + person tables
+	// Look up user by email in users + person tables, the email is matched through its blind index
+	emailMatch, args := fieldcrypt.EmailMatch("p", req.Email)
 	err := db.QueryRow(`
 		SELECT u.id, u.password_hash, u.role
 		FROM users u
 		JOIN person p ON p.person_id = u.id
-		WHERE p.email = ?`, req.Email,
+		WHERE `+emailMatch+` AND p.deleted_at IS NULL`, args...,
 	).Scan(&userID, &passwordHash, &role)
 
 	// Return unauthorized if not found
@@ -150,14 +153,23 @@ func SignupStudentHandler(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		`INSERT INTO person (
 			first_name, preferred_name, middle_name, last_name, email,
 			phone_number, pronouns, sex, gender, birthday,
-			address, city, state, zip_code, country
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			address, city, state, zip_code, country, email_index
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		s.FirstName, s.PreferredName, s.MiddleName, s.LastName,
-		s.Email, s.PhoneNumber, s.Pronouns, s.Sex, s.Gender, s.Birthday,
-		s.Address, s.City, s.State, s.ZipCode, s.Country,
+		fieldcrypt.Value(fieldcrypt.PersonEmail, s.Email),
+		fieldcrypt.Value(fieldcrypt.PersonPhoneNumber, s.PhoneNumber),
+		s.Pronouns, s.Sex, s.Gender,
+		fieldcrypt.Value(fieldcrypt.PersonBirthday, s.Birthday),
+		fieldcrypt.Value(fieldcrypt.PersonAddress, s.Address),
+		s.City, s.State, s.ZipCode, s.Country,
+		fieldcrypt.BlindIndex(fieldcrypt.PersonEmail, s.Email),
 	)
 
 	// Error message if ExecContext fails
+	if utils.IsDuplicateEntry(err) {
+		utils.WriteError(w, http.StatusConflict, "Email is already used by another person")
+		return
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to insert into person")
 		log.Println("DB insert error:", err)
@@ -213,3 +225,44 @@ func SignupStudentHandler(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		"studentId": lastID,
 	})
 }
+
+func AcceptInviteHandler(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Local struct for request
+	type AcceptInviteRequest struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	// Decodes JSON body from the request into "req" variable
+	var req AcceptInviteRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields() // Prevents extra unexpected fields
+	if err := decoder.Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		log.Println("JSON decode error:", err)
+		return
+	}
+
+	// Validates required fields
+	if req.Token == "" || req.Password == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Missing required fields")
+		return
+	}
+
+	// Sets the password and marks the invite as used
+	userID, err := invite.Accept(r.Context(), db, req.Token, req.Password)
+	if err == invite.ErrInvalidToken {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid or expired invite")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to accept invite")
+		log.Println("DB update error:", err)
+		return
+	}
+
+	// Writes JSON response confirming the login is active & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Invite accepted, you can now log in",
+		"id":      userID,
+	})
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/audit"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// txHandler is a write handler that runs inside a transaction owned by its caller
+type txHandler func(tx *sql.Tx, w http.ResponseWriter, r *http.Request)
+
+// batchOperation is an operation that /batch can run, keyed by "METHOD /path" in batchOperations
+type batchOperation struct {
+	// resourceType is the audit resource type the REST route records
+	resourceType string
+	run          txHandler
+}
+
+// batchOperations lists the operations that can be combined in one /batch transaction
+var batchOperations = map[string]batchOperation{
+	"POST /pinned":      {"pinned", createPinned},
+	"DELETE /pinned":    {"pinned", deletePinned},
+	"POST /stu-accom":   {"stu_accom", createStuAccom},
+	"DELETE /stu-accom": {"stu_accom", deleteStuAccom},
+	"POST /stu-dis":     {"stu_dis", createStuDis},
+	"DELETE /stu-dis":   {"stu_dis", deleteStuDis},
+	"POST /poc-admin":   {"poc_admin", createPocAdmin},
+	"DELETE /poc-admin": {"poc_admin", deletePocAdmin},
+}
+
+// maxBatchOperations bounds how many operations one transaction may hold
+const maxBatchOperations = 100
+
+// BatchRequest is the body of POST /batch
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchOperation is one REST call of a batch, the path may carry a query string
+type BatchOperation struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// BatchResult is the response one operation would have received on its own
+type BatchResult struct {
+	Index  int             `json:"index"`
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// BatchResponse lists the results in operation order; when an operation fails the batch is rolled back
+// and the results stop at the failed operation
+type BatchResponse struct {
+	Committed   bool          `json:"committed"`
+	FailedIndex *int          `json:"failed_index,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	Results     []BatchResult `json:"results"`
+}
+
+func Batch(db *sql.DB, router *mux.Router, w http.ResponseWriter, r *http.Request) {
+	// Decodes JSON body from the request into "req" variable
+	var req BatchRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields() // Prevents extra unexpected fields
+	if err := decoder.Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		log.Println("JSON decode error:", err)
+		return
+	}
+
+	// Validates the operation list
+	if len(req.Operations) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Missing operations")
+		return
+	}
+	if len(req.Operations) > maxBatchOperations {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("At most %d operations per batch", maxBatchOperations))
+		return
+	}
+
+	// Builds each operation's request and checks it against its own route before anything runs
+	type prepared struct {
+		op      batchOperation
+		request *http.Request
+		body    []byte
+	}
+	ops := make([]prepared, len(req.Operations))
+	role, _ := r.Context().Value(utils.RoleKey).(string)
+	for i, op := range req.Operations {
+		sub, err := http.NewRequestWithContext(r.Context(), strings.ToUpper(op.Method), op.Path, bytes.NewReader(op.Body))
+		if err != nil || !strings.HasPrefix(op.Path, "/") {
+			writeBatchFailure(w, http.StatusBadRequest, i, "Invalid operation method or path", nil)
+			return
+		}
+		if len(op.Body) > 0 {
+			sub.Header.Set("Content-Type", "application/json")
+		}
+
+		// Same role table as calling the route directly
+		var match mux.RouteMatch
+		if !router.Match(sub, &match) || match.Route == nil {
+			writeBatchFailure(w, http.StatusNotFound, i, "No route for "+sub.Method+" "+sub.URL.Path, nil)
+			return
+		}
+		roles, ok := match.Route.GetHandler().(*utils.RoleHandler)
+		if !ok || !roles.Allows(role, sub.Method) {
+			writeBatchFailure(w, http.StatusForbidden, i, "Forbidden: insufficient role", nil)
+			return
+		}
+
+		template, _ := match.Route.GetPathTemplate()
+		batchOp, ok := batchOperations[sub.Method+" "+template]
+		if !ok {
+			writeBatchFailure(w, http.StatusBadRequest, i, sub.Method+" "+template+" cannot be used in a batch", nil)
+			return
+		}
+		ops[i] = prepared{op: batchOp, request: mux.SetURLVars(sub, match.Vars), body: op.Body}
+	}
+
+	// Start transaction
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
+		log.Println("BeginTx error:", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Runs the operations in order and stops at the first one that fails
+	results := make([]BatchResult, 0, len(ops))
+	for i, p := range ops {
+		rec := newBufferedResponse()
+		p.op.run(tx, rec, p.request)
+		results = append(results, BatchResult{Index: i, Status: rec.status, Body: rec.jsonBody()})
+
+		if rec.status < 200 || rec.status > 299 {
+			writeBatchFailure(w, rec.status, i, fmt.Sprintf("Operation %d failed, no operation was applied", i), results)
+			return
+		}
+	}
+
+	// Records every operation in the audit log, in the same transaction so the log and the changes commit together
+	for _, p := range ops {
+		if err := audit.AppendRequest(tx, p.request, audit.RelationshipEntry(p.request, p.op.resourceType, p.body)); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to write audit log, no operation was applied")
+			return
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
+		log.Println("Transaction commit error:", err)
+		return
+	}
+
+	// Writes JSON response & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, BatchResponse{Committed: true, Results: results})
+}
+
+// writeBatchFailure answers with the failing operation's status so clients can branch on it like on a single call
+func writeBatchFailure(w http.ResponseWriter, status, index int, message string, results []BatchResult) {
+	if results == nil {
+		results = []BatchResult{}
+	}
+	utils.WriteJSON(w, status, BatchResponse{FailedIndex: &index, Error: message, Results: results})
+}
+
+// runInTx runs a write handler in its own transaction and commits when it answered with a 2xx status.
+// The response is held back until the commit so a failed commit still answers with an error.
+func runInTx(db *sql.DB, w http.ResponseWriter, r *http.Request, handler txHandler) {
+	// Start transaction
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
+		log.Println("BeginTx error:", err)
+		return
+	}
+	defer tx.Rollback()
+
+	rec := newBufferedResponse()
+	handler(tx, rec, r)
+
+	// Commit transaction
+	if rec.status >= 200 && rec.status <= 299 {
+		if err := tx.Commit(); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
+			log.Println("Transaction commit error:", err)
+			return
+		}
+	}
+	rec.writeTo(w)
+}
+
+// bufferedResponse holds a handler's response until its transaction is settled
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponse) WriteHeader(status int)      { b.status = status }
+
+// jsonBody returns the compacted body, or nil when it is not JSON
+func (b *bufferedResponse) jsonBody() json.RawMessage {
+	var out bytes.Buffer
+	if json.Compact(&out, b.body.Bytes()) != nil {
+		return nil
+	}
+	return out.Bytes()
+}
+
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for name, values := range b.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/disabilitylink"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/export"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 
@@ -26,6 +28,13 @@ func GetDisabilities(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "disabilities", models.Disability{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	disabilities := make([]models.Disability, 0)
 
@@ -34,15 +43,35 @@ func GetDisabilities(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		var d models.Disability
 		// Parses the current data into fields of "d" variable
 		if err := rows.Scan(&d.DisabilityID, &d.Name, &d.Description); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse disabilities")
 			log.Println("Row scan error:", err)
 			return
 		}
 
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(d); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		// Adds the obtained data to the slice
 		disabilities = append(disabilities, d)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -118,21 +147,26 @@ func GetDisabilitiesByStudentID(db *sql.DB, w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Reads the student's links first, sealed links cannot be joined to disability
+	links, err := disabilitylink.ForStudents(r.Context(), db, studentID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to obtain disabilities for student")
+		log.Println("DB query error:", err)
+		return
+	}
+	has := make(map[int]bool, len(links))
+	for _, link := range links {
+		has[link.DisabilityID] = true
+	}
+
 	// All data being selected for this GET command
 	query := `
-		SELECT 
-    		d.disability_id,
-    		d.name,
-    		d.description,
-    		CASE WHEN sd.student_id IS NULL THEN FALSE ELSE TRUE END AS has_disability
-		FROM disability d
-		LEFT JOIN stu_dis sd
-    		ON d.disability_id = sd.disability_id
-    		AND sd.student_id = ?
+		SELECT disability_id, name, description
+		FROM disability
 	`
 
 	// Executes written SQL
-	rows, err := db.QueryContext(r.Context(), query, studentID)
+	rows, err := db.QueryContext(r.Context(), query)
 
 	// Error message if QueryContext fails
 	if err != nil {
@@ -142,6 +176,13 @@ func GetDisabilitiesByStudentID(db *sql.DB, w http.ResponseWriter, r *http.Reque
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "student_disabilities", DisabilityWithBoolean{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	disabilities := make([]DisabilityWithBoolean, 0)
 
@@ -149,16 +190,37 @@ func GetDisabilitiesByStudentID(db *sql.DB, w http.ResponseWriter, r *http.Reque
 	for rows.Next() {
 		var d DisabilityWithBoolean
 		// Parses the current data into fields of "d" variable
-		if err := rows.Scan(&d.DisabilityID, &d.Name, &d.Description, &d.HasDisability); err != nil {
+		if err := rows.Scan(&d.DisabilityID, &d.Name, &d.Description); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse disabilities")
 			log.Println("Row scan error:", err)
 			return
 		}
+		d.HasDisability = has[d.DisabilityID]
+
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(d); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
 
 		// Adds the obtained data to the slice
 		disabilities = append(disabilities, d)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -301,8 +363,24 @@ func DeleteDisability(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Begins a transaction so the disability and its links go together
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
+		log.Println("BeginTx error:", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Deletes the links of students to the disability, the foreign key from stu_dis only covers plaintext links
+	if _, err := disabilitylink.Delete(r.Context(), tx, 0, disabilityID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete disability")
+		log.Println("DB delete error:", err)
+		return
+	}
+
 	// Executes written SQL to delete the disability
-	res, err := db.ExecContext(r.Context(), "DELETE FROM disability WHERE disability_id = ?", disabilityID)
+	res, err := tx.ExecContext(r.Context(), "DELETE FROM disability WHERE disability_id = ?", disabilityID)
 
 	// Error message if ExecContext fails
 	if err != nil {
@@ -327,6 +405,13 @@ func DeleteDisability(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Commits the transaction
+	if err := tx.Commit(); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
+		log.Println("Commit error:", err)
+		return
+	}
+
 	// Writes JSON response confirming deletion & sends a HTTP 200 response code
 	utils.WriteJSON(w, http.StatusOK, map[string]string{
 		"message": "Disability deleted successfully",
@@ -1,13 +1,26 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/docstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/export"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/filecrypt"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/scanner"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/uploadpolicy"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/webhook"
 
 	"github.com/gorilla/mux"
 )
@@ -19,12 +32,13 @@ func GetDocumentations(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 			d.documentation_id,
 			a.activity_datetime,
 			d.file_name,
-			d.file_path,
+			d.storage_key,
 			d.mime_type,
 			d.size_bytes,
 			d.uploaded_by
 		FROM documentation d
 		JOIN activity a ON d.documentation_id = a.activity_id
+		WHERE d.deleted_at IS NULL
 	`
 
 	// Executes written SQL
@@ -38,6 +52,13 @@ func GetDocumentations(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "documentation", models.Documentation{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	documentations := make([]models.Documentation, 0)
 
@@ -49,20 +70,40 @@ func GetDocumentations(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 			&d.DocumentationID,
 			&d.ActivityDateTime,
 			&d.FileName,
-			&d.FilePath,
+			&d.StorageKey,
 			&d.MimeType,
 			&d.SizeBytes,
 			&d.UploadedBy,
 		); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse documentations")
 			log.Println("Row scan error:", err)
 			return
 		}
 
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(d); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		// Adds the obtained data to the slice
 		documentations = append(documentations, d)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -97,13 +138,13 @@ func GetDocumentationByID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 			d.documentation_id,
 			a.activity_datetime,
 			d.file_name,
-			d.file_path,
+			d.storage_key,
 			d.mime_type,
 			d.size_bytes,
 			d.uploaded_by
 		FROM documentation d
 		JOIN activity a ON d.documentation_id = a.activity_id
-		WHERE d.documentation_id = ?
+		WHERE d.documentation_id = ? AND d.deleted_at IS NULL
 	`
 
 	// Empty variable for documentation struct
@@ -114,7 +155,7 @@ func GetDocumentationByID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		&d.DocumentationID,
 		&d.ActivityDateTime,
 		&d.FileName,
-		&d.FilePath,
+		&d.StorageKey,
 		&d.MimeType,
 		&d.SizeBytes,
 		&d.UploadedBy,
@@ -134,3 +175,231 @@ func GetDocumentationByID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	// Writes the struct as JSON & sends a HTTP 200 response code
 	utils.WriteJSON(w, http.StatusOK, d)
 }
+
+// documentDeletionQueries select the live documents about to be trashed as (documentation_id, owner_id),
+// keyed by kind and then by the column the delete filters on
+var documentDeletionQueries = map[string]map[string]string{
+	"specific": {
+		"specific_documentation_id": `
+			SELECT sd.specific_documentation_id, sd.student_id
+			FROM specific_documentation sd
+			JOIN documentation d ON d.documentation_id = sd.specific_documentation_id
+			WHERE sd.specific_documentation_id = ? AND d.deleted_at IS NULL`,
+		"student_id": `
+			SELECT sd.specific_documentation_id, sd.student_id
+			FROM specific_documentation sd
+			JOIN documentation d ON d.documentation_id = sd.specific_documentation_id
+			WHERE sd.student_id = ? AND d.deleted_at IS NULL`,
+	},
+	"personal": {
+		"personal_documentation_id": `
+			SELECT pd.personal_documentation_id, pd.admin_id
+			FROM personal_documentation pd
+			JOIN documentation d ON d.documentation_id = pd.personal_documentation_id
+			WHERE pd.personal_documentation_id = ? AND d.deleted_at IS NULL`,
+		"admin_id": `
+			SELECT pd.personal_documentation_id, pd.admin_id
+			FROM personal_documentation pd
+			JOIN documentation d ON d.documentation_id = pd.personal_documentation_id
+			WHERE pd.admin_id = ? AND d.deleted_at IS NULL`,
+	},
+}
+
+// queueDocumentDeletions queues a document.deleted webhook event for every live document a delete is about to trash.
+// It must run in the delete's transaction before the documents are marked deleted.
+func queueDocumentDeletions(ctx context.Context, tx *sql.Tx, kind, column string, id int) error {
+	ownerKey := "student_id"
+	if kind == "personal" {
+		ownerKey = "admin_id"
+	}
+
+	rows, err := tx.QueryContext(ctx, documentDeletionQueries[kind][column]+" FOR UPDATE", id)
+	if err != nil {
+		return err
+	}
+	var events []map[string]interface{}
+	for rows.Next() {
+		var documentationID, ownerID int
+		if err := rows.Scan(&documentationID, &ownerID); err != nil {
+			rows.Close()
+			return err
+		}
+		events = append(events, map[string]interface{}{
+			"documentation_id": documentationID,
+			"kind":             kind,
+			ownerKey:           ownerID,
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if err := webhook.Enqueue(ctx, tx, webhook.EventDocumentDeleted, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeUploadError answers an upload the policy refused with its error code, anything else with
+// status and message
+func writeUploadError(w http.ResponseWriter, err error, status int, message string) {
+	var rejected *uploadpolicy.Rejection
+	if errors.As(err, &rejected) {
+		utils.WriteErrorCode(w, rejected.Status, rejected.Code, rejected.Message)
+		return
+	}
+	utils.WriteError(w, status, message)
+}
+
+// documentScan is the malware scan of an upload as it is recorded in its documentation row
+type documentScan struct {
+	Status    string
+	Signature sql.NullString
+	ScannedAt sql.NullTime
+}
+
+// scanDocument runs the configured scanner over an upload and rewinds it. Uploads stay unscanned
+// while scanning is disabled; a scanner failure is recorded as an error, which keeps the file from
+// being downloaded until a rescan clears it.
+func scanDocument(ctx context.Context, file multipart.File) (documentScan, error) {
+	s, err := scanner.Default()
+	if errors.Is(err, scanner.ErrDisabled) {
+		return documentScan{Status: scanner.StatusUnscanned}, nil
+	}
+	if err != nil {
+		return documentScan{}, err
+	}
+
+	scan := documentScan{ScannedAt: sql.NullTime{Time: time.Now(), Valid: true}}
+	result, err := s.Scan(ctx, file)
+	switch {
+	case err != nil:
+		scan.Status = scanner.StatusError
+		log.Println("Malware scan error:", err)
+	case result.Infected:
+		scan.Status = scanner.StatusInfected
+		scan.Signature = sql.NullString{String: result.Signature, Valid: true}
+	default:
+		scan.Status = scanner.StatusClean
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return documentScan{}, err
+	}
+	return scan, nil
+}
+
+// uploadEvent is the webhook event of an upload. Infected uploads are announced as quarantined,
+// so subscribers acting on new documents never pick up a file that cannot be downloaded.
+func uploadEvent(scan documentScan) string {
+	if scan.Status == scanner.StatusInfected {
+		return webhook.EventDocumentQuarantined
+	}
+	return webhook.EventDocumentUploaded
+}
+
+// storeDocument saves an uploaded file in the document store under the digest of its content,
+// sharing the blob of an identical earlier upload, and records the blob in tx. Infected files are
+// stored in quarantine instead, together with any identical blob that was already stored.
+func storeDocument(ctx context.Context, db *sql.DB, tx *sql.Tx, file multipart.File, header *multipart.FileHeader, scan documentScan) (docstore.Stored, error) {
+	store, err := blobstore.Default()
+	if err != nil {
+		return docstore.Stored{}, err
+	}
+	if scan.Status == scanner.StatusInfected {
+		return docstore.PutQuarantined(ctx, db, store, file, header.Size, scan.Signature.String)
+	}
+	return docstore.Put(ctx, tx, store, file, header.Size)
+}
+
+// discardDocument deletes the file stored for an upload whose transaction did not commit. The
+// transaction is rolled back first because it holds the blob row lock the cleanup takes.
+func discardDocument(db *sql.DB, tx *sql.Tx, stored docstore.Stored) {
+	tx.Rollback()
+	store, err := blobstore.Default()
+	if err == nil {
+		err = docstore.Discard(context.Background(), db, store, stored)
+	}
+	if err != nil {
+		log.Println("Warning: failed to delete the file of an aborted upload:", err)
+	}
+}
+
+// serveDocument streams a stored document, decrypting it when it is encrypted and checking it
+// against its digest when one is recorded, except for presigned redirects which the server does
+// not stream. Range requests are answered from the decrypted content.
+// Quarantined files and files whose scan failed are never served.
+func serveDocument(w http.ResponseWriter, r *http.Request, key, digest, scanStatus, fileName, mimeType string) {
+	if scanStatus == scanner.StatusInfected || docstore.Quarantined(key) {
+		utils.WriteErrorCode(w, http.StatusForbidden, scanner.CodeQuarantined, "File was found infected and is quarantined")
+		return
+	}
+	if !scanner.Downloadable(scanStatus) {
+		utils.WriteErrorCode(w, http.StatusConflict, scanner.CodeScanFailed, "File could not be scanned for malware yet and is held back until a rescan")
+		return
+	}
+
+	store, err := blobstore.Default()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Document storage is not configured")
+		log.Println("Blob store error:", err)
+		return
+	}
+	disposition := fmt.Sprintf("attachment; filename=%q", fileName)
+
+	// Sends the client straight to the bucket when files are stored as uploaded. The server never
+	// sees those bytes, so presigned downloads skip the digest check and trust the bucket's content.
+	if !filecrypt.Enabled() && utils.Env("DOCUMENT_PRESIGNED_DOWNLOADS", "false") == "true" {
+		url, err := store.Presign(r.Context(), http.MethodGet, key, utils.EnvDuration("DOCUMENT_PRESIGN_EXPIRY", 5*time.Minute),
+			blobstore.PresignOptions{ContentType: mimeType, ContentDisposition: disposition})
+		if err == nil {
+			http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+			return
+		}
+		if err != blobstore.ErrPresignUnsupported {
+			log.Println("Presign error:", err)
+		}
+	}
+
+	// Opens the stored object, which is decrypted as it streams when it is stored encrypted
+	obj, err := store.Get(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			utils.WriteError(w, http.StatusNotFound, "File not found on server")
+			log.Println("Missing file in document store:", key)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to open file")
+		log.Println("Blob store error:", err)
+		return
+	}
+	defer obj.Close()
+
+	content, size, err := filecrypt.Open(obj, obj.Info().Size)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to open file")
+		log.Println("File open error:", err)
+		return
+	}
+	verified := docstore.Verify(content, size, digest)
+	if verified.Mismatch() {
+		utils.WriteError(w, http.StatusInternalServerError, "Stored file failed its integrity check")
+		log.Println("Digest mismatch:", key)
+		return
+	}
+
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Content-Disposition", disposition)
+
+	// Streams the file to the HTTP response, Content-Length and ranges come from the decrypted size
+	http.ServeContent(w, r, fileName, obj.Info().ModTime, verified)
+
+	// The status is already sent, breaking the connection keeps a corrupted download from looking complete
+	if verified.Mismatch() {
+		log.Println("Digest mismatch:", key)
+		panic(http.ErrAbortHandler)
+	}
+}
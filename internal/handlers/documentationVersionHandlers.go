@@ -0,0 +1,459 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/docversion"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/scanner"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/uploadpolicy"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+// documentKind describes how the version handlers find a specific or personal document
+type documentKind struct {
+	name  string
+	label string
+	// idVar is the route variable and the id column of table
+	idVar string
+	table string
+	// policy selects the upload policy, a column of table or a fixed upload policy kind
+	policy string
+}
+
+var (
+	specificDocument = documentKind{
+		name: "specific", label: "Specific documentation", idVar: "specific_documentation_id",
+		table: "specific_documentation", policy: "t.doc_type",
+	}
+	personalDocument = documentKind{
+		name: "personal", label: "Personal documentation", idVar: "personal_documentation_id",
+		table: "personal_documentation", policy: "'" + uploadpolicy.Personal + "'",
+	}
+)
+
+func GetSpecificDocumentationVersions(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	listDocumentVersions(db, w, r, specificDocument)
+}
+
+func CreateSpecificDocumentationVersion(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	createDocumentVersion(db, w, r, specificDocument)
+}
+
+func DownloadSpecificDocumentationVersion(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	downloadDocumentVersion(db, w, r, specificDocument)
+}
+
+func SetSpecificDocumentationCurrentVersion(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	setCurrentDocumentVersion(db, w, r, specificDocument)
+}
+
+func GetPersonalDocumentationVersions(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	listDocumentVersions(db, w, r, personalDocument)
+}
+
+func CreatePersonalDocumentationVersion(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	createDocumentVersion(db, w, r, personalDocument)
+}
+
+func DownloadPersonalDocumentationVersion(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	downloadDocumentVersion(db, w, r, personalDocument)
+}
+
+func SetPersonalDocumentationCurrentVersion(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	setCurrentDocumentVersion(db, w, r, personalDocument)
+}
+
+// documentID reads the document ID from the route, writing a 400 response when it is missing or invalid
+func documentID(w http.ResponseWriter, r *http.Request, kind documentKind) (int, bool) {
+	idStr, ok := mux.Vars(r)[kind.idVar]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, "Missing "+kind.idVar)
+		return 0, false
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid "+kind.idVar)
+		log.Println("Invalid ID parse error:", err)
+		return 0, false
+	}
+	return id, true
+}
+
+// documentPolicy returns the upload policy kind of a live document, sql.ErrNoRows when it does not exist or is trashed
+func documentPolicy(r *http.Request, q utils.DBTX, kind documentKind, id int) (string, error) {
+	var policy string
+	err := q.QueryRowContext(r.Context(), `
+		SELECT `+kind.policy+`
+		FROM documentation d
+		JOIN `+kind.table+` t ON t.`+kind.idVar+` = d.documentation_id
+		WHERE d.documentation_id = ? AND d.deleted_at IS NULL`, id,
+	).Scan(&policy)
+	return policy, err
+}
+
+func listDocumentVersions(db *sql.DB, w http.ResponseWriter, r *http.Request, kind documentKind) {
+	// Extracts the document ID from URL path parameters
+	id, ok := documentID(w, r, kind)
+	if !ok {
+		return
+	}
+
+	// Confirms the document exists and is not in the trash
+	if _, err := documentPolicy(r, db, kind, id); err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, kind.label+" not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch "+kind.name+" documentation")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Retrieves the versions, newest first
+	versions, err := docversion.List(r.Context(), db, id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve document versions")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Writes JSON response & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, versions)
+}
+
+func createDocumentVersion(db *sql.DB, w http.ResponseWriter, r *http.Request, kind documentKind) {
+	// Extracts the document ID from URL path parameters
+	id, ok := documentID(w, r, kind)
+	if !ok {
+		return
+	}
+
+	// Looks up which upload policy the document's files are checked against
+	policy, err := documentPolicy(r, db, kind, id)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, kind.label+" not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch "+kind.name+" documentation")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Caps the request body at the largest file the upload policy accepts
+	if err := uploadpolicy.LimitBody(w, r); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Upload policy is not configured")
+		log.Println("Upload policy error:", err)
+		return
+	}
+
+	// Parses multipart form data from the request, keeping up to 20MB in memory
+	if err := r.ParseMultipartForm(20 << 20); err != nil {
+		writeUploadError(w, uploadpolicy.FormError(err), http.StatusBadRequest, "Failed to parse form data")
+		log.Println("Form parse error:", err)
+		return
+	}
+
+	// Retrieves the uploaded file from the form
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeUploadError(w, uploadpolicy.FormError(err), http.StatusBadRequest, "Missing file in request")
+		log.Println("Form file error:", err)
+		return
+	}
+	defer file.Close()
+
+	// Detects the file's MIME type from its content and checks it and the size against the document's policy
+	mimeType, err := uploadpolicy.Validate(file, header.Size, policy)
+	if err != nil {
+		writeUploadError(w, err, http.StatusInternalServerError, "Failed to check uploaded file")
+		log.Println("Upload validation error:", err)
+		return
+	}
+	fileName := uploadpolicy.FileName(header.Filename)
+
+	// Scans the file for malware before anything is stored
+	scan, err := scanDocument(r.Context(), file)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to scan uploaded file")
+		log.Println("Malware scan error:", err)
+		return
+	}
+
+	// Begins a new database transaction
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
+		log.Println("BeginTx error:", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Locks the activity row, which also serializes version numbers, and checks the If-Match precondition
+	version, err := utils.LockLiveVersion(r.Context(), tx, "activity", "activity_id", "documentation", "documentation_id", id)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, kind.label+" not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch "+kind.name+" documentation")
+		log.Println("DB query error:", err)
+		return
+	}
+	if !utils.CheckIfMatch(w, r, utils.ETag(id, version)) {
+		return
+	}
+
+	// Saves the file in the document store the same way a new document is saved
+	stored, err := storeDocument(r.Context(), db, tx, file, header, scan)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to save uploaded file")
+		log.Println("File store error:", err)
+		return
+	}
+
+	// Deletes the stored file again unless the upload commits, its blob row rolls back with tx
+	committed := false
+	defer func() {
+		if !committed {
+			discardDocument(db, tx, stored)
+		}
+	}()
+
+	// Records the file as the document's next version
+	var uploadedBy any
+	if userID, ok := r.Context().Value(utils.UserIDKey).(int); ok && userID > 0 {
+		uploadedBy = userID
+	}
+	number, err := docversion.Add(r.Context(), tx, id, docversion.File{
+		FileName:      fileName,
+		StorageKey:    stored.Key,
+		ContentSHA256: stored.Digest,
+		MimeType:      mimeType,
+		SizeBytes:     stored.Size,
+		UploadedBy:    uploadedBy,
+		ScanStatus:    scan.Status,
+		ScanSignature: scan.Signature,
+		ScannedAt:     scan.ScannedAt,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to record document version")
+		log.Println("Insert documentation version error:", err)
+		return
+	}
+
+	// Makes the new version current unless it is infected, which keeps the previous file in place
+	if scan.Status != scanner.StatusInfected {
+		if err := docversion.SetCurrent(r.Context(), tx, id, number); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to set current version")
+			log.Println("DB update error:", err)
+			return
+		}
+		if _, err := tx.ExecContext(r.Context(), "UPDATE activity SET version=version+1 WHERE activity_id=?", id); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to update activity")
+			log.Println("DB update error:", err)
+			return
+		}
+		version++
+	}
+
+	// Queues the webhook event in the same transaction, leaving out the server file path
+	if err := webhook.Enqueue(r.Context(), tx, uploadEvent(scan), map[string]interface{}{
+		"documentation_id": id,
+		"kind":             kind.name,
+		"version_number":   number,
+		"file_name":        fileName,
+		"mime_type":        mimeType,
+		"size_bytes":       stored.Size,
+		"scan_status":      scan.Status,
+	}); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to queue webhook event")
+		log.Println("Webhook enqueue error:", err)
+		return
+	}
+
+	// Commits the transaction to finalize the database changes
+	if err := tx.Commit(); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
+		log.Println("Transaction commit error:", err)
+		return
+	}
+	committed = true
+
+	// Applies the retention rules to the document's previous versions right away
+	if rules := docversion.RetentionFromEnv(); rules.Enabled() {
+		store, err := blobstore.Default()
+		if err == nil {
+			_, err = docversion.Prune(r.Context(), db, store, rules, id)
+		}
+		if err != nil {
+			log.Println("Document version prune error:", err)
+		}
+	}
+
+	// Refuses an infected upload once it is recorded and quarantined
+	if scan.Status == scanner.StatusInfected {
+		utils.WriteErrorCode(w, http.StatusUnprocessableEntity, scanner.CodeInfected,
+			fmt.Sprintf("File was found infected (%s) and has been quarantined, the current version is unchanged", scan.Signature.String))
+		return
+	}
+
+	// Writes JSON response with the new row version as ETag & sends a HTTP 201 response code
+	w.Header().Set("ETag", utils.ETag(id, version))
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"message":        "Document version uploaded successfully",
+		"id":             id,
+		"version_number": number,
+		"file_name":      fileName,
+		"mime_type":      mimeType,
+		"storage_key":    stored.Key,
+		"content_sha256": stored.Digest,
+		"size":           stored.Size,
+		"scan_status":    scan.Status,
+	})
+}
+
+func downloadDocumentVersion(db *sql.DB, w http.ResponseWriter, r *http.Request, kind documentKind) {
+	// Extracts the document ID and version number from URL path parameters
+	id, ok := documentID(w, r, kind)
+	if !ok {
+		return
+	}
+	number, err := strconv.Atoi(mux.Vars(r)["version_number"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid version_number")
+		log.Println("Invalid version number parse error:", err)
+		return
+	}
+
+	// SQL query to retrieve the version's file metadata
+	query := `
+		SELECT
+			v.file_name,
+			v.storage_key,
+			v.content_sha256,
+			v.scan_status,
+			v.mime_type
+		FROM documentation_version v
+		JOIN documentation d ON d.documentation_id = v.documentation_id
+		JOIN ` + kind.table + ` t ON t.` + kind.idVar + ` = d.documentation_id
+		WHERE v.documentation_id = ? AND v.version_number = ? AND d.deleted_at IS NULL
+	`
+
+	// Variables to store result
+	var fileName, storageKey, scanStatus, mimeType string
+	var contentSHA256 sql.NullString
+
+	// Executes the SQL query
+	err = db.QueryRowContext(r.Context(), query, id, number).Scan(&fileName, &storageKey, &contentSHA256, &scanStatus, &mimeType)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteError(w, http.StatusNotFound, "Version not found for this documentation ID")
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to obtain document version info")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Streams the file to the HTTP response unless its malware scan keeps it back
+	serveDocument(w, r, storageKey, contentSHA256.String, scanStatus, fileName, mimeType)
+}
+
+func setCurrentDocumentVersion(db *sql.DB, w http.ResponseWriter, r *http.Request, kind documentKind) {
+	// Extracts the document ID from URL path parameters
+	id, ok := documentID(w, r, kind)
+	if !ok {
+		return
+	}
+
+	// Decodes JSON body naming the version to make current
+	var req struct {
+		VersionNumber int `json:"version_number"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields() // Prevents extra unexpected fields
+	if err := decoder.Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		log.Println("JSON decode error:", err)
+		return
+	}
+	if req.VersionNumber <= 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Missing version_number")
+		return
+	}
+
+	// Start transaction
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
+		log.Println("BeginTx error:", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Confirms the document is of this kind, then locks the activity row and checks the If-Match precondition
+	if _, err := documentPolicy(r, tx, kind, id); err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, kind.label+" not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch "+kind.name+" documentation")
+		log.Println("DB query error:", err)
+		return
+	}
+	version, err := utils.LockLiveVersion(r.Context(), tx, "activity", "activity_id", "documentation", "documentation_id", id)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, kind.label+" not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch "+kind.name+" documentation")
+		log.Println("DB query error:", err)
+		return
+	}
+	if !utils.CheckIfMatch(w, r, utils.ETag(id, version)) {
+		return
+	}
+
+	// Copies the version's file into the document
+	err = docversion.SetCurrent(r.Context(), tx, id, req.VersionNumber)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "Version not found for this documentation ID")
+		return
+	} else if errors.Is(err, docversion.ErrInfected) {
+		utils.WriteErrorCode(w, http.StatusForbidden, scanner.CodeQuarantined, "Version was found infected and is quarantined")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to set current version")
+		log.Println("DB update error:", err)
+		return
+	}
+
+	// Bumps the activity row version
+	_, err = tx.ExecContext(r.Context(), "UPDATE activity SET version=version+1 WHERE activity_id=?", id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update activity")
+		log.Println("DB update error:", err)
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
+		log.Println("Transaction commit error:", err)
+		return
+	}
+
+	// Writes JSON response & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(id, version+1))
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message":        "Current version updated successfully",
+		"version_number": req.VersionNumber,
+	})
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/graph"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/graphql"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// maxGraphQLBody bounds the size of a GraphQL request body
+const maxGraphQLBody = 1 << 20
+
+func GraphQL(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+
+	// Reads the query from the URL for GET and from the JSON body for POST
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if vars := q.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				utils.WriteError(w, http.StatusBadRequest, "Invalid variables")
+				log.Println("JSON decode error:", err)
+				return
+			}
+		}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBody)).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		log.Println("JSON decode error:", err)
+		return
+	}
+
+	// Validates required fields
+	if req.Query == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Missing query")
+		return
+	}
+
+	// Runs the query with loaders that batch every lookup of this request
+	resp := graph.Schema.Execute(graph.WithLoaders(r.Context(), db), req)
+
+	// Requests rejected before execution get a 400, partial results a 200 with errors
+	if resp.Data == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/history"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/studentstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+func GetStudentHistory(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts path variables from the request
+	vars := mux.Vars(r)
+	idStr, ok := vars["student_id"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, "Missing student ID")
+		return
+	}
+
+	// Converts the "student_id" string to an integer
+	studentID, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid student ID")
+		log.Println("Invalid ID parse error:", err)
+		return
+	}
+
+	// Lists who changed which fields and when
+	versions, err := history.List(r.Context(), db, history.ProfileStudent, studentID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to obtain student history")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Writes the versions as JSON & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, versions)
+}
+
+func RevertStudent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts path variables from the request
+	vars := mux.Vars(r)
+	idStr, ok := vars["student_id"]
+	versionStr, ok2 := vars["version"]
+	if !ok || !ok2 {
+		utils.WriteError(w, http.StatusBadRequest, "Missing student ID or version")
+		return
+	}
+
+	// Converts the "student_id" string to an integer
+	studentID, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid student ID")
+		log.Println("Invalid ID parse error:", err)
+		return
+	}
+
+	// Converts the "version" string to an integer
+	target, err := strconv.Atoi(versionStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid version")
+		log.Println("Invalid version parse error:", err)
+		return
+	}
+
+	// Start transaction
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
+		log.Println("BeginTx error:", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Locks the student row and keeps its current state for the history
+	current, version, err := studentstore.Fetch(r.Context(), tx, studentID)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "Student not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch student")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Checks the If-Match precondition against the locked row
+	if !utils.CheckIfMatch(w, r, utils.ETag(studentID, version)) {
+		return
+	}
+
+	// Reverting to the current version would only bump the version
+	if target == version {
+		utils.WriteError(w, http.StatusConflict, "Student is already at this version")
+		return
+	}
+
+	// Loads the saved state of the requested version
+	var s models.Student
+	err = history.Load(r.Context(), tx, history.ProfileStudent, studentID, target, &s)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "No such student version")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to load student version")
+		log.Println("DB query error:", err)
+		return
+	}
+	s.StudentID = studentID
+
+	// Writes the old state back to the person and student rows
+	if _, err := studentstore.Update(r.Context(), tx, studentID, s); utils.IsDuplicateEntry(err) {
+		utils.WriteError(w, http.StatusConflict, "Email is already used by another person")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to revert student")
+		log.Println("DB update error:", err)
+		return
+	}
+
+	// Saves the revert as a new version to the profile history
+	if err := history.Record(r.Context(), tx, history.ProfileStudent, studentID, version, current, s, r.Context().Value(utils.UserIDKey), &target); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to record student history")
+		log.Println("DB insert error:", err)
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
+		log.Println("Transaction commit error:", err)
+		return
+	}
+
+	// Writes the reverted student as JSON & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(studentID, version+1))
+	utils.WriteJSON(w, http.StatusOK, s)
+}
+
+func GetAdminHistory(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts path variables from the request
+	vars := mux.Vars(r)
+	idStr, ok := vars["admin_id"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, "Missing admin ID")
+		return
+	}
+
+	// Converts the "admin_id" string to an integer
+	adminID, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid admin ID")
+		log.Println("Invalid ID parse error:", err)
+		return
+	}
+
+	// Lists who changed which fields and when
+	versions, err := history.List(r.Context(), db, history.ProfileAdmin, adminID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to obtain admin history")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Writes the versions as JSON & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, versions)
+}
+
+func RevertAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts path variables from the request
+	vars := mux.Vars(r)
+	idStr, ok := vars["admin_id"]
+	versionStr, ok2 := vars["version"]
+	if !ok || !ok2 {
+		utils.WriteError(w, http.StatusBadRequest, "Missing admin ID or version")
+		return
+	}
+
+	// Converts the "admin_id" string to an integer
+	adminID, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid admin ID")
+		log.Println("Invalid ID parse error:", err)
+		return
+	}
+
+	// Converts the "version" string to an integer
+	target, err := strconv.Atoi(versionStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid version")
+		log.Println("Invalid version parse error:", err)
+		return
+	}
+
+	// Start transaction
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
+		log.Println("BeginTx error:", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Locks the admin row and keeps its current state for the history
+	current, version, err := fetchAdmin(r.Context(), tx, adminID)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "Admin not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch admin")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Checks the If-Match precondition against the locked row
+	if !utils.CheckIfMatch(w, r, utils.ETag(adminID, version)) {
+		return
+	}
+
+	// Reverting to the current version would only bump the version
+	if target == version {
+		utils.WriteError(w, http.StatusConflict, "Admin is already at this version")
+		return
+	}
+
+	// Loads the saved state of the requested version
+	var a models.Admin
+	err = history.Load(r.Context(), tx, history.ProfileAdmin, adminID, target, &a)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "No such admin version")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to load admin version")
+		log.Println("DB query error:", err)
+		return
+	}
+	a.AdminID = adminID
+
+	// Writes the old state back to the person and admin rows
+	if _, err := updateAdminRows(r.Context(), tx, adminID, a); utils.IsDuplicateEntry(err) {
+		utils.WriteError(w, http.StatusConflict, "Email is already used by another person")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to revert admin")
+		log.Println("DB update error:", err)
+		return
+	}
+
+	// Saves the revert as a new version to the profile history
+	if err := history.Record(r.Context(), tx, history.ProfileAdmin, adminID, version, current, a, r.Context().Value(utils.UserIDKey), &target); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to record admin history")
+		log.Println("DB insert error:", err)
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
+		log.Println("Transaction commit error:", err)
+		return
+	}
+
+	// Writes the reverted admin as JSON & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(adminID, version+1))
+	utils.WriteJSON(w, http.StatusOK, a)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// studentRow is student 7 at row version 2 as studentstore.Fetch selects it
+func studentRow(s models.Student) *testdb.Rows {
+	return testdb.Row(int64(7), s.FirstName, s.PreferredName, s.MiddleName, s.LastName, s.Email, s.PhoneNumber,
+		s.Pronouns, s.Sex, s.Gender, s.Birthday, s.Address, s.City, s.State, s.ZipCode, s.Country,
+		s.Year, int64(s.StartYear), int64(s.PlannedGradYear), s.Housing, s.Dining, int64(2))
+}
+
+// revertDB answers the revert of student 7, whose history has version 1 saved as old
+func revertDB(current, old models.Student) *testdb.DB {
+	snapshot, _ := json.Marshal(old)
+	return &testdb.DB{Query: func(query string, args []driver.Value) (*testdb.Rows, error) {
+		switch {
+		case strings.Contains(query, "FROM student s") && strings.Contains(query, "FOR UPDATE"):
+			return studentRow(current), nil
+		case strings.Contains(query, "SELECT snapshot"):
+			if args[2] != int64(1) {
+				return testdb.Empty(), nil
+			}
+			return testdb.Row(string(snapshot)), nil
+		}
+		return nil, nil
+	}}
+}
+
+func revert(t *testing.T, d *testdb.DB, version, ifMatch string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/student/7/history/"+version+"/revert", nil)
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	r = mux.SetURLVars(r, map[string]string{"student_id": "7", "version": version})
+	r = r.WithContext(context.WithValue(r.Context(), utils.UserIDKey, 1))
+	w := httptest.NewRecorder()
+	RevertStudent(d.Open(t), w, r)
+	return w
+}
+
+func TestRevertStudent(t *testing.T) {
+	old := models.Student{FirstName: "Ann", LastName: "Lee", Email: "ann@example.edu", City: "Ames", StartYear: 2023, PlannedGradYear: 2027}
+	current := old
+	current.City = "Boone"
+
+	d := revertDB(current, old)
+	var updates [][]driver.Value
+	d.Exec = func(query string, args []driver.Value) (testdb.Result, error) {
+		if strings.HasPrefix(query, "UPDATE person") {
+			updates = append(updates, args)
+		}
+		return testdb.Result{Affected: 1}, nil
+	}
+
+	w := revert(t, d, "1", utils.ETag(7, 2))
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != utils.ETag(7, 3) {
+		t.Fatalf("revert = %d %s with ETag %q", w.Code, w.Body, w.Header().Get("ETag"))
+	}
+	var got models.Student
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.City != "Ames" || got.StudentID != 7 {
+		t.Fatalf("reverted student = %+v, %v", got, err)
+	}
+
+	// The saved state is written back and recorded as version 3, reverted from 1
+	if len(updates) != 1 || updates[0][11] != "Ames" {
+		t.Fatalf("person updates = %v, want the city of version 1", updates)
+	}
+	if d.Count("INSERT INTO profile_history") != 1 || d.Count("INSERT IGNORE INTO profile_history") != 1 || d.Commits() != 1 {
+		t.Fatalf("the revert was not recorded:\n%s", d.Log())
+	}
+}
+
+func TestRevertStudentRefusals(t *testing.T) {
+	student := models.Student{FirstName: "Ann", City: "Ames"}
+	tests := []struct {
+		name, version, ifMatch string
+		status                 int
+	}{
+		{"current version", "2", "", http.StatusConflict},
+		{"missing version", "9", "", http.StatusNotFound},
+		{"stale If-Match", "1", utils.ETag(7, 1), http.StatusPreconditionFailed},
+		{"invalid version", "one", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		d := revertDB(student, student)
+		if w := revert(t, d, tt.version, tt.ifMatch); w.Code != tt.status {
+			t.Errorf("%s: revert = %d %s, want %d", tt.name, w.Code, w.Body, tt.status)
+		}
+		if d.Commits() != 0 || d.Count("UPDATE person") != 0 {
+			t.Errorf("%s: the refused revert wrote:\n%s", tt.name, d.Log())
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/audit"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/importer"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+func ImportStudents(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Parses multipart form data from the request with a maximum upload size of 20MB
+	err := r.ParseMultipartForm(20 << 20)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Failed to parse form data")
+		log.Println("Form parse error:", err)
+		return
+	}
+
+	// Reads the options from the multipart form
+	mapping, err := importer.ParseMapping(r.FormValue("mapping"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts := importer.Options{
+		Mapping:      mapping,
+		Mode:         r.FormValue("mode"),
+		DryRun:       r.FormValue("dry_run") == "true",
+		CreateLogins: r.FormValue("create_logins") == "true",
+		ActorID:      r.Context().Value(utils.UserIDKey),
+		// Records every saved change in the audit trail, in the row's transaction
+		Record: func(ctx context.Context, tx *sql.Tx, row *importer.RowResult) error {
+			action := audit.ActionCreate
+			if row.Action == importer.ActionUpdated {
+				action = audit.ActionUpdate
+			}
+			return audit.AppendRequest(tx, r, &audit.Entry{
+				Action:       action,
+				ResourceType: "student",
+				ResourceID:   strconv.Itoa(row.StudentID),
+				Before:       marshalOrNil(row.Before),
+				After:        marshalOrNil(row.After),
+			})
+		},
+	}
+	if opts.Mode != "" && opts.Mode != importer.ModeTransaction && opts.Mode != importer.ModePerRow {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid mode, expected transaction or per-row")
+		return
+	}
+
+	// Retrieves the uploaded file from the form
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Missing file in request")
+		log.Println("Form file error:", err)
+		return
+	}
+	defer file.Close()
+
+	// Reads the CSV or XLSX rows
+	rows, err := importer.ReadTable(file)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Failed to read file, expected CSV or XLSX")
+		log.Println("Import read error:", err)
+		return
+	}
+
+	// Imports the students
+	report, err := importer.Run(r.Context(), db, rows, opts)
+	if errors.Is(err, importer.ErrEmptyFile) || errors.Is(err, importer.ErrNoEmailColumn) {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to import students")
+		log.Println("Import error:", err)
+		return
+	}
+
+	// An import whose failed rows kept anything from being written is reported as unprocessable
+	status := http.StatusOK
+	if !report.DryRun && !report.Committed && report.Failed > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	// The report carries the invite tokens of new logins, which must not be cached or stored for replays
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Writes the import report as JSON
+	utils.WriteJSON(w, status, report)
+}
+
+// marshalOrNil encodes a value for the audit trail, nil pointers stay empty
+func marshalOrNil[T any](v *T) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
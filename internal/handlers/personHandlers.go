@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/export"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 
@@ -22,6 +24,7 @@ func GetPersons(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 			email, phone_number, pronouns, sex, gender,
 			birthday, address, city, state, zip_code, country
 		FROM person
+		WHERE deleted_at IS NULL
 	`
 
 	// Executes written SQL
@@ -35,6 +38,13 @@ func GetPersons(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "persons", models.Person{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	persons := make([]models.Person, 0)
 
@@ -44,17 +54,41 @@ func GetPersons(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		// Parses the current data into fields of "p" variable
 		if err := rows.Scan(
 			&p.PersonID, &p.FirstName, &p.PreferredName, &p.MiddleName, &p.LastName,
-			&p.Email, &p.PhoneNumber, &p.Pronouns, &p.Sex, &p.Gender,
-			&p.Birthday, &p.Address, &p.City, &p.State, &p.ZipCode, &p.Country,
+			fieldcrypt.Scan(fieldcrypt.PersonEmail, &p.Email),
+			fieldcrypt.Scan(fieldcrypt.PersonPhoneNumber, &p.PhoneNumber),
+			&p.Pronouns, &p.Sex, &p.Gender,
+			fieldcrypt.Scan(fieldcrypt.PersonBirthday, &p.Birthday),
+			fieldcrypt.Scan(fieldcrypt.PersonAddress, &p.Address),
+			&p.City, &p.State, &p.ZipCode, &p.Country,
 		); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse persons")
 			log.Println("Row scan error:", err)
 			return
 		}
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(p); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		// Adds the obtained data to the slice
 		persons = append(persons, p)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -90,7 +124,7 @@ func GetPersonByID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 			email, phone_number, pronouns, sex, gender,
 			birthday, address, city, state, zip_code, country
 		FROM person
-		WHERE id = ?
+		WHERE id = ? AND deleted_at IS NULL
 	`
 
 	// Empty variable for person struct
@@ -99,8 +133,12 @@ func GetPersonByID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	// Executes written SQL and retrieves only one row
 	err = db.QueryRowContext(r.Context(), query, personID).Scan(
 		&p.PersonID, &p.FirstName, &p.PreferredName, &p.MiddleName, &p.LastName,
-		&p.Email, &p.PhoneNumber, &p.Pronouns, &p.Sex, &p.Gender,
-		&p.Birthday, &p.Address, &p.City, &p.State, &p.ZipCode, &p.Country,
+		fieldcrypt.Scan(fieldcrypt.PersonEmail, &p.Email),
+		fieldcrypt.Scan(fieldcrypt.PersonPhoneNumber, &p.PhoneNumber),
+		&p.Pronouns, &p.Sex, &p.Gender,
+		fieldcrypt.Scan(fieldcrypt.PersonBirthday, &p.Birthday),
+		fieldcrypt.Scan(fieldcrypt.PersonAddress, &p.Address),
+		&p.City, &p.State, &p.ZipCode, &p.Country,
 	)
 
 	// Error message if no rows are found
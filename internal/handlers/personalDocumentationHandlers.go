@@ -4,16 +4,21 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"time"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/activity"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/docstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/docversion"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/export"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/scanner"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/uploadpolicy"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/webhook"
 	"github.com/gorilla/mux"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -30,13 +35,14 @@ func GetPersonalDocumentations(db *sql.DB, w http.ResponseWriter, r *http.Reques
 			pd.admin_id,
 			a.activity_datetime,
 			d.file_name,
-			d.file_path,
+			d.storage_key,
 			d.mime_type,
 			d.size_bytes,
 			d.uploaded_by
 		FROM personal_documentation pd
 		JOIN activity a ON pd.personal_documentation_id = a.activity_id
 		JOIN documentation d ON pd.personal_documentation_id = d.documentation_id
+		WHERE d.deleted_at IS NULL
 	`
 
 	args := []any{}
@@ -50,7 +56,7 @@ func GetPersonalDocumentations(db *sql.DB, w http.ResponseWriter, r *http.Reques
 			log.Println("Invalid ID parse error:", err)
 			return
 		}
-		query += " WHERE pd.admin_id = ?"
+		query += " AND pd.admin_id = ?"
 		args = append(args, adminID)
 	}
 
@@ -64,6 +70,13 @@ func GetPersonalDocumentations(db *sql.DB, w http.ResponseWriter, r *http.Reques
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "personal_documentation", models.PersonalDocumentation{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	personalDocumentation := make([]models.PersonalDocumentation, 0)
 
@@ -76,19 +89,39 @@ func GetPersonalDocumentations(db *sql.DB, w http.ResponseWriter, r *http.Reques
 			&pd.AdminID,
 			&pd.ActivityDateTime,
 			&pd.FileName,
-			&pd.FilePath,
+			&pd.StorageKey,
 			&pd.MimeType,
 			&pd.SizeBytes,
 			&pd.UploadedBy,
 		); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to scan personal documentation")
 			log.Println("Row scan error:", err)
 			return
 		}
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(pd); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		// Adds the obtained data to the slice
 		personalDocumentation = append(personalDocumentation, pd)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -124,18 +157,20 @@ func GetPersonalDocumentationByID(db *sql.DB, w http.ResponseWriter, r *http.Req
 			pd.admin_id,
 			a.activity_datetime,
 			d.file_name,
-			d.file_path,
+			d.storage_key,
 			d.mime_type,
 			d.size_bytes,
-			d.uploaded_by
+			d.uploaded_by,
+			a.version
 		FROM personal_documentation pd
 		JOIN activity a ON pd.personal_documentation_id = a.activity_id
 		JOIN documentation d ON pd.personal_documentation_id = d.documentation_id
-		WHERE pd.personal_documentation_id = ?
+		WHERE pd.personal_documentation_id = ? AND d.deleted_at IS NULL
 	`
 
-	// Empty variable for personal_documentation struct
+	// Empty variables for personal_documentation struct and row version
 	var pd models.PersonalDocumentation
+	var version int
 
 	// Executes query
 	err = db.QueryRowContext(r.Context(), query, personalDocumentationID).Scan(
@@ -143,10 +178,11 @@ func GetPersonalDocumentationByID(db *sql.DB, w http.ResponseWriter, r *http.Req
 		&pd.AdminID,
 		&pd.ActivityDateTime,
 		&pd.FileName,
-		&pd.FilePath,
+		&pd.StorageKey,
 		&pd.MimeType,
 		&pd.SizeBytes,
 		&pd.UploadedBy,
+		&version,
 	)
 	// Error message if no rows are found
 	if err == sql.ErrNoRows {
@@ -159,7 +195,8 @@ func GetPersonalDocumentationByID(db *sql.DB, w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	// Writes JSON response & sends a HTTP 200 response code
+	// Writes JSON response with the row version as ETag & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(personalDocumentationID, version))
 	utils.WriteJSON(w, http.StatusOK, pd)
 }
 
@@ -184,22 +221,25 @@ func DownloadPersonalDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Re
 	query := `
 		SELECT
 			d.file_name,
-			d.file_path,
+			d.storage_key,
+			d.content_sha256,
+			d.scan_status,
 			d.mime_type,
 			d.size_bytes,
 			d.uploaded_by
 		FROM documentation d
 		JOIN personal_documentation pd ON pd.personal_documentation_id = d.documentation_id
-		WHERE pd.personal_documentation_id = ?
+		WHERE pd.personal_documentation_id = ? AND d.deleted_at IS NULL
 	`
 
 	// Creates variables to store result
-	var fileName, filePath, mimeType string
+	var fileName, storageKey, scanStatus, mimeType string
+	var contentSHA256 sql.NullString
 	var sizeBytes int64
 	var uploadedBy sql.NullInt64
 
 	// Executes the SQL query
-	err = db.QueryRowContext(r.Context(), query, id).Scan(&fileName, &filePath, &mimeType, &sizeBytes, &uploadedBy)
+	err = db.QueryRowContext(r.Context(), query, id).Scan(&fileName, &storageKey, &contentSHA256, &scanStatus, &mimeType, &sizeBytes, &uploadedBy)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			utils.WriteError(w, http.StatusNotFound, "File not found for this documentation ID")
@@ -210,32 +250,28 @@ func DownloadPersonalDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// Validates file path and existence
-	if filePath == "" {
-		utils.WriteError(w, http.StatusInternalServerError, "File path not found in database")
+	// Validates the storage key
+	if storageKey == "" {
+		utils.WriteError(w, http.StatusInternalServerError, "Storage key not found in database")
 		return
 	}
-	fullPath := filepath.Clean(filePath)
-
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		utils.WriteError(w, http.StatusNotFound, "File not found on server")
-		log.Println("Missing file on disk:", fullPath)
-		return
-	}
-
-	w.Header().Set("Content-Type", mimeType)
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", sizeBytes))
 
-	// Streams the file to the HTTP response
-	http.ServeFile(w, r, fullPath)
+	// Streams the file to the HTTP response unless its malware scan keeps it back
+	serveDocument(w, r, storageKey, contentSHA256.String, scanStatus, fileName, mimeType)
 }
 
 func CreatePersonalDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	// Parses multipart form data from the request with a maximum upload size of 20MB
+	// Caps the request body at the largest file the upload policy accepts
+	if err := uploadpolicy.LimitBody(w, r); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Upload policy is not configured")
+		log.Println("Upload policy error:", err)
+		return
+	}
+
+	// Parses multipart form data from the request, keeping up to 20MB in memory
 	err := r.ParseMultipartForm(20 << 20)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, "Failed to parse form data")
+		writeUploadError(w, uploadpolicy.FormError(err), http.StatusBadRequest, "Failed to parse form data")
 		log.Println("Form parse error:", err)
 		return
 	}
@@ -255,79 +291,78 @@ func CreatePersonalDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Begins a new database transaction
-	tx, err := db.BeginTx(r.Context(), nil)
+	// Retrieves the uploaded file from the form
+	file, header, err := r.FormFile("file")
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
-		log.Println("BeginTx error:", err)
+		writeUploadError(w, uploadpolicy.FormError(err), http.StatusBadRequest, "Missing file in request")
+		log.Println("Form file error:", err)
 		return
 	}
-	defer tx.Rollback()
+	defer file.Close()
 
-	// Inserts a new activity record with the current timestamp
-	now := time.Now()
-	res, err := tx.ExecContext(r.Context(), "INSERT INTO activity (activity_datetime) VALUES (?)", now)
+	// Detects the file's MIME type from its content and checks it and the size against the personal document policy
+	mimeType, err := uploadpolicy.Validate(file, header.Size, uploadpolicy.Personal)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to insert activity")
-		log.Println("Insert activity error:", err)
+		writeUploadError(w, err, http.StatusInternalServerError, "Failed to check uploaded file")
+		log.Println("Upload validation error:", err)
 		return
 	}
+	fileName := uploadpolicy.FileName(header.Filename)
 
-	// Retrieves the automatically generated activity_id from the database
-	activityID, err := res.LastInsertId()
+	// Scans the file for malware before anything is stored
+	scan, err := scanDocument(r.Context(), file)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve inserted activity ID")
-		log.Println("LastInsertId error:", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to scan uploaded file")
+		log.Println("Malware scan error:", err)
 		return
 	}
 
-	// Retrieves the uploaded file from the form
-	file, header, err := r.FormFile("file")
+	// Begins a new database transaction
+	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, "Missing file in request")
-		log.Println("Form file error:", err)
-		return
-	}
-	defer file.Close()
-
-	// Defines file storage directory and constructs a unique filename
-	dstDir := "/home/piconex/database/files/personal"
-	if err := os.MkdirAll(dstDir, 0755); err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to ensure personal folder")
-		log.Println("MkdirAll error:", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
+		log.Println("BeginTx error:", err)
 		return
 	}
-	safeFileName := fmt.Sprintf("%d_%s", activityID, filepath.Base(header.Filename))
-	fullPath := filepath.Join(dstDir, safeFileName)
+	defer tx.Rollback()
 
-	// Creates a new file at the destination path
-	dst, err := os.Create(fullPath)
+	// Inserts a new activity record with the current timestamp
+	now := time.Now()
+	activityID, err := activity.Create(r.Context(), tx, activity.TypePersonalDocumentation, now)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to create file on server")
-		log.Println("File create error:", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to insert activity")
+		log.Println("Insert activity error:", err)
 		return
 	}
-	defer dst.Close()
 
-	// Copies the uploaded file content into the newly created file
-	sizeBytes, err := io.Copy(dst, file)
+	// Saves the file in the document store under the digest of its content, encrypted when field encryption keys are configured,
+	// or in quarantine when the scan found it infected
+	stored, err := storeDocument(r.Context(), db, tx, file, header, scan)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to save uploaded file")
-		log.Println("File write error:", err)
+		log.Println("File store error:", err)
 		return
 	}
 
-	// Detects the file's MIME type from the uploaded header
-	mimeType := header.Header.Get("Content-Type")
-	if mimeType == "" {
-		mimeType = "application/octet-stream"
-	}
+	// Deletes the stored file again unless the upload commits, its blob row rolls back with tx
+	committed := false
+	defer func() {
+		if !committed {
+			discardDocument(db, tx, stored)
+		}
+	}()
 
-	// Inserts a new record into the documentation table with file metadata
+	// Inserts a new record into the documentation table with file metadata, uploaded by the caller
+	var uploadedBy any
+	if userID, ok := r.Context().Value(utils.UserIDKey).(int); ok && userID > 0 {
+		uploadedBy = userID
+	}
 	_, err = tx.ExecContext(r.Context(),
-		`INSERT INTO documentation (documentation_id, file_name, file_path, mime_type, size_bytes, uploaded_by)
-		 VALUES (?, ?, ?, ?, ?, ?)`,
-		activityID, header.Filename, fullPath, mimeType, sizeBytes, 5, // uploaded_by temporarily set to 5
+		`INSERT INTO documentation (documentation_id, file_name, storage_key, content_sha256, mime_type, size_bytes, uploaded_by,
+			scan_status, scan_signature, scanned_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		activityID, fileName, stored.Key, stored.Digest, mimeType, stored.Size, uploadedBy,
+		scan.Status, scan.Signature, scan.ScannedAt,
 	)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to insert documentation metadata")
@@ -335,6 +370,13 @@ func CreatePersonalDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Records the uploaded file as the document's first version
+	if err := docversion.Record(r.Context(), tx, activityID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to record document version")
+		log.Println("Insert documentation version error:", err)
+		return
+	}
+
 	// Inserts a new record into the personal_documentation table linking the admin
 	_, err = tx.ExecContext(r.Context(),
 		`INSERT INTO personal_documentation (personal_documentation_id, admin_id)
@@ -347,19 +389,46 @@ func CreatePersonalDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Queues the webhook event in the same transaction, leaving out the server file path
+	if err := webhook.Enqueue(r.Context(), tx, uploadEvent(scan), map[string]interface{}{
+		"documentation_id": activityID,
+		"kind":             "personal",
+		"admin_id":         adminID,
+		"file_name":        fileName,
+		"mime_type":        mimeType,
+		"size_bytes":       stored.Size,
+		"scan_status":      scan.Status,
+	}); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to queue webhook event")
+		log.Println("Webhook enqueue error:", err)
+		return
+	}
+
 	// Commits the transaction to finalize the database changes
 	if err := tx.Commit(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
 		log.Println("Transaction commit error:", err)
 		return
 	}
+	committed = true
+
+	// Refuses an infected upload once it is recorded and quarantined
+	if scan.Status == scanner.StatusInfected {
+		utils.WriteErrorCode(w, http.StatusUnprocessableEntity, scanner.CodeInfected,
+			fmt.Sprintf("File was found infected (%s) and has been quarantined", scan.Signature.String))
+		return
+	}
 
 	// Writes JSON response & sends a HTTP 201 response code
 	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
-		"message": "Personal documentation uploaded successfully",
-		"id":      activityID,
-		"path":    fullPath,
-		"size":    sizeBytes,
+		"message":        "Personal documentation uploaded successfully",
+		"id":             activityID,
+		"file_name":      fileName,
+		"mime_type":      mimeType,
+		"storage_key":    stored.Key,
+		"content_sha256": stored.Digest,
+		"size":           stored.Size,
+		"scan_status":    scan.Status,
 	})
 }
 
@@ -396,11 +465,20 @@ func UpdatePersonalDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 	pd.ActivityDateTime = time.Now()
 
 	// Validates required fields
-	if pd.AdminID == 0 || pd.FileName == "" || pd.FilePath == "" || pd.MimeType == "" || pd.SizeBytes == 0 {
+	if pd.AdminID == 0 || pd.FileName == "" || pd.StorageKey == "" || pd.MimeType == "" || pd.SizeBytes == 0 {
 		utils.WriteError(w, http.StatusBadRequest, "Missing required fields")
 		return
 	}
 
+	// Cleans the file name the same way uploads are
+	pd.FileName = uploadpolicy.FileName(pd.FileName)
+
+	// Validates the storage key so it cannot point outside the document store or into quarantine
+	if err := blobstore.ValidKey(pd.StorageKey); err != nil || docstore.Quarantined(pd.StorageKey) {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid storage_key")
+		return
+	}
+
 	// Start transaction
 	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
@@ -410,9 +488,23 @@ func UpdatePersonalDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 	}
 	defer tx.Rollback()
 
+	// Locks the activity row and checks the If-Match precondition
+	version, err := utils.LockLiveVersion(r.Context(), tx, "activity", "activity_id", "documentation", "documentation_id", personalDocumentationID)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "Personal documentation not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch personal documentation")
+		log.Println("DB query error:", err)
+		return
+	}
+	if !utils.CheckIfMatch(w, r, utils.ETag(personalDocumentationID, version)) {
+		return
+	}
+
 	// Executes written SQL to update the activity data
 	_, err = tx.ExecContext(r.Context(),
-		"UPDATE activity SET activity_datetime=? WHERE activity_id=?",
+		"UPDATE activity SET activity_datetime=?, version=version+1 WHERE activity_id=?",
 		pd.ActivityDateTime, personalDocumentationID,
 	)
 
@@ -423,11 +515,17 @@ func UpdatePersonalDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// A new storage_key takes the digest of the blob it names and waits for a rescan
 	_, err = tx.ExecContext(r.Context(),
 		`UPDATE documentation
-		SET file_name=?, file_path=?, mime_type=?, size_bytes=?, uploaded_by=?
+		SET file_name=?,
+			content_sha256=IF(storage_key=?, content_sha256, (SELECT b.content_sha256 FROM document_blob b WHERE b.storage_key=?)),
+			scan_status=IF(storage_key=?, scan_status, 'unscanned'),
+			scan_signature=IF(storage_key=?, scan_signature, NULL),
+			scanned_at=IF(storage_key=?, scanned_at, NULL),
+			storage_key=?, mime_type=?, size_bytes=?, uploaded_by=?
 		WHERE documentation_id=?`,
-		pd.FileName, pd.FilePath, pd.MimeType, pd.SizeBytes, pd.UploadedBy, personalDocumentationID,
+		pd.FileName, pd.StorageKey, pd.StorageKey, pd.StorageKey, pd.StorageKey, pd.StorageKey, pd.StorageKey, pd.MimeType, pd.SizeBytes, pd.UploadedBy, personalDocumentationID,
 	)
 
 	// Error message if ExecContext fails
@@ -437,6 +535,13 @@ func UpdatePersonalDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Keeps the current version in step with the edited file metadata
+	if err := docversion.Sync(r.Context(), tx, personalDocumentationID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update document version")
+		log.Println("DB update error:", err)
+		return
+	}
+
 	// Executes written SQL to update the personal documentation data
 	res, err := tx.ExecContext(r.Context(),
 		"UPDATE personal_documentation SET admin_id=? WHERE personal_documentation_id=?",
@@ -474,6 +579,7 @@ func UpdatePersonalDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 	}
 
 	// Writes JSON response confirming update & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(personalDocumentationID, version+1))
 	utils.WriteJSON(w, http.StatusOK, map[string]string{
 		"message": "Personal documentation updated successfully",
 	})
@@ -496,59 +602,47 @@ func DeletePersonalDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Retrieve file path before deleting from DB
-	var filePath, fileName string
-	err = db.QueryRowContext(r.Context(),
-		`SELECT d.file_path, d.file_name
-	 FROM documentation d
-	 JOIN personal_documentation pd ON d.documentation_id = pd.personal_documentation_id
-	 WHERE pd.personal_documentation_id = ?`,
-		personalDocumentationID,
-	).Scan(&filePath, &fileName)
-
-	// Clean and reconstruct the actual stored file path (id-prefixed)
-	dir := filepath.Dir(filePath)
-	prefixedFile := fmt.Sprintf("%d_%s", personalDocumentationID, filepath.Base(fileName))
-	fullPath := filepath.Join(dir, prefixedFile)
-
-	// Clean and verify path
-	fullPath = filepath.Clean(fullPath)
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		log.Println("Warning: file not found on disk, skipping delete:", fullPath)
-		fullPath = "" // prevents unnecessary os.Remove()
+	// Begin a transaction (not strictly required for a single UPDATE, but safer)
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
+		log.Println("BeginTx error:", err)
+		return
 	}
+	defer tx.Rollback()
 
-	// Handles missing or invalid file path case
+	// Locks the activity row and checks the If-Match precondition
+	version, err := utils.LockLiveVersion(r.Context(), tx, "activity", "activity_id", "documentation", "documentation_id", personalDocumentationID)
 	if err == sql.ErrNoRows {
-		utils.WriteError(w, http.StatusNotFound, "No file found for this documentation ID")
+		utils.WriteError(w, http.StatusNotFound, "No personal documentation found for this ID")
 		return
 	} else if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve file path")
-		log.Println("File path retrieval error:", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch personal documentation")
+		log.Println("DB query error:", err)
+		return
+	}
+	if !utils.CheckIfMatch(w, r, utils.ETag(personalDocumentationID, version)) {
 		return
 	}
 
-	// Begin a transaction (not strictly required for single multi-table DELETE, but safer)
-	tx, err := db.BeginTx(r.Context(), nil)
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
-		log.Println("BeginTx error:", err)
+	// Queues document.deleted events for the documents being trashed
+	if err := queueDocumentDeletions(r.Context(), tx, "personal", "personal_documentation_id", personalDocumentationID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to queue webhook event")
+		log.Println("Webhook enqueue error:", err)
 		return
 	}
-	defer tx.Rollback()
 
-	// Multi-table delete query:
-	// Deletes from personal_documentation, documentation, and activity in one go
+	// Soft delete query:
+	// Moves the documentation to the trash, the file stays on disk until the purger removes it
 	query := `
-		DELETE pd, d, a
-		FROM personal_documentation pd
-		JOIN documentation d ON d.documentation_id = pd.personal_documentation_id
-		JOIN activity a ON a.activity_id = d.documentation_id
-		WHERE pd.personal_documentation_id = ?;
+		UPDATE documentation d
+		JOIN personal_documentation pd ON pd.personal_documentation_id = d.documentation_id
+		SET d.deleted_at = NOW(), d.deleted_by = ?
+		WHERE pd.personal_documentation_id = ? AND d.deleted_at IS NULL;
 	`
 
-	// Executes written SQL to delete the documentation
-	res, err := tx.ExecContext(r.Context(), query, personalDocumentationID)
+	// Executes written SQL to trash the documentation
+	res, err := tx.ExecContext(r.Context(), query, r.Context().Value(utils.UserIDKey), personalDocumentationID)
 
 	// Error message if ExecContext fails
 	if err != nil {
@@ -557,7 +651,7 @@ func DeletePersonalDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Gets the number of rows affected by the delete
+	// Gets the number of rows affected by the update
 	rowsAffected, err := res.RowsAffected()
 
 	// Error message if RowsAffected fails
@@ -567,7 +661,7 @@ func DeletePersonalDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Error message if no rows were deleted
+	// Error message if nothing was trashed
 	if rowsAffected == 0 {
 		utils.WriteError(w, http.StatusNotFound, "No personal documentation found for this ID")
 		return
@@ -580,16 +674,10 @@ func DeletePersonalDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Delete the physical file (after DB commit)
-	if fullPath != "" && os.Remove(fullPath) != nil {
-		log.Println("Warning: failed to delete file from disk:", fullPath)
-	}
-
-	// Respond with success
+	// Respond with success JSON
 	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"message":       "Personal documentation " + idStr + " deleted successfully",
-		"file_deleted":  filePath,
-		"rows_affected": rowsAffected / 3, // Each personal documentation involves 3 rows deleted
+		"message":       "Personal documentation " + idStr + " moved to trash",
+		"rows_affected": rowsAffected,
 	})
 }
 
@@ -610,39 +698,7 @@ func DeletePersonalDocumentationByAdminID(db *sql.DB, w http.ResponseWriter, r *
 		return
 	}
 
-	// Retrieve all file paths before deleting from DB
-	rows, err := db.QueryContext(r.Context(), `
-		SELECT d.documentation_id, d.file_path, d.file_name
-		FROM documentation d
-		JOIN personal_documentation pd ON d.documentation_id = pd.personal_documentation_id
-		WHERE pd.admin_id = ?;
-	`, adminID)
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve file paths")
-		log.Println("File path retrieval error:", err)
-		return
-	}
-	defer rows.Close()
-
-	var filePaths []string
-	for rows.Next() {
-		var id int
-		var filePath, fileName string
-		if err := rows.Scan(&id, &filePath, &fileName); err == nil && filePath != "" {
-			dir := filepath.Dir(filePath)
-			prefixed := fmt.Sprintf("%d_%s", id, filepath.Base(fileName))
-			fullPath := filepath.Clean(filepath.Join(dir, prefixed))
-			filePaths = append(filePaths, fullPath)
-		}
-	}
-	_ = filePaths
-	if err := rows.Err(); err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Error scanning file paths")
-		log.Println("Rows scan error:", err)
-		return
-	}
-
-	// Begin a transaction (not strictly required for single multi-table DELETE, but safer)
+	// Begin a transaction so the trash and its events commit together
 	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
@@ -651,18 +707,24 @@ func DeletePersonalDocumentationByAdminID(db *sql.DB, w http.ResponseWriter, r *
 	}
 	defer tx.Rollback()
 
-	// Multi-table delete query:
-	// Deletes from personal_documentation, documentation, and activity in one go
+	// Queues document.deleted events for the documents being trashed
+	if err := queueDocumentDeletions(r.Context(), tx, "personal", "admin_id", adminID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to queue webhook event")
+		log.Println("Webhook enqueue error:", err)
+		return
+	}
+
+	// Soft delete query:
+	// Moves every live personal documentation of the admin to the trash
 	query := `
-		DELETE pd, d, a
-		FROM personal_documentation pd
-		JOIN documentation d ON d.documentation_id = pd.personal_documentation_id
-		JOIN activity a ON a.activity_id = d.documentation_id
-		WHERE pd.admin_id = ?;
+		UPDATE documentation d
+		JOIN personal_documentation pd ON pd.personal_documentation_id = d.documentation_id
+		SET d.deleted_at = NOW(), d.deleted_by = ?
+		WHERE pd.admin_id = ? AND d.deleted_at IS NULL;
 	`
 
-	// Executes written SQL to delete the documentation
-	res, err := tx.ExecContext(r.Context(), query, adminID)
+	// Executes written SQL to trash the documentation
+	res, err := tx.ExecContext(r.Context(), query, r.Context().Value(utils.UserIDKey), adminID)
 
 	// Error message if ExecContext fails
 	if err != nil {
@@ -671,7 +733,7 @@ func DeletePersonalDocumentationByAdminID(db *sql.DB, w http.ResponseWriter, r *
 		return
 	}
 
-	// Gets the number of rows affected by the delete
+	// Gets the number of rows affected by the update
 	rowsAffected, err := res.RowsAffected()
 
 	// Error message if RowsAffected fails
@@ -681,30 +743,22 @@ func DeletePersonalDocumentationByAdminID(db *sql.DB, w http.ResponseWriter, r *
 		return
 	}
 
-	// Error message if no rows were deleted
+	// Error message if nothing was trashed
 	if rowsAffected == 0 {
 		utils.WriteError(w, http.StatusNotFound, "No personal documentation found for this admin")
 		return
 	}
 
-	// Commit the transaction
+	// Commit transaction
 	if err := tx.Commit(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
 		log.Println("Transaction commit error:", err)
 		return
 	}
 
-	// Delete physical files (after DB commit)
-	for _, path := range filePaths {
-		if os.Remove(path) != nil {
-			log.Println("Warning: failed to delete file:", path)
-		}
-	}
-
 	// Respond with success
 	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"message":       "All personal documentation for admin " + adminIDStr + " deleted successfully",
-		"rows_affected": rowsAffected / 3,
-		"files_deleted": len(filePaths),
+		"message":       "All personal documentation for admin " + adminIDStr + " moved to trash",
+		"rows_affected": rowsAffected,
 	})
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"log"
@@ -9,8 +10,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/activity"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/export"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/webhook"
 	"github.com/gorilla/mux"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -41,6 +45,13 @@ func GetPointsOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "points_of_contact", models.PointOfContact{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	pointsOfContact := make([]models.PointOfContact, 0)
 
@@ -56,15 +67,35 @@ func GetPointsOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 			&poc.EventType,
 			&poc.StudentID,
 		); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse points of contact")
 			log.Println("Row scan error:", err)
 			return
 		}
 
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(poc); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		// Adds the obtained data to the slice
 		pointsOfContact = append(pointsOfContact, poc)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -93,32 +124,8 @@ func GetPointOfContactByID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// All data being selected for this GET command
-	query := `
-		SELECT
-    		poc.point_of_contact_id,
-    		a.activity_datetime,
-    		poc.event_datetime,
-    		poc.duration,
-    		poc.event_type,
-    		poc.student_id
-		FROM point_of_contact poc
-		JOIN activity a ON poc.point_of_contact_id = a.activity_id
-		WHERE poc.point_of_contact_id = ?
-	`
-
-	// Empty variable for PointOfContact struct
-	var poc models.PointOfContact
-
-	// Executes written SQL and retrieves only one row
-	err = db.QueryRowContext(r.Context(), query, pointOfContactID).Scan(
-		&poc.PointOfContactID,
-		&poc.ActivityDateTime,
-		&poc.EventDateTime,
-		&poc.Duration,
-		&poc.EventType,
-		&poc.StudentID,
-	)
+	// Fetches the point of contact from the database
+	poc, version, err := fetchPointOfContact(r.Context(), db, pointOfContactID)
 
 	// Error message if no rows are found
 	if err == sql.ErrNoRows {
@@ -131,7 +138,8 @@ func GetPointOfContactByID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Writes the struct as JSON & sends a HTTP 200 response code
+	// Writes the struct as JSON with the row version as ETag & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(pointOfContactID, version))
 	utils.WriteJSON(w, http.StatusOK, poc)
 }
 
@@ -216,6 +224,13 @@ func GetPastPointsOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request)
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "past_points_of_contact", models.PointOfContact{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	pointsOfContact := make([]models.PointOfContact, 0)
 
@@ -231,14 +246,34 @@ func GetPastPointsOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request)
 			&poc.EventType,
 			&poc.StudentID,
 		); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse points of contact")
 			log.Println("Row scan error:", err)
 			return
 		}
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(poc); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		// Adds the obtained data to the slice
 		pointsOfContact = append(pointsOfContact, poc)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -331,6 +366,13 @@ func GetFuturePointsOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "future_points_of_contact", models.PointOfContact{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	pointsOfContact := make([]models.PointOfContact, 0)
 
@@ -346,14 +388,34 @@ func GetFuturePointsOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request
 			&poc.EventType,
 			&poc.StudentID,
 		); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse points of contact")
 			log.Println("Row scan error:", err)
 			return
 		}
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(poc); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		// Adds the obtained data to the slice
 		pointsOfContact = append(pointsOfContact, poc)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -367,7 +429,6 @@ func GetFuturePointsOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request
 
 func GetPointsOfContactSummary(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	// Query params
-	dateStr := r.URL.Query().Get("date")
 	tzStr := r.URL.Query().Get("tz")
 	studentIDStr := r.URL.Query().Get("student_id")
 	adminIDStr := r.URL.Query().Get("admin_id")
@@ -385,17 +446,7 @@ func GetPointsOfContactSummary(db *sql.DB, w http.ResponseWriter, r *http.Reques
 	}
 
 	// Base query: PoC + Activity (for activity_datetime) + Student
-	query := `
-		SELECT
-			poc.point_of_contact_id,
-			a.activity_datetime,
-			poc.event_datetime,
-			poc.duration,
-			poc.event_type,
-			s.student_id,
-			p.first_name,
-			p.preferred_name,
-			p.last_name
+	from := `
 		FROM point_of_contact poc
 		INNER JOIN activity a
 			ON a.activity_id = poc.point_of_contact_id
@@ -408,18 +459,15 @@ func GetPointsOfContactSummary(db *sql.DB, w http.ResponseWriter, r *http.Reques
 	args := []any{}
 	where := []string{}
 
-	// Date filter (NOW on poc.event_datetime, not activity)
-	if dateStr != "" {
-		targetDate, err := time.ParseInLocation("2006-01-02", dateStr, loc)
-		if err != nil {
-			utils.WriteError(w, http.StatusBadRequest, "Invalid date format (expected YYYY-MM-DD)")
-			log.Println("Date parse error:", err)
-			return
-		}
-		start := targetDate
-		end := targetDate.Add(24 * time.Hour)
-		where = append(where, "poc.event_datetime >= ? AND poc.event_datetime < ?")
-		args = append(args, start.UTC(), end.UTC())
+	// Date or from/to filter (on poc.event_datetime, not activity)
+	dateRange, rangeArgs, err := summaryRange(r.URL.Query(), loc, "poc.event_datetime")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if dateRange != "" {
+		where = append(where, dateRange)
+		args = append(args, rangeArgs...)
 	}
 
 	// Optional student filter
@@ -442,13 +490,32 @@ func GetPointsOfContactSummary(db *sql.DB, w http.ResponseWriter, r *http.Reques
 
 	// Combine filters
 	if len(where) > 0 {
-		query += " WHERE " + strings.Join(where, " AND ")
+		from += " WHERE " + strings.Join(where, " AND ")
 	}
 
-	// Order by event time primarily
-	query += " ORDER BY poc.event_datetime ASC"
+	// Admins of every PoC in the summary, loaded in one query instead of one per row
+	admins, err := activity.Admins(r.Context(), db, "SELECT poc.point_of_contact_id "+from, args)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch point of contact admins")
+		log.Println("DB query error:", err)
+		return
+	}
 
-	rows, err := db.QueryContext(r.Context(), query, args...)
+	// Order by event time primarily
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT
+			poc.point_of_contact_id,
+			a.activity_datetime,
+			poc.event_datetime,
+			poc.duration,
+			poc.event_type,
+			s.student_id,
+			p.first_name,
+			p.preferred_name,
+			p.last_name
+		`+from+`
+		ORDER BY poc.event_datetime ASC
+	`, args...)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch points of contact")
 		log.Println("DB query error:", err)
@@ -456,28 +523,28 @@ func GetPointsOfContactSummary(db *sql.DB, w http.ResponseWriter, r *http.Reques
 	}
 	defer rows.Close()
 
-	type Person struct {
-		ID            int    `json:"id"`
-		FirstName     string `json:"first_name"`
-		PreferredName string `json:"preferred_name"`
-		LastName      string `json:"last_name"`
+	type PointOfContactSummary struct {
+		PointOfContactID int               `json:"point_of_contact_id"`
+		ActivityDateTime time.Time         `json:"activity_datetime"`
+		EventDateTime    time.Time         `json:"event_datetime"`
+		Duration         int               `json:"duration"`
+		EventType        string            `json:"event_type"`
+		Student          activity.Person   `json:"student"`
+		Admins           []activity.Person `json:"admins,omitempty"`
 	}
 
-	type PointOfContactSummary struct {
-		PointOfContactID int       `json:"point_of_contact_id"`
-		ActivityDateTime time.Time `json:"activity_datetime"`
-		EventDateTime    time.Time `json:"event_datetime"`
-		Duration         int       `json:"duration"`
-		EventType        string    `json:"event_type"`
-		Student          Person    `json:"student"`
-		Admins           []Person  `json:"admins,omitempty"`
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "point_of_contact_summary", PointOfContactSummary{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
 	}
 
 	results := make([]PointOfContactSummary, 0)
 
 	for rows.Next() {
 		var poc PointOfContactSummary
-		var student Person
+		var student activity.Person
 
 		if err := rows.Scan(
 			&poc.PointOfContactID,
@@ -490,35 +557,37 @@ func GetPointsOfContactSummary(db *sql.DB, w http.ResponseWriter, r *http.Reques
 			&student.PreferredName,
 			&student.LastName,
 		); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse results")
 			log.Println("Row scan error:", err)
 			return
 		}
 
 		poc.Student = student
+		poc.Admins = admins[poc.PointOfContactID]
 
-		// Admins for this PoC
-		adminRows, _ := db.QueryContext(r.Context(), `
-			SELECT p.person_id, p.first_name, p.preferred_name, p.last_name
-			FROM poc_admin pa
-			INNER JOIN admin a ON a.admin_id = pa.admin_id
-			INNER JOIN person p ON p.person_id = a.admin_id
-			WHERE pa.point_of_contact_id = ?
-		`, poc.PointOfContactID)
-
-		admins := []Person{}
-		for adminRows.Next() {
-			var adm Person
-			if err := adminRows.Scan(&adm.ID, &adm.FirstName, &adm.PreferredName, &adm.LastName); err == nil {
-				admins = append(admins, adm)
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(poc); err != nil {
+				log.Println("Export write error:", err)
+				return
 			}
+			continue
 		}
-		adminRows.Close()
-		poc.Admins = admins
 
 		results = append(results, poc)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational error")
 		log.Println("Rows error:", err)
@@ -545,7 +614,7 @@ func CreatePointOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	poc.ActivityDateTime = time.Now()
 
 	// Validates required fields
-	if poc.StudentID == 0 || poc.Duration == 0 || poc.EventType == "" || poc.EventDateTime.IsZero() {
+	if missingPointOfContactFields(poc) {
 		utils.WriteError(w, http.StatusBadRequest, "Missing required fields")
 		return
 	}
@@ -559,29 +628,16 @@ func CreatePointOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	// Executes written SQL to insert a new activity
-	res, err := tx.ExecContext(r.Context(),
-		`INSERT INTO activity (activity_datetime) VALUES (?)`,
-		poc.ActivityDateTime,
-	)
+	// Inserts the activity row of the new point of contact
+	lastID, err := activity.Create(r.Context(), tx, activity.TypePointOfContact, poc.ActivityDateTime)
 
-	// Error message if ExecContext fails
+	// Error message if Create fails
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to insert activity")
 		log.Println("DB insert activity error:", err)
 		return
 	}
 
-	// Gets the ID of the newly inserted accommodation
-	lastID, err := res.LastInsertId()
-
-	// Error message if LastInsertId fails
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to get last insert ID for activity")
-		log.Println("LastInsertId error:", err)
-		return
-	}
-
 	// Executes written SQL to insert a new point of contact
 	_, err = tx.ExecContext(r.Context(),
 		`INSERT INTO point_of_contact (point_of_contact_id, event_datetime, duration, event_type, student_id) VALUES (?, ?, ?, ?, ?)`,
@@ -595,6 +651,14 @@ func CreatePointOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Queues the webhook event in the same transaction so it is only sent if the insert commits
+	poc.PointOfContactID = int(lastID)
+	if err := webhook.Enqueue(r.Context(), tx, webhook.EventPointOfContactCreated, poc); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to queue webhook event")
+		log.Println("Webhook enqueue error:", err)
+		return
+	}
+
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
@@ -642,7 +706,7 @@ func UpdatePointOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	poc.ActivityDateTime = time.Now()
 
 	// Validates required fields
-	if poc.StudentID == 0 || poc.Duration == 0 || poc.EventType == "" || poc.EventDateTime.IsZero() {
+	if missingPointOfContactFields(poc) {
 		utils.WriteError(w, http.StatusBadRequest, "Missing required fields")
 		return
 	}
@@ -656,37 +720,27 @@ func UpdatePointOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	// Updates the activity table first
-	_, err = tx.ExecContext(r.Context(),
-		`UPDATE activity SET activity_datetime=? WHERE activity_id=?`,
-		poc.ActivityDateTime, pointOfContactID)
-
-	// Error message if ExecContext fails
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to update activity")
-		log.Println("DB update error:", err)
+	// Locks the activity row and checks the If-Match precondition
+	version, err := utils.LockVersion(r.Context(), tx, "activity", "activity_id", pointOfContactID)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "Point of Contact not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch point of contact")
+		log.Println("DB query error:", err)
 		return
 	}
-
-	// Updates the point_of_contact table
-	res, err := tx.ExecContext(r.Context(),
-		`UPDATE point_of_contact SET event_datetime=?, duration=?, event_type=?, student_id=? WHERE point_of_contact_id=?`,
-		poc.EventDateTime, poc.Duration, poc.EventType, poc.StudentID, pointOfContactID)
-
-	// Error message if ExecContext fails
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to update point of contact")
-		log.Println("DB update point_of_contact error:", err)
+	if !utils.CheckIfMatch(w, r, utils.ETag(pointOfContactID, version)) {
 		return
 	}
 
-	// Gets the number of rows affected by the update
-	rowsAffected, err := res.RowsAffected()
+	// Updates the activity and point_of_contact rows
+	rowsAffected, err := updatePointOfContactRows(r.Context(), tx, pointOfContactID, poc)
 
-	// Error message if RowsAffected fails
+	// Error message if the update fails
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to get rows affected")
-		log.Println("RowsAffected error:", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update point of contact")
+		log.Println("DB update point_of_contact error:", err)
 		return
 	}
 
@@ -704,12 +758,13 @@ func UpdatePointOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Writes JSON response confirming update & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(pointOfContactID, version+1))
 	utils.WriteJSON(w, http.StatusOK, map[string]string{
 		"message": "Point of Contact updated successfully",
 	})
 }
 
-func DeletePointOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+func PatchPointOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	// Extracts path variables from the request
 	vars := mux.Vars(r)
 	pointOfContactIDStr, ok := vars["point_of_contact_id"]
@@ -726,7 +781,18 @@ func DeletePointOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Begin a transaction (not strictly required for single multi-table DELETE, but safer)
+	// Reads the JSON Merge Patch document from the request
+	patch, err := utils.ReadMergePatch(r)
+	if err == utils.ErrUnsupportedPatchType {
+		utils.WriteError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/merge-patch+json")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		log.Println("JSON decode error:", err)
+		return
+	}
+
+	// Start transaction
 	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
@@ -735,32 +801,117 @@ func DeletePointOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	// Multi-table delete query:
-	// Deletes from point_of_contact and activity in one go
-	query := `
-		DELETE poc, a
-		FROM point_of_contact poc
-		JOIN activity a ON a.activity_id = poc.point_of_contact_id
-		WHERE poc.point_of_contact_id = ?;
-	`
+	// Loads the current point of contact to merge the patch into
+	current, version, err := fetchPointOfContact(r.Context(), tx, pointOfContactID)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "Point of Contact not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch point of contact")
+		log.Println("DB query error:", err)
+		return
+	}
 
-	// Executes written SQL to delete the student
-	res, err := tx.ExecContext(r.Context(), query, pointOfContactID)
+	// Checks the If-Match precondition against the locked row
+	if !utils.CheckIfMatch(w, r, utils.ETag(pointOfContactID, version)) {
+		return
+	}
 
-	// Error message if ExecContext fails
+	// Applies the patch on top of the current point of contact
+	var poc models.PointOfContact
+	if err := utils.ApplyMergePatch(current, patch, &poc); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid patch document")
+		log.Println("Merge patch error:", err)
+		return
+	}
+
+	// The point of contact ID cannot be changed
+	if poc.PointOfContactID != pointOfContactID {
+		utils.WriteError(w, http.StatusBadRequest, "point_of_contact_id cannot be modified")
+		return
+	}
+
+	// Students cannot move a point of contact to another student
+	if !utils.IsStudentOwner(r, poc.StudentID) {
+		utils.WriteError(w, http.StatusForbidden, "Forbidden: not owner")
+		return
+	}
+
+	// Automatically set activity_datetime to now
+	poc.ActivityDateTime = time.Now()
+
+	// Validates required fields on the merged result
+	if missingPointOfContactFields(poc) {
+		utils.WriteError(w, http.StatusBadRequest, "Missing required fields")
+		return
+	}
+
+	// Updates the activity and point_of_contact rows
+	if _, err := updatePointOfContactRows(r.Context(), tx, pointOfContactID, poc); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update point of contact")
+		log.Println("DB update point_of_contact error:", err)
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
+		log.Println("Transaction commit error:", err)
+		return
+	}
+
+	// Writes the patched point of contact as JSON & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(pointOfContactID, version+1))
+	utils.WriteJSON(w, http.StatusOK, poc)
+}
+
+func DeletePointOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts path variables from the request
+	vars := mux.Vars(r)
+	pointOfContactIDStr, ok := vars["point_of_contact_id"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, "Missing point of contact ID")
+		return
+	}
+
+	// Converts the "point_of_contact_id" string to an integer
+	pointOfContactID, err := strconv.Atoi(pointOfContactIDStr)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete point of contact")
-		log.Println("DB delete error:", err)
+		utils.WriteError(w, http.StatusBadRequest, "Invalid point of contact ID")
+		log.Println("Invalid ID parse error:", err)
 		return
 	}
 
-	// Gets the number of rows affected by the delete
-	rowsAffected, err := res.RowsAffected()
+	// Begin a transaction (not strictly required for single multi-table DELETE, but safer)
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
+		log.Println("BeginTx error:", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Locks the activity row and checks the If-Match precondition
+	version, err := utils.LockVersion(r.Context(), tx, "activity", "activity_id", pointOfContactID)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "No point of contact found for this ID")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch point of contact")
+		log.Println("DB query error:", err)
+		return
+	}
+	if !utils.CheckIfMatch(w, r, utils.ETag(pointOfContactID, version)) {
+		return
+	}
 
-	// Error message if RowsAffected fails
+	// Deletes the point of contact together with its activity row
+	rowsAffected, err := activity.Delete(r.Context(), tx, activity.TypePointOfContact, "poc.point_of_contact_id = ?", pointOfContactID)
+
+	// Error message if Delete fails
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to get rows affected")
-		log.Println("RowsAffected error:", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete point of contact")
+		log.Println("DB delete error:", err)
 		return
 	}
 
@@ -780,7 +931,7 @@ func DeletePointOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	// Respond with success
 	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"message":       "Point of contact " + pointOfContactIDStr + " deleted successfully",
-		"rows_affected": rowsAffected / 2, // Each point of contact involves 2 rows deleted
+		"rows_affected": rowsAffected,
 	})
 }
 
@@ -804,12 +955,6 @@ func DeletePointsOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	// Build the base multi-table delete query dynamically
-	query := `
-		DELETE poc, a
-		FROM point_of_contact poc
-		JOIN activity a ON a.activity_id = poc.point_of_contact_id
-	`
 	var args []interface{}
 	var whereClauses []string
 
@@ -824,39 +969,25 @@ func DeletePointsOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		args = append(args, studentID)
 	}
 
-	// Add filter for admin_id (through poc_admin join)
+	// Add filter for admin_id (through poc_admin)
 	if adminIDStr != "" {
 		adminID, err := strconv.Atoi(adminIDStr)
 		if err != nil {
 			utils.WriteError(w, http.StatusBadRequest, "Invalid admin_id")
 			return
 		}
-		query += " JOIN poc_admin pa ON pa.point_of_contact_id = poc.point_of_contact_id"
-		whereClauses = append(whereClauses, "pa.admin_id = ?")
+		whereClauses = append(whereClauses, "poc.point_of_contact_id IN (SELECT pa.point_of_contact_id FROM poc_admin pa WHERE pa.admin_id = ?)")
 		args = append(args, adminID)
 	}
 
-	// Combine conditions
-	if len(whereClauses) > 0 {
-		query += " WHERE " + strings.Join(whereClauses, " AND ")
-	}
-
-	// Execute delete query
-	res, err := tx.ExecContext(r.Context(), query, args...)
+	// Deletes the matching points of contact together with their activity rows
+	rowsAffected, err := activity.Delete(r.Context(), tx, activity.TypePointOfContact, strings.Join(whereClauses, " AND "), args...)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete point(s) of contact")
 		log.Println("Delete query error:", err)
 		return
 	}
 
-	// Get affected rows
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to get rows affected")
-		log.Println("RowsAffected error:", err)
-		return
-	}
-
 	// Handle no matches
 	if rowsAffected == 0 {
 		utils.WriteError(w, http.StatusNotFound, "No points of contact found for given filters")
@@ -876,3 +1007,77 @@ func DeletePointsOfContact(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		"rows_affected": rowsAffected,
 	})
 }
+
+// fetchPointOfContact loads a single point of contact joined with its activity row and returns its row version.
+// The rows are locked when called inside a transaction.
+func fetchPointOfContact(ctx context.Context, q utils.DBTX, pointOfContactID int) (models.PointOfContact, int, error) {
+	// All data being selected for this GET command
+	query := `
+		SELECT
+    		poc.point_of_contact_id,
+    		a.activity_datetime,
+    		poc.event_datetime,
+    		poc.duration,
+    		poc.event_type,
+    		poc.student_id,
+    		a.version
+		FROM point_of_contact poc
+		JOIN activity a ON poc.point_of_contact_id = a.activity_id
+		WHERE poc.point_of_contact_id = ?
+	`
+	if _, ok := q.(*sql.Tx); ok {
+		query += " FOR UPDATE"
+	}
+
+	// Empty variables for PointOfContact struct and row version
+	var poc models.PointOfContact
+	var version int
+
+	// Executes written SQL and retrieves only one row
+	err := q.QueryRowContext(ctx, query, pointOfContactID).Scan(
+		&poc.PointOfContactID,
+		&poc.ActivityDateTime,
+		&poc.EventDateTime,
+		&poc.Duration,
+		&poc.EventType,
+		&poc.StudentID,
+		&version,
+	)
+
+	return poc, version, err
+}
+
+// missingPointOfContactFields reports whether any required point of contact field is empty
+func missingPointOfContactFields(poc models.PointOfContact) bool {
+	return poc.StudentID == 0 || poc.Duration == 0 || poc.EventType == "" || poc.EventDateTime.IsZero()
+}
+
+// updatePointOfContactRows writes a point of contact to the activity and point_of_contact tables,
+// bumps the activity row version and queues the point_of_contact.updated event
+func updatePointOfContactRows(ctx context.Context, tx *sql.Tx, pointOfContactID int, poc models.PointOfContact) (int64, error) {
+	// Updates the activity table first
+	_, err := tx.ExecContext(ctx,
+		`UPDATE activity SET activity_datetime=?, version=version+1 WHERE activity_id=?`,
+		poc.ActivityDateTime, pointOfContactID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Updates the point_of_contact table
+	res, err := tx.ExecContext(ctx,
+		`UPDATE point_of_contact SET event_datetime=?, duration=?, event_type=?, student_id=? WHERE point_of_contact_id=?`,
+		poc.EventDateTime, poc.Duration, poc.EventType, poc.StudentID, pointOfContactID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Gets the number of rows affected by the update
+	rowsAffected, err := res.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		return rowsAffected, err
+	}
+
+	// Queues the webhook event in the same transaction
+	poc.PointOfContactID = pointOfContactID
+	return rowsAffected, webhook.Enqueue(ctx, tx, webhook.EventPointOfContactUpdated, poc)
+}
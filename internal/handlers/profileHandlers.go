@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/studentstore"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/activity"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/disabilitylink"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+	"github.com/gorilla/mux"
+	"strings"
+)
+
+// profileSections are the parts of a student profile, in response order
+var profileSections = []string{"student", "disabilities", "accommodations", "upcoming", "recent", "documents", "pinned_by"}
+
+// adminProfileSections are only shown to admins, like the routes they come from
+var adminProfileSections = map[string]bool{"pinned_by": true}
+
+// profileAppointment is a point of contact on a student profile together with its admins
+type profileAppointment struct {
+	PointOfContactID int               `json:"point_of_contact_id"`
+	EventDateTime    time.Time         `json:"event_datetime"`
+	Duration         int               `json:"duration"`
+	EventType        string            `json:"event_type"`
+	Admins           []activity.Person `json:"admins"`
+}
+
+// studentProfile leaves out the sections that were not requested
+type studentProfile struct {
+	Student        *models.Student                 `json:"student,omitempty"`
+	Disabilities   *[]models.Disability            `json:"disabilities,omitempty"`
+	Accommodations *[]models.Accommodation         `json:"accommodations,omitempty"`
+	Upcoming       *[]profileAppointment           `json:"upcoming,omitempty"`
+	Recent         *[]profileAppointment           `json:"recent,omitempty"`
+	Documents      *[]models.SpecificDocumentation `json:"documents,omitempty"`
+	PinnedBy       *[]activity.Person              `json:"pinned_by,omitempty"`
+}
+
+func GetStudentProfile(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts path variables from the request
+	vars := mux.Vars(r)
+	idStr, ok := vars["student_id"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, "Missing student ID")
+		return
+	}
+
+	// Converts the "student_id" string to an integer
+	studentID, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid student ID")
+		log.Println("Invalid ID parse error:", err)
+		return
+	}
+
+	// Every section by default, admin only sections are left out for students and refused when they ask for them
+	role, _ := r.Context().Value(utils.RoleKey).(string)
+	isAdmin := role == "admin" || role == "superadmin"
+	include := map[string]bool{}
+	if includeStr := r.URL.Query().Get("include"); includeStr != "" {
+		for _, name := range strings.Split(includeStr, ",") {
+			name = strings.TrimSpace(name)
+			if !isProfileSection(name) {
+				utils.WriteError(w, http.StatusBadRequest, "Unknown profile section: "+name)
+				return
+			}
+			if adminProfileSections[name] && !isAdmin {
+				utils.WriteError(w, http.StatusForbidden, "Forbidden: "+name+" is only shown to admins")
+				return
+			}
+			include[name] = true
+		}
+	} else {
+		for _, name := range profileSections {
+			include[name] = isAdmin || !adminProfileSections[name]
+		}
+	}
+
+	// Optional number of upcoming and recent appointments
+	limit := 10
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 100 {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid limit (1-100)")
+			return
+		}
+	}
+
+	// Loads the sections concurrently, the first failure cancels the others
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var profile studentProfile
+	var student models.Student
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	load := func(fn func(ctx context.Context) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(ctx); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}()
+	}
+
+	// The student is always loaded so a missing student is a 404 whatever was included
+	load(func(ctx context.Context) error {
+		var err error
+		student, _, err = studentstore.Fetch(ctx, db, studentID)
+		return err
+	})
+	if include["disabilities"] {
+		profile.Disabilities = &[]models.Disability{}
+		load(func(ctx context.Context) error {
+			return profileDisabilities(ctx, db, studentID, profile.Disabilities)
+		})
+	}
+	if include["accommodations"] {
+		profile.Accommodations = &[]models.Accommodation{}
+		load(func(ctx context.Context) error {
+			return profileAccommodations(ctx, db, studentID, profile.Accommodations)
+		})
+	}
+	now := time.Now().UTC()
+	if include["upcoming"] {
+		profile.Upcoming = &[]profileAppointment{}
+		load(func(ctx context.Context) error {
+			return profileAppointments(ctx, db, "poc.student_id = ? AND poc.event_datetime >= ? ORDER BY poc.event_datetime ASC",
+				[]any{studentID, now, limit}, profile.Upcoming)
+		})
+	}
+	if include["recent"] {
+		profile.Recent = &[]profileAppointment{}
+		load(func(ctx context.Context) error {
+			return profileAppointments(ctx, db, "poc.student_id = ? AND poc.event_datetime < ? ORDER BY poc.event_datetime DESC",
+				[]any{studentID, now, limit}, profile.Recent)
+		})
+	}
+	if include["documents"] {
+		profile.Documents = &[]models.SpecificDocumentation{}
+		load(func(ctx context.Context) error {
+			return profileDocuments(ctx, db, studentID, profile.Documents)
+		})
+	}
+	if include["pinned_by"] {
+		profile.PinnedBy = &[]activity.Person{}
+		load(func(ctx context.Context) error {
+			return profilePinnedBy(ctx, db, studentID, profile.PinnedBy)
+		})
+	}
+	wg.Wait()
+
+	// Error message if no rows are found
+	if firstErr == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "Student not found")
+		return
+		// Error message if any section failed
+	} else if firstErr != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch student profile")
+		log.Println("DB query error:", firstErr)
+		return
+	}
+	if include["student"] {
+		profile.Student = &student
+	}
+
+	// Writes JSON response & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, profile)
+}
+
+// isProfileSection reports whether name is a section include= accepts
+func isProfileSection(name string) bool {
+	for _, section := range profileSections {
+		if section == name {
+			return true
+		}
+	}
+	return false
+}
+
+// profileDisabilities loads the disabilities a student has
+func profileDisabilities(ctx context.Context, db *sql.DB, studentID int, dst *[]models.Disability) error {
+	// The links are read first, sealed links cannot be joined to disability
+	links, err := disabilitylink.ForStudents(ctx, db, studentID)
+	if err != nil || len(links) == 0 {
+		return err
+	}
+	ids := disabilitylink.DisabilityIDs(links)
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT disability_id, name, description
+		FROM disability
+		WHERE disability_id IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")+`)
+		ORDER BY name
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.Disability
+		if err := rows.Scan(&d.DisabilityID, &d.Name, &d.Description); err != nil {
+			return err
+		}
+		*dst = append(*dst, d)
+	}
+	return rows.Err()
+}
+
+// profileAccommodations loads the accommodations a student was granted
+func profileAccommodations(ctx context.Context, db *sql.DB, studentID int, dst *[]models.Accommodation) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT a.accommodation_id, a.name, a.description
+		FROM stu_accom sa
+		INNER JOIN accommodation a ON a.accommodation_id = sa.accommodation_id
+		WHERE sa.student_id = ?
+		ORDER BY a.name
+	`, studentID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a models.Accommodation
+		if err := rows.Scan(&a.AccommodationID, &a.Name, &a.Description); err != nil {
+			return err
+		}
+		*dst = append(*dst, a)
+	}
+	return rows.Err()
+}
+
+// profileAppointments loads the points of contact matching condition, which ends with its ORDER BY,
+// and then their admins in one query
+func profileAppointments(ctx context.Context, db *sql.DB, condition string, args []any, dst *[]profileAppointment) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT poc.point_of_contact_id, poc.event_datetime, poc.duration, poc.event_type
+		FROM point_of_contact poc
+		WHERE `+condition+`
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var ids []any
+	for rows.Next() {
+		var a profileAppointment
+		if err := rows.Scan(&a.PointOfContactID, &a.EventDateTime, &a.Duration, &a.EventType); err != nil {
+			return err
+		}
+		a.Admins = []activity.Person{}
+		*dst = append(*dst, a)
+		ids = append(ids, a.PointOfContactID)
+	}
+	if err := rows.Err(); err != nil || len(ids) == 0 {
+		return err
+	}
+
+	// MySQL does not take LIMIT in an IN subquery, so the admins are matched on the IDs just read
+	admins, err := activity.Admins(ctx, db, strings.TrimSuffix(strings.Repeat("?,", len(ids)), ","), ids)
+	if err != nil {
+		return err
+	}
+	for i := range *dst {
+		if list, ok := admins[(*dst)[i].PointOfContactID]; ok {
+			(*dst)[i].Admins = list
+		}
+	}
+	return nil
+}
+
+// profileDocuments loads the metadata of a student's documents that are not in the trash, newest first
+func profileDocuments(ctx context.Context, db *sql.DB, studentID int, dst *[]models.SpecificDocumentation) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT
+			sd.specific_documentation_id,
+			sd.student_id,
+			sd.doc_type,
+			a.activity_datetime,
+			d.file_name,
+			d.storage_key,
+			d.mime_type,
+			d.size_bytes,
+			d.uploaded_by
+		FROM specific_documentation sd
+		JOIN activity a ON sd.specific_documentation_id = a.activity_id
+		JOIN documentation d ON sd.specific_documentation_id = d.documentation_id
+		WHERE d.deleted_at IS NULL AND sd.student_id = ?
+		ORDER BY a.activity_datetime DESC
+	`, studentID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sd models.SpecificDocumentation
+		if err := rows.Scan(
+			&sd.SpecificDocumentationID,
+			&sd.StudentID,
+			&sd.DocType,
+			&sd.ActivityDateTime,
+			&sd.FileName,
+			&sd.StorageKey,
+			&sd.MimeType,
+			&sd.SizeBytes,
+			&sd.UploadedBy,
+		); err != nil {
+			return err
+		}
+		*dst = append(*dst, sd)
+	}
+	return rows.Err()
+}
+
+// profilePinnedBy loads the admins who pinned a student
+func profilePinnedBy(ctx context.Context, db *sql.DB, studentID int, dst *[]activity.Person) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT p.person_id, p.first_name, p.preferred_name, p.last_name
+		FROM pinned pn
+		INNER JOIN person p ON p.person_id = pn.admin_id
+		WHERE pn.student_id = ? AND p.deleted_at IS NULL
+		ORDER BY p.last_name, p.first_name
+	`, studentID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var adm activity.Person
+		if err := rows.Scan(&adm.ID, &adm.FirstName, &adm.PreferredName, &adm.LastName); err != nil {
+			return err
+		}
+		*dst = append(*dst, adm)
+	}
+	return rows.Err()
+}
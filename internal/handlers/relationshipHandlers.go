@@ -6,9 +6,14 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/disabilitylink"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/export"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/webhook"
 
 	"github.com/gorilla/mux"
 
@@ -33,6 +38,13 @@ func GetPinned(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "pinned", models.Pinned{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	pinnedList := make([]models.Pinned, 0)
 
@@ -41,14 +53,34 @@ func GetPinned(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		var p models.Pinned
 		// Parses the current data into fields of "p" variable
 		if err := rows.Scan(&p.AdminID, &p.StudentID); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse pinned record")
 			log.Println("Row scan error:", err)
 			return
 		}
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(p); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		// Adds the obtained data to the slice
 		pinnedList = append(pinnedList, p)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -138,7 +170,7 @@ func GetPinnedByAdminID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		FROM pinned p
 		JOIN student s ON p.student_id = s.student_id
 		JOIN person pe ON s.student_id = pe.person_id
-		WHERE p.admin_id = ?
+		WHERE p.admin_id = ? AND pe.deleted_at IS NULL
 	`
 
 	// Executes written SQL
@@ -152,6 +184,13 @@ func GetPinnedByAdminID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "pinned_students", models.Student{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	students := make([]models.Student, 0)
 
@@ -161,17 +200,41 @@ func GetPinnedByAdminID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		// Parses the current row into student struct
 		if err := rows.Scan(
 			&s.StudentID, &s.FirstName, &s.PreferredName, &s.MiddleName, &s.LastName,
-			&s.Email, &s.PhoneNumber, &s.Pronouns, &s.Sex, &s.Gender, &s.Birthday,
-			&s.Address, &s.City, &s.State, &s.ZipCode, &s.Country,
+			fieldcrypt.Scan(fieldcrypt.PersonEmail, &s.Email),
+			fieldcrypt.Scan(fieldcrypt.PersonPhoneNumber, &s.PhoneNumber),
+			&s.Pronouns, &s.Sex, &s.Gender,
+			fieldcrypt.Scan(fieldcrypt.PersonBirthday, &s.Birthday),
+			fieldcrypt.Scan(fieldcrypt.PersonAddress, &s.Address),
+			&s.City, &s.State, &s.ZipCode, &s.Country,
 			&s.Year, &s.StartYear, &s.PlannedGradYear, &s.Housing, &s.Dining,
 		); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse student record")
 			log.Println("Row scan error:", err)
 			return
 		}
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(s); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		students = append(students, s)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -184,6 +247,11 @@ func GetPinnedByAdminID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 }
 
 func CreatePinned(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Runs in its own transaction, /batch runs the same code inside a shared one
+	runInTx(db, w, r, createPinned)
+}
+
+func createPinned(tx *sql.Tx, w http.ResponseWriter, r *http.Request) {
 	// Empty variable for request struct
 	var req models.Pinned
 	decoder := json.NewDecoder(r.Body)
@@ -201,7 +269,7 @@ func CreatePinned(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Executes written SQL to insert pinned record
-	_, err := db.ExecContext(r.Context(),
+	_, err := tx.ExecContext(r.Context(),
 		"INSERT INTO pinned (admin_id, student_id) VALUES (?, ?)",
 		req.AdminID, req.StudentID,
 	)
@@ -220,6 +288,11 @@ func CreatePinned(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 }
 
 func DeletePinned(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Runs in its own transaction, /batch runs the same code inside a shared one
+	runInTx(db, w, r, deletePinned)
+}
+
+func deletePinned(tx *sql.Tx, w http.ResponseWriter, r *http.Request) {
 	// Parse query params
 	adminIDStr := r.URL.Query().Get("admin_id")
 	studentIDStr := r.URL.Query().Get("student_id")
@@ -255,7 +328,7 @@ func DeletePinned(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Executes written SQL to delete pinned record
-	res, err := db.ExecContext(r.Context(), query, args...)
+	res, err := tx.ExecContext(r.Context(), query, args...)
 
 	// Error message if ExecContext fails
 	if err != nil {
@@ -298,6 +371,13 @@ func GetStuAccom(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "stu_accom", models.StudentAccommodation{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	stuAccomList := make([]models.StudentAccommodation, 0)
 
@@ -306,14 +386,34 @@ func GetStuAccom(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		var sa models.StudentAccommodation
 		// Parses the current data into fields of "sa" variable
 		if err := rows.Scan(&sa.StudentID, &sa.AccommodationID); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse student accommodation")
 			log.Println("Row scan error:", err)
 			return
 		}
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(sa); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		// Adds the obtained data to the slice
 		stuAccomList = append(stuAccomList, sa)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -326,6 +426,11 @@ func GetStuAccom(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 }
 
 func CreateStuAccom(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Runs in its own transaction, /batch runs the same code inside a shared one
+	runInTx(db, w, r, createStuAccom)
+}
+
+func createStuAccom(tx *sql.Tx, w http.ResponseWriter, r *http.Request) {
 	// Empty variable for request struct
 	var req models.StudentAccommodation
 	decoder := json.NewDecoder(r.Body)
@@ -343,9 +448,9 @@ func CreateStuAccom(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Executes written SQL to insert student accommodation record
-	_, err := db.ExecContext(r.Context(),
-		"INSERT INTO stu_accom (student_id, accommodation_id) VALUES (?, ?)",
-		req.StudentID, req.AccommodationID,
+	_, err := tx.ExecContext(r.Context(),
+		"INSERT INTO stu_accom (student_id, accommodation_id, granted_at) VALUES (?, ?, ?)",
+		req.StudentID, req.AccommodationID, time.Now().UTC(),
 	)
 
 	// Error message if ExecContext fails
@@ -355,6 +460,13 @@ func CreateStuAccom(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Queues the webhook event in the same transaction so it is only sent if the grant commits
+	if err := webhook.Enqueue(r.Context(), tx, webhook.EventAccommodationGranted, req); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to queue webhook event")
+		log.Println("Webhook enqueue error:", err)
+		return
+	}
+
 	// Writes JSON response confirming creation & sends a HTTP 201 response code
 	utils.WriteJSON(w, http.StatusCreated, map[string]string{
 		"message": "Student accommodation created successfully",
@@ -362,6 +474,11 @@ func CreateStuAccom(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 }
 
 func DeleteStuAccom(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Runs in its own transaction, /batch runs the same code inside a shared one
+	runInTx(db, w, r, deleteStuAccom)
+}
+
+func deleteStuAccom(tx *sql.Tx, w http.ResponseWriter, r *http.Request) {
 	// Parse query params
 	studentIDStr := r.URL.Query().Get("student_id")
 	accomIDStr := r.URL.Query().Get("accommodation_id")
@@ -399,7 +516,7 @@ func DeleteStuAccom(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Executes written SQL to delete student-accommodation record(s)
-	res, err := db.ExecContext(r.Context(), query, args...)
+	res, err := tx.ExecContext(r.Context(), query, args...)
 
 	// Error message if ExecContext fails
 	if err != nil {
@@ -425,43 +542,45 @@ func DeleteStuAccom(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 }
 
 func GetStuDis(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	// All data being selected for this GET command
-	query := `
-		SELECT student_id, disability_id
-		FROM stu_dis
-	`
-
-	// Executes written SQL
-	rows, err := db.QueryContext(r.Context(), query)
+	// Reads every link, sealed disability IDs are decrypted by disabilitylink
+	links, err := disabilitylink.All(r.Context(), db)
 
-	// Error message if QueryContext fails
+	// Error message if the links cannot be read
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to obtain student disabilities")
 		log.Println("DB query error:", err)
 		return
 	}
-	defer rows.Close()
 
-	// Creates an empty slice to obtain results
-	stuDisList := make([]models.StudentDisability, 0)
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "stu_dis", models.StudentDisability{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
 
-	// Reads each row returned by the database
-	for rows.Next() {
-		var sd models.StudentDisability
-		// Parses the current data into fields of "sd" variable
-		if err := rows.Scan(&sd.StudentID, &sd.DisabilityID); err != nil {
-			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse student disability")
-			log.Println("Row scan error:", err)
-			return
+	// Creates an empty slice to obtain results
+	stuDisList := make([]models.StudentDisability, 0, len(links))
+
+	// Converts each link into the response shape
+	for _, link := range links {
+		sd := models.StudentDisability{StudentID: link.StudentID, DisabilityID: link.DisabilityID}
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(sd); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
 		}
+
 		// Adds the obtained data to the slice
 		stuDisList = append(stuDisList, sd)
 	}
 
-	// Checks for errors during iteration such as network interruptions and driver errors
-	if err := rows.Err(); err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
-		log.Println("Rows error:", err)
+	// Finishes the export
+	if out != nil {
+		out.Close(nil)
 		return
 	}
 
@@ -470,6 +589,11 @@ func GetStuDis(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 }
 
 func CreateStuDis(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Runs in its own transaction, /batch runs the same code inside a shared one
+	runInTx(db, w, r, createStuDis)
+}
+
+func createStuDis(tx *sql.Tx, w http.ResponseWriter, r *http.Request) {
 	// Empty variable for request struct
 	var req models.StudentDisability
 	decoder := json.NewDecoder(r.Body)
@@ -486,11 +610,8 @@ func CreateStuDis(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Executes written SQL to insert student disability record
-	_, err := db.ExecContext(r.Context(),
-		"INSERT INTO stu_dis (student_id, disability_id) VALUES (?, ?)",
-		req.StudentID, req.DisabilityID,
-	)
+	// Inserts the link, sealing the disability when stu_dis is encrypted
+	err := disabilitylink.Add(r.Context(), tx, req.StudentID, req.DisabilityID, time.Now().UTC())
 
 	// Error message if ExecContext fails
 	if err != nil {
@@ -506,6 +627,11 @@ func CreateStuDis(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 }
 
 func DeleteStuDis(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Runs in its own transaction, /batch runs the same code inside a shared one
+	runInTx(db, w, r, deleteStuDis)
+}
+
+func deleteStuDis(tx *sql.Tx, w http.ResponseWriter, r *http.Request) {
 	// Parse query params
 	studentIDStr := r.URL.Query().Get("student_id")
 	disabilityIDStr := r.URL.Query().Get("disability_id")
@@ -516,43 +642,36 @@ func DeleteStuDis(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build base query dynamically
-	query := "DELETE FROM stu_dis WHERE 1=1"
-	var args []interface{}
+	// Zero matches every student or disability
+	var studentID, disabilityID int
+	var err error
 
 	if studentIDStr != "" {
-		studentID, err := strconv.Atoi(studentIDStr)
+		studentID, err = strconv.Atoi(studentIDStr)
 		if err != nil {
 			utils.WriteError(w, http.StatusBadRequest, "Invalid student_id")
 			return
 		}
-		query += " AND student_id = ?"
-		args = append(args, studentID)
 	}
 
 	if disabilityIDStr != "" {
-		disabilityID, err := strconv.Atoi(disabilityIDStr)
+		disabilityID, err = strconv.Atoi(disabilityIDStr)
 		if err != nil {
 			utils.WriteError(w, http.StatusBadRequest, "Invalid disability_id")
 			return
 		}
-		query += " AND disability_id = ?"
-		args = append(args, disabilityID)
 	}
 
-	// Executes written SQL to delete student_disability record
-	res, err := db.ExecContext(r.Context(), query, args...)
+	// Deletes the matching links, sealed links are found through their blind index
+	rowsAffected, err := disabilitylink.Delete(r.Context(), tx, studentID, disabilityID)
 
-	// Error message if ExecContext fails
+	// Error message if the delete fails
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete student_disability record(s)")
 		log.Println("Delete error:", err)
 		return
 	}
 
-	// Get number of rows affected
-	rowsAffected, _ := res.RowsAffected()
-
 	// Error message if no rows were deleted and it was a single delete
 	if studentIDStr != "" && disabilityIDStr != "" && rowsAffected == 0 {
 		utils.WriteError(w, http.StatusNotFound, "No stu_dis records found to delete")
@@ -584,6 +703,13 @@ func GetPocAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "poc_admin", models.PocAdmin{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	pocAdmins := make([]models.PocAdmin, 0)
 
@@ -592,14 +718,34 @@ func GetPocAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		var pa models.PocAdmin
 		// Parses the current data into fields of "pa" variable
 		if err := rows.Scan(&pa.PointOfContactID, &pa.AdminID); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to parse POC admin")
 			log.Println("Row scan error:", err)
 			return
 		}
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(pa); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		// Adds the obtained data to the slice
 		pocAdmins = append(pocAdmins, pa)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -612,6 +758,11 @@ func GetPocAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 }
 
 func CreatePocAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Runs in its own transaction, /batch runs the same code inside a shared one
+	runInTx(db, w, r, createPocAdmin)
+}
+
+func createPocAdmin(tx *sql.Tx, w http.ResponseWriter, r *http.Request) {
 	// Empty variable for request struct
 	var req models.PocAdmin
 	decoder := json.NewDecoder(r.Body)
@@ -629,7 +780,7 @@ func CreatePocAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Executes written SQL to insert POC admin record
-	_, err := db.ExecContext(r.Context(),
+	_, err := tx.ExecContext(r.Context(),
 		"INSERT INTO poc_admin (point_of_contact_id, admin_id) VALUES (?, ?)",
 		req.PointOfContactID, req.AdminID,
 	)
@@ -648,6 +799,11 @@ func CreatePocAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 }
 
 func DeletePocAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Runs in its own transaction, /batch runs the same code inside a shared one
+	runInTx(db, w, r, deletePocAdmin)
+}
+
+func deletePocAdmin(tx *sql.Tx, w http.ResponseWriter, r *http.Request) {
 	// Parse query params
 	pocIDStr := r.URL.Query().Get("point_of_contact_id")
 	adminIDStr := r.URL.Query().Get("admin_id")
@@ -685,7 +841,7 @@ func DeletePocAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Executes written SQL to delete poc-admin record(s)
-	res, err := db.ExecContext(r.Context(), query, args...)
+	res, err := tx.ExecContext(r.Context(), query, args...)
 
 	// Error message if ExecContext fails
 	if err != nil {
@@ -1,19 +1,25 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"time"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/activity"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/docstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/docversion"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/export"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/scanner"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/uploadpolicy"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/webhook"
 	"github.com/gorilla/mux"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -31,13 +37,14 @@ func GetSpecificDocumentations(db *sql.DB, w http.ResponseWriter, r *http.Reques
 			sd.doc_type,
 			a.activity_datetime,
 			d.file_name,
-			d.file_path,
+			d.storage_key,
 			d.mime_type,
 			d.size_bytes,
 			d.uploaded_by
 		FROM specific_documentation sd
 		JOIN activity a ON sd.specific_documentation_id = a.activity_id
 		JOIN documentation d ON sd.specific_documentation_id = d.documentation_id
+		WHERE d.deleted_at IS NULL
 	`
 
 	args := []any{}
@@ -51,7 +58,7 @@ func GetSpecificDocumentations(db *sql.DB, w http.ResponseWriter, r *http.Reques
 			log.Println("Invalid ID parse error:", err)
 			return
 		}
-		query += " WHERE sd.student_id = ?"
+		query += " AND sd.student_id = ?"
 		args = append(args, studentID)
 	}
 
@@ -64,6 +71,13 @@ func GetSpecificDocumentations(db *sql.DB, w http.ResponseWriter, r *http.Reques
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "specific_documentation", models.SpecificDocumentation{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	specificDocumentation := make([]models.SpecificDocumentation, 0)
 
@@ -77,19 +91,39 @@ func GetSpecificDocumentations(db *sql.DB, w http.ResponseWriter, r *http.Reques
 			&sd.DocType,
 			&sd.ActivityDateTime,
 			&sd.FileName,
-			&sd.FilePath,
+			&sd.StorageKey,
 			&sd.MimeType,
 			&sd.SizeBytes,
 			&sd.UploadedBy,
 		); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to scan specific documentation")
 			log.Println("Row scan error:", err)
 			return
 		}
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(sd); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		// Adds the obtained data to the slice
 		specificDocumentation = append(specificDocumentation, sd)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -118,39 +152,9 @@ func GetSpecificDocumentationByID(db *sql.DB, w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	// SQL query to select a single specific_documentation
-	query := `
-		SELECT
-			sd.specific_documentation_id,
-			sd.student_id,
-			sd.doc_type,
-			a.activity_datetime,
-			d.file_name,
-			d.file_path,
-			d.mime_type,
-			d.size_bytes,
-			d.uploaded_by
-		FROM specific_documentation sd
-		JOIN activity a ON sd.specific_documentation_id = a.activity_id
-		JOIN documentation d ON sd.specific_documentation_id = d.documentation_id
-		WHERE sd.specific_documentation_id = ?
-	`
-
-	// Empty variable for specific_documentation struct
-	var sd models.SpecificDocumentation
+	// Fetches the specific documentation from the database
+	sd, version, err := fetchSpecificDocumentation(r.Context(), db, specificDocumentationID)
 
-	// Executes query
-	err = db.QueryRowContext(r.Context(), query, specificDocumentationID).Scan(
-		&sd.SpecificDocumentationID,
-		&sd.StudentID,
-		&sd.DocType,
-		&sd.ActivityDateTime,
-		&sd.FileName,
-		&sd.FilePath,
-		&sd.MimeType,
-		&sd.SizeBytes,
-		&sd.UploadedBy,
-	)
 	// Error message if no rows are found
 	if err == sql.ErrNoRows {
 		utils.WriteError(w, http.StatusNotFound, "Specific documentation not found")
@@ -162,15 +166,23 @@ func GetSpecificDocumentationByID(db *sql.DB, w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	// Writes JSON response & sends a HTTP 200 response code
+	// Writes JSON response with the row version as ETag & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(specificDocumentationID, version))
 	utils.WriteJSON(w, http.StatusOK, sd)
 }
 
 func CreateSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	// Parses multipart form data from the request with a maximum upload size of 20MB
+	// Caps the request body at the largest file the upload policy accepts
+	if err := uploadpolicy.LimitBody(w, r); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Upload policy is not configured")
+		log.Println("Upload policy error:", err)
+		return
+	}
+
+	// Parses multipart form data from the request, keeping up to 20MB in memory
 	err := r.ParseMultipartForm(20 << 20)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, "Failed to parse form data")
+		writeUploadError(w, uploadpolicy.FormError(err), http.StatusBadRequest, "Failed to parse form data")
 		log.Println("Form parse error:", err)
 		return
 	}
@@ -193,79 +205,78 @@ func CreateSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Begins a new database transaction
-	tx, err := db.BeginTx(r.Context(), nil)
+	// Retrieves the uploaded file from the form
+	file, header, err := r.FormFile("file")
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
-		log.Println("BeginTx error:", err)
+		writeUploadError(w, uploadpolicy.FormError(err), http.StatusBadRequest, "Missing file in request")
+		log.Println("Form file error:", err)
 		return
 	}
-	defer tx.Rollback()
+	defer file.Close()
 
-	// Inserts a new activity record with the current timestamp
-	now := time.Now()
-	res, err := tx.ExecContext(r.Context(), "INSERT INTO activity (activity_datetime) VALUES (?)", now)
+	// Detects the file's MIME type from its content and checks it and the size against the doc_type's policy
+	mimeType, err := uploadpolicy.Validate(file, header.Size, docType)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to insert activity")
-		log.Println("Insert activity error:", err)
+		writeUploadError(w, err, http.StatusInternalServerError, "Failed to check uploaded file")
+		log.Println("Upload validation error:", err)
 		return
 	}
+	fileName := uploadpolicy.FileName(header.Filename)
 
-	// Retrieves the automatically generated activity_id from the database
-	activityID, err := res.LastInsertId()
+	// Scans the file for malware before anything is stored
+	scan, err := scanDocument(r.Context(), file)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve inserted activity ID")
-		log.Println("LastInsertId error:", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to scan uploaded file")
+		log.Println("Malware scan error:", err)
 		return
 	}
 
-	// Retrieves the uploaded file from the form
-	file, header, err := r.FormFile("file")
+	// Begins a new database transaction
+	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, "Missing file in request")
-		log.Println("Form file error:", err)
-		return
-	}
-	defer file.Close()
-
-	// Defines file storage directory and constructs a unique filename
-	dstDir := "/home/piconex/database/files/specific"
-	if err := os.MkdirAll(dstDir, 0755); err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to ensure specific folder")
-		log.Println("MkdirAll error:", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
+		log.Println("BeginTx error:", err)
 		return
 	}
-	safeFileName := fmt.Sprintf("%d_%s", activityID, filepath.Base(header.Filename))
-	fullPath := filepath.Join(dstDir, safeFileName)
+	defer tx.Rollback()
 
-	// Creates a new file at the destination path
-	dst, err := os.Create(fullPath)
+	// Inserts a new activity record with the current timestamp
+	now := time.Now()
+	activityID, err := activity.Create(r.Context(), tx, activity.TypeSpecificDocumentation, now)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to create file on server")
-		log.Println("File create error:", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to insert activity")
+		log.Println("Insert activity error:", err)
 		return
 	}
-	defer dst.Close()
 
-	// Copies the uploaded file content into the newly created file
-	sizeBytes, err := io.Copy(dst, file)
+	// Saves the file in the document store under the digest of its content, encrypted when field encryption keys are configured,
+	// or in quarantine when the scan found it infected
+	stored, err := storeDocument(r.Context(), db, tx, file, header, scan)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to save uploaded file")
-		log.Println("File write error:", err)
+		log.Println("File store error:", err)
 		return
 	}
 
-	// Detects the file's MIME type from the uploaded header
-	mimeType := header.Header.Get("Content-Type")
-	if mimeType == "" {
-		mimeType = "application/octet-stream"
-	}
+	// Deletes the stored file again unless the upload commits, its blob row rolls back with tx
+	committed := false
+	defer func() {
+		if !committed {
+			discardDocument(db, tx, stored)
+		}
+	}()
 
-	// Inserts a new record into the documentation table with file metadata
+	// Inserts a new record into the documentation table with file metadata, uploaded by the caller
+	var uploadedBy any
+	if userID, ok := r.Context().Value(utils.UserIDKey).(int); ok && userID > 0 {
+		uploadedBy = userID
+	}
 	_, err = tx.ExecContext(r.Context(),
-		`INSERT INTO documentation (documentation_id, file_name, file_path, mime_type, size_bytes, uploaded_by)
-		 VALUES (?, ?, ?, ?, ?, ?)`,
-		activityID, header.Filename, fullPath, mimeType, sizeBytes, 5, // uploaded_by temporarily set to 5
+		`INSERT INTO documentation (documentation_id, file_name, storage_key, content_sha256, mime_type, size_bytes, uploaded_by,
+			scan_status, scan_signature, scanned_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		activityID, fileName, stored.Key, stored.Digest, mimeType, stored.Size, uploadedBy,
+		scan.Status, scan.Signature, scan.ScannedAt,
 	)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to insert documentation metadata")
@@ -273,6 +284,13 @@ func CreateSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Records the uploaded file as the document's first version
+	if err := docversion.Record(r.Context(), tx, activityID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to record document version")
+		log.Println("Insert documentation version error:", err)
+		return
+	}
+
 	// Inserts a new record into the specific_documentation table linking the student and doc_type
 	_, err = tx.ExecContext(r.Context(),
 		`INSERT INTO specific_documentation (specific_documentation_id, student_id, doc_type)
@@ -285,19 +303,47 @@ func CreateSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Queues the webhook event in the same transaction, leaving out the server file path
+	if err := webhook.Enqueue(r.Context(), tx, uploadEvent(scan), map[string]interface{}{
+		"documentation_id": activityID,
+		"kind":             "specific",
+		"student_id":       studentID,
+		"doc_type":         docType,
+		"file_name":        fileName,
+		"mime_type":        mimeType,
+		"size_bytes":       stored.Size,
+		"scan_status":      scan.Status,
+	}); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to queue webhook event")
+		log.Println("Webhook enqueue error:", err)
+		return
+	}
+
 	// Commits the transaction to finalize the database changes
 	if err := tx.Commit(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
 		log.Println("Transaction commit error:", err)
 		return
 	}
+	committed = true
+
+	// Refuses an infected upload once it is recorded and quarantined
+	if scan.Status == scanner.StatusInfected {
+		utils.WriteErrorCode(w, http.StatusUnprocessableEntity, scanner.CodeInfected,
+			fmt.Sprintf("File was found infected (%s) and has been quarantined", scan.Signature.String))
+		return
+	}
 
 	// Writes JSON response & sends a HTTP 201 response code
 	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
-		"message": "Specific documentation uploaded successfully",
-		"id":      activityID,
-		"path":    fullPath,
-		"size":    sizeBytes,
+		"message":        "Specific documentation uploaded successfully",
+		"id":             activityID,
+		"file_name":      fileName,
+		"mime_type":      mimeType,
+		"storage_key":    stored.Key,
+		"content_sha256": stored.Digest,
+		"size":           stored.Size,
+		"scan_status":    scan.Status,
 	})
 }
 
@@ -322,23 +368,26 @@ func DownloadSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Re
 	query := `
 		SELECT
 			d.file_name,
-			d.file_path,
+			d.storage_key,
+			d.content_sha256,
+			d.scan_status,
 			d.mime_type,
 			d.size_bytes,
 			d.uploaded_by,
 			sd.doc_type
 		FROM documentation d
 		JOIN specific_documentation sd ON sd.specific_documentation_id = d.documentation_id
-		WHERE sd.specific_documentation_id = ?
+		WHERE sd.specific_documentation_id = ? AND d.deleted_at IS NULL
 	`
 
 	// Variables to store result
-	var fileName, filePath, mimeType, docType string
+	var fileName, storageKey, scanStatus, mimeType, docType string
+	var contentSHA256 sql.NullString
 	var sizeBytes int64
 	var uploadedBy sql.NullInt64
 
 	// Executes the SQL query
-	err = db.QueryRowContext(r.Context(), query, id).Scan(&fileName, &filePath, &mimeType, &sizeBytes, &uploadedBy, &docType)
+	err = db.QueryRowContext(r.Context(), query, id).Scan(&fileName, &storageKey, &contentSHA256, &scanStatus, &mimeType, &sizeBytes, &uploadedBy, &docType)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			utils.WriteError(w, http.StatusNotFound, "File not found for this documentation ID")
@@ -349,25 +398,14 @@ func DownloadSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// Validates file path and existence
-	if filePath == "" {
-		utils.WriteError(w, http.StatusInternalServerError, "File path not found in database")
+	// Validates the storage key
+	if storageKey == "" {
+		utils.WriteError(w, http.StatusInternalServerError, "Storage key not found in database")
 		return
 	}
-	fullPath := filepath.Clean(filePath)
 
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		utils.WriteError(w, http.StatusNotFound, "File not found on server")
-		log.Println("Missing file on disk:", fullPath)
-		return
-	}
-
-	w.Header().Set("Content-Type", mimeType)
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", sizeBytes))
-
-	// Streams the file to the HTTP response
-	http.ServeFile(w, r, fullPath)
+	// Streams the file to the HTTP response unless its malware scan keeps it back
+	serveDocument(w, r, storageKey, contentSHA256.String, scanStatus, fileName, mimeType)
 }
 
 func UpdateSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Request) {
@@ -403,11 +441,20 @@ func UpdateSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 	sd.ActivityDateTime = time.Now()
 
 	// Validates required fields
-	if sd.StudentID == 0 || sd.DocType == "" || sd.FileName == "" || sd.FilePath == "" || sd.MimeType == "" || sd.SizeBytes == 0 {
+	if sd.StudentID == 0 || sd.DocType == "" || sd.FileName == "" || sd.StorageKey == "" || sd.MimeType == "" || sd.SizeBytes == 0 {
 		utils.WriteError(w, http.StatusBadRequest, "Missing required fields")
 		return
 	}
 
+	// Cleans the file name the same way uploads are
+	sd.FileName = uploadpolicy.FileName(sd.FileName)
+
+	// Validates the storage key so it cannot point outside the document store or into quarantine
+	if err := blobstore.ValidKey(sd.StorageKey); err != nil || docstore.Quarantined(sd.StorageKey) {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid storage_key")
+		return
+	}
+
 	// Start transaction
 	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
@@ -417,9 +464,23 @@ func UpdateSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 	}
 	defer tx.Rollback()
 
+	// Locks the activity row and checks the If-Match precondition
+	version, err := utils.LockLiveVersion(r.Context(), tx, "activity", "activity_id", "documentation", "documentation_id", specificDocumentationID)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "Specific documentation not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch specific documentation")
+		log.Println("DB query error:", err)
+		return
+	}
+	if !utils.CheckIfMatch(w, r, utils.ETag(specificDocumentationID, version)) {
+		return
+	}
+
 	// Executes written SQL to update the activity data
 	_, err = tx.ExecContext(r.Context(),
-		"UPDATE activity SET activity_datetime=? WHERE activity_id=?",
+		"UPDATE activity SET activity_datetime=?, version=version+1 WHERE activity_id=?",
 		sd.ActivityDateTime, specificDocumentationID,
 	)
 
@@ -430,12 +491,17 @@ func UpdateSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Executes written SQL to update the documentation data
+	// Executes written SQL to update the documentation data, a new storage_key takes the digest of the blob it names and waits for a rescan
 	_, err = tx.ExecContext(r.Context(),
 		`UPDATE documentation
-		SET file_name=?, file_path=?, mime_type=?, size_bytes=?, uploaded_by=?
+		SET file_name=?,
+			content_sha256=IF(storage_key=?, content_sha256, (SELECT b.content_sha256 FROM document_blob b WHERE b.storage_key=?)),
+			scan_status=IF(storage_key=?, scan_status, 'unscanned'),
+			scan_signature=IF(storage_key=?, scan_signature, NULL),
+			scanned_at=IF(storage_key=?, scanned_at, NULL),
+			storage_key=?, mime_type=?, size_bytes=?, uploaded_by=?
 		WHERE documentation_id=?`,
-		sd.FileName, sd.FilePath, sd.MimeType, sd.SizeBytes, sd.UploadedBy, specificDocumentationID,
+		sd.FileName, sd.StorageKey, sd.StorageKey, sd.StorageKey, sd.StorageKey, sd.StorageKey, sd.StorageKey, sd.MimeType, sd.SizeBytes, sd.UploadedBy, specificDocumentationID,
 	)
 
 	// Error message if ExecContext fails
@@ -445,6 +511,13 @@ func UpdateSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Keeps the current version in step with the edited file metadata
+	if err := docversion.Sync(r.Context(), tx, specificDocumentationID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update document version")
+		log.Println("DB update error:", err)
+		return
+	}
+
 	// Executes written SQL to update the specific documentation data
 	res, err := tx.ExecContext(r.Context(),
 		"UPDATE specific_documentation SET doc_type=?, student_id=? WHERE specific_documentation_id=?",
@@ -482,12 +555,13 @@ func UpdateSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 	}
 
 	// Writes JSON response & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(specificDocumentationID, version+1))
 	utils.WriteJSON(w, http.StatusOK, map[string]string{
 		"message": "Specific documentation updated successfully",
 	})
 }
 
-func DeleteSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+func PatchSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	// Extracts path variables from the request
 	vars := mux.Vars(r)
 	idStr, ok := vars["specific_documentation_id"]
@@ -504,38 +578,144 @@ func DeleteSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	var filePath, fileName string
-	err = db.QueryRowContext(r.Context(),
-		`SELECT d.file_path, d.file_name
-		FROM documentation d
-		JOIN specific_documentation sd ON d.documentation_id = sd.specific_documentation_id
-		WHERE sd.specific_documentation_id = ?`,
-		specificDocumentationID,
-	).Scan(&filePath, &fileName)
-
-	// Clean and reconstruct the actual stored file path (id-prefixed)
-	dir := filepath.Dir(filePath)
-	prefixedFile := fmt.Sprintf("%d_%s", specificDocumentationID, filepath.Base(fileName))
-	fullPath := filepath.Join(dir, prefixedFile)
+	// Reads the JSON Merge Patch document from the request
+	patch, err := utils.ReadMergePatch(r)
+	if err == utils.ErrUnsupportedPatchType {
+		utils.WriteError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/merge-patch+json")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		log.Println("JSON decode error:", err)
+		return
+	}
 
-	// Clean and verify path
-	fullPath = filepath.Clean(fullPath)
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		log.Println("Warning: file not found on disk, skipping delete:", fullPath)
-		fullPath = "" // prevents unnecessary os.Remove()
+	// Start transaction
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
+		log.Println("BeginTx error:", err)
+		return
 	}
+	defer tx.Rollback()
 
-	// Handles missing or invalid file path case
+	// Loads the current specific documentation to merge the patch into
+	current, version, err := fetchSpecificDocumentation(r.Context(), tx, specificDocumentationID)
 	if err == sql.ErrNoRows {
-		utils.WriteError(w, http.StatusNotFound, "No file found for this documentation ID")
+		utils.WriteError(w, http.StatusNotFound, "Specific documentation not found")
 		return
 	} else if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve file path")
-		log.Println("File path retrieval error:", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch specific documentation")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Checks the If-Match precondition against the locked row
+	if !utils.CheckIfMatch(w, r, utils.ETag(specificDocumentationID, version)) {
+		return
+	}
+
+	// Applies the patch on top of the current specific documentation
+	var sd models.SpecificDocumentation
+	if err := utils.ApplyMergePatch(current, patch, &sd); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid patch document")
+		log.Println("Merge patch error:", err)
+		return
+	}
+
+	// File metadata is owned by the server and cannot be changed by clients
+	if sd.SpecificDocumentationID != current.SpecificDocumentationID ||
+		!sd.ActivityDateTime.Equal(current.ActivityDateTime) ||
+		sd.StorageKey != current.StorageKey || sd.MimeType != current.MimeType ||
+		sd.SizeBytes != current.SizeBytes || !sameUploader(sd.UploadedBy, current.UploadedBy) {
+		utils.WriteError(w, http.StatusBadRequest, "Only file_name, doc_type and student_id can be modified")
+		return
+	}
+
+	// Students cannot move documentation to another student
+	if !utils.IsStudentOwner(r, sd.StudentID) {
+		utils.WriteError(w, http.StatusForbidden, "Forbidden: not owner")
+		return
+	}
+
+	// Validates required fields on the merged result
+	if sd.StudentID == 0 || sd.DocType == "" || sd.FileName == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Missing required fields")
+		return
+	}
+
+	// Cleans the file name the same way uploads are
+	sd.FileName = uploadpolicy.FileName(sd.FileName)
+
+	// Bumps the activity row version
+	_, err = tx.ExecContext(r.Context(),
+		"UPDATE activity SET version=version+1 WHERE activity_id=?",
+		specificDocumentationID,
+	)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update activity")
+		log.Println("DB update error:", err)
+		return
+	}
+
+	// Executes written SQL to update the documentation file name
+	_, err = tx.ExecContext(r.Context(),
+		"UPDATE documentation SET file_name=? WHERE documentation_id=?",
+		sd.FileName, specificDocumentationID,
+	)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update documentation")
+		log.Println("DB update error:", err)
+		return
+	}
+
+	// Keeps the current version in step with the edited file metadata
+	if err := docversion.Sync(r.Context(), tx, specificDocumentationID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update document version")
+		log.Println("DB update error:", err)
+		return
+	}
+
+	// Executes written SQL to update the specific documentation data
+	_, err = tx.ExecContext(r.Context(),
+		"UPDATE specific_documentation SET doc_type=?, student_id=? WHERE specific_documentation_id=?",
+		sd.DocType, sd.StudentID, specificDocumentationID,
+	)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update specific documentation")
+		log.Println("DB update error:", err)
 		return
 	}
 
-	// Begin a transaction (not strictly required for single multi-table DELETE, but safer)
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
+		log.Println("Transaction commit error:", err)
+		return
+	}
+
+	// Writes the patched specific documentation as JSON & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(specificDocumentationID, version+1))
+	utils.WriteJSON(w, http.StatusOK, sd)
+}
+
+func DeleteSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts path variables from the request
+	vars := mux.Vars(r)
+	idStr, ok := vars["specific_documentation_id"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, "Missing specific documentation ID")
+		return
+	}
+
+	// Converts the "specific_documentation_id" string to an integer
+	specificDocumentationID, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid specific documentation ID")
+		log.Println("Invalid ID parse error:", err)
+		return
+	}
+
+	// Begin a transaction (not strictly required for a single UPDATE, but safer)
 	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
@@ -544,18 +724,38 @@ func DeleteSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 	}
 	defer tx.Rollback()
 
-	// Multi-table delete query:
-	// Deletes from specific_documentation, documentation, and activity in one go
+	// Locks the activity row and checks the If-Match precondition
+	version, err := utils.LockLiveVersion(r.Context(), tx, "activity", "activity_id", "documentation", "documentation_id", specificDocumentationID)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "No specific documentation found for this ID")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch specific documentation")
+		log.Println("DB query error:", err)
+		return
+	}
+	if !utils.CheckIfMatch(w, r, utils.ETag(specificDocumentationID, version)) {
+		return
+	}
+
+	// Queues document.deleted events for the documents being trashed
+	if err := queueDocumentDeletions(r.Context(), tx, "specific", "specific_documentation_id", specificDocumentationID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to queue webhook event")
+		log.Println("Webhook enqueue error:", err)
+		return
+	}
+
+	// Soft delete query:
+	// Moves the documentation to the trash, the file stays on disk until the purger removes it
 	query := `
-		DELETE sd, d, a
-		FROM specific_documentation sd
-		JOIN documentation d ON d.documentation_id = sd.specific_documentation_id
-		JOIN activity a ON a.activity_id = d.documentation_id
-		WHERE sd.specific_documentation_id = ?;
+		UPDATE documentation d
+		JOIN specific_documentation sd ON sd.specific_documentation_id = d.documentation_id
+		SET d.deleted_at = NOW(), d.deleted_by = ?
+		WHERE sd.specific_documentation_id = ? AND d.deleted_at IS NULL;
 	`
 
-	// Executes written SQL to delete the specific documentation
-	res, err := tx.ExecContext(r.Context(), query, specificDocumentationID)
+	// Executes written SQL to trash the documentation
+	res, err := tx.ExecContext(r.Context(), query, r.Context().Value(utils.UserIDKey), specificDocumentationID)
 
 	// Error message if ExecContext fails
 	if err != nil {
@@ -564,7 +764,7 @@ func DeleteSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Gets the number of rows affected by the delete
+	// Gets the number of rows affected by the update
 	rowsAffected, err := res.RowsAffected()
 
 	// Error message if RowsAffected fails
@@ -574,7 +774,7 @@ func DeleteSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Error message if no rows were deleted
+	// Error message if nothing was trashed
 	if rowsAffected == 0 {
 		utils.WriteError(w, http.StatusNotFound, "No specific documentation found for this ID")
 		return
@@ -587,15 +787,10 @@ func DeleteSpecificDocumentation(db *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if fullPath != "" && os.Remove(fullPath) != nil {
-		log.Println("Warning: failed to delete file from disk:", fullPath)
-	}
-
 	// Respond with success JSON
 	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"message":       "Specific documentation " + idStr + " deleted successfully",
-		"file_deleted":  filePath,
-		"rows_affected": rowsAffected / 3,
+		"message":       "Specific documentation " + idStr + " moved to trash",
+		"rows_affected": rowsAffected,
 	})
 }
 
@@ -616,39 +811,7 @@ func DeleteSpecificDocumentationByStudentID(db *sql.DB, w http.ResponseWriter, r
 		return
 	}
 
-	// Retrieve all file info before deleting from DB
-	rows, err := db.QueryContext(r.Context(), `
-	SELECT d.documentation_id, d.file_path, d.file_name
-	FROM documentation d
-	JOIN specific_documentation sd ON d.documentation_id = sd.specific_documentation_id
-	WHERE sd.student_id = ?;
-`, studentID)
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve file paths")
-		log.Println("File path retrieval error:", err)
-		return
-	}
-	defer rows.Close()
-
-	var filePaths []string
-	for rows.Next() {
-		var id int
-		var filePath, fileName string
-		if err := rows.Scan(&id, &filePath, &fileName); err == nil && filePath != "" {
-			dir := filepath.Dir(filePath)
-			prefixed := fmt.Sprintf("%d_%s", id, filepath.Base(fileName))
-			fullPath := filepath.Clean(filepath.Join(dir, prefixed))
-			filePaths = append(filePaths, fullPath)
-		}
-	}
-	_ = filePaths
-	if err := rows.Err(); err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Error scanning file paths")
-		log.Println("Rows scan error:", err)
-		return
-	}
-
-	// Begin a transaction (not strictly required for single multi-table DELETE, but safer)
+	// Begin a transaction so the trash and its events commit together
 	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
@@ -657,18 +820,24 @@ func DeleteSpecificDocumentationByStudentID(db *sql.DB, w http.ResponseWriter, r
 	}
 	defer tx.Rollback()
 
-	// Multi-table delete query:
-	// Deletes from specific_documentation, documentation, and activity in one go
+	// Queues document.deleted events for the documents being trashed
+	if err := queueDocumentDeletions(r.Context(), tx, "specific", "student_id", studentID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to queue webhook event")
+		log.Println("Webhook enqueue error:", err)
+		return
+	}
+
+	// Soft delete query:
+	// Moves every live specific documentation of the student to the trash
 	query := `
-		DELETE sd, d, a
-		FROM specific_documentation sd
-		JOIN documentation d ON d.documentation_id = sd.specific_documentation_id
-		JOIN activity a ON a.activity_id = d.documentation_id
-		WHERE sd.student_id = ?;
+		UPDATE documentation d
+		JOIN specific_documentation sd ON sd.specific_documentation_id = d.documentation_id
+		SET d.deleted_at = NOW(), d.deleted_by = ?
+		WHERE sd.student_id = ? AND d.deleted_at IS NULL;
 	`
 
-	// Executes written SQL to delete the documentation
-	res, err := tx.ExecContext(r.Context(), query, studentID)
+	// Executes written SQL to trash the documentation
+	res, err := tx.ExecContext(r.Context(), query, r.Context().Value(utils.UserIDKey), studentID)
 
 	// Error message if ExecContext fails
 	if err != nil {
@@ -677,7 +846,7 @@ func DeleteSpecificDocumentationByStudentID(db *sql.DB, w http.ResponseWriter, r
 		return
 	}
 
-	// Gets the number of rows affected by the delete
+	// Gets the number of rows affected by the update
 	rowsAffected, err := res.RowsAffected()
 
 	// Error message if RowsAffected fails
@@ -687,30 +856,76 @@ func DeleteSpecificDocumentationByStudentID(db *sql.DB, w http.ResponseWriter, r
 		return
 	}
 
-	// Error message if no rows were deleted
+	// Error message if nothing was trashed
 	if rowsAffected == 0 {
 		utils.WriteError(w, http.StatusNotFound, "No specific documentation found for this student")
 		return
 	}
 
-	// Commit the transaction
+	// Commit transaction
 	if err := tx.Commit(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
 		log.Println("Transaction commit error:", err)
 		return
 	}
 
-	// Delete physical files (after DB commit)
-	for _, path := range filePaths {
-		if os.Remove(path) != nil {
-			log.Println("Warning: failed to delete file:", path)
-		}
-	}
-
 	// Respond with success
 	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"message":       "All specific documentation for student " + studentIDStr + " deleted successfully",
-		"rows_affected": rowsAffected / 3,
-		"files_deleted": len(filePaths),
+		"message":       "All specific documentation for student " + studentIDStr + " moved to trash",
+		"rows_affected": rowsAffected,
 	})
 }
+
+// fetchSpecificDocumentation loads a single specific documentation joined with its activity and documentation rows
+// and returns its row version. The rows are locked when called inside a transaction.
+func fetchSpecificDocumentation(ctx context.Context, q utils.DBTX, specificDocumentationID int) (models.SpecificDocumentation, int, error) {
+	// SQL query to select a single specific_documentation
+	query := `
+		SELECT
+			sd.specific_documentation_id,
+			sd.student_id,
+			sd.doc_type,
+			a.activity_datetime,
+			d.file_name,
+			d.storage_key,
+			d.mime_type,
+			d.size_bytes,
+			d.uploaded_by,
+			a.version
+		FROM specific_documentation sd
+		JOIN activity a ON sd.specific_documentation_id = a.activity_id
+		JOIN documentation d ON sd.specific_documentation_id = d.documentation_id
+		WHERE sd.specific_documentation_id = ? AND d.deleted_at IS NULL
+	`
+	if _, ok := q.(*sql.Tx); ok {
+		query += " FOR UPDATE"
+	}
+
+	// Empty variables for specific_documentation struct and row version
+	var sd models.SpecificDocumentation
+	var version int
+
+	// Executes query
+	err := q.QueryRowContext(ctx, query, specificDocumentationID).Scan(
+		&sd.SpecificDocumentationID,
+		&sd.StudentID,
+		&sd.DocType,
+		&sd.ActivityDateTime,
+		&sd.FileName,
+		&sd.StorageKey,
+		&sd.MimeType,
+		&sd.SizeBytes,
+		&sd.UploadedBy,
+		&version,
+	)
+
+	return sd, version, err
+}
+
+// sameUploader compares two optional uploader IDs
+func sameUploader(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
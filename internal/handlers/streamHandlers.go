@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/stream"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/webhook"
+)
+
+// streamHeartbeat keeps idle connections open through proxies
+const streamHeartbeat = 15 * time.Second
+
+// CreateStreamTicket issues a short-lived ticket that opens the activity stream for the caller.
+// EventSource cannot send an Authorization header, the ticket goes in the stream URL instead of the login token.
+func CreateStreamTicket(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value(utils.UserIDKey).(int)
+	role, _ := r.Context().Value(utils.RoleKey).(string)
+
+	// Signs a ticket for the caller's user and role
+	ticket, expiresAt, err := utils.CreateStreamTicket(userID, role)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create stream ticket")
+		log.Println("Stream ticket error:", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]any{
+		"ticket":     ticket,
+		"expires_at": expiresAt.UTC(),
+	})
+}
+
+func StreamActivity(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts optional query parameters from the request
+	q := r.URL.Query()
+	var filter stream.Filter
+	types, err := stream.ParseTypes(q.Get("types"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid types: "+err.Error())
+		return
+	}
+	filter.Types = types
+
+	// Optional student and admin filters
+	for _, param := range []struct {
+		name string
+		dst  *int
+	}{{"student_id", &filter.StudentID}, {"admin_id", &filter.AdminID}} {
+		value := q.Get(param.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid "+param.name)
+			return
+		}
+		*param.dst = n
+	}
+
+	// Optional pinned filter, only meaningful for a logged in admin
+	if pinned, _ := strconv.ParseBool(q.Get("pinned")); pinned {
+		userID, _ := r.Context().Value(utils.UserIDKey).(int)
+		if userID <= 0 {
+			utils.WriteError(w, http.StatusBadRequest, "pinned requires an admin login")
+			return
+		}
+		filter.PinnedBy = userID
+	}
+
+	// Resumes after the last event the client saw, EventSource sends it as a header on reconnect
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = q.Get("last_event_id")
+	}
+	var after int64
+	if lastID != "" {
+		after, err = strconv.ParseInt(lastID, 10, 64)
+		if err != nil || after < 0 {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		utils.WriteError(w, http.StatusInternalServerError, "Streaming unsupported")
+		return
+	}
+
+	// Subscribes before replaying so nothing committed in between is lost
+	events, cancel := stream.For(db).Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	// Sends an event if it passes the filter
+	matcher := stream.NewMatcher(db, filter)
+	send := func(e webhook.Payload) error {
+		match, err := matcher.Match(r.Context(), e)
+		if err != nil || !match {
+			return err
+		}
+		return stream.WriteEvent(w, e)
+	}
+
+	// Replays what the client missed while disconnected, remembering what it sent
+	replayed := map[int64]bool{}
+	if lastID != "" {
+		_, err = stream.Replay(r.Context(), db, after, func(e webhook.Payload) error {
+			replayed[e.ID] = true
+			return send(e)
+		})
+		if err != nil {
+			log.Println("Stream replay error:", err)
+			return
+		}
+		flusher.Flush()
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case e, ok := <-events:
+			// Closed when the client fell behind or the server is shutting down, it reconnects with Last-Event-ID
+			if !ok {
+				return
+			}
+			// Skips events already sent by the replay. Events are not compared by ID because one
+			// that committed late arrives after events with higher IDs.
+			if replayed[e.ID] {
+				delete(replayed, e.ID)
+				continue
+			}
+			if err := send(e); err != nil {
+				log.Println("Stream write error:", err)
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -8,7 +8,12 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/deletion"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/export"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/history"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/studentstore"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 	"github.com/gorilla/mux"
 
@@ -28,6 +33,7 @@ func GetStudents(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 			s.start_year, s.planned_grad_year, s.housing, s.dining
 		FROM student s
 		JOIN person p ON s.student_id = p.person_id
+		WHERE p.deleted_at IS NULL
 	`
 
 	args := []any{}
@@ -55,7 +61,7 @@ func GetStudents(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 
 		// Combines the conditions with AND
 		whereClause := strings.Join(conditions, " AND ")
-		query += " WHERE " + whereClause
+		query += " AND " + whereClause
 	}
 
 	// Executes written SQL
@@ -69,6 +75,13 @@ func GetStudents(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
+	// Streams the rows as a CSV, XLSX or NDJSON file when the client asked for one
+	out, err := export.Start(db, w, r, "students", models.Student{})
+	if err != nil {
+		utils.WriteError(w, http.StatusNotAcceptable, "Unsupported export format")
+		return
+	}
+
 	// Creates an empty slice to obtain results
 	students := make([]models.Student, 0)
 
@@ -78,19 +91,43 @@ func GetStudents(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		// Parses the current data into fields of "s" variable
 		if err := rows.Scan(
 			&s.StudentID, &s.FirstName, &s.PreferredName, &s.MiddleName, &s.LastName,
-			&s.Email, &s.PhoneNumber, &s.Pronouns, &s.Sex, &s.Gender,
-			&s.Birthday, &s.Address, &s.City, &s.State, &s.ZipCode, &s.Country,
+			fieldcrypt.Scan(fieldcrypt.PersonEmail, &s.Email),
+			fieldcrypt.Scan(fieldcrypt.PersonPhoneNumber, &s.PhoneNumber),
+			&s.Pronouns, &s.Sex, &s.Gender,
+			fieldcrypt.Scan(fieldcrypt.PersonBirthday, &s.Birthday),
+			fieldcrypt.Scan(fieldcrypt.PersonAddress, &s.Address),
+			&s.City, &s.State, &s.ZipCode, &s.Country,
 			&s.Year, &s.StartYear, &s.PlannedGradYear, &s.Housing, &s.Dining,
 		); err != nil {
+			// The export already sent its headers, so the file is cut short instead
+			if out != nil {
+				out.Close(err)
+				return
+			}
 			utils.WriteError(w, http.StatusInternalServerError, "Failed to scan student")
 			log.Println("Row scan error:", err)
 			return
 		}
 
+		// Streams the row instead of collecting it when exporting
+		if out != nil {
+			if err := out.Write(s); err != nil {
+				log.Println("Export write error:", err)
+				return
+			}
+			continue
+		}
+
 		// Adds the obtained data to the slice
 		students = append(students, s)
 	}
 
+	// Finishes the export, an interrupted iteration leaves the file incomplete
+	if out != nil {
+		out.Close(rows.Err())
+		return
+	}
+
 	// Checks for errors during iteration such as network interruptions and driver errors
 	if err := rows.Err(); err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Operational Error")
@@ -119,46 +156,8 @@ func GetStudentByID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// SQL query to select a single student
-	query := `
-		SELECT
-			s.student_id,
-			p.first_name, p.preferred_name, p.middle_name, p.last_name,
-			p.email, p.phone_number, p.pronouns, p.sex, p.gender,
-			p.birthday, p.address, p.city, p.state, p.zip_code, p.country,
-			s.year, s.start_year, s.planned_grad_year, s.housing, s.dining
-		FROM student s
-		JOIN person p ON s.student_id = p.person_id
-		WHERE s.student_id = ?
-	`
-
-	// Empty variable for student struct
-	var s models.Student
-
-	// Executes query
-	err = db.QueryRowContext(r.Context(), query, studentID).Scan(
-		&s.StudentID,
-		&s.FirstName,
-		&s.PreferredName,
-		&s.MiddleName,
-		&s.LastName,
-		&s.Email,
-		&s.PhoneNumber,
-		&s.Pronouns,
-		&s.Sex,
-		&s.Gender,
-		&s.Birthday,
-		&s.Address,
-		&s.City,
-		&s.State,
-		&s.ZipCode,
-		&s.Country,
-		&s.Year,
-		&s.StartYear,
-		&s.PlannedGradYear,
-		&s.Housing,
-		&s.Dining,
-	)
+	// Fetches the student from the database
+	s, version, err := studentstore.Fetch(r.Context(), db, studentID)
 
 	// Error message if no rows are found
 	if err == sql.ErrNoRows {
@@ -171,7 +170,8 @@ func GetStudentByID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Writes JSON response & sends a HTTP 200 response code
+	// Writes JSON response with the row version as ETag & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(studentID, version))
 	utils.WriteJSON(w, http.StatusOK, s)
 }
 
@@ -189,9 +189,7 @@ func CreateStudent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validates required fields
-	if s.FirstName == "" || s.LastName == "" || s.Email == "" || s.PhoneNumber == "" ||
-		s.Sex == "" || s.Birthday == "" || s.Address == "" || s.City == "" ||
-		s.Country == "" || s.Year == "" || s.StartYear == 0 || s.PlannedGradYear == 0 {
+	if missingStudentFields(s) {
 		utils.WriteError(w, http.StatusBadRequest, "Missing required fields")
 		return
 	}
@@ -205,45 +203,16 @@ func CreateStudent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	// Executes SQL to insert into person table
-	res, err := tx.ExecContext(r.Context(),
-		`INSERT INTO person (
-			first_name, preferred_name, middle_name, last_name, email,
-			phone_number, pronouns, sex, gender, birthday,
-			address, city, state, zip_code, country
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		s.FirstName, s.PreferredName, s.MiddleName, s.LastName,
-		s.Email, s.PhoneNumber, s.Pronouns, s.Sex, s.Gender, s.Birthday,
-		s.Address, s.City, s.State, s.ZipCode, s.Country,
-	)
+	// Executes SQL to insert into the person and student tables
+	lastID, err := studentstore.Insert(r.Context(), tx, s)
 
-	// Error message if ExecContext fails
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to insert into person")
-		log.Println("DB insert error:", err)
+	// Error message if Insert fails
+	if utils.IsDuplicateEntry(err) {
+		utils.WriteError(w, http.StatusConflict, "Email is already used by another person")
 		return
 	}
-
-	// Gets the last inserted person ID
-	lastID, err := res.LastInsertId()
-
-	// Error message if LastInsertId fails
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to get inserted person ID")
-		log.Println("LastInsertId error:", err)
-		return
-	}
-
-	// Executes SQL to insert into student table
-	_, err = tx.ExecContext(r.Context(),
-		`INSERT INTO student (student_id, year, start_year, planned_grad_year, housing, dining)
-		VALUES (?, ?, ?, ?, ?, ?)`,
-		lastID, s.Year, s.StartYear, s.PlannedGradYear, s.Housing, s.Dining,
-	)
-
-	// Error message if ExecContext fails
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to insert into student")
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create student")
 		log.Println("DB insert error:", err)
 		return
 	}
@@ -292,9 +261,7 @@ func UpdateStudent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validates required fields
-	if s.FirstName == "" || s.LastName == "" || s.Email == "" || s.PhoneNumber == "" ||
-		s.Sex == "" || s.Birthday == "" || s.Address == "" || s.City == "" ||
-		s.Country == "" || s.Year == "" || s.StartYear == 0 || s.PlannedGradYear == 0 {
+	if missingStudentFields(s) {
 		utils.WriteError(w, http.StatusBadRequest, "Missing required fields")
 		return
 	}
@@ -308,56 +275,150 @@ func UpdateStudent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	// Execute direct SQL update
-	_, err = tx.ExecContext(r.Context(),
-		`UPDATE person
-		 SET first_name = ?, preferred_name = ?, middle_name = ?, last_name = ?,
-		     email = ?, phone_number = ?, pronouns = ?, sex = ?, gender = ?,
-		     birthday = ?, address = ?, city = ?, state = ?, zip_code = ?, country = ?
-		 WHERE person_id = ?`,
-		s.FirstName, s.PreferredName, s.MiddleName, s.LastName,
-		s.Email, s.PhoneNumber, s.Pronouns, s.Sex, s.Gender,
-		s.Birthday, s.Address, s.City, s.State, s.ZipCode, s.Country,
-		studentID,
-	)
+	// Locks the student row, keeps its current state for the history and checks the If-Match precondition
+	before, version, err := studentstore.Fetch(r.Context(), tx, studentID)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "Student not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch student")
+		log.Println("DB query error:", err)
+		return
+	}
+	if !utils.CheckIfMatch(w, r, utils.ETag(studentID, version)) {
+		return
+	}
+
+	// Updates the person and student rows
+	rowsAffected, err := studentstore.Update(r.Context(), tx, studentID, s)
 
-	// Error message if ExecContext fails
+	// Error message if the update fails
+	if utils.IsDuplicateEntry(err) {
+		utils.WriteError(w, http.StatusConflict, "Email is already used by another person")
+		return
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to update student")
 		log.Println("DB update error:", err)
 		return
 	}
 
-	// Optionally update student table fields
-	res, err := tx.ExecContext(r.Context(),
-		`UPDATE student
-		 SET year = ?, start_year = ?, planned_grad_year = ?, housing = ?, dining = ?
-		 WHERE student_id = ?`,
-		s.Year, s.StartYear, s.PlannedGradYear, s.Housing, s.Dining,
-		studentID,
-	)
+	// Error message if no rows were updated
+	if rowsAffected == 0 {
+		utils.WriteError(w, http.StatusNotFound, "Student not found")
+		return
+	}
+
+	// Saves the new version to the profile history
+	s.StudentID = studentID
+	if err := history.Record(r.Context(), tx, history.ProfileStudent, studentID, version, before, s, r.Context().Value(utils.UserIDKey), nil); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to record student history")
+		log.Println("DB insert error:", err)
+		return
+	}
 
-	// Error message if ExecContext fails
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
+		log.Println("Transaction commit error:", err)
+		return
+	}
+
+	// Writes JSON response confirming update & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(studentID, version+1))
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Student updated successfully",
+	})
+}
+
+func PatchStudent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts path variables from the request
+	vars := mux.Vars(r)
+	idStr, ok := vars["student_id"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, "Missing student ID")
+		return
+	}
+
+	// Converts the "student_id" string to an integer
+	studentID, err := strconv.Atoi(idStr)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to update student details")
-		log.Println("DB update error:", err)
+		utils.WriteError(w, http.StatusBadRequest, "Invalid student ID")
+		log.Println("Invalid ID parse error:", err)
 		return
 	}
 
-	// Gets the number of rows affected by the update
-	rowsAffected, err := res.RowsAffected()
+	// Reads the JSON Merge Patch document from the request
+	patch, err := utils.ReadMergePatch(r)
+	if err == utils.ErrUnsupportedPatchType {
+		utils.WriteError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/merge-patch+json")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		log.Println("JSON decode error:", err)
+		return
+	}
 
-	// Error message if RowsAffected fails
+	// Start transaction
+	tx, err := db.BeginTx(r.Context(), nil)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to get rows affected")
-		log.Println("RowsAffected error:", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to begin transaction")
+		log.Println("BeginTx error:", err)
 		return
 	}
+	defer tx.Rollback()
 
-	// Error message if no rows were updated
-	if rowsAffected == 0 {
+	// Loads the current student to merge the patch into
+	current, version, err := studentstore.Fetch(r.Context(), tx, studentID)
+	if err == sql.ErrNoRows {
 		utils.WriteError(w, http.StatusNotFound, "Student not found")
 		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch student")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Checks the If-Match precondition against the locked row
+	if !utils.CheckIfMatch(w, r, utils.ETag(studentID, version)) {
+		return
+	}
+
+	// Applies the patch on top of the current student
+	var s models.Student
+	if err := utils.ApplyMergePatch(current, patch, &s); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid patch document")
+		log.Println("Merge patch error:", err)
+		return
+	}
+
+	// The student ID cannot be changed
+	if s.StudentID != studentID {
+		utils.WriteError(w, http.StatusBadRequest, "student_id cannot be modified")
+		return
+	}
+
+	// Validates required fields on the merged result
+	if missingStudentFields(s) {
+		utils.WriteError(w, http.StatusBadRequest, "Missing required fields")
+		return
+	}
+
+	// Updates the person and student rows
+	if _, err := studentstore.Update(r.Context(), tx, studentID, s); utils.IsDuplicateEntry(err) {
+		utils.WriteError(w, http.StatusConflict, "Email is already used by another person")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update student")
+		log.Println("DB update error:", err)
+		return
+	}
+
+	// Saves the new version to the profile history
+	if err := history.Record(r.Context(), tx, history.ProfileStudent, studentID, version, current, s, r.Context().Value(utils.UserIDKey), nil); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to record student history")
+		log.Println("DB insert error:", err)
+		return
 	}
 
 	// Commit transaction
@@ -367,10 +428,9 @@ func UpdateStudent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Writes JSON response confirming update & sends a HTTP 200 response code
-	utils.WriteJSON(w, http.StatusOK, map[string]string{
-		"message": "Student updated successfully",
-	})
+	// Writes the patched student as JSON & sends a HTTP 200 response code
+	w.Header().Set("ETag", utils.ETag(studentID, version+1))
+	utils.WriteJSON(w, http.StatusOK, s)
 }
 
 func DeleteStudent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
@@ -399,17 +459,31 @@ func DeleteStudent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	// Multi-table delete query:
-	// Deletes from student and person in one go
+	// Locks the student row and checks the If-Match precondition
+	version, err := utils.LockLiveVersion(r.Context(), tx, "student", "student_id", "person", "person_id", studentID)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "No student found for this ID")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch student")
+		log.Println("DB query error:", err)
+		return
+	}
+	if !utils.CheckIfMatch(w, r, utils.ETag(studentID, version)) {
+		return
+	}
+
+	// Soft delete query:
+	// Moves the student to the trash, the purger removes it after the retention window
 	query := `
-		DELETE s, p
-		FROM student s
-		JOIN person p ON p.person_id = s.student_id
-		WHERE s.student_id = ?;
+		UPDATE person p
+		JOIN student s ON s.student_id = p.person_id
+		SET p.deleted_at = NOW(), p.deleted_by = ?
+		WHERE s.student_id = ? AND p.deleted_at IS NULL;
 	`
 
-	// Executes written SQL to delete the student
-	res, err := tx.ExecContext(r.Context(), query, studentID)
+	// Executes written SQL to trash the student
+	res, err := tx.ExecContext(r.Context(), query, r.Context().Value(utils.UserIDKey), studentID)
 
 	// Error message if ExecContext fails
 	if err != nil {
@@ -443,7 +517,87 @@ func DeleteStudent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 
 	// Respond with success
 	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"message":       "Student " + idStr + " deleted successfully",
-		"rows_affected": rowsAffected / 2, // Each student involves 2 rows deleted
+		"message":       "Student " + idStr + " moved to trash",
+		"rows_affected": rowsAffected,
 	})
 }
+
+func PreviewStudentPurge(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts path variables from the request
+	vars := mux.Vars(r)
+	idStr, ok := vars["student_id"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, "Missing student ID")
+		return
+	}
+
+	// Converts the "student_id" string to an integer
+	studentID, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid student ID")
+		log.Println("Invalid ID parse error:", err)
+		return
+	}
+
+	// Lists everything a purge would remove
+	plan, err := deletion.PreviewStudent(r.Context(), db, studentID)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "No student found for this ID")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to preview student deletion")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Writes the deletion plan as JSON & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, plan)
+}
+
+func PurgeStudent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts path variables from the request
+	vars := mux.Vars(r)
+	idStr, ok := vars["student_id"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, "Missing student ID")
+		return
+	}
+
+	// Converts the "student_id" string to an integer
+	studentID, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid student ID")
+		log.Println("Invalid ID parse error:", err)
+		return
+	}
+
+	// dry_run=true only reports what would be removed
+	if r.URL.Query().Get("dry_run") == "true" {
+		PreviewStudentPurge(db, w, r)
+		return
+	}
+
+	// Permanently removes the student and all dependent data
+	plan, err := deletion.DeleteStudent(r.Context(), db, studentID, r.Context().Value(utils.UserIDKey))
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "No student found for this ID")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete student")
+		log.Println("DB delete error:", err)
+		return
+	}
+
+	// Respond with success
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Student " + idStr + " permanently deleted",
+		"deleted": plan,
+	})
+}
+
+// missingStudentFields reports whether any required student field is empty
+func missingStudentFields(s models.Student) bool {
+	return s.FirstName == "" || s.LastName == "" || s.Email == "" || s.PhoneNumber == "" ||
+		s.Sex == "" || s.Birthday == "" || s.Address == "" || s.City == "" ||
+		s.Country == "" || s.Year == "" || s.StartYear == 0 || s.PlannedGradYear == 0
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// summaryRange turns the date or from/to query parameters into a condition on column.
+// Days are whole days in loc and to is inclusive; an empty condition means no range was asked for.
+func summaryRange(q url.Values, loc *time.Location, column string) (string, []any, error) {
+	start, end, err := dayRange(q, loc)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var where []string
+	var args []any
+	if !start.IsZero() {
+		where = append(where, column+" >= ?")
+		args = append(args, start.UTC())
+	}
+	if !end.IsZero() {
+		where = append(where, column+" < ?")
+		args = append(args, end.UTC())
+	}
+	return strings.Join(where, " AND "), args, nil
+}
+
+// dayRange reads the date or from/to query parameters as whole days in loc. The end is the start of
+// the day after to, so DST changes keep whole days; a zero time means that side is open.
+func dayRange(q url.Values, loc *time.Location) (start, end time.Time, err error) {
+	dateStr, fromStr, toStr := q.Get("date"), q.Get("from"), q.Get("to")
+	if dateStr != "" {
+		if fromStr != "" || toStr != "" {
+			return start, end, errors.New("Use either date or from/to")
+		}
+		fromStr, toStr = dateStr, dateStr
+	}
+
+	if fromStr != "" {
+		if start, err = time.ParseInLocation("2006-01-02", fromStr, loc); err != nil {
+			return start, end, errors.New("Invalid date format (expected YYYY-MM-DD)")
+		}
+	}
+	if toStr != "" {
+		day, err := time.ParseInLocation("2006-01-02", toStr, loc)
+		if err != nil {
+			return start, end, errors.New("Invalid date format (expected YYYY-MM-DD)")
+		}
+		if !start.IsZero() && day.Before(start) {
+			return start, end, errors.New("from must not be after to")
+		}
+		end = day.AddDate(0, 0, 1)
+	}
+	return start, end, nil
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/activity"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+)
+
+// summaryDB answers the summary queries for n activities, alternating points of contact and
+// specific documents, each point of contact with two admins
+func summaryDB(n int) *testdb.DB {
+	at := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	person := func(id any) []driver.Value { return []driver.Value{id, "First", "Preferred", "Last"} }
+	typeOf := func(id int64) string {
+		if id%2 == 0 {
+			return activity.TypeSpecificDocumentation
+		}
+		return activity.TypePointOfContact
+	}
+	// ids are the activities a query selects, its ID arguments or every activity of the type
+	ids := func(args []driver.Value, typeName string) []int64 {
+		var selected []int64
+		for _, arg := range args {
+			if id, ok := arg.(int64); ok {
+				selected = append(selected, id)
+			}
+		}
+		if len(selected) > 0 {
+			return selected
+		}
+		for id := int64(1); id <= int64(n); id++ {
+			if typeOf(id) == typeName {
+				selected = append(selected, id)
+			}
+		}
+		return selected
+	}
+
+	return &testdb.DB{Query: func(query string, args []driver.Value) (*testdb.Rows, error) {
+		rows := &testdb.Rows{}
+		switch {
+		case strings.Contains(query, "FROM poc_admin pca"):
+			for _, id := range ids(args, activity.TypePointOfContact) {
+				rows.Values = append(rows.Values,
+					append([]driver.Value{id}, person(int64(100))...),
+					append([]driver.Value{id}, person(int64(101))...))
+			}
+
+		case strings.Contains(query, "FROM point_of_contact poc") && strings.Contains(query, "LEFT JOIN person sp"):
+			for _, id := range ids(args, activity.TypePointOfContact) {
+				rows.Values = append(rows.Values, append([]driver.Value{id, at, int64(30), "meeting"}, person(int64(7))...))
+			}
+
+		case strings.Contains(query, "FROM point_of_contact poc"):
+			for _, id := range ids(nil, activity.TypePointOfContact) {
+				rows.Values = append(rows.Values, append([]driver.Value{id, at, at, int64(30), "meeting"}, person(int64(7))...))
+			}
+
+		case strings.Contains(query, "FROM specific_documentation sd"):
+			for _, id := range ids(args, activity.TypeSpecificDocumentation) {
+				rows.Values = append(rows.Values, append([]driver.Value{id, "medical", "notes.pdf"}, person(int64(7))...))
+			}
+
+		case strings.Contains(query, "FROM activity a"):
+			for id := int64(1); id <= int64(n); id++ {
+				rows.Values = append(rows.Values, []driver.Value{id, at, typeOf(id)})
+			}
+
+		default:
+			return nil, nil
+		}
+		return rows, nil
+	}}
+}
+
+// benchmarkSummaryQueries runs a summary handler over growing data and fails when the number of
+// queries it runs grows with the number of rows
+func benchmarkSummaryQueries(b *testing.B, path string, handler func(*sql.DB, http.ResponseWriter, *http.Request), want int) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprint(n, " rows"), func(b *testing.B) {
+			fake := summaryDB(n)
+			db := fake.Open(b)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				fake.Reset()
+				w := httptest.NewRecorder()
+				handler(db, w, httptest.NewRequest(http.MethodGet, path, nil))
+				if w.Code != http.StatusOK {
+					b.Fatalf("status %d: %s", w.Code, w.Body)
+				}
+				if got := len(fake.Statements()); got != want {
+					b.Fatalf("%d rows ran %d queries, want %d:\n%s", n, got, want, fake.Log())
+				}
+			}
+			b.ReportMetric(float64(want), "queries/op")
+		})
+	}
+}
+
+func BenchmarkGetActivitiesSummary(b *testing.B) {
+	// The activities, then the details and admins of points of contact and the details of documents
+	benchmarkSummaryQueries(b, "/activities/summary", GetActivitiesSummary, 4)
+}
+
+func BenchmarkGetPointsOfContactSummary(b *testing.B) {
+	// The admins of every point of contact, then the points of contact themselves
+	benchmarkSummaryQueries(b, "/point-of-contacts/summary", GetPointsOfContactSummary, 2)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/studentstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/timeline"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+	"github.com/gorilla/mux"
+)
+
+func GetStudentTimeline(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts path variables from the request
+	vars := mux.Vars(r)
+	idStr, ok := vars["student_id"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, "Missing student ID")
+		return
+	}
+
+	// Converts the "student_id" string to an integer
+	studentID, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid student ID")
+		log.Println("Invalid ID parse error:", err)
+		return
+	}
+
+	// Extracts optional query parameters from the request
+	q := r.URL.Query()
+	var filter timeline.Filter
+
+	// Optional type filter, every registered type by default
+	filter.Types, err = timeline.ParseTypes(q.Get("types"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid types: "+err.Error())
+		return
+	}
+
+	// Sets the default timezone to UTC or loads the provided timezone
+	loc := time.UTC
+	if tzStr := q.Get("tz"); tzStr != "" {
+		loc, err = time.LoadLocation(tzStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid timezone")
+			log.Println("Timezone parse error:", err)
+			return
+		}
+	}
+
+	// Optional date or from/to filter
+	filter.From, filter.To, err = dayRange(q, loc)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Optional page size
+	filter.Limit = 50
+	if limitStr := q.Get("limit"); limitStr != "" {
+		filter.Limit, err = strconv.Atoi(limitStr)
+		if err != nil || filter.Limit < 1 || filter.Limit > 200 {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid limit (1-200)")
+			return
+		}
+	}
+
+	// Continues after the last entry of the previous page
+	if cursor := q.Get("cursor"); cursor != "" {
+		filter.After, err = timeline.ParseCursor(cursor)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+	}
+
+	// Checks that the student exists and is not in the trash
+	if _, _, err := studentstore.Fetch(r.Context(), db, studentID); err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "Student not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch student")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Loads the page
+	page, err := timeline.List(r.Context(), db, studentID, filter)
+	if errors.Is(err, timeline.ErrUnknownType) {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to obtain timeline")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Writes JSON response & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, page)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/trash"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+func GetTrash(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts optional type filter from the request
+	itemType := r.URL.Query().Get("type")
+
+	// Lists trashed records
+	items, err := trash.List(r.Context(), db, itemType)
+	if err == trash.ErrUnknownType {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid trash type")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to obtain trash")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Writes the trashed records as JSON & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, items)
+}
+
+func RestoreTrash(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts path variables from the request
+	vars := mux.Vars(r)
+	itemType := vars["type"]
+	idStr, ok := vars["id"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, "Missing ID")
+		return
+	}
+
+	// Converts the "id" string to an integer
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid ID")
+		log.Println("Invalid ID parse error:", err)
+		return
+	}
+
+	// Clears the deletion markers
+	err = trash.Restore(r.Context(), db, itemType, id)
+	if err == trash.ErrUnknownType {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid trash type")
+		return
+	} else if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, "No trashed "+itemType+" found for this ID")
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to restore "+itemType)
+		log.Println("DB update error:", err)
+		return
+	}
+
+	// Respond with success
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": itemType + " " + idStr + " restored successfully",
+	})
+}
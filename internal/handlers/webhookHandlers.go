@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+// webhookRequest is the body accepted when creating or updating a subscription
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+	Secret string   `json:"secret"`
+}
+
+// validWebhookURL only accepts absolute http and https URLs
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// decodeWebhookRequest decodes and validates a subscription body, writing the error response on failure
+func decodeWebhookRequest(w http.ResponseWriter, r *http.Request) (webhookRequest, bool) {
+	var req webhookRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields() // Prevents extra unexpected fields
+	if err := decoder.Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		log.Println("JSON decode error:", err)
+		return req, false
+	}
+
+	// Validates required fields
+	if req.URL == "" || len(req.Events) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Missing required fields")
+		return req, false
+	}
+	if !validWebhookURL(req.URL) {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid url (expected an absolute http or https URL)")
+		return req, false
+	}
+	if err := webhook.ValidateEvents(req.Events); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid events: "+err.Error())
+		return req, false
+	}
+	return req, true
+}
+
+// webhookIDFromPath reads the "webhook_id" path variable, writing the error response on failure
+func webhookIDFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	webhookID, err := strconv.Atoi(mux.Vars(r)["webhook_id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid webhook ID")
+		log.Println("Invalid ID parse error:", err)
+		return 0, false
+	}
+	return webhookID, true
+}
+
+func GetWebhooks(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Lists every subscription, secrets are never returned
+	subs, err := webhook.Subscriptions(r.Context(), db)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to obtain webhooks")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Writes the slice as JSON & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, subs)
+}
+
+func GetWebhookByID(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts and converts the "webhook_id" path variable
+	webhookID, ok := webhookIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// Loads the subscription
+	sub, err := webhook.GetSubscription(r.Context(), db, webhookID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to obtain webhook")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Writes JSON response & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, sub)
+}
+
+func CreateWebhook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Decodes and validates the JSON body
+	req, ok := decodeWebhookRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// Generates a signing secret unless the receiver already has one
+	sub := webhook.Subscription{
+		URL:    req.URL,
+		Events: req.Events,
+		Active: req.Active == nil || *req.Active,
+		Secret: req.Secret,
+	}
+	if sub.Secret == "" {
+		sub.Secret = webhook.NewSecret()
+	}
+	if userID, ok := r.Context().Value(utils.UserIDKey).(int); ok && userID > 0 {
+		sub.CreatedBy = &userID
+	}
+
+	// Stores the subscription
+	if err := webhook.CreateSubscription(r.Context(), db, &sub); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create webhook")
+		log.Println("DB insert error:", err)
+		return
+	}
+
+	// The secret must not be cached or stored for Idempotency-Key replays
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Writes JSON response including the secret, which is only shown once, & sends a HTTP 201 response code
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"message":    "Webhook created successfully",
+		"webhook_id": sub.WebhookID,
+		"secret":     sub.Secret,
+	})
+}
+
+func UpdateWebhook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts and converts the "webhook_id" path variable
+	webhookID, ok := webhookIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// Decodes and validates the JSON body, the secret cannot be changed
+	req, ok := decodeWebhookRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Secret != "" {
+		utils.WriteError(w, http.StatusBadRequest, "The secret cannot be changed, create a new webhook instead")
+		return
+	}
+
+	// Updates the subscription
+	found, err := webhook.UpdateSubscription(r.Context(), db, webhook.Subscription{
+		WebhookID: webhookID,
+		URL:       req.URL,
+		Events:    req.Events,
+		Active:    req.Active == nil || *req.Active,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update webhook")
+		log.Println("DB update error:", err)
+		return
+	}
+	if !found {
+		utils.WriteError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+
+	// Writes JSON response & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Webhook updated successfully",
+	})
+}
+
+func DeleteWebhook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts and converts the "webhook_id" path variable
+	webhookID, ok := webhookIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// Deletes the subscription together with its deliveries
+	n, err := webhook.DeleteSubscription(r.Context(), db, webhookID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete webhook")
+		log.Println("DB delete error:", err)
+		return
+	}
+	if n == 0 {
+		utils.WriteError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+
+	// Writes JSON response & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Webhook deleted successfully",
+	})
+}
+
+func GetWebhookDeliveries(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts optional query parameters from the request
+	q := r.URL.Query()
+	filter := webhook.DeliveryFilter{Status: q.Get("status")}
+	switch filter.Status {
+	case "", webhook.StatusPending, webhook.StatusDelivered, webhook.StatusDead:
+	default:
+		utils.WriteError(w, http.StatusBadRequest, "Invalid status (expected pending, delivered or dead)")
+		return
+	}
+
+	// Optional webhook filter and paging
+	for _, param := range []struct {
+		name string
+		dst  *int
+	}{{"webhook_id", &filter.WebhookID}, {"limit", &filter.Limit}, {"offset", &filter.Offset}} {
+		value := q.Get(param.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid "+param.name)
+			return
+		}
+		*param.dst = n
+	}
+
+	// Lists matching deliveries
+	deliveries, err := webhook.Deliveries(r.Context(), db, filter)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to obtain webhook deliveries")
+		log.Println("DB query error:", err)
+		return
+	}
+
+	// Writes the slice as JSON & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, deliveries)
+}
+
+func RetryWebhookDelivery(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	// Extracts and converts the "delivery_id" path variable
+	deliveryID, err := strconv.ParseInt(mux.Vars(r)["delivery_id"], 10, 64)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid delivery ID")
+		log.Println("Invalid ID parse error:", err)
+		return
+	}
+
+	// Requeues the delivery if it is dead
+	requeued, err := webhook.Retry(r.Context(), db, deliveryID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retry webhook delivery")
+		log.Println("DB update error:", err)
+		return
+	}
+	if !requeued {
+		utils.WriteError(w, http.StatusNotFound, "Dead webhook delivery not found")
+		return
+	}
+
+	// Writes JSON response & sends a HTTP 200 response code
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": "Webhook delivery queued for retry",
+	})
+}
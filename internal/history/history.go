@@ -0,0 +1,135 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// Profile types with a change history
+const (
+	ProfileStudent = "student"
+	ProfileAdmin   = "admin"
+)
+
+// Version is one saved state of a profile together with the fields that changed to reach it
+type Version struct {
+	Version      int             `json:"version"`
+	ChangedBy    *int            `json:"changed_by"`
+	ChangedAt    time.Time       `json:"changed_at"`
+	Changes      json.RawMessage `json:"changes,omitempty"`
+	RevertedFrom *int            `json:"reverted_from,omitempty"`
+	Snapshot     json.RawMessage `json:"snapshot,omitempty"`
+}
+
+// Record saves the new state of a profile inside the caller's transaction.
+// version is the row version before the change; the new state is stored as version+1.
+// Profiles changed before history existed get their previous state saved as a baseline first.
+// Snapshots and changes keep encrypted person fields such as email sealed, like person itself.
+func Record(ctx context.Context, tx *sql.Tx, profileType string, id, version int, before, after any, changedBy any, revertedFrom *int) error {
+	beforeJSON, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	var changes any
+	if diff := utils.JSONDiff(beforeJSON, afterJSON); diff != nil {
+		sealed, err := fieldcrypt.SealJSON(diff, fieldcrypt.PersonFields)
+		if err != nil {
+			return err
+		}
+		changes = string(sealed)
+	}
+	if beforeJSON, err = fieldcrypt.SealJSON(beforeJSON, fieldcrypt.PersonFields); err != nil {
+		return err
+	}
+	if afterJSON, err = fieldcrypt.SealJSON(afterJSON, fieldcrypt.PersonFields); err != nil {
+		return err
+	}
+
+	// Baseline for the state the change starts from
+	_, err = tx.ExecContext(ctx, `
+		INSERT IGNORE INTO profile_history (profile_type, profile_id, version, changed_by, changed_at, changes, snapshot)
+		VALUES (?, ?, ?, NULL, NOW(), NULL, ?)`,
+		profileType, id, version, string(beforeJSON),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO profile_history (profile_type, profile_id, version, changed_by, changed_at, changes, reverted_from, snapshot)
+		VALUES (?, ?, ?, ?, NOW(), ?, ?, ?)`,
+		profileType, id, version+1, changedBy, changes, revertedFrom, string(afterJSON),
+	)
+	return err
+}
+
+// List returns the versions of a profile, newest first, without their snapshots
+func List(ctx context.Context, q utils.DBTX, profileType string, id int) ([]Version, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT version, changed_by, changed_at, changes, reverted_from
+		FROM profile_history
+		WHERE profile_type = ? AND profile_id = ?
+		ORDER BY version DESC`,
+		profileType, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]Version, 0)
+	for rows.Next() {
+		var v Version
+		var changedBy, revertedFrom sql.NullInt64
+		var changes sql.NullString
+		if err := rows.Scan(&v.Version, &changedBy, &v.ChangedAt, &changes, &revertedFrom); err != nil {
+			return nil, err
+		}
+		if changedBy.Valid {
+			id := int(changedBy.Int64)
+			v.ChangedBy = &id
+		}
+		if revertedFrom.Valid {
+			from := int(revertedFrom.Int64)
+			v.RevertedFrom = &from
+		}
+		if changes.Valid {
+			opened, err := fieldcrypt.OpenJSON([]byte(changes.String), fieldcrypt.PersonFields)
+			if err != nil {
+				return nil, err
+			}
+			v.Changes = json.RawMessage(opened)
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// Load decodes the saved state of one version of a profile into dst
+func Load(ctx context.Context, q utils.DBTX, profileType string, id, version int, dst any) error {
+	var snapshot string
+	err := q.QueryRowContext(ctx, `
+		SELECT snapshot
+		FROM profile_history
+		WHERE profile_type = ? AND profile_id = ? AND version = ?`,
+		profileType, id, version,
+	).Scan(&snapshot)
+	if err != nil {
+		return err
+	}
+	opened, err := fieldcrypt.OpenJSON([]byte(snapshot), fieldcrypt.PersonFields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(opened, dst)
+}
@@ -0,0 +1,188 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type entry struct {
+	version                                    int64
+	changedBy, changes, revertedFrom, snapshot driver.Value
+}
+
+// historyTable is profile_history, rows keyed by profile and version
+type historyTable struct {
+	testdb.DB
+	mu   sync.Mutex
+	rows map[string]*entry
+}
+
+func newHistoryTable() *historyTable {
+	h := &historyTable{rows: map[string]*entry{}}
+	h.Query = h.query
+	h.Exec = h.exec
+	return h
+}
+
+func historyKey(profileType, id, version driver.Value) string {
+	return fmt.Sprint(profileType, "/", id, "/", version)
+}
+
+func (h *historyTable) exec(query string, args []driver.Value) (testdb.Result, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := historyKey(args[0], args[1], args[2])
+	switch {
+	case strings.Contains(query, "INSERT IGNORE INTO profile_history"):
+		if h.rows[key] != nil {
+			return testdb.Result{}, nil
+		}
+		h.rows[key] = &entry{version: args[2].(int64), snapshot: args[3]}
+	case strings.Contains(query, "INSERT INTO profile_history"):
+		if h.rows[key] != nil {
+			return testdb.Result{}, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+		}
+		h.rows[key] = &entry{version: args[2].(int64), changedBy: args[3], changes: args[4], revertedFrom: args[5], snapshot: args[6]}
+	}
+	return testdb.Result{Affected: 1}, nil
+}
+
+func (h *historyTable) query(query string, args []driver.Value) (*testdb.Rows, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case strings.Contains(query, "SELECT snapshot"):
+		if e := h.rows[historyKey(args[0], args[1], args[2])]; e != nil {
+			return testdb.Row(e.snapshot), nil
+		}
+		return testdb.Empty(), nil
+
+	case strings.Contains(query, "SELECT version, changed_by"):
+		var entries []*entry
+		prefix := historyKey(args[0], args[1], "")
+		for key, e := range h.rows {
+			if strings.HasPrefix(key, prefix) {
+				entries = append(entries, e)
+			}
+		}
+		slices.SortFunc(entries, func(a, b *entry) int { return int(b.version - a.version) })
+		rows := &testdb.Rows{}
+		for _, e := range entries {
+			rows.Values = append(rows.Values, []driver.Value{e.version, e.changedBy, time.Now(), e.changes, e.revertedFrom})
+		}
+		return rows, nil
+	}
+	return nil, nil
+}
+
+type profile struct {
+	Name string `json:"name"`
+	City string `json:"city"`
+}
+
+func record(t *testing.T, db *sql.DB, version int, before, after profile, revertedFrom *int) error {
+	t.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := Record(context.Background(), tx, ProfileStudent, 7, version, before, after, 2, revertedFrom); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func TestRecordSavesBaselineOnce(t *testing.T) {
+	table := newHistoryTable()
+	db := table.Open(t)
+	ctx := context.Background()
+	original := profile{Name: "Ann", City: "Ames"}
+	moved := profile{Name: "Ann", City: "Boone"}
+
+	// The profile is at version 3 when its first change is recorded
+	if err := record(t, db, 3, original, moved, nil); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := List(ctx, db, ProfileStudent, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Version != 4 || versions[1].Version != 3 {
+		t.Fatalf("versions = %+v, want 4 and its baseline 3", versions)
+	}
+	if baseline := versions[1]; baseline.ChangedBy != nil || baseline.Changes != nil {
+		t.Fatalf("baseline = %+v, want no author and no changes", baseline)
+	}
+	if change := versions[0]; change.ChangedBy == nil || *change.ChangedBy != 2 || !strings.Contains(string(change.Changes), "Boone") ||
+		strings.Contains(string(change.Changes), "name") {
+		t.Fatalf("change = %+v with %s, want only city by 2", change, change.Changes)
+	}
+
+	// The next change starts from a saved version, its baseline insert is ignored
+	renamed := profile{Name: "Anna", City: "Boone"}
+	if err := record(t, db, 4, moved, renamed, nil); err != nil {
+		t.Fatal(err)
+	}
+	var v4 profile
+	if err := Load(ctx, db, ProfileStudent, 7, 4, &v4); err != nil || v4 != moved {
+		t.Fatalf("version 4 = %+v, %v, want the state it was saved with", v4, err)
+	}
+
+	// A version saved twice means a concurrent change, the transaction fails
+	if err := record(t, db, 4, moved, renamed, nil); err == nil {
+		t.Fatal("recording version 5 twice succeeded")
+	}
+}
+
+func TestRecordRevert(t *testing.T) {
+	table := newHistoryTable()
+	db := table.Open(t)
+	ctx := context.Background()
+	original := profile{Name: "Ann", City: "Ames"}
+	moved := profile{Name: "Ann", City: "Boone"}
+	if err := record(t, db, 1, original, moved, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reverting loads version 1 and records it as version 3
+	var target profile
+	if err := Load(ctx, db, ProfileStudent, 7, 1, &target); err != nil || target != original {
+		t.Fatalf("version 1 = %+v, %v", target, err)
+	}
+	from := 1
+	if err := record(t, db, 2, moved, target, &from); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := List(ctx, db, ProfileStudent, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 || versions[0].RevertedFrom == nil || *versions[0].RevertedFrom != 1 {
+		t.Fatalf("versions = %+v, want version 3 reverted from 1", versions)
+	}
+	var changes map[string]json.RawMessage
+	if err := json.Unmarshal(versions[0].Changes, &changes); err != nil || len(changes) != 1 || changes["city"] == nil {
+		t.Fatalf("revert changes = %s, want city", versions[0].Changes)
+	}
+	var v3 profile
+	if err := Load(ctx, db, ProfileStudent, 7, 3, &v3); err != nil || v3 != original {
+		t.Fatalf("version 3 = %+v, %v, want the reverted state", v3, err)
+	}
+	if err := Load(ctx, db, ProfileStudent, 7, 9, &v3); err != sql.ErrNoRows {
+		t.Fatalf("Load of a missing version = %v, want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,344 @@
+// Package idempotency makes POST requests safe to retry. A client sends an Idempotency-Key header;
+// the first successful response for that user and key is stored and replayed for retries within
+// the window, and a key reused with a different request is rejected.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Headers read and written by the middleware
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+)
+
+const (
+	maxKeyLength = 255
+	// maxRequestBody covers the 20MB upload limit plus multipart overhead
+	maxRequestBody = 32 << 20
+	// maxStoredResponse bounds the stored response, larger responses are not replayable
+	maxStoredResponse = 1 << 20
+)
+
+// Window is how long a key is remembered, IDEMPOTENCY_WINDOW defaults to a day
+var Window = utils.EnvDuration("IDEMPOTENCY_WINDOW", 24*time.Hour)
+
+// Lease is how long a claim stays valid without a heartbeat, IDEMPOTENCY_LEASE defaults to a
+// minute. A running request keeps extending it, so only the claim of a request that died with
+// its server expires and the key can be used again.
+var Lease = utils.EnvDuration("IDEMPOTENCY_LEASE", time.Minute)
+
+// withheldBody replaces responses that must not be stored, such as ones carrying secrets
+var withheldBody = []byte(`{"message":"The original response is not stored because it contained credentials"}`)
+
+// replayedHeaders are the response headers stored with the body
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// stored is a remembered request and, once it finished, its response
+type stored struct {
+	requestHash string
+	status      sql.NullInt64
+	headers     []byte
+	body        []byte
+}
+
+// Middleware applies Idempotency-Key handling to POST requests. It must run after AuthMiddleware
+// because keys are scoped to the authenticated user.
+func Middleware(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(HeaderKey)
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxKeyLength {
+				utils.WriteError(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+				return
+			}
+			userID, ok := r.Context().Value(utils.UserIDKey).(int)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Buffers the body to fingerprint it, the handler reads the buffered copy
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody+1))
+			if err != nil {
+				utils.WriteError(w, http.StatusBadRequest, "Failed to read request body")
+				log.Println("Body read error:", err)
+				return
+			}
+			if len(body) > maxRequestBody {
+				utils.WriteError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			hash := fingerprint(r, body)
+
+			// Claims the key, or finds the request that already claimed it
+			existing, err := claim(r.Context(), db, userID, key, r, hash)
+			if err != nil {
+				utils.WriteError(w, http.StatusInternalServerError, "Failed to check Idempotency-Key")
+				log.Println("DB query error:", err)
+				return
+			}
+			if existing != nil {
+				switch {
+				case existing.requestHash != hash:
+					utils.WriteError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request")
+				case !existing.status.Valid:
+					utils.WriteError(w, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+				default:
+					if err := replay(w, existing); err != nil {
+						utils.WriteError(w, http.StatusInternalServerError, "Failed to replay stored response")
+						log.Println("Idempotency replay error:", err)
+					}
+				}
+				return
+			}
+
+			// Keeps the claim alive while the request runs
+			stop := heartbeat(context.WithoutCancel(r.Context()), db, userID, key)
+			rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			stop()
+
+			// The request finished after the client left or the server is stopping, the key is still saved
+			ctx := context.WithoutCancel(r.Context())
+
+			// Only successes are remembered. Rejections such as a 403 from the role check that runs
+			// after this middleware, validation errors and server errors let a retry run again, so
+			// a request refused before it changed anything is not replayed for the whole window.
+			if rec.status < 200 || rec.status > 299 || rec.overflow {
+				if _, err := db.ExecContext(ctx, "DELETE FROM idempotency_key WHERE user_id = ? AND idempotency_key = ?", userID, key); err != nil {
+					log.Println("DB delete error:", err)
+				}
+				return
+			}
+			if err := save(ctx, db, userID, key, rec); err != nil {
+				log.Println("DB update error:", err)
+			}
+		})
+	}
+}
+
+// fingerprint hashes what makes a request distinct. Multipart boundaries are random per attempt,
+// so they are blanked out before hashing.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	h.Write([]byte(mediaType + "\n"))
+	if boundary := params["boundary"]; strings.HasPrefix(mediaType, "multipart/") && boundary != "" {
+		body = bytes.ReplaceAll(body, []byte(boundary), nil)
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// claim inserts an in-progress row for the key, valid for one Lease. It returns the existing row
+// when the key is taken and still inside its window or lease; expired rows are replaced.
+func claim(ctx context.Context, db *sql.DB, userID int, key string, r *http.Request, hash string) (*stored, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		now := time.Now().UTC()
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO idempotency_key (user_id, idempotency_key, method, path, request_hash, created_at, expires_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			userID, key, r.Method, r.URL.Path, hash, now, now.Add(Lease),
+		)
+		if err == nil {
+			return nil, nil
+		}
+		var mysqlErr *mysql.MySQLError
+		if !errors.As(err, &mysqlErr) || mysqlErr.Number != 1062 {
+			return nil, err
+		}
+
+		// The key exists, it is replayed unless it expired
+		var s stored
+		var expiresAt time.Time
+		err = db.QueryRowContext(ctx, `
+			SELECT request_hash, status, response_headers, response_body, expires_at
+			FROM idempotency_key
+			WHERE user_id = ? AND idempotency_key = ?`,
+			userID, key,
+		).Scan(&s.requestHash, &s.status, &s.headers, &s.body, &expiresAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if expiresAt.After(now) {
+			return &s, nil
+		}
+		if _, err := db.ExecContext(ctx,
+			"DELETE FROM idempotency_key WHERE user_id = ? AND idempotency_key = ? AND expires_at <= ?",
+			userID, key, now,
+		); err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("idempotency key kept changing while being claimed")
+}
+
+// heartbeat extends the lease of an in-progress claim until the returned function is called
+func heartbeat(ctx context.Context, db *sql.DB, userID int, key string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		interval := Lease / 3
+		if interval <= 0 {
+			interval = time.Second
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if _, err := db.ExecContext(ctx,
+				"UPDATE idempotency_key SET expires_at = ? WHERE user_id = ? AND idempotency_key = ? AND status IS NULL",
+				time.Now().UTC().Add(Lease), userID, key,
+			); err != nil {
+				log.Println("DB update error:", err)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// save stores the finished response for replays. Responses can carry any column, so they are
+// encrypted as a whole whenever idempotency_key.response_body is configured for encryption.
+// Responses marked Cache-Control: no-store, such as new webhook secrets and invite tokens, are
+// never stored: their retries get the status and a body saying the response was withheld.
+func save(ctx context.Context, db *sql.DB, userID int, key string, rec *recorder) error {
+	headers := map[string]string{}
+	for _, name := range replayedHeaders {
+		if value := rec.Header().Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+	response := rec.body.Bytes()
+	if strings.Contains(rec.Header().Get("Cache-Control"), "no-store") {
+		headers = map[string]string{"Content-Type": "application/json"}
+		response = withheldBody
+	}
+	encoded, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+	body, err := fieldcrypt.Encrypt(fieldcrypt.IdempotencyResponse, string(response))
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		UPDATE idempotency_key SET status = ?, response_headers = ?, response_body = ?, expires_at = ?
+		WHERE user_id = ? AND idempotency_key = ?`,
+		rec.status, encoded, []byte(body), time.Now().UTC().Add(Window), userID, key,
+	)
+	return err
+}
+
+// replay writes a stored response, marked so clients can tell it was not executed again
+func replay(w http.ResponseWriter, s *stored) error {
+	body, err := fieldcrypt.Decrypt(fieldcrypt.IdempotencyResponse, string(s.body))
+	if err != nil {
+		return err
+	}
+
+	var headers map[string]string
+	json.Unmarshal(s.headers, &headers)
+	for name, value := range headers {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set(HeaderReplayed, "true")
+	w.WriteHeader(int(s.status.Int64))
+	w.Write([]byte(body))
+	return nil
+}
+
+// Purge removes keys whose window has passed
+func Purge(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, "DELETE FROM idempotency_key WHERE expires_at <= ?", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// StartPurger runs Purge on an interval until the context is cancelled
+func StartPurger(ctx context.Context, db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := Purge(ctx, db); err != nil {
+				log.Println("Idempotency purge error:", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// recorder passes the response through while keeping a copy of it
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	overflow    bool
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.wroteHeader = true
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.body.Len()+len(b) > maxStoredResponse {
+		rec.overflow = true
+	} else {
+		rec.body.Write(b)
+	}
+	return rec.ResponseWriter.Write(b)
+}
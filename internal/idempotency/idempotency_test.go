@@ -0,0 +1,237 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type keyRow struct {
+	hash      string
+	status    driver.Value
+	headers   driver.Value
+	body      driver.Value
+	expiresAt time.Time
+}
+
+// keyTable is the idempotency_key table, rows keyed by user and key
+type keyTable struct {
+	testdb.DB
+	mu   sync.Mutex
+	rows map[string]*keyRow
+}
+
+func newKeyTable() *keyTable {
+	k := &keyTable{rows: map[string]*keyRow{}}
+	k.Query = k.query
+	k.Exec = k.exec
+	return k
+}
+
+func rowKey(user, key driver.Value) string {
+	return fmt.Sprint(user, "/", key)
+}
+
+func (k *keyTable) row(user int64, key string) *keyRow {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.rows[rowKey(user, key)]
+}
+
+func (k *keyTable) query(query string, args []driver.Value) (*testdb.Rows, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	row := k.rows[rowKey(args[0], args[1])]
+	if row == nil {
+		return testdb.Empty(), nil
+	}
+	return testdb.Row(row.hash, row.status, row.headers, row.body, row.expiresAt), nil
+}
+
+func (k *keyTable) exec(query string, args []driver.Value) (testdb.Result, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	switch {
+	case strings.Contains(query, "INSERT INTO idempotency_key"):
+		id := rowKey(args[0], args[1])
+		if k.rows[id] != nil {
+			return testdb.Result{}, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+		}
+		k.rows[id] = &keyRow{hash: args[4].(string), expiresAt: args[6].(time.Time)}
+
+	case strings.Contains(query, "SET status = ?"):
+		row := k.rows[rowKey(args[4], args[5])]
+		row.status, row.headers, row.body, row.expiresAt = args[0], args[1], args[2], args[3].(time.Time)
+
+	case strings.Contains(query, "SET expires_at = ?"):
+		if row := k.rows[rowKey(args[1], args[2])]; row != nil && row.status == nil {
+			row.expiresAt = args[0].(time.Time)
+		}
+
+	case strings.Contains(query, "expires_at <= ?") && strings.Contains(query, "idempotency_key = ?"):
+		id := rowKey(args[0], args[1])
+		if row := k.rows[id]; row != nil && !row.expiresAt.After(args[2].(time.Time)) {
+			delete(k.rows, id)
+		}
+
+	case strings.Contains(query, "DELETE FROM idempotency_key WHERE user_id = ?"):
+		delete(k.rows, rowKey(args[0], args[1]))
+	}
+	return testdb.Result{Affected: 1}, nil
+}
+
+// newPost returns a POST with an Idempotency-Key sent by user 1
+func newPost(key, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/point-of-contact", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(HeaderKey, key)
+	return r.WithContext(context.WithValue(r.Context(), utils.UserIDKey, 1))
+}
+
+func post(h http.Handler, key, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newPost(key, body))
+	return w
+}
+
+// counting is a handler answering with status and counting the requests it ran
+type counting struct {
+	mu     sync.Mutex
+	runs   int
+	status int
+}
+
+func (c *counting) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	c.runs++
+	status := c.status
+	c.mu.Unlock()
+	w.Header().Set("Location", "/point-of-contact/9")
+	utils.WriteJSON(w, status, map[string]int{"point_of_contact_id": 9})
+}
+
+func TestReplay(t *testing.T) {
+	table := newKeyTable()
+	next := &counting{status: http.StatusCreated}
+	h := Middleware(table.Open(t))(next)
+
+	first := post(h, "key-1", `{"duration":30}`)
+	if first.Code != http.StatusCreated || first.Header().Get(HeaderReplayed) != "" {
+		t.Fatalf("first request = %d %v", first.Code, first.Header())
+	}
+
+	retry := post(h, "key-1", `{"duration":30}`)
+	if next.runs != 1 {
+		t.Fatalf("the retry ran the handler again, %d runs", next.runs)
+	}
+	if retry.Code != http.StatusCreated || retry.Header().Get(HeaderReplayed) != "true" ||
+		retry.Header().Get("Location") != "/point-of-contact/9" || retry.Body.String() != first.Body.String() {
+		t.Fatalf("replay = %d %v %s, want the first response", retry.Code, retry.Header(), retry.Body)
+	}
+
+	// Another key is a new request
+	if w := post(h, "key-2", `{"duration":30}`); w.Code != http.StatusCreated || next.runs != 2 {
+		t.Fatalf("a new key = %d after %d runs", w.Code, next.runs)
+	}
+}
+
+func TestMismatchedRequest(t *testing.T) {
+	table := newKeyTable()
+	next := &counting{status: http.StatusCreated}
+	h := Middleware(table.Open(t))(next)
+
+	post(h, "key-1", `{"duration":30}`)
+	w := post(h, "key-1", `{"duration":45}`)
+	if w.Code != http.StatusUnprocessableEntity || next.runs != 1 {
+		t.Fatalf("a different body under the same key = %d after %d runs, want 422", w.Code, next.runs)
+	}
+}
+
+func TestErrorsAreNotStored(t *testing.T) {
+	for _, status := range []int{http.StatusForbidden, http.StatusBadRequest, http.StatusInternalServerError} {
+		table := newKeyTable()
+		next := &counting{status: status}
+		h := Middleware(table.Open(t))(next)
+
+		if w := post(h, "key-1", `{}`); w.Code != status {
+			t.Fatalf("first request = %d, want %d", w.Code, status)
+		}
+		if table.row(1, "key-1") != nil {
+			t.Fatalf("a %d response was stored", status)
+		}
+
+		// Once the cause is fixed, e.g. the role was granted, the retry runs
+		next.status = http.StatusCreated
+		if w := post(h, "key-1", `{}`); w.Code != http.StatusCreated || w.Header().Get(HeaderReplayed) != "" || next.runs != 2 {
+			t.Fatalf("retry after a %d = %d replayed %q after %d runs", status, w.Code, w.Header().Get(HeaderReplayed), next.runs)
+		}
+	}
+}
+
+func TestConcurrentClaims(t *testing.T) {
+	table := newKeyTable()
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		utils.WriteJSON(w, http.StatusCreated, map[string]int{"point_of_contact_id": 9})
+	})
+	h := Middleware(table.Open(t))(slow)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post(h, "key-1", `{}`) }()
+	<-started
+
+	// The second insert hits the duplicate key and finds the claim still running
+	if w := post(h, "key-1", `{}`); w.Code != http.StatusConflict {
+		t.Fatalf("a retry during the first request = %d, want 409", w.Code)
+	}
+	if n := table.Count("INSERT INTO idempotency_key"); n != 2 {
+		t.Fatalf("%d claims inserted, want 2", n)
+	}
+
+	close(release)
+	if w := <-done; w.Code != http.StatusCreated {
+		t.Fatalf("first request = %d", w.Code)
+	}
+	if w := post(h, "key-1", `{}`); w.Code != http.StatusCreated || w.Header().Get(HeaderReplayed) != "true" {
+		t.Fatalf("retry after the first request = %d, want a replay", w.Code)
+	}
+}
+
+func TestExpiredLease(t *testing.T) {
+	table := newKeyTable()
+	next := &counting{status: http.StatusCreated}
+	h := Middleware(table.Open(t))(next)
+
+	// A claim whose request died with its server, its lease ran out
+	table.rows[rowKey(int64(1), "key-1")] = &keyRow{hash: "lost", expiresAt: time.Now().Add(-time.Second)}
+
+	if w := post(h, "key-1", `{}`); w.Code != http.StatusCreated || next.runs != 1 {
+		t.Fatalf("request after the lease ran out = %d after %d runs", w.Code, next.runs)
+	}
+	if row := table.row(1, "key-1"); row == nil || row.status != int64(http.StatusCreated) || time.Until(row.expiresAt) < Window-time.Minute {
+		t.Fatalf("the new claim was not saved for the window: %+v", row)
+	}
+
+	// A live claim of the same request is not taken over
+	hash := fingerprint(newPost("key-2", `{}`), []byte(`{}`))
+	table.rows[rowKey(int64(1), "key-2")] = &keyRow{hash: hash, expiresAt: time.Now().Add(Lease)}
+	if w := post(h, "key-2", `{}`); w.Code != http.StatusConflict {
+		t.Fatalf("request during a live lease = %d, want 409", w.Code)
+	}
+	if next.runs != 1 {
+		t.Fatal("a live claim was taken over")
+	}
+}
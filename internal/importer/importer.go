@@ -0,0 +1,435 @@
+// Package importer creates and updates students in bulk from registrar CSV or XLSX files.
+package importer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/history"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/invite"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/studentstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/xlsx"
+)
+
+// Commit modes
+const (
+	// ModeTransaction saves every row or none of them
+	ModeTransaction = "transaction"
+	// ModePerRow saves each valid row on its own and skips the invalid ones
+	ModePerRow = "per-row"
+)
+
+// Row outcomes
+const (
+	ActionCreated   = "created"
+	ActionUpdated   = "updated"
+	ActionUnchanged = "unchanged"
+	ActionFailed    = "failed"
+)
+
+// ErrEmptyFile is returned when the upload has no header row
+var ErrEmptyFile = errors.New("import: file is empty")
+
+// Options control how an import runs
+type Options struct {
+	// Mapping maps normalized column headers to models.Student JSON field names
+	Mapping map[string]string
+	// DryRun validates and plans every row, then rolls everything back
+	DryRun bool
+	// Mode is ModeTransaction (default) or ModePerRow
+	Mode string
+	// CreateLogins adds a student login with an invite for students that have none
+	CreateLogins bool
+	// InviteTTL is how long invites stay valid, 7 days by default
+	InviteTTL time.Duration
+	// ActorID is recorded as the author of profile changes
+	ActorID any
+	// Record, when set, is called for every created or updated row inside the row's transaction,
+	// so the audit trail commits or rolls back together with the row
+	Record func(ctx context.Context, tx *sql.Tx, res *RowResult) error
+}
+
+// RowResult is the outcome of one data row. Row is the 1-based line number in the file.
+type RowResult struct {
+	Row          int      `json:"row"`
+	Email        string   `json:"email"`
+	Action       string   `json:"action"`
+	StudentID    int      `json:"student_id,omitempty"`
+	LoginCreated bool     `json:"login_created,omitempty"`
+	InviteToken  string   `json:"invite_token,omitempty"`
+	Errors       []string `json:"errors,omitempty"`
+
+	// Before and After are the profile states around the change, used for the audit trail
+	Before *models.Student `json:"-"`
+	After  *models.Student `json:"-"`
+}
+
+// Report summarises an import
+type Report struct {
+	Mode           string      `json:"mode"`
+	DryRun         bool        `json:"dry_run"`
+	Committed      bool        `json:"committed"`
+	Created        int         `json:"created"`
+	Updated        int         `json:"updated"`
+	Unchanged      int         `json:"unchanged"`
+	Failed         int         `json:"failed"`
+	LoginsCreated  int         `json:"logins_created"`
+	IgnoredColumns []string    `json:"ignored_columns"`
+	Rows           []RowResult `json:"rows"`
+}
+
+// rowErrors are validation problems reported back for a row
+type rowErrors []string
+
+func (e rowErrors) Error() string { return strings.Join(e, "; ") }
+
+// Run imports the rows of a table whose first row is the header
+func Run(ctx context.Context, db *sql.DB, rows [][]string, opts Options) (*Report, error) {
+	if len(rows) == 0 {
+		return nil, ErrEmptyFile
+	}
+	if opts.Mode == "" {
+		opts.Mode = ModeTransaction
+	}
+	if opts.Mode != ModeTransaction && opts.Mode != ModePerRow {
+		return nil, fmt.Errorf("import: unknown mode %q", opts.Mode)
+	}
+	if opts.InviteTTL <= 0 {
+		opts.InviteTTL = 7 * 24 * time.Hour
+	}
+
+	fields, ignored, err := columnFields(rows[0], opts.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Mode: opts.Mode, DryRun: opts.DryRun, IgnoredColumns: ignored, Rows: []RowResult{}}
+
+	// Parses every row first so duplicate emails are caught before anything is written
+	var values []map[string]string
+	firstRow := map[string]int{}
+	for i, row := range rows[1:] {
+		v := rowValues(fields, row)
+		if v == nil {
+			continue
+		}
+
+		res := RowResult{Row: i + 2, Email: v["email"]}
+		key := strings.ToLower(res.Email)
+		if first, ok := firstRow[key]; ok && key != "" {
+			res.Errors = []string{fmt.Sprintf("email already used on row %d", first)}
+		} else {
+			firstRow[key] = res.Row
+		}
+		report.Rows = append(report.Rows, res)
+		values = append(values, v)
+	}
+
+	switch opts.Mode {
+	case ModeTransaction:
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		for i := range report.Rows {
+			res := &report.Rows[i]
+			if len(res.Errors) > 0 {
+				continue
+			}
+			// A savepoint per row undoes a half-written row and lets the remaining rows still be checked
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT import_row"); err != nil {
+				return nil, err
+			}
+			if err := applyRow(ctx, tx, values[i], opts, res); err != nil {
+				fail(res, err)
+				if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT import_row"); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		tally(report)
+		if report.Failed == 0 && !opts.DryRun {
+			if err := tx.Commit(); err != nil {
+				return nil, err
+			}
+			report.Committed = true
+		}
+
+	case ModePerRow:
+		for i := range report.Rows {
+			res := &report.Rows[i]
+			if len(res.Errors) > 0 {
+				continue
+			}
+			if err := runRow(ctx, db, values[i], opts, res); err != nil {
+				fail(res, err)
+			}
+		}
+
+		// Committed means at least one row was written, a run where every row failed changed nothing
+		tally(report)
+		report.Committed = !opts.DryRun && report.Created+report.Updated+report.LoginsCreated > 0
+	}
+
+	// Tokens from rolled back rows were never stored
+	if !report.Committed {
+		for i := range report.Rows {
+			report.Rows[i].InviteToken = ""
+		}
+	}
+
+	return report, nil
+}
+
+// runRow saves one row in its own transaction
+func runRow(ctx context.Context, db *sql.DB, values map[string]string, opts Options, res *RowResult) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := applyRow(ctx, tx, values, opts, res); err != nil {
+		return err
+	}
+	if opts.DryRun {
+		return nil
+	}
+	return tx.Commit()
+}
+
+// applyRow creates or updates the student matching the row's email
+func applyRow(ctx context.Context, tx *sql.Tx, values map[string]string, opts Options, res *RowResult) error {
+	// Finds the person already using this email, if any
+	var personID int
+	var isStudent, trashed bool
+	emailMatch, args := fieldcrypt.EmailMatch("p", values["email"])
+	err := tx.QueryRowContext(ctx, `
+		SELECT p.person_id, s.student_id IS NOT NULL, p.deleted_at IS NOT NULL
+		FROM person p
+		LEFT JOIN student s ON s.student_id = p.person_id
+		WHERE `+emailMatch+`
+		LIMIT 1
+		FOR UPDATE`,
+		args...,
+	).Scan(&personID, &isStudent, &trashed)
+
+	switch {
+	case err == sql.ErrNoRows:
+		var s models.Student
+		if err := assign(&s, values); err != nil {
+			return err
+		}
+		// Another request may have taken the email since the lookup, the unique email index refuses it
+		id, err := studentstore.Insert(ctx, tx, s)
+		if utils.IsDuplicateEntry(err) {
+			return rowErrors{"email is already used by another person"}
+		}
+		if err != nil {
+			return err
+		}
+		s.StudentID = id
+		res.Action, res.StudentID, res.After = ActionCreated, id, &s
+
+	case err != nil:
+		return err
+
+	case !isStudent:
+		return rowErrors{"email belongs to an account that is not a student"}
+
+	case trashed:
+		return rowErrors{"a student with this email is in the trash, restore it first"}
+
+	default:
+		current, version, err := studentstore.Fetch(ctx, tx, personID)
+		if err != nil {
+			return err
+		}
+
+		// Columns missing from the file or left blank keep their current values
+		s := current
+		if err := assign(&s, values); err != nil {
+			return err
+		}
+		res.StudentID = personID
+		if s == current {
+			res.Action = ActionUnchanged
+			break
+		}
+
+		if _, err := studentstore.Update(ctx, tx, personID, s); utils.IsDuplicateEntry(err) {
+			return rowErrors{"email is already used by another person"}
+		} else if err != nil {
+			return err
+		}
+		if err := history.Record(ctx, tx, history.ProfileStudent, personID, version, current, s, opts.ActorID, nil); err != nil {
+			return err
+		}
+		res.Action, res.Before, res.After = ActionUpdated, &current, &s
+	}
+
+	if opts.Record != nil && res.Action != ActionUnchanged {
+		if err := opts.Record(ctx, tx, res); err != nil {
+			return err
+		}
+	}
+
+	if !opts.CreateLogins {
+		return nil
+	}
+
+	// Only students without a login get one
+	var logins int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE id = ?", res.StudentID).Scan(&logins); err != nil {
+		return err
+	}
+	if logins > 0 {
+		return nil
+	}
+
+	token, err := invite.CreateLogin(ctx, tx, res.StudentID, opts.InviteTTL)
+	if err != nil {
+		return err
+	}
+	res.LoginCreated, res.InviteToken = true, token
+	return nil
+}
+
+// assign copies the non-empty row values onto the student and validates the result
+func assign(s *models.Student, values map[string]string) error {
+	var errs rowErrors
+	v := reflect.ValueOf(s).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		value, ok := values[name]
+		if !ok || value == "" {
+			continue
+		}
+
+		switch v.Field(i).Kind() {
+		case reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, name+" must be a whole number")
+				continue
+			}
+			v.Field(i).SetInt(int64(n))
+		default:
+			v.Field(i).SetString(value)
+		}
+	}
+
+	// Spreadsheets store dates as serial day numbers
+	s.Birthday = xlsx.ExcelDate(s.Birthday)
+	if s.Birthday != "" {
+		if _, err := time.Parse("2006-01-02", s.Birthday); err != nil {
+			errs = append(errs, "birthday must be a date formatted YYYY-MM-DD")
+		}
+	}
+	if s.Email != "" && !strings.Contains(s.Email, "@") {
+		errs = append(errs, "email is not a valid address")
+	}
+	if missing := missingFields(*s); len(missing) > 0 {
+		errs = append(errs, "missing required fields: "+strings.Join(missing, ", "))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// missingFields lists the required student fields that are empty, matching POST /student
+func missingFields(s models.Student) []string {
+	missing := []string{}
+	for name, empty := range map[string]bool{
+		"first_name":        s.FirstName == "",
+		"last_name":         s.LastName == "",
+		"email":             s.Email == "",
+		"phone_number":      s.PhoneNumber == "",
+		"sex":               s.Sex == "",
+		"birthday":          s.Birthday == "",
+		"address":           s.Address == "",
+		"city":              s.City == "",
+		"country":           s.Country == "",
+		"year":              s.Year == "",
+		"start_year":        s.StartYear == 0,
+		"planned_grad_year": s.PlannedGradYear == 0,
+	} {
+		if empty {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// rowValues maps a row's cells to student fields, returning nil for blank rows
+func rowValues(fields []string, row []string) map[string]string {
+	values := map[string]string{}
+	blank := true
+	for i, field := range fields {
+		if field == "" || i >= len(row) {
+			continue
+		}
+		value := strings.TrimSpace(row[i])
+		values[field] = value
+		blank = blank && value == ""
+	}
+	if blank {
+		return nil
+	}
+	return values
+}
+
+// fail records why a row could not be saved
+func fail(res *RowResult, err error) {
+	var errs rowErrors
+	if errors.As(err, &errs) {
+		res.Errors = errs
+	} else {
+		log.Printf("Import row %d error: %v\n", res.Row, err)
+		res.Errors = []string{"database error: " + err.Error()}
+	}
+	res.Action, res.LoginCreated, res.InviteToken = ActionFailed, false, ""
+	res.Before, res.After = nil, nil
+}
+
+// tally counts the row outcomes
+func tally(report *Report) {
+	for i := range report.Rows {
+		res := &report.Rows[i]
+		if len(res.Errors) > 0 {
+			res.Action = ActionFailed
+		}
+		switch res.Action {
+		case ActionCreated:
+			report.Created++
+		case ActionUpdated:
+			report.Updated++
+		case ActionUnchanged:
+			report.Unchanged++
+		case ActionFailed:
+			report.Failed++
+		}
+		if res.LoginCreated {
+			report.LoginsCreated++
+		}
+	}
+}
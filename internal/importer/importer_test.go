@@ -0,0 +1,70 @@
+package importer
+
+import (
+	"context"
+	"database/sql/driver"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// peopleDB knows a set of emails that belong to accounts that are not students, every other
+// email is new
+func peopleDB(admins ...string) *testdb.DB {
+	return &testdb.DB{Query: func(query string, args []driver.Value) (*testdb.Rows, error) {
+		email, _ := args[len(args)-1].(string)
+		if strings.Contains(query, "FROM person p") && slices.Contains(admins, email) {
+			return testdb.Row(int64(4), false, false), nil
+		}
+		return testdb.Empty(), nil
+	}}
+}
+
+func TestRunPerRowCommittedOnlyWhenWritten(t *testing.T) {
+	d := peopleDB("ann@example.edu", "bo@example.edu")
+	db := d.Open(t)
+
+	rows := [][]string{
+		{"Email", "First Name"},
+		{"ann@example.edu", "Ann"},
+		{"bo@example.edu", "Bo"},
+	}
+	report, err := Run(context.Background(), db, rows, Options{Mode: ModePerRow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Committed || report.Failed != 2 {
+		t.Fatalf("committed = %v with %d failed rows, want nothing committed", report.Committed, report.Failed)
+	}
+	if d.Commits() != 0 {
+		t.Fatalf("%d row transactions committed", d.Commits())
+	}
+}
+
+func TestRunReportsTakenEmail(t *testing.T) {
+	// The email is free when the row is looked up, another request takes it before the insert
+	d := peopleDB()
+	d.Exec = func(query string, args []driver.Value) (testdb.Result, error) {
+		if strings.Contains(query, "INSERT INTO person") {
+			return testdb.Result{}, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+		}
+		return testdb.Result{InsertID: 9, Affected: 1}, nil
+	}
+	db := d.Open(t)
+
+	rows := [][]string{
+		{"Email", "First Name", "Last Name", "Phone Number", "Sex", "Birthday", "Address", "City", "Country", "Year", "Start Year", "Planned Grad Year"},
+		{"cy@example.edu", "Cy", "Doe", "555-0100", "F", "2004-05-06", "1 Main St", "Springfield", "USA", "Junior", "2023", "2027"},
+	}
+	report, err := Run(context.Background(), db, rows, Options{Mode: ModePerRow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Failed != 1 || !slices.Equal(report.Rows[0].Errors, []string{"email is already used by another person"}) {
+		t.Fatalf("report = %+v, want the row failed with a taken email", report.Rows)
+	}
+}
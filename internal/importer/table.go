@@ -0,0 +1,111 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/xlsx"
+)
+
+// ErrNoEmailColumn is returned when no column maps to the email used to match students
+var ErrNoEmailColumn = errors.New("import: no column maps to email")
+
+// studentFields are the models.Student JSON names a column can map to
+var studentFields = jsonFields(models.Student{})
+
+// ReadTable reads a CSV or XLSX upload into rows of cells, the first row being the header.
+// XLSX files are recognised by their ZIP signature, anything else is parsed as CSV.
+func ReadTable(r io.Reader) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return xlsx.ReadRows(bytes.NewReader(data), int64(len(data)))
+	}
+
+	// Registrar exports often start with a byte order mark
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	return reader.ReadAll()
+}
+
+// ParseMapping reads a column mapping such as "Given Name=first_name,Surname=last_name"
+func ParseMapping(spec string) (map[string]string, error) {
+	mapping := map[string]string{}
+	if strings.TrimSpace(spec) == "" {
+		return mapping, nil
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		column, field, ok := strings.Cut(pair, "=")
+		field = strings.TrimSpace(field)
+		if !ok || strings.TrimSpace(column) == "" || field == "" {
+			return nil, fmt.Errorf("invalid mapping %q, expected column=field", pair)
+		}
+		if !studentFields[field] || field == "student_id" {
+			return nil, fmt.Errorf("unknown student field %q", field)
+		}
+		mapping[normalize(column)] = field
+	}
+	return mapping, nil
+}
+
+// columnFields resolves each header to a student field. Headers that already are field names
+// map to themselves; the explicit mapping takes precedence. Unmapped headers are returned as ignored.
+func columnFields(header []string, mapping map[string]string) ([]string, []string, error) {
+	fields := make([]string, len(header))
+	ignored := []string{}
+	seen := map[string]bool{}
+	hasEmail := false
+
+	for i, column := range header {
+		key := normalize(column)
+		field, ok := mapping[key]
+		if !ok && studentFields[key] && key != "student_id" {
+			field, ok = key, true
+		}
+		if !ok {
+			if key != "" {
+				ignored = append(ignored, column)
+			}
+			continue
+		}
+		if seen[field] {
+			return nil, nil, fmt.Errorf("more than one column maps to %s", field)
+		}
+		seen[field] = true
+		fields[i] = field
+		hasEmail = hasEmail || field == "email"
+	}
+
+	if !hasEmail {
+		return nil, nil, ErrNoEmailColumn
+	}
+	return fields, ignored, nil
+}
+
+// normalize turns headers such as "First Name" or "first-name" into "first_name"
+func normalize(column string) string {
+	column = strings.ToLower(strings.TrimSpace(column))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(column)
+}
+
+func jsonFields(v any) map[string]bool {
+	fields := map[string]bool{}
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
+	}
+	return fields
+}
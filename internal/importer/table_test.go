@@ -0,0 +1,165 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/xlsx"
+)
+
+// registrarWorkbook is laid out the way Excel saves files: shared strings with rich text runs,
+// sparse cells, numbers for years and serial day numbers for dates, and a sheet that is not
+// called sheet1.xml
+func registrarWorkbook(t *testing.T) []byte {
+	t.Helper()
+	parts := map[string]string{
+		"[Content_Types].xml": `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`,
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+			xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+			<sheets><sheet name="Students" sheetId="1" r:id="rId7"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+			<Relationship Id="rId1" Target="worksheets/unused.xml"/>
+			<Relationship Id="rId7" Target="/xl/worksheets/registrar.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+			<si><t>Given Name</t></si><si><t>Surname</t></si><si><t>Email</t></si>
+			<si><r><t>Ann</t></r><r><t>e</t></r></si><si><t>Lee</t></si><si><t>anne@example.edu</t></si></sst>`,
+		"xl/worksheets/registrar.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+			<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c>
+				<c r="D1" t="inlineStr"><is><t>birthday</t></is></c><c r="F1" t="inlineStr"><is><t>start_year</t></is></c></row>
+			<row r="2"><c r="A2" t="s"><v>3</v></c><c r="B2" t="s"><v>4</v></c><c r="C2" t="s"><v>5</v></c>
+				<c r="D2"><v>36527</v></c><c r="F2"><v>2021</v></c></row>
+			<row r="3"></row></sheetData></worksheet>`,
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range parts {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadTableXLSX(t *testing.T) {
+	rows, err := ReadTable(bytes.NewReader(registrarWorkbook(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The rich text runs of the first name are joined
+	want := [][]string{
+		{"Given Name", "Surname", "Email", "birthday", "", "start_year"},
+		{"Anne", "Lee", "anne@example.edu", "36527", "", "2021"},
+		{},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows = %q", rows)
+	}
+
+	mapping, err := ParseMapping("Given Name=first_name, Surname=last_name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, ignored, err := columnFields(rows[0], mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(fields, ","); got != "first_name,last_name,email,birthday,,start_year" || len(ignored) != 0 {
+		t.Fatalf("fields = %s, ignored %q", got, ignored)
+	}
+	if rowValues(fields, rows[2]) != nil {
+		t.Fatal("the empty row was not skipped")
+	}
+
+	var s models.Student
+	err = assign(&s, rowValues(fields, rows[1]))
+	var errs rowErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || !strings.HasPrefix(errs[0], "missing required fields: address, city") {
+		t.Fatalf("assign = %v", err)
+	}
+	if s.FirstName != "Anne" || s.Email != "anne@example.edu" || s.Birthday != "2000-01-02" || s.StartYear != 2021 {
+		t.Fatalf("student = %+v", s)
+	}
+}
+
+func TestReadTableRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := xlsx.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := [][]xlsx.Cell{
+		{{Value: "email"}, {Value: "first_name"}, {Value: "planned_grad_year"}},
+		{{Value: "a&b@example.edu"}, {Value: "<Zoë>"}, {Value: "2027", Number: true}},
+	}
+	for _, row := range written {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := ReadTable(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"email", "first_name", "planned_grad_year"}, {"a&b@example.edu", "<Zoë>", "2027"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows = %q", rows)
+	}
+}
+
+func TestReadTableCSV(t *testing.T) {
+	rows, err := ReadTable(strings.NewReader("\xef\xbb\xbfEmail, First Name\nann@example.edu, \"Ann, Jr\"\nshort\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"Email", "First Name"}, {"ann@example.edu", "Ann, Jr"}, {"short"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows = %q", rows)
+	}
+}
+
+func TestColumnFields(t *testing.T) {
+	if _, _, err := columnFields([]string{"First Name", "Notes"}, nil); !errors.Is(err, ErrNoEmailColumn) {
+		t.Fatalf("without email = %v", err)
+	}
+	if _, _, err := columnFields([]string{"email", "E-mail"}, map[string]string{"e_mail": "email"}); err == nil {
+		t.Fatal("two columns mapping to email were accepted")
+	}
+	fields, ignored, err := columnFields([]string{"Email", "student_id", "Notes", ""}, nil)
+	if err != nil || strings.Join(fields, ",") != "email,,," || !reflect.DeepEqual(ignored, []string{"student_id", "Notes"}) {
+		t.Fatalf("columnFields = %q, %q, %v", fields, ignored, err)
+	}
+
+	for _, spec := range []string{"Given Name", "=first_name", "Id=student_id", "Shoe=shoe_size"} {
+		if _, err := ParseMapping(spec); err == nil {
+			t.Errorf("ParseMapping(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestAssignValidates(t *testing.T) {
+	var s models.Student
+	err := assign(&s, map[string]string{"email": "not-an-address", "birthday": "02/01/2000", "start_year": "soon"})
+	var errs rowErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("assign = %v", err)
+	}
+	for _, want := range []string{"start_year must be a whole number", "birthday must be a date formatted YYYY-MM-DD", "email is not a valid address"} {
+		if !strings.Contains(errs.Error(), want) {
+			t.Errorf("missing %q in %v", want, errs)
+		}
+	}
+}
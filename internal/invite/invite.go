@@ -0,0 +1,108 @@
+package invite
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidToken is returned for unknown, used or expired invite tokens
+var ErrInvalidToken = errors.New("invite: invalid or expired token")
+
+// CreateLogin adds a student login that cannot be used until the invite is accepted
+// and returns the one-time invite token. Only the token's hash is stored.
+func CreateLogin(ctx context.Context, tx *sql.Tx, userID int, ttl time.Duration) (string, error) {
+	// A random password nobody knows keeps the account locked until the invite sets a real one
+	placeholder, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(placeholder), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO users (id, password_hash, role) VALUES (?, ?, ?)`,
+		userID, string(hash), "student",
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return Create(ctx, tx, userID, ttl)
+}
+
+// Create issues a new invite token for an existing login
+func Create(ctx context.Context, tx *sql.Tx, userID int, ttl time.Duration) (string, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO user_invite (token_hash, user_id, created_at, expires_at) VALUES (?, ?, NOW(), ?)`,
+		hashToken(token), userID, time.Now().Add(ttl).UTC(),
+	)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Accept sets the password of the invited user and marks the invite as used
+func Accept(ctx context.Context, db *sql.DB, token, password string) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Locks the invite so it can only be redeemed once
+	var inviteID, userID int
+	err = tx.QueryRowContext(ctx, `
+		SELECT invite_id, user_id
+		FROM user_invite
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > UTC_TIMESTAMP()
+		FOR UPDATE`,
+		hashToken(token),
+	).Scan(&inviteID, &userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidToken
+	} else if err != nil {
+		return 0, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET password_hash = ? WHERE id = ?", string(hash), userID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE user_invite SET used_at = NOW() WHERE invite_id = ?", inviteID); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -68,13 +68,14 @@ type Admin struct {
 type Activity struct {
 	ActivityID       int       `json:"activity_id"`
 	ActivityDateTime time.Time `json:"activity_datetime"`
+	ActivityType     string    `json:"activity_type"`
 }
 
 type Documentation struct {
 	DocumentationID  int       `json:"documentation_id"`
 	ActivityDateTime time.Time `json:"activity_datetime"`
 	FileName         string    `json:"file_name"`
-	FilePath         string    `json:"file_path"`
+	StorageKey       string    `json:"storage_key"`
 	MimeType         string    `json:"mime_type"`
 	SizeBytes        int64     `json:"size_bytes"`
 	UploadedBy       *int      `json:"uploaded_by,omitempty"`
@@ -84,7 +85,7 @@ type PersonalDocumentation struct {
 	PersonalDocumentationID int       `json:"personal_documentation_id"`
 	ActivityDateTime        time.Time `json:"activity_datetime"`
 	FileName                string    `json:"file_name"`
-	FilePath                string    `json:"file_path"`
+	StorageKey              string    `json:"storage_key"`
 	MimeType                string    `json:"mime_type"`
 	SizeBytes               int64     `json:"size_bytes"`
 	UploadedBy              *int      `json:"uploaded_by,omitempty"`
@@ -95,7 +96,7 @@ type SpecificDocumentation struct {
 	SpecificDocumentationID int       `json:"specific_documentation_id"`
 	ActivityDateTime        time.Time `json:"activity_datetime"`
 	FileName                string    `json:"file_name"`
-	FilePath                string    `json:"file_path"`
+	StorageKey              string    `json:"storage_key"`
 	MimeType                string    `json:"mime_type"`
 	SizeBytes               int64     `json:"size_bytes"`
 	UploadedBy              *int      `json:"uploaded_by,omitempty"`
@@ -103,6 +104,21 @@ type SpecificDocumentation struct {
 	StudentID               int       `json:"student_id"`
 }
 
+type DocumentationVersion struct {
+	DocumentationID int        `json:"documentation_id"`
+	VersionNumber   int        `json:"version_number"`
+	Current         bool       `json:"current"`
+	FileName        string     `json:"file_name"`
+	StorageKey      string     `json:"storage_key"`
+	ContentSHA256   *string    `json:"content_sha256,omitempty"`
+	MimeType        string     `json:"mime_type"`
+	SizeBytes       int64      `json:"size_bytes"`
+	UploadedBy      *int       `json:"uploaded_by,omitempty"`
+	ScanStatus      string     `json:"scan_status"`
+	CreatedAt       time.Time  `json:"created_at"`
+	SupersededAt    *time.Time `json:"superseded_at,omitempty"`
+}
+
 type Disability struct {
 	DisabilityID int    `json:"disability_id"`
 	Name         string `json:"name"`
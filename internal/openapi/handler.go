@@ -0,0 +1,40 @@
+package openapi
+
+import (
+	_ "embed"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+// SpecHandler serves the document of the router. It is built on the first request so every
+// route registered after the handler is included.
+func SpecHandler(router *mux.Router) http.HandlerFunc {
+	var (
+		once sync.Once
+		spec map[string]any
+		err  error
+	)
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { spec, err = Build(router) })
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to build API document")
+			log.Println("OpenAPI build error:", err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, spec)
+	}
+}
+
+// DocsHandler serves the interactive documentation page
+func DocsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
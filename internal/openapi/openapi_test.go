@@ -0,0 +1,63 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/openapi"
+)
+
+// Every route must be documented in Operations and every operation must still have a route,
+// the same check as "piconexctl openapi-check"
+func TestEveryRouteIsDocumented(t *testing.T) {
+	problems, err := openapi.Check(internal.NewRouter(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Fatalf("%d problems:\n%s", len(problems), strings.Join(problems, "\n"))
+	}
+}
+
+func TestBuildProducesDocument(t *testing.T) {
+	spec, err := openapi.Build(internal.NewRouter(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		OpenAPI string                               `json:"openapi"`
+		Paths   map[string]map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(encoded, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.0.3" {
+		t.Fatalf("openapi = %q", doc.OpenAPI)
+	}
+	if len(doc.Paths) == 0 {
+		t.Fatal("no paths")
+	}
+
+	// Operation IDs must be unique for generated clients
+	seen := map[string]string{}
+	for path, methods := range doc.Paths {
+		for method, op := range methods {
+			id, _ := op["operationId"].(string)
+			if id == "" {
+				t.Errorf("%s %s has no operationId", method, path)
+				continue
+			}
+			if other, dup := seen[id]; dup {
+				t.Errorf("operationId %s is used by %s and %s %s", id, other, method, path)
+			}
+			seen[id] = method + " " + path
+		}
+	}
+}
@@ -0,0 +1,459 @@
+package openapi
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/activity"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/audit"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/deletion"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/graphql"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/history"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/importer"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/timeline"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/trash"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/webhook"
+)
+
+// Operation documents one method of one route. Paths, path parameters and required roles
+// come from the router itself; everything else is described here.
+type Operation struct {
+	Summary string
+	Query   []Param
+	// Body is a zero value of the JSON request body
+	Body any
+	// Patch marks Body as a JSON Merge Patch document
+	Patch bool
+	// Form lists the multipart/form-data fields of uploads
+	Form []Param
+	// Upload marks document uploads, which are checked against the upload policy and scanned for malware
+	Upload bool
+	// Status is the success status, 200 when zero
+	Status int
+	// Response is a zero value of the JSON response body
+	Response any
+	// File marks responses that are file downloads, held back while quarantined or unscannable
+	File bool
+	// Export marks list endpoints that can also stream CSV, XLSX or NDJSON
+	Export bool
+	// Stream marks Server-Sent Events endpoints, Response then documents the data of each event
+	Stream bool
+	// Versioned marks resources answered with an ETag whose writes honour If-Match
+	Versioned bool
+}
+
+// Param is a query parameter or form field
+type Param struct {
+	Name        string
+	Type        string
+	Description string
+	Required    bool
+}
+
+func query(name, typ, description string) Param {
+	return Param{Name: name, Type: typ, Description: description}
+}
+
+// Shared query parameters
+var (
+	studentFilter = query("student_id", "integer", "Only records of this student")
+	adminFilter   = query("admin_id", "integer", "Only records of this admin")
+	dateFilter    = query("date", "string", "Only this day, formatted YYYY-MM-DD")
+	tzParam       = query("tz", "string", "IANA timezone the date is interpreted in, UTC by default")
+	fromFilter    = query("from", "string", "Only from this day on, formatted YYYY-MM-DD; not combined with date")
+	toFilter      = query("to", "string", "Only up to and including this day, formatted YYYY-MM-DD; not combined with date")
+)
+
+// Response and request bodies that only exist as maps or local types in the handlers
+type (
+	Message struct {
+		Message string `json:"message"`
+	}
+	Error struct {
+		Error string `json:"error"`
+		// Code is only set where a client may want to act on the reason, e.g. file_too_large
+		Code string `json:"code,omitempty"`
+	}
+	Deleted struct {
+		Message      string `json:"message"`
+		RowsAffected int64  `json:"rows_affected"`
+	}
+	StudentCreated struct {
+		Message   string `json:"message"`
+		StudentID int64  `json:"studentId"`
+	}
+	AdminCreated struct {
+		Message string `json:"message"`
+		AdminID int64  `json:"adminId"`
+	}
+	AccommodationCreated struct {
+		Message         string `json:"message"`
+		AccommodationID int64  `json:"accommodation_id"`
+	}
+	DisabilityCreated struct {
+		Message      string `json:"message"`
+		DisabilityID int64  `json:"disability_id"`
+	}
+	PointOfContactCreated struct {
+		Message          string `json:"message"`
+		PointOfContactID int64  `json:"point_of_contact_id"`
+	}
+	DocumentUploaded struct {
+		Message       string `json:"message"`
+		ID            int64  `json:"id"`
+		FileName      string `json:"file_name"`
+		MimeType      string `json:"mime_type"`
+		StorageKey    string `json:"storage_key"`
+		ContentSHA256 string `json:"content_sha256"`
+		Size          int64  `json:"size"`
+		ScanStatus    string `json:"scan_status"`
+	}
+	DocumentVersionUploaded struct {
+		Message       string `json:"message"`
+		ID            int64  `json:"id"`
+		VersionNumber int    `json:"version_number"`
+		FileName      string `json:"file_name"`
+		MimeType      string `json:"mime_type"`
+		StorageKey    string `json:"storage_key"`
+		ContentSHA256 string `json:"content_sha256"`
+		Size          int64  `json:"size"`
+		ScanStatus    string `json:"scan_status"`
+	}
+	CurrentVersionRequest struct {
+		VersionNumber int `json:"version_number"`
+	}
+	CurrentVersionSet struct {
+		Message       string `json:"message"`
+		VersionNumber int    `json:"version_number"`
+	}
+	StudentPurged struct {
+		Message string        `json:"message"`
+		Deleted deletion.Plan `json:"deleted"`
+	}
+	StreamTicket struct {
+		Ticket    string    `json:"ticket"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	LoginRequest struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	LoginResponse struct {
+		Token  string `json:"token"`
+		UserID int    `json:"user_id"`
+	}
+	SignupRequest struct {
+		ID       int    `json:"id"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	StudentSignupRequest struct {
+		models.Student
+		Password string `json:"password"`
+	}
+	AdminCreateRequest struct {
+		models.Admin
+		Password string `json:"password"`
+	}
+	InviteAcceptRequest struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	InviteAccepted struct {
+		Message string `json:"message"`
+		ID      int    `json:"id"`
+	}
+	AccommodationWithBoolean struct {
+		models.Accommodation
+		HasAccommodation bool `json:"hasAccommodation"`
+	}
+	DisabilityWithBoolean struct {
+		models.Disability
+		HasDisability bool `json:"hasDisability"`
+	}
+	SummaryPerson struct {
+		ID            int    `json:"id"`
+		FirstName     string `json:"first_name"`
+		PreferredName string `json:"preferred_name"`
+		LastName      string `json:"last_name"`
+	}
+	ActivityDetails struct {
+		models.Activity
+		// Details is the point of contact or document named by activity_type
+		Details json.RawMessage `json:"details"`
+	}
+	PointOfContactSummary struct {
+		PointOfContactID int             `json:"point_of_contact_id"`
+		ActivityDateTime time.Time       `json:"activity_datetime"`
+		EventDateTime    time.Time       `json:"event_datetime"`
+		Duration         int             `json:"duration"`
+		EventType        string          `json:"event_type"`
+		Student          SummaryPerson   `json:"student"`
+		Admins           []SummaryPerson `json:"admins,omitempty"`
+	}
+	ProfileAppointment struct {
+		PointOfContactID int             `json:"point_of_contact_id"`
+		EventDateTime    time.Time       `json:"event_datetime"`
+		Duration         int             `json:"duration"`
+		EventType        string          `json:"event_type"`
+		Admins           []SummaryPerson `json:"admins"`
+	}
+	StudentProfile struct {
+		Student        *models.Student                `json:"student,omitempty"`
+		Disabilities   []models.Disability            `json:"disabilities,omitempty"`
+		Accommodations []models.Accommodation         `json:"accommodations,omitempty"`
+		Upcoming       []ProfileAppointment           `json:"upcoming,omitempty"`
+		Recent         []ProfileAppointment           `json:"recent,omitempty"`
+		Documents      []models.SpecificDocumentation `json:"documents,omitempty"`
+		PinnedBy       []SummaryPerson                `json:"pinned_by,omitempty"`
+	}
+	GraphQLResponse struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []graphql.Error `json:"errors,omitempty"`
+	}
+	WebhookRequest struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active,omitempty"`
+		Secret string   `json:"secret,omitempty"`
+	}
+	WebhookCreated struct {
+		Message   string `json:"message"`
+		WebhookID int    `json:"webhook_id"`
+		Secret    string `json:"secret"`
+	}
+	AuditVerification struct {
+		Valid          bool  `json:"valid"`
+		FirstBrokenID  int64 `json:"first_broken_id,omitempty"`
+		EntriesChecked int   `json:"entries_checked"`
+	}
+)
+
+// Operations documents every route, keyed by "METHOD /path/template".
+// openapi-check fails when the router and this table disagree.
+var Operations = map[string]Operation{
+	// Person
+	"GET /person":             {Summary: "List people", Response: []models.Person{}, Export: true},
+	"GET /person/{person_id}": {Summary: "Get a person", Response: models.Person{}},
+
+	// Student
+	"GET /student": {Summary: "List students", Response: []models.Student{}, Export: true,
+		Query: []Param{query("name", "string", "Words matched against first, last, preferred and middle names")}},
+	"POST /student": {Summary: "Create a student", Body: models.Student{}, Status: 201, Response: StudentCreated{}},
+	"POST /student/import": {Summary: "Bulk create or update students from a CSV or XLSX file, matched by email", Response: importer.Report{},
+		Form: []Param{
+			{Name: "file", Type: "file", Description: "CSV or XLSX file whose first row is the header", Required: true},
+			query("mapping", "string", `Column mapping such as "Given Name=first_name,Surname=last_name"`),
+			query("dry_run", "boolean", "Validate every row and roll back"),
+			query("mode", "string", "transaction (all or nothing, default) or per-row"),
+			query("create_logins", "boolean", "Create student logins with invite tokens"),
+		}},
+	"GET /student/{student_id}":       {Summary: "Get a student", Response: models.Student{}, Versioned: true},
+	"PUT /student/{student_id}":       {Summary: "Replace a student", Body: models.Student{}, Response: Message{}, Versioned: true},
+	"PATCH /student/{student_id}":     {Summary: "Update some fields of a student", Body: models.Student{}, Patch: true, Response: models.Student{}, Versioned: true},
+	"DELETE /student/{student_id}":    {Summary: "Move a student to the trash", Response: Deleted{}, Versioned: true},
+	"GET /student/{student_id}/purge": {Summary: "Preview everything a permanent deletion would remove", Response: deletion.Plan{}},
+	"DELETE /student/{student_id}/purge": {Summary: "Permanently delete a student and all dependent data", Response: StudentPurged{},
+		Query: []Param{query("dry_run", "boolean", "Only report what would be removed")}},
+	"GET /student/{student_id}/profile": {Summary: "Get a student's case view: profile, disabilities, accommodations, upcoming and recent appointments, documents and the admins who pinned them",
+		Response: StudentProfile{}, Query: []Param{
+			query("include", "string", "Comma-separated sections: student, disabilities, accommodations, upcoming, recent, documents, pinned_by (admins only); every section by default"),
+			query("limit", "integer", "Upcoming and recent appointments to return, 1-100, 10 by default"),
+		}},
+	"GET /student/{student_id}/timeline": {Summary: "List everything that happened to a student, newest first: points of contact, documents, accommodation and disability grants and profile changes",
+		Response: timeline.Page{}, Query: []Param{
+			query("types", "string", "Comma-separated entry types: point_of_contact, specific_documentation, accommodation_granted, disability_recorded, profile_changed; every type by default"),
+			dateFilter, fromFilter, toFilter, tzParam,
+			query("limit", "integer", "Page size, 1-200, 50 by default"),
+			query("cursor", "string", "next_cursor of the previous page"),
+		}},
+	"GET /student/{student_id}/history":                   {Summary: "List the profile versions of a student", Response: []history.Version{}},
+	"POST /student/{student_id}/history/{version}/revert": {Summary: "Restore a student profile to an earlier version", Response: models.Student{}},
+
+	// Admin
+	"GET /admin":                                      {Summary: "List admins", Response: []models.Admin{}, Export: true},
+	"POST /admin":                                     {Summary: "Create an admin with a login", Body: AdminCreateRequest{}, Status: 201, Response: AdminCreated{}},
+	"GET /admin/{admin_id}":                           {Summary: "Get an admin", Response: models.Admin{}, Versioned: true},
+	"PUT /admin/{admin_id}":                           {Summary: "Replace an admin", Body: models.Admin{}, Response: Message{}, Versioned: true},
+	"PATCH /admin/{admin_id}":                         {Summary: "Update some fields of an admin", Body: models.Admin{}, Patch: true, Response: models.Admin{}, Versioned: true},
+	"DELETE /admin/{admin_id}":                        {Summary: "Move an admin to the trash", Response: Deleted{}, Versioned: true},
+	"GET /admin/{admin_id}/history":                   {Summary: "List the profile versions of an admin", Response: []history.Version{}},
+	"POST /admin/{admin_id}/history/{version}/revert": {Summary: "Restore an admin profile to an earlier version", Response: models.Admin{}},
+
+	// Activity
+	"GET /activity": {Summary: "List activities", Response: []models.Activity{}, Export: true},
+	"GET /activity/summary": {Summary: "List activities with their student, admins and details", Response: []activity.Summary{}, Export: true,
+		Query: []Param{dateFilter, fromFilter, toFilter, tzParam, studentFilter, adminFilter}},
+	"GET /activity/{activity_id}": {Summary: "Get an activity with the details of its type; students only read their own", Response: ActivityDetails{}},
+	"GET /activity/stream": {Summary: "Server-Sent Events of points of contact created or updated and documents uploaded or deleted, resumable with Last-Event-ID",
+		Response: webhook.Payload{}, Stream: true,
+		Query: []Param{
+			query("types", "string", "Comma-separated event types, every dashboard event by default"),
+			studentFilter,
+			query("admin_id", "integer", "Only points of contact this admin attends and this admin's personal documents"),
+			query("pinned", "boolean", "Only events about students pinned by the caller"),
+			query("last_event_id", "integer", "Resume after this event when the Last-Event-ID header cannot be set"),
+			query("ticket", "string", "Stream ticket from POST /activity/stream/ticket for EventSource clients, which cannot send an Authorization header"),
+		}},
+	"POST /activity/stream/ticket": {Summary: "Issue a stream ticket valid for 30 seconds, passed as ?ticket= to open the activity stream instead of the login token",
+		Status: 201, Response: StreamTicket{}},
+
+	// Documentation
+	"GET /documentation":                    {Summary: "List documents", Response: []models.Documentation{}, Export: true},
+	"GET /documentation/{documentation_id}": {Summary: "Get a document", Response: models.Documentation{}},
+
+	// Personal documentation
+	"GET /personal-documentation": {Summary: "List personal documents", Response: []models.PersonalDocumentation{}, Export: true,
+		Query: []Param{adminFilter}},
+	"POST /personal-documentation": {Summary: "Upload a personal document", Status: 201, Response: DocumentUploaded{}, Upload: true,
+		Form: []Param{
+			{Name: "admin_id", Type: "integer", Description: "Owning admin", Required: true},
+			{Name: "file", Type: "file", Description: "Document to upload", Required: true},
+		}},
+	"DELETE /personal-documentation/admin/{admin_id}":                  {Summary: "Move every personal document of an admin to the trash", Response: Deleted{}},
+	"GET /personal-documentation/{personal_documentation_id}/download": {Summary: "Download a personal document", File: true},
+	"GET /personal-documentation/{personal_documentation_id}/versions": {Summary: "List the versions of a personal document, newest first", Response: []models.DocumentationVersion{}},
+	"POST /personal-documentation/{personal_documentation_id}/versions": {Summary: "Upload a new version of a personal document and make it current", Status: 201, Response: DocumentVersionUploaded{}, Upload: true,
+		Form: []Param{
+			{Name: "file", Type: "file", Description: "New file, checked against the document's upload policy", Required: true},
+		}},
+	"GET /personal-documentation/{personal_documentation_id}/versions/{version_number}/download": {Summary: "Download one version of a personal document", File: true},
+	"PUT /personal-documentation/{personal_documentation_id}/current-version":                    {Summary: "Make an earlier version of a personal document current", Body: CurrentVersionRequest{}, Response: CurrentVersionSet{}},
+	"GET /personal-documentation/{personal_documentation_id}":                                    {Summary: "Get a personal document", Response: models.PersonalDocumentation{}},
+	"PUT /personal-documentation/{personal_documentation_id}":                                    {Summary: "Replace a personal document's details", Body: models.PersonalDocumentation{}, Response: Message{}},
+	"DELETE /personal-documentation/{personal_documentation_id}":                                 {Summary: "Move a personal document to the trash", Response: Deleted{}},
+
+	// Specific documentation
+	"GET /specific-documentation": {Summary: "List student documents", Response: []models.SpecificDocumentation{}, Export: true,
+		Query: []Param{studentFilter}},
+	"POST /specific-documentation": {Summary: "Upload a student document", Status: 201, Response: DocumentUploaded{}, Upload: true,
+		Form: []Param{
+			{Name: "student_id", Type: "integer", Description: "Student the document belongs to", Required: true},
+			{Name: "doc_type", Type: "string", Description: "Kind of document, selects the allowed file types and size limit", Required: true},
+			{Name: "file", Type: "file", Description: "Document to upload", Required: true},
+		}},
+	"DELETE /specific-documentation/student/{student_id}":              {Summary: "Move every document of a student to the trash", Response: Deleted{}},
+	"GET /specific-documentation/{specific_documentation_id}/download": {Summary: "Download a student document", File: true},
+	"GET /specific-documentation/{specific_documentation_id}/versions": {Summary: "List the versions of a student document, newest first", Response: []models.DocumentationVersion{}},
+	"POST /specific-documentation/{specific_documentation_id}/versions": {Summary: "Upload a new version of a student document and make it current", Status: 201, Response: DocumentVersionUploaded{}, Upload: true, Versioned: true,
+		Form: []Param{
+			{Name: "file", Type: "file", Description: "New file, checked against the document's upload policy", Required: true},
+		}},
+	"GET /specific-documentation/{specific_documentation_id}/versions/{version_number}/download": {Summary: "Download one version of a student document", File: true},
+	"PUT /specific-documentation/{specific_documentation_id}/current-version":                    {Summary: "Make an earlier version of a student document current", Body: CurrentVersionRequest{}, Response: CurrentVersionSet{}, Versioned: true},
+	"GET /specific-documentation/{specific_documentation_id}":                                    {Summary: "Get a student document", Response: models.SpecificDocumentation{}, Versioned: true},
+	"PUT /specific-documentation/{specific_documentation_id}":                                    {Summary: "Replace a student document's details", Body: models.SpecificDocumentation{}, Response: Message{}, Versioned: true},
+	"PATCH /specific-documentation/{specific_documentation_id}":                                  {Summary: "Update some details of a student document", Body: models.SpecificDocumentation{}, Patch: true, Response: models.SpecificDocumentation{}, Versioned: true},
+	"DELETE /specific-documentation/{specific_documentation_id}":                                 {Summary: "Move a student document to the trash", Response: Deleted{}, Versioned: true},
+
+	// Point of contact
+	"GET /point-of-contact":  {Summary: "List points of contact", Response: []models.PointOfContact{}, Export: true},
+	"POST /point-of-contact": {Summary: "Record a point of contact", Body: models.PointOfContact{}, Status: 201, Response: PointOfContactCreated{}},
+	"DELETE /point-of-contact": {Summary: "Delete the points of contact of a student or admin", Response: Deleted{},
+		Query: []Param{studentFilter, adminFilter}},
+	"GET /point-of-contact/summary": {Summary: "List points of contact with their student and admins", Response: []PointOfContactSummary{}, Export: true,
+		Query: []Param{dateFilter, fromFilter, toFilter, tzParam, studentFilter, adminFilter}},
+	"GET /point-of-contact/past": {Summary: "List points of contact that already happened", Response: []models.PointOfContact{}, Export: true,
+		Query: []Param{studentFilter, adminFilter, tzParam}},
+	"GET /point-of-contact/future": {Summary: "List upcoming points of contact", Response: []models.PointOfContact{}, Export: true,
+		Query: []Param{studentFilter, adminFilter, tzParam}},
+	"GET /point-of-contact/{point_of_contact_id}":    {Summary: "Get a point of contact", Response: models.PointOfContact{}, Versioned: true},
+	"PUT /point-of-contact/{point_of_contact_id}":    {Summary: "Replace a point of contact", Body: models.PointOfContact{}, Response: Message{}, Versioned: true},
+	"PATCH /point-of-contact/{point_of_contact_id}":  {Summary: "Update some fields of a point of contact", Body: models.PointOfContact{}, Patch: true, Response: models.PointOfContact{}, Versioned: true},
+	"DELETE /point-of-contact/{point_of_contact_id}": {Summary: "Delete a point of contact", Response: Deleted{}, Versioned: true},
+
+	// Disability
+	"GET /disability":                      {Summary: "List disabilities", Response: []models.Disability{}, Export: true},
+	"POST /disability":                     {Summary: "Create a disability", Body: models.Disability{}, Status: 201, Response: DisabilityCreated{}},
+	"GET /disability/{disability_id}":      {Summary: "Get a disability", Response: models.Disability{}},
+	"PUT /disability/{disability_id}":      {Summary: "Replace a disability", Body: models.Disability{}, Response: Message{}},
+	"DELETE /disability/{disability_id}":   {Summary: "Delete a disability", Response: Message{}},
+	"GET /disability/student/{student_id}": {Summary: "List every disability with whether the student has it", Response: []DisabilityWithBoolean{}, Export: true},
+
+	// Accommodation
+	"GET /accommodation":                       {Summary: "List accommodations", Response: []models.Accommodation{}, Export: true},
+	"POST /accommodation":                      {Summary: "Create an accommodation", Body: models.Accommodation{}, Status: 201, Response: AccommodationCreated{}},
+	"GET /accommodation/{accommodation_id}":    {Summary: "Get an accommodation", Response: models.Accommodation{}},
+	"PUT /accommodation/{accommodation_id}":    {Summary: "Replace an accommodation", Body: models.Accommodation{}, Response: Message{}},
+	"DELETE /accommodation/{accommodation_id}": {Summary: "Delete an accommodation", Response: Message{}},
+	"GET /accommodation/student/{student_id}":  {Summary: "List every accommodation with whether the student has it", Response: []AccommodationWithBoolean{}, Export: true},
+
+	// Relationships
+	"GET /pinned":                         {Summary: "List pinned students of every admin", Response: []models.Pinned{}, Export: true},
+	"POST /pinned":                        {Summary: "Pin a student for an admin", Body: models.Pinned{}, Status: 201, Response: Message{}},
+	"DELETE /pinned":                      {Summary: "Unpin students", Response: Deleted{}, Query: []Param{adminFilter, studentFilter}},
+	"GET /pinned/admin/{admin_id}":        {Summary: "List the students an admin pinned", Response: []models.Student{}, Export: true},
+	"GET /pinned/{admin_id}/{student_id}": {Summary: "Whether an admin pinned a student", Response: true},
+	"GET /stu-accom":                      {Summary: "List student accommodations", Response: []models.StudentAccommodation{}, Export: true},
+	"POST /stu-accom":                     {Summary: "Give a student an accommodation", Body: models.StudentAccommodation{}, Status: 201, Response: Message{}},
+	"DELETE /stu-accom":                   {Summary: "Remove student accommodations", Response: Deleted{}, Query: []Param{studentFilter, query("accommodation_id", "integer", "Only this accommodation")}},
+	"GET /stu-dis":                        {Summary: "List student disabilities", Response: []models.StudentDisability{}, Export: true},
+	"POST /stu-dis":                       {Summary: "Record a student disability", Body: models.StudentDisability{}, Status: 201, Response: Message{}},
+	"DELETE /stu-dis":                     {Summary: "Remove student disabilities", Response: Deleted{}, Query: []Param{studentFilter, query("disability_id", "integer", "Only this disability")}},
+	"GET /poc-admin":                      {Summary: "List the admins of every point of contact", Response: []models.PocAdmin{}, Export: true},
+	"POST /poc-admin":                     {Summary: "Add an admin to a point of contact", Body: models.PocAdmin{}, Status: 201, Response: Message{}},
+	"DELETE /poc-admin":                   {Summary: "Remove admins from points of contact", Response: Deleted{}, Query: []Param{query("point_of_contact_id", "integer", "Only this point of contact"), adminFilter}},
+
+	// Auth
+	"POST /login":          {Summary: "Exchange an email and password for a JWT", Body: LoginRequest{}, Response: LoginResponse{}},
+	"POST /signup":         {Summary: "Create a login for an existing student", Body: SignupRequest{}, Status: 201, Response: StudentCreated{}},
+	"POST /signup/student": {Summary: "Create a student together with their login", Body: StudentSignupRequest{}, Status: 201, Response: StudentCreated{}},
+	"POST /invite/accept":  {Summary: "Set the password of a login created by an import invite", Body: InviteAcceptRequest{}, Response: InviteAccepted{}},
+
+	// Trash
+	"GET /trash": {Summary: "List trashed students, admins and documents", Response: []trash.Item{},
+		Query: []Param{query("type", "string", "student, admin, specific_documentation or personal_documentation")}},
+	"POST /trash/{type}/{id}/restore": {Summary: "Restore a trashed record", Response: Message{}},
+
+	// Audit
+	"GET /audit": {Summary: "Search the audit log", Response: []audit.Entry{},
+		Query: []Param{
+			query("actor_id", "integer", "Only changes by this user"),
+			query("role", "string", "Only changes by this role"),
+			query("action", "string", "create, update, delete, download or export"),
+			query("resource_type", "string", "Only this kind of resource"),
+			query("resource_id", "string", "Only this resource"),
+			query("request_id", "string", "Only entries of this request"),
+			query("from", "string", "Earliest time, RFC 3339"),
+			query("to", "string", "Latest time (exclusive), RFC 3339"),
+			query("limit", "integer", "Page size, at most 1000"),
+			query("offset", "integer", "Entries to skip"),
+		}},
+	"GET /audit/verify": {Summary: "Verify the audit log hash chain, 409 when it was tampered with", Response: AuditVerification{}},
+
+	// GraphQL
+	"GET /graphql": {Summary: "Run a GraphQL query passed as query, operationName and variables parameters", Response: GraphQLResponse{},
+		Query: []Param{
+			{Name: "query", Type: "string", Description: "GraphQL query document", Required: true},
+			query("operationName", "string", "Operation to run when the document has several"),
+			query("variables", "string", "Variables as a JSON object"),
+		}},
+	"POST /graphql": {Summary: "Run a GraphQL query over students, admins, points of contact, documents, disabilities and accommodations",
+		Body: graphql.Request{}, Response: GraphQLResponse{}},
+
+	// Webhooks
+	"GET /webhook": {Summary: "List webhook subscriptions", Response: []webhook.Subscription{}},
+	"POST /webhook": {Summary: "Subscribe a URL to point_of_contact.created, accommodation.granted, document.uploaded, document.quarantined or * events; the signing secret is only returned here",
+		Body: WebhookRequest{}, Status: 201, Response: WebhookCreated{}},
+	"GET /webhook/{webhook_id}":    {Summary: "Get a webhook subscription", Response: webhook.Subscription{}},
+	"PUT /webhook/{webhook_id}":    {Summary: "Change the URL, events or active flag of a webhook subscription", Body: WebhookRequest{}, Response: Message{}},
+	"DELETE /webhook/{webhook_id}": {Summary: "Delete a webhook subscription and its deliveries", Response: Message{}},
+	"GET /webhook/deliveries": {Summary: "List webhook deliveries, status=dead is the dead-letter queue", Response: []webhook.Delivery{},
+		Query: []Param{
+			query("status", "string", "pending, delivered or dead"),
+			query("webhook_id", "integer", "Only deliveries to this subscription"),
+			query("limit", "integer", "Page size, at most 1000"),
+			query("offset", "integer", "Deliveries to skip"),
+		}},
+	"POST /webhook/deliveries/{delivery_id}/retry": {Summary: "Requeue a dead webhook delivery with a fresh attempt budget", Response: Message{}},
+
+	// Batch
+	"POST /batch": {Summary: "Run up to 100 pinned, stu-accom, stu-dis and poc-admin creates and deletes in one transaction; each operation needs the role its route needs and any failure rolls back the whole batch",
+		Body: handlers.BatchRequest{}, Response: handlers.BatchResponse{}},
+
+	// Documentation of the API itself
+	"GET /openapi.json": {Summary: "This OpenAPI document"},
+	"GET /docs":         {Summary: "Interactive API documentation"},
+}
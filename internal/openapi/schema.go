@@ -0,0 +1,108 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemas collects the component schemas of every Go type referenced by the operations
+type schemas map[string]any
+
+// ref returns the schema of a Go value, registering named struct types as components
+func (s schemas) ref(v any) map[string]any {
+	return s.schemaOf(reflect.TypeOf(v))
+}
+
+func (s schemas) schemaOf(t reflect.Type) map[string]any {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t, nullable = t.Elem(), true
+	}
+
+	var schema map[string]any
+	switch {
+	case t == timeType:
+		schema = map[string]any{"type": "string", "format": "date-time"}
+	case t == rawType:
+		schema = map[string]any{"description": "Any JSON value"}
+	case t.Kind() == reflect.Struct:
+		name := componentName(t)
+		if _, ok := s[name]; !ok {
+			// Registers first so self-referencing types terminate
+			s[name] = nil
+			s[name] = s.object(t)
+		}
+		schema = map[string]any{"$ref": "#/components/schemas/" + name}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		schema = map[string]any{"type": "array", "items": s.schemaOf(t.Elem())}
+	case t.Kind() == reflect.Map:
+		schema = map[string]any{"type": "object", "additionalProperties": s.schemaOf(t.Elem())}
+	case t.Kind() == reflect.Bool:
+		schema = map[string]any{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		schema = map[string]any{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema = map[string]any{"type": "number"}
+	case t.Kind() == reflect.String:
+		schema = map[string]any{"type": "string"}
+	default:
+		schema = map[string]any{}
+	}
+
+	if nullable {
+		if _, isRef := schema["$ref"]; isRef {
+			return map[string]any{"allOf": []any{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+	}
+	return schema
+}
+
+// object describes a struct from its JSON tags, flattening embedded structs like encoding/json
+func (s schemas) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	s.fields(t, properties)
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+func (s schemas) fields(t reflect.Type, properties map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			s.fields(f.Type, properties)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = s.schemaOf(f.Type)
+	}
+}
+
+// componentName names models types after the type and other packages' types after package and type,
+// e.g. Student, AuditEntry, ImporterReport
+func componentName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	pkg = pkg[strings.LastIndex(pkg, "/")+1:]
+	if pkg == "models" || pkg == "openapi" || pkg == "" {
+		return t.Name()
+	}
+	r := []rune(pkg)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r) + t.Name()
+}
@@ -0,0 +1,323 @@
+// Package openapi generates the OpenAPI 3 document of the API from the router and the models.
+package openapi
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// Version is the version of the API reported in the document
+const Version = "1.0.0"
+
+var pathParam = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// route is one method of one registered path
+type route struct {
+	method string
+	path   string
+	roles  []string
+	public bool
+}
+
+// routes lists every method of every path registered on the router, OPTIONS excluded
+func routes(router *mux.Router) ([]route, error) {
+	var found []route
+	err := router.Walk(func(r *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := r.GetMethods()
+		if err != nil {
+			// Subrouter prefixes have no methods of their own
+			return nil
+		}
+		path, err := r.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+
+		roleHandler, secured := r.GetHandler().(*utils.RoleHandler)
+		for _, method := range methods {
+			if method == http.MethodOptions {
+				continue
+			}
+			rt := route{method: method, path: path, public: !secured}
+			if secured {
+				rt.roles = roleHandler.MethodRoles[method]
+			}
+			found = append(found, rt)
+		}
+		return nil
+	})
+	return found, err
+}
+
+// Check compares the router with the Operations table and returns one problem per undocumented
+// route and per documented operation that no longer has a route
+func Check(router *mux.Router) ([]string, error) {
+	found, err := routes(router)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	registered := map[string]bool{}
+	for _, rt := range found {
+		key := rt.method + " " + rt.path
+		registered[key] = true
+		if _, ok := Operations[key]; !ok {
+			problems = append(problems, "undocumented route: "+key)
+		}
+		if !rt.public && len(rt.roles) == 0 {
+			problems = append(problems, "route without allowed roles: "+key)
+		}
+	}
+	for key := range Operations {
+		if !registered[key] {
+			problems = append(problems, "documented operation without a route: "+key)
+		}
+	}
+	sort.Strings(problems)
+	return problems, nil
+}
+
+// Build generates the OpenAPI document from the routes registered on the router
+func Build(router *mux.Router) (map[string]any, error) {
+	found, err := routes(router)
+	if err != nil {
+		return nil, err
+	}
+
+	components := schemas{}
+	paths := map[string]map[string]any{}
+	for _, rt := range found {
+		op, ok := Operations[rt.method+" "+rt.path]
+		if !ok {
+			// Undocumented routes still appear so the document never hides an endpoint
+			op = Operation{Summary: "Undocumented"}
+		}
+		if paths[rt.path] == nil {
+			paths[rt.path] = map[string]any{}
+		}
+		paths[rt.path][strings.ToLower(rt.method)] = operation(components, rt, op)
+	}
+
+	// Registers the error body every operation refers to
+	components.ref(Error{})
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Piconex API",
+			"version":     Version,
+			"description": "Student disability services backend. Errors are returned as {\"error\": message}.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": components,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+					"description":  "JWT from /login. The superkey is accepted as a bearer token with the superadmin role.",
+				},
+			},
+		},
+	}, nil
+}
+
+func operation(components schemas, rt route, op Operation) map[string]any {
+	tag := strings.SplitN(strings.TrimPrefix(rt.path, "/"), "/", 2)[0]
+	out := map[string]any{
+		"summary":     op.Summary,
+		"operationId": operationID(rt),
+		"tags":        []string{tag},
+	}
+
+	// Path parameters come from the route template
+	var params []any
+	for _, m := range pathParam.FindAllStringSubmatch(rt.path, -1) {
+		typ := "integer"
+		if m[1] == "type" {
+			typ = "string"
+		}
+		params = append(params, map[string]any{
+			"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": typ},
+		})
+	}
+	for _, q := range op.Query {
+		params = append(params, map[string]any{
+			"name": q.Name, "in": "query", "required": q.Required, "description": q.Description,
+			"schema": map[string]any{"type": q.Type},
+		})
+	}
+	if op.Export {
+		params = append(params, map[string]any{
+			"name": "format", "in": "query",
+			"description": "Streams the list as a file instead of JSON, the Accept header works too",
+			"schema":      map[string]any{"type": "string", "enum": []string{"json", "csv", "xlsx", "ndjson"}},
+		})
+	}
+	if op.Versioned {
+		header := "If-None-Match"
+		if rt.method != http.MethodGet {
+			header = "If-Match"
+		}
+		params = append(params, map[string]any{
+			"name": header, "in": "header", "description": "ETag of the version the client has",
+			"schema": map[string]any{"type": "string"},
+		})
+	}
+	if params != nil {
+		out["parameters"] = params
+	}
+
+	// Request body
+	switch {
+	case op.Body != nil:
+		contentType := "application/json"
+		if op.Patch {
+			contentType = "application/merge-patch+json"
+		}
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{contentType: map[string]any{"schema": components.ref(op.Body)}},
+		}
+	case op.Form != nil:
+		properties := map[string]any{}
+		var required []string
+		for _, f := range op.Form {
+			schema := map[string]any{"type": f.Type, "description": f.Description}
+			if f.Type == "file" {
+				schema = map[string]any{"type": "string", "format": "binary", "description": f.Description}
+			}
+			properties[f.Name] = schema
+			if f.Required {
+				required = append(required, f.Name)
+			}
+		}
+		schema := map[string]any{"type": "object", "properties": properties}
+		if required != nil {
+			schema["required"] = required
+		}
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"multipart/form-data": map[string]any{"schema": schema}},
+		}
+	}
+
+	// Responses
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]any{"description": http.StatusText(status)}
+	content := map[string]any{}
+	switch {
+	case op.Stream:
+		content["text/event-stream"] = map[string]any{
+			"schema": map[string]any{
+				"type":        "string",
+				"description": "Server-Sent Events; each id can be resumed from with Last-Event-ID and each data line is the x-event-data JSON document",
+			},
+			"x-event-data": components.ref(op.Response),
+		}
+	case op.Response != nil:
+		content["application/json"] = map[string]any{"schema": components.ref(op.Response)}
+	}
+	if op.Export {
+		file := map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+		content["text/csv"] = file
+		content["application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"] = file
+		content["application/x-ndjson"] = map[string]any{"schema": map[string]any{"type": "string"}}
+	}
+	if op.File {
+		content["application/octet-stream"] = map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+	}
+	if len(content) > 0 {
+		success["content"] = content
+	}
+
+	errorResponse := func(description string) map[string]any {
+		return map[string]any{
+			"description": description,
+			"content": map[string]any{"application/json": map[string]any{
+				"schema": map[string]any{"$ref": "#/components/schemas/Error"},
+			}},
+		}
+	}
+	responses := map[string]any{
+		strconv.Itoa(status): success,
+		"400":                errorResponse("Invalid request"),
+		"500":                errorResponse("Internal server error"),
+	}
+	if op.Versioned && rt.method != http.MethodGet {
+		responses["412"] = errorResponse("The resource changed since the If-Match ETag")
+	}
+	if op.Upload {
+		responses["413"] = errorResponse("The file is larger than allowed, code file_too_large")
+		responses["415"] = errorResponse("The detected file type is not allowed, code unrecognized_file_type or file_type_not_allowed")
+	}
+	out["responses"] = responses
+
+	// Security and roles come from the role table the route was registered with
+	if rt.public {
+		out["security"] = []any{}
+		out["x-roles"] = []string{}
+		return out
+	}
+	out["security"] = []any{map[string]any{"bearerAuth": []string{}}}
+	out["x-roles"] = rt.roles
+	description := "Requires the " + strings.Join(rt.roles, " or ") + " role."
+	for _, role := range rt.roles {
+		if role == "student" {
+			description += " Students can only access their own records."
+		}
+	}
+	out["description"] = description
+	responses["401"] = errorResponse("Missing or invalid token")
+	responses["403"] = errorResponse("Role not allowed")
+
+	// Authenticated POST requests can be retried safely with an Idempotency-Key
+	if rt.method == http.MethodPost {
+		params, _ := out["parameters"].([]any)
+		out["parameters"] = append(params, map[string]any{
+			"name": "Idempotency-Key", "in": "header",
+			"description": "Replays the first response for retries with the same key within the idempotency window",
+			"schema":      map[string]any{"type": "string", "maxLength": 255},
+		})
+		responses["409"] = errorResponse("A request with this Idempotency-Key is still in progress")
+		responses["422"] = errorResponse("The Idempotency-Key was already used with a different request")
+	}
+
+	// Malware scanning adds its own reasons to some of the statuses above
+	if op.Upload {
+		responses["422"] = errorResponse("The file was found infected and quarantined (code file_infected), or the Idempotency-Key was already used with a different request")
+	}
+	if op.File {
+		responses["403"] = errorResponse("Role not allowed, or the file is quarantined (code file_quarantined)")
+		responses["409"] = errorResponse("The file could not be scanned for malware yet, code scan_failed")
+	}
+	return out
+}
+
+// operationID derives a stable identifier such as getStudentByStudentId
+func operationID(rt route) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(rt.method))
+	for _, segment := range strings.Split(rt.path, "/") {
+		by := ""
+		if m := pathParam.FindStringSubmatch(segment); m != nil {
+			by, segment = "By", m[1]
+		}
+		b.WriteString(by)
+		for _, word := range strings.FieldsFunc(segment, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 
 	"github.com/Peter-Tabarani/PiconexBackend/internal/routes"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 
 	"github.com/gorilla/mux"
 )
@@ -11,6 +12,12 @@ import (
 func NewRouter(db *sql.DB) *mux.Router {
 	router := mux.NewRouter()
 
+	// Tags every request with an ID that shows up in logs and the audit trail
+	router.Use(utils.RequestIDMiddleware)
+
+	// Adds ETags to JSON reads so clients can poll with If-None-Match
+	router.Use(utils.ConditionalGetMiddleware)
+
 	routes.RegisterPersonRoutes(router, db)
 	routes.RegisterStudentRoutes(router, db)
 	routes.RegisterAdminRoutes(router, db)
@@ -23,6 +30,14 @@ func NewRouter(db *sql.DB) *mux.Router {
 	routes.RegisterAccommodationRoutes(router, db)
 	routes.RegisterRelationshipRoutes(router, db)
 	routes.RegisterAuthRoutes(router, db)
+	routes.RegisterTrashRoutes(router, db)
+	routes.RegisterAuditRoutes(router, db)
+	routes.RegisterGraphQLRoutes(router, db)
+	routes.RegisterWebhookRoutes(router, db)
+	routes.RegisterBatchRoutes(router, db)
+
+	// Documents every route registered above
+	routes.RegisterDocsRoutes(router)
 
 	return router
 }
@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/audit"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 
 	"github.com/gorilla/mux"
@@ -12,13 +14,13 @@ import (
 
 func RegisterAccommodationRoutes(router *mux.Router, db *sql.DB) {
 	accommodationRouter := router.PathPrefix("/accommodation").Subrouter()
-	accommodationRouter.Use(utils.WithCORS, utils.AuthMiddleware)
+	accommodationRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
 
 	accommodationRouter.Handle("",
 		utils.RollMiddleware(map[string][]string{
 			"GET":  {"student", "admin"},
 			"POST": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.Middleware(db, "accommodation", "accommodation_id", snapshot(db, handlers.GetAccommodationByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.GetAccommodations(db, w, r)
@@ -27,7 +29,7 @@ func RegisterAccommodationRoutes(router *mux.Router, db *sql.DB) {
 			default:
 				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			}
-		})),
+		}))),
 	).Methods("GET", "POST", "OPTIONS")
 
 	accommodationRouter.Handle("/{accommodation_id}",
@@ -35,7 +37,7 @@ func RegisterAccommodationRoutes(router *mux.Router, db *sql.DB) {
 			"GET":    {"student", "admin"},
 			"PUT":    {"admin"},
 			"DELETE": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.Middleware(db, "accommodation", "accommodation_id", snapshot(db, handlers.GetAccommodationByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.GetAccommodationByID(db, w, r)
@@ -46,7 +48,7 @@ func RegisterAccommodationRoutes(router *mux.Router, db *sql.DB) {
 			default:
 				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			}
-		})),
+		}))),
 	).Methods("GET", "PUT", "DELETE", "OPTIONS")
 
 	accommodationRouter.Handle(
@@ -5,14 +5,32 @@ import (
 	"net/http"
 
 	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 
 	"github.com/gorilla/mux"
 )
 
 func RegisterActivityRoutes(router *mux.Router, db *sql.DB) {
+	// Registered before /activity/{activity_id}, with its own chain so EventSource clients can pass a stream ticket in the URL
+	streamRouter := router.PathPrefix("/activity/stream").Subrouter()
+	streamRouter.Use(utils.WithCORS, utils.QueryTokenMiddleware, utils.AuthMiddleware)
+
+	streamRouter.Handle("",
+		utils.RollMiddleware(map[string][]string{
+			"GET": {"admin"},
+		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				handlers.StreamActivity(db, w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})),
+	).Methods("GET", "OPTIONS")
+
 	activityRouter := router.PathPrefix("/activity").Subrouter()
-	activityRouter.Use(utils.WithCORS, utils.AuthMiddleware)
+	activityRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
 
 	activityRouter.Handle("",
 		utils.RollMiddleware(map[string][]string{
@@ -27,6 +45,19 @@ func RegisterActivityRoutes(router *mux.Router, db *sql.DB) {
 		})),
 	).Methods("GET", "OPTIONS")
 
+	activityRouter.Handle("/stream/ticket",
+		utils.RollMiddleware(map[string][]string{
+			"POST": {"admin"},
+		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost:
+				handlers.CreateStreamTicket(db, w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})),
+	).Methods("POST", "OPTIONS")
+
 	activityRouter.Handle("/summary",
 		utils.RollMiddleware(map[string][]string{
 			"GET": {"admin"},
@@ -42,7 +73,7 @@ func RegisterActivityRoutes(router *mux.Router, db *sql.DB) {
 
 	activityRouter.Handle("/{activity_id}",
 		utils.RollMiddleware(map[string][]string{
-			"GET": {"admin"},
+			"GET": {"student", "admin"},
 		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/audit"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 
 	"github.com/gorilla/mux"
@@ -12,13 +14,13 @@ import (
 
 func RegisterAdminRoutes(router *mux.Router, db *sql.DB) {
 	adminRouter := router.PathPrefix("/admin").Subrouter()
-	adminRouter.Use(utils.WithCORS, utils.AuthMiddleware)
+	adminRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
 
 	adminRouter.Handle("",
 		utils.RollMiddleware(map[string][]string{
 			"GET":  {"admin"},
 			"POST": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.Middleware(db, "admin", "admin_id", snapshot(db, handlers.GetAdminByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.GetAdmins(db, w, r)
@@ -27,25 +29,54 @@ func RegisterAdminRoutes(router *mux.Router, db *sql.DB) {
 			default:
 				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			}
-		})),
+		}))),
 	).Methods("GET", "POST", "OPTIONS")
 
 	adminRouter.Handle("/{admin_id}",
 		utils.RollMiddleware(map[string][]string{
 			"GET":    {"admin"},
 			"PUT":    {"admin"},
+			"PATCH":  {"admin"},
 			"DELETE": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.Middleware(db, "admin", "admin_id", snapshot(db, handlers.GetAdminByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.GetAdminByID(db, w, r)
 			case http.MethodPut:
 				handlers.UpdateAdmin(db, w, r)
+			case http.MethodPatch:
+				handlers.PatchAdmin(db, w, r)
 			case http.MethodDelete:
 				handlers.DeleteAdmin(db, w, r)
 			default:
 				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			}
+		}))),
+	).Methods("GET", "PUT", "PATCH", "DELETE", "OPTIONS")
+
+	adminRouter.Handle("/{admin_id}/history",
+		utils.RollMiddleware(map[string][]string{
+			"GET": {"admin"},
+		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				handlers.GetAdminHistory(db, w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
 		})),
-	).Methods("GET", "PUT", "DELETE", "OPTIONS")
+	).Methods("GET", "OPTIONS")
+
+	adminRouter.Handle("/{admin_id}/history/{version}/revert",
+		utils.RollMiddleware(map[string][]string{
+			"POST": {"admin"},
+		}, audit.Middleware(db, "admin", "admin_id", snapshot(db, handlers.GetAdminByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost:
+				handlers.RevertAdmin(db, w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		}))),
+	).Methods("POST", "OPTIONS")
 }
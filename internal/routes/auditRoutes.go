@@ -0,0 +1,50 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+func RegisterAuditRoutes(router *mux.Router, db *sql.DB) {
+	auditRouter := router.PathPrefix("/audit").Subrouter()
+	auditRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
+
+	auditRouter.Handle("",
+		utils.RollMiddleware(map[string][]string{
+			"GET": {"admin"},
+		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				handlers.GetAuditLog(db, w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})),
+	).Methods("GET", "OPTIONS")
+
+	auditRouter.Handle("/verify",
+		utils.RollMiddleware(map[string][]string{
+			"GET": {"admin"},
+		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				handlers.VerifyAuditLog(db, w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})),
+	).Methods("GET", "OPTIONS")
+}
+
+// snapshot adapts a GET-by-ID handler so the audit middleware can capture a resource's state
+func snapshot(db *sql.DB, get func(*sql.DB, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		get(db, w, r)
+	}
+}
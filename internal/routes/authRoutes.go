@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/audit"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 	"github.com/gorilla/mux"
 )
@@ -13,14 +15,23 @@ func RegisterAuthRoutes(router *mux.Router, db *sql.DB) {
 	publicAuth := router.PathPrefix("/").Subrouter()
 	publicAuth.Use(utils.WithCORS)
 
-	publicAuth.HandleFunc("/signup/student", func(w http.ResponseWriter, r *http.Request) {
+	publicAuth.Handle("/signup/student", audit.Middleware(db, "user", "", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPost:
 			handlers.SignupStudentHandler(db, w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	}).Methods("POST", "OPTIONS")
+	}))).Methods("POST", "OPTIONS")
+
+	publicAuth.Handle("/invite/accept", audit.Middleware(db, "user", "", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			handlers.AcceptInviteHandler(db, w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))).Methods("POST", "OPTIONS")
 
 	publicAuth.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -32,18 +43,18 @@ func RegisterAuthRoutes(router *mux.Router, db *sql.DB) {
 	}).Methods("POST", "OPTIONS")
 
 	protectedAuth := router.PathPrefix("/").Subrouter()
-	protectedAuth.Use(utils.WithCORS, utils.AuthMiddleware)
+	protectedAuth.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
 
 	protectedAuth.Handle("/signup",
 		utils.RollMiddleware(map[string][]string{
 			"POST": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.Middleware(db, "student", "student_id", snapshot(db, handlers.GetStudentByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodPost:
 				handlers.SignupHandler(db, w, r)
 			default:
 				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			}
-		})),
+		}))),
 	).Methods("POST", "OPTIONS")
 }
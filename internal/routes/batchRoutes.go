@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// RegisterBatchRoutes takes the router so each operation is authorized against the route it targets
+func RegisterBatchRoutes(router *mux.Router, db *sql.DB) {
+	batchRouter := router.PathPrefix("/batch").Subrouter()
+	batchRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
+
+	// Each operation is checked against its own route's roles, this only admits callers that could hold any
+	batchRouter.Handle("",
+		utils.RollMiddleware(map[string][]string{
+			"POST": {"student", "admin"},
+		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost:
+				handlers.Batch(db, router, w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})),
+	).Methods("POST", "OPTIONS")
+}
@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// batch posts operations to /batch on a router with the relationship routes, logged in with role
+func batch(t *testing.T, d *testdb.DB, role, operations string) (*httptest.ResponseRecorder, handlers.BatchResponse) {
+	t.Helper()
+	router := mux.NewRouter()
+	db := d.Open(t)
+	RegisterRelationshipRoutes(router, db)
+	RegisterBatchRoutes(router, db)
+
+	token, err := utils.CreateJWT(1, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(`{"operations": `+operations+`}`))
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	var resp handlers.BatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("batch answered %d %s", w.Code, w.Body)
+	}
+	return w, resp
+}
+
+func TestBatchRollsBackOnFailedOperation(t *testing.T) {
+	d := &testdb.DB{}
+	w, resp := batch(t, d, "admin", `[
+		{"method": "POST", "path": "/pinned", "body": {"admin_id": 1, "student_id": 7}},
+		{"method": "POST", "path": "/stu-accom", "body": {"student_id": 7}}
+	]`)
+
+	// The second operation misses accommodation_id, the batch answers with its status
+	if w.Code != http.StatusBadRequest || resp.Committed || resp.FailedIndex == nil || *resp.FailedIndex != 1 {
+		t.Fatalf("batch = %d %+v, want operation 1 failed with 400", w.Code, resp)
+	}
+	if len(resp.Results) != 2 || resp.Results[0].Status != http.StatusCreated || resp.Results[1].Status != http.StatusBadRequest {
+		t.Fatalf("results = %+v, want the created pin and the failure", resp.Results)
+	}
+
+	// The pin was written inside the transaction and rolled back with it, nothing was audited
+	if d.Count("INSERT INTO pinned") != 1 || d.Commits() != 0 || d.Rollbacks() != 1 {
+		t.Fatalf("%d commits and %d rollbacks:\n%s", d.Commits(), d.Rollbacks(), d.Log())
+	}
+	if d.Count("audit") != 0 {
+		t.Fatalf("a failed batch was audited:\n%s", d.Log())
+	}
+}
+
+func TestBatchChecksEachRoute(t *testing.T) {
+	tests := []struct {
+		name, role, operations string
+		status, index          int
+	}{
+		// The role table of POST /pinned only admits admins
+		{"role denied", "student", `[{"method": "POST", "path": "/pinned", "body": {"admin_id": 1, "student_id": 7}}]`, http.StatusForbidden, 0},
+		{"nested batch", "admin", `[{"method": "POST", "path": "/batch"}, {"method": "POST", "path": "/pinned"}]`, http.StatusBadRequest, 0},
+		{"unknown route", "admin", `[{"method": "POST", "path": "/pinned"}, {"method": "POST", "path": "/nowhere"}]`, http.StatusNotFound, 1},
+		{"not batchable", "admin", `[{"method": "GET", "path": "/pinned"}]`, http.StatusBadRequest, 0},
+		{"relative path", "admin", `[{"method": "POST", "path": "pinned"}]`, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		d := &testdb.DB{}
+		w, resp := batch(t, d, tt.role, tt.operations)
+		if w.Code != tt.status || resp.FailedIndex == nil || *resp.FailedIndex != tt.index {
+			t.Errorf("%s: batch = %d %+v, want %d at operation %d", tt.name, w.Code, resp, tt.status, tt.index)
+		}
+
+		// Operations are checked before the transaction starts
+		if len(d.Statements()) != 0 {
+			t.Errorf("%s: a rejected batch ran statements:\n%s", tt.name, d.Log())
+		}
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/audit"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 
 	"github.com/gorilla/mux"
@@ -12,14 +14,14 @@ import (
 
 func RegisterDisabilityRoutes(router *mux.Router, db *sql.DB) {
 	disabilityRouter := router.PathPrefix("/disability").Subrouter()
-	disabilityRouter.Use(utils.WithCORS, utils.AuthMiddleware)
+	disabilityRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
 
 	disabilityRouter.Handle(
 		"",
 		utils.RollMiddleware(map[string][]string{
 			"GET":  {"student", "admin"},
 			"POST": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.Middleware(db, "disability", "disability_id", snapshot(db, handlers.GetDisabilityByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.GetDisabilities(db, w, r)
@@ -28,7 +30,7 @@ func RegisterDisabilityRoutes(router *mux.Router, db *sql.DB) {
 			default:
 				utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
 			}
-		})),
+		}))),
 	).Methods("GET", "POST", "OPTIONS")
 
 	disabilityRouter.Handle(
@@ -37,7 +39,7 @@ func RegisterDisabilityRoutes(router *mux.Router, db *sql.DB) {
 			"GET":    {"student", "admin"},
 			"PUT":    {"admin"},
 			"DELETE": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.Middleware(db, "disability", "disability_id", snapshot(db, handlers.GetDisabilityByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.GetDisabilityByID(db, w, r)
@@ -48,7 +50,7 @@ func RegisterDisabilityRoutes(router *mux.Router, db *sql.DB) {
 			default:
 				utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
 			}
-		})),
+		}))),
 	).Methods("GET", "PUT", "DELETE", "OPTIONS")
 
 	disabilityRouter.Handle(
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/openapi"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// RegisterDocsRoutes serves the OpenAPI document of the router and the docs page reading it.
+// Both are public, the document only describes the API.
+func RegisterDocsRoutes(router *mux.Router) {
+	router.Handle("/openapi.json", utils.WithCORS(openapi.SpecHandler(router))).Methods("GET", "OPTIONS")
+	router.Handle("/docs", utils.WithCORS(http.HandlerFunc(openapi.DocsHandler))).Methods("GET", "OPTIONS")
+}
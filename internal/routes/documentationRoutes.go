@@ -5,13 +5,14 @@ import (
 	"net/http"
 
 	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 	"github.com/gorilla/mux"
 )
 
 func RegisterDocumentationRoutes(router *mux.Router, db *sql.DB) {
 	documentationRouter := router.PathPrefix("/documentation").Subrouter()
-	documentationRouter.Use(utils.WithCORS, utils.AuthMiddleware)
+	documentationRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
 
 	documentationRouter.Handle("",
 		utils.RollMiddleware(map[string][]string{
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+func RegisterGraphQLRoutes(router *mux.Router, db *sql.DB) {
+	graphqlRouter := router.PathPrefix("/graphql").Subrouter()
+	graphqlRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
+
+	// Roles and ownership are checked per type and field by the schema
+	graphqlRouter.Handle("",
+		utils.RollMiddleware(map[string][]string{
+			"GET":  {"student", "admin"},
+			"POST": {"student", "admin"},
+		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodPost:
+				handlers.GraphQL(db, w, r)
+			default:
+				utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			}
+		})),
+	).Methods("GET", "POST", "OPTIONS")
+}
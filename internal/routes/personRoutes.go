@@ -5,13 +5,14 @@ import (
 	"net/http"
 
 	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 	"github.com/gorilla/mux"
 )
 
 func RegisterPersonRoutes(router *mux.Router, db *sql.DB) {
 	personRouter := router.PathPrefix("/person").Subrouter()
-	personRouter.Use(utils.WithCORS, utils.AuthMiddleware)
+	personRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
 
 	personRouter.Handle("",
 		utils.RollMiddleware(map[string][]string{
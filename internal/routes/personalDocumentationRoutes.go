@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/audit"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 
 	"github.com/gorilla/mux"
@@ -12,13 +14,13 @@ import (
 
 func RegisterPersonalDocumentationRoutes(router *mux.Router, db *sql.DB) {
 	pdRouter := router.PathPrefix("/personal-documentation").Subrouter()
-	pdRouter.Use(utils.WithCORS, utils.AuthMiddleware)
+	pdRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
 
 	pdRouter.Handle("",
 		utils.RollMiddleware(map[string][]string{
 			"GET":  {"admin"},
 			"POST": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.Middleware(db, "personal_documentation", "personal_documentation_id", snapshot(db, handlers.GetPersonalDocumentationByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.GetPersonalDocumentations(db, w, r)
@@ -27,41 +29,83 @@ func RegisterPersonalDocumentationRoutes(router *mux.Router, db *sql.DB) {
 			default:
 				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			}
-		})),
+		}))),
 	).Methods("GET", "POST", "OPTIONS")
 
 	pdRouter.Handle("/admin/{admin_id}",
 		utils.RollMiddleware(map[string][]string{
 			"DELETE": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.Middleware(db, "personal_documentation", "", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodDelete:
 				handlers.DeletePersonalDocumentationByAdminID(db, w, r)
 			default:
 				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			}
-		})),
+		}))),
 	).Methods("DELETE", "OPTIONS")
 
 	pdRouter.Handle("/{personal_documentation_id}/download",
 		utils.RollMiddleware(map[string][]string{
 			"GET": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.DownloadMiddleware(db, "personal_documentation", "personal_documentation_id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.DownloadPersonalDocumentation(db, w, r)
 			default:
 				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			}
-		})),
+		}))),
 	).Methods("GET", "OPTIONS")
 
+	pdRouter.Handle("/{personal_documentation_id}/versions",
+		utils.RollMiddleware(map[string][]string{
+			"GET":  {"admin"},
+			"POST": {"admin"},
+		}, audit.Middleware(db, "personal_documentation", "personal_documentation_id", snapshot(db, handlers.GetPersonalDocumentationByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				handlers.GetPersonalDocumentationVersions(db, w, r)
+			case http.MethodPost:
+				handlers.CreatePersonalDocumentationVersion(db, w, r)
+			default:
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			}
+		}))),
+	).Methods("GET", "POST", "OPTIONS")
+
+	pdRouter.Handle("/{personal_documentation_id}/versions/{version_number}/download",
+		utils.RollMiddleware(map[string][]string{
+			"GET": {"admin"},
+		}, audit.DownloadMiddleware(db, "personal_documentation", "personal_documentation_id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				handlers.DownloadPersonalDocumentationVersion(db, w, r)
+			default:
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			}
+		}))),
+	).Methods("GET", "OPTIONS")
+
+	pdRouter.Handle("/{personal_documentation_id}/current-version",
+		utils.RollMiddleware(map[string][]string{
+			"PUT": {"admin"},
+		}, audit.Middleware(db, "personal_documentation", "personal_documentation_id", snapshot(db, handlers.GetPersonalDocumentationByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPut:
+				handlers.SetPersonalDocumentationCurrentVersion(db, w, r)
+			default:
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			}
+		}))),
+	).Methods("PUT", "OPTIONS")
+
 	pdRouter.Handle("/{personal_documentation_id}",
 		utils.RollMiddleware(map[string][]string{
 			"GET":    {"admin"},
 			"PUT":    {"admin"},
 			"DELETE": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.Middleware(db, "personal_documentation", "personal_documentation_id", snapshot(db, handlers.GetPersonalDocumentationByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.GetPersonalDocumentationByID(db, w, r)
@@ -72,6 +116,6 @@ func RegisterPersonalDocumentationRoutes(router *mux.Router, db *sql.DB) {
 			default:
 				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			}
-		})),
+		}))),
 	).Methods("GET", "PUT", "DELETE", "OPTIONS")
 }
@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/audit"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 
 	"github.com/gorilla/mux"
@@ -12,7 +14,7 @@ import (
 
 func RegisterPointOfContactRoutes(router *mux.Router, db *sql.DB) {
 	pocRouter := router.PathPrefix("/point-of-contact").Subrouter()
-	pocRouter.Use(utils.WithCORS, utils.AuthMiddleware)
+	pocRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
 
 	pocRouter.Handle(
 		"",
@@ -20,7 +22,7 @@ func RegisterPointOfContactRoutes(router *mux.Router, db *sql.DB) {
 			"GET":    {"admin"},
 			"POST":   {"student", "admin"},
 			"DELETE": {"admin"},
-		}, utils.ResourceCreateOwnershipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, utils.ResourceCreateOwnershipMiddleware(audit.Middleware(db, "point_of_contact", "point_of_contact_id", snapshot(db, handlers.GetPointOfContactByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.GetPointsOfContact(db, w, r)
@@ -31,7 +33,7 @@ func RegisterPointOfContactRoutes(router *mux.Router, db *sql.DB) {
 			default:
 				utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
 			}
-		}))),
+		})))),
 	).Methods("GET", "POST", "DELETE", "OPTIONS")
 
 	pocRouter.Handle("/summary",
@@ -80,24 +82,27 @@ func RegisterPointOfContactRoutes(router *mux.Router, db *sql.DB) {
 		utils.RollMiddleware(map[string][]string{
 			"GET":    {"student", "admin"},
 			"PUT":    {"student", "admin"},
+			"PATCH":  {"student", "admin"},
 			"DELETE": {"student", "admin"},
 		}, utils.ResourceOwnershipMiddleware(
 			db,
 			"point_of_contact",
 			"point_of_contact_id",
 			"student_id",
-			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			audit.Middleware(db, "point_of_contact", "point_of_contact_id", snapshot(db, handlers.GetPointOfContactByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				switch r.Method {
 				case http.MethodGet:
 					handlers.GetPointOfContactByID(db, w, r)
 				case http.MethodPut:
 					handlers.UpdatePointOfContact(db, w, r)
+				case http.MethodPatch:
+					handlers.PatchPointOfContact(db, w, r)
 				case http.MethodDelete:
 					handlers.DeletePointOfContact(db, w, r)
 				default:
 					utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
 				}
-			}),
+			})),
 		)),
-	).Methods("GET", "PUT", "DELETE", "OPTIONS")
+	).Methods("GET", "PUT", "PATCH", "DELETE", "OPTIONS")
 }
@@ -0,0 +1,95 @@
+package routes
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// profileDB answers the profile of student 7, who was pinned by admin 1
+func profileDB() *testdb.DB {
+	return &testdb.DB{Query: func(query string, args []driver.Value) (*testdb.Rows, error) {
+		switch {
+		case strings.Contains(query, "FROM student s"):
+			if args[0] != int64(7) {
+				return testdb.Empty(), nil
+			}
+			return testdb.Row(int64(7), "Ann", "", "", "Lee", "ann@example.edu", "", "", "", "", "", "", "", "", "", "",
+				"Junior", int64(2023), int64(2027), "", "", int64(1)), nil
+		case strings.Contains(query, "FROM pinned pn"):
+			return testdb.Row(int64(1), "Ada", "", "Admin"), nil
+		}
+		return testdb.Empty(), nil
+	}}
+}
+
+// profile gets path as user 7 logged in with role
+func profile(t *testing.T, d *testdb.DB, role, path string) (*httptest.ResponseRecorder, map[string]json.RawMessage) {
+	t.Helper()
+	router := mux.NewRouter()
+	RegisterStudentRoutes(router, d.Open(t))
+
+	token, err := utils.CreateJWT(7, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	var sections map[string]json.RawMessage
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &sections); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w, sections
+}
+
+func TestStudentProfileOwnership(t *testing.T) {
+	// A student sees their own profile without the admin only sections
+	d := profileDB()
+	w, sections := profile(t, d, "student", "/student/7/profile")
+	if w.Code != http.StatusOK || sections["student"] == nil || sections["upcoming"] == nil {
+		t.Fatalf("own profile = %d %s", w.Code, w.Body)
+	}
+	if sections["pinned_by"] != nil || d.Count("FROM pinned pn") != 0 {
+		t.Fatalf("a student was shown pinned_by: %s", w.Body)
+	}
+
+	// Another student's profile is refused before anything is read
+	d = profileDB()
+	if w, _ := profile(t, d, "student", "/student/8/profile"); w.Code != http.StatusForbidden {
+		t.Fatalf("other profile = %d %s, want 403", w.Code, w.Body)
+	}
+	if len(d.Statements()) != 0 {
+		t.Fatalf("a refused profile ran statements:\n%s", d.Log())
+	}
+
+	// Asking for an admin only section is refused rather than left out
+	d = profileDB()
+	if w, _ := profile(t, d, "student", "/student/7/profile?include=student,pinned_by"); w.Code != http.StatusForbidden {
+		t.Fatalf("pinned_by for a student = %d %s, want 403", w.Code, w.Body)
+	}
+
+	// Admins see every student with every section
+	d = profileDB()
+	w, sections = profile(t, d, "admin", "/student/7/profile")
+	if w.Code != http.StatusOK || !strings.Contains(string(sections["pinned_by"]), `"Ada"`) {
+		t.Fatalf("admin profile = %d %s, want pinned_by", w.Code, w.Body)
+	}
+
+	// A missing student is a 404 whatever was included
+	if w, _ := profile(t, profileDB(), "admin", "/student/9/profile?include=documents"); w.Code != http.StatusNotFound {
+		t.Fatalf("missing profile = %d %s, want 404", w.Code, w.Body)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/audit"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 
 	"github.com/gorilla/mux"
@@ -12,14 +14,14 @@ import (
 
 func RegisterRelationshipRoutes(router *mux.Router, db *sql.DB) {
 	pinnedRouter := router.PathPrefix("/pinned").Subrouter()
-	pinnedRouter.Use(utils.WithCORS, utils.AuthMiddleware)
+	pinnedRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
 
 	pinnedRouter.Handle("",
 		utils.RollMiddleware(map[string][]string{
 			"GET":    {"admin"},
 			"POST":   {"admin"},
 			"DELETE": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.Middleware(db, "pinned", "", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.GetPinned(db, w, r)
@@ -30,7 +32,7 @@ func RegisterRelationshipRoutes(router *mux.Router, db *sql.DB) {
 			default:
 				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			}
-		})),
+		}))),
 	).Methods("GET", "POST", "DELETE", "OPTIONS")
 
 	pinnedRouter.Handle("/admin/{admin_id}",
@@ -62,14 +64,14 @@ func RegisterRelationshipRoutes(router *mux.Router, db *sql.DB) {
 	).Methods("GET", "OPTIONS")
 
 	stuAccomRouter := router.PathPrefix("/stu-accom").Subrouter()
-	stuAccomRouter.Use(utils.WithCORS, utils.AuthMiddleware)
+	stuAccomRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
 
 	stuAccomRouter.Handle("",
 		utils.RollMiddleware(map[string][]string{
 			"GET":    {"admin"},
 			"POST":   {"admin"},
 			"DELETE": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.Middleware(db, "stu_accom", "", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.GetStuAccom(db, w, r)
@@ -80,18 +82,18 @@ func RegisterRelationshipRoutes(router *mux.Router, db *sql.DB) {
 			default:
 				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			}
-		})),
+		}))),
 	).Methods("GET", "POST", "DELETE", "OPTIONS")
 
 	stuDisRouter := router.PathPrefix("/stu-dis").Subrouter()
-	stuDisRouter.Use(utils.WithCORS, utils.AuthMiddleware)
+	stuDisRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
 
 	stuDisRouter.Handle("",
 		utils.RollMiddleware(map[string][]string{
 			"GET":    {"admin"},
 			"POST":   {"admin"},
 			"DELETE": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.Middleware(db, "stu_dis", "", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.GetStuDis(db, w, r)
@@ -102,18 +104,18 @@ func RegisterRelationshipRoutes(router *mux.Router, db *sql.DB) {
 			default:
 				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			}
-		})),
+		}))),
 	).Methods("GET", "POST", "DELETE", "OPTIONS")
 
 	pocAdminRouter := router.PathPrefix("/poc-admin").Subrouter()
-	pocAdminRouter.Use(utils.WithCORS, utils.AuthMiddleware)
+	pocAdminRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
 
 	pocAdminRouter.Handle("",
 		utils.RollMiddleware(map[string][]string{
 			"GET":    {"admin"},
 			"POST":   {"admin"},
 			"DELETE": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.Middleware(db, "poc_admin", "", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.GetPocAdmin(db, w, r)
@@ -124,6 +126,6 @@ func RegisterRelationshipRoutes(router *mux.Router, db *sql.DB) {
 			default:
 				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			}
-		})),
+		}))),
 	).Methods("GET", "POST", "DELETE", "OPTIONS")
 }
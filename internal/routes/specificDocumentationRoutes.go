@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/audit"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 
 	"github.com/gorilla/mux"
@@ -12,14 +14,14 @@ import (
 
 func RegisterSpecificDocumentationRoutes(router *mux.Router, db *sql.DB) {
 	sdRouter := router.PathPrefix("/specific-documentation").Subrouter()
-	sdRouter.Use(utils.WithCORS, utils.AuthMiddleware)
+	sdRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
 
 	sdRouter.Handle(
 		"",
 		utils.RollMiddleware(map[string][]string{
 			"GET":  {"admin"},
 			"POST": {"student", "admin"},
-		}, utils.ResourceCreateOwnershipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, utils.ResourceCreateOwnershipMiddleware(audit.Middleware(db, "specific_documentation", "specific_documentation_id", snapshot(db, handlers.GetSpecificDocumentationByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.GetSpecificDocumentations(db, w, r)
@@ -28,20 +30,20 @@ func RegisterSpecificDocumentationRoutes(router *mux.Router, db *sql.DB) {
 			default:
 				utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
 			}
-		}))),
+		})))),
 	).Methods("GET", "POST", "OPTIONS")
 
 	sdRouter.Handle("/student/{student_id}",
 		utils.RollMiddleware(map[string][]string{
 			"DELETE": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.Middleware(db, "specific_documentation", "", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodDelete:
 				handlers.DeleteSpecificDocumentationByStudentID(db, w, r)
 			default:
 				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			}
-		})),
+		}))),
 	).Methods("DELETE", "OPTIONS")
 
 	sdRouter.Handle(
@@ -53,40 +55,106 @@ func RegisterSpecificDocumentationRoutes(router *mux.Router, db *sql.DB) {
 			"specific_documentation",
 			"specific_documentation_id",
 			"student_id",
-			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			audit.DownloadMiddleware(db, "specific_documentation", "specific_documentation_id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				switch r.Method {
 				case http.MethodGet:
 					handlers.DownloadSpecificDocumentation(db, w, r)
 				default:
 					utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
 				}
-			}),
+			})),
+		)),
+	).Methods("GET", "OPTIONS")
+
+	sdRouter.Handle(
+		"/{specific_documentation_id}/versions",
+		utils.RollMiddleware(map[string][]string{
+			"GET":  {"student", "admin"},
+			"POST": {"student", "admin"},
+		}, utils.ResourceOwnershipMiddleware(
+			db,
+			"specific_documentation",
+			"specific_documentation_id",
+			"student_id",
+			audit.Middleware(db, "specific_documentation", "specific_documentation_id", snapshot(db, handlers.GetSpecificDocumentationByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					handlers.GetSpecificDocumentationVersions(db, w, r)
+				case http.MethodPost:
+					handlers.CreateSpecificDocumentationVersion(db, w, r)
+				default:
+					utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
+				}
+			})),
+		)),
+	).Methods("GET", "POST", "OPTIONS")
+
+	sdRouter.Handle(
+		"/{specific_documentation_id}/versions/{version_number}/download",
+		utils.RollMiddleware(map[string][]string{
+			"GET": {"student", "admin"},
+		}, utils.ResourceOwnershipMiddleware(
+			db,
+			"specific_documentation",
+			"specific_documentation_id",
+			"student_id",
+			audit.DownloadMiddleware(db, "specific_documentation", "specific_documentation_id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					handlers.DownloadSpecificDocumentationVersion(db, w, r)
+				default:
+					utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
+				}
+			})),
 		)),
 	).Methods("GET", "OPTIONS")
 
+	sdRouter.Handle(
+		"/{specific_documentation_id}/current-version",
+		utils.RollMiddleware(map[string][]string{
+			"PUT": {"student", "admin"},
+		}, utils.ResourceOwnershipMiddleware(
+			db,
+			"specific_documentation",
+			"specific_documentation_id",
+			"student_id",
+			audit.Middleware(db, "specific_documentation", "specific_documentation_id", snapshot(db, handlers.GetSpecificDocumentationByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodPut:
+					handlers.SetSpecificDocumentationCurrentVersion(db, w, r)
+				default:
+					utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
+				}
+			})),
+		)),
+	).Methods("PUT", "OPTIONS")
+
 	sdRouter.Handle(
 		"/{specific_documentation_id}",
 		utils.RollMiddleware(map[string][]string{
 			"GET":    {"student", "admin"},
 			"PUT":    {"student", "admin"},
+			"PATCH":  {"student", "admin"},
 			"DELETE": {"student", "admin"},
 		}, utils.ResourceOwnershipMiddleware(
 			db,
 			"specific_documentation",
 			"specific_documentation_id",
 			"student_id",
-			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			audit.Middleware(db, "specific_documentation", "specific_documentation_id", snapshot(db, handlers.GetSpecificDocumentationByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				switch r.Method {
 				case http.MethodGet:
 					handlers.GetSpecificDocumentationByID(db, w, r)
 				case http.MethodPut:
 					handlers.UpdateSpecificDocumentation(db, w, r)
+				case http.MethodPatch:
+					handlers.PatchSpecificDocumentation(db, w, r)
 				case http.MethodDelete:
 					handlers.DeleteSpecificDocumentation(db, w, r)
 				default:
 					utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
 				}
-			}),
+			})),
 		)),
-	).Methods("GET", "PUT", "DELETE", "OPTIONS")
+	).Methods("GET", "PUT", "PATCH", "DELETE", "OPTIONS")
 }
@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/Peter-Tabarani/PiconexBackend/internal/audit"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
 
 	"github.com/gorilla/mux"
@@ -12,13 +14,13 @@ import (
 
 func RegisterStudentRoutes(router *mux.Router, db *sql.DB) {
 	studentRouter := router.PathPrefix("/student").Subrouter()
-	studentRouter.Use(utils.WithCORS, utils.AuthMiddleware)
+	studentRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
 
 	studentRouter.Handle("",
 		utils.RollMiddleware(map[string][]string{
 			"GET":  {"admin"},
 			"POST": {"admin"},
-		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, audit.Middleware(db, "student", "student_id", snapshot(db, handlers.GetStudentByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.GetStudents(db, w, r)
@@ -27,25 +29,112 @@ func RegisterStudentRoutes(router *mux.Router, db *sql.DB) {
 			default:
 				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			}
-		})),
+		}))),
 	).Methods("GET", "POST", "OPTIONS")
 
+	// Registered before "/{student_id}" so "import" is not taken for an ID
+	studentRouter.Handle(
+		"/import",
+		utils.RollMiddleware(map[string][]string{
+			"POST": {"admin"},
+		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost:
+				handlers.ImportStudents(db, w, r)
+			default:
+				utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			}
+		})),
+	).Methods("POST", "OPTIONS")
+
 	studentRouter.Handle(
 		"/{student_id}",
 		utils.RollMiddleware(map[string][]string{
 			"GET":    {"student", "admin"},
 			"PUT":    {"student", "admin"},
+			"PATCH":  {"student", "admin"},
 			"DELETE": {"admin"},
-		}, utils.OwnershipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}, utils.OwnershipMiddleware(audit.Middleware(db, "student", "student_id", snapshot(db, handlers.GetStudentByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodGet:
 				handlers.GetStudentByID(db, w, r)
 			case http.MethodPut:
 				handlers.UpdateStudent(db, w, r)
+			case http.MethodPatch:
+				handlers.PatchStudent(db, w, r)
 			case http.MethodDelete:
 				handlers.DeleteStudent(db, w, r)
 			default:
 				utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
 			}
-		})))).Methods("GET", "PUT", "DELETE", "OPTIONS")
+		}))))).Methods("GET", "PUT", "PATCH", "DELETE", "OPTIONS")
+
+	studentRouter.Handle(
+		"/{student_id}/purge",
+		utils.RollMiddleware(map[string][]string{
+			"GET":    {"admin"},
+			"DELETE": {"admin"},
+		}, audit.Middleware(db, "student", "student_id", snapshot(db, handlers.GetStudentByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				handlers.PreviewStudentPurge(db, w, r)
+			case http.MethodDelete:
+				handlers.PurgeStudent(db, w, r)
+			default:
+				utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			}
+		})))).Methods("GET", "DELETE", "OPTIONS")
+
+	studentRouter.Handle(
+		"/{student_id}/profile",
+		utils.RollMiddleware(map[string][]string{
+			"GET": {"student", "admin"},
+		}, utils.OwnershipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				handlers.GetStudentProfile(db, w, r)
+			default:
+				utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			}
+		})))).Methods("GET", "OPTIONS")
+
+	studentRouter.Handle(
+		"/{student_id}/timeline",
+		utils.RollMiddleware(map[string][]string{
+			"GET": {"admin"},
+		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				handlers.GetStudentTimeline(db, w, r)
+			default:
+				utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			}
+		})),
+	).Methods("GET", "OPTIONS")
+
+	studentRouter.Handle(
+		"/{student_id}/history",
+		utils.RollMiddleware(map[string][]string{
+			"GET": {"student", "admin"},
+		}, utils.OwnershipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				handlers.GetStudentHistory(db, w, r)
+			default:
+				utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			}
+		})))).Methods("GET", "OPTIONS")
+
+	studentRouter.Handle(
+		"/{student_id}/history/{version}/revert",
+		utils.RollMiddleware(map[string][]string{
+			"POST": {"student", "admin"},
+		}, utils.OwnershipMiddleware(audit.Middleware(db, "student", "student_id", snapshot(db, handlers.GetStudentByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost:
+				handlers.RevertStudent(db, w, r)
+			default:
+				utils.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			}
+		}))))).Methods("POST", "OPTIONS")
 }
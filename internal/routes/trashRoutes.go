@@ -0,0 +1,44 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/audit"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+func RegisterTrashRoutes(router *mux.Router, db *sql.DB) {
+	trashRouter := router.PathPrefix("/trash").Subrouter()
+	trashRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
+
+	trashRouter.Handle("",
+		utils.RollMiddleware(map[string][]string{
+			"GET": {"admin"},
+		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				handlers.GetTrash(db, w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})),
+	).Methods("GET", "OPTIONS")
+
+	trashRouter.Handle("/{type}/{id}/restore",
+		utils.RollMiddleware(map[string][]string{
+			"POST": {"admin"},
+		}, audit.Middleware(db, "trash", "", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost:
+				handlers.RestoreTrash(db, w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		}))),
+	).Methods("POST", "OPTIONS")
+}
@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/audit"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/handlers"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+func RegisterWebhookRoutes(router *mux.Router, db *sql.DB) {
+	webhookRouter := router.PathPrefix("/webhook").Subrouter()
+	webhookRouter.Use(utils.WithCORS, utils.AuthMiddleware, idempotency.Middleware(db))
+
+	webhookRouter.Handle("",
+		utils.RollMiddleware(map[string][]string{
+			"GET":  {"admin"},
+			"POST": {"admin"},
+		}, audit.Middleware(db, "webhook", "webhook_id", snapshot(db, handlers.GetWebhookByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				handlers.GetWebhooks(db, w, r)
+			case http.MethodPost:
+				handlers.CreateWebhook(db, w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		}))),
+	).Methods("GET", "POST", "OPTIONS")
+
+	// Registered before /{webhook_id} so "deliveries" is not taken for an ID
+	webhookRouter.Handle("/deliveries",
+		utils.RollMiddleware(map[string][]string{
+			"GET": {"admin"},
+		}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				handlers.GetWebhookDeliveries(db, w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		})),
+	).Methods("GET", "OPTIONS")
+
+	webhookRouter.Handle("/deliveries/{delivery_id}/retry",
+		utils.RollMiddleware(map[string][]string{
+			"POST": {"admin"},
+		}, audit.Middleware(db, "webhook_delivery", "delivery_id", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost:
+				handlers.RetryWebhookDelivery(db, w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		}))),
+	).Methods("POST", "OPTIONS")
+
+	webhookRouter.Handle("/{webhook_id}",
+		utils.RollMiddleware(map[string][]string{
+			"GET":    {"admin"},
+			"PUT":    {"admin"},
+			"DELETE": {"admin"},
+		}, audit.Middleware(db, "webhook", "webhook_id", snapshot(db, handlers.GetWebhookByID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				handlers.GetWebhookByID(db, w, r)
+			case http.MethodPut:
+				handlers.UpdateWebhook(db, w, r)
+			case http.MethodDelete:
+				handlers.DeleteWebhook(db, w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		}))),
+	).Methods("GET", "PUT", "DELETE", "OPTIONS")
+}
@@ -0,0 +1,163 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdChunk is how much content is sent per INSTREAM chunk
+const clamdChunk = 64 << 10
+
+// Clamd scans through a clamd daemon with the INSTREAM command, the content is streamed over the
+// socket so clamd does not need access to the document store. clamd's StreamMaxLength must be at
+// least the upload size limit or large files come back as scan errors.
+type Clamd struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamd returns a client of the clamd listening on addr, "tcp://host:port", "unix:///path" or
+// "host:port". Nothing is dialled until the first scan.
+func NewClamd(addr string, timeout time.Duration) (*Clamd, error) {
+	c := &Clamd{network: "tcp", address: addr, timeout: timeout}
+	switch {
+	case strings.HasPrefix(addr, "tcp://"):
+		c.address = strings.TrimPrefix(addr, "tcp://")
+	case strings.HasPrefix(addr, "unix://"):
+		c.network, c.address = "unix", strings.TrimPrefix(addr, "unix://")
+	case strings.HasPrefix(addr, "/"):
+		c.network = "unix"
+	}
+	if c.address == "" {
+		return nil, errors.New("scanner: CLAMD_ADDRESS is empty")
+	}
+	return c, nil
+}
+
+func (c *Clamd) Name() string {
+	return "clamd"
+}
+
+// dial connects and bounds the whole exchange by the timeout and ctx
+func (c *Clamd) dial(ctx context.Context) (net.Conn, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, fmt.Errorf("scanner: clamd: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+// Ping checks that clamd answers
+func (c *Clamd) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return fmt.Errorf("scanner: clamd: %w", err)
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("scanner: clamd: unexpected reply %q", reply)
+	}
+	return nil
+}
+
+// Scan streams r to clamd in length-prefixed chunks and parses the verdict
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+
+	// Closing the connection interrupts a scan whose context is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	w := bufio.NewWriterSize(conn, clamdChunk+4)
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return Result{}, fmt.Errorf("scanner: clamd: %w", err)
+	}
+	buf := make([]byte, clamdChunk)
+	var size [4]byte
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			w.Write(size[:])
+			if _, err := w.Write(buf[:n]); err != nil {
+				// clamd hangs up once StreamMaxLength is exceeded, its reply says why
+				if reply, replyErr := readReply(conn); replyErr == nil {
+					return parseReply(reply)
+				}
+				return Result{}, fmt.Errorf("scanner: clamd: %w", err)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return Result{}, readErr
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	w.Write(size[:])
+	if err := w.Flush(); err != nil {
+		return Result{}, fmt.Errorf("scanner: clamd: %w", err)
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		if ctx.Err() != nil {
+			return Result{}, ctx.Err()
+		}
+		return Result{}, err
+	}
+	return parseReply(reply)
+}
+
+// readReply reads one NUL-terminated reply
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && !(err == io.EOF && len(reply) > 0) {
+		return "", fmt.Errorf("scanner: clamd: %w", err)
+	}
+	return string(bytes.TrimRight(reply, "\x00\n")), nil
+}
+
+// parseReply reads "stream: OK", "stream: <signature> FOUND" or "<message> ERROR"
+func parseReply(reply string) (Result, error) {
+	verdict := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case verdict == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	case strings.HasSuffix(verdict, " ERROR"):
+		return Result{}, fmt.Errorf("scanner: clamd: %s", strings.TrimSuffix(verdict, " ERROR"))
+	}
+	return Result{}, fmt.Errorf("scanner: clamd: unexpected reply %q", reply)
+}
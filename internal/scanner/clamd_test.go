@@ -0,0 +1,207 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd speaks the clamd INSTREAM and PING commands on a local socket. It reports content
+// containing the EICAR string as infected and hangs up once more than limit bytes were streamed.
+type fakeClamd struct {
+	limit    int
+	silent   bool
+	received chan []byte
+}
+
+func startClamd(t *testing.T, f *fakeClamd) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	f.received = make(chan []byte, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return "tcp://" + l.Addr().String()
+}
+
+func (f *fakeClamd) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	switch command {
+	case "zPING\x00":
+		conn.Write([]byte("PONG\x00"))
+		return
+	case "zINSTREAM\x00":
+	default:
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+
+	var content []byte
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if n == 0 {
+			break
+		}
+		if n > clamdChunk {
+			conn.Write([]byte("INSTREAM chunk too large ERROR\x00"))
+			return
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return
+		}
+		content = append(content, chunk...)
+		if f.limit > 0 && len(content) > f.limit {
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			return
+		}
+	}
+	f.received <- content
+	if f.silent {
+		io.Copy(io.Discard, conn)
+		return
+	}
+	if bytes.Contains(content, eicarSignature) {
+		conn.Write([]byte("stream: Eicar-Signature FOUND\x00"))
+		return
+	}
+	conn.Write([]byte("stream: OK\x00"))
+}
+
+func TestClamdScan(t *testing.T) {
+	f := &fakeClamd{}
+	c, err := NewClamd(startClamd(t, f), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping = %v", err)
+	}
+
+	// Larger than one chunk, so the framing is exercised
+	clean := bytes.Repeat([]byte("harmless "), clamdChunk/4)
+	result, err := c.Scan(ctx, bytes.NewReader(clean))
+	if err != nil || result.Infected {
+		t.Fatalf("clean file = %+v, %v", result, err)
+	}
+	if got := <-f.received; !bytes.Equal(got, clean) {
+		t.Fatalf("clamd received %d bytes of %d", len(got), len(clean))
+	}
+
+	infected := append(bytes.Repeat([]byte("x"), clamdChunk-10), eicarSignature...)
+	result, err = c.Scan(ctx, bytes.NewReader(infected))
+	if err != nil || !result.Infected || result.Signature != "Eicar-Signature" {
+		t.Fatalf("infected file = %+v, %v", result, err)
+	}
+	<-f.received
+
+	result, err = c.Scan(ctx, bytes.NewReader(nil))
+	if err != nil || result.Infected {
+		t.Fatalf("empty file = %+v, %v", result, err)
+	}
+}
+
+func TestClamdErrors(t *testing.T) {
+	f := &fakeClamd{limit: 1000}
+	c, _ := NewClamd(startClamd(t, f), 5*time.Second)
+	_, err := c.Scan(context.Background(), bytes.NewReader(make([]byte, 3*clamdChunk)))
+	if err == nil || !strings.Contains(err.Error(), "size limit exceeded") {
+		t.Fatalf("oversized stream = %v", err)
+	}
+
+	// A scan that gets no verdict ends with its context
+	silent := &fakeClamd{silent: true}
+	c, _ = NewClamd(startClamd(t, silent), 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if _, err := c.Scan(ctx, strings.NewReader("waiting")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("scan without a reply = %v, want the context error", err)
+	}
+
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+	c, _ = NewClamd(addr, time.Second)
+	if err := c.Ping(context.Background()); err == nil {
+		t.Fatal("Ping of a closed port succeeded")
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  Result
+		err   string
+	}{
+		{"stream: OK", Result{}, ""},
+		{"stream: Win.Test.EICAR_HDB-1 FOUND", Result{Infected: true, Signature: "Win.Test.EICAR_HDB-1"}, ""},
+		{"INSTREAM size limit exceeded. ERROR", Result{}, "INSTREAM size limit exceeded."},
+		{"something else", Result{}, "unexpected reply"},
+	}
+	for _, tt := range tests {
+		got, err := parseReply(tt.reply)
+		if got != tt.want || (tt.err == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("parseReply(%q) = %+v, %v", tt.reply, got, err)
+		}
+	}
+}
+
+func TestNewClamd(t *testing.T) {
+	tests := map[string][2]string{
+		"tcp://127.0.0.1:3310":             {"tcp", "127.0.0.1:3310"},
+		"clamav:3310":                      {"tcp", "clamav:3310"},
+		"unix:///var/run/clamav/clamd.ctl": {"unix", "/var/run/clamav/clamd.ctl"},
+		"/var/run/clamav/clamd.ctl":        {"unix", "/var/run/clamav/clamd.ctl"},
+	}
+	for addr, want := range tests {
+		c, err := NewClamd(addr, 0)
+		if err != nil || c.network != want[0] || c.address != want[1] {
+			t.Errorf("NewClamd(%q) = %+v, %v", addr, c, err)
+		}
+	}
+	if _, err := NewClamd("tcp://", 0); err == nil {
+		t.Error("NewClamd accepted an empty address")
+	}
+}
+
+func TestEICAR(t *testing.T) {
+	// The signature split across two reads is still found
+	content := append(bytes.Repeat([]byte("a"), 32<<10-20), eicarSignature...)
+	result, err := EICAR{}.Scan(context.Background(), io.MultiReader(bytes.NewReader(content[:32<<10]), bytes.NewReader(content[32<<10:])))
+	if err != nil || !result.Infected {
+		t.Fatalf("EICAR = %+v, %v", result, err)
+	}
+	result, err = EICAR{}.Scan(context.Background(), strings.NewReader("clean"))
+	if err != nil || result.Infected {
+		t.Fatalf("clean = %+v, %v", result, err)
+	}
+}
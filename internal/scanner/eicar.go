@@ -0,0 +1,47 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// eicarSignature is the part of the EICAR anti-virus test file that scanners look for
+var eicarSignature = []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`)
+
+// EICAR reports files that contain the EICAR test string as infected and everything else as
+// clean, for development and for checking the quarantine path end to end
+type EICAR struct{}
+
+func (EICAR) Name() string {
+	return "eicar"
+}
+
+// Scan looks for the test string anywhere in the content, also across read boundaries
+func (EICAR) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	buf := make([]byte, 32<<10)
+	keep := len(eicarSignature) - 1
+	var tail []byte
+	for {
+		if err := ctx.Err(); err != nil {
+			return Result{}, err
+		}
+		n, err := r.Read(buf)
+		if n > 0 {
+			window := append(tail, buf[:n]...)
+			if bytes.Contains(window, eicarSignature) {
+				return Result{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+			}
+			if len(window) > keep {
+				window = window[len(window)-keep:]
+			}
+			tail = append(tail[:0], window...)
+		}
+		if err == io.EOF {
+			return Result{}, nil
+		}
+		if err != nil {
+			return Result{}, err
+		}
+	}
+}
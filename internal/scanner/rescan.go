@@ -0,0 +1,145 @@
+package scanner
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/docstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/filecrypt"
+)
+
+// RescanReport is the result of scanning stored documents again
+type RescanReport struct {
+	Scanner  string    `json:"scanner"`
+	Blobs    int       `json:"blobs"`
+	Clean    int       `json:"clean"`
+	Infected []Finding `json:"infected"`
+	// Failed lists blobs that could not be scanned, their rows keep their status
+	Failed []Finding `json:"failed"`
+}
+
+// Finding is a blob that was quarantined or could not be scanned
+type Finding struct {
+	StorageKey       string `json:"storage_key"`
+	DocumentationIDs []int  `json:"documentation_ids"`
+	Signature        string `json:"signature,omitempty"`
+	Error            string `json:"error,omitempty"`
+}
+
+// OK reports whether every blob was scanned and found clean
+func (r RescanReport) OK() bool {
+	return len(r.Infected) == 0 && len(r.Failed) == 0
+}
+
+// target is a stored blob and the rows that reference it
+type target struct {
+	key    string
+	digest string
+	ids    []int
+}
+
+// Rescan scans the documents and versions whose scan_status is unscanned or error, or every one
+// that is not quarantined when all is set, trashed ones included. Clean blobs are marked clean and
+// infected ones are quarantined with all of their rows.
+func Rescan(ctx context.Context, db *sql.DB, store blobstore.BlobStore, s Scanner, all bool) (RescanReport, error) {
+	report := RescanReport{Scanner: s.Name(), Infected: []Finding{}, Failed: []Finding{}}
+
+	// Previous versions are scanned too, they can be made current again
+	where := "storage_key NOT LIKE 'quarantine/%'"
+	if !all {
+		where += " AND scan_status IN ('unscanned', 'error')"
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT documentation_id, storage_key, content_sha256 FROM documentation WHERE `+where+`
+		UNION
+		SELECT documentation_id, storage_key, content_sha256 FROM documentation_version WHERE `+where+`
+		ORDER BY documentation_id`)
+	if err != nil {
+		return report, err
+	}
+	targets := map[string]*target{}
+	for rows.Next() {
+		var id int
+		var key string
+		var digest sql.NullString
+		if err := rows.Scan(&id, &key, &digest); err != nil {
+			rows.Close()
+			return report, err
+		}
+		t, ok := targets[key]
+		if !ok {
+			t = &target{key: key, digest: digest.String}
+			targets[key] = t
+		}
+		if n := len(t.ids); n == 0 || t.ids[n-1] != id {
+			t.ids = append(t.ids, id)
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return report, err
+	}
+
+	keys := make([]string, 0, len(targets))
+	for key := range targets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		t := targets[key]
+		report.Blobs++
+		finding := Finding{StorageKey: t.key, DocumentationIDs: t.ids}
+
+		result, err := scanBlob(ctx, store, s, t.key)
+		if err != nil {
+			finding.Error = err.Error()
+			report.Failed = append(report.Failed, finding)
+			continue
+		}
+
+		if result.Infected {
+			if err := docstore.Quarantine(ctx, db, store, t.key, t.digest, result.Signature); err != nil {
+				return report, err
+			}
+			finding.Signature = result.Signature
+			report.Infected = append(report.Infected, finding)
+			continue
+		}
+
+		for _, table := range []string{"documentation", "documentation_version"} {
+			if _, err := db.ExecContext(ctx,
+				`UPDATE `+table+` SET scan_status = ?, scan_signature = NULL, scanned_at = NOW()
+				 WHERE storage_key = ? AND scan_status <> ?`,
+				StatusClean, t.key, StatusInfected,
+			); err != nil {
+				return report, err
+			}
+		}
+		report.Clean++
+	}
+	return report, nil
+}
+
+// scanBlob scans the decrypted content of one blob
+func scanBlob(ctx context.Context, store blobstore.BlobStore, s Scanner, key string) (Result, error) {
+	obj, err := store.Get(ctx, key)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		return Result{}, errors.New("blob is missing from the document store")
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	defer obj.Close()
+	content, _, err := filecrypt.Open(obj, obj.Info().Size)
+	if err != nil {
+		return Result{}, err
+	}
+	return s.Scan(ctx, content)
+}
@@ -0,0 +1,108 @@
+// Package scanner checks uploaded documents for malware before they are stored. Every upload
+// goes through the configured Scanner; infected files are quarantined by docstore and the result
+// is recorded in documentation.scan_status.
+//
+// Configuration comes from the environment:
+//
+//	DOCUMENT_SCANNER   clamd, eicar or none (default)
+//	CLAMD_ADDRESS      clamd socket, e.g. tcp://127.0.0.1:3310 (default) or unix:///var/run/clamav/clamd.ctl
+//	CLAMD_TIMEOUT      how long one scan may take, default 2m
+//
+// "eicar" only recognises the EICAR test file, which makes the quarantine path easy to try out
+// without running clamd. "none" stores and serves uploads unscanned, the server warns about it on
+// startup so deployments that have not set DOCUMENT_SCANNER yet keep running.
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// Values of documentation.scan_status
+const (
+	// StatusUnscanned marks files stored while scanning was disabled or before it existed. They are
+	// only served while scanning stays disabled, a configured scanner holds them until a rescan.
+	StatusUnscanned = "unscanned"
+	StatusClean     = "clean"
+	// StatusInfected files are quarantined and cannot be downloaded
+	StatusInfected = "infected"
+	// StatusError files could not be scanned and cannot be downloaded until a rescan clears them
+	StatusError = "error"
+)
+
+// Error codes of uploads and downloads held back by a scan
+const (
+	CodeInfected    = "file_infected"
+	CodeQuarantined = "file_quarantined"
+	CodeScanFailed  = "scan_failed"
+)
+
+// Downloadable reports whether a file with the status may be served
+func Downloadable(status string) bool {
+	return status == StatusClean || status == StatusUnscanned && Backend() == "none"
+}
+
+// Result is the verdict on one file
+type Result struct {
+	Infected bool
+	// Signature names what was found in an infected file
+	Signature string
+}
+
+// Scanner checks content for malware
+type Scanner interface {
+	// Name identifies the scanner in logs and reports
+	Name() string
+	// Scan reads r to the end, an error means no verdict was reached
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// ErrDisabled is returned by Default when DOCUMENT_SCANNER is none
+var ErrDisabled = errors.New("scanner: document scanning is disabled")
+
+var (
+	defaultOnce    sync.Once
+	defaultScanner Scanner
+	defaultErr     error
+)
+
+// Default returns the scanner configured in the environment, ErrDisabled when there is none
+func Default() (Scanner, error) {
+	defaultOnce.Do(func() {
+		defaultScanner, defaultErr = fromEnv()
+	})
+	return defaultScanner, defaultErr
+}
+
+// Check loads the configured scanner, so the server can refuse to start with a broken configuration
+func Check() error {
+	_, err := Default()
+	if errors.Is(err, ErrDisabled) {
+		return nil
+	}
+	return err
+}
+
+// Backend returns the name of the configured scanner
+func Backend() string {
+	return utils.Env("DOCUMENT_SCANNER", "none")
+}
+
+func fromEnv() (Scanner, error) {
+	switch backend := Backend(); backend {
+	case "none":
+		return nil, ErrDisabled
+	case "eicar":
+		return EICAR{}, nil
+	case "clamd":
+		return NewClamd(utils.Env("CLAMD_ADDRESS", "tcp://127.0.0.1:3310"), utils.EnvDuration("CLAMD_TIMEOUT", 2*time.Minute))
+	default:
+		return nil, fmt.Errorf("scanner: unknown DOCUMENT_SCANNER %q, expected none, eicar or clamd", backend)
+	}
+}
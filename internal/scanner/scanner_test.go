@@ -0,0 +1,60 @@
+package scanner
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		backend string
+		name    string
+		err     error
+	}{
+		{backend: "", err: ErrDisabled},
+		{backend: "none", err: ErrDisabled},
+		{backend: "eicar", name: "eicar"},
+		{backend: "antivirus"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.backend, func(t *testing.T) {
+			t.Setenv("DOCUMENT_SCANNER", tt.backend)
+			s, err := fromEnv()
+			switch {
+			case tt.name != "":
+				if err != nil || s.Name() != tt.name {
+					t.Fatalf("fromEnv = %v, %v, want %s", s, err, tt.name)
+				}
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("fromEnv error = %v, want %v", err, tt.err)
+				}
+			default:
+				if err == nil {
+					t.Fatal("an unknown scanner was accepted")
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadable(t *testing.T) {
+	tests := []struct {
+		backend, status string
+		want            bool
+	}{
+		{"clamd", StatusClean, true},
+		{"clamd", StatusUnscanned, false},
+		{"clamd", StatusError, false},
+		{"clamd", StatusInfected, false},
+		{"none", StatusUnscanned, true},
+		{"none", StatusError, false},
+		{"", StatusUnscanned, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("DOCUMENT_SCANNER", tt.backend)
+		if got := Downloadable(tt.status); got != tt.want {
+			t.Errorf("Downloadable(%q) with DOCUMENT_SCANNER=%q = %v, want %v", tt.status, tt.backend, got, tt.want)
+		}
+	}
+}
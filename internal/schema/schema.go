@@ -0,0 +1,113 @@
+// Package schema checks that the database has every migration the server relies on. Migrations
+// are the numbered SQL files in migrations/, applied by hand in file name order before a deploy
+// (see VPS_README.md).
+//
+// Each migration leaves a column or a named key behind, so checking those tells which
+// migrations are missing without a bookkeeping table. The server and restart.sh refuse to
+// run against an older schema instead of failing on the first request that reads a new column.
+package schema
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// Migration is one file of migrations/ and a column, unique key or foreign key of Table that
+// exists once it was applied
+type Migration struct {
+	File   string
+	Table  string
+	Marker string
+}
+
+// Migrations lists every migration in the order it has to be applied. A new migration file
+// is added here together with a column or named key it creates.
+var Migrations = []Migration{
+	{"001_row_versions.sql", "activity", "version"},
+	{"002_soft_delete.sql", "person", "deleted_at"},
+	{"003_deletion_tombstones.sql", "deletion_tombstone", "tombstone_id"},
+	{"004_audit_log.sql", "audit_chain_head", "hash"},
+	{"005_profile_history.sql", "profile_history", "version"},
+	{"006_user_invites.sql", "user_invite", "token_hash"},
+	{"007_webhooks.sql", "webhook_delivery", "next_attempt_at"},
+	{"008_idempotency_keys.sql", "idempotency_key", "request_hash"},
+	{"009_grant_timestamps.sql", "stu_accom", "granted_at"},
+	{"010_activity_type.sql", "activity", "activity_type"},
+	{"011_field_encryption.sql", "person", "email_index"},
+	{"012_storage_key.sql", "documentation", "storage_key"},
+	{"013_content_addressed_storage.sql", "documentation", "content_sha256"},
+	{"014_malware_scanning.sql", "documentation", "scan_status"},
+	{"015_document_versions.sql", "documentation", "current_version"},
+	{"016_encrypted_disability_links.sql", "stu_dis", "disability_index"},
+	{"017_unique_email_index.sql", "person", "uq_person_email_index"},
+	{"018_disability_link_foreign_key.sql", "stu_dis", "fk_stu_dis_disability"},
+}
+
+// Missing returns the migrations whose column or key does not exist, in order
+func Missing(ctx context.Context, q utils.DBTX) ([]Migration, error) {
+	tables := map[string]bool{}
+	args := []any{}
+	for _, m := range Migrations {
+		if !tables[m.Table] {
+			tables[m.Table] = true
+			args = append(args, m.Table)
+		}
+	}
+
+	in := strings.TrimSuffix(strings.Repeat("?,", len(args)), ",")
+	rows, err := q.QueryContext(ctx, `
+		SELECT table_name, column_name FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name IN (`+in+`)
+		UNION ALL
+		SELECT table_name, constraint_name FROM information_schema.table_constraints
+		WHERE table_schema = DATABASE() AND table_name IN (`+in+`)
+	`, append(args, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := map[string]bool{}
+	for rows.Next() {
+		var table, name string
+		if err := rows.Scan(&table, &name); err != nil {
+			return nil, err
+		}
+		existing[strings.ToLower(table)+"."+strings.ToLower(name)] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var missing []Migration
+	for _, m := range Migrations {
+		if !existing[m.Table+"."+m.Marker] {
+			missing = append(missing, m)
+		}
+	}
+	return missing, nil
+}
+
+// Check returns an error naming the migrations that have not been applied
+func Check(ctx context.Context, q utils.DBTX) error {
+	missing, err := Missing(ctx, q)
+	if err != nil {
+		return fmt.Errorf("schema: reading the columns and keys: %w", err)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	files := make([]string, len(missing))
+	for i, m := range missing {
+		files[i] = m.File
+	}
+	return fmt.Errorf("schema: migrations %s have not been applied, run them in order from migrations/", strings.Join(files, ", "))
+}
+
+// Latest returns the file name of the newest migration
+func Latest() string {
+	return Migrations[len(Migrations)-1].File
+}
@@ -0,0 +1,62 @@
+package schema
+
+import (
+	"context"
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+)
+
+func TestMigrationsListEveryFile(t *testing.T) {
+	files, err := filepath.Glob("../../migrations/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migrations found: %v", err)
+	}
+	if len(files) != len(Migrations) {
+		t.Fatalf("%d migration files but %d listed", len(files), len(Migrations))
+	}
+	for i, file := range files {
+		m := Migrations[i]
+		if filepath.Base(file) != m.File {
+			t.Fatalf("migration %d is %s, listed as %s", i+1, filepath.Base(file), m.File)
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(content), m.Table) || !strings.Contains(string(content), m.Marker) {
+			t.Errorf("%s does not mention %s.%s", m.File, m.Table, m.Marker)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	// A database with every migration up to 014
+	var columns [][]driver.Value
+	for _, m := range Migrations {
+		if m.File < "015" {
+			columns = append(columns, []driver.Value{strings.ToUpper(m.Table), m.Marker})
+		}
+	}
+	fake := &testdb.DB{Query: func(string, []driver.Value) (*testdb.Rows, error) {
+		return &testdb.Rows{Values: columns}, nil
+	}}
+	db := fake.Open(t)
+
+	err := Check(context.Background(), db)
+	if err == nil || !strings.Contains(err.Error(), "015_document_versions.sql, 016_encrypted_disability_links.sql, 017") ||
+		strings.Contains(err.Error(), "014") {
+		t.Fatalf("Check = %v, want 015 and later reported missing", err)
+	}
+
+	for _, m := range Migrations[len(columns):] {
+		columns = append(columns, []driver.Value{m.Table, m.Marker})
+	}
+	if err := Check(context.Background(), db); err != nil {
+		t.Fatalf("Check on an up to date schema = %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package stream
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/webhook"
+)
+
+// DashboardEvents are the event types streamed to the admin dashboard
+var DashboardEvents = []string{
+	webhook.EventPointOfContactCreated,
+	webhook.EventPointOfContactUpdated,
+	webhook.EventDocumentUploaded,
+	webhook.EventDocumentDeleted,
+}
+
+// Filter selects the events a client is interested in, zero fields match everything
+type Filter struct {
+	// Types limits the event types, DashboardEvents when empty
+	Types []string
+	// StudentID only keeps events about this student
+	StudentID int
+	// AdminID only keeps points of contact the admin attends and the admin's personal documents
+	AdminID int
+	// PinnedBy only keeps events about students pinned by this admin
+	PinnedBy int
+}
+
+// ParseTypes validates a comma-separated list of event types
+func ParseTypes(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	types := strings.Split(value, ",")
+	for _, t := range types {
+		known := false
+		for _, d := range DashboardEvents {
+			known = known || t == d
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	return types, nil
+}
+
+// subject is what the filter needs from an event's data
+type subject struct {
+	StudentID        *int `json:"student_id"`
+	AdminID          *int `json:"admin_id"`
+	PointOfContactID *int `json:"point_of_contact_id"`
+}
+
+// lookupTTL is how long a connection trusts a pin or point of contact lookup before asking again,
+// so pins and attendance changed during a connection apply within a minute
+const lookupTTL = time.Minute
+
+// lookup is a cached answer of an EXISTS query
+type lookup struct {
+	ok bool
+	at time.Time
+}
+
+// Matcher applies a filter to the events of one connection. It caches the pin and point of
+// contact lookups for lookupTTL, so a busy stream does not query the database for every event.
+// It is not safe for concurrent use, each connection sends its events from one goroutine.
+type Matcher struct {
+	Filter
+	db      *sql.DB
+	lookups map[string]lookup
+	now     func() time.Time
+}
+
+// NewMatcher returns a matcher of the filter for one connection
+func NewMatcher(db *sql.DB, f Filter) *Matcher {
+	return &Matcher{Filter: f, db: db, lookups: map[string]lookup{}, now: time.Now}
+}
+
+// exists answers an EXISTS query from the cache while it is fresh
+func (m *Matcher) exists(ctx context.Context, query string, args ...any) (bool, error) {
+	key := fmt.Sprint(query, args)
+	if l, ok := m.lookups[key]; ok && m.now().Sub(l.at) < lookupTTL {
+		return l.ok, nil
+	}
+	var ok bool
+	if err := m.db.QueryRowContext(ctx, query, args...).Scan(&ok); err != nil {
+		return false, err
+	}
+	m.lookups[key] = lookup{ok: ok, at: m.now()}
+	return ok, nil
+}
+
+// Match reports whether an event passes the filter, looking up pins and point of contact admins when needed
+func (m *Matcher) Match(ctx context.Context, e webhook.Payload) (bool, error) {
+	types := m.Types
+	if len(types) == 0 {
+		types = DashboardEvents
+	}
+	wanted := false
+	for _, t := range types {
+		wanted = wanted || e.Type == t
+	}
+	if !wanted {
+		return false, nil
+	}
+
+	var s subject
+	if err := json.Unmarshal(e.Data, &s); err != nil {
+		return false, err
+	}
+
+	if m.StudentID != 0 && (s.StudentID == nil || *s.StudentID != m.StudentID) {
+		return false, nil
+	}
+
+	if m.PinnedBy != 0 {
+		if s.StudentID == nil {
+			return false, nil
+		}
+		pinned, err := m.exists(ctx,
+			"SELECT EXISTS (SELECT 1 FROM pinned WHERE admin_id = ? AND student_id = ?)",
+			m.PinnedBy, *s.StudentID,
+		)
+		if err != nil || !pinned {
+			return false, err
+		}
+	}
+
+	if m.AdminID != 0 {
+		switch {
+		case s.PointOfContactID != nil:
+			attends, err := m.exists(ctx,
+				"SELECT EXISTS (SELECT 1 FROM poc_admin WHERE point_of_contact_id = ? AND admin_id = ?)",
+				*s.PointOfContactID, m.AdminID,
+			)
+			if err != nil || !attends {
+				return false, err
+			}
+		case s.AdminID != nil:
+			if *s.AdminID != m.AdminID {
+				return false, nil
+			}
+		default:
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// WriteEvent writes an event in Server-Sent Events format, its outbox ID becomes the event ID
+func WriteEvent(w io.Writer, e webhook.Payload) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
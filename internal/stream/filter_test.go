@@ -0,0 +1,92 @@
+package stream
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/webhook"
+)
+
+// pins answers the pin lookups, admin 1 has pinned the listed students
+func pins(students ...int64) *testdb.DB {
+	pinned := map[int64]bool{}
+	for _, id := range students {
+		pinned[id] = true
+	}
+	return &testdb.DB{Query: func(query string, args []driver.Value) (*testdb.Rows, error) {
+		if !strings.Contains(query, "FROM pinned") {
+			return nil, nil
+		}
+		return testdb.Row(args[0] == int64(1) && pinned[args[1].(int64)]), nil
+	}}
+}
+
+func event(t *testing.T, eventType string, data any) webhook.Payload {
+	t.Helper()
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return webhook.Payload{ID: 1, Type: eventType, Data: raw}
+}
+
+func TestMatcherFilters(t *testing.T) {
+	db := pins(7).Open(t)
+	ctx := context.Background()
+	created := webhook.EventPointOfContactCreated
+
+	tests := []struct {
+		filter Filter
+		event  webhook.Payload
+		want   bool
+	}{
+		{Filter{}, event(t, created, map[string]int{"student_id": 7}), true},
+		{Filter{}, event(t, webhook.EventAccommodationGranted, map[string]int{"student_id": 7}), false},
+		{Filter{Types: []string{webhook.EventDocumentDeleted}}, event(t, created, map[string]int{"student_id": 7}), false},
+		{Filter{StudentID: 7}, event(t, created, map[string]int{"student_id": 8}), false},
+		{Filter{PinnedBy: 1}, event(t, created, map[string]int{"student_id": 7}), true},
+		{Filter{PinnedBy: 1}, event(t, created, map[string]int{"student_id": 8}), false},
+		{Filter{PinnedBy: 1}, event(t, webhook.EventDocumentUploaded, map[string]int{"admin_id": 1}), false},
+		{Filter{AdminID: 1}, event(t, webhook.EventDocumentUploaded, map[string]int{"admin_id": 1}), true},
+		{Filter{AdminID: 1}, event(t, webhook.EventDocumentUploaded, map[string]int{"admin_id": 2}), false},
+	}
+	for i, tt := range tests {
+		got, err := NewMatcher(db, tt.filter).Match(ctx, tt.event)
+		if err != nil || got != tt.want {
+			t.Errorf("case %d: Match = %v, %v, want %v", i, got, err, tt.want)
+		}
+	}
+}
+
+func TestMatcherCachesLookups(t *testing.T) {
+	fake := pins(7)
+	m := NewMatcher(fake.Open(t), Filter{PinnedBy: 1})
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// A busy stream asks once per student, not once per event
+	for _, student := range []int{7, 7, 8, 7, 8} {
+		if _, err := m.Match(ctx, event(t, webhook.EventPointOfContactCreated, map[string]int{"student_id": student})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := fake.Count("FROM pinned"); n != 2 {
+		t.Fatalf("%d pin lookups for two students, want 2", n)
+	}
+
+	// An unpinned student stops matching once the cached answer is stale
+	fake.Query = pins().Query
+	now = now.Add(lookupTTL)
+	if ok, err := m.Match(ctx, event(t, webhook.EventPointOfContactCreated, map[string]int{"student_id": 7})); err != nil || ok {
+		t.Fatalf("Match after unpinning = %v, %v, want false", ok, err)
+	}
+	if n := fake.Count("FROM pinned"); n != 3 {
+		t.Fatalf("%d pin lookups, want the stale answer looked up again", n)
+	}
+}
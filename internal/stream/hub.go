@@ -0,0 +1,228 @@
+// Package stream pushes committed domain events to connected dashboards. Events are read from the
+// webhook outbox, so the stream only ever shows committed changes and the event ID doubles as the
+// Server-Sent Events ID that clients resume from with Last-Event-ID.
+package stream
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/webhook"
+)
+
+// Hub tuning
+const (
+	pollInterval = time.Second
+	pollBatch    = 500
+	// subscriberBuffer is how many events a slow client may fall behind before it is disconnected.
+	// It then reconnects with Last-Event-ID and catches up from the database.
+	subscriberBuffer = 256
+	// gapTimeout is how long an event ID the poll skipped is looked for again. IDs are taken when
+	// an event is inserted but only become visible when its transaction commits, so a transaction
+	// that commits late shows up below events already sent; IDs of rolled back ones never appear.
+	gapTimeout = time.Minute
+	// maxGaps bounds the skipped IDs looked for, the lowest are given up first
+	maxGaps = 1000
+)
+
+// Hub polls the outbox once for every connected client and fans new events out to them
+type Hub struct {
+	db     *sql.DB
+	ctx    context.Context
+	stop   context.CancelFunc
+	mu     sync.Mutex
+	subs   map[chan webhook.Payload]struct{}
+	start  sync.Once
+	closed bool
+}
+
+var (
+	hubsMu sync.Mutex
+	hubs   = map[*sql.DB]*Hub{}
+)
+
+// For returns the hub of a database, polling starts with the first subscriber
+func For(db *sql.DB) *Hub {
+	hubsMu.Lock()
+	defer hubsMu.Unlock()
+
+	h, ok := hubs[db]
+	if !ok {
+		h = &Hub{db: db, subs: map[chan webhook.Payload]struct{}{}}
+		h.ctx, h.stop = context.WithCancel(context.Background())
+		hubs[db] = h
+	}
+	return h
+}
+
+// Shutdown stops polling and disconnects every client so the server can stop without waiting on open streams
+func Shutdown() {
+	hubsMu.Lock()
+	defer hubsMu.Unlock()
+
+	for _, h := range hubs {
+		h.stop()
+		h.mu.Lock()
+		h.closed = true
+		for ch := range h.subs {
+			delete(h.subs, ch)
+			close(ch)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Subscribe returns a channel of events committed from now on. The channel is closed when the
+// client falls too far behind or the server shuts down; cancel must be called when the client leaves.
+func (h *Hub) Subscribe() (<-chan webhook.Payload, func()) {
+	// The cursor is read before the first client replays so no event falls between the two
+	h.start.Do(func() {
+		cursor, err := webhook.LatestEventID(h.ctx, h.db)
+		go h.run(h.ctx, cursor, err)
+	})
+
+	ch := make(chan webhook.Payload, subscriberBuffer)
+	h.mu.Lock()
+	if h.closed {
+		close(ch)
+	} else {
+		h.subs[ch] = struct{}{}
+	}
+	h.mu.Unlock()
+
+	cancel := func() {
+		h.mu.Lock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+		h.mu.Unlock()
+	}
+	return ch, cancel
+}
+
+// run polls from cursor, the newest event when the hub started, until ctx is cancelled; history
+// is served from the database by Replay
+func (h *Hub) run(ctx context.Context, cursor int64, err error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for err != nil {
+		log.Println("Stream poll error:", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cursor, err = webhook.LatestEventID(ctx, h.db)
+	}
+
+	gaps := map[int64]time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !h.active() {
+			continue
+		}
+		cursor = h.poll(ctx, cursor, gaps)
+	}
+}
+
+// poll sends the events that committed since the last poll and returns the new cursor: first the
+// late ones among the gaps, the IDs below cursor that were not visible yet, then the ones after cursor
+func (h *Hub) poll(ctx context.Context, cursor int64, gaps map[int64]time.Time) int64 {
+	now := time.Now()
+	if len(gaps) > 0 {
+		ids := make([]int64, 0, len(gaps))
+		for id, skipped := range gaps {
+			if now.Sub(skipped) > gapTimeout {
+				delete(gaps, id)
+				continue
+			}
+			ids = append(ids, id)
+		}
+		late, err := webhook.EventsIn(ctx, h.db, ids)
+		if err != nil {
+			log.Println("Stream poll error:", err)
+		}
+		for _, e := range late {
+			delete(gaps, e.ID)
+			h.broadcast(e)
+		}
+	}
+
+	events, err := webhook.EventsAfter(ctx, h.db, cursor, pollBatch)
+	if err != nil {
+		log.Println("Stream poll error:", err)
+		return cursor
+	}
+	for _, e := range events {
+		for id := max(cursor+1, e.ID-maxGaps); id < e.ID; id++ {
+			gaps[id] = now
+		}
+		h.broadcast(e)
+		cursor = e.ID
+	}
+
+	if len(gaps) > maxGaps {
+		ids := make([]int64, 0, len(gaps))
+		for id := range gaps {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		for _, id := range ids[:len(ids)-maxGaps] {
+			delete(gaps, id)
+		}
+	}
+	return cursor
+}
+
+// active reports whether anyone is listening, idle hubs skip the database
+func (h *Hub) active() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs) > 0
+}
+
+func (h *Hub) broadcast(e webhook.Payload) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+			// Disconnects clients that stopped reading instead of blocking everyone else
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Replay calls send for every event after afterID that is already in the database, in ID order,
+// and returns the ID of the last event it saw. An event below afterID that commits later is only
+// sent live, to clients connected when it commits.
+func Replay(ctx context.Context, db *sql.DB, afterID int64, send func(webhook.Payload) error) (int64, error) {
+	for {
+		events, err := webhook.EventsAfter(ctx, db, afterID, pollBatch)
+		if err != nil {
+			return afterID, err
+		}
+		for _, e := range events {
+			if err := send(e); err != nil {
+				return afterID, err
+			}
+			afterID = e.ID
+		}
+		if len(events) < pollBatch {
+			return afterID, nil
+		}
+	}
+}
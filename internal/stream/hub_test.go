@@ -0,0 +1,147 @@
+package stream
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/webhook"
+)
+
+// outbox is a webhook_event table whose rows become visible when committed
+type outbox struct {
+	testdb.DB
+	mu        sync.Mutex
+	committed map[int64]bool
+}
+
+func newOutbox(ids ...int64) *outbox {
+	o := &outbox{committed: map[int64]bool{}}
+	o.commit(ids...)
+	o.Query = o.answer
+	return o
+}
+
+func (o *outbox) commit(ids ...int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, id := range ids {
+		o.committed[id] = true
+	}
+}
+
+// answer answers the event queries of the webhook package
+func (o *outbox) answer(query string, args []driver.Value) (*testdb.Rows, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var match func(id int64) bool
+	switch {
+	case strings.Contains(query, "MAX(event_id)"):
+		var latest int64
+		for id := range o.committed {
+			latest = max(latest, id)
+		}
+		return testdb.Row(latest), nil
+	case strings.Contains(query, "event_id > ?"):
+		after := args[0].(int64)
+		match = func(id int64) bool { return id > after }
+	case strings.Contains(query, "event_id IN"):
+		wanted := map[int64]bool{}
+		for _, arg := range args {
+			wanted[arg.(int64)] = true
+		}
+		match = func(id int64) bool { return wanted[id] }
+	default:
+		return nil, nil
+	}
+
+	rows := &testdb.Rows{Columns: []string{"event_id", "event_type", "created_at", "payload"}}
+	for id := int64(1); id <= 100; id++ {
+		if o.committed[id] && match(id) {
+			rows.Values = append(rows.Values, []driver.Value{id, "student.updated", time.Now(), []byte(`{}`)})
+		}
+	}
+	return rows, nil
+}
+
+func receive(t *testing.T, h *Hub, ch chan webhook.Payload, gaps map[int64]time.Time, cursor *int64) []int64 {
+	t.Helper()
+	*cursor = h.poll(context.Background(), *cursor, gaps)
+	var ids []int64
+	for {
+		select {
+		case e := <-ch:
+			ids = append(ids, e.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestPollDeliversLateCommits(t *testing.T) {
+	o := newOutbox(1)
+	db := o.Open(t)
+	h := &Hub{db: db, subs: map[chan webhook.Payload]struct{}{}}
+	ch := make(chan webhook.Payload, subscriberBuffer)
+	h.subs[ch] = struct{}{}
+
+	gaps := map[int64]time.Time{}
+	cursor := int64(1)
+
+	// 3 commits before 2, whose transaction took its ID first
+	o.commit(3)
+	if got := fmt.Sprint(receive(t, h, ch, gaps, &cursor)); got != "[3]" {
+		t.Fatalf("first poll sent %s", got)
+	}
+	o.commit(2, 4)
+	if got := fmt.Sprint(receive(t, h, ch, gaps, &cursor)); got != "[2 4]" {
+		t.Fatalf("second poll sent %s, want the late event 2 and then 4", got)
+	}
+	if got := fmt.Sprint(receive(t, h, ch, gaps, &cursor)); got != "[]" || len(gaps) != 0 {
+		t.Fatalf("third poll sent %s with gaps %v", got, gaps)
+	}
+
+	// A rolled back ID is looked for until gapTimeout passes
+	o.commit(7)
+	receive(t, h, ch, gaps, &cursor)
+	if len(gaps) != 2 {
+		t.Fatalf("gaps = %v, want 5 and 6", gaps)
+	}
+	for id := range gaps {
+		gaps[id] = time.Now().Add(-2 * gapTimeout)
+	}
+	receive(t, h, ch, gaps, &cursor)
+	if len(gaps) != 0 {
+		t.Fatalf("expired gaps were kept: %v", gaps)
+	}
+}
+
+func TestShutdownStopsPolling(t *testing.T) {
+	o := newOutbox(1)
+	db := o.Open(t)
+
+	h := For(db)
+	done := make(chan struct{})
+	go func() {
+		h.run(h.ctx, 0, nil)
+		close(done)
+	}()
+	events, cancel := h.Subscribe()
+	defer cancel()
+
+	Shutdown()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the poll loop kept running after Shutdown")
+	}
+	if _, ok := <-events; ok {
+		t.Fatal("the subscription was not closed")
+	}
+}
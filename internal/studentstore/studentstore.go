@@ -0,0 +1,142 @@
+// Package studentstore reads and writes the person and student rows of a student. The student
+// handlers and the importer share it so both write students the same way.
+package studentstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/models"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// Insert adds the person and student rows of a new student and returns its ID
+func Insert(ctx context.Context, tx *sql.Tx, s models.Student) (int, error) {
+	// Executes SQL to insert into person table
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO person (
+			first_name, preferred_name, middle_name, last_name, email,
+			phone_number, pronouns, sex, gender, birthday,
+			address, city, state, zip_code, country, email_index
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.FirstName, s.PreferredName, s.MiddleName, s.LastName,
+		fieldcrypt.Value(fieldcrypt.PersonEmail, s.Email),
+		fieldcrypt.Value(fieldcrypt.PersonPhoneNumber, s.PhoneNumber),
+		s.Pronouns, s.Sex, s.Gender,
+		fieldcrypt.Value(fieldcrypt.PersonBirthday, s.Birthday),
+		fieldcrypt.Value(fieldcrypt.PersonAddress, s.Address),
+		s.City, s.State, s.ZipCode, s.Country,
+		fieldcrypt.BlindIndex(fieldcrypt.PersonEmail, s.Email),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	// Gets the last inserted person ID
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	// Executes SQL to insert into student table
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO student (student_id, year, start_year, planned_grad_year, housing, dining)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		id, s.Year, s.StartYear, s.PlannedGradYear, s.Housing, s.Dining,
+	)
+	return int(id), err
+}
+
+// Fetch loads a single student joined with its person row and returns its row version.
+// The student row is locked when called inside a transaction.
+func Fetch(ctx context.Context, q utils.DBTX, studentID int) (models.Student, int, error) {
+	// SQL query to select a single student
+	query := `
+		SELECT
+			s.student_id,
+			p.first_name, p.preferred_name, p.middle_name, p.last_name,
+			p.email, p.phone_number, p.pronouns, p.sex, p.gender,
+			p.birthday, p.address, p.city, p.state, p.zip_code, p.country,
+			s.year, s.start_year, s.planned_grad_year, s.housing, s.dining, s.version
+		FROM student s
+		JOIN person p ON s.student_id = p.person_id
+		WHERE s.student_id = ? AND p.deleted_at IS NULL
+	`
+	if _, ok := q.(*sql.Tx); ok {
+		query += " FOR UPDATE"
+	}
+
+	// Empty variables for student struct and row version
+	var s models.Student
+	var version int
+
+	// Executes query
+	err := q.QueryRowContext(ctx, query, studentID).Scan(
+		&s.StudentID,
+		&s.FirstName,
+		&s.PreferredName,
+		&s.MiddleName,
+		&s.LastName,
+		fieldcrypt.Scan(fieldcrypt.PersonEmail, &s.Email),
+		fieldcrypt.Scan(fieldcrypt.PersonPhoneNumber, &s.PhoneNumber),
+		&s.Pronouns,
+		&s.Sex,
+		&s.Gender,
+		fieldcrypt.Scan(fieldcrypt.PersonBirthday, &s.Birthday),
+		fieldcrypt.Scan(fieldcrypt.PersonAddress, &s.Address),
+		&s.City,
+		&s.State,
+		&s.ZipCode,
+		&s.Country,
+		&s.Year,
+		&s.StartYear,
+		&s.PlannedGradYear,
+		&s.Housing,
+		&s.Dining,
+		&version,
+	)
+
+	return s, version, err
+}
+
+// Update writes a student to the person and student tables, bumps its row version
+// and returns the student rows affected
+func Update(ctx context.Context, tx *sql.Tx, studentID int, s models.Student) (int64, error) {
+	// Execute direct SQL update
+	_, err := tx.ExecContext(ctx,
+		`UPDATE person
+		 SET first_name = ?, preferred_name = ?, middle_name = ?, last_name = ?,
+		     email = ?, phone_number = ?, pronouns = ?, sex = ?, gender = ?,
+		     birthday = ?, address = ?, city = ?, state = ?, zip_code = ?, country = ?, email_index = ?
+		 WHERE person_id = ?`,
+		s.FirstName, s.PreferredName, s.MiddleName, s.LastName,
+		fieldcrypt.Value(fieldcrypt.PersonEmail, s.Email),
+		fieldcrypt.Value(fieldcrypt.PersonPhoneNumber, s.PhoneNumber),
+		s.Pronouns, s.Sex, s.Gender,
+		fieldcrypt.Value(fieldcrypt.PersonBirthday, s.Birthday),
+		fieldcrypt.Value(fieldcrypt.PersonAddress, s.Address),
+		s.City, s.State, s.ZipCode, s.Country,
+		fieldcrypt.BlindIndex(fieldcrypt.PersonEmail, s.Email),
+		studentID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	// Updates student table fields
+	res, err := tx.ExecContext(ctx,
+		`UPDATE student
+		 SET year = ?, start_year = ?, planned_grad_year = ?, housing = ?, dining = ?,
+		     version = version + 1
+		 WHERE student_id = ?`,
+		s.Year, s.StartYear, s.PlannedGradYear, s.Housing, s.Dining,
+		studentID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	// Gets the number of rows affected by the update
+	return res.RowsAffected()
+}
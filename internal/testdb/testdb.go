@@ -0,0 +1,228 @@
+// Package testdb is a fake database/sql driver for package tests. A test describes how the
+// database answers in Query and Exec functions and inspects the statements it received, which
+// keeps the fixtures of every package to the few queries they care about.
+package testdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// DB answers the statements of one test. Query and Exec run one at a time under the DB's lock,
+// so fixtures can keep state in plain fields.
+type DB struct {
+	// Query answers a query with its rows. When nil, every query returns no rows.
+	Query func(query string, args []driver.Value) (*Rows, error)
+	// Exec answers any other statement. When nil, every statement affects one row.
+	Exec func(query string, args []driver.Value) (Result, error)
+	// BeginErr and CommitErr make transactions fail to start or to commit
+	BeginErr  error
+	CommitErr error
+
+	mu         sync.Mutex
+	statements []string
+	commits    int
+	rollbacks  int
+}
+
+// Rows is the result of a query. Columns may be left empty, the values then decide how many
+// placeholder columns there are.
+type Rows struct {
+	Columns []string
+	Values  [][]driver.Value
+}
+
+// Result is the result of a statement
+type Result struct {
+	InsertID int64
+	Affected int64
+}
+
+// Row returns a result with the single row of values
+func Row(values ...driver.Value) *Rows {
+	return &Rows{Values: [][]driver.Value{values}}
+}
+
+// Empty returns a result without rows
+func Empty() *Rows {
+	return &Rows{}
+}
+
+// Open returns a *sql.DB backed by d that is closed when the test ends
+func (d *DB) Open(t testing.TB) *sql.DB {
+	db := sql.OpenDB(d)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// Statements returns every statement received so far with its whitespace collapsed, including
+// BEGIN, COMMIT and ROLLBACK
+func (d *DB) Statements() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.statements...)
+}
+
+// Log returns the statements one per line, for failure messages
+func (d *DB) Log() string {
+	return strings.Join(d.Statements(), "\n")
+}
+
+// Count returns how many statements contain substr
+func (d *DB) Count(substr string) int {
+	n := 0
+	for _, statement := range d.Statements() {
+		if strings.Contains(statement, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+// Commits returns how many transactions were committed
+func (d *DB) Commits() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.commits
+}
+
+// Rollbacks returns how many transactions were rolled back
+func (d *DB) Rollbacks() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rollbacks
+}
+
+// Reset forgets the statements and transactions received so far
+func (d *DB) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements, d.commits, d.rollbacks = nil, 0, 0
+}
+
+// Normalize collapses the whitespace of a statement the way Statements records it
+func Normalize(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+func (d *DB) Connect(context.Context) (driver.Conn, error) { return conn{d}, nil }
+func (d *DB) Driver() driver.Driver                        { return fakeDriver{d} }
+
+type fakeDriver struct{ d *DB }
+
+func (f fakeDriver) Open(string) (driver.Conn, error) { return conn(f), nil }
+
+type conn struct{ d *DB }
+
+func (c conn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("testdb: prepared statements are not supported")
+}
+func (c conn) Close() error { return nil }
+
+func (c conn) Begin() (driver.Tx, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.statements = append(c.d.statements, "BEGIN")
+	if c.d.BeginErr != nil {
+		return nil, c.d.BeginErr
+	}
+	return tx(c), nil
+}
+
+func (c conn) QueryContext(_ context.Context, query string, named []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.statements = append(c.d.statements, Normalize(query))
+	if c.d.Query == nil {
+		return &rows{}, nil
+	}
+	result, err := c.d.Query(query, values(named))
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, fmt.Errorf("testdb: unexpected query %s", Normalize(query))
+	}
+	return &rows{columns: result.Columns, values: result.Values}, nil
+}
+
+func (c conn) ExecContext(_ context.Context, query string, named []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.statements = append(c.d.statements, Normalize(query))
+	if c.d.Exec == nil {
+		return Result{Affected: 1}, nil
+	}
+	return c.d.Exec(query, values(named))
+}
+
+func values(named []driver.NamedValue) []driver.Value {
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+	return args
+}
+
+type tx struct{ d *DB }
+
+func (t tx) Commit() error {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	t.d.statements = append(t.d.statements, "COMMIT")
+	if t.d.CommitErr != nil {
+		t.d.rollbacks++
+		return t.d.CommitErr
+	}
+	t.d.commits++
+	return nil
+}
+
+func (t tx) Rollback() error {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	t.d.statements = append(t.d.statements, "ROLLBACK")
+	t.d.rollbacks++
+	return nil
+}
+
+func (r Result) LastInsertId() (int64, error) { return r.InsertID, nil }
+func (r Result) RowsAffected() (int64, error) { return r.Affected, nil }
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *rows) Columns() []string {
+	if r.columns != nil {
+		return r.columns
+	}
+	if len(r.values) == 0 {
+		return []string{}
+	}
+	// Kept so a scan error after the last row can still name its column
+	r.columns = make([]string, len(r.values[0]))
+	for i := range r.columns {
+		r.columns[i] = fmt.Sprintf("c%d", i)
+	}
+	return r.columns
+}
+
+func (r *rows) Close() error { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,163 @@
+package timeline
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// Entry types registered by this package
+const (
+	TypePointOfContact        = "point_of_contact"
+	TypeSpecificDocumentation = "specific_documentation"
+	TypeAccommodationGranted  = "accommodation_granted"
+	TypeDisabilityRecorded    = "disability_recorded"
+	TypeProfileChanged        = "profile_changed"
+)
+
+func init() {
+	// Appointments are placed at the time they take place, with the admins attending
+	Register(Kind{Type: TypePointOfContact, Query: `
+		SELECT poc.point_of_contact_id AS id, poc.event_datetime AS occurred_at,
+			JSON_OBJECT(
+				'point_of_contact_id', poc.point_of_contact_id,
+				'event_datetime', poc.event_datetime,
+				'duration', poc.duration,
+				'event_type', poc.event_type,
+				'admins', COALESCE((
+					SELECT JSON_ARRAYAGG(JSON_OBJECT(
+						'id', p.person_id, 'first_name', p.first_name,
+						'preferred_name', p.preferred_name, 'last_name', p.last_name))
+					FROM poc_admin pa
+					INNER JOIN person p ON p.person_id = pa.admin_id
+					WHERE pa.point_of_contact_id = poc.point_of_contact_id
+				), JSON_ARRAY())
+			) AS data
+		FROM point_of_contact poc
+		WHERE poc.student_id = ?
+	`})
+
+	// Documents are placed at upload time, documents in the trash are left out
+	Register(Kind{Type: TypeSpecificDocumentation, Query: `
+		SELECT sd.specific_documentation_id AS id, a.activity_datetime AS occurred_at,
+			JSON_OBJECT(
+				'specific_documentation_id', sd.specific_documentation_id,
+				'doc_type', sd.doc_type,
+				'file_name', d.file_name,
+				'mime_type', d.mime_type,
+				'size_bytes', d.size_bytes,
+				'uploaded_by', d.uploaded_by
+			) AS data
+		FROM specific_documentation sd
+		INNER JOIN activity a ON a.activity_id = sd.specific_documentation_id
+		INNER JOIN documentation d ON d.documentation_id = sd.specific_documentation_id
+		WHERE sd.student_id = ? AND d.deleted_at IS NULL
+	`})
+
+	Register(Kind{Type: TypeAccommodationGranted, Query: `
+		SELECT sa.accommodation_id AS id, sa.granted_at AS occurred_at,
+			JSON_OBJECT('accommodation_id', ac.accommodation_id, 'name', ac.name) AS data
+		FROM stu_accom sa
+		INNER JOIN accommodation ac ON ac.accommodation_id = sa.accommodation_id
+		WHERE sa.student_id = ?
+	`})
+
+	// Sealed links cannot be joined to disability, finishDisabilities decrypts them and adds the names
+	Register(Kind{Type: TypeDisabilityRecorded, Query: `
+		SELECT sd.stu_dis_id AS id, sd.recorded_at AS occurred_at,
+			JSON_OBJECT('disability_id', sd.disability_id, 'disability_ref', sd.disability_ref) AS data
+		FROM stu_dis sd
+		WHERE sd.student_id = ?
+	`, Finish: finishDisabilities})
+
+	// Profile versions, baselines captured before the first recorded change have no changes and are left out
+	Register(Kind{Type: TypeProfileChanged, Query: `
+		SELECT ph.version AS id, ph.changed_at AS occurred_at,
+			JSON_OBJECT(
+				'version', ph.version,
+				'changed_by', ph.changed_by,
+				'changes', CAST(ph.changes AS JSON),
+				'reverted_from', ph.reverted_from
+			) AS data
+		FROM profile_history ph
+		WHERE ph.profile_type = 'student' AND ph.profile_id = ? AND ph.changes IS NOT NULL
+	`, Finish: finishProfileChanges})
+}
+
+// finishDisabilities replaces the stored link of disability_recorded entries with the disability's
+// ID and name, disabilities deleted since keep a null name
+func finishDisabilities(ctx context.Context, q utils.DBTX, entries []*Entry) error {
+	ids := make([]int, len(entries))
+	args := []any{}
+	for i, e := range entries {
+		var link struct {
+			DisabilityID  *int    `json:"disability_id"`
+			DisabilityRef *string `json:"disability_ref"`
+		}
+		if err := json.Unmarshal(e.Data, &link); err != nil {
+			return err
+		}
+		switch {
+		case link.DisabilityID != nil:
+			ids[i] = *link.DisabilityID
+		case link.DisabilityRef != nil:
+			value, err := fieldcrypt.Decrypt(fieldcrypt.StuDisDisabilityID, *link.DisabilityRef)
+			if err != nil {
+				return err
+			}
+			if ids[i], err = strconv.Atoi(value); err != nil {
+				return err
+			}
+		}
+		args = append(args, ids[i])
+	}
+
+	names := map[int]string{}
+	rows, err := q.QueryContext(ctx,
+		"SELECT disability_id, name FROM disability WHERE disability_id IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")+")",
+		args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		names[id] = name
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, e := range entries {
+		var name *string
+		if n, ok := names[ids[i]]; ok {
+			name = &n
+		}
+		data, err := json.Marshal(map[string]any{"disability_id": ids[i], "name": name})
+		if err != nil {
+			return err
+		}
+		e.Data = data
+	}
+	return nil
+}
+
+// finishProfileChanges decrypts the person fields that profile history stores sealed
+func finishProfileChanges(ctx context.Context, q utils.DBTX, entries []*Entry) error {
+	for _, e := range entries {
+		data, err := fieldcrypt.OpenJSON(e.Data, fieldcrypt.PersonFields)
+		if err != nil {
+			return err
+		}
+		e.Data = data
+	}
+	return nil
+}
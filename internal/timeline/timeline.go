@@ -0,0 +1,222 @@
+// Package timeline merges everything that happened to a student into one history, newest first.
+// Each kind of entry registers the SQL that selects it, so a new activity type is a Register call
+// instead of another branch in a handler.
+package timeline
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// Entry is one event on a student's timeline. Data depends on Type.
+type Entry struct {
+	Type       string          `json:"type"`
+	ID         int64           `json:"id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// Kind is a registered type of timeline entry
+type Kind struct {
+	Type string
+	// Query selects the columns id, occurred_at and data (a JSON object) for the student bound to
+	// its only placeholder. Rows with a NULL occurred_at are skipped.
+	Query string
+	// Finish, when set, rewrites the data of the kind's entries on a page, for data SQL cannot
+	// produce such as decrypted values
+	Finish func(ctx context.Context, q utils.DBTX, entries []*Entry) error
+}
+
+// Page is one page of a timeline; NextCursor is empty on the last page
+type Page struct {
+	Entries    []Entry `json:"entries"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// Filter narrows a timeline. Zero values mean no restriction; To is exclusive.
+type Filter struct {
+	Types []string
+	From  time.Time
+	To    time.Time
+	After *Cursor
+	Limit int
+}
+
+// Cursor is the position of the last entry of a page
+type Cursor struct {
+	OccurredAt time.Time
+	Type       string
+	ID         int64
+}
+
+// ErrUnknownType is returned for entry types that were never registered
+var ErrUnknownType = errors.New("unknown timeline type")
+
+// ErrInvalidCursor is returned for cursors that were not produced by Encode
+var ErrInvalidCursor = errors.New("invalid timeline cursor")
+
+var (
+	kinds    = map[string]Kind{}
+	order    []string
+	typeName = regexp.MustCompile(`^[a-z_]+$`)
+)
+
+// Register adds a kind of entry. It panics on a malformed or duplicate type because kinds are
+// registered by the program itself.
+func Register(k Kind) {
+	if !typeName.MatchString(k.Type) {
+		panic("timeline: malformed type " + k.Type)
+	}
+	if _, ok := kinds[k.Type]; ok {
+		panic("timeline: duplicate type " + k.Type)
+	}
+	kinds[k.Type] = k
+	order = append(order, k.Type)
+}
+
+// Types lists the registered entry types in registration order
+func Types() []string {
+	return append([]string(nil), order...)
+}
+
+// ParseTypes parses a comma-separated list of entry types, an empty list means every type
+func ParseTypes(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var types []string
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		if _, ok := kinds[t]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownType, t)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// Encode turns the cursor into an opaque string for the next_cursor field
+func (c Cursor) Encode() string {
+	raw := strconv.FormatInt(c.OccurredAt.UnixNano(), 10) + ":" + c.Type + ":" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor reads a cursor produced by Encode
+func ParseCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 || !typeName.MatchString(parts[1]) {
+		return nil, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{OccurredAt: time.Unix(0, nanos).UTC(), Type: parts[1], ID: id}, nil
+}
+
+// List returns one page of a student's timeline in a single query: the registered kinds are
+// combined with UNION ALL and paged by (occurred_at, type, id) so entries sharing a timestamp
+// are neither repeated nor skipped.
+func List(ctx context.Context, q utils.DBTX, studentID int, f Filter) (Page, error) {
+	types := f.Types
+	if len(types) == 0 {
+		types = order
+	}
+
+	var sources []string
+	var args []any
+	for _, t := range types {
+		k, ok := kinds[t]
+		if !ok {
+			return Page{}, fmt.Errorf("%w: %s", ErrUnknownType, t)
+		}
+		sources = append(sources, "SELECT ? AS type, k.id, k.occurred_at, k.data FROM ("+k.Query+") k")
+		args = append(args, k.Type, studentID)
+	}
+
+	where := []string{"e.occurred_at IS NOT NULL"}
+	if !f.From.IsZero() {
+		where = append(where, "e.occurred_at >= ?")
+		args = append(args, f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		where = append(where, "e.occurred_at < ?")
+		args = append(args, f.To.UTC())
+	}
+	if c := f.After; c != nil {
+		where = append(where, "(e.occurred_at < ? OR (e.occurred_at = ? AND (e.type < ? OR (e.type = ? AND e.id < ?))))")
+		args = append(args, c.OccurredAt, c.OccurredAt, c.Type, c.Type, c.ID)
+	}
+
+	// One extra row tells whether there is a next page
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	args = append(args, limit+1)
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT e.type, e.id, e.occurred_at, e.data
+		FROM (`+strings.Join(sources, " UNION ALL ")+`) e
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY e.occurred_at DESC, e.type DESC, e.id DESC
+		LIMIT ?`,
+		args...,
+	)
+	if err != nil {
+		return Page{}, err
+	}
+	defer rows.Close()
+
+	page := Page{Entries: make([]Entry, 0, limit)}
+	for rows.Next() {
+		var e Entry
+		var data []byte
+		if err := rows.Scan(&e.Type, &e.ID, &e.OccurredAt, &data); err != nil {
+			return Page{}, err
+		}
+		e.Data = json.RawMessage(data)
+		page.Entries = append(page.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return Page{}, err
+	}
+
+	if len(page.Entries) > limit {
+		page.Entries = page.Entries[:limit]
+		last := page.Entries[limit-1]
+		page.NextCursor = Cursor{OccurredAt: last.OccurredAt, Type: last.Type, ID: last.ID}.Encode()
+	}
+
+	// Lets kinds finish their entries once the page is known
+	byType := map[string][]*Entry{}
+	for i := range page.Entries {
+		e := &page.Entries[i]
+		byType[e.Type] = append(byType[e.Type], e)
+	}
+	for t, entries := range byType {
+		if finish := kinds[t].Finish; finish != nil {
+			if err := finish(ctx, q, entries); err != nil {
+				return Page{}, fmt.Errorf("timeline %s: %w", t, err)
+			}
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,132 @@
+package timeline
+
+import (
+	"cmp"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+)
+
+// timelineDB answers List from entries the way MySQL runs its query: only the requested types,
+// after the cursor, newest first, limited
+func timelineDB(entries []Entry) *testdb.DB {
+	return &testdb.DB{Query: func(query string, args []driver.Value) (*testdb.Rows, error) {
+		if !strings.Contains(query, "ORDER BY e.occurred_at DESC, e.type DESC, e.id DESC") {
+			return nil, nil
+		}
+		types := map[driver.Value]bool{}
+		for i := 0; i < strings.Count(query, "SELECT ? AS type"); i++ {
+			types[args[2*i]] = true
+		}
+		var after *Entry
+		if strings.Contains(query, "e.type < ?") {
+			n := len(args)
+			after = &Entry{OccurredAt: args[n-6].(time.Time), Type: args[n-4].(string), ID: args[n-2].(int64)}
+		}
+
+		var matched []Entry
+		for _, e := range entries {
+			if types[e.Type] && (after == nil || compare(e, *after) < 0) {
+				matched = append(matched, e)
+			}
+		}
+		slices.SortFunc(matched, func(a, b Entry) int { return compare(b, a) })
+		matched = matched[:min(len(matched), int(args[len(args)-1].(int64)))]
+
+		rows := &testdb.Rows{}
+		for _, e := range matched {
+			rows.Values = append(rows.Values, []driver.Value{e.Type, e.ID, e.OccurredAt, []byte(`{}`)})
+		}
+		return rows, nil
+	}}
+}
+
+// compare orders entries by (occurred_at, type, id)
+func compare(a, b Entry) int {
+	return cmp.Or(a.OccurredAt.Compare(b.OccurredAt), cmp.Compare(a.Type, b.Type), cmp.Compare(a.ID, b.ID))
+}
+
+func TestListPagesNewestFirst(t *testing.T) {
+	noon := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Type: TypePointOfContact, ID: 4, OccurredAt: noon.Add(-time.Hour)},
+		// Three entries share a timestamp, a page boundary falls between them
+		{Type: TypeAccommodationGranted, ID: 9, OccurredAt: noon},
+		{Type: TypePointOfContact, ID: 5, OccurredAt: noon},
+		{Type: TypePointOfContact, ID: 6, OccurredAt: noon},
+		{Type: TypeSpecificDocumentation, ID: 2, OccurredAt: noon.Add(time.Hour)},
+		{Type: TypeSpecificDocumentation, ID: 3, OccurredAt: noon.Add(-2 * time.Hour)},
+	}
+	db := timelineDB(entries).Open(t)
+	types := []string{TypePointOfContact, TypeSpecificDocumentation, TypeAccommodationGranted}
+
+	var got []Entry
+	var cursor *Cursor
+	for pages := 0; ; pages++ {
+		if pages == len(entries) {
+			t.Fatal("the cursor never reached the last page")
+		}
+		page, err := List(context.Background(), db, 7, Filter{Types: types, After: cursor, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, page.Entries...)
+		if page.NextCursor == "" {
+			break
+		}
+		if cursor, err = ParseCursor(page.NextCursor); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []Entry{entries[4], entries[3], entries[2], entries[1], entries[0], entries[5]}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].Type != want[i].Type || got[i].ID != want[i].ID {
+			t.Fatalf("entry %d = %s %d, want %s %d", i, got[i].Type, got[i].ID, want[i].Type, want[i].ID)
+		}
+	}
+}
+
+func TestListFiltersTypes(t *testing.T) {
+	noon := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	d := timelineDB([]Entry{
+		{Type: TypePointOfContact, ID: 5, OccurredAt: noon},
+		{Type: TypeAccommodationGranted, ID: 9, OccurredAt: noon},
+	})
+	page, err := List(context.Background(), d.Open(t), 7, Filter{Types: []string{TypeAccommodationGranted}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Entries) != 1 || page.Entries[0].Type != TypeAccommodationGranted || page.NextCursor != "" {
+		t.Fatalf("page = %+v, want only the accommodation", page)
+	}
+	if d.Count("UNION ALL") != 0 {
+		t.Fatalf("types that were not asked for were selected:\n%s", d.Log())
+	}
+
+	if _, err := List(context.Background(), d.Open(t), 7, Filter{Types: []string{"nothing"}}); !errors.Is(err, ErrUnknownType) {
+		t.Fatalf("List of an unknown type = %v, want ErrUnknownType", err)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := Cursor{OccurredAt: time.Date(2026, 3, 2, 12, 0, 0, 1500, time.UTC), Type: TypePointOfContact, ID: 42}
+	parsed, err := ParseCursor(c.Encode())
+	if err != nil || !parsed.OccurredAt.Equal(c.OccurredAt) || parsed.Type != c.Type || parsed.ID != c.ID {
+		t.Fatalf("ParseCursor(Encode) = %+v, %v, want %+v", parsed, err, c)
+	}
+	for _, s := range []string{"", "not base64!", "MTox", "MTpQT0M6Mw"} {
+		if _, err := ParseCursor(s); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("ParseCursor(%q) = %v, want ErrInvalidCursor", s, err)
+		}
+	}
+}
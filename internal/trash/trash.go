@@ -0,0 +1,312 @@
+package trash
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/activity"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/deletion"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/docstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/docversion"
+)
+
+// Resource types that support soft deletion
+const (
+	TypeStudent               = "student"
+	TypeAdmin                 = "admin"
+	TypeSpecificDocumentation = "specific_documentation"
+	TypePersonalDocumentation = "personal_documentation"
+)
+
+// ErrUnknownType is returned for resource types that cannot be trashed
+var ErrUnknownType = errors.New("unknown trash type")
+
+// Item describes a trashed record
+type Item struct {
+	Type      string    `json:"type"`
+	ID        int       `json:"id"`
+	Label     string    `json:"label"`
+	DeletedAt time.Time `json:"deleted_at"`
+	DeletedBy *int      `json:"deleted_by,omitempty"`
+}
+
+// listQueries select trashed records of each type as (id, label, deleted_at, deleted_by)
+var listQueries = map[string]string{
+	TypeStudent: `
+		SELECT s.student_id, CONCAT(p.first_name, ' ', p.last_name), p.deleted_at, p.deleted_by
+		FROM student s
+		JOIN person p ON p.person_id = s.student_id
+		WHERE p.deleted_at IS NOT NULL
+	`,
+	TypeAdmin: `
+		SELECT a.admin_id, CONCAT(p.first_name, ' ', p.last_name), p.deleted_at, p.deleted_by
+		FROM admin a
+		JOIN person p ON p.person_id = a.admin_id
+		WHERE p.deleted_at IS NOT NULL
+	`,
+	TypeSpecificDocumentation: `
+		SELECT sd.specific_documentation_id, d.file_name, d.deleted_at, d.deleted_by
+		FROM specific_documentation sd
+		JOIN documentation d ON d.documentation_id = sd.specific_documentation_id
+		WHERE d.deleted_at IS NOT NULL
+	`,
+	TypePersonalDocumentation: `
+		SELECT pd.personal_documentation_id, d.file_name, d.deleted_at, d.deleted_by
+		FROM personal_documentation pd
+		JOIN documentation d ON d.documentation_id = pd.personal_documentation_id
+		WHERE d.deleted_at IS NOT NULL
+	`,
+}
+
+// restoreQueries clear the deletion markers of a single trashed record
+var restoreQueries = map[string]string{
+	TypeStudent: `
+		UPDATE person p
+		JOIN student s ON s.student_id = p.person_id
+		SET p.deleted_at = NULL, p.deleted_by = NULL
+		WHERE s.student_id = ? AND p.deleted_at IS NOT NULL
+	`,
+	TypeAdmin: `
+		UPDATE person p
+		JOIN admin a ON a.admin_id = p.person_id
+		SET p.deleted_at = NULL, p.deleted_by = NULL
+		WHERE a.admin_id = ? AND p.deleted_at IS NOT NULL
+	`,
+	TypeSpecificDocumentation: `
+		UPDATE documentation d
+		JOIN specific_documentation sd ON sd.specific_documentation_id = d.documentation_id
+		SET d.deleted_at = NULL, d.deleted_by = NULL
+		WHERE sd.specific_documentation_id = ? AND d.deleted_at IS NOT NULL
+	`,
+	TypePersonalDocumentation: `
+		UPDATE documentation d
+		JOIN personal_documentation pd ON pd.personal_documentation_id = d.documentation_id
+		SET d.deleted_at = NULL, d.deleted_by = NULL
+		WHERE pd.personal_documentation_id = ? AND d.deleted_at IS NOT NULL
+	`,
+}
+
+// List returns trashed records, optionally restricted to one type, newest first
+func List(ctx context.Context, db *sql.DB, itemType string) ([]Item, error) {
+	types := []string{TypeStudent, TypeAdmin, TypeSpecificDocumentation, TypePersonalDocumentation}
+	if itemType != "" {
+		if _, ok := listQueries[itemType]; !ok {
+			return nil, ErrUnknownType
+		}
+		types = []string{itemType}
+	}
+
+	items := make([]Item, 0)
+	for _, t := range types {
+		rows, err := db.QueryContext(ctx, listQueries[t])
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			item := Item{Type: t}
+			var deletedBy sql.NullInt64
+			if err := rows.Scan(&item.ID, &item.Label, &item.DeletedAt, &deletedBy); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if deletedBy.Valid {
+				id := int(deletedBy.Int64)
+				item.DeletedBy = &id
+			}
+			items = append(items, item)
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Newest first across all types
+	sort.SliceStable(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+
+	return items, nil
+}
+
+// Restore moves a trashed record back into the default queries
+func Restore(ctx context.Context, db *sql.DB, itemType string, id int) error {
+	query, ok := restoreQueries[itemType]
+	if !ok {
+		return ErrUnknownType
+	}
+
+	res, err := db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Purge permanently removes records that have been in the trash longer than the retention window.
+// A record that fails is logged and skipped so the others are still purged, the returned error
+// joins every failure. It returns the number of rows deleted.
+func Purge(ctx context.Context, db *sql.DB, retention time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-retention)
+	var total int64
+	var errs []error
+
+	// Students and admins are removed with all of their dependent data
+	for _, p := range []struct {
+		typeName string
+		table    string
+		remove   func(context.Context, *sql.DB, int, any) (*deletion.Plan, error)
+	}{
+		{TypeStudent, "student", deletion.DeleteStudent},
+		{TypeAdmin, "admin", deletion.DeleteAdmin},
+	} {
+		people, err := expiredPeople(ctx, db, p.table, cutoff)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("list expired %ss: %w", p.typeName, err))
+			continue
+		}
+		for _, person := range people {
+			plan, err := p.remove(ctx, db, person.id, person.deletedBy)
+			if err != nil {
+				log.Printf("Trash purge error for %s %d: %v\n", p.typeName, person.id, err)
+				errs = append(errs, fmt.Errorf("purge %s %d: %w", p.typeName, person.id, err))
+				continue
+			}
+			for _, n := range plan.Rows {
+				total += n
+			}
+		}
+	}
+
+	// Documents also lose their files once the rows are gone
+	for _, typeName := range []string{activity.TypeSpecificDocumentation, activity.TypePersonalDocumentation} {
+		n, err := purgeDocuments(ctx, db, typeName, cutoff)
+		total += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("purge %s: %w", typeName, err))
+		}
+	}
+
+	return total, errors.Join(errs...)
+}
+
+// purgeDocuments hard deletes expired documents of one activity type and then removes their files
+func purgeDocuments(ctx context.Context, db *sql.DB, typeName string, cutoff time.Time) (int64, error) {
+	// Collects the files of every version before the rows disappear
+	rows, err := db.QueryContext(ctx, `
+		SELECT d.storage_key, d.content_sha256
+		FROM documentation d
+		JOIN activity a ON a.activity_id = d.documentation_id
+		WHERE a.activity_type = ? AND d.deleted_at IS NOT NULL AND d.deleted_at < ?
+		UNION
+		SELECT v.storage_key, v.content_sha256
+		FROM documentation_version v
+		JOIN documentation d ON d.documentation_id = v.documentation_id
+		JOIN activity a ON a.activity_id = d.documentation_id
+		WHERE a.activity_type = ? AND d.deleted_at IS NOT NULL AND d.deleted_at < ?`, typeName, cutoff, typeName, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	var refs []docstore.Ref
+	for rows.Next() {
+		var key string
+		var digest sql.NullString
+		if err := rows.Scan(&key, &digest); err == nil && key != "" {
+			refs = append(refs, docstore.Ref{Key: key, Digest: digest.String})
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := activity.Delete(ctx, db, typeName, "d.deleted_at IS NOT NULL AND d.deleted_at < ?", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := docversion.DeleteOrphans(ctx, db); err != nil {
+		return rowsAffected, err
+	}
+
+	// Delete stored files no other document or version shares (after DB delete)
+	store, err := blobstore.Default()
+	if err != nil {
+		return rowsAffected, err
+	}
+	if err := docstore.Release(ctx, db, store, refs); err != nil {
+		log.Println("Warning: failed to delete files:", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// trashedPerson is a student or admin waiting to be purged
+type trashedPerson struct {
+	id        int
+	deletedBy sql.NullInt64
+}
+
+// expiredPeople lists trashed students or admins past the cutoff with the user who trashed them
+func expiredPeople(ctx context.Context, db *sql.DB, table string, cutoff time.Time) ([]trashedPerson, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT t.`+table+`_id, p.deleted_by
+		FROM `+table+` t
+		JOIN person p ON p.person_id = t.`+table+`_id
+		WHERE p.deleted_at IS NOT NULL AND p.deleted_at < ?`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var people []trashedPerson
+	for rows.Next() {
+		var p trashedPerson
+		if err := rows.Scan(&p.id, &p.deletedBy); err != nil {
+			return nil, err
+		}
+		people = append(people, p)
+	}
+	return people, rows.Err()
+}
+
+// StartPurger runs Purge on an interval until the context is cancelled
+func StartPurger(ctx context.Context, db *sql.DB, retention, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			n, err := Purge(ctx, db, retention)
+			if err != nil {
+				log.Println("Trash purge error:", err)
+			}
+			if n > 0 {
+				log.Printf("🗑️ Purged %d trashed rows older than %s\n", n, retention)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,102 @@
+package trash
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+)
+
+// trashDB answers queries by a substring of the SQL and fails the ones matching a substring of fail
+func trashDB(answers map[string][][]driver.Value, fail ...string) *testdb.DB {
+	return &testdb.DB{
+		Query: func(query string, _ []driver.Value) (*testdb.Rows, error) {
+			for _, match := range fail {
+				if strings.Contains(query, match) {
+					return nil, fmt.Errorf("fake: %s failed", match)
+				}
+			}
+			for match, rows := range answers {
+				if strings.Contains(query, match) {
+					return &testdb.Rows{Values: rows}, nil
+				}
+			}
+			if strings.Contains(query, "SELECT COUNT(*)") {
+				return testdb.Row(int64(1)), nil
+			}
+			return testdb.Empty(), nil
+		},
+		Exec: func(string, []driver.Value) (testdb.Result, error) {
+			return testdb.Result{}, nil
+		},
+	}
+}
+
+func TestListNewestFirstAcrossTypes(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 0, 0, 0, 0, time.UTC) }
+	fake := trashDB(map[string][][]driver.Value{
+		"FROM student s":                 {{int64(1), "Ann Lee", day(3), nil}, {int64(2), "Bo Diaz", day(1), nil}},
+		"FROM admin a":                   {{int64(9), "Cy Park", day(4), int64(1)}},
+		"FROM specific_documentation sd": {{int64(5), "notes.pdf", day(2), nil}},
+	})
+
+	items, err := List(context.Background(), fake.Open(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, item := range items {
+		got = append(got, fmt.Sprintf("%s %d", item.Type, item.ID))
+	}
+	want := "admin 9, student 1, specific_documentation 5, student 2"
+	if strings.Join(got, ", ") != want {
+		t.Fatalf("List = %s, want %s", strings.Join(got, ", "), want)
+	}
+}
+
+func TestPurgeCascadesAdminsAndKeepsGoing(t *testing.T) {
+	t.Setenv("DOCUMENT_STORAGE_DIR", t.TempDir())
+	// Listing expired students fails, admins and documents are still purged
+	fake := trashDB(map[string][][]driver.Value{
+		"FROM admin t":               {{int64(9), nil}},
+		"SELECT admin_id FROM admin": {{int64(9)}},
+	}, "FROM student t")
+
+	total, err := Purge(context.Background(), fake.Open(t), time.Hour)
+	if err == nil || !strings.Contains(err.Error(), "student") {
+		t.Fatalf("err = %v, want the student failure reported", err)
+	}
+	if total != int64(len(fakeAdminSteps)) {
+		t.Fatalf("total = %d, want %d", total, len(fakeAdminSteps))
+	}
+
+	executed := fake.Log()
+	for _, want := range append(fakeAdminSteps,
+		"INSERT INTO deletion_tombstone",
+		"DELETE a, d, sd FROM activity a",
+		"DELETE a, d, pd FROM activity a",
+	) {
+		if !strings.Contains(executed, want) {
+			t.Errorf("purge did not run %q, ran:\n%s", want, executed)
+		}
+	}
+	if strings.Contains(executed, "DELETE a, u, p") {
+		t.Errorf("admins were deleted without their references:\n%s", executed)
+	}
+}
+
+// fakeAdminSteps are the statements that remove admin 9 and everything that points at it
+var fakeAdminSteps = []string{
+	"DELETE FROM pinned WHERE admin_id = ?",
+	"DELETE FROM poc_admin WHERE admin_id = ?",
+	"UPDATE documentation SET uploaded_by = NULL WHERE uploaded_by = ?",
+	"UPDATE documentation_version SET uploaded_by = NULL WHERE uploaded_by = ?",
+	"DELETE FROM profile_history WHERE profile_type = 'admin' AND profile_id = ?",
+	"DELETE FROM users WHERE id = ?",
+	"DELETE FROM admin WHERE admin_id = ?",
+	"DELETE FROM person WHERE person_id = ?",
+}
@@ -0,0 +1,103 @@
+package uploadpolicy
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// sniffLen is how much of a file http.DetectContentType looks at
+const sniffLen = 512
+
+// Detect returns the type of the size bytes of r from their magic bytes, Unknown when they are
+// not recognised. Office documents are told apart by the entries of their ZIP container.
+func Detect(r io.ReaderAt, size int64) (string, error) {
+	head := make([]byte, sniffLen)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return PDF, nil
+	case bytes.HasPrefix(head, []byte("{\\rtf")):
+		return RTF, nil
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return TIFF, nil
+	case bytes.HasPrefix(head, []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1")):
+		return OLE, nil
+	case len(head) >= 12 && string(head[4:8]) == "ftyp" && isHEIFBrand(string(head[8:12])):
+		return HEIC, nil
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return detectZip(r, size), nil
+	}
+
+	// HTML and scripts come back as text/html and friends, which no allowlist should contain
+	return http.DetectContentType(head), nil
+}
+
+// isHEIFBrand reports whether an ISO base media file is a HEIF image rather than a video
+func isHEIFBrand(brand string) bool {
+	switch brand {
+	case "heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1":
+		return true
+	}
+	return false
+}
+
+// detectZip looks inside a ZIP archive for the entries that mark Office documents
+func detectZip(r io.ReaderAt, size int64) string {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return Unknown
+	}
+
+	contentTypes := false
+	var prefix string
+	for _, f := range archive.File {
+		switch {
+		case f.Name == "[Content_Types].xml":
+			contentTypes = true
+		case f.Name == "mimetype":
+			if t := readMimetype(f); t == ODT || t == ODS {
+				return t
+			}
+		case prefix == "":
+			if dir, _, ok := strings.Cut(f.Name, "/"); ok && (dir == "word" || dir == "xl" || dir == "ppt") {
+				prefix = dir
+			}
+		}
+	}
+	if contentTypes {
+		switch prefix {
+		case "word":
+			return DOCX
+		case "xl":
+			return XLSX
+		case "ppt":
+			return PPTX
+		}
+	}
+	return ZIP
+}
+
+// readMimetype reads the "mimetype" entry of an OpenDocument file
+func readMimetype(f *zip.File) string {
+	if f.UncompressedSize64 > 128 {
+		return ""
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return ""
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, 128))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
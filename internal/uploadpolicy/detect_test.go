@@ -0,0 +1,151 @@
+package uploadpolicy
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// zipOf builds an archive with the named entries, "mimetype" entries get the given content
+func zipOf(t *testing.T, mimetype string, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "mimetype" {
+			f.Write([]byte(mimetype))
+		} else {
+			f.Write([]byte("<xml/>"))
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetect(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"pdf", []byte("%PDF-1.7\n%âãÏÓ"), PDF},
+		{"rtf", []byte(`{\rtf1\ansi hello}`), RTF},
+		{"tiff little endian", []byte("II*\x00\x08\x00\x00\x00"), TIFF},
+		{"tiff big endian", []byte("MM\x00*\x00\x00\x00\x08"), TIFF},
+		{"legacy office", []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1\x00\x00"), OLE},
+		{"heic", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), HEIC},
+		{"mp4 is not heic", []byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00"), Unknown},
+		{"png", png, "image/png"},
+		{"plain text", []byte("Notes from the intake meeting"), "text/plain; charset=utf-8"},
+		{"html", []byte("<!DOCTYPE html><script>alert(1)</script>"), "text/html; charset=utf-8"},
+		{"docx", zipOf(t, "", "[Content_Types].xml", "_rels/.rels", "word/document.xml"), DOCX},
+		{"xlsx", zipOf(t, "", "[Content_Types].xml", "xl/workbook.xml"), XLSX},
+		{"pptx", zipOf(t, "", "[Content_Types].xml", "ppt/presentation.xml"), PPTX},
+		{"odt", zipOf(t, ODT, "mimetype", "content.xml"), ODT},
+		{"ods", zipOf(t, ODS, "mimetype", "content.xml"), ODS},
+		{"office folder without content types", zipOf(t, "", "word/document.xml"), ZIP},
+		{"other opendocument", zipOf(t, "application/vnd.oasis.opendocument.presentation", "mimetype"), ZIP},
+		{"plain zip", zipOf(t, "", "notes.txt"), ZIP},
+		{"broken zip", []byte("PK\x03\x04 not really a zip"), Unknown},
+		{"empty", nil, "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Detect(bytes.NewReader(tt.content), int64(len(tt.content)))
+			if err != nil || got != tt.want {
+				t.Fatalf("Detect = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	r, err := load("1KB", "medical=600B", "research=text/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadOnce.Do(func() {})
+	previous := loaded
+	loaded = r
+	t.Cleanup(func() { loaded = previous })
+
+	pdf := []byte("%PDF-1.7\n" + strings.Repeat("x", 50))
+	docx := zipOf(t, "", "[Content_Types].xml", "word/document.xml")
+	tests := []struct {
+		name    string
+		content []byte
+		kind    string
+		want    string
+		code    string
+	}{
+		{"allowed", pdf, "general", PDF, ""},
+		{"kind with its own list", docx, "medical", "", CodeFileTypeNotAllowed},
+		{"wildcard", []byte("plain notes"), "Research", "text/plain; charset=utf-8", ""},
+		{"too large for its kind", append(pdf, make([]byte, 600)...), "medical", "", CodeFileTooLarge},
+		{"too large overall", append(pdf, make([]byte, 1024)...), "general", "", CodeFileTooLarge},
+		{"empty", nil, "general", "", CodeEmptyFile},
+		{"unrecognised", []byte("\x00\x01\x02\x03binary"), "general", "", CodeUnrecognizedType},
+		{"html", []byte("<html><body>hi</body></html>"), "general", "", CodeFileTypeNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Validate(bytes.NewReader(tt.content), int64(len(tt.content)), tt.kind)
+			if tt.code == "" {
+				if err != nil || got != tt.want {
+					t.Fatalf("Validate = %q, %v; want %q", got, err, tt.want)
+				}
+				return
+			}
+			rejection, ok := err.(*Rejection)
+			if !ok || rejection.Code != tt.code {
+				t.Fatalf("Validate = %q, %v; want a %s rejection", got, err, tt.code)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]int64{"1048576": 1 << 20, "512KB": 512 << 10, "20mb": 20 << 20, " 1 GB ": 1 << 30, "10B": 10} {
+		if got, err := ParseSize(in); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "MB", "-1MB", "0", "1.5MB", "1TB"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) succeeded", in)
+		}
+	}
+	if _, err := load("20MB", "", "general=pdf"); err == nil {
+		t.Error("load accepted a type without a slash")
+	}
+}
+
+func TestFileName(t *testing.T) {
+	long := strings.Repeat("é", 200) + ".pdf"
+	tests := map[string]string{
+		"report.pdf":                     "report.pdf",
+		`C:\Users\ann\My  Report.pdf`:    "My Report.pdf",
+		"../../etc/passwd":               "passwd",
+		"  spaced\tname .pdf. ":          "spaced name .pdf",
+		"...hidden":                      "hidden",
+		"bad<>:\"|?*chars\x00\u202e.txt": "badchars.txt",
+		"":                               "document",
+		"...":                            "document",
+	}
+	for in, want := range tests {
+		if got := FileName(in); got != want {
+			t.Errorf("FileName(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := FileName(long); len(got) > maxFileName || !strings.HasSuffix(got, "é.pdf") {
+		t.Errorf("FileName of a long name = %q (%d bytes)", got, len(got))
+	}
+}
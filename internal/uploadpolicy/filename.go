@@ -0,0 +1,58 @@
+package uploadpolicy
+
+import (
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFileName is the longest stored file name in bytes
+const maxFileName = 255
+
+// FileName cleans a client supplied file name for storage and for Content-Disposition: directory
+// parts, control characters and characters Windows refuses are dropped, whitespace is collapsed
+// and overlong names are shortened keeping their extension. A name with nothing left becomes
+// "document".
+func FileName(name string) string {
+	// Browsers on Windows may send the full path
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = path.Base(name)
+
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToValidUTF8(name, "") {
+		switch {
+		case unicode.IsSpace(r):
+			space = b.Len() > 0
+			continue
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r) || strings.ContainsRune(`<>:"/|?*`, r):
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+
+	// Leading dots would hide the file, trailing dots and spaces are stripped by Windows
+	name = strings.TrimRight(strings.TrimLeft(b.String(), "."), ". ")
+	if name == "" {
+		return "document"
+	}
+	if len(name) <= maxFileName {
+		return name
+	}
+
+	ext := path.Ext(name)
+	if len(ext) > 16 {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(name, ext)
+	stem = stem[:maxFileName-len(ext)]
+	for !utf8.ValidString(stem) {
+		stem = stem[:len(stem)-1]
+	}
+	return strings.TrimRight(stem, ". ") + ext
+}
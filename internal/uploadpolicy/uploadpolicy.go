@@ -0,0 +1,330 @@
+// Package uploadpolicy decides which uploaded documents are accepted. The type of a file is
+// detected from its content, never taken from the client, and checked against the types and
+// size allowed for the kind of document: the doc_type of student documents, "personal" for
+// personal documents and "*" for anything without its own rule.
+//
+// Configuration comes from the environment:
+//
+//	UPLOAD_MAX_BYTES       size limit of kinds without their own, e.g. "20MB" (default), "512KB" or bytes
+//	UPLOAD_SIZE_LIMITS     semicolon-separated kind=size rules, e.g. "medical=10MB;personal=5MB"
+//	UPLOAD_ALLOWED_TYPES   semicolon-separated kind=type,type rules replacing the built-in ones of
+//	                       the same kind, e.g. "medical=application/pdf,image/*;*=application/pdf,text/plain"
+//
+// Types are media types without parameters, "image/*" allows every image type.
+package uploadpolicy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// Kinds with a meaning of their own
+const (
+	Default  = "*"
+	Personal = "personal"
+)
+
+// Detected types that http.DetectContentType does not know
+const (
+	PDF  = "application/pdf"
+	DOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	XLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	PPTX = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	ODT  = "application/vnd.oasis.opendocument.text"
+	ODS  = "application/vnd.oasis.opendocument.spreadsheet"
+	RTF  = "application/rtf"
+	HEIC = "image/heic"
+	TIFF = "image/tiff"
+	// OLE is the container of legacy Office files (.doc, .xls, .ppt)
+	OLE = "application/x-ole-storage"
+	ZIP = "application/zip"
+	// Unknown is the type of content that could not be recognised
+	Unknown = "application/octet-stream"
+)
+
+// DefaultTypes are the built-in allowlists, UPLOAD_ALLOWED_TYPES replaces them kind by kind
+var DefaultTypes = map[string][]string{
+	Default:   {PDF, "image/png", "image/jpeg", "image/gif", "image/webp", HEIC, TIFF, "text/plain", RTF, DOCX, XLSX, PPTX, ODT, ODS},
+	"medical": {PDF, "image/png", "image/jpeg", HEIC, TIFF},
+}
+
+// Error codes of rejected uploads
+const (
+	CodeMissingFile        = "missing_file"
+	CodeEmptyFile          = "empty_file"
+	CodeFileTooLarge       = "file_too_large"
+	CodeUnrecognizedType   = "unrecognized_file_type"
+	CodeFileTypeNotAllowed = "file_type_not_allowed"
+)
+
+// Rejection is an upload refused by the policy, Code is meant for clients to act on
+type Rejection struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (r *Rejection) Error() string {
+	return r.Message
+}
+
+// Policy is what is accepted for one kind of document
+type Policy struct {
+	Kind     string
+	Types    []string
+	MaxBytes int64
+}
+
+// Allows reports whether a file of the detected type may be stored
+func (p Policy) Allows(mimeType string) bool {
+	base := baseType(mimeType)
+	for _, allowed := range p.Types {
+		if allowed == base || strings.HasSuffix(allowed, "/*") && strings.HasPrefix(base, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// rules holds the configuration loaded from the environment
+type rules struct {
+	types    map[string][]string
+	sizes    map[string]int64
+	maxBytes int64
+}
+
+var (
+	loadOnce sync.Once
+	loaded   *rules
+	loadErr  error
+)
+
+// Load reads the configuration, so the server can refuse to start with a broken one
+func Load() error {
+	_, err := config()
+	return err
+}
+
+func config() (*rules, error) {
+	loadOnce.Do(func() {
+		loaded, loadErr = load(
+			utils.Env("UPLOAD_MAX_BYTES", "20MB"),
+			utils.Env("UPLOAD_SIZE_LIMITS", ""),
+			utils.Env("UPLOAD_ALLOWED_TYPES", ""),
+		)
+	})
+	return loaded, loadErr
+}
+
+func load(maxBytes, sizeLimits, allowedTypes string) (*rules, error) {
+	c := &rules{types: map[string][]string{}, sizes: map[string]int64{}}
+	for kind, types := range DefaultTypes {
+		c.types[kind] = types
+	}
+
+	n, err := ParseSize(maxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("uploadpolicy: UPLOAD_MAX_BYTES: %w", err)
+	}
+	c.maxBytes = n
+
+	for kind, value := range splitRules(sizeLimits) {
+		n, err := ParseSize(value)
+		if err != nil {
+			return nil, fmt.Errorf("uploadpolicy: UPLOAD_SIZE_LIMITS %s: %w", kind, err)
+		}
+		c.sizes[kind] = n
+	}
+
+	for kind, value := range splitRules(allowedTypes) {
+		var types []string
+		for _, t := range strings.Split(value, ",") {
+			t = strings.ToLower(strings.TrimSpace(t))
+			if t == "" {
+				continue
+			}
+			if !strings.Contains(t, "/") {
+				return nil, fmt.Errorf("uploadpolicy: UPLOAD_ALLOWED_TYPES %s: %q is not a media type", kind, t)
+			}
+			types = append(types, t)
+		}
+		c.types[kind] = types
+	}
+	return c, nil
+}
+
+// splitRules parses "kind=value;kind=value", kinds are case-insensitive
+func splitRules(s string) map[string]string {
+	out := map[string]string{}
+	for _, rule := range strings.Split(s, ";") {
+		kind, value, ok := strings.Cut(rule, "=")
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		if !ok || kind == "" {
+			continue
+		}
+		out[kind] = strings.TrimSpace(value)
+	}
+	return out
+}
+
+// ParseSize reads a byte count such as "1048576", "512KB", "20MB" or "1GB"
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		mult   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			value, mult = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix)), unit.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+// For returns the policy of a kind of document
+func For(kind string) (Policy, error) {
+	c, err := config()
+	if err != nil {
+		return Policy{}, err
+	}
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	p := Policy{Kind: kind, Types: c.types[Default], MaxBytes: c.maxBytes}
+	if types, ok := c.types[kind]; ok {
+		p.Types = types
+	}
+	if n, ok := c.sizes[Default]; ok {
+		p.MaxBytes = n
+	}
+	if n, ok := c.sizes[kind]; ok {
+		p.MaxBytes = n
+	}
+	return p, nil
+}
+
+// MaxBytes is the largest file any kind accepts, request bodies are cut off a little above it
+func MaxBytes() (int64, error) {
+	c, err := config()
+	if err != nil {
+		return 0, err
+	}
+	max := c.maxBytes
+	for _, n := range c.sizes {
+		if n > max {
+			max = n
+		}
+	}
+	return max, nil
+}
+
+// formOverhead leaves room for the other form fields and the multipart framing
+const formOverhead = 1 << 20
+
+// LimitBody caps the request body at what the largest accepted upload needs
+func LimitBody(w http.ResponseWriter, r *http.Request) error {
+	max, err := MaxBytes()
+	if err != nil {
+		return err
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, max+formOverhead)
+	return nil
+}
+
+// FormError turns a failed ParseMultipartForm or FormFile into a rejection when the client is at
+// fault for it, other errors are returned unchanged
+func FormError(err error) error {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return &Rejection{http.StatusRequestEntityTooLarge, CodeFileTooLarge,
+			fmt.Sprintf("Upload is larger than the %s allowed", FormatSize(tooLarge.Limit-formOverhead))}
+	case errors.Is(err, http.ErrMissingFile):
+		return &Rejection{http.StatusBadRequest, CodeMissingFile, "Missing file in request"}
+	}
+	return err
+}
+
+// File is an uploaded file, multipart.File satisfies it
+type File interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+// Validate checks an uploaded file of size bytes against the policy of kind and returns its
+// detected type, which is what gets stored. Refusals are *Rejection errors.
+func Validate(file File, size int64, kind string) (string, error) {
+	p, err := For(kind)
+	if err != nil {
+		return "", err
+	}
+	if size == 0 {
+		return "", &Rejection{http.StatusBadRequest, CodeEmptyFile, "Uploaded file is empty"}
+	}
+	if size > p.MaxBytes {
+		return "", &Rejection{http.StatusRequestEntityTooLarge, CodeFileTooLarge,
+			fmt.Sprintf("File is larger than the %s allowed for %s documents", FormatSize(p.MaxBytes), label(p.Kind))}
+	}
+
+	mimeType, err := Detect(file, size)
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if !p.Allows(mimeType) {
+		if mimeType == Unknown {
+			return "", &Rejection{http.StatusUnsupportedMediaType, CodeUnrecognizedType,
+				fmt.Sprintf("The file type could not be recognised, %s documents may be %s", label(p.Kind), strings.Join(p.Types, ", "))}
+		}
+		return "", &Rejection{http.StatusUnsupportedMediaType, CodeFileTypeNotAllowed,
+			fmt.Sprintf("Files of type %s are not accepted for %s documents, allowed are %s", baseType(mimeType), label(p.Kind), strings.Join(p.Types, ", "))}
+	}
+	return mimeType, nil
+}
+
+// label names a kind in messages
+func label(kind string) string {
+	if kind == "" || kind == Default {
+		return "these"
+	}
+	return strconv.Quote(kind)
+}
+
+// baseType drops the parameters of a media type, "text/plain; charset=utf-8" becomes "text/plain"
+func baseType(mimeType string) string {
+	if base, _, err := mime.ParseMediaType(mimeType); err == nil {
+		return base
+	}
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
+
+// FormatSize writes a byte count the way limits are configured
+func FormatSize(n int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		switch {
+		case n < unit.size:
+			continue
+		case n%unit.size == 0:
+			return fmt.Sprintf("%d%s", n/unit.size, unit.suffix)
+		}
+		return fmt.Sprintf("%.1f%s", float64(n)/float64(unit.size), unit.suffix)
+	}
+	return fmt.Sprintf("%dB", n)
+}
@@ -3,6 +3,8 @@ package utils
 import (
 	"time"
 
+	"crypto/hmac"
+	"crypto/sha256"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -30,3 +32,43 @@ func CreateJWT(userID int, role string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(JwtSecret)
 }
+
+// StreamTicketTTL is how long a stream ticket can be used to open an event stream
+const StreamTicketTTL = 30 * time.Second
+
+// streamTicketKey signs stream tickets. It is derived from JwtSecret but differs from it, so a
+// ticket, which travels in a URL and may end up in access logs, never works as a login token.
+func streamTicketKey() []byte {
+	mac := hmac.New(sha256.New, JwtSecret)
+	mac.Write([]byte("piconex stream ticket"))
+	return mac.Sum(nil)
+}
+
+// CreateStreamTicket returns a short-lived token that opens an event stream for a user
+func CreateStreamTicket(userID int, role string) (string, time.Time, error) {
+	expiration := time.Now().Add(StreamTicketTTL)
+	claims := &Claims{
+		UserID: userID,
+		Role:   role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiration),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	ticket, err := token.SignedString(streamTicketKey())
+	return ticket, expiration, err
+}
+
+// parseStreamTicket returns the claims of a valid, unexpired stream ticket
+func parseStreamTicket(ticket string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(ticket, claims, func(token *jwt.Token) (interface{}, error) {
+		return streamTicketKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// whoami answers with the user and role the middleware stored
+var whoami = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, map[string]any{"user_id": r.Context().Value(UserIDKey), "role": r.Context().Value(RoleKey)})
+})
+
+func openStream(h http.Handler, url, bearer string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, url, nil)
+	if bearer != "" {
+		r.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestStreamTicket(t *testing.T) {
+	stream := QueryTokenMiddleware(whoami)
+	ticket, expiresAt, err := CreateStreamTicket(4, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(expiresAt) > StreamTicketTTL {
+		t.Fatalf("ticket expires at %v, later than the TTL", expiresAt)
+	}
+
+	w := openStream(stream, "/activity/stream?ticket="+ticket, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"user_id": 4`) {
+		t.Fatalf("stream with a ticket = %d %s", w.Code, w.Body)
+	}
+
+	// The login token still works as a header, never in the URL
+	login, err := CreateJWT(4, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := openStream(stream, "/activity/stream", login); w.Code != http.StatusOK {
+		t.Fatalf("stream with the Authorization header = %d", w.Code)
+	}
+	for _, url := range []string{"/activity/stream?ticket=" + login, "/activity/stream?access_token=" + login} {
+		if w := openStream(stream, url, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s = %d, want 401", url, w.Code)
+		}
+	}
+
+	// A ticket is not a login token
+	if w := openStream(AuthMiddleware(whoami), "/student", ticket); w.Code != http.StatusUnauthorized {
+		t.Fatalf("ticket as a bearer token = %d, want 401", w.Code)
+	}
+}
+
+func TestExpiredStreamTicket(t *testing.T) {
+	claims := &Claims{UserID: 4, Role: "admin", RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Second)),
+	}}
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(streamTicketKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := openStream(QueryTokenMiddleware(whoami), "/activity/stream?ticket="+expired, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expired ticket = %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Env returns the environment variable or the fallback when it is unset
+func Env(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// EnvInt returns the environment variable as an integer or the fallback when it is unset or invalid
+func EnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %d\n", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// EnvDuration returns the environment variable as a duration (e.g. "90s", "1h") or the fallback
+func EnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s\n", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// DSN returns the MySQL data source name, overridable with DATABASE_DSN
+func DSN() string {
+	return Env("DATABASE_DSN", "piconex:pjaplmTabs7!@tcp(178.156.189.138:3306)/piconexdb?parseTime=true")
+}
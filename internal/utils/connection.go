@@ -1,11 +1,20 @@
 package utils
 
 import (
+	"context"
 	"database/sql"
 
-	_ "github.com/go-sql-driver/mysql"
+	"errors"
+	"github.com/go-sql-driver/mysql"
 )
 
+// DBTX is satisfied by both *sql.DB and *sql.Tx so helpers can run inside or outside a transaction
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 func Connect(dataSourceName string) (*sql.DB, error) {
 	db, err := sql.Open("mysql", dataSourceName)
 
@@ -20,3 +29,10 @@ func Connect(dataSourceName string) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// IsDuplicateEntry reports whether err is MySQL's duplicate entry error (1062), returned when a
+// write would break a unique key such as person.email_index
+func IsDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
@@ -5,8 +5,9 @@ import "net/http"
 func WithCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Accept, If-Match, If-None-Match, X-Request-ID, Last-Event-ID, Idempotency-Key")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-ID, Content-Disposition, Idempotent-Replayed")
 
 		// Handle preflight requests quickly
 		if r.Method == http.MethodOptions {
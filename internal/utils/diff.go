@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// JSONDiff lists the top-level fields that differ between two JSON objects as {field: {before, after}}
+func JSONDiff(before, after json.RawMessage) json.RawMessage {
+	var b, a map[string]json.RawMessage
+	json.Unmarshal(before, &b)
+	json.Unmarshal(after, &a)
+	if b == nil && a == nil {
+		return nil
+	}
+
+	type change struct {
+		Before json.RawMessage `json:"before"`
+		After  json.RawMessage `json:"after"`
+	}
+	changes := map[string]change{}
+	for key, value := range b {
+		if !jsonEqual(value, a[key]) {
+			changes[key] = change{Before: value, After: orNull(a[key])}
+		}
+	}
+	for key, value := range a {
+		if _, seen := b[key]; !seen {
+			changes[key] = change{Before: json.RawMessage("null"), After: value}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	out, err := json.Marshal(changes)
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return bytes.Equal(a, b)
+	}
+	xb, _ := json.Marshal(x)
+	yb, _ := json.Marshal(y)
+	return bytes.Equal(xb, yb)
+}
+
+func orNull(raw json.RawMessage) json.RawMessage {
+	if raw == nil {
+		return json.RawMessage("null")
+	}
+	return raw
+}
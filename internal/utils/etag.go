@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ETag formats a strong entity tag from a resource ID and its row version
+func ETag(id, version int) string {
+	return fmt.Sprintf("\"%d-%d\"", id, version)
+}
+
+// LockVersion reads and locks the row version of a resource inside a transaction
+func LockVersion(ctx context.Context, tx *sql.Tx, table, idColumn string, id int) (int, error) {
+	var version int
+	query := fmt.Sprintf("SELECT version FROM %s WHERE %s = ? FOR UPDATE", table, idColumn)
+	err := tx.QueryRowContext(ctx, query, id).Scan(&version)
+	return version, err
+}
+
+// LockLiveVersion is LockVersion for soft deletable resources, rows whose parent is in the trash
+// are reported as sql.ErrNoRows
+func LockLiveVersion(ctx context.Context, tx *sql.Tx, table, idColumn, parentTable, parentColumn string, id int) (int, error) {
+	var version int
+	query := fmt.Sprintf(
+		"SELECT t.version FROM %s t JOIN %s p ON p.%s = t.%s WHERE t.%s = ? AND p.deleted_at IS NULL FOR UPDATE",
+		table, parentTable, parentColumn, idColumn, idColumn,
+	)
+	err := tx.QueryRowContext(ctx, query, id).Scan(&version)
+	return version, err
+}
+
+// CheckIfMatch enforces the If-Match precondition and writes a 412 response when it fails
+func CheckIfMatch(w http.ResponseWriter, r *http.Request, current string) bool {
+	header := r.Header.Get("If-Match")
+
+	// No precondition means last write wins
+	if header == "" || strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	// If-Match uses strong comparison so weak tags never match
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == current {
+			return true
+		}
+	}
+
+	WriteError(w, http.StatusPreconditionFailed, "Resource has been modified, reload and try again")
+	log.Printf("Precondition failed: If-Match %s does not match %s\n", header, current)
+	return false
+}
+
+// ConditionalGetMiddleware adds ETags to JSON GET responses and answers If-None-Match with 304
+func ConditionalGetMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only safe reads can be answered from the client's cache
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &conditionalWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+
+		// Streamed responses were already written through
+		if cw.passthrough {
+			return
+		}
+		if !cw.wroteHeader {
+			cw.status = http.StatusOK
+		}
+
+		// Handlers may set a version based tag, otherwise the body is hashed
+		if cw.status == http.StatusOK {
+			etag := w.Header().Get("ETag")
+			if etag == "" {
+				sum := sha256.Sum256(cw.body.Bytes())
+				etag = "W/\"" + hex.EncodeToString(sum[:16]) + "\""
+				w.Header().Set("ETag", etag)
+			}
+
+			if noneMatch(r.Header.Get("If-None-Match"), etag) {
+				w.Header().Del("Content-Type")
+				w.Header().Del("Content-Length")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+
+		w.WriteHeader(cw.status)
+		w.Write(cw.body.Bytes())
+	})
+}
+
+// noneMatch reports whether an If-None-Match header matches the tag using weak comparison
+func noneMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	want := strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionalWriter buffers JSON bodies and passes every other content type straight through
+type conditionalWriter struct {
+	http.ResponseWriter
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+	passthrough bool
+}
+
+func (cw *conditionalWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+
+	// Files and streams are never buffered
+	if !strings.HasPrefix(cw.Header().Get("Content-Type"), "application/json") {
+		cw.passthrough = true
+		cw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (cw *conditionalWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.passthrough {
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.body.Write(b)
+}
+
+// Flush keeps streaming responses working behind the middleware
+func (cw *conditionalWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok && cw.passthrough {
+		f.Flush()
+	}
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestETag(t *testing.T) {
+	if got := ETag(12, 3); got != `"12-3"` {
+		t.Fatalf("ETag(12, 3) = %s", got)
+	}
+	if ETag(12, 3) == ETag(12, 4) || ETag(1, 23) == ETag(12, 3) {
+		t.Fatal("different versions share a tag")
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	current := ETag(7, 2)
+	tests := []struct {
+		header string
+		ok     bool
+	}{
+		{"", true},
+		{"*", true},
+		{current, true},
+		{`"7-1", ` + current, true},
+		{`"7-1"`, false},
+		// Weak tags never satisfy If-Match
+		{"W/" + current, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/students/7", nil)
+		if tt.header != "" {
+			r.Header.Set("If-Match", tt.header)
+		}
+		w := httptest.NewRecorder()
+		if ok := CheckIfMatch(w, r, current); ok != tt.ok {
+			t.Errorf("CheckIfMatch(%q) = %v, want %v", tt.header, ok, tt.ok)
+		}
+		if !tt.ok && w.Code != http.StatusPreconditionFailed {
+			t.Errorf("CheckIfMatch(%q) answered %d, want 412", tt.header, w.Code)
+		}
+		if tt.ok && w.Code != http.StatusOK {
+			t.Errorf("CheckIfMatch(%q) wrote a %d response", tt.header, w.Code)
+		}
+	}
+}
+
+// conditionalGet runs a request through ConditionalGetMiddleware
+func conditionalGet(handler http.HandlerFunc, method, ifNoneMatch string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/students/7", nil)
+	if ifNoneMatch != "" {
+		r.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	w := httptest.NewRecorder()
+	ConditionalGetMiddleware(handler).ServeHTTP(w, r)
+	return w
+}
+
+func TestConditionalGetVersionTag(t *testing.T) {
+	versioned := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", ETag(7, 2))
+		WriteJSON(w, http.StatusOK, map[string]int{"student_id": 7})
+	}
+
+	w := conditionalGet(versioned, http.MethodGet, "")
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"7-2"` || !strings.Contains(w.Body.String(), "student_id") {
+		t.Fatalf("first GET = %d %q %s", w.Code, w.Header().Get("ETag"), w.Body)
+	}
+
+	// A matching tag, also sent weak or among others, is answered without a body
+	for _, header := range []string{`"7-2"`, `W/"7-2"`, `"7-1", "7-2"`, "*"} {
+		w = conditionalGet(versioned, http.MethodGet, header)
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+			t.Errorf("If-None-Match %s = %d with %q", header, w.Code, w.Body)
+		}
+		if w.Header().Get("ETag") != `"7-2"` {
+			t.Errorf("If-None-Match %s dropped the ETag", header)
+		}
+	}
+
+	if w = conditionalGet(versioned, http.MethodGet, `"7-1"`); w.Code != http.StatusOK {
+		t.Fatalf("a stale tag = %d, want 200", w.Code)
+	}
+}
+
+func TestConditionalGetWeakFallback(t *testing.T) {
+	body := "ann"
+	list := func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, []string{body})
+	}
+
+	w := conditionalGet(list, http.MethodGet, "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("GET without a version = %d with ETag %q, want a weak tag", w.Code, etag)
+	}
+	if again := conditionalGet(list, http.MethodGet, ""); again.Header().Get("ETag") != etag {
+		t.Fatal("the same body got a different tag")
+	}
+	if w = conditionalGet(list, http.MethodGet, etag); w.Code != http.StatusNotModified {
+		t.Fatalf("If-None-Match with the weak tag = %d, want 304", w.Code)
+	}
+
+	// A changed body gets a new tag
+	body = "bo"
+	if w = conditionalGet(list, http.MethodGet, etag); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatalf("changed body = %d with ETag %q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestConditionalGetPassesThrough(t *testing.T) {
+	// Errors are never answered from the cache
+	failing := func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, http.StatusNotFound, "Student not found")
+	}
+	if w := conditionalGet(failing, http.MethodGet, "*"); w.Code != http.StatusNotFound || w.Header().Get("ETag") != "" {
+		t.Fatalf("error response = %d with ETag %q", w.Code, w.Header().Get("ETag"))
+	}
+
+	// Other methods and non-JSON bodies are not tagged
+	json := func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, map[string]int{"student_id": 7})
+	}
+	if w := conditionalGet(json, http.MethodPost, "*"); w.Code != http.StatusOK || w.Header().Get("ETag") != "" {
+		t.Fatalf("POST = %d with ETag %q", w.Code, w.Header().Get("ETag"))
+	}
+	file := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF"))
+	}
+	if w := conditionalGet(file, http.MethodGet, ""); w.Body.String() != "%PDF" || w.Header().Get("ETag") != "" {
+		t.Fatalf("file = %q with ETag %q", w.Body, w.Header().Get("ETag"))
+	}
+}
@@ -23,3 +23,8 @@ func WriteJSON(w http.ResponseWriter, status int, data interface{}) {
 func WriteError(w http.ResponseWriter, status int, message string) {
 	WriteJSON(w, status, map[string]string{"error": message})
 }
+
+// WriteErrorCode is WriteError with a machine-readable code clients can branch on
+func WriteErrorCode(w http.ResponseWriter, status int, code, message string) {
+	WriteJSON(w, status, map[string]string{"error": message, "code": code})
+}
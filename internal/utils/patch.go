@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// MergePatchContentType is the media type defined by RFC 7396
+const MergePatchContentType = "application/merge-patch+json"
+
+// ErrUnsupportedPatchType is returned when a PATCH body is not JSON Merge Patch
+var ErrUnsupportedPatchType = errors.New("unsupported patch content type")
+
+// ErrPatchNotObject is returned when a PATCH body is valid JSON but not an object
+var ErrPatchNotObject = errors.New("patch must be a JSON object")
+
+// ReadMergePatch reads a JSON Merge Patch document from the request body. Besides the RFC 7396
+// media type it accepts plain application/json and a missing Content-Type: the frontend's request
+// helper sends every body as application/json, and a merge patch is an ordinary JSON object, so the
+// two cannot be told apart or misread. Any other media type, such as JSON Patch
+// (application/json-patch+json), is refused rather than applied with the wrong semantics.
+func ReadMergePatch(r *http.Request) ([]byte, error) {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || (mediaType != MergePatchContentType && mediaType != "application/json") {
+			return nil, ErrUnsupportedPatchType
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// The patch itself must be a JSON object, a top-level null would erase the whole resource
+	var patch map[string]interface{}
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return nil, err
+	}
+	if patch == nil {
+		return nil, ErrPatchNotObject
+	}
+
+	return body, nil
+}
+
+// MergePatch applies an RFC 7396 JSON Merge Patch to the original document
+func MergePatch(original, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(original, &target); err != nil {
+		return nil, err
+	}
+
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mergeValue(target, p))
+}
+
+// ApplyMergePatch merges the patch into current and decodes the result into dst
+func ApplyMergePatch(current interface{}, patch []byte, dst interface{}) error {
+	original, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+
+	merged, err := MergePatch(original, patch)
+	if err != nil {
+		return err
+	}
+
+	// Rejects members that do not exist on the resource
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(dst)
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	// A non-object patch replaces the target entirely
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+
+	for key, value := range patchObj {
+		// null removes the member, anything else is merged recursively
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = mergeValue(targetObj[key], value)
+	}
+
+	return targetObj
+}
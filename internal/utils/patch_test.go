@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name, original, patch, want string
+	}{
+		{"replaces a member", `{"a":1,"b":2}`, `{"a":3}`, `{"a":3,"b":2}`},
+		{"adds a member", `{"a":1}`, `{"b":2}`, `{"a":1,"b":2}`},
+		{"null deletes a member", `{"a":1,"b":2}`, `{"a":null}`, `{"b":2}`},
+		{"null on a missing member", `{"a":1}`, `{"b":null}`, `{"a":1}`},
+		{"merges nested objects", `{"a":{"b":1,"c":2}}`, `{"a":{"b":3,"c":null}}`, `{"a":{"b":3}}`},
+		{"object replaces a scalar", `{"a":1}`, `{"a":{"b":2}}`, `{"a":{"b":2}}`},
+		{"arrays are replaced", `{"a":[1,2,3]}`, `{"a":[4]}`, `{"a":[4]}`},
+		{"array members are not merged", `{"a":[{"b":1}]}`, `{"a":[{"c":2}]}`, `{"a":[{"c":2}]}`},
+		{"empty patch changes nothing", `{"a":1}`, `{}`, `{"a":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.original), []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("MergePatch(%s, %s) = %s, want %s", tt.original, tt.patch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	type contact struct {
+		Name     string   `json:"name"`
+		Email    *string  `json:"email"`
+		Duration int      `json:"duration"`
+		Tags     []string `json:"tags"`
+	}
+	email := "ann@example.edu"
+	current := contact{Name: "Ann", Email: &email, Duration: 30, Tags: []string{"a", "b"}}
+
+	var got contact
+	if err := ApplyMergePatch(current, []byte(`{"duration":45,"email":null,"tags":["c"]}`), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Ann" || got.Email != nil || got.Duration != 45 || strings.Join(got.Tags, ",") != "c" {
+		t.Fatalf("merged = %+v", got)
+	}
+
+	// Members the resource does not have are rejected instead of ignored
+	if err := ApplyMergePatch(current, []byte(`{"file_path":"/etc/passwd"}`), &got); err == nil ||
+		!strings.Contains(err.Error(), "unknown field") {
+		t.Fatalf("unknown member error = %v", err)
+	}
+	// The merged result still has to fit the resource's types
+	var typeErr *json.UnmarshalTypeError
+	if err := ApplyMergePatch(current, []byte(`{"duration":"long"}`), &got); !errors.As(err, &typeErr) {
+		t.Fatalf("mistyped member error = %v", err)
+	}
+}
+
+func TestReadMergePatch(t *testing.T) {
+	tests := []struct {
+		contentType, body string
+		err               error
+	}{
+		{MergePatchContentType, `{"a":1}`, nil},
+		{MergePatchContentType + "; charset=utf-8", `{"a":1}`, nil},
+		{"application/json", `{"a":1}`, nil},
+		{"", `{"a":1}`, nil},
+		{"application/json-patch+json", `[{"op":"remove","path":"/a"}]`, ErrUnsupportedPatchType},
+		{"text/plain", `{"a":1}`, ErrUnsupportedPatchType},
+		{"not a media type;", `{"a":1}`, ErrUnsupportedPatchType},
+		{MergePatchContentType, `null`, ErrPatchNotObject},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPatch, "/students/1", strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		body, err := ReadMergePatch(r)
+		if err != tt.err {
+			t.Errorf("ReadMergePatch(%q, %s) error = %v, want %v", tt.contentType, tt.body, err, tt.err)
+		}
+		if err == nil && string(body) != tt.body {
+			t.Errorf("ReadMergePatch(%q) = %s, want the body", tt.contentType, body)
+		}
+	}
+
+	// Bodies that are not a JSON object are refused
+	for _, body := range []string{`[1,2]`, `"a"`, `{"a":`} {
+		r := httptest.NewRequest(http.MethodPatch, "/students/1", strings.NewReader(body))
+		r.Header.Set("Content-Type", MergePatchContentType)
+		if _, err := ReadMergePatch(r); err == nil {
+			t.Errorf("ReadMergePatch accepted %s", body)
+		}
+	}
+}
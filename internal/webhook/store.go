@@ -0,0 +1,225 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Subscription is an admin-managed webhook endpoint. The secret is only returned when it is created.
+type Subscription struct {
+	WebhookID int       `json:"webhook_id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy *int      `json:"created_by"`
+}
+
+// Delivery is one event sent to one subscription
+type Delivery struct {
+	DeliveryID     int64      `json:"delivery_id"`
+	EventID        int64      `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	WebhookID      int        `json:"webhook_id"`
+	URL            string     `json:"url"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at"`
+	LastStatusCode *int       `json:"last_status_code"`
+	LastError      *string    `json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+// DeliveryFilter narrows the delivery listing, zero values match everything
+type DeliveryFilter struct {
+	Status    string
+	WebhookID int
+	Limit     int
+	Offset    int
+}
+
+const subscriptionColumns = "webhook_id, url, events, active, created_at, created_by"
+
+func scanSubscription(row interface{ Scan(...any) error }) (Subscription, error) {
+	var s Subscription
+	var events string
+	err := row.Scan(&s.WebhookID, &s.URL, &events, &s.Active, &s.CreatedAt, &s.CreatedBy)
+	s.Events = strings.Split(events, ",")
+	return s, err
+}
+
+// Subscriptions lists every subscription
+func Subscriptions(ctx context.Context, db *sql.DB) ([]Subscription, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+subscriptionColumns+" FROM webhook_subscription ORDER BY webhook_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := make([]Subscription, 0)
+	for rows.Next() {
+		s, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// GetSubscription returns one subscription, sql.ErrNoRows when it does not exist
+func GetSubscription(ctx context.Context, db *sql.DB, id int) (Subscription, error) {
+	return scanSubscription(db.QueryRowContext(ctx, "SELECT "+subscriptionColumns+" FROM webhook_subscription WHERE webhook_id = ?", id))
+}
+
+// CreateSubscription stores a subscription and sets its ID and creation time
+func CreateSubscription(ctx context.Context, db *sql.DB, s *Subscription) error {
+	s.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	res, err := db.ExecContext(ctx,
+		"INSERT INTO webhook_subscription (url, secret, events, active, created_at, created_by) VALUES (?, ?, ?, ?, ?, ?)",
+		s.URL, s.Secret, strings.Join(s.Events, ","), s.Active, s.CreatedAt, s.CreatedBy,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	s.WebhookID = int(id)
+	return err
+}
+
+// UpdateSubscription changes the URL, events and active flag, reporting whether the subscription exists
+func UpdateSubscription(ctx context.Context, db *sql.DB, s Subscription) (bool, error) {
+	_, err := db.ExecContext(ctx,
+		"UPDATE webhook_subscription SET url = ?, events = ?, active = ? WHERE webhook_id = ?",
+		s.URL, strings.Join(s.Events, ","), s.Active, s.WebhookID,
+	)
+	if err != nil {
+		return false, err
+	}
+	// MySQL reports unchanged rows as unaffected, so existence is checked separately
+	var exists bool
+	err = db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM webhook_subscription WHERE webhook_id = ?)", s.WebhookID).Scan(&exists)
+	return exists, err
+}
+
+// DeleteSubscription removes a subscription and its deliveries
+func DeleteSubscription(ctx context.Context, db *sql.DB, id int) (int64, error) {
+	res, err := db.ExecContext(ctx, "DELETE FROM webhook_subscription WHERE webhook_id = ?", id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Deliveries lists deliveries matching the filter, newest first. Status "dead" is the dead-letter view.
+func Deliveries(ctx context.Context, db *sql.DB, f DeliveryFilter) ([]Delivery, error) {
+	query := `
+		SELECT d.delivery_id, d.event_id, e.event_type, d.webhook_id, s.url, d.status, d.attempts,
+			d.next_attempt_at, d.last_attempt_at, d.last_status_code, d.last_error, d.delivered_at
+		FROM webhook_delivery d
+		JOIN webhook_event e ON e.event_id = d.event_id
+		JOIN webhook_subscription s ON s.webhook_id = d.webhook_id
+		WHERE 1=1`
+	args := []any{}
+	if f.Status != "" {
+		query += " AND d.status = ?"
+		args = append(args, f.Status)
+	}
+	if f.WebhookID != 0 {
+		query += " AND d.webhook_id = ?"
+		args = append(args, f.WebhookID)
+	}
+	if f.Limit <= 0 || f.Limit > 1000 {
+		f.Limit = 100
+	}
+	query += " ORDER BY d.delivery_id DESC LIMIT ? OFFSET ?"
+	args = append(args, f.Limit, f.Offset)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]Delivery, 0)
+	for rows.Next() {
+		var d Delivery
+		if err := rows.Scan(&d.DeliveryID, &d.EventID, &d.EventType, &d.WebhookID, &d.URL, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.LastAttemptAt, &d.LastStatusCode, &d.LastError, &d.DeliveredAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// Retry puts a dead delivery back in the queue with a fresh attempt budget, reporting whether it was dead
+func Retry(ctx context.Context, db *sql.DB, deliveryID int64) (bool, error) {
+	res, err := db.ExecContext(ctx, `
+		UPDATE webhook_delivery
+		SET status = ?, attempts = 0, next_attempt_at = ?, last_error = NULL
+		WHERE delivery_id = ? AND status = ?`,
+		StatusPending, time.Now().UTC(), deliveryID, StatusDead,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// EventsAfter returns up to limit events with an ID above afterID in ID order, for consumers that read the outbox directly
+func EventsAfter(ctx context.Context, db *sql.DB, afterID int64, limit int) ([]Payload, error) {
+	return queryEvents(ctx, db,
+		"SELECT event_id, event_type, created_at, payload FROM webhook_event WHERE event_id > ? ORDER BY event_id LIMIT ?",
+		afterID, limit,
+	)
+}
+
+// EventsIn returns the events among ids that exist, in ID order. Consumers use it to pick up events
+// whose transaction committed after events with higher IDs were already read.
+func EventsIn(ctx context.Context, db *sql.DB, ids []int64) ([]Payload, error) {
+	if len(ids) == 0 {
+		return []Payload{}, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return queryEvents(ctx, db,
+		"SELECT event_id, event_type, created_at, payload FROM webhook_event WHERE event_id IN ("+
+			strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")+") ORDER BY event_id",
+		args...,
+	)
+}
+
+func queryEvents(ctx context.Context, db *sql.DB, query string, args ...any) ([]Payload, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]Payload, 0)
+	for rows.Next() {
+		var e Payload
+		var data []byte
+		if err := rows.Scan(&e.ID, &e.Type, &e.CreatedAt, &data); err != nil {
+			return nil, err
+		}
+		e.Data = data
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// LatestEventID returns the ID of the newest event, 0 when there is none
+func LatestEventID(ctx context.Context, db *sql.DB) (int64, error) {
+	var id int64
+	err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(event_id), 0) FROM webhook_event").Scan(&id)
+	return id, err
+}
@@ -0,0 +1,171 @@
+// Package webhook notifies other campus systems of domain events. Changes write their event to an
+// outbox table in the same transaction, and a worker fans each event out to the matching
+// subscriptions and delivers it as an HMAC-signed POST with retries and a dead-letter state.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event types
+const (
+	EventPointOfContactCreated = "point_of_contact.created"
+	EventPointOfContactUpdated = "point_of_contact.updated"
+	EventAccommodationGranted  = "accommodation.granted"
+	EventDocumentUploaded      = "document.uploaded"
+	EventDocumentQuarantined   = "document.quarantined"
+	EventDocumentDeleted       = "document.deleted"
+
+	// AllEvents subscribes to every event type
+	AllEvents = "*"
+)
+
+// EventTypes lists the event types subscriptions can choose from
+var EventTypes = []string{
+	EventPointOfContactCreated,
+	EventPointOfContactUpdated,
+	EventAccommodationGranted,
+	EventDocumentUploaded,
+	EventDocumentQuarantined,
+	EventDocumentDeleted,
+}
+
+// Delivery states
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Piconex-Event"
+	HeaderDelivery  = "X-Piconex-Delivery"
+	HeaderSignature = "X-Piconex-Signature"
+)
+
+// Errors returned by Verify
+var (
+	ErrMissingSignature = errors.New("webhook: missing signature")
+	ErrBadSignature     = errors.New("webhook: signature mismatch")
+	ErrExpiredSignature = errors.New("webhook: signature timestamp outside tolerance")
+)
+
+// Payload is the JSON body POSTed to subscribers
+type Payload struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Enqueue writes an event to the outbox. It must run in the transaction of the change so the
+// event exists exactly when the change was committed.
+func Enqueue(ctx context.Context, tx *sql.Tx, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO webhook_event (event_type, payload, created_at) VALUES (?, ?, ?)",
+		eventType, payload, time.Now().UTC().Truncate(time.Microsecond),
+	)
+	return err
+}
+
+// NewSecret returns a random signing secret for a subscription
+func NewSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+// Sign returns the signature header value for a body sent at t, in the form "t=<unix>,v1=<hex>".
+// The HMAC-SHA256 covers "<unix>.<body>" so a captured request cannot be replayed later with a new timestamp.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + mac(secret, ts, body)
+}
+
+func mac(secret, ts string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify checks a signature header against the body, rejecting timestamps further than tolerance from now.
+// Receivers written in Go can use it as is.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	if header == "" {
+		return ErrMissingSignature
+	}
+	var ts string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrMissingSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrExpiredSignature
+	}
+
+	expected := mac(secret, ts, body)
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrBadSignature
+}
+
+// ValidateEvents checks a subscription's event list
+func ValidateEvents(events []string) error {
+	if len(events) == 0 {
+		return errors.New("at least one event is required")
+	}
+	for _, e := range events {
+		if e == AllEvents {
+			continue
+		}
+		known := false
+		for _, t := range EventTypes {
+			known = known || e == t
+		}
+		if !known {
+			return fmt.Errorf("unknown event %q", e)
+		}
+	}
+	return nil
+}
+
+// matches reports whether a subscription's comma-separated events include an event type
+func matches(events, eventType string) bool {
+	for _, e := range strings.Split(events, ",") {
+		if e == AllEvents || e == eventType {
+			return true
+		}
+	}
+	return false
+}
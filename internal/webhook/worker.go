@@ -0,0 +1,297 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Delivery tuning
+const (
+	// MaxAttempts is how many times a delivery is tried before it is marked dead
+	MaxAttempts = 8
+
+	batchSize   = 50
+	lease       = 2 * time.Minute
+	timeout     = 10 * time.Second
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+)
+
+// client does not follow redirects, a receiver answering 3xx fails the attempt instead of sending
+// the signed payload to wherever it points
+var client = &http.Client{
+	Timeout: timeout,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// Backoff returns how long to wait after the given number of failed attempts: 30s, 1m, 2m, ... capped at 6h
+func Backoff(attempts int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+// StartWorker dispatches new events and sends due deliveries on an interval until the context is cancelled
+func StartWorker(ctx context.Context, db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := Dispatch(ctx, db); err != nil {
+				log.Println("Webhook dispatch error:", err)
+			}
+			if _, err := Deliver(ctx, db); err != nil {
+				log.Println("Webhook delivery error:", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Dispatch fans undispatched events out to the active subscriptions that want them, returning how many events it handled.
+// SKIP LOCKED lets several server instances run the worker without dispatching an event twice.
+func Dispatch(ctx context.Context, db *sql.DB) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT event_id, event_type FROM webhook_event
+		WHERE dispatched_at IS NULL
+		ORDER BY event_id
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED`, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	type event struct {
+		id  int64
+		typ string
+	}
+	var events []event
+	for rows.Next() {
+		var e event
+		if err := rows.Scan(&e.id, &e.typ); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	// Loads the active subscriptions once for the whole batch
+	subs := map[int]string{}
+	rows, err = tx.QueryContext(ctx, "SELECT webhook_id, events FROM webhook_subscription WHERE active = TRUE")
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var id int
+		var types string
+		if err := rows.Scan(&id, &types); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		subs[id] = types
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	for _, e := range events {
+		for id, types := range subs {
+			if !matches(types, e.typ) {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT IGNORE INTO webhook_delivery (event_id, webhook_id, status, next_attempt_at, created_at)
+				VALUES (?, ?, ?, ?, ?)`,
+				e.id, id, StatusPending, now, now,
+			); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE webhook_event SET dispatched_at = ? WHERE event_id = ?", now, e.id); err != nil {
+			return 0, err
+		}
+	}
+	return len(events), tx.Commit()
+}
+
+// claimed is a delivery leased by this worker together with what is needed to send it
+type claimed struct {
+	deliveryID int64
+	attempts   int
+	url        string
+	secret     string
+	payload    Payload
+}
+
+// Deliver sends due deliveries of active subscriptions, returning how many it attempted.
+// Claimed deliveries are leased by pushing next_attempt_at forward, so a crash mid-send only delays them.
+func Deliver(ctx context.Context, db *sql.DB) (int, error) {
+	batch, err := claim(ctx, db)
+	if err != nil || len(batch) == 0 {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range batch {
+		wg.Add(1)
+		go func(c claimed) {
+			defer wg.Done()
+			code, err := send(ctx, c)
+			if err := record(ctx, db, c, code, err); err != nil {
+				log.Println("DB query error:", err)
+			}
+		}(c)
+	}
+	wg.Wait()
+	return len(batch), nil
+}
+
+func claim(ctx context.Context, db *sql.DB) ([]claimed, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	rows, err := tx.QueryContext(ctx, `
+		SELECT d.delivery_id, d.attempts, s.url, s.secret, e.event_id, e.event_type, e.created_at, e.payload
+		FROM webhook_delivery d
+		JOIN webhook_subscription s ON s.webhook_id = d.webhook_id
+		JOIN webhook_event e ON e.event_id = d.event_id
+		WHERE d.status = ? AND d.next_attempt_at <= ? AND s.active = TRUE
+		ORDER BY d.next_attempt_at
+		LIMIT ?
+		FOR UPDATE OF d SKIP LOCKED`,
+		StatusPending, now, batchSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var batch []claimed
+	for rows.Next() {
+		var c claimed
+		var data []byte
+		if err := rows.Scan(&c.deliveryID, &c.attempts, &c.url, &c.secret,
+			&c.payload.ID, &c.payload.Type, &c.payload.CreatedAt, &data); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c.payload.Data = data
+		batch = append(batch, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, c := range batch {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE webhook_delivery SET next_attempt_at = ? WHERE delivery_id = ?",
+			now.Add(lease), c.deliveryID,
+		); err != nil {
+			return nil, err
+		}
+	}
+	return batch, tx.Commit()
+}
+
+// send POSTs the signed payload, returning the response status code when one was received
+func send(ctx context.Context, c claimed) (int, error) {
+	body, err := json.Marshal(c.payload)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Piconex-Webhooks/1")
+	req.Header.Set(HeaderEvent, c.payload.Type)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(c.deliveryID, 10))
+	req.Header.Set(HeaderSignature, Sign(c.secret, time.Now(), body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// record stores the outcome of an attempt, scheduling a retry or marking the delivery dead
+func record(ctx context.Context, db *sql.DB, c claimed, code int, sendErr error) error {
+	now := time.Now().UTC()
+	attempts := c.attempts + 1
+	var statusCode *int
+	if code != 0 {
+		statusCode = &code
+	}
+
+	if sendErr == nil {
+		_, err := db.ExecContext(ctx, `
+			UPDATE webhook_delivery
+			SET status = ?, attempts = ?, last_attempt_at = ?, last_status_code = ?, last_error = NULL, delivered_at = ?
+			WHERE delivery_id = ?`,
+			StatusDelivered, attempts, now, statusCode, now, c.deliveryID,
+		)
+		return err
+	}
+
+	status, next := StatusPending, now.Add(Backoff(attempts))
+	if attempts >= MaxAttempts {
+		status = StatusDead
+		log.Printf("☠️ Webhook delivery %d to %s is dead after %d attempts: %v\n", c.deliveryID, c.url, attempts, sendErr)
+	}
+	msg := sendErr.Error()
+	if len(msg) > 1024 {
+		msg = msg[:1024]
+	}
+	_, err := db.ExecContext(ctx, `
+		UPDATE webhook_delivery
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_attempt_at = ?, last_status_code = ?, last_error = ?
+		WHERE delivery_id = ?`,
+		status, attempts, next, now, statusCode, strings.ToValidUTF8(msg, ""), c.deliveryID,
+	)
+	return err
+}
@@ -0,0 +1,278 @@
+package webhook
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/testdb"
+)
+
+type fakeEvent struct {
+	id         int64
+	typ        string
+	dispatched bool
+}
+
+type fakeSubscription struct {
+	id          int64
+	url, secret string
+	events      string
+}
+
+type fakeDelivery struct {
+	id, eventID, webhookID int64
+	status                 string
+	attempts               int64
+	next, lastAttempt      time.Time
+	lastCode               driver.Value
+	lastError              driver.Value
+}
+
+// outbox keeps the webhook tables in memory and answers the statements of the worker
+type outbox struct {
+	testdb.DB
+	mu         sync.Mutex
+	events     []*fakeEvent
+	subs       []*fakeSubscription
+	deliveries []*fakeDelivery
+}
+
+func newOutbox(subs ...*fakeSubscription) *outbox {
+	o := &outbox{subs: subs}
+	o.Query = o.query
+	o.Exec = o.exec
+	return o
+}
+
+func (o *outbox) delivery(id int64) *fakeDelivery {
+	for _, d := range o.deliveries {
+		if d.id == id {
+			return d
+		}
+	}
+	return nil
+}
+
+// due makes every pending delivery due now, as if its backoff had passed
+func (o *outbox) due() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, d := range o.deliveries {
+		d.next = time.Now().Add(-time.Second)
+	}
+}
+
+func (o *outbox) query(query string, args []driver.Value) (*testdb.Rows, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	rows := &testdb.Rows{}
+	switch {
+	case strings.Contains(query, "WHERE dispatched_at IS NULL"):
+		for _, e := range o.events {
+			if !e.dispatched {
+				rows.Values = append(rows.Values, []driver.Value{e.id, e.typ})
+			}
+		}
+
+	case strings.Contains(query, "SELECT webhook_id, events FROM webhook_subscription"):
+		for _, s := range o.subs {
+			rows.Values = append(rows.Values, []driver.Value{s.id, s.events})
+		}
+
+	case strings.Contains(query, "d.next_attempt_at <= ?"):
+		for _, d := range o.deliveries {
+			if d.status != args[0] || d.next.After(args[1].(time.Time)) {
+				continue
+			}
+			s := o.subs[d.webhookID-1]
+			e := o.events[d.eventID-1]
+			rows.Values = append(rows.Values, []driver.Value{d.id, d.attempts, s.url, s.secret, e.id, e.typ, time.Now(), []byte(`{"student_id":7}`)})
+		}
+
+	case strings.Contains(query, "ORDER BY d.delivery_id DESC"):
+		for i := len(o.deliveries) - 1; i >= 0; i-- {
+			d := o.deliveries[i]
+			if strings.Contains(query, "d.status = ?") && d.status != args[0] {
+				continue
+			}
+			rows.Values = append(rows.Values, []driver.Value{d.id, d.eventID, o.events[d.eventID-1].typ, d.webhookID,
+				o.subs[d.webhookID-1].url, d.status, d.attempts, d.next, d.lastAttempt, d.lastCode, d.lastError, nil})
+		}
+
+	default:
+		return nil, nil
+	}
+	return rows, nil
+}
+
+func (o *outbox) exec(query string, args []driver.Value) (testdb.Result, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	switch {
+	case strings.Contains(query, "INSERT IGNORE INTO webhook_delivery"):
+		o.deliveries = append(o.deliveries, &fakeDelivery{
+			id: int64(len(o.deliveries) + 1), eventID: args[0].(int64), webhookID: args[1].(int64),
+			status: args[2].(string), next: args[3].(time.Time),
+		})
+	case strings.Contains(query, "UPDATE webhook_event SET dispatched_at"):
+		o.events[args[1].(int64)-1].dispatched = true
+	case strings.Contains(query, "SET next_attempt_at = ? WHERE delivery_id = ?"):
+		o.delivery(args[1].(int64)).next = args[0].(time.Time)
+	case strings.Contains(query, "delivered_at = ?"):
+		d := o.delivery(args[5].(int64))
+		d.status, d.attempts, d.lastAttempt, d.lastCode = args[0].(string), args[1].(int64), args[2].(time.Time), args[3]
+	case strings.Contains(query, "last_error = ?"):
+		d := o.delivery(args[6].(int64))
+		d.status, d.attempts, d.next, d.lastAttempt = args[0].(string), args[1].(int64), args[2].(time.Time), args[3].(time.Time)
+		d.lastCode, d.lastError = args[4], args[5]
+	}
+	return testdb.Result{Affected: 1}, nil
+}
+
+func TestDispatchSignsDeliveries(t *testing.T) {
+	const secret = "whsec_test"
+	var got http.Header
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, body = r.Header.Clone(), must(io.ReadAll(r.Body))
+	}))
+	defer receiver.Close()
+
+	o := newOutbox(
+		&fakeSubscription{id: 1, url: receiver.URL, secret: secret, events: EventDocumentUploaded},
+		&fakeSubscription{id: 2, url: receiver.URL, secret: secret, events: EventAccommodationGranted},
+	)
+	o.events = []*fakeEvent{{id: 1, typ: EventDocumentUploaded}}
+	db := o.Open(t)
+	ctx := context.Background()
+
+	// Only the subscription to the event's type gets a delivery
+	if n, err := Dispatch(ctx, db); err != nil || n != 1 {
+		t.Fatalf("Dispatch = %d, %v", n, err)
+	}
+	if len(o.deliveries) != 1 || o.deliveries[0].webhookID != 1 || !o.events[0].dispatched {
+		t.Fatalf("deliveries = %+v", o.deliveries)
+	}
+	if n, err := Dispatch(ctx, db); err != nil || n != 0 {
+		t.Fatalf("a dispatched event was dispatched again: %d, %v", n, err)
+	}
+
+	if n, err := Deliver(ctx, db); err != nil || n != 1 {
+		t.Fatalf("Deliver = %d, %v", n, err)
+	}
+	if err := Verify(secret, got.Get(HeaderSignature), body, time.Minute); err != nil {
+		t.Fatalf("signature %q does not verify: %v", got.Get(HeaderSignature), err)
+	}
+	if !strings.HasPrefix(got.Get(HeaderSignature), "t=") || !strings.Contains(got.Get(HeaderSignature), ",v1=") {
+		t.Fatalf("signature header = %q, want t=<unix>,v1=<hex>", got.Get(HeaderSignature))
+	}
+	if err := Verify("whsec_other", got.Get(HeaderSignature), body, time.Minute); err != ErrBadSignature {
+		t.Fatalf("Verify with another secret = %v, want ErrBadSignature", err)
+	}
+	if got.Get(HeaderEvent) != EventDocumentUploaded || got.Get(HeaderDelivery) != "1" {
+		t.Fatalf("headers = %v", got)
+	}
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.ID != 1 || string(payload.Data) != `{"student_id":7}` {
+		t.Fatalf("payload = %s, %v", body, err)
+	}
+	if d := o.deliveries[0]; d.status != StatusDelivered || d.attempts != 1 {
+		t.Fatalf("delivery = %+v, want delivered after one attempt", d)
+	}
+}
+
+func TestDeliverRetriesUntilDead(t *testing.T) {
+	var calls int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	o := newOutbox(&fakeSubscription{id: 1, url: receiver.URL, secret: "whsec_test", events: AllEvents})
+	o.events = []*fakeEvent{{id: 1, typ: EventPointOfContactCreated}}
+	db := o.Open(t)
+	ctx := context.Background()
+	if _, err := Dispatch(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	d := o.deliveries[0]
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		o.due()
+		if n, err := Deliver(ctx, db); err != nil || n != 1 {
+			t.Fatalf("attempt %d: Deliver = %d, %v", attempt, n, err)
+		}
+		if d.attempts != int64(attempt) || d.lastCode != int64(http.StatusServiceUnavailable) {
+			t.Fatalf("attempt %d recorded %+v", attempt, d)
+		}
+		if attempt < MaxAttempts {
+			// Not due again until its backoff has passed
+			if d.status != StatusPending || d.next.Sub(d.lastAttempt) != Backoff(attempt) {
+				t.Fatalf("attempt %d scheduled %s later with status %s, want %s", attempt, d.next.Sub(d.lastAttempt), d.status, Backoff(attempt))
+			}
+			if n, _ := Deliver(ctx, db); n != 0 {
+				t.Fatalf("attempt %d was retried before its backoff", attempt)
+			}
+		}
+	}
+	if d.status != StatusDead || calls != MaxAttempts {
+		t.Fatalf("status %s after %d calls, want dead after %d", d.status, calls, MaxAttempts)
+	}
+
+	// A dead delivery is not sent again and shows up in the dead-letter listing
+	o.due()
+	if n, _ := Deliver(ctx, db); n != 0 || calls != MaxAttempts {
+		t.Fatalf("a dead delivery was sent again")
+	}
+	dead, err := Deliveries(ctx, db, DeliveryFilter{Status: StatusDead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].DeliveryID != 1 || dead[0].Attempts != MaxAttempts || dead[0].LastError == nil ||
+		dead[0].LastStatusCode == nil || *dead[0].LastStatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("dead letters = %+v", dead)
+	}
+	if pending, _ := Deliveries(ctx, db, DeliveryFilter{Status: StatusPending}); len(pending) != 0 {
+		t.Fatalf("pending = %+v", pending)
+	}
+}
+
+func TestDeliverDoesNotFollowRedirects(t *testing.T) {
+	var redirected bool
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer receiver.Close()
+
+	code, err := send(context.Background(), claimed{deliveryID: 1, url: receiver.URL, secret: "whsec_test"})
+	if redirected {
+		t.Fatal("the delivery followed a redirect")
+	}
+	if err == nil || code != http.StatusTemporaryRedirect {
+		t.Fatalf("send = %d, %v, want a failed attempt with status %d", code, err, http.StatusTemporaryRedirect)
+	}
+	if !strings.Contains(err.Error(), strconv.Itoa(http.StatusTemporaryRedirect)) {
+		t.Fatalf("error %q does not name the status", err)
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
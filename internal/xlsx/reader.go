@@ -0,0 +1,209 @@
+// Package xlsx reads and writes the subset of Office Open XML spreadsheets the
+// importer and exporter need: a single sheet of plain text and number cells.
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentType is the media type of .xlsx workbooks
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// ErrNoSheet is returned when a workbook has no worksheet
+var ErrNoSheet = errors.New("xlsx: workbook has no worksheet")
+
+// ReadRows returns every row of the first worksheet as strings. Missing cells are empty strings.
+func ReadRows(r io.ReaderAt, size int64) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := readSharedStrings(files["xl/sharedStrings.xml"])
+	if err != nil {
+		return nil, err
+	}
+
+	sheet, ok := files[sheetPath]
+	if !ok {
+		return nil, ErrNoSheet
+	}
+	return readSheet(sheet, shared)
+}
+
+// ExcelDate converts an Excel serial day number (e.g. "45123") to YYYY-MM-DD.
+// Values that are not serial numbers are returned unchanged.
+func ExcelDate(value string) string {
+	serial, err := strconv.ParseFloat(value, 64)
+	if err != nil || serial < 1 {
+		return value
+	}
+	// Excel counts from 1899-12-30 because of its 1900 leap year bug
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	return base.AddDate(0, 0, int(serial)).Format("2006-01-02")
+}
+
+// firstSheetPath follows the workbook relationships to the first sheet
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeFile(files["xl/workbook.xml"], &workbook); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", ErrNoSheet
+	}
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeFile(files["xl/_rels/workbook.xml.rels"], &rels); err != nil {
+		// Workbooks without relationships use the conventional name
+		return "xl/worksheets/sheet1.xml", nil
+	}
+
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[0].ID {
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+	}
+	return "xl/worksheets/sheet1.xml", nil
+}
+
+func readSharedStrings(f *zip.File) ([]string, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	var sst struct {
+		Items []struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if err := decodeFile(f, &sst); err != nil {
+		return nil, err
+	}
+
+	shared := make([]string, len(sst.Items))
+	for i, item := range sst.Items {
+		// Rich text is split into runs
+		if len(item.Runs) > 0 {
+			var b strings.Builder
+			for _, run := range item.Runs {
+				b.WriteString(run.Text)
+			}
+			shared[i] = b.String()
+			continue
+		}
+		shared[i] = item.Text
+	}
+	return shared, nil
+}
+
+func readSheet(f *zip.File, shared []string) ([][]string, error) {
+	var ws struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := decodeFile(f, &ws); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(ws.Rows))
+	for _, row := range ws.Rows {
+		values := []string{}
+		for i, c := range row.Cells {
+			// Cells may be sparse, the reference gives the real column
+			col := i
+			if c.Ref != "" {
+				col = columnIndex(c.Ref)
+			}
+			for len(values) <= col {
+				values = append(values, "")
+			}
+
+			switch c.Type {
+			case "s":
+				idx, err := strconv.Atoi(c.Value)
+				if err != nil || idx < 0 || idx >= len(shared) {
+					return nil, fmt.Errorf("xlsx: invalid shared string %q in %s", c.Value, c.Ref)
+				}
+				values[col] = shared[idx]
+			case "inlineStr":
+				values[col] = c.Inline
+			case "b":
+				values[col] = map[string]string{"1": "true", "0": "false"}[c.Value]
+			default:
+				values[col] = c.Value
+			}
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+// columnIndex converts a cell reference such as "AB12" to a zero-based column
+func columnIndex(ref string) int {
+	col := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A'+1)
+	}
+	return col - 1
+}
+
+func decodeFile(f *zip.File, v any) error {
+	if f == nil {
+		return ErrNoSheet
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	return xml.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
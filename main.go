@@ -10,17 +10,89 @@ import (
 	"time"
 
 	"github.com/Peter-Tabarani/PiconexBackend/internal"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/docversion"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/idempotency"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/scanner"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/schema"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/stream"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/trash"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/uploadpolicy"
 	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/webhook"
 )
 
 func main() {
-	dsn := "piconex:pjaplmTabs7!@tcp(178.156.189.138:3306)/piconexdb?parseTime=true"
-	db, err := utils.Connect(dsn)
+	db, err := utils.Connect(utils.DSN())
 	if err != nil {
 		log.Fatal("❌ Failed to connect to database:", err)
 	}
 	defer db.Close()
 
+	// Refuses to start against a database that is missing a migration the handlers read from
+	if err := schema.Check(context.Background(), db); err != nil {
+		log.Fatal("❌ Database schema is out of date:", err)
+	}
+	log.Println("✅ Database schema:", schema.Latest())
+
+	// Refuses to start with a malformed field encryption key instead of failing on the first request
+	if err := fieldcrypt.Check(); err != nil {
+		log.Fatal("❌ Invalid field encryption configuration:", err)
+	}
+	if fieldcrypt.CurrentKeyID() == "" {
+		log.Println("⚠️ Field encryption disabled, FIELD_ENCRYPTION_KEYS is not set")
+	}
+
+	// Refuses to start when the document store cannot be set up
+	if err := blobstore.Check(); err != nil {
+		log.Fatal("❌ Invalid document storage configuration:", err)
+	}
+	log.Println("✅ Document storage:", blobstore.Backend())
+
+	// Refuses to start when the malware scanner is misconfigured, an unreachable clamd only fails the scans
+	if err := scanner.Check(); err != nil {
+		log.Fatal("❌ Invalid document scanner configuration:", err)
+	}
+	if s, err := scanner.Default(); err == nil {
+		if c, ok := s.(*scanner.Clamd); ok {
+			if err := c.Ping(context.Background()); err != nil {
+				log.Println("⚠️ clamd is not reachable, uploads will be stored with scan_status error:", err)
+			}
+		}
+	}
+	if scanner.Backend() == "none" {
+		log.Println("⚠️ Document scanning is disabled (DOCUMENT_SCANNER is none or not set), uploads are stored and served unscanned")
+	} else {
+		log.Println("✅ Document scanner:", scanner.Backend())
+	}
+
+	// Refuses to start when the upload size limits or allowed types cannot be read
+	if err := uploadpolicy.Load(); err != nil {
+		log.Fatal("❌ Invalid upload policy configuration:", err)
+	}
+
+	// Hard deletes trashed records once they are older than the retention window
+	purgeCtx, stopPurger := context.WithCancel(context.Background())
+	defer stopPurger()
+	retention := time.Duration(utils.EnvInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour
+	trash.StartPurger(purgeCtx, db, retention, utils.EnvDuration("TRASH_PURGE_INTERVAL", time.Hour))
+
+	// Removes previous document versions the retention rules no longer keep
+	versionCtx, stopVersionPruner := context.WithCancel(context.Background())
+	defer stopVersionPruner()
+	docversion.StartPruner(versionCtx, db, docversion.RetentionFromEnv(), utils.EnvDuration("DOCUMENT_VERSION_PRUNE_INTERVAL", time.Hour))
+
+	// Forgets Idempotency-Key responses once their window has passed
+	idempotencyCtx, stopIdempotencyPurger := context.WithCancel(context.Background())
+	defer stopIdempotencyPurger()
+	idempotency.StartPurger(idempotencyCtx, db, utils.EnvDuration("IDEMPOTENCY_PURGE_INTERVAL", time.Hour))
+
+	// Sends queued domain events to webhook subscribers
+	webhookCtx, stopWebhooks := context.WithCancel(context.Background())
+	defer stopWebhooks()
+	webhook.StartWorker(webhookCtx, db, utils.EnvDuration("WEBHOOK_INTERVAL", 5*time.Second))
+
 	router := internal.NewRouter(db)
 
 	srv := &http.Server{
@@ -28,6 +100,9 @@ func main() {
 		Handler: router,
 	}
 
+	// Closes live activity streams so shutdown does not wait on them
+	srv.RegisterOnShutdown(stream.Shutdown)
+
 	// Run server in goroutine
 	go func() {
 		log.Println("✅ Server started on :8080")
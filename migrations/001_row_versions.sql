@@ -0,0 +1,6 @@
+-- Row versions used for ETags and If-Match optimistic concurrency.
+-- Points of contact and documentation share the version on their activity row.
+
+ALTER TABLE student ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE admin ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE activity ADD COLUMN version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,13 @@
+-- Soft delete markers for students, admins (both live on person) and documents.
+-- Trashed rows are hidden from default queries and hard deleted by the purger
+-- once they are older than TRASH_RETENTION_DAYS.
+
+ALTER TABLE person
+    ADD COLUMN deleted_at DATETIME NULL,
+    ADD COLUMN deleted_by INT NULL,
+    ADD INDEX idx_person_deleted_at (deleted_at);
+
+ALTER TABLE documentation
+    ADD COLUMN deleted_at DATETIME NULL,
+    ADD COLUMN deleted_by INT NULL,
+    ADD INDEX idx_documentation_deleted_at (deleted_at);
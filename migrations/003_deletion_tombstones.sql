@@ -0,0 +1,12 @@
+-- Tombstones record permanent deletions performed by the deletion service.
+-- summary holds the deletion plan (row counts per table and removed files).
+
+CREATE TABLE deletion_tombstone (
+    tombstone_id INT AUTO_INCREMENT PRIMARY KEY,
+    resource_type VARCHAR(64) NOT NULL,
+    resource_id INT NOT NULL,
+    deleted_by INT NULL,
+    deleted_at DATETIME NOT NULL,
+    summary JSON NOT NULL,
+    INDEX idx_deletion_tombstone_resource (resource_type, resource_id)
+);
@@ -0,0 +1,38 @@
+-- Append-only audit trail. Every entry stores the hash of its predecessor and
+-- its own SHA-256 hash so tampering breaks the chain (see GET /audit/verify).
+-- before_data/after_data/changes are TEXT rather than JSON so the stored bytes
+-- match the hashed bytes exactly.
+
+CREATE TABLE audit_log (
+    audit_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(6) NOT NULL,
+    actor_id INT NULL,
+    role VARCHAR(32) NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    resource_type VARCHAR(64) NOT NULL,
+    resource_id VARCHAR(255) NOT NULL,
+    before_data MEDIUMTEXT NULL,
+    after_data MEDIUMTEXT NULL,
+    changes MEDIUMTEXT NULL,
+    ip VARCHAR(64) NOT NULL,
+    request_id VARCHAR(64) NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL,
+    INDEX idx_audit_resource (resource_type, resource_id),
+    INDEX idx_audit_actor (actor_id),
+    INDEX idx_audit_created_at (created_at),
+    INDEX idx_audit_request (request_id)
+);
+
+-- Single row holding the latest hash, locked by writers to serialise the chain
+CREATE TABLE audit_chain_head (
+    id TINYINT PRIMARY KEY,
+    hash CHAR(64) NOT NULL
+);
+INSERT INTO audit_chain_head (id, hash) VALUES (1, '');
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
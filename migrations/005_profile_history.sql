@@ -0,0 +1,17 @@
+-- Versioned history of student and admin profiles. Each row is the full
+-- profile state at a row version plus the fields that changed to reach it.
+-- Rows with changed_by NULL and no changes are baselines captured on the first
+-- change after this table was introduced.
+
+CREATE TABLE profile_history (
+    history_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    profile_type VARCHAR(16) NOT NULL,
+    profile_id INT NOT NULL,
+    version INT NOT NULL,
+    changed_by INT NULL,
+    changed_at DATETIME NOT NULL,
+    changes MEDIUMTEXT NULL,
+    reverted_from INT NULL,
+    snapshot MEDIUMTEXT NOT NULL,
+    UNIQUE KEY uq_profile_history_version (profile_type, profile_id, version)
+);
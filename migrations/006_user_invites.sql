@@ -0,0 +1,15 @@
+-- One-time invites for logins created by the bulk student import. Only the
+-- SHA-256 of the token is stored; accepting an invite sets the password and
+-- stamps used_at.
+
+CREATE TABLE user_invite (
+    invite_id INT AUTO_INCREMENT PRIMARY KEY,
+    token_hash CHAR(64) NOT NULL,
+    user_id INT NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME NULL,
+    UNIQUE KEY uq_user_invite_token (token_hash),
+    KEY idx_user_invite_user (user_id),
+    CONSTRAINT fk_user_invite_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,41 @@
+-- Outbound webhooks. Handlers write domain events to webhook_event in the same
+-- transaction as the change; the worker fans each event out to the matching
+-- active subscriptions as webhook_delivery rows and sends them with retries.
+-- Deliveries that exhaust their attempts are marked dead and can be retried.
+
+CREATE TABLE webhook_subscription (
+    webhook_id INT AUTO_INCREMENT PRIMARY KEY,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    events VARCHAR(255) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at DATETIME NOT NULL,
+    created_by INT NULL
+);
+
+CREATE TABLE webhook_event (
+    event_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    event_type VARCHAR(64) NOT NULL,
+    payload JSON NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    dispatched_at DATETIME(6) NULL,
+    KEY idx_webhook_event_pending (dispatched_at, event_id)
+);
+
+CREATE TABLE webhook_delivery (
+    delivery_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    event_id BIGINT NOT NULL,
+    webhook_id INT NOT NULL,
+    status ENUM('pending', 'delivered', 'dead') NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME(6) NOT NULL,
+    last_attempt_at DATETIME(6) NULL,
+    last_status_code INT NULL,
+    last_error VARCHAR(1024) NULL,
+    delivered_at DATETIME(6) NULL,
+    created_at DATETIME(6) NOT NULL,
+    UNIQUE KEY uq_webhook_delivery (event_id, webhook_id),
+    KEY idx_webhook_delivery_due (status, next_attempt_at),
+    CONSTRAINT fk_webhook_delivery_event FOREIGN KEY (event_id) REFERENCES webhook_event (event_id) ON DELETE CASCADE,
+    CONSTRAINT fk_webhook_delivery_subscription FOREIGN KEY (webhook_id) REFERENCES webhook_subscription (webhook_id) ON DELETE CASCADE
+);
@@ -0,0 +1,19 @@
+-- Responses of POST requests sent with an Idempotency-Key header, kept per
+-- user and key so client retries replay the first response instead of
+-- creating duplicates. status is NULL while the first request is running.
+-- Rows are purged once expires_at has passed.
+
+CREATE TABLE idempotency_key (
+    user_id INT NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path VARCHAR(2048) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status INT NULL,
+    response_headers JSON NULL,
+    response_body MEDIUMBLOB NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    PRIMARY KEY (user_id, idempotency_key),
+    KEY idx_idempotency_key_expires (expires_at)
+);
@@ -0,0 +1,8 @@
+-- When an accommodation was granted or a disability recorded, shown on the
+-- student timeline. Rows from before this migration keep NULL because their
+-- date is unknown and are left off the timeline.
+
+ALTER TABLE stu_accom ADD COLUMN granted_at DATETIME NULL;
+ALTER TABLE stu_dis ADD COLUMN recorded_at DATETIME NULL;
+
+CREATE INDEX idx_profile_history_profile_changed ON profile_history (profile_type, profile_id, changed_at);
@@ -0,0 +1,14 @@
+-- Records the subtype of every activity so its type can be looked up in one
+-- query instead of probing each subtype table. Existing rows are backfilled
+-- from the subtype table that holds them.
+
+ALTER TABLE activity ADD COLUMN activity_type VARCHAR(32) NOT NULL DEFAULT '';
+
+UPDATE activity a JOIN point_of_contact poc ON poc.point_of_contact_id = a.activity_id
+SET a.activity_type = 'point_of_contact';
+UPDATE activity a JOIN specific_documentation sd ON sd.specific_documentation_id = a.activity_id
+SET a.activity_type = 'specific_documentation';
+UPDATE activity a JOIN personal_documentation pd ON pd.personal_documentation_id = a.activity_id
+SET a.activity_type = 'personal_documentation';
+
+CREATE INDEX idx_activity_type_datetime ON activity (activity_type, activity_datetime);
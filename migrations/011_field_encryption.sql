@@ -0,0 +1,14 @@
+-- Widens the person columns encrypted by internal/fieldcrypt to hold
+-- ciphertexts and adds the blind index used to look people up by email.
+-- birthday becomes text so it can be encrypted; existing dates keep their
+-- YYYY-MM-DD form. Existing rows stay readable as plaintext until
+-- "piconexctl rotate-field-keys" encrypts them and fills email_index.
+
+ALTER TABLE person
+	MODIFY email VARCHAR(512) NULL,
+	MODIFY phone_number VARCHAR(512) NULL,
+	MODIFY birthday VARCHAR(512) NULL,
+	MODIFY address VARCHAR(1024) NULL,
+	ADD COLUMN email_index CHAR(64) NULL;
+
+CREATE INDEX idx_person_email_index ON person (email_index);
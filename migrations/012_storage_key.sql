@@ -0,0 +1,13 @@
+-- Documents are addressed by a key in the document store (internal/blobstore)
+-- instead of an absolute path on the server, e.g. "specific/12_report.pdf".
+-- Files written under /home/piconex/database/files keep their place: the
+-- local store is rooted there, so their keys are the paths relative to it.
+-- To move to S3, copy the directory into the bucket keeping the relative
+-- paths and set DOCUMENT_STORAGE=s3.
+
+ALTER TABLE documentation
+	CHANGE COLUMN file_path storage_key VARCHAR(512) NOT NULL;
+
+UPDATE documentation
+SET storage_key = SUBSTRING(storage_key, CHAR_LENGTH('/home/piconex/database/files/') + 1)
+WHERE storage_key LIKE '/home/piconex/database/files/%';
@@ -0,0 +1,18 @@
+-- New uploads are stored under the SHA-256 of their content (internal/docstore)
+-- as "sha256/<first two hex digits>/<digest>", identical files share one blob.
+-- documentation.content_sha256 is checked on download; rows written before this
+-- migration keep their storage_key and a NULL digest. document_blob has one row
+-- per stored blob and is locked while a blob is written or released.
+-- "piconexctl verify-storage" reports missing, mismatched and unreferenced blobs.
+
+CREATE TABLE document_blob (
+	content_sha256 CHAR(64) NOT NULL PRIMARY KEY,
+	storage_key VARCHAR(512) NOT NULL,
+	size_bytes BIGINT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE documentation
+	ADD COLUMN content_sha256 CHAR(64) NULL;
+
+CREATE INDEX idx_documentation_content_sha256 ON documentation (content_sha256);
@@ -0,0 +1,13 @@
+-- Uploads are scanned for malware (internal/scanner) before they are stored.
+-- scan_status is unscanned, clean, infected or error; only clean and unscanned
+-- files can be downloaded. Infected files are moved below "quarantine/" in the
+-- document store and scan_signature names what was found. Existing rows start as
+-- unscanned, "piconexctl rescan-documents" scans them.
+
+ALTER TABLE documentation
+	ADD COLUMN scan_status VARCHAR(16) NOT NULL DEFAULT 'unscanned',
+	ADD COLUMN scan_signature VARCHAR(255) NULL,
+	ADD COLUMN scanned_at DATETIME NULL;
+
+CREATE INDEX idx_documentation_scan_status ON documentation (scan_status);
+CREATE INDEX idx_documentation_storage_key ON documentation (storage_key);
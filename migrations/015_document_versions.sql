@@ -0,0 +1,40 @@
+-- Specific and personal documents keep every uploaded file as a version
+-- (internal/docversion). documentation always mirrors its current version, named
+-- by documentation.current_version. superseded_at is set when a version stops
+-- being current and starts its retention period (DOCUMENT_VERSIONS_KEEP,
+-- DOCUMENT_VERSION_RETENTION_DAYS); the current version is never pruned.
+-- Versions of hard deleted documents are removed with them.
+
+CREATE TABLE documentation_version (
+	documentation_id INT NOT NULL,
+	version_number INT NOT NULL,
+	file_name VARCHAR(255) NOT NULL,
+	storage_key VARCHAR(512) NOT NULL,
+	content_sha256 CHAR(64) NULL,
+	mime_type VARCHAR(255) NOT NULL,
+	size_bytes BIGINT NOT NULL,
+	uploaded_by INT NULL,
+	scan_status VARCHAR(16) NOT NULL DEFAULT 'unscanned',
+	scan_signature VARCHAR(255) NULL,
+	scanned_at DATETIME NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	superseded_at DATETIME NULL,
+	PRIMARY KEY (documentation_id, version_number)
+);
+
+CREATE INDEX idx_documentation_version_storage_key ON documentation_version (storage_key);
+CREATE INDEX idx_documentation_version_content_sha256 ON documentation_version (content_sha256);
+CREATE INDEX idx_documentation_version_superseded_at ON documentation_version (superseded_at);
+
+ALTER TABLE documentation
+	ADD COLUMN current_version INT NOT NULL DEFAULT 1;
+
+-- Every existing document becomes version 1 of itself
+INSERT INTO documentation_version (
+	documentation_id, version_number, file_name, storage_key, content_sha256, mime_type, size_bytes,
+	uploaded_by, scan_status, scan_signature, scanned_at, created_at
+)
+SELECT d.documentation_id, 1, d.file_name, d.storage_key, d.content_sha256, d.mime_type, d.size_bytes,
+	d.uploaded_by, d.scan_status, d.scan_signature, d.scanned_at, a.activity_datetime
+FROM documentation d
+JOIN activity a ON a.activity_id = d.documentation_id;
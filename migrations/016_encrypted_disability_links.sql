@@ -0,0 +1,30 @@
+-- Rebuilds stu_dis so the disability of a link can be encrypted by
+-- internal/fieldcrypt (column stu_dis.disability_id, see internal/disabilitylink).
+-- Sealed links keep disability_id NULL, the ciphertext in disability_ref and a
+-- blind index in disability_index, which also enforces one link per student and
+-- disability. The foreign key to disability cannot cover sealed links, so
+-- deleting a disability removes its links in the application instead.
+-- Existing rows stay readable as plaintext until "piconexctl rotate-field-keys"
+-- seals them.
+
+RENAME TABLE stu_dis TO stu_dis_plain;
+
+CREATE TABLE stu_dis (
+	stu_dis_id INT NOT NULL AUTO_INCREMENT,
+	student_id INT NOT NULL,
+	disability_id INT NULL,
+	disability_ref VARCHAR(512) NULL,
+	disability_index CHAR(64) NULL,
+	recorded_at DATETIME NULL,
+	PRIMARY KEY (stu_dis_id),
+	UNIQUE KEY uq_stu_dis_disability_id (student_id, disability_id),
+	UNIQUE KEY uq_stu_dis_disability_index (student_id, disability_index),
+	KEY idx_stu_dis_disability_id (disability_id),
+	KEY idx_stu_dis_disability_index (disability_index),
+	CONSTRAINT fk_stu_dis_student FOREIGN KEY (student_id) REFERENCES student (student_id)
+);
+
+INSERT INTO stu_dis (student_id, disability_id, recorded_at)
+SELECT student_id, disability_id, recorded_at FROM stu_dis_plain;
+
+DROP TABLE stu_dis_plain;
@@ -0,0 +1,12 @@
+-- Makes the email blind index of person unique, so two people can never end
+-- up with the same email once it is encrypted. Rows not encrypted yet keep
+-- email_index NULL, which a unique key allows any number of times.
+-- Trashed people keep their email until they are purged.
+-- The ALTER fails while two people already share an email; list them with
+--   SELECT email_index, COUNT(*) FROM person WHERE email_index IS NOT NULL
+--   GROUP BY email_index HAVING COUNT(*) > 1;
+-- and change or merge them before running it again.
+
+ALTER TABLE person
+	DROP INDEX idx_person_email_index,
+	ADD UNIQUE KEY uq_person_email_index (email_index);
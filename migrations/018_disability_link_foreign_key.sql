@@ -0,0 +1,14 @@
+-- Restores the foreign key from stu_dis to disability that 016 left out when
+-- it rebuilt the table. A foreign key only checks values that are not NULL,
+-- and sealed links keep disability_id NULL, so it covers every plaintext link
+-- without getting in the way of sealed ones. Deleting a disability still
+-- removes its links in the application first, the sealed ones included.
+-- Plaintext links left pointing at a deleted disability since 016 are removed
+-- so the key can be added.
+
+DELETE FROM stu_dis
+WHERE disability_id IS NOT NULL
+	AND disability_id NOT IN (SELECT disability_id FROM disability);
+
+ALTER TABLE stu_dis
+	ADD CONSTRAINT fk_stu_dis_disability FOREIGN KEY (disability_id) REFERENCES disability (disability_id);
@@ -11,6 +11,12 @@ cd $BACKEND_DIR
 echo "[$(date)] 🔨 Building backend..." >> "$LOG_FILE"
 go build -o main main.go >> "$LOG_FILE" 2>&1
 
+# Keeps the running backend when a migration has not been applied, the new build would refuse to start
+if ! go run ./scripts/piconexctl schema-check >> "$LOG_FILE" 2>&1; then
+    echo "[$(date)] ❌ Database schema is out of date, apply the new files in migrations/ and restart again." >> "$LOG_FILE"
+    exit 1
+fi
+
 # Find running backend PID
 PID=$(pgrep -f main)
 
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/schema"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// checkSchema fails when a migration the server relies on has not been applied, so a deploy can
+// stop before replacing a running server with one that refuses to start
+func checkSchema(args []string) error {
+	flags := flag.NewFlagSet("schema-check", flag.ExitOnError)
+	flags.Parse(args)
+
+	db, err := utils.Connect(utils.DSN())
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+
+	if err := schema.Check(context.Background(), db); err != nil {
+		return err
+	}
+	fmt.Println("✅ Database schema is up to date with", schema.Latest())
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/filecrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// encryptDocuments encrypts the stored documents in place with the current field encryption key,
+// moves files off older keys and verifies that every file decrypts to its recorded size
+func encryptDocuments(args []string) error {
+	flags := flag.NewFlagSet("encrypt-documents", flag.ExitOnError)
+	verify := flags.Bool("verify", false, "only check that every document decrypts, without rewriting anything")
+	flags.Parse(args)
+
+	if err := fieldcrypt.Check(); err != nil {
+		return err
+	}
+
+	store, err := blobstore.Default()
+	if err != nil {
+		return err
+	}
+
+	db, err := utils.Connect(utils.DSN())
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+
+	result, err := filecrypt.Migrate(context.Background(), db, store, *verify)
+
+	out, jsonErr := json.MarshalIndent(result, "", "  ")
+	if jsonErr != nil {
+		return jsonErr
+	}
+	fmt.Println(string(out))
+	if err == nil && len(result.Failed) > 0 {
+		err = fmt.Errorf("%d documents failed", len(result.Failed))
+	}
+	return err
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/graph"
+)
+
+// printGraphQLSchema writes the schema served at /graphql in SDL, for client code generators
+func printGraphQLSchema(args []string) error {
+	fmt.Print(graph.Schema.SDL())
+	return nil
+}
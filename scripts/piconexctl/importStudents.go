@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/importer"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// importStudents runs the same import as POST /student/import and prints the report as JSON
+func importStudents(args []string) error {
+	flags := flag.NewFlagSet("import-students", flag.ExitOnError)
+	file := flags.String("file", "", "CSV or XLSX file to import (required)")
+	mapping := flags.String("mapping", "", `column mapping, e.g. "Given Name=first_name,Surname=last_name"`)
+	mode := flags.String("mode", importer.ModeTransaction, "transaction (all or nothing) or per-row")
+	dryRun := flags.Bool("dry-run", false, "validate every row and roll back")
+	createLogins := flags.Bool("create-logins", false, "create student logins with invite tokens")
+	inviteTTL := flags.Duration("invite-ttl", 7*24*time.Hour, "how long invite tokens stay valid")
+	flags.Parse(args)
+
+	if *file == "" {
+		flags.Usage()
+		return errors.New("-file is required")
+	}
+
+	columns, err := importer.ParseMapping(*mapping)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rows, err := importer.ReadTable(f)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", *file, err)
+	}
+
+	db, err := utils.Connect(utils.DSN())
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+
+	report, err := importer.Run(context.Background(), db, rows, importer.Options{
+		Mapping:      columns,
+		Mode:         *mode,
+		DryRun:       *dryRun,
+		CreateLogins: *createLogins,
+		InviteTTL:    *inviteTTL,
+	})
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d rows failed", report.Failed, len(report.Rows))
+	}
+	return nil
+}
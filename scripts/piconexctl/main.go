@@ -0,0 +1,61 @@
+// Command piconexctl runs maintenance tasks against the Piconex database.
+// The database is taken from DATABASE_DSN, defaulting to the server's DSN.
+//
+//	go run ./scripts/piconexctl <command> [flags]
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// commands maps each subcommand to its implementation, which receives the remaining arguments
+var commands = map[string]struct {
+	usage string
+	run   func(args []string) error
+}{
+	"encrypt-documents": {"encrypt stored documents in place and verify that every file decrypts", encryptDocuments},
+	"graphql-schema":    {"print the GraphQL schema served at /graphql", printGraphQLSchema},
+	"import-students":   {"bulk create or update students from a CSV or XLSX file", importStudents},
+	"openapi":           {"print the OpenAPI document generated from the routes", printOpenAPI},
+	"openapi-check":     {"fail when a route is missing from the API documentation", checkOpenAPI},
+	"rescan-documents":  {"scan stored documents for malware again and quarantine infected ones", rescanDocuments},
+	"rotate-field-keys": {"re-encrypt sensitive columns with the current key and rebuild blind indexes", rotateFieldKeys},
+	"schema-check":      {"fail when a migration from migrations/ has not been applied", checkSchema},
+	"verify-storage":    {"check stored documents against their digests and report missing, mismatched and unreferenced blobs", verifyStorage},
+	"webhook-receiver":  {"run a local endpoint that verifies and prints webhook deliveries", webhookReceiver},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		log.Fatal("❌ ", err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: piconexctl <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", name, commands[name].usage)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/openapi"
+)
+
+// printOpenAPI writes the document served at /openapi.json to stdout. No database is needed,
+// the router is only walked.
+func printOpenAPI(args []string) error {
+	spec, err := openapi.Build(internal.NewRouter(nil))
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(spec)
+}
+
+// checkOpenAPI lists routes missing from the documentation and documented operations without a route.
+// It exits non-zero on any problem so it can gate builds.
+func checkOpenAPI(args []string) error {
+	problems, err := openapi.Check(internal.NewRouter(nil))
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d API documentation problems", len(problems))
+	}
+	fmt.Printf("✅ Every route is documented (%d operations)\n", len(openapi.Operations))
+	return nil
+}
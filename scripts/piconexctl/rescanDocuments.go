@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/scanner"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// rescanDocuments scans stored documents with the configured scanner, quarantining infected
+// ones. It exits non-zero when it finds infected files or cannot scan some.
+func rescanDocuments(args []string) error {
+	flags := flag.NewFlagSet("rescan-documents", flag.ExitOnError)
+	all := flags.Bool("all", false, "scan every document again, not only unscanned ones and failed scans")
+	flags.Parse(args)
+
+	s, err := scanner.Default()
+	if errors.Is(err, scanner.ErrDisabled) {
+		return errors.New("set DOCUMENT_SCANNER to eicar or clamd to rescan documents")
+	}
+	if err != nil {
+		return err
+	}
+	if err := fieldcrypt.Check(); err != nil {
+		return err
+	}
+	store, err := blobstore.Default()
+	if err != nil {
+		return err
+	}
+
+	db, err := utils.Connect(utils.DSN())
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+
+	report, err := scanner.Rescan(context.Background(), db, store, s, *all)
+
+	out, jsonErr := json.MarshalIndent(report, "", "  ")
+	if jsonErr != nil {
+		return jsonErr
+	}
+	fmt.Println(string(out))
+	if err == nil && !report.OK() {
+		err = fmt.Errorf("%d infected, %d could not be scanned", len(report.Infected), len(report.Failed))
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// rotateFieldKeys re-encrypts the encrypted columns with the current key and rebuilds the blind
+// indexes. It also encrypts plaintext rows, so it is the first step after enabling encryption.
+func rotateFieldKeys(args []string) error {
+	flags := flag.NewFlagSet("rotate-field-keys", flag.ExitOnError)
+	batch := flags.Int("batch", 500, "rows rewritten per transaction")
+	force := flags.Bool("force", false, "re-encrypt values already sealed with the current key")
+	generate := flags.Bool("generate-key", false, "print a new random key for FIELD_ENCRYPTION_KEYS or FIELD_BLIND_INDEX_KEY and exit")
+	flags.Parse(args)
+
+	if *generate {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		fmt.Println(base64.StdEncoding.EncodeToString(key))
+		return nil
+	}
+
+	if err := fieldcrypt.Check(); err != nil {
+		return err
+	}
+	if fieldcrypt.CurrentKeyID() == "" {
+		return fieldcrypt.ErrDisabled
+	}
+
+	db, err := utils.Connect(utils.DSN())
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+
+	result, err := fieldcrypt.Rotate(context.Background(), db, *batch, *force)
+
+	out, jsonErr := json.MarshalIndent(result, "", "  ")
+	if jsonErr != nil {
+		return jsonErr
+	}
+	fmt.Println(string(out))
+	return err
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/blobstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/docstore"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/fieldcrypt"
+	"github.com/Peter-Tabarani/PiconexBackend/internal/utils"
+)
+
+// verifyStorage reads every stored document back and reports missing, mismatched and
+// unreferenced blobs. It exits non-zero when it finds any.
+func verifyStorage(args []string) error {
+	flags := flag.NewFlagSet("verify-storage", flag.ExitOnError)
+	flags.Parse(args)
+
+	if err := fieldcrypt.Check(); err != nil {
+		return err
+	}
+	store, err := blobstore.Default()
+	if err != nil {
+		return err
+	}
+
+	db, err := utils.Connect(utils.DSN())
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer db.Close()
+
+	report, err := docstore.VerifyStorage(context.Background(), db, store)
+
+	out, jsonErr := json.MarshalIndent(report, "", "  ")
+	if jsonErr != nil {
+		return jsonErr
+	}
+	fmt.Println(string(out))
+	if err == nil && !report.OK() {
+		err = fmt.Errorf("%d missing, %d mismatched, %d unreferenced", len(report.Missing), len(report.Mismatched), len(report.Unreferenced))
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Peter-Tabarani/PiconexBackend/internal/webhook"
+)
+
+// webhookReceiver runs a local HTTP endpoint that verifies and prints webhook deliveries.
+// Subscribe it with POST /webhook {"url": "http://localhost:9000/", "events": ["*"], "secret": "<secret>"}.
+func webhookReceiver(args []string) error {
+	flags := flag.NewFlagSet("webhook-receiver", flag.ExitOnError)
+	addr := flags.String("addr", ":9000", "address to listen on")
+	secret := flags.String("secret", "", "subscription secret used to verify signatures (required)")
+	fail := flags.Int("fail", 0, "answer the first N deliveries with 500 to exercise retries")
+	tolerance := flags.Duration("tolerance", 5*time.Minute, "accepted clock skew of signature timestamps")
+	flags.Parse(args)
+
+	if *secret == "" {
+		flags.Usage()
+		return errors.New("-secret is required")
+	}
+
+	var received atomic.Int64
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "read error", http.StatusBadRequest)
+			return
+		}
+
+		delivery := r.Header.Get(webhook.HeaderDelivery)
+		if err := webhook.Verify(*secret, r.Header.Get(webhook.HeaderSignature), body, *tolerance); err != nil {
+			log.Printf("❌ delivery %s rejected: %v\n", delivery, err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if n := received.Add(1); n <= int64(*fail) {
+			log.Printf("💥 delivery %s failed on purpose (%d/%d)\n", delivery, n, *fail)
+			http.Error(w, "failing on purpose", http.StatusInternalServerError)
+			return
+		}
+
+		var pretty bytes.Buffer
+		json.Indent(&pretty, body, "", "  ")
+		log.Printf("✅ delivery %s %s\n%s\n", delivery, r.Header.Get(webhook.HeaderEvent), pretty.String())
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	log.Println("✅ Webhook receiver listening on", *addr)
+	return http.ListenAndServe(*addr, handler)
+}